@@ -42,6 +42,13 @@ var (
 	filterNamespaces = flagSet.String("filter-namespaces", "", "filter namespaces while in learner role for pd")
 	balanceVer       = flagSet.String("balance-ver", "", "balance strategy version")
 	balanceInterval  = common.StringArray{}
+
+	tlsCertFile       = flagSet.String("tls-cert-file", "", "the certificate file for tls")
+	tlsKeyFile        = flagSet.String("tls-key-file", "", "the key file for tls")
+	tlsCAFile         = flagSet.String("tls-ca-file", "", "the ca file to verify the peer certificate")
+	tlsServerName     = flagSet.String("tls-server-name", "", "the server name to verify the data node certificate")
+	tlsClientCertAuth = flagSet.Bool("tls-client-cert-auth", false, "require the client certificate for the tls http api")
+	tlsHTTPAPI        = flagSet.Bool("tls-http-api", false, "serve the http api with tls")
 )
 
 func init() {
@@ -38,6 +38,7 @@ const (
 func help() {
 	log.Println("Usage:")
 	log.Println("\t", os.Args[0], "[-data restore] -lookup lookuplist -ns namespace -table table_name [-qps 1000]")
+	log.Println("\t", os.Args[0], "-pitr_src partition_data_dir -pitr_dst new_partition_data_dir [-pitr_archive archive_root_dir] [-to_time time] [-to_index index]")
 	os.Exit(0)
 }
 
@@ -377,6 +378,10 @@ func main() {
 
 	flagSet.Parse(os.Args[1:])
 
+	if *pitrSrc != "" {
+		pitrRestore()
+		return
+	}
 	checkParameter()
 
 	tm = time.Duration(1000000 / *qps) * time.Microsecond
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	pitrSrc        = flagSet.String("pitr_src", "", "the partition data dir with the checkpoints for point-in-time restore")
+	pitrDst        = flagSet.String("pitr_dst", "", "the new partition data dir for the restored data")
+	pitrArchive    = flagSet.String("pitr_archive", "", "the root dir of the archived raft logs, default is the raft_archive dir next to the partition data dir")
+	toTime         = flagSet.String("to_time", "", "restore to the time, format: 2006-01-02 15:04:05 in local time zone")
+	toIndex        = flagSet.Uint64("to_index", 0, "restore to the raft index")
+	dataVersion    = flagSet.String("data_version", "", "the data version of the namespace")
+	expPolicy      = flagSet.String("expiration_policy", common.DefaultExpirationPolicy, "the expiration policy of the namespace")
+	rotationPeriod = flagSet.Int64("expiration_rotation_period", 0, "the bucket time range in seconds of the periodical rotation policy, 0 for the default")
+	engType        = flagSet.String("engine_type", "", "the rocksdb engine type, default is rocksdb")
+)
+
+func pitrRestore() {
+	var ts int64
+	if *toTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", *toTime, time.Local)
+		if err != nil {
+			log.Printf("invalid restore time: %v, %v\n", *toTime, err)
+			return
+		}
+		ts = t.UnixNano()
+	}
+	if ts == 0 && *toIndex == 0 {
+		log.Println("Error:must specify the restore time or raft index")
+		help()
+	}
+	if *pitrDst == "" {
+		log.Println("Error:must specify the data dir for the restored partition")
+		help()
+	}
+	ep, err := common.StringToExpirationPolicy(*expPolicy)
+	if err != nil {
+		log.Printf("invalid expiration policy: %v\n", err)
+		return
+	}
+	dv, err := common.StringToDataVersionType(*dataVersion)
+	if err != nil {
+		log.Printf("invalid data version: %v\n", err)
+		return
+	}
+	kvOpts := &node.KVOptions{
+		DataDir:          *pitrDst,
+		EngType:          rockredis.EngType,
+		ExpirationPolicy: ep,
+		DataVersion:      dv,
+
+		ExpirationRotationPeriod: *rotationPeriod,
+	}
+	kvOpts.RockOpts.EngineType = *engType
+	engine.FillDefaultOptions(&kvOpts.RockOpts)
+
+	stop := make(chan struct{})
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sc
+		close(stop)
+	}()
+	info, err := node.RestorePointInTime(kvOpts, *pitrSrc, *pitrArchive, *toIndex, ts, stop)
+	if err != nil {
+		log.Printf("point-in-time restore failed: %v\n", err)
+		return
+	}
+	log.Printf("restored from checkpoint %v-%v to raft log %v-%v at %v\n",
+		info.CheckpointTerm, info.CheckpointIndex, info.Term, info.Index, time.Unix(0, info.Timestamp))
+}
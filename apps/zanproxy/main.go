@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/proxy"
+
+	"github.com/BurntSushi/toml"
+	"github.com/judwhite/go-svc/svc"
+	"github.com/mreiferson/go-options"
+)
+
+var (
+	flagSet = flag.NewFlagSet("zanproxy", flag.ExitOnError)
+
+	config      = flagSet.String("config", "", "path to config file")
+	logAge      = flagSet.Int("logage", 0, "the max age (day) log will keep")
+	showVersion = flagSet.Bool("version", false, "print version string")
+
+	redisAddress  = flagSet.String("redis-address", "0.0.0.0:16379", "<addr>:<port> to listen on for redis clients")
+	metricAddress = flagSet.String("metric-address", ":8801", "<addr>:<port> to listen on for HTTP metric clients")
+	profilePort   = flagSet.String("profile-port", "6668", "<port> for golang profile")
+
+	password    = flagSet.String("password", "", "the password used to auth the data nodes")
+	requirePass = flagSet.String("require-pass", "", "the password the redis client should auth")
+	authFile    = flagSet.String("auth-file", "", "the json file with the users and acls for the redis clients")
+	hashPass    = flagSet.String("hash-password", "", "print the password hash for the user in the auth file and exit")
+
+	maxActiveConn  = flagSet.Int("max-active-conn", 100, "the max active connections to the data nodes for each namespace")
+	maxIdleConn    = flagSet.Int("max-idle-conn", 20, "the max idle connections to the data nodes for each namespace")
+	dialTimeoutMs  = flagSet.Int("dial-timeout-ms", 3000, "dial timeout (ms) to the data nodes")
+	readTimeoutMs  = flagSet.Int("read-timeout-ms", 5000, "read timeout (ms) to the data nodes")
+	writeTimeoutMs = flagSet.Int("write-timeout-ms", 5000, "write timeout (ms) to the data nodes")
+	tendInterval   = flagSet.Int64("tend-interval", 3, "the interval (second) to refresh the partition leaders")
+
+	logLevel   = flagSet.Int("log-level", 1, "log verbose level")
+	logDir     = flagSet.String("log-dir", "", "directory for log file")
+	lookupList = common.StringArray{}
+	namespaces = common.StringArray{}
+)
+
+func init() {
+	flagSet.Var(&lookupList, "lookup-list", "the placedriver http address list")
+	flagSet.Var(&namespaces, "namespaces", "the namespaces allowed to access through the proxy")
+}
+
+type program struct {
+	proxy *proxy.Server
+}
+
+func main() {
+	defer common.FlushZapDefault()
+	prg := &program{}
+	if err := svc.Run(prg, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGINT); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (p *program) Init(env svc.Environment) error {
+	if env.IsWindowsService() {
+		dir := filepath.Dir(os.Args[0])
+		return os.Chdir(dir)
+	}
+	return nil
+}
+
+func (p *program) Start() error {
+	flagSet.Parse(os.Args[1:])
+	fmt.Println(common.VerString("zanproxy"))
+	if *showVersion {
+		os.Exit(0)
+	}
+	if *hashPass != "" {
+		fmt.Println(common.HashAuthPassword(*hashPass))
+		os.Exit(0)
+	}
+
+	var cfg map[string]interface{}
+	if *config != "" {
+		_, err := toml.DecodeFile(*config, &cfg)
+		if err != nil {
+			log.Fatalf("ERROR: failed to load config file %s - %s", *config, err.Error())
+		}
+	}
+
+	opts := proxy.NewServerConfig()
+	options.Resolve(opts, flagSet, cfg)
+	common.SetZapRotateOptions(false, true, path.Join(opts.LogDir, "zanproxy.log"), 0, 0, *logAge)
+	daemon, err := proxy.NewServer(opts)
+	if err != nil {
+		return err
+	}
+
+	daemon.Start()
+	p.proxy = daemon
+	return nil
+}
+
+func (p *program) Stop() error {
+	if p.proxy != nil {
+		p.proxy.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mreiferson/go-options"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/proxy"
+)
+
+func TestAppConfigParse(t *testing.T) {
+	flagSet.Parse([]string{})
+
+	configFile := "../../proxy/proxy.example.conf"
+	var cfg map[string]interface{}
+	_, err := toml.DecodeFile(configFile, &cfg)
+	if err != nil {
+		t.Fatalf("ERROR: failed to load config file %s - %s", configFile, err.Error())
+	}
+	opts := proxy.NewServerConfig()
+	options.Resolve(opts, flagSet, cfg)
+	opts.LogDir = path.Join(os.TempDir(), strconv.Itoa(int(time.Now().UnixNano())))
+	os.MkdirAll(opts.LogDir, 0755)
+	common.SetZapRotateOptions(false, true, path.Join(opts.LogDir, "test.log"), 0, 0, 0)
+	assert.Equal(t, []string{"127.0.0.1:18001"}, opts.LookupList)
+	assert.Equal(t, 0, len(opts.Namespaces))
+	assert.Equal(t, int64(3), opts.TendInterval)
+
+	opts.RedisAddress = "127.0.0.1:0"
+	opts.MetricAddress = "127.0.0.1:0"
+	opts.ProfilePort = ""
+	s, err := proxy.NewServer(opts)
+	assert.Nil(t, err)
+	s.Start()
+	time.Sleep(time.Second)
+	s.Stop()
+}
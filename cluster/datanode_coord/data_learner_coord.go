@@ -124,7 +124,9 @@ func (dc *DataCoordinator) ensureJoinNamespaceGroupForLearner(nsInfo cluster.Par
 	}
 
 	dyConf := &node.NamespaceDynamicConf{
-		nsInfo.Replica,
+		Replicator:   nsInfo.Replica,
+		PartitionNum: nsInfo.PartitionNum,
+		Quota:        nsInfo.Quota,
 	}
 	localNamespace.SetDynamicInfo(*dyConf)
 	if localNamespace.IsDataNeedFix() {
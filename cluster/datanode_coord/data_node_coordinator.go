@@ -157,6 +157,27 @@ func (dc *DataCoordinator) GetSyncerNormalInit() (bool, error) {
 	return dc.getRegisterKV("syncer_normal_init")
 }
 
+// GetClusterAuthInfo read the auth info saved by placement driver, return empty
+// auth info if the placement driver never set it.
+func (dc *DataCoordinator) GetClusterAuthInfo() (*common.AuthInfo, error) {
+	if dc.register == nil {
+		return nil, errors.New("missing register")
+	}
+	var info common.AuthInfo
+	v, err := dc.register.GetKV(cluster.AuthInfoKVKey)
+	if err != nil {
+		if err == cluster.ErrKeyNotFound {
+			return &info, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(v), &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
 func (dc *DataCoordinator) updateRegisterKV(k string, v bool) error {
 	if dc.register == nil {
 		return errors.New("missing register")
@@ -243,7 +264,7 @@ func (dc *DataCoordinator) Start() error {
 
 		dc.wg.Add(1)
 		go dc.checkForUnsyncedNamespaces()
-	} else if common.IsRoleLogSyncer(dc.learnerRole) {
+	} else if common.IsRoleLogSyncer(dc.learnerRole) || common.IsRoleCDC(dc.learnerRole) {
 		dc.loadLocalNamespaceForLearners()
 		dc.wg.Add(1)
 		go dc.checkForUnsyncedLogSyncers()
@@ -337,6 +358,10 @@ func (dc *DataCoordinator) loadLocalNamespaceData() error {
 			if namespaceName == "" {
 				continue
 			}
+			if !dc.isSplitSeedReady(&nsInfo) {
+				cluster.CoordLog().Infof("namespace %v waiting split seed", nsInfo.GetDesp())
+				continue
+			}
 
 			localNamespace, coordErr := dc.updateLocalNamespace(&nsInfo, false)
 			if coordErr != nil {
@@ -370,7 +395,7 @@ func (dc *DataCoordinator) isLocalRaftInRaftGroup(nsInfo *cluster.PartitionMetaI
 		destAddress := net.JoinHostPort(nip, httpPort)
 		var rsp []*common.MemberInfo
 		code, err := common.APIRequest("GET",
-			"http://"+destAddress+common.APIGetMembers+"/"+nsInfo.GetDesp(),
+			common.HTTPScheme()+"://"+destAddress+common.APIGetMembers+"/"+nsInfo.GetDesp(),
 			nil, cluster.APIShortTo, &rsp)
 		if err != nil {
 			cluster.CoordLog().Infof("failed to get members from %v for namespace: %v, %v", destAddress, nsInfo.GetDesp(), err)
@@ -578,7 +603,7 @@ func (dc *DataCoordinator) isReplicaReadyForRaft(nsNode *node.NamespaceNode, toR
 		if checkAll {
 			nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nodeID)
 			code, err := common.APIRequest("GET",
-				"http://"+net.JoinHostPort(nip, httpPort)+common.APINodeAllReady,
+				common.HTTPScheme()+"://"+net.JoinHostPort(nip, httpPort)+common.APINodeAllReady,
 				nil, cluster.APILongTo, nil)
 			if err != nil {
 				cluster.CoordLog().Infof("not ready from %v for transfer leader: %v, %v", nip, code, err.Error())
@@ -667,6 +692,7 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 		if atomic.LoadInt32(&dc.stopping) == 1 {
 			return
 		}
+		dc.syncSplitRouting()
 		// try load local namespace if any namespace raft group changed
 		err := dc.loadLocalNamespaceData()
 		if err != nil {
@@ -736,6 +762,8 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 				dc.forceRemoveLocalNamespace(localNamespace)
 				continue
 			}
+			dc.checkLocalSplit(namespaceMeta, localNamespace)
+			dc.checkLocalRestore(namespaceMeta, localNamespace)
 			leader := dc.getNamespaceRaftLeader(namespaceMeta)
 			isrList := namespaceMeta.GetISR()
 			if localRID != namespaceMeta.RaftIDs[dc.GetMyID()] {
@@ -963,9 +991,11 @@ func (dc *DataCoordinator) prepareNamespaceConf(nsInfo *cluster.PartitionMetaInf
 	if nsInfo.ExpirationPolicy != "" {
 		nsConf.ExpirationPolicy = nsInfo.ExpirationPolicy
 	}
+	nsConf.ExpirationRotationPeriod = nsInfo.ExpirationRotationPeriod
 	if nsInfo.DataVersion != "" {
 		nsConf.DataVersion = nsInfo.DataVersion
 	}
+	nsConf.RestoreFrom = nsInfo.RestoreFrom
 	if nsInfo.SnapCount > 100 {
 		nsConf.SnapCount = nsInfo.SnapCount
 		nsConf.SnapCatchup = nsInfo.SnapCount / 4
@@ -1024,9 +1054,9 @@ func (dc *DataCoordinator) requestJoinNamespaceGroup(raftID uint64, nsInfo *clus
 	}
 	nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(remoteNode)
 	d, _ := json.Marshal(m)
-	uri := "http://" + net.JoinHostPort(nip, httpPort) + common.APIAddNode
+	uri := common.HTTPScheme() + "://" + net.JoinHostPort(nip, httpPort) + common.APIAddNode
 	if joinAsLearner {
-		uri = "http://" + net.JoinHostPort(nip, httpPort) + common.APIAddLearnerNode
+		uri = common.HTTPScheme() + "://" + net.JoinHostPort(nip, httpPort) + common.APIAddLearnerNode
 	}
 	_, err := common.APIRequest("POST",
 		uri,
@@ -1081,7 +1111,9 @@ func (dc *DataCoordinator) ensureJoinNamespaceGroup(nsInfo cluster.PartitionMeta
 	}
 
 	dyConf := &node.NamespaceDynamicConf{
-		nsInfo.Replica,
+		Replicator:   nsInfo.Replica,
+		PartitionNum: nsInfo.PartitionNum,
+		Quota:        nsInfo.Quota,
 	}
 	localNamespace.SetDynamicInfo(*dyConf)
 	if localNamespace.IsDataNeedFix() {
@@ -1237,7 +1269,9 @@ func (dc *DataCoordinator) updateLocalNamespace(nsInfo *cluster.PartitionMetaInf
 		return localNode, cluster.ErrLocalInitNamespaceFailed
 	}
 	dyConf := &node.NamespaceDynamicConf{
-		nsConf.Replicator,
+		Replicator:   nsConf.Replicator,
+		PartitionNum: nsInfo.PartitionNum,
+		Quota:        nsInfo.Quota,
 	}
 	localNode.SetDynamicInfo(*dyConf)
 	if err := localNode.Start(forceStandaloneCluster); err != nil {
@@ -1445,3 +1479,37 @@ func (dc *DataCoordinator) Stats(namespace string, part int) *cluster.CoordStats
 	}
 	return s
 }
+
+// GetNamespacePartitions return the cached partitions info (including the leader) of the namespace,
+// the partitions are ordered by the partition id.
+func (dc *DataCoordinator) GetNamespacePartitions(namespace string) ([]*cluster.PartitionMetaInfo, error) {
+	meta, err := dc.register.GetNamespaceMetaInfo(namespace)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*cluster.PartitionMetaInfo, 0, meta.PartitionNum)
+	for i := 0; i < meta.PartitionNum; i++ {
+		nsInfo, err := dc.register.GetNamespacePartInfo(namespace, i)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, nsInfo)
+	}
+	return parts, nil
+}
+
+// GetPeerDataNodes return the other data nodes in the cluster, the learners are excluded
+func (dc *DataCoordinator) GetPeerDataNodes() ([]cluster.NodeInfo, error) {
+	nodes, err := dc.register.GetDataNodes()
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]cluster.NodeInfo, 0, len(nodes))
+	for _, n := range nodes {
+		if n.GetID() == dc.GetMyID() || n.LearnerRole != "" {
+			continue
+		}
+		peers = append(peers, n)
+	}
+	return peers, nil
+}
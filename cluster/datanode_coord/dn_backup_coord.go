@@ -0,0 +1,19 @@
+package datanode_coord
+
+import (
+	"github.com/youzan/ZanRedisDB/cluster"
+	node "github.com/youzan/ZanRedisDB/node"
+)
+
+// check the restore state for the local partition of the namespace restored from backup
+func (dc *DataCoordinator) checkLocalRestore(nsInfo *cluster.PartitionMetaInfo, localNamespace *node.NamespaceNode) {
+	if !nsInfo.IsRestoring() || !localNamespace.Node.IsLead() {
+		return
+	}
+	if localNamespace.Node.IsRestoreSeeding() {
+		// all the replicas are seeded from the same backup files, the snapshot should be
+		// saved before the new replica added.
+		cluster.CoordLog().Infof("namespace %v force snapshot for restore seed", nsInfo.GetDesp())
+		localNamespace.Node.BackupDB(false)
+	}
+}
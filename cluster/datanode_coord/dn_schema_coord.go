@@ -8,6 +8,65 @@ import (
 	node "github.com/youzan/ZanRedisDB/node"
 )
 
+const (
+	indexChangeNone = iota
+	indexChangeAdd
+	indexChangeUpdate
+	indexChangeDelete
+)
+
+// check if we need propose the updated index state
+func getIndexChangeOp(nsName string, table string, index interface{}, state common.IndexState,
+	localExist bool, localState common.IndexState) int {
+	if !localExist {
+		if state == common.DeletedIndex {
+			return indexChangeNone
+		}
+		if state != common.InitIndex {
+			cluster.CoordLog().Warningf("namespace %v update index state invalid: %v, local index not init",
+				nsName, index)
+			return indexChangeNone
+		}
+		cluster.CoordLog().Infof("namespace %v init new index : %v, table: %v",
+			nsName, index, table)
+		return indexChangeAdd
+	}
+	if state == localState {
+		return indexChangeNone
+	}
+	switch state {
+	case common.BuildingIndex:
+		if localState == common.InitIndex {
+			cluster.CoordLog().Infof("namespace %v index start to build : %v, %v",
+				nsName, index, table)
+			return indexChangeUpdate
+		}
+	case common.ReadyIndex:
+		if localState == common.BuildDoneIndex {
+			cluster.CoordLog().Infof("namespace %v index ready for read: %v, %v",
+				nsName, index, table)
+			return indexChangeUpdate
+		}
+	case common.InitIndex:
+		// maybe rebuild, wait current done
+		if localState == common.BuildDoneIndex ||
+			localState == common.ReadyIndex ||
+			localState == common.DeletedIndex {
+			cluster.CoordLog().Warningf("namespace %v rebuild index: %v for table %v, local index state: %v",
+				nsName, index, table, localState)
+			return indexChangeUpdate
+		}
+	case common.DeletedIndex:
+		// remove local
+		if localState == common.BuildDoneIndex ||
+			localState == common.ReadyIndex {
+			return indexChangeDelete
+		}
+	default:
+	}
+	return indexChangeNone
+}
+
 // this will only be handled on leader of raft group
 func (dc *DataCoordinator) doSyncSchemaInfo(localNamespace *node.NamespaceNode,
 	indexSchemas map[string]*common.IndexSchema) {
@@ -17,12 +76,16 @@ func (dc *DataCoordinator) doSyncSchemaInfo(localNamespace *node.NamespaceNode,
 	for table, tindexes := range indexSchemas {
 		localIndexSchema, err := localNamespace.Node.GetIndexSchema(table)
 		schemaMap := make(map[string]*common.HsetIndexSchema)
+		jsonSchemaMap := make(map[string]*common.JSONIndexSchema)
 		if err == nil {
 			localTableIndexSchema, ok := localIndexSchema[table]
 			if ok {
 				for _, v := range localTableIndexSchema.HsetIndexes {
 					schemaMap[v.Name] = v
 				}
+				for _, v := range localTableIndexSchema.JSONIndexes {
+					jsonSchemaMap[v.Name] = v
+				}
 			}
 		}
 		for _, hindex := range tindexes.HsetIndexes {
@@ -33,60 +96,47 @@ func (dc *DataCoordinator) doSyncSchemaInfo(localNamespace *node.NamespaceNode,
 			}
 			sc.SchemaData, _ = json.Marshal(hindex)
 
-			// check if we need propose the updated index state
+			var localState common.IndexState
 			localHIndex, ok := schemaMap[hindex.Name]
-			if !ok {
-				if hindex.State == common.DeletedIndex {
-					continue
-				}
-				if hindex.State != common.InitIndex {
-					cluster.CoordLog().Warningf("namespace %v update index state invalid: %v, local index not init",
-						localNamespace.FullName(), hindex)
-					continue
-				}
-				cluster.CoordLog().Infof("namespace %v init new index : %v, table: %v",
-					localNamespace.FullName(), hindex, table)
+			if ok {
+				localState = localHIndex.State
+			}
+			switch getIndexChangeOp(localNamespace.FullName(), table, hindex, hindex.State, ok, localState) {
+			case indexChangeAdd:
 				localNamespace.Node.ProposeChangeTableSchema(table, sc)
-			} else if hindex.State == localHIndex.State {
-			} else {
-				switch hindex.State {
-				case common.BuildingIndex:
-					if localHIndex.State == common.InitIndex {
-						cluster.CoordLog().Infof("namespace %v index start to build : %v, %v",
-							localNamespace.FullName(), hindex, table)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.ReadyIndex:
-					if localHIndex.State == common.BuildDoneIndex {
-						cluster.CoordLog().Infof("namespace %v index ready for read: %v, %v",
-							localNamespace.FullName(), hindex, table)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.InitIndex:
-					// maybe rebuild, wait current done
-					if localHIndex.State == common.BuildDoneIndex ||
-						localHIndex.State == common.ReadyIndex ||
-						localHIndex.State == common.DeletedIndex {
-						cluster.CoordLog().Warningf("namespace %v rebuild index: %v for table %v, local index state: %v",
-							localNamespace.FullName(), hindex, table, localHIndex)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.DeletedIndex:
-					// remove local
-					if localHIndex.State == common.BuildDoneIndex ||
-						localHIndex.State == common.ReadyIndex {
-						sc.Type = node.SchemaChangeDeleteHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				default:
-				}
+			case indexChangeUpdate:
+				sc.Type = node.SchemaChangeUpdateHsetIndex
+				localNamespace.Node.ProposeChangeTableSchema(table, sc)
+			case indexChangeDelete:
+				sc.Type = node.SchemaChangeDeleteHsetIndex
+				localNamespace.Node.ProposeChangeTableSchema(table, sc)
+			default:
 			}
 		}
-		for _, jsonIndex := range tindexes.JSONIndexes {
-			_ = jsonIndex
+		for _, jindex := range tindexes.JSONIndexes {
+			sc := &node.SchemaChange{
+				Type:       node.SchemaChangeAddJSONIndex,
+				Table:      table,
+				SchemaData: nil,
+			}
+			sc.SchemaData, _ = json.Marshal(jindex)
+
+			var localState common.IndexState
+			localJIndex, ok := jsonSchemaMap[jindex.Name]
+			if ok {
+				localState = localJIndex.State
+			}
+			switch getIndexChangeOp(localNamespace.FullName(), table, jindex, jindex.State, ok, localState) {
+			case indexChangeAdd:
+				localNamespace.Node.ProposeChangeTableSchema(table, sc)
+			case indexChangeUpdate:
+				sc.Type = node.SchemaChangeUpdateJSONIndex
+				localNamespace.Node.ProposeChangeTableSchema(table, sc)
+			case indexChangeDelete:
+				sc.Type = node.SchemaChangeDeleteJSONIndex
+				localNamespace.Node.ProposeChangeTableSchema(table, sc)
+			default:
+			}
 		}
 	}
 }
@@ -0,0 +1,66 @@
+package datanode_coord
+
+import (
+	"time"
+
+	"github.com/youzan/ZanRedisDB/cluster"
+	"github.com/youzan/ZanRedisDB/common"
+	node "github.com/youzan/ZanRedisDB/node"
+)
+
+// check if the new partition created by split can be loaded on local node, the new partition
+// should be seeded by the checkpoint saved while applying the split barrier of the parent partition.
+func (dc *DataCoordinator) isSplitSeedReady(nsInfo *cluster.PartitionMetaInfo) bool {
+	if !nsInfo.IsSplitting() || nsInfo.Partition < nsInfo.PartitionNum {
+		return true
+	}
+	parentPid := nsInfo.Partition - nsInfo.PartitionNum
+	parentName := common.GetNsDesp(nsInfo.Name, parentPid)
+	if dc.localNSMgr.IsSplitSeedReady(parentName, nsInfo.GetDesp()) {
+		return true
+	}
+	parent := dc.localNSMgr.GetNamespaceNode(parentName)
+	if parent != nil && parent.IsReady() && parent.Node.IsLead() {
+		cluster.CoordLog().Infof("namespace %v propose split barrier for new partition %v",
+			parentName, nsInfo.GetDesp())
+		err := parent.Node.ProposeSplitBarrier(nsInfo.SplitPartitionNum, parentPid)
+		if err != nil {
+			cluster.CoordLog().Infof("namespace %v propose split barrier failed: %v", parentName, err)
+		}
+	}
+	dc.tryCheckNamespacesIn(time.Second * 5)
+	return false
+}
+
+// switch the routing for all the split namespaces from the same register scan, it should be
+// done before loading the local namespaces which may take long.
+func (dc *DataCoordinator) syncSplitRouting() {
+	if dc.localNSMgr == nil {
+		return
+	}
+	allNamespaces, _, err := dc.register.GetAllNamespaces()
+	if err != nil {
+		return
+	}
+	for ns, parts := range allNamespaces {
+		for _, p := range parts {
+			dc.localNSMgr.UpdateNamespacePartitionNum(ns, p.PartitionNum)
+			break
+		}
+	}
+}
+
+// check the split state for the local partition
+func (dc *DataCoordinator) checkLocalSplit(nsInfo *cluster.PartitionMetaInfo, localNamespace *node.NamespaceNode) {
+	dc.localNSMgr.UpdateNamespacePartitionNum(nsInfo.Name, nsInfo.PartitionNum)
+	if localNamespace.Node.IsLead() && localNamespace.Node.IsSplitSeeding() {
+		// the seed data is not in raft logs, make sure the snapshot is saved so the
+		// new partition can be fully ready. The routing may be switched before that.
+		cluster.CoordLog().Infof("namespace %v force snapshot for split seed", nsInfo.GetDesp())
+		localNamespace.Node.BackupDB(false)
+	}
+	if !nsInfo.IsSplitting() {
+		// the routing is switched, the moved keys can be cleaned
+		localNamespace.Node.CleanSplitMovedKeys(nsInfo.PartitionNum)
+	}
+}
@@ -147,7 +147,7 @@ func (pdCoord *PDCoordinator) DeleteNamespace(ns string, partition string) error
 		if err != nil {
 			cluster.CoordLog().Infof("failed to get meta for namespace: %v", err)
 		}
-		for pid := 0; pid < meta.PartitionNum; pid++ {
+		for pid := 0; pid < meta.MaxPartitionNum(); pid++ {
 			err := pdCoord.deleteNamespacePartition(ns, pid)
 			if err != nil {
 				cluster.CoordLog().Infof("failed to delete namespace partition %v for namespace: %v, err:%v", pid, ns, err)
@@ -195,6 +195,9 @@ func (pdCoord *PDCoordinator) ChangeNamespaceMetaParam(namespace string, newRepl
 			cluster.CoordLog().Infof("get namespace key %v failed :%v", namespace, err)
 			return err
 		}
+		if oldMeta.IsSplitting() {
+			return ErrNamespaceSplitting
+		}
 		currentNodes := pdCoord.getCurrentNodes(oldMeta.Tags)
 		meta = oldMeta
 		if newReplicator > 0 {
@@ -217,6 +220,56 @@ func (pdCoord *PDCoordinator) ChangeNamespaceMetaParam(namespace string, newRepl
 	return nil
 }
 
+// ChangeNamespaceQuota update the quota for the namespace if table is empty, otherwise
+// update the quota for the table. The empty limit will remove the quota.
+func (pdCoord *PDCoordinator) ChangeNamespaceQuota(namespace string, table string, limit common.QuotaLimit) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while change namespace quota")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(namespace) {
+		return errors.New("invalid namespace name")
+	}
+	if limit.MaxKeys < 0 || limit.MaxDiskBytes < 0 || limit.MaxReadQPS < 0 || limit.MaxWriteQPS < 0 {
+		return errors.New("invalid quota limit")
+	}
+	if ok, _ := pdCoord.register.IsExistNamespace(namespace); !ok {
+		cluster.CoordLog().Infof("namespace not exist %v ", namespace)
+		return cluster.ErrNamespaceNotCreated.ToErrorType()
+	}
+	oldMeta, err := pdCoord.register.GetNamespaceMetaInfo(namespace)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", namespace, err)
+		return err
+	}
+	meta := oldMeta.DeepClone()
+	quota := meta.Quota
+	if quota == nil {
+		quota = &common.NamespaceQuota{}
+	}
+	if table == "" {
+		quota.QuotaLimit = limit
+	} else if limit.IsEmpty() {
+		delete(quota.Tables, table)
+	} else {
+		if quota.Tables == nil {
+			quota.Tables = make(map[string]common.QuotaLimit)
+		}
+		quota.Tables[table] = limit
+	}
+	if quota.IsEmpty() {
+		quota = nil
+	}
+	meta.Quota = quota
+	err = pdCoord.register.UpdateNamespaceMetaInfo(namespace, &meta, oldMeta.MetaEpoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v quota failed :%v", namespace, err)
+		return err
+	}
+	cluster.CoordLog().Infof("namespace %v quota changed, table: %v, %v", namespace, table, limit)
+	return nil
+}
+
 func (pdCoord *PDCoordinator) updateNamespaceMeta(currentNodes map[string]cluster.NodeInfo, namespace string, meta *cluster.NamespaceMetaInfo) error {
 	cluster.CoordLog().Infof("update namespace: %v, with meta: %v", namespace, meta)
 
@@ -324,6 +377,15 @@ func (pdCoord *PDCoordinator) DelHIndexSchema(namespace string, table string, hi
 	return pdCoord.delHIndexSchema(namespace, table, hindexName)
 }
 
+func (pdCoord *PDCoordinator) AddJSONIndexSchema(namespace string, table string, jindex *common.JSONIndexSchema) error {
+	jindex.State = common.InitIndex
+	return pdCoord.addJSONIndexSchema(namespace, table, jindex)
+}
+
+func (pdCoord *PDCoordinator) DelJSONIndexSchema(namespace string, table string, jindexName string) error {
+	return pdCoord.delJSONIndexSchema(namespace, table, jindexName)
+}
+
 func (pdCoord *PDCoordinator) RemoveLearnerFromNs(ns string, pidStr string, nid string) error {
 	if pidStr == "**" {
 		oldMeta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
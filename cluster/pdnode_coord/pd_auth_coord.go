@@ -0,0 +1,86 @@
+package pdnode_coord
+
+import (
+	"encoding/json"
+
+	"github.com/youzan/ZanRedisDB/cluster"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func (pdCoord *PDCoordinator) GetClusterAuthInfo() (*common.AuthInfo, error) {
+	var info common.AuthInfo
+	v, err := pdCoord.register.GetKV(cluster.AuthInfoKVKey)
+	if err != nil {
+		if err == cluster.ErrKeyNotFound {
+			return &info, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(v), &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (pdCoord *PDCoordinator) saveClusterAuthInfo(info *common.AuthInfo) error {
+	d, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return pdCoord.register.SaveKV(cluster.AuthInfoKVKey, string(d))
+}
+
+// SwitchClusterAuth enable or disable the auth on all the data nodes, the data nodes will
+// refresh the auth info from register in the background.
+func (pdCoord *PDCoordinator) SwitchClusterAuth(enable bool) error {
+	if !pdCoord.IsMineLeader() {
+		return ErrNotLeader
+	}
+	info, err := pdCoord.GetClusterAuthInfo()
+	if err != nil {
+		return err
+	}
+	if enable && len(info.Users) == 0 {
+		return common.ErrAuthInvalidUser
+	}
+	info.Enabled = enable
+	cluster.CoordLog().Infof("cluster auth enable changed to: %v", enable)
+	return pdCoord.saveClusterAuthInfo(info)
+}
+
+func (pdCoord *PDCoordinator) AddOrUpdateAuthUser(user common.AuthUser) error {
+	if !pdCoord.IsMineLeader() {
+		return ErrNotLeader
+	}
+	info, err := pdCoord.GetClusterAuthInfo()
+	if err != nil {
+		return err
+	}
+	info, err = info.AddOrUpdateUser(user)
+	if err != nil {
+		return err
+	}
+	cluster.CoordLog().Infof("cluster auth user %v updated, acls: %v", user.Name, user.ACLs)
+	return pdCoord.saveClusterAuthInfo(info)
+}
+
+func (pdCoord *PDCoordinator) DelAuthUser(name string) error {
+	if !pdCoord.IsMineLeader() {
+		return ErrNotLeader
+	}
+	info, err := pdCoord.GetClusterAuthInfo()
+	if err != nil {
+		return err
+	}
+	if info.GetUser(name) == nil {
+		return cluster.ErrKeyNotFound
+	}
+	info = info.DelUser(name)
+	if info.Enabled && len(info.Users) == 0 {
+		// avoid lock all the clients out
+		return common.ErrAuthInvalidUser
+	}
+	cluster.CoordLog().Infof("cluster auth user %v deleted", name)
+	return pdCoord.saveClusterAuthInfo(info)
+}
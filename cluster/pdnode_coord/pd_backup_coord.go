@@ -0,0 +1,182 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/cluster"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var (
+	ErrNamespaceRestoring = errors.New("the namespace is restoring from backup")
+	errBackupMetaChanged  = errors.New("the namespace meta changed while backup")
+)
+
+// the export will copy all the checkpoint files to the backup target
+var backupExportTimeout = time.Hour
+
+// BackupNamespace start the backup for all the partitions of the namespace at the same time,
+// all the partitions are exported at the same cut timestamp proposed by the placement driver.
+// Each partition leader will export the checkpoint and the archived raft logs to replay up to
+// the cut to the backup directory under the target. The manifest of the backup is saved after
+// all the partitions exported, so the target should be the filesystem shared by the placement
+// driver and all the data nodes.
+func (pdCoord *PDCoordinator) BackupNamespace(ns string, target string) (string, *common.NamespaceBackupManifest, error) {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while backup namespace")
+		return "", nil, ErrNotLeader
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return "", nil, err
+	}
+	if meta.IsSplitting() {
+		return "", nil, ErrNamespaceSplitting
+	}
+	if meta.IsRestoring() {
+		return "", nil, ErrNamespaceRestoring
+	}
+	leaders := make([]string, 0, meta.PartitionNum)
+	for pid := 0; pid < meta.PartitionNum; pid++ {
+		part, err := pdCoord.register.GetNamespacePartInfo(ns, pid)
+		if err != nil {
+			cluster.CoordLog().Infof("get namespace %v-%v info failed :%v", ns, pid, err)
+			return "", nil, err
+		}
+		if part.GetRealLeader() == "" {
+			cluster.CoordLog().Infof("namespace %v has no leader for backup", part.GetDesp())
+			return "", nil, ErrClusterUnstable
+		}
+		leaders = append(leaders, part.GetRealLeader())
+	}
+
+	begin := time.Now()
+	backupDir := path.Join(target, ns+"-"+begin.Format("20060102150405"))
+	err = os.MkdirAll(backupDir, common.DIR_PERM)
+	if err != nil {
+		return "", nil, err
+	}
+	m := &common.NamespaceBackupManifest{
+		Namespace:        ns,
+		PartitionNum:     meta.PartitionNum,
+		Replica:          meta.Replica,
+		EngType:          meta.EngType,
+		OptimizedFsync:   meta.OptimizedFsync,
+		ExpirationPolicy: meta.ExpirationPolicy,
+		DataVersion:      meta.DataVersion,
+		BackupTime:       begin.UnixNano(),
+		Partitions:       make([]common.PartitionBackupInfo, meta.PartitionNum),
+		CutTs:            begin.UnixNano(),
+
+		ExpirationRotationPeriod: meta.ExpirationRotationPeriod,
+	}
+	cluster.CoordLog().Infof("begin backup namespace %v to %v at cut %v", ns, backupDir, m.CutTs)
+	errs := make([]error, meta.PartitionNum)
+	var wg sync.WaitGroup
+	for pid, leader := range leaders {
+		wg.Add(1)
+		go func(pid int, leader string) {
+			defer wg.Done()
+			nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(leader)
+			_, errs[pid] = common.APIRequest("POST",
+				common.HTTPScheme()+"://"+net.JoinHostPort(nip, httpPort)+common.APIBackupExport+"/"+common.GetNsDesp(ns, pid)+
+					"?dir="+url.QueryEscape(backupDir)+"&cut_ts="+strconv.FormatInt(m.CutTs, 10),
+				nil, backupExportTimeout, &m.Partitions[pid])
+		}(pid, leader)
+	}
+	wg.Wait()
+	for pid, err := range errs {
+		if err != nil {
+			cluster.CoordLog().Infof("namespace %v-%v export backup failed: %v", ns, pid, err)
+			return "", nil, err
+		}
+	}
+	// the partitions should not be changed by split while exporting
+	newMeta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		return "", nil, err
+	}
+	if newMeta.PartitionNum != meta.PartitionNum || newMeta.IsSplitting() {
+		return "", nil, errBackupMetaChanged
+	}
+	err = common.SaveBackupManifest(backupDir, m)
+	if err != nil {
+		cluster.CoordLog().Infof("save backup manifest for %v failed: %v", ns, err)
+		return "", nil, err
+	}
+	cluster.CoordLog().Infof("backup namespace %v to %v done, cost: %v", ns, backupDir, time.Since(begin))
+	return backupDir, m, nil
+}
+
+// RestoreNamespace create the new namespace from the backup, the partitions of the new
+// namespace will be seeded from the backup files on all the replicas.
+func (pdCoord *PDCoordinator) RestoreNamespace(ns string, backupDir string, replica int, tags map[string]interface{}) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while restore namespace")
+		return ErrNotLeader
+	}
+	m, err := common.LoadBackupManifest(backupDir)
+	if err != nil {
+		cluster.CoordLog().Infof("load backup manifest from %v failed: %v", backupDir, err)
+		return err
+	}
+	var meta cluster.NamespaceMetaInfo
+	meta.PartitionNum = m.PartitionNum
+	meta.Replica = replica
+	if meta.Replica <= 0 {
+		meta.Replica = m.Replica
+	}
+	meta.EngType = m.EngType
+	meta.OptimizedFsync = m.OptimizedFsync
+	meta.ExpirationPolicy = m.ExpirationPolicy
+	meta.ExpirationRotationPeriod = m.ExpirationRotationPeriod
+	meta.DataVersion = m.DataVersion
+	meta.Tags = tags
+	meta.RestoreFrom = backupDir
+	cluster.CoordLog().Infof("restore namespace %v from backup %v of %v", ns, backupDir, m.Namespace)
+	return pdCoord.CreateNamespace(ns, meta)
+}
+
+// check the restoring namespaces and finish the restore if all the partitions are ready
+func (pdCoord *PDCoordinator) doRestoreCheck() {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return
+	}
+	for ns, parts := range allNamespaces {
+		meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+		if err != nil || !meta.IsRestoring() {
+			continue
+		}
+		isReady := true
+		for pid := 0; pid < meta.PartitionNum; pid++ {
+			part, ok := parts[pid]
+			if !ok || len(part.RaftNodes) == 0 || part.GetRealLeader() == "" {
+				isReady = false
+				break
+			}
+			if ok, err := IsAllISRFullReady(&part); err != nil || !ok {
+				cluster.CoordLog().Infof("namespace %v is not full ready for restore", part.GetDesp())
+				isReady = false
+				break
+			}
+		}
+		if !isReady {
+			continue
+		}
+		cluster.CoordLog().Infof("namespace %v restore from %v done", ns, meta.RestoreFrom)
+		meta.RestoreFrom = ""
+		err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+		if err != nil {
+			cluster.CoordLog().Infof("update namespace %v meta failed: %v", ns, err)
+		}
+	}
+}
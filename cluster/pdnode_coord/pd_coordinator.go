@@ -17,9 +17,10 @@ import (
 )
 
 var (
-	ErrAlreadyExist    = errors.New("already exist")
-	ErrNotLeader       = errors.New("Not leader")
-	ErrClusterUnstable = errors.New("the cluster is unstable")
+	ErrAlreadyExist       = errors.New("already exist")
+	ErrNotLeader          = errors.New("Not leader")
+	ErrClusterUnstable    = errors.New("the cluster is unstable")
+	ErrNamespaceSplitting = errors.New("the namespace is splitting")
 
 	ErrLeaderNodeLost            = cluster.NewCoordErr("leader node is lost", cluster.CoordTmpErr)
 	ErrNodeNotFound              = cluster.NewCoordErr("node not found", cluster.CoordCommonErr)
@@ -726,6 +727,8 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 			if fullCheck && fullReady {
 				atomic.StoreInt32(&pdCoord.isClusterUnstable, 0)
 				pdCoord.doSchemaCheck()
+				pdCoord.doSplitCheck()
+				pdCoord.doRestoreCheck()
 			}
 		} else {
 			atomic.StoreInt32(&pdCoord.isClusterUnstable, 1)
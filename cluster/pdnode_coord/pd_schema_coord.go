@@ -18,7 +18,7 @@ func getIndexSchemasFromDataNode(remoteNode string, ns string) (map[string]*comm
 	nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(remoteNode)
 	rsp := make(map[string]*common.IndexSchema)
 	_, err := common.APIRequest("GET",
-		"http://"+net.JoinHostPort(nip, httpPort)+common.APIGetIndexes+"/"+ns,
+		common.HTTPScheme()+"://"+net.JoinHostPort(nip, httpPort)+common.APIGetIndexes+"/"+ns,
 		nil, cluster.APIShortTo, &rsp)
 	if err != nil {
 		cluster.CoordLog().Infof("failed (%v) to get indexes for namespace %v : %v",
@@ -46,6 +46,14 @@ func isAllPartsIndexSchemaReady(allPartsSchema map[int]map[string]*common.IndexS
 				break
 			}
 		}
+		for _, partIndex := range s.JSONIndexes {
+			if partIndex.Name == name {
+				if partIndex.State == expectedState {
+					isSame = true
+				}
+				break
+			}
+		}
 		if !isSame {
 			allDone = false
 			break
@@ -120,8 +128,24 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 				default:
 				}
 			}
-			for _, jsonIndex := range indexes.JSONIndexes {
-				_ = jsonIndex
+			for _, jindex := range indexes.JSONIndexes {
+				switch jindex.State {
+				case common.InitIndex:
+					if isAllPartsIndexSchemaReady(allPartsSchema, table, jindex.Name, common.InitIndex) {
+						schemaChanged = true
+						jindex.State = common.BuildingIndex
+					}
+					go pdCoord.triggerCheckNamespaces(ns, -1, time.Second)
+				case common.BuildingIndex:
+					if isAllPartsIndexSchemaReady(allPartsSchema, table, jindex.Name, common.BuildDoneIndex) {
+						schemaChanged = true
+						jindex.State = common.ReadyIndex
+						cluster.CoordLog().Infof("namespace %v table %v json schema info ready: %v", ns, table, jindex)
+					} else {
+						go pdCoord.triggerCheckNamespaces(ns, -1, time.Second*3)
+					}
+				default:
+				}
 			}
 
 			if schemaChanged {
@@ -136,17 +160,14 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 	}
 }
 
-func (pdCoord *PDCoordinator) addHIndexSchema(ns string, table string, hindex *common.HsetIndexSchema) error {
-	if !hindex.IsValidNewSchema() {
-		return ErrInvalidSchema
-	}
+func (pdCoord *PDCoordinator) getTableIndexSchema(ns string, table string) (*common.IndexSchema, *cluster.SchemaInfo, error) {
 	var indexes common.IndexSchema
 	var newSchema cluster.SchemaInfo
 
 	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
 	if err != nil {
 		if err != cluster.ErrKeyNotFound {
-			return err
+			return nil, nil, err
 		}
 		newSchema.Epoch = 0
 	} else {
@@ -154,18 +175,61 @@ func (pdCoord *PDCoordinator) addHIndexSchema(ns string, table string, hindex *c
 		err := json.Unmarshal(schema.Schema, &indexes)
 		if err != nil {
 			cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
-			return err
+			return nil, nil, err
 		}
 	}
+	return &indexes, &newSchema, nil
+}
 
+func isIndexNameExist(indexes *common.IndexSchema, name string) bool {
 	for _, hi := range indexes.HsetIndexes {
-		if hi.Name == hindex.Name {
-			return errors.New("index already exist")
+		if hi.Name == name {
+			return true
+		}
+	}
+	for _, ji := range indexes.JSONIndexes {
+		if ji.Name == name {
+			return true
 		}
 	}
+	return false
+}
+
+func (pdCoord *PDCoordinator) addHIndexSchema(ns string, table string, hindex *common.HsetIndexSchema) error {
+	if !hindex.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	indexes, newSchema, err := pdCoord.getTableIndexSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	if isIndexNameExist(indexes, hindex.Name) {
+		return errors.New("index already exist")
+	}
 	indexes.HsetIndexes = append(indexes.HsetIndexes, hindex)
 	newSchema.Schema, _ = json.Marshal(indexes)
-	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, newSchema)
+}
+
+func (pdCoord *PDCoordinator) addJSONIndexSchema(ns string, table string, jindex *common.JSONIndexSchema) error {
+	if !jindex.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	indexes, newSchema, err := pdCoord.getTableIndexSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	if isIndexNameExist(indexes, jindex.Name) {
+		return errors.New("index already exist")
+	}
+	for _, ji := range indexes.JSONIndexes {
+		if ji.IndexPath == jindex.IndexPath && ji.State != common.DeletedIndex {
+			return errors.New("index on json path already exist")
+		}
+	}
+	indexes.JSONIndexes = append(indexes.JSONIndexes, jindex)
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, newSchema)
 }
 
 func (pdCoord *PDCoordinator) delHIndexSchema(ns string, table string, hindexName string) error {
@@ -195,3 +259,31 @@ func (pdCoord *PDCoordinator) delHIndexSchema(ns string, table string, hindexNam
 	newSchema.Schema, _ = json.Marshal(indexes)
 	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
 }
+
+func (pdCoord *PDCoordinator) delJSONIndexSchema(ns string, table string, jindexName string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	for _, ji := range indexes.JSONIndexes {
+		if ji.Name == jindexName {
+			if ji.State != common.ReadyIndex {
+				cluster.CoordLog().Infof("namespace %v table %v json index schema not ready: %v", ns, table, ji)
+				return errors.New("Unready index can not be deleted")
+			}
+			cluster.CoordLog().Infof("namespace %v table %v json index schema deleted: %v", ns, table, ji)
+			ji.State = common.DeletedIndex
+		}
+	}
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
@@ -0,0 +1,180 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/cluster"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+// SplitNamespacePartitions double the partitions of the namespace online.
+// The new partition (pid + PartitionNum) will be placed on the same nodes as the old partition pid,
+// and the data node will seed it from the checkpoint of the old partition. The routing will be
+// switched after the leaders of all the new partitions applied the seed.
+func (pdCoord *PDCoordinator) SplitNamespacePartitions(ns string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while split namespace")
+		return ErrNotLeader
+	}
+
+	begin := time.Now()
+	for !atomic.CompareAndSwapInt32(&pdCoord.doChecking, 0, 1) {
+		cluster.CoordLog().Infof("split %v waiting check namespace finish", ns)
+		time.Sleep(time.Millisecond * 200)
+		if time.Since(begin) > time.Second*5 {
+			return ErrClusterUnstable
+		}
+	}
+	defer atomic.StoreInt32(&pdCoord.doChecking, 0)
+
+	if !pdCoord.IsClusterStable() {
+		return ErrClusterUnstable
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if meta.IsSplitting() {
+		return ErrNamespaceSplitting
+	}
+	if meta.IsRestoring() {
+		return ErrNamespaceRestoring
+	}
+	splitNum := meta.PartitionNum * 2
+	if splitNum > common.MAX_PARTITION_NUM {
+		return errors.New("max partition allowed exceed")
+	}
+	parts := make([]*cluster.PartitionMetaInfo, 0, meta.PartitionNum)
+	for pid := 0; pid < meta.PartitionNum; pid++ {
+		part, err := pdCoord.register.GetNamespacePartInfo(ns, pid)
+		if err != nil {
+			cluster.CoordLog().Infof("get namespace %v-%v info failed :%v", ns, pid, err)
+			return err
+		}
+		if part.GetRealLeader() == "" || len(part.Removings) > 0 ||
+			len(part.GetISR()) < part.Replica {
+			cluster.CoordLog().Infof("namespace %v is not stable for split: %v", part.GetDesp(), part)
+			return ErrClusterUnstable
+		}
+		if ok, err := IsAllISRFullReady(part); err != nil || !ok {
+			cluster.CoordLog().Infof("namespace %v isr is not full ready for split: %v", part.GetDesp(), err)
+			return ErrClusterUnstable
+		}
+		parts = append(parts, part)
+	}
+
+	meta.SplitPartitionNum = splitNum
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v meta for split failed :%v", ns, err)
+		return err
+	}
+	cluster.CoordLog().Infof("begin split namespace %v from %v to %v partitions", ns, meta.PartitionNum, splitNum)
+	for _, part := range parts {
+		err = pdCoord.createSplitPartition(part)
+		if err != nil {
+			// will be created again while checking the split state
+			cluster.CoordLog().Infof("create split partition for %v failed: %v", part.GetDesp(), err)
+		}
+	}
+	go pdCoord.triggerCheckNamespaces("", 0, time.Second)
+	return nil
+}
+
+// create the new partition on the same raft nodes as the parent partition
+func (pdCoord *PDCoordinator) createSplitPartition(parent *cluster.PartitionMetaInfo) error {
+	ns := parent.Name
+	pid := parent.Partition + parent.PartitionNum
+	err := pdCoord.register.CreateNamespacePartition(ns, pid)
+	if err != nil && err != cluster.ErrKeyAlreadyExist {
+		return err
+	}
+	if err == cluster.ErrKeyAlreadyExist {
+		if t, err := pdCoord.register.GetNamespacePartInfo(ns, pid); err == nil && len(t.RaftNodes) > 0 {
+			return nil
+		}
+	}
+	var replicaInfo cluster.PartitionReplicaInfo
+	replicaInfo.RaftIDs = make(map[string]uint64)
+	for _, nid := range parent.GetISR() {
+		replicaInfo.RaftNodes = append(replicaInfo.RaftNodes, nid)
+		replicaInfo.MaxRaftID++
+		replicaInfo.RaftIDs[nid] = uint64(replicaInfo.MaxRaftID)
+	}
+	cluster.CoordLog().Infof("create split partition %v-%v from %v with replicas: %v", ns, pid,
+		parent.GetDesp(), replicaInfo.RaftNodes)
+	return pdCoord.register.UpdateNamespacePartReplicaInfo(ns, pid, &replicaInfo, replicaInfo.Epoch())
+}
+
+// check the splitting namespaces and switch the routing to the new partition number
+// if all the new partitions are ready.
+func (pdCoord *PDCoordinator) doSplitCheck() {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return
+	}
+	for ns, parts := range allNamespaces {
+		meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+		if err != nil || !meta.IsSplitting() {
+			continue
+		}
+		isReady := true
+		for pid := meta.PartitionNum; pid < meta.SplitPartitionNum; pid++ {
+			part, ok := parts[pid]
+			if !ok || len(part.RaftNodes) == 0 {
+				isReady = false
+				if parent, ok := parts[pid-meta.PartitionNum]; ok {
+					err := pdCoord.createSplitPartition(parent.GetCopy())
+					if err != nil {
+						cluster.CoordLog().Infof("create split partition for %v failed: %v", parent.GetDesp(), err)
+					}
+				}
+				continue
+			}
+			// the moved keys are refused by the parent until switched, so do not wait
+			// the followers catching up with the snapshot.
+			if ok, err := isSplitSeedApplied(&part); err != nil || !ok {
+				cluster.CoordLog().Infof("namespace %v leader has not applied the split seed: %v", part.GetDesp(), err)
+				isReady = false
+			}
+		}
+		if !isReady {
+			continue
+		}
+		// the new partition number is published by one CAS on the namespace meta, so the
+		// data nodes and clients switch the routing from the same etcd revision.
+		cluster.CoordLog().Infof("namespace %v split done, switch partition number from %v to %v",
+			ns, meta.PartitionNum, meta.SplitPartitionNum)
+		meta.PartitionNum = meta.SplitPartitionNum
+		meta.SplitPartitionNum = 0
+		err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+		if err != nil {
+			cluster.CoordLog().Infof("update namespace %v meta failed: %v", ns, err)
+		}
+	}
+}
+
+// query the leader of the new partition whether the seed data is applied
+func isSplitSeedApplied(part *cluster.PartitionMetaInfo) (bool, error) {
+	leader := part.GetRealLeader()
+	if leader == "" {
+		return false, nil
+	}
+	nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(leader)
+	var rsp struct {
+		SeedIndex uint64 `json:"seed_index"`
+	}
+	_, err := common.APIRequest("GET",
+		common.HTTPScheme()+"://"+net.JoinHostPort(nip, httpPort)+common.APIIsSplitSeedApplied+"/"+part.GetDesp(),
+		nil, cluster.APIShortTo, &rsp)
+	if err != nil {
+		return false, err
+	}
+	cluster.CoordLog().Infof("namespace %v leader %v applied the split seed from parent index %v",
+		part.GetDesp(), leader, rsp.SeedIndex)
+	return true, nil
+}
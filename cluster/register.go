@@ -12,6 +12,8 @@ var (
 	ErrLearnerRoleInvalidChanged = errors.New("node learner role should never be changed")
 	ErrLearnerRoleUnsupported    = errors.New("node learner role is not supported")
 	DCInfoTag                    = "dc_info"
+	// the cluster auth info saved by placement driver and read by all data nodes
+	AuthInfoKVKey = "cluster:auth_info"
 )
 
 type EpochType int64
@@ -62,19 +64,45 @@ type NamespaceMetaInfo struct {
 	SnapCount        int
 	Tags             map[string]interface{}
 	ExpirationPolicy string
-	DataVersion      string
+	// the time range in seconds of each bucket under the periodical rotation policy, 0 for the default
+	ExpirationRotationPeriod int64
+	DataVersion              string
+	// the target partition number while splitting, 0 means no split in progress
+	SplitPartitionNum int
+	// the backup directory to restore the data from, cleared after all the partitions are ready
+	RestoreFrom string
+	// the quota for keys, disk bytes and qps, nil means no limit
+	Quota *common.NamespaceQuota
 }
 
 func (self *NamespaceMetaInfo) MetaEpoch() EpochType {
 	return self.metaEpoch
 }
 
+func (self *NamespaceMetaInfo) IsSplitting() bool {
+	return self.SplitPartitionNum > self.PartitionNum
+}
+
+func (self *NamespaceMetaInfo) IsRestoring() bool {
+	return self.RestoreFrom != ""
+}
+
+// MaxPartitionNum return the number of all the partitions including the new
+// partitions created by split
+func (self *NamespaceMetaInfo) MaxPartitionNum() int {
+	if self.IsSplitting() {
+		return self.SplitPartitionNum
+	}
+	return self.PartitionNum
+}
+
 func (self *NamespaceMetaInfo) DeepClone() NamespaceMetaInfo {
 	nm := *self
 	nm.Tags = make(map[string]interface{})
 	for k, v := range self.Tags {
 		nm.Tags[k] = v
 	}
+	nm.Quota = self.Quota.DeepClone()
 	return nm
 }
 
@@ -256,6 +284,8 @@ type DataNodeRegister interface {
 	// get the newest pd leader and watch the change of it.
 	WatchPDLeader(leader chan *NodeInfo, stop chan struct{}) error
 	GetNodeInfo(nid string) (NodeInfo, error)
+	// get all the data nodes registered in the cluster
+	GetDataNodes() ([]NodeInfo, error)
 	// while losing leader, update to empty nid
 	// while became the new leader, update to my node
 	UpdateNamespaceLeader(ns string, partition int, rl RealLeader, oldGen EpochType) (EpochType, error)
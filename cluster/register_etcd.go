@@ -429,7 +429,7 @@ func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaI
 			if err != nil {
 				continue
 			}
-			if partition >= meta.PartitionNum {
+			if partition >= meta.MaxPartitionNum() {
 				coordLog.Infof("invalid partition id : %v ", k2)
 				continue
 			}
@@ -886,7 +886,7 @@ func (etcdReg *PDEtcdRegister) CheckIfLeader() bool {
 	return false
 }
 
-func (etcdReg *PDEtcdRegister) GetDataNodes() ([]NodeInfo, error) {
+func (etcdReg *EtcdRegister) GetDataNodes() ([]NodeInfo, error) {
 	n, _, err := etcdReg.getDataNodes(false)
 	return n, err
 }
@@ -926,7 +926,7 @@ func (etcdReg *PDEtcdRegister) WatchDataNodes(dataNodesChan chan []NodeInfo, sto
 	}, nil)
 }
 
-func (etcdReg *PDEtcdRegister) getDataNodes(upToDate bool) ([]NodeInfo, uint64, error) {
+func (etcdReg *EtcdRegister) getDataNodes(upToDate bool) ([]NodeInfo, uint64, error) {
 	var rsp *client.Response
 	var err error
 	if upToDate {
@@ -1120,6 +1120,7 @@ func NewDNEtcdRegister(host string) (*DNEtcdRegister, error) {
 func (etcdReg *DNEtcdRegister) Register(nodeData *NodeInfo) error {
 	if nodeData.LearnerRole != "" &&
 		!common.IsRoleLogSyncer(nodeData.LearnerRole) &&
+		!common.IsRoleCDC(nodeData.LearnerRole) &&
 		nodeData.LearnerRole != common.LearnerRoleSearcher {
 		return ErrLearnerRoleUnsupported
 	}
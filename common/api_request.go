@@ -35,6 +35,7 @@ func NewDeadlineTransport(timeout time.Duration) *http.Transport {
 			}
 			return &deadlinedConn{timeout, c}, nil
 		},
+		TLSClientConfig: GetClientTLS(),
 	}
 	return transport
 }
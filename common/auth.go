@@ -0,0 +1,229 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the user used while the client send AUTH with password only
+	DefaultAuthUser = "default"
+	// match any namespace or table in acl
+	AuthMatchAll = "*"
+
+	authHashScheme     = "pbkdf2-sha256"
+	authHashIterations = 50000
+	authHashSaltLen    = 16
+)
+
+var (
+	ErrAuthRequired    = errors.New("NOAUTH Authentication required")
+	ErrAuthFailed      = errors.New("WRONGPASS invalid username-password pair or user is disabled")
+	ErrAuthNoPerm      = errors.New("NOPERM this user has no permissions to access the namespace or table")
+	ErrAuthReadOnly    = errors.New("NOPERM this user has no permissions to run write command")
+	ErrAuthInvalidUser = errors.New("invalid auth user")
+)
+
+// AuthACL limit the user to the namespace and the tables in it.
+type AuthACL struct {
+	// the namespace name, * for all namespaces
+	Namespace string `json:"namespace"`
+	// empty for all the tables in namespace
+	Tables   []string `json:"tables,omitempty"`
+	ReadOnly bool     `json:"read_only"`
+}
+
+func (acl *AuthACL) matchTable(table string) bool {
+	if len(acl.Tables) == 0 {
+		return true
+	}
+	for _, t := range acl.Tables {
+		if t == AuthMatchAll || t == table {
+			return true
+		}
+	}
+	return false
+}
+
+type AuthUser struct {
+	Name string `json:"name"`
+	// the salted pbkdf2 hash of the password, the plain password should never be saved
+	PasswordHash string    `json:"password_hash"`
+	Disabled     bool      `json:"disabled"`
+	ACLs         []AuthACL `json:"acls"`
+}
+
+// pbkdf2 with hmac-sha256 (RFC 8018), the key length is the same as the hash size
+func pbkdf2SHA256(pass []byte, salt []byte, iter int) []byte {
+	mac := hmac.New(sha256.New, pass)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	dk := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range dk {
+			dk[j] ^= u[j]
+		}
+	}
+	return dk
+}
+
+// HashAuthPassword return the password hash with a random salt in the format of
+// pbkdf2-sha256$iterations$salt$hash, the salt and hash are hex encoded.
+func HashAuthPassword(pass string) string {
+	salt := make([]byte, authHashSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		// should never happen, the password can not be saved without salt
+		panic(err)
+	}
+	dk := pbkdf2SHA256([]byte(pass), salt, authHashIterations)
+	return strings.Join([]string{authHashScheme, strconv.Itoa(authHashIterations),
+		hex.EncodeToString(salt), hex.EncodeToString(dk)}, "$")
+}
+
+func parseAuthPasswordHash(ph string) (int, []byte, []byte, error) {
+	subs := strings.Split(ph, "$")
+	if len(subs) != 4 || subs[0] != authHashScheme {
+		return 0, nil, nil, ErrAuthInvalidUser
+	}
+	iter, err := strconv.Atoi(subs[1])
+	if err != nil || iter <= 0 {
+		return 0, nil, nil, ErrAuthInvalidUser
+	}
+	salt, err := hex.DecodeString(subs[2])
+	if err != nil || len(salt) == 0 {
+		return 0, nil, nil, ErrAuthInvalidUser
+	}
+	dk, err := hex.DecodeString(subs[3])
+	if err != nil || len(dk) != sha256.Size {
+		return 0, nil, nil, ErrAuthInvalidUser
+	}
+	return iter, salt, dk, nil
+}
+
+func (u *AuthUser) IsValid() bool {
+	if u.Name == "" {
+		return false
+	}
+	_, _, _, err := parseAuthPasswordHash(u.PasswordHash)
+	return err == nil
+}
+
+func (u *AuthUser) CheckPassword(pass string) bool {
+	if u.Disabled {
+		return false
+	}
+	iter, salt, dk, err := parseAuthPasswordHash(u.PasswordHash)
+	if err != nil {
+		return false
+	}
+	h := pbkdf2SHA256([]byte(pass), salt, iter)
+	return subtle.ConstantTimeCompare(h, dk) == 1
+}
+
+// CheckAccess check whether the user can access the table in namespace, the table can be empty
+// for the command without table (such as scan the whole namespace).
+func (u *AuthUser) CheckAccess(ns string, table string, isWrite bool) error {
+	readOnlyMatched := false
+	for i := range u.ACLs {
+		acl := &u.ACLs[i]
+		if acl.Namespace != AuthMatchAll && acl.Namespace != ns {
+			continue
+		}
+		if table == "" {
+			// no table means the command may across all the tables, so only allow it
+			// if the acl is not limited to tables
+			if len(acl.Tables) != 0 {
+				continue
+			}
+		} else if !acl.matchTable(table) {
+			continue
+		}
+		if !isWrite || !acl.ReadOnly {
+			return nil
+		}
+		readOnlyMatched = true
+	}
+	if readOnlyMatched {
+		return ErrAuthReadOnly
+	}
+	return ErrAuthNoPerm
+}
+
+// AuthInfo is the cluster auth info saved in the register by placement driver, all data nodes should
+// read it from the register to check the client connection.
+type AuthInfo struct {
+	Enabled bool       `json:"enabled"`
+	Users   []AuthUser `json:"users"`
+}
+
+func (ai *AuthInfo) GetUser(name string) *AuthUser {
+	if ai == nil {
+		return nil
+	}
+	for i := range ai.Users {
+		if ai.Users[i].Name == name {
+			return &ai.Users[i]
+		}
+	}
+	return nil
+}
+
+// Authenticate return the user if the name and password matched
+func (ai *AuthInfo) Authenticate(name string, pass string) (*AuthUser, error) {
+	u := ai.GetUser(name)
+	if u == nil || !u.CheckPassword(pass) {
+		return nil, ErrAuthFailed
+	}
+	return u, nil
+}
+
+// AddOrUpdateUser return the new auth info with the user changed
+func (ai *AuthInfo) AddOrUpdateUser(u AuthUser) (*AuthInfo, error) {
+	if !u.IsValid() {
+		return nil, ErrAuthInvalidUser
+	}
+	var newInfo AuthInfo
+	replaced := false
+	if ai != nil {
+		newInfo.Enabled = ai.Enabled
+		newInfo.Users = make([]AuthUser, 0, len(ai.Users)+1)
+		for _, old := range ai.Users {
+			if old.Name == u.Name {
+				newInfo.Users = append(newInfo.Users, u)
+				replaced = true
+				continue
+			}
+			newInfo.Users = append(newInfo.Users, old)
+		}
+	}
+	if !replaced {
+		newInfo.Users = append(newInfo.Users, u)
+	}
+	return &newInfo, nil
+}
+
+// DelUser return the new auth info with the user removed
+func (ai *AuthInfo) DelUser(name string) *AuthInfo {
+	var newInfo AuthInfo
+	if ai == nil {
+		return &newInfo
+	}
+	newInfo.Enabled = ai.Enabled
+	for _, old := range ai.Users {
+		if old.Name == name {
+			continue
+		}
+		newInfo.Users = append(newInfo.Users, old)
+	}
+	return &newInfo
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthUserCheckPassword(t *testing.T) {
+	u := AuthUser{
+		Name:         "test",
+		PasswordHash: HashAuthPassword("test_pass"),
+	}
+	assert.True(t, u.IsValid())
+	assert.True(t, u.CheckPassword("test_pass"))
+	assert.False(t, u.CheckPassword("test_pass2"))
+	assert.False(t, u.CheckPassword(""))
+	u.Disabled = true
+	assert.False(t, u.CheckPassword("test_pass"))
+
+	// the same password should be hashed with different salts
+	u = AuthUser{Name: "test", PasswordHash: HashAuthPassword("test_pass")}
+	assert.NotEqual(t, HashAuthPassword("test_pass"), u.PasswordHash)
+	assert.True(t, u.CheckPassword("test_pass"))
+	// the unsalted hash is not allowed
+	h := sha256.Sum256([]byte("test_pass"))
+	u.PasswordHash = hex.EncodeToString(h[:])
+	assert.False(t, u.IsValid())
+	assert.False(t, u.CheckPassword("test_pass"))
+
+	var ai *AuthInfo
+	_, err := ai.Authenticate("test", "test_pass")
+	assert.Equal(t, ErrAuthFailed, err)
+	ai, err = ai.AddOrUpdateUser(AuthUser{Name: "test"})
+	assert.Equal(t, ErrAuthInvalidUser, err)
+	ai, err = ai.AddOrUpdateUser(AuthUser{Name: "test", PasswordHash: HashAuthPassword("p1")})
+	assert.Nil(t, err)
+	_, err = ai.Authenticate("test", "p1")
+	assert.Nil(t, err)
+	ai, err = ai.AddOrUpdateUser(AuthUser{Name: "test", PasswordHash: HashAuthPassword("p2")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ai.Users))
+	_, err = ai.Authenticate("test", "p1")
+	assert.Equal(t, ErrAuthFailed, err)
+	_, err = ai.Authenticate("test", "p2")
+	assert.Nil(t, err)
+	ai = ai.DelUser("test")
+	assert.Equal(t, 0, len(ai.Users))
+	_, err = ai.Authenticate("test", "p2")
+	assert.Equal(t, ErrAuthFailed, err)
+}
+
+func TestAuthUserCheckAccess(t *testing.T) {
+	u := AuthUser{
+		Name:         "test",
+		PasswordHash: HashAuthPassword("test_pass"),
+		ACLs: []AuthACL{
+			{Namespace: "ns1"},
+			{Namespace: "ns2", Tables: []string{"t1", "t2"}},
+			{Namespace: "ns2", Tables: []string{"t3"}, ReadOnly: true},
+			{Namespace: "ns3", ReadOnly: true},
+		},
+	}
+	assert.Nil(t, u.CheckAccess("ns1", "t1", true))
+	assert.Nil(t, u.CheckAccess("ns1", "", true))
+	assert.Nil(t, u.CheckAccess("ns2", "t1", true))
+	assert.Nil(t, u.CheckAccess("ns2", "t2", false))
+	assert.Nil(t, u.CheckAccess("ns2", "t3", false))
+	assert.Equal(t, ErrAuthReadOnly, u.CheckAccess("ns2", "t3", true))
+	assert.Equal(t, ErrAuthNoPerm, u.CheckAccess("ns2", "t4", false))
+	assert.Equal(t, ErrAuthNoPerm, u.CheckAccess("ns2", "", false))
+	assert.Nil(t, u.CheckAccess("ns3", "t1", false))
+	assert.Equal(t, ErrAuthReadOnly, u.CheckAccess("ns3", "t1", true))
+	assert.Equal(t, ErrAuthNoPerm, u.CheckAccess("ns4", "t1", false))
+
+	u.ACLs = append(u.ACLs, AuthACL{Namespace: AuthMatchAll, ReadOnly: true})
+	assert.Nil(t, u.CheckAccess("ns4", "t1", false))
+	assert.Equal(t, ErrAuthReadOnly, u.CheckAccess("ns4", "t1", true))
+	assert.Nil(t, u.CheckAccess("ns1", "t1", true))
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// the known test vectors for pbkdf2 with hmac-sha256 and 32 bytes key
+	assert.Equal(t, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), 1)))
+	assert.Equal(t, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43",
+		hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), 2)))
+	assert.Equal(t, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), 4096)))
+}
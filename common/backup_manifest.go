@@ -0,0 +1,176 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	BackupManifestFile = "manifest.json"
+)
+
+var (
+	errBackupPartitionNotFound = errors.New("the partition is not found in the backup manifest")
+)
+
+// PartitionBackupInfo is the backup of a partition exported to the backup directory
+type PartitionBackupInfo struct {
+	Partition int    `json:"partition"`
+	Term      uint64 `json:"term"`
+	Index     uint64 `json:"index"`
+	// the directory of the checkpoint files relative to the backup directory
+	Dir   string         `json:"dir"`
+	Files []SnapFileInfo `json:"files"`
+	// the archived raft logs replayed on the checkpoint up to the cut index while restoring,
+	// no archive if the checkpoint is already at the cut of the backup.
+	CutIndex     uint64         `json:"cut_index"`
+	ArchiveDir   string         `json:"archive_dir,omitempty"`
+	ArchiveFiles []SnapFileInfo `json:"archive_files,omitempty"`
+}
+
+// NamespaceBackupManifest describe the backup of all the partitions of the namespace,
+// it is saved in the backup directory and used to restore a new namespace.
+type NamespaceBackupManifest struct {
+	Namespace        string                `json:"namespace"`
+	PartitionNum     int                   `json:"partition_num"`
+	Replica          int                   `json:"replica"`
+	EngType          string                `json:"eng_type"`
+	OptimizedFsync   bool                  `json:"optimized_fsync"`
+	ExpirationPolicy string                `json:"expiration_policy"`
+	DataVersion      string                `json:"data_version"`
+	BackupTime       int64                 `json:"backup_time"`
+	Partitions       []PartitionBackupInfo `json:"partitions"`
+	// the common cut of all the partitions, each partition is restored to the raft logs
+	// before the first write newer than it.
+	CutTs int64 `json:"cut_ts"`
+	// the bucket time range of the periodical rotation policy
+	ExpirationRotationPeriod int64 `json:"expiration_rotation_period,omitempty"`
+}
+
+func (m *NamespaceBackupManifest) GetPartition(pid int) (*PartitionBackupInfo, error) {
+	for i := range m.Partitions {
+		if m.Partitions[i].Partition == pid {
+			return &m.Partitions[i], nil
+		}
+	}
+	return nil, errBackupPartitionNotFound
+}
+
+// check all the partitions are in the manifest
+func (m *NamespaceBackupManifest) Validate() error {
+	if m.PartitionNum <= 0 || len(m.Partitions) != m.PartitionNum {
+		return fmt.Errorf("invalid backup manifest: partition number %v, backup partitions %v",
+			m.PartitionNum, len(m.Partitions))
+	}
+	for pid := 0; pid < m.PartitionNum; pid++ {
+		p, err := m.GetPartition(pid)
+		if err != nil {
+			return fmt.Errorf("invalid backup manifest: partition %v is missing", pid)
+		}
+		if _, err := getRelFilePath("", p.Dir); err != nil {
+			return fmt.Errorf("invalid backup manifest: partition %v dir %v", pid, p.Dir)
+		}
+		if p.CutIndex != 0 && p.CutIndex < p.Index {
+			return fmt.Errorf("invalid backup manifest: partition %v cut index %v before checkpoint %v", pid, p.CutIndex, p.Index)
+		}
+		if p.CutIndex > p.Index {
+			if _, err := getRelFilePath("", p.ArchiveDir); err != nil || p.ArchiveDir == "" {
+				return fmt.Errorf("invalid backup manifest: partition %v archive dir %v", pid, p.ArchiveDir)
+			}
+		}
+	}
+	return nil
+}
+
+func SaveBackupManifest(backupDir string, m *NamespaceBackupManifest) error {
+	sort.Slice(m.Partitions, func(i, j int) bool {
+		return m.Partitions[i].Partition < m.Partitions[j].Partition
+	})
+	d, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	tmpFile := path.Join(backupDir, BackupManifestFile+".tmp")
+	err = ioutil.WriteFile(tmpFile, d, FILE_PERM)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path.Join(backupDir, BackupManifestFile))
+}
+
+func LoadBackupManifest(backupDir string) (*NamespaceBackupManifest, error) {
+	d, err := ioutil.ReadFile(path.Join(backupDir, BackupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m NamespaceBackupManifest
+	err = json.Unmarshal(d, &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, m.Validate()
+}
+
+// ExportBackupFiles copy all the files in the checkpoint directory to the backup directory,
+// the copied files are verified by the checksum of the source files.
+func ExportBackupFiles(srcDir string, dstDir string) ([]SnapFileInfo, error) {
+	files, err := ListSnapFiles(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].CRC, err = snapFileCRC(filepath.Join(srcDir, filepath.FromSlash(files[i].Name)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the backup directory may be on the other filesystem, so we always copy the content
+	err = copyBackupFiles(srcDir, dstDir, files, CopyFile)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ImportBackupFiles copy the files of the partition backup to the local data directory
+func ImportBackupFiles(srcDir string, dstDir string, files []SnapFileInfo) error {
+	return copyBackupFiles(srcDir, dstDir, files, func(src, dst string, override bool) error {
+		return CopyFileForHardLink(src, dst)
+	})
+}
+
+func copyBackupFiles(srcDir string, dstDir string, files []SnapFileInfo,
+	copyFn func(string, string, bool) error) error {
+	for _, f := range files {
+		src, err := getRelFilePath(srcDir, f.Name)
+		if err != nil {
+			return err
+		}
+		dst, err := getRelFilePath(dstDir, f.Name)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(dst), DIR_PERM)
+		if err != nil {
+			return err
+		}
+		err = copyFn(src, dst, true)
+		if err != nil {
+			return err
+		}
+		crc, err := snapFileCRC(dst)
+		if err != nil {
+			return err
+		}
+		if crc != f.CRC {
+			return fmt.Errorf("%v: %v", errSnapFileChecksum, dst)
+		}
+	}
+	return nil
+}
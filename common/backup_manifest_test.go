@@ -0,0 +1,84 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupExportAndImport(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "backup-manifest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	srcDir := filepath.Join(tmpDir, "checkpoint")
+	os.MkdirAll(filepath.Join(srcDir, "sub"), DIR_PERM)
+	ioutil.WriteFile(filepath.Join(srcDir, "000001.sst"), []byte("sst data"), FILE_PERM)
+	ioutil.WriteFile(filepath.Join(srcDir, "sub", "MANIFEST"), []byte("manifest"), FILE_PERM)
+
+	backupDir := filepath.Join(tmpDir, "backup")
+	os.MkdirAll(backupDir, DIR_PERM)
+	files, err := ExportBackupFiles(srcDir, filepath.Join(backupDir, "test-0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+
+	m := &NamespaceBackupManifest{
+		Namespace:    "test",
+		PartitionNum: 2,
+		Replica:      3,
+		Partitions: []PartitionBackupInfo{
+			{Partition: 1, Term: 2, Index: 20, Dir: "test-1", Files: files},
+			{Partition: 0, Term: 2, Index: 10, Dir: "test-0", Files: files},
+		},
+	}
+	err = SaveBackupManifest(backupDir, m)
+	assert.Nil(t, err)
+	loaded, err := LoadBackupManifest(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, loaded.Partitions[0].Partition)
+	p, err := loaded.GetPartition(1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), p.Index)
+	_, err = loaded.GetPartition(2)
+	assert.Equal(t, errBackupPartitionNotFound, err)
+
+	p, _ = loaded.GetPartition(0)
+	dstDir := filepath.Join(tmpDir, "restore")
+	err = ImportBackupFiles(filepath.Join(backupDir, p.Dir), dstDir, p.Files)
+	assert.Nil(t, err)
+	d, err := ioutil.ReadFile(filepath.Join(dstDir, "sub", "MANIFEST"))
+	assert.Nil(t, err)
+	assert.Equal(t, "manifest", string(d))
+
+	// the corrupted backup file should fail the checksum
+	ioutil.WriteFile(filepath.Join(backupDir, p.Dir, "000001.sst"), []byte("bad data"), FILE_PERM)
+	err = ImportBackupFiles(filepath.Join(backupDir, p.Dir), filepath.Join(tmpDir, "restore2"), p.Files)
+	assert.NotNil(t, err)
+
+	// the archived logs are needed if the cut is after the checkpoint
+	m.Partitions[0].CutIndex = 15
+	err = SaveBackupManifest(backupDir, m)
+	assert.Nil(t, err)
+	_, err = LoadBackupManifest(backupDir)
+	assert.NotNil(t, err)
+	m.Partitions[0].ArchiveDir = "test-0-raft_archive"
+	err = SaveBackupManifest(backupDir, m)
+	assert.Nil(t, err)
+	_, err = LoadBackupManifest(backupDir)
+	assert.Nil(t, err)
+	m.Partitions[0].CutIndex = 5
+	err = SaveBackupManifest(backupDir, m)
+	assert.Nil(t, err)
+	_, err = LoadBackupManifest(backupDir)
+	assert.NotNil(t, err)
+
+	// the manifest with missing partition is invalid
+	m.Partitions = m.Partitions[:1]
+	err = SaveBackupManifest(backupDir, m)
+	assert.Nil(t, err)
+	_, err = LoadBackupManifest(backupDir)
+	assert.NotNil(t, err)
+}
@@ -27,11 +27,15 @@ const (
 
 var ErrTransferOutofdate = errors.New("waiting transfer snapshot too long, maybe out of date")
 var ErrRsyncFailed = errors.New("transfer snapshot failed due to rsync error")
+var errSnapFileChecksum = errors.New("snapshot file checksum mismatch")
+var errSnapFileInvalidPath = errors.New("invalid snapshot file path")
 
 func SetRsyncLimit(limit int64) {
 	atomic.StoreInt64(&rsyncLimit, limit)
 }
 
+// The remote can be the http address (http://ip:port) of the remote data node for the native transfer,
+// or the rsync daemon address for the rsync transfer, or empty for the local copy.
 // make sure the file sync will not overwrite hard link file inplace. (Because the hard link file content which may be
 // used in rocksdb should not be changed )
 // So with hard link sync, we make sure we do unlink on the file before we update it. (rsync just do it)
@@ -63,6 +67,18 @@ func RunFileSync(remote string, srcPath string, dstPath string, stopCh chan stru
 	} else {
 		os.MkdirAll(dstPath, DIR_PERM)
 	}
+	if IsNativeFileSyncAddr(remote) {
+		log.Printf("transfer from remote :%v/%v to local: %v\n", remote, srcPath, dstPath)
+		err := runNativeFileSync(remote, srcPath, dstPath, stopCh)
+		if err != nil {
+			log.Printf("transfer from %v/%v error: %v", remote, srcPath, err)
+			if err == ErrStopped {
+				return err
+			}
+			return ErrRsyncFailed
+		}
+		return nil
+	}
 	if remote == "" {
 		log.Printf("copy local :%v to %v\n", srcPath, dstPath)
 		cmd = exec.Command("cp", "-rp", srcPath, dstPath)
@@ -0,0 +1,66 @@
+package common
+
+// QuotaLimit is the limit for the keys, disk bytes and qps, 0 means no limit.
+type QuotaLimit struct {
+	MaxKeys      int64 `json:"max_keys,omitempty"`
+	MaxDiskBytes int64 `json:"max_disk_bytes,omitempty"`
+	MaxReadQPS   int64 `json:"max_read_qps,omitempty"`
+	MaxWriteQPS  int64 `json:"max_write_qps,omitempty"`
+}
+
+func (ql QuotaLimit) IsEmpty() bool {
+	return ql.MaxKeys <= 0 && ql.MaxDiskBytes <= 0 && ql.MaxReadQPS <= 0 && ql.MaxWriteQPS <= 0
+}
+
+// divide the limit to each partition, since each partition only knows the local usage.
+// a positive limit will be at least 1 after divided.
+func (ql QuotaLimit) PerPartition(partitionNum int) QuotaLimit {
+	if partitionNum <= 1 {
+		return ql
+	}
+	div := func(v int64) int64 {
+		if v <= 0 {
+			return 0
+		}
+		v = v / int64(partitionNum)
+		if v <= 0 {
+			v = 1
+		}
+		return v
+	}
+	return QuotaLimit{
+		MaxKeys:      div(ql.MaxKeys),
+		MaxDiskBytes: div(ql.MaxDiskBytes),
+		MaxReadQPS:   div(ql.MaxReadQPS),
+		MaxWriteQPS:  div(ql.MaxWriteQPS),
+	}
+}
+
+// NamespaceQuota is the quota for the whole namespace and the tables in it.
+type NamespaceQuota struct {
+	QuotaLimit
+	Tables map[string]QuotaLimit `json:"tables,omitempty"`
+}
+
+func (nq *NamespaceQuota) IsEmpty() bool {
+	if nq == nil {
+		return true
+	}
+	return nq.QuotaLimit.IsEmpty() && len(nq.Tables) == 0
+}
+
+func (nq *NamespaceQuota) DeepClone() *NamespaceQuota {
+	if nq == nil {
+		return nil
+	}
+	c := &NamespaceQuota{
+		QuotaLimit: nq.QuotaLimit,
+	}
+	if nq.Tables != nil {
+		c.Tables = make(map[string]QuotaLimit, len(nq.Tables))
+		for t, l := range nq.Tables {
+			c.Tables[t] = l
+		}
+	}
+	return c
+}
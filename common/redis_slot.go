@@ -0,0 +1,38 @@
+package common
+
+import "bytes"
+
+// the slot number used by the redis cluster
+const RedisClusterSlots = 16384
+
+// crc16 (XMODEM) used by the redis cluster to compute the key slot
+func crc16(buf []byte) uint16 {
+	var crc uint16
+	for _, b := range buf {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc = crc << 1
+			}
+		}
+	}
+	return crc
+}
+
+// KeyHashSlot compute the slot as the redis cluster client, only the hash tag is used if the key has one.
+func KeyHashSlot(key []byte) int {
+	if s := bytes.IndexByte(key, '{'); s >= 0 {
+		if e := bytes.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) & (RedisClusterSlots - 1)
+}
+
+// SlotPartition return the partition owning the slot, the slots are assigned to the partitions
+// by contiguous blocks, so the slots of each partition can be returned as one range.
+func SlotPartition(slot int, pnum int) int {
+	return slot * pnum / RedisClusterSlots
+}
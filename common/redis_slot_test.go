@@ -0,0 +1,32 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisClusterKeySlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16([]byte("123456789")))
+	assert.Equal(t, 12182, KeyHashSlot([]byte("foo")))
+	assert.Equal(t, KeyHashSlot([]byte("{user1000}.following")), KeyHashSlot([]byte("{user1000}.followers")))
+	assert.Equal(t, KeyHashSlot([]byte("user1000")), KeyHashSlot([]byte("default:{user1000}:k1")))
+	// the empty hash tag is ignored
+	assert.Equal(t, int(crc16([]byte("foo{}{bar}"))&(RedisClusterSlots-1)), KeyHashSlot([]byte("foo{}{bar}")))
+}
+
+func TestRedisClusterSlotPartition(t *testing.T) {
+	assert.Equal(t, 0, SlotPartition(0, 4))
+	assert.Equal(t, 0, SlotPartition(4095, 4))
+	assert.Equal(t, 1, SlotPartition(4096, 4))
+	assert.Equal(t, 3, SlotPartition(RedisClusterSlots-1, 4))
+	for _, pnum := range []int{1, 3, 7, 16} {
+		last := 0
+		for slot := 0; slot < RedisClusterSlots; slot++ {
+			pid := SlotPartition(slot, pnum)
+			assert.True(t, pid == last || pid == last+1)
+			last = pid
+		}
+		assert.Equal(t, pnum-1, last)
+	}
+}
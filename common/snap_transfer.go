@@ -0,0 +1,344 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	snapPartFileSuffix = ".part"
+	snapTransferBufLen = 32 * 1024
+	// the same as the backup directory name under the namespace data in rockredis
+	snapBackupDirName = "rocksdb_backup"
+)
+
+var snapCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// the checkpoint directory name is in the format of term-index
+var snapCheckpointNameRegexp = regexp.MustCompile("^[0-9a-f]{16}-[0-9a-f]{16}$")
+
+// SnapFileInfo is the file info in the snapshot checkpoint directory
+type SnapFileInfo struct {
+	// the path relative to the checkpoint directory, slash separated
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// the checksum is only returned while requesting the single file
+	CRC uint32 `json:"crc,omitempty"`
+}
+
+// IsNativeFileSyncAddr check whether the remote address is the http address of data node which
+// can be used to transfer the snapshot files without rsync.
+func IsNativeFileSyncAddr(remote string) bool {
+	return strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://")
+}
+
+// IsNativeFileSyncSupported check whether the remote data node has the snapshot file api. The
+// old node without the api will return not found for the route, while the new node return bad
+// request for the empty path, so we can fall back to rsync while upgrading the cluster.
+func IsNativeFileSyncSupported(remote string) bool {
+	httpclient := &http.Client{Transport: NewDeadlineTransport(time.Second * 5)}
+	resp, err := httpclient.Get(remote + APISnapFileList)
+	if err != nil {
+		// the remote may be unavailable for now, and it will be retried later
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound
+}
+
+// return the full path for the path relative to the root, the path out of the root is not allowed.
+func getRelFilePath(root string, rel string) (string, error) {
+	if rel == "" || path.IsAbs(rel) {
+		return "", errSnapFileInvalidPath
+	}
+	cleaned := path.Clean(rel)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errSnapFileInvalidPath
+	}
+	return filepath.Join(root, filepath.FromSlash(cleaned)), nil
+}
+
+// GetSnapFilePath return the full path for the path relative to the data root, only the
+// checkpoint directory (namespace/rocksdb_backup/term-index) and the files under it are allowed.
+func GetSnapFilePath(root string, rel string) (string, error) {
+	fullPath, err := getRelFilePath(root, rel)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(path.Clean(rel), "/")
+	if len(parts) < 3 || parts[0] == "." ||
+		parts[1] != snapBackupDirName || !snapCheckpointNameRegexp.MatchString(parts[2]) {
+		return "", errSnapFileInvalidPath
+	}
+	return fullPath, nil
+}
+
+func snapFileCRC(fn string) (uint32, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.New(snapCRCTable)
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// GetSnapFileInfo return the size and checksum of the snapshot file
+func GetSnapFileInfo(fn string) (SnapFileInfo, error) {
+	var info SnapFileInfo
+	st, err := os.Stat(fn)
+	if err != nil {
+		return info, err
+	}
+	if st.IsDir() {
+		return info, errSnapFileInvalidPath
+	}
+	info.Name = filepath.Base(fn)
+	info.Size = st.Size()
+	info.CRC, err = snapFileCRC(fn)
+	return info, err
+}
+
+// ListSnapFiles list all the files under the checkpoint directory, the checksum is not computed
+// here since it may take a long time for the large checkpoint.
+func ListSnapFiles(dir string) ([]SnapFileInfo, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, errSnapFileInvalidPath
+	}
+	files := make([]SnapFileInfo, 0, 10)
+	err = filepath.Walk(dir, func(fn string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(fn, snapPartFileSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fn)
+		if err != nil {
+			return err
+		}
+		files = append(files, SnapFileInfo{
+			Name: filepath.ToSlash(rel),
+			Size: info.Size(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// ServeSnapFile write the file content begin at the offset, the http error will be
+// written if failed before sending the content.
+func ServeSnapFile(w http.ResponseWriter, fn string, offset int64) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	if st.IsDir() || offset < 0 || offset > st.Size() {
+		http.Error(w, errSnapFileInvalidPath.Error(), http.StatusBadRequest)
+		return errSnapFileInvalidPath
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(st.Size()-offset, 10))
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// limit the transfer rate in kilobytes using the same dynamic limit as rsync,
+// and stop the transfer if stopped
+type snapLimitedReader struct {
+	r           io.Reader
+	stopCh      chan struct{}
+	windowStart time.Time
+	windowBytes int64
+}
+
+func (lr *snapLimitedReader) Read(p []byte) (int, error) {
+	select {
+	case <-lr.stopCh:
+		return 0, ErrStopped
+	default:
+	}
+	if len(p) > snapTransferBufLen {
+		p = p[:snapTransferBufLen]
+	}
+	limit := atomic.LoadInt64(&rsyncLimit) * 1024
+	if limit > 0 && lr.windowBytes >= limit {
+		wait := time.Second - time.Since(lr.windowStart)
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-lr.stopCh:
+				return 0, ErrStopped
+			}
+		}
+		lr.windowBytes = 0
+		lr.windowStart = time.Now()
+	}
+	n, err := lr.r.Read(p)
+	lr.windowBytes += int64(n)
+	return n, err
+}
+
+func runNativeFileSync(remote string, srcPath string, dstPath string, stopCh chan struct{}) error {
+	// keep the same destination as the rsync, the source directory will be put
+	// under the destination directory
+	targetDir := dstPath
+	if path.Base(srcPath) != filepath.Base(dstPath) {
+		targetDir = filepath.Join(dstPath, path.Base(srcPath))
+	}
+	err := os.MkdirAll(targetDir, DIR_PERM)
+	if err != nil {
+		return err
+	}
+	var files []SnapFileInfo
+	uri := remote + APISnapFileList + "?path=" + url.QueryEscape(srcPath)
+	_, err = APIRequest("GET", uri, nil, time.Second*10, &files)
+	if err != nil {
+		return err
+	}
+	remoteFiles := make(map[string]bool, len(files))
+	for _, f := range files {
+		select {
+		case <-stopCh:
+			return ErrStopped
+		default:
+		}
+		remoteFiles[filepath.FromSlash(f.Name)] = true
+		err = fetchSnapFile(remote, srcPath, f, targetDir, stopCh)
+		if err != nil {
+			return err
+		}
+	}
+	// remove the local files not in the remote (the same as rsync --delete)
+	return filepath.Walk(targetDir, func(fn string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(targetDir, fn)
+		if err != nil {
+			return err
+		}
+		if !remoteFiles[rel] {
+			log.Printf("remove the file %v not in the remote snapshot", fn)
+			return os.Remove(fn)
+		}
+		return nil
+	})
+}
+
+// fetch the snapshot file to the part file first and resume from the end of the
+// part file if already exist. The part file will be renamed after the checksum is verified,
+// so the file hard linked by others will never be changed in place.
+func fetchSnapFile(remote string, srcPath string, f SnapFileInfo, targetDir string, stopCh chan struct{}) error {
+	dst := filepath.Join(targetDir, filepath.FromSlash(f.Name))
+	// the checksum of each file is computed by the remote while requesting, so the timeout
+	// is for the single file
+	to := time.Second * time.Duration(GetIntDynamicConf(ConfCheckSnapTimeout))
+	uri := remote + APISnapFileCRC + "?path=" + url.QueryEscape(path.Join(srcPath, f.Name))
+	var remoteInfo SnapFileInfo
+	_, err := APIRequest("GET", uri, nil, to, &remoteInfo)
+	if err != nil {
+		return err
+	}
+	if remoteInfo.Size != f.Size {
+		return fmt.Errorf("%v: %v changed while transferring", errSnapFileChecksum, f.Name)
+	}
+	f.CRC = remoteInfo.CRC
+	if st, err := os.Stat(dst); err == nil && st.Size() == f.Size {
+		crc, err := snapFileCRC(dst)
+		if err == nil && crc == f.CRC {
+			return nil
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(dst), DIR_PERM)
+	if err != nil {
+		return err
+	}
+	partFile := dst + snapPartFileSuffix
+	offset := int64(0)
+	if st, err := os.Stat(partFile); err == nil {
+		if st.Size() <= f.Size {
+			offset = st.Size()
+		} else {
+			os.Remove(partFile)
+		}
+	}
+	if offset < f.Size {
+		err = downloadSnapFile(remote, path.Join(srcPath, f.Name), partFile, offset, stopCh)
+		if err != nil {
+			return err
+		}
+	}
+	crc, err := snapFileCRC(partFile)
+	if err != nil {
+		return err
+	}
+	if crc != f.CRC {
+		os.Remove(partFile)
+		return fmt.Errorf("%v: %v", errSnapFileChecksum, f.Name)
+	}
+	return os.Rename(partFile, dst)
+}
+
+func downloadSnapFile(remote string, srcFile string, partFile string, offset int64, stopCh chan struct{}) error {
+	fd, err := os.OpenFile(partFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, FILE_PERM)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	uri := remote + APISnapFile + "?path=" + url.QueryEscape(srcFile) +
+		"&offset=" + strconv.FormatInt(offset, 10)
+	httpclient := &http.Client{Transport: NewDeadlineTransport(time.Minute)}
+	resp, err := httpclient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("download snapshot file failed: " + resp.Status)
+	}
+	lr := &snapLimitedReader{r: resp.Body, stopCh: stopCh, windowStart: time.Now()}
+	buf := make([]byte, snapTransferBufLen)
+	_, err = io.CopyBuffer(fd, lr, buf)
+	if err != nil {
+		return err
+	}
+	return fd.Sync()
+}
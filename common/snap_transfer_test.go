@@ -0,0 +1,162 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSnapFileServer(root string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		fullPath, err := GetSnapFilePath(root, req.URL.Query().Get("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files, err := ListSnapFiles(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		d, _ := json.Marshal(files)
+		w.Write(d)
+	})
+	mux.HandleFunc(APISnapFileCRC, func(w http.ResponseWriter, req *http.Request) {
+		fullPath, err := GetSnapFilePath(root, req.URL.Query().Get("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info, err := GetSnapFileInfo(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		d, _ := json.Marshal(info)
+		w.Write(d)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		fullPath, err := GetSnapFilePath(root, req.URL.Query().Get("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		offset, _ := strconv.ParseInt(req.URL.Query().Get("offset"), 10, 64)
+		ServeSnapFile(w, fullPath, offset)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestGetSnapFilePath(t *testing.T) {
+	ckpt := "0000000000000001-0000000000000001"
+	p, err := GetSnapFilePath("/data", "ns-0/rocksdb_backup/"+ckpt)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("/data", "ns-0", "rocksdb_backup", ckpt), p)
+	p, err = GetSnapFilePath("/data", "ns-0/rocksdb_backup/"+ckpt+"/000001.sst")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("/data", "ns-0", "rocksdb_backup", ckpt, "000001.sst"), p)
+	_, err = GetSnapFilePath("/data", "/etc/passwd")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0/../../etc")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", ".")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0/rocksdb_backup")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0/raft/"+ckpt)
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0/rocksdb_backup/invalid")
+	assert.NotNil(t, err)
+	_, err = GetSnapFilePath("/data", "ns-0/rocksdb_backup/"+ckpt+"/../../rocksdb")
+	assert.NotNil(t, err)
+}
+
+func TestIsNativeFileSyncSupported(t *testing.T) {
+	root, err := ioutil.TempDir("", "snap-transfer-support")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	ts := newTestSnapFileServer(root)
+	defer ts.Close()
+	assert.True(t, IsNativeFileSyncSupported(ts.URL))
+	// the old node without the snapshot api
+	oldTS := httptest.NewServer(http.NewServeMux())
+	defer oldTS.Close()
+	assert.False(t, IsNativeFileSyncSupported(oldTS.URL))
+}
+
+func TestNativeFileSync(t *testing.T) {
+	remoteRoot, err := ioutil.TempDir("", "snap-transfer-remote")
+	assert.Nil(t, err)
+	defer os.RemoveAll(remoteRoot)
+	localRoot, err := ioutil.TempDir("", "snap-transfer-local")
+	assert.Nil(t, err)
+	defer os.RemoveAll(localRoot)
+
+	srcPath := path.Join("ns-0", "rocksdb_backup", "0000000000000001-000000000000000a")
+	srcDir := filepath.Join(remoteRoot, filepath.FromSlash(srcPath))
+	os.MkdirAll(filepath.Join(srcDir, "sub"), DIR_PERM)
+	content1 := make([]byte, 100*1024)
+	for i := range content1 {
+		content1[i] = byte(i)
+	}
+	ioutil.WriteFile(filepath.Join(srcDir, "000001.sst"), content1, FILE_PERM)
+	ioutil.WriteFile(filepath.Join(srcDir, "sub", "MANIFEST"), []byte("manifest"), FILE_PERM)
+
+	ts := newTestSnapFileServer(remoteRoot)
+	defer ts.Close()
+	assert.True(t, IsNativeFileSyncAddr(ts.URL))
+
+	dstPath := filepath.Join(localRoot, "0000000000000001-000000000000000a")
+	// prepare a partial downloaded file and a stale file to test resume and delete
+	os.MkdirAll(dstPath, DIR_PERM)
+	ioutil.WriteFile(filepath.Join(dstPath, "000001.sst"+snapPartFileSuffix), content1[:1000], FILE_PERM)
+	ioutil.WriteFile(filepath.Join(dstPath, "stale.sst"), []byte("stale"), FILE_PERM)
+
+	err = RunFileSync(ts.URL, srcPath, dstPath, nil)
+	assert.Nil(t, err)
+	d, err := ioutil.ReadFile(filepath.Join(dstPath, "000001.sst"))
+	assert.Nil(t, err)
+	assert.Equal(t, content1, d)
+	d, err = ioutil.ReadFile(filepath.Join(dstPath, "sub", "MANIFEST"))
+	assert.Nil(t, err)
+	assert.Equal(t, "manifest", string(d))
+	_, err = os.Stat(filepath.Join(dstPath, "stale.sst"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dstPath, "000001.sst"+snapPartFileSuffix))
+	assert.True(t, os.IsNotExist(err))
+
+	// the corrupted part file should fail the checksum and be removed
+	os.Remove(filepath.Join(dstPath, "000001.sst"))
+	corrupt := make([]byte, 1000)
+	ioutil.WriteFile(filepath.Join(dstPath, "000001.sst"+snapPartFileSuffix), corrupt, FILE_PERM)
+	err = RunFileSync(ts.URL, srcPath, dstPath, nil)
+	assert.Equal(t, ErrRsyncFailed, err)
+	_, err = os.Stat(filepath.Join(dstPath, "000001.sst"+snapPartFileSuffix))
+	assert.True(t, os.IsNotExist(err))
+	// retry should download from the beginning
+	err = RunFileSync(ts.URL, srcPath, dstPath, nil)
+	assert.Nil(t, err)
+	d, err = ioutil.ReadFile(filepath.Join(dstPath, "000001.sst"))
+	assert.Nil(t, err)
+	assert.Equal(t, content1, d)
+
+	// the source directory should be put under the destination if the base name is different
+	err = RunFileSync(ts.URL, srcPath, localRoot, nil)
+	assert.Nil(t, err)
+
+	err = RunFileSync(ts.URL, path.Join("ns-0", "rocksdb_backup", "0000000000000001-000000000000000b"), filepath.Join(localRoot, "notfound"), nil)
+	assert.Equal(t, ErrRsyncFailed, err)
+}
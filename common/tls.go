@@ -0,0 +1,264 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultTLSReloadInterval = time.Second * 10
+
+var errNoCertInPEM = errors.New("no certificate found in the ca file")
+
+// TLSConfig is the certificate config for the tls connections
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// the ca file to verify the peer certificate, use the system roots if empty
+	CAFile string `json:"ca_file"`
+	// require and verify the client certificate for the mutual tls
+	ClientCertAuth bool `json:"client_cert_auth"`
+	// the hostname in the peer certificate is not checked if empty
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+func (tc TLSConfig) IsEnabled() bool {
+	return tc.CertFile != "" && tc.KeyFile != ""
+}
+
+var clientTLS struct {
+	sync.RWMutex
+	conf *tls.Config
+}
+
+// SetClientTLS set the tls config used by the requests between the nodes in the cluster,
+// nil means the plain text is used.
+func SetClientTLS(c *tls.Config) {
+	clientTLS.Lock()
+	clientTLS.conf = c
+	clientTLS.Unlock()
+}
+
+func GetClientTLS() *tls.Config {
+	clientTLS.RLock()
+	c := clientTLS.conf
+	clientTLS.RUnlock()
+	return c
+}
+
+// HTTPScheme return the scheme of the http api for the nodes in the cluster
+func HTTPScheme() string {
+	if GetClientTLS() != nil {
+		return "https"
+	}
+	return "http"
+}
+
+type tlsFileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// TLSReloader load the certificates and reload them if any of the files changed, the
+// tls config from the reloader will use the latest certificates for the new connections.
+type TLSReloader struct {
+	conf      TLSConfig
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	fileStats map[string]tlsFileStat
+	stopC     chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewTLSReloader(conf TLSConfig) (*TLSReloader, error) {
+	if !conf.IsEnabled() {
+		return nil, errors.New("both cert file and key file should be configured for tls")
+	}
+	r := &TLSReloader{
+		conf:  conf,
+		stopC: make(chan struct{}),
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *TLSReloader) files() []string {
+	fs := []string{r.conf.CertFile, r.conf.KeyFile}
+	if r.conf.CAFile != "" {
+		fs = append(fs, r.conf.CAFile)
+	}
+	return fs
+}
+
+func (r *TLSReloader) isChanged() (bool, map[string]tlsFileStat, error) {
+	stats := make(map[string]tlsFileStat, 3)
+	for _, fn := range r.files() {
+		st, err := os.Stat(fn)
+		if err != nil {
+			return false, nil, err
+		}
+		stats[fn] = tlsFileStat{modTime: st.ModTime(), size: st.Size()}
+	}
+	r.mutex.RLock()
+	old := r.fileStats
+	r.mutex.RUnlock()
+	if len(old) != len(stats) {
+		return true, stats, nil
+	}
+	for fn, st := range stats {
+		if old[fn] != st {
+			return true, stats, nil
+		}
+	}
+	return false, stats, nil
+}
+
+// reload the certificates if changed, the old certificates are kept if failed
+func (r *TLSReloader) reload() (bool, error) {
+	changed, stats, err := r.isChanged()
+	if err != nil || !changed {
+		return false, err
+	}
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	var pool *x509.CertPool
+	if r.conf.CAFile != "" {
+		pem, err := ioutil.ReadFile(r.conf.CAFile)
+		if err != nil {
+			return false, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, errNoCertInPEM
+		}
+	}
+	r.mutex.Lock()
+	r.cert = &cert
+	r.caPool = pool
+	r.fileStats = stats
+	r.mutex.Unlock()
+	return true, nil
+}
+
+func (r *TLSReloader) getCert() (*tls.Certificate, *x509.CertPool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, r.caPool
+}
+
+func (r *TLSReloader) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(defaultTLSReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				changed, err := r.reload()
+				if err != nil {
+					log.Printf("reload the tls certificates failed: %v", err)
+				} else if changed {
+					log.Printf("the tls certificates reloaded: %v", r.files())
+				}
+			case <-r.stopC:
+				return
+			}
+		}
+	}()
+}
+
+func (r *TLSReloader) Stop() {
+	close(r.stopC)
+	r.wg.Wait()
+}
+
+// ServerConfig return the tls config for the listener
+func (r *TLSReloader) ServerConfig() *tls.Config {
+	return r.serverConfig(tls.NoClientCert)
+}
+
+// PeerServerConfig return the tls config for the listener which also accepted the requests
+// from the other nodes in the cluster, the client certificate will be verified if given, so
+// the api for peers only can check the verified certificate.
+func (r *TLSReloader) PeerServerConfig() *tls.Config {
+	return r.serverConfig(tls.VerifyClientCertIfGiven)
+}
+
+func (r *TLSReloader) serverConfig(defaultAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.getCert()
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   defaultAuth,
+			}
+			if defaultAuth != tls.NoClientCert {
+				c.ClientCAs = pool
+			}
+			if r.conf.ClientCertAuth {
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+				c.ClientCAs = pool
+			}
+			return c, nil
+		},
+	}
+}
+
+// ClientConfig return the tls config for the connection to the other nodes, the
+// peer certificate is verified by the latest ca, so the ca can be changed without restart.
+func (r *TLSReloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.getCert()
+			return cert, nil
+		},
+		// we verify the peer in VerifyPeerCertificate instead of using the fixed RootCAs
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if r.conf.InsecureSkipVerify {
+				return nil
+			}
+			_, pool := r.getCert()
+			return verifyPeerCerts(rawCerts, pool, r.conf.ServerName)
+		},
+	}
+}
+
+func verifyPeerCerts(rawCerts [][]byte, roots *x509.CertPool, serverName string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no peer certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		c, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, c)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,203 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) writeCert(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+	kb, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	certFile := path.Join(dir, name+".pem")
+	keyFile := path.Join(dir, name+"-key.pem")
+	writeTestTLSFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeTestTLSFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}))
+	return certFile, keyFile
+}
+
+var testTLSFileTime = time.Now()
+
+// make sure the modify time changed even the file system has the low time resolution
+func writeTestTLSFile(t *testing.T, fn string, data []byte) {
+	assert.Nil(t, ioutil.WriteFile(fn, data, 0600))
+	testTLSFileTime = testTLSFileTime.Add(time.Second)
+	assert.Nil(t, os.Chtimes(fn, testTLSFileTime, testTLSFileTime))
+}
+
+func testTLSHandshake(t *testing.T, serverConf *tls.Config, clientConf *tls.Config) error {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConf)
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.(*tls.Conn).Handshake()
+		c.Close()
+	}()
+	c, err := tls.Dial("tcp", ln.Addr().String(), clientConf)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	// the client cert is verified by the server after the client handshake finished
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = c.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil
+	}
+	if err != nil && err.Error() == "EOF" {
+		return nil
+	}
+	return err
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca1 := newTestCA(t, "ca1")
+	ca2 := newTestCA(t, "ca2")
+	serverCA := path.Join(dir, "server-ca.pem")
+	clientCA := path.Join(dir, "client-ca.pem")
+	writeTestTLSFile(t, serverCA, ca1.pem)
+	writeTestTLSFile(t, clientCA, ca1.pem)
+	serverCert, serverKey := ca1.writeCert(t, dir, "server")
+	clientCert, clientKey := ca1.writeCert(t, dir, "client")
+
+	_, err = NewTLSReloader(TLSConfig{CertFile: serverCert})
+	assert.NotNil(t, err)
+
+	sr, err := NewTLSReloader(TLSConfig{
+		CertFile:       serverCert,
+		KeyFile:        serverKey,
+		CAFile:         serverCA,
+		ClientCertAuth: true,
+	})
+	assert.Nil(t, err)
+	cr, err := NewTLSReloader(TLSConfig{
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		CAFile:     clientCA,
+		ServerName: "localhost",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, testTLSHandshake(t, sr.ServerConfig(), cr.ClientConfig()))
+	// the client without the certificate is refused by the server
+	assert.NotNil(t, testTLSHandshake(t, sr.ServerConfig(), &tls.Config{InsecureSkipVerify: true}))
+	changed, err := sr.reload()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	// the server certificate changed to another ca
+	ca2.writeCert(t, dir, "server")
+	changed, err = sr.reload()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.NotNil(t, testTLSHandshake(t, sr.ServerConfig(), cr.ClientConfig()))
+
+	writeTestTLSFile(t, clientCA, ca2.pem)
+	changed, err = cr.reload()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Nil(t, testTLSHandshake(t, sr.ServerConfig(), cr.ClientConfig()))
+
+	// the invalid file will not replace the loaded certificates
+	writeTestTLSFile(t, clientCA, []byte("invalid"))
+	_, err = cr.reload()
+	assert.NotNil(t, err)
+	assert.Nil(t, testTLSHandshake(t, sr.ServerConfig(), cr.ClientConfig()))
+
+	cr.conf.ServerName = "otherhost"
+	writeTestTLSFile(t, clientCA, ca2.pem)
+	_, err = cr.reload()
+	assert.Nil(t, err)
+	assert.NotNil(t, testTLSHandshake(t, sr.ServerConfig(), cr.ClientConfig()))
+
+	sr.Start()
+	sr.Stop()
+}
+
+func TestTLSPeerServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-peer-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca1 := newTestCA(t, "ca1")
+	ca2 := newTestCA(t, "ca2")
+	caFile := path.Join(dir, "ca.pem")
+	writeTestTLSFile(t, caFile, ca1.pem)
+	serverCert, serverKey := ca1.writeCert(t, dir, "server")
+	clientCert, clientKey := ca1.writeCert(t, dir, "client")
+	otherCert, otherKey := ca2.writeCert(t, dir, "other")
+
+	sr, err := NewTLSReloader(TLSConfig{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile})
+	assert.Nil(t, err)
+	cr, err := NewTLSReloader(TLSConfig{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+	other, err := NewTLSReloader(TLSConfig{CertFile: otherCert, KeyFile: otherKey, CAFile: caFile, ServerName: "localhost"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, testTLSHandshake(t, sr.PeerServerConfig(), cr.ClientConfig()))
+	// the client without certificate is allowed, and the api for peers should check it
+	assert.Nil(t, testTLSHandshake(t, sr.PeerServerConfig(), &tls.Config{InsecureSkipVerify: true}))
+	// the certificate not signed by the cluster ca is refused
+	assert.NotNil(t, testTLSHandshake(t, sr.PeerServerConfig(), other.ClientConfig()))
+	// the normal listener will not ask the client certificate
+	assert.Nil(t, testTLSHandshake(t, sr.ServerConfig(), other.ClientConfig()))
+}
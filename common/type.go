@@ -19,12 +19,17 @@ const (
 const (
 	LearnerRoleLogSyncer = "role_log_syncer"
 	LearnerRoleSearcher  = "role_searcher"
+	LearnerRoleCDC       = "role_cdc"
 )
 
 func IsRoleLogSyncer(role string) bool {
 	return strings.HasPrefix(role, LearnerRoleLogSyncer)
 }
 
+func IsRoleCDC(role string) bool {
+	return strings.HasPrefix(role, LearnerRoleCDC)
+}
+
 var (
 	SCAN_CURSOR_SEP = []byte(";")
 	SCAN_NODE_SEP   = []byte(":")
@@ -57,15 +62,17 @@ const (
 	HASH
 	SET
 	ZSET
+	STREAM
 	ALL
 )
 
 const (
-	KVName   = "KV"
-	ListName = "LIST"
-	HashName = "HASH"
-	SetName  = "SET"
-	ZSetName = "ZSET"
+	KVName     = "KV"
+	ListName   = "LIST"
+	HashName   = "HASH"
+	SetName    = "SET"
+	ZSetName   = "ZSET"
+	StreamName = "STREAM"
 )
 
 const (
@@ -84,6 +91,8 @@ func (d DataType) String() string {
 		return SetName
 	case ZSET:
 		return ZSetName
+	case STREAM:
+		return StreamName
 	default:
 		return "unknown"
 	}
@@ -96,7 +105,8 @@ const (
 	// do not need to care about the data expiration. Every node in the cluster should start the 'TTLChecker' of the storage system
 	// with this policy.
 	LocalDeletion ExpirationPolicy = iota
-	//
+	// PeriodicalRotation indicates the kv value with ttl will be stored in the time rotated buckets, and the whole bucket
+	// will be removed after all the keys in it expired. The ttl is stored in the values the same as WaitCompact.
 	PeriodicalRotation
 
 	// WaitCompact indicates that all ttl will be stored in the values and will be checked while compacting and reading
@@ -106,8 +116,9 @@ const (
 )
 
 const (
-	DefaultExpirationPolicy     = "local_deletion"
-	WaitCompactExpirationPolicy = "wait_compact"
+	DefaultExpirationPolicy            = "local_deletion"
+	WaitCompactExpirationPolicy        = "wait_compact"
+	PeriodicalRotationExpirationPolicy = "periodical_rotation"
 )
 
 var (
@@ -121,6 +132,8 @@ func StringToExpirationPolicy(s string) (ExpirationPolicy, error) {
 		return LocalDeletion, nil
 	case WaitCompactExpirationPolicy:
 		return WaitCompact, nil
+	case PeriodicalRotationExpirationPolicy:
+		return PeriodicalRotation, nil
 	default:
 		return UnknownPolicy, errors.New("unknown policy")
 	}
@@ -482,7 +495,16 @@ func (sh *SearchResultHeap) update(item *HIndexRespWithValues) {
 }
 
 type JSONIndexSchema struct {
-	State IndexState `json:"state"`
+	Name      string             `json:"name"`
+	IndexPath string             `json:"index_path"`
+	PrefixLen int32              `json:"prefix_len"`
+	Unique    int32              `json:"unique"`
+	ValueType IndexPropertyDType `json:"value_type"`
+	State     IndexState         `json:"state"`
+}
+
+func (s *JSONIndexSchema) IsValidNewSchema() bool {
+	return s.Name != "" && s.IndexPath != "" && s.ValueType < MaxVT && s.State < MaxIndexState
 }
 
 type IndexSchema struct {
@@ -27,6 +27,16 @@ const (
 	// check if the namespace raft node is synced and can be elected as leader immediately
 	APIIsRaftSynced = "/cluster/israftsynced"
 	APITableStats   = "/tablestats"
+	// check if the leader of the new partition by split has applied the seed data
+	APIIsSplitSeedApplied = "/cluster/issplitseedapplied"
+	// list and download the snapshot files for the native snapshot transfer
+	APISnapFileList = "/snapshot/files"
+	APISnapFile     = "/snapshot/file"
+	APISnapFileCRC  = "/snapshot/filecrc"
+	// the messages published on the other data nodes
+	APIPubSubForward = "/pubsub/forward"
+	// export the partition checkpoint for the namespace backup started by pd
+	APIBackupExport = "/kv/backup_export"
 
 	// below api for pd
 	APIGetSnapshotSyncInfo = "/pd/snapshot_sync_info"
@@ -203,12 +213,102 @@ func IsMergeIndexSearchCommand(cmd string) bool {
 	if len(cmd) != len("hidx.from") {
 		return false
 	}
-	return strings.ToLower(cmd) == "hidx.from"
+	lcmd := strings.ToLower(cmd)
+	return lcmd == "hidx.from" || lcmd == "jidx.from"
 }
 
 func IsMergeKeysCommand(cmd string) bool {
 	lcmd := strings.ToLower(cmd)
-	return lcmd == "plset" || lcmd == "exists" || lcmd == "del"
+	return lcmd == "plset" || lcmd == "exists" || lcmd == "del" ||
+		lcmd == "mget" || lcmd == "mset" || IsMergeSetsCommand(lcmd)
+}
+
+// the set algebra commands which need read the members of the sets from multi partitions
+func IsMergeSetsCommand(cmd string) bool {
+	lcmd := strings.ToLower(cmd)
+	return lcmd == "sinter" || lcmd == "sunion" || lcmd == "sdiff"
+}
+
+// SetInter return the members in all the sets, the members are in the order of the first set
+func SetInter(sets [][][]byte) [][]byte {
+	if len(sets) == 0 {
+		return [][]byte{}
+	}
+	for _, set := range sets {
+		if len(set) == 0 {
+			return [][]byte{}
+		}
+	}
+	counts := make(map[string]int, len(sets[0]))
+	for i, set := range sets {
+		for _, m := range set {
+			// the member in the same set should be counted only once
+			if c, ok := counts[string(m)]; ok && c == i {
+				counts[string(m)] = i + 1
+			} else if !ok && i == 0 {
+				counts[string(m)] = 1
+			}
+		}
+	}
+	rets := make([][]byte, 0, len(counts))
+	for _, m := range sets[0] {
+		if counts[string(m)] == len(sets) {
+			rets = append(rets, m)
+			// avoid the duplicate member
+			counts[string(m)] = 0
+		}
+	}
+	return rets
+}
+
+// SetUnion return the members in any of the sets
+func SetUnion(sets [][][]byte) [][]byte {
+	exists := make(map[string]bool)
+	rets := make([][]byte, 0)
+	for _, set := range sets {
+		for _, m := range set {
+			if exists[string(m)] {
+				continue
+			}
+			exists[string(m)] = true
+			rets = append(rets, m)
+		}
+	}
+	return rets
+}
+
+// SetDiff return the members in the first set but not in any of the other sets
+func SetDiff(sets [][][]byte) [][]byte {
+	if len(sets) == 0 {
+		return [][]byte{}
+	}
+	excluded := make(map[string]bool)
+	for _, set := range sets[1:] {
+		for _, m := range set {
+			excluded[string(m)] = true
+		}
+	}
+	rets := make([][]byte, 0, len(sets[0]))
+	for _, m := range sets[0] {
+		if excluded[string(m)] {
+			continue
+		}
+		excluded[string(m)] = true
+		rets = append(rets, m)
+	}
+	return rets
+}
+
+// MergeSets compute the result of the set algebra command from the members of each key
+func MergeSets(cmd string, sets [][][]byte) [][]byte {
+	switch strings.ToLower(cmd) {
+	case "sinter", "sinterstore":
+		return SetInter(sets)
+	case "sunion", "sunionstore":
+		return SetUnion(sets)
+	default:
+		return SetDiff(sets)
+	}
 }
 
 func IsMergeCommand(cmd string) bool {
@@ -1,6 +1,9 @@
 package common
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestIsValidNamespace(t *testing.T) {
 
@@ -21,3 +24,41 @@ func TestIsValidNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeSets(t *testing.T) {
+	toSet := func(ms ...string) [][]byte {
+		set := make([][]byte, 0, len(ms))
+		for _, m := range ms {
+			set = append(set, []byte(m))
+		}
+		return set
+	}
+	sets := [][][]byte{
+		toSet("a", "b", "c", "d"),
+		toSet("c", "a", "e", "a"),
+		toSet("a", "c", "f"),
+	}
+	tests := []struct {
+		name string
+		cmd  string
+		sets [][][]byte
+		want [][]byte
+	}{
+		{"inter", "sinter", sets, toSet("a", "c")},
+		{"inter store", "SINTERSTORE", sets, toSet("a", "c")},
+		{"inter with empty", "sinter", append(sets, nil), toSet()},
+		{"inter single", "sinter", sets[1:2], toSet("c", "a", "e")},
+		{"union", "sunion", sets, toSet("a", "b", "c", "d", "e", "f")},
+		{"union empty", "sunion", nil, toSet()},
+		{"diff", "sdiff", sets, toSet("b", "d")},
+		{"diff single", "sdiffstore", sets[1:2], toSet("c", "a", "e")},
+		{"diff empty first", "sdiff", [][][]byte{nil, sets[0]}, toSet()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeSets(tt.cmd, tt.sets); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeSets() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
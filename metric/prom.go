@@ -56,6 +56,10 @@ var (
 		Help:    "slow limiter queued cost distribution in slow wait queue",
 		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
 	}, []string{"namespace", "table", "cmd"})
+	QuotaRefusedCnt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "quota_refused_cnt",
+		Help: "refused counter for the request exceeded the namespace or table quota",
+	}, []string{"namespace", "table", "quota_type"})
 
 	QueueLen = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "queue_len",
@@ -72,6 +76,11 @@ var (
 		Help: "the important event counter for internal event",
 	}, []string{"namespace", "event_name"})
 
+	ClusterSyncConflictCnt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluster_sync_conflict_cnt",
+		Help: "the conflict counter for the writes from the other cluster in active-active sync",
+	}, []string{"namespace", "cmd", "resolution"})
+
 	TableKeyNum = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "table_key_num",
 		Help: "the key number stats for each table",
@@ -90,10 +99,33 @@ var (
 		Name: "write_cmd_total",
 		Help: "redis write command total counter",
 	}, []string{"namespace"})
+	FollowerReadCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "follower_read_total",
+		Help: "the read index waiting counter for the read on the follower",
+	}, []string{"result"})
 
 	CollectionLenDist = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "collection_length_dist",
 		Help:    "the length distribute for the large collections",
 		Buckets: prometheus.ExponentialBuckets(128, 2, 12),
 	}, []string{"table"})
+
+	ProxyClientConnNum = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "proxy_client_conn_num",
+		Help: "the connection number for each client in proxy",
+	}, []string{"client"})
+	ProxyClientCmdCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_client_cmd_total",
+		Help: "the command total counter for each client in proxy",
+	}, []string{"client", "namespace"})
+	ProxyClientErrCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_client_error_total",
+		Help: "the command error counter for each client in proxy",
+	}, []string{"client", "namespace"})
+	// unit is ms
+	ProxyCmdLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "proxy_cmd_latency",
+		Help:    "the command latency forwarded by proxy",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"namespace"})
 )
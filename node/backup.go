@@ -0,0 +1,311 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/rockredis"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+const (
+	backupExportStagingDir = "backup_exporting"
+	backupSnapshotWait     = time.Minute
+)
+
+var (
+	errBackupStoreNotReady        = errors.New("the store of the partition is not ready for backup")
+	errBackupArchiveDisabled      = errors.New("the raft log archive is needed for the namespace backup")
+	errBackupCutTooNew            = errors.New("the cut timestamp of backup is too far in the future")
+	errBackupSnapshotTimeout      = errors.New("wait the snapshot for backup timeout")
+	errBackupCheckpointNotFound   = errors.New("the checkpoint for backup is not found")
+	errBackupPartitionNumMismatch = errors.New("the partition number of the backup mismatch")
+)
+
+// ExportBackup export the data of the partition at the common cut timestamp of the namespace
+// backup. A backup proposal is committed as the barrier after the local time passed the cut,
+// so all the writes before the cut are in the raft logs before the barrier. If the checkpoint
+// of the barrier has the writes newer than the cut, the older checkpoint is exported with the
+// archived raft logs to replay up to the cut. The raft term-index of the checkpoint and the
+// cut is returned with the file checksums.
+func (nd *KVNode) ExportBackup(backupDir string, cutTs int64) (*common.PartitionBackupInfo, error) {
+	kvsm, ok := nd.sm.(*kvStoreSM)
+	if nd.store == nil || !ok {
+		return nil, errBackupStoreNotReady
+	}
+	if kvsm.archiver == nil {
+		return nil, errBackupArchiveDisabled
+	}
+	// the local clock may be behind the placement driver
+	if delay := time.Duration(cutTs - time.Now().UnixNano()); delay > 0 {
+		if delay > backupSnapshotWait {
+			return nil, errBackupCutTooNew
+		}
+		select {
+		case <-nd.stopChan:
+			return nil, common.ErrStopped
+		case <-time.After(delay):
+		}
+	}
+	lastSnap := nd.GetLastSnapIndex()
+	p := &customProposeData{
+		ProposeOp:  ProposeOp_Backup,
+		NeedBackup: true,
+	}
+	d, _ := json.Marshal(p)
+	_, err := nd.CustomPropose(d)
+	if err != nil {
+		return nil, err
+	}
+	// the snapshot is saved after the backup proposal applied
+	deadline := time.Now().Add(backupSnapshotWait)
+	for nd.GetLastSnapIndex() <= lastSnap {
+		if time.Now().After(deadline) {
+			return nil, errBackupSnapshotTimeout
+		}
+		select {
+		case <-nd.stopChan:
+			return nil, common.ErrStopped
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+	snapIndex := nd.GetLastSnapIndex()
+	checkpointDir := rockredis.GetBackupDir(nd.store.GetBackupBase())
+	// the archived logs before the snapshot are flushed while saving the snapshot
+	archiveStart, cutIndex, hasNewer, err := findBackupCut(kvsm.archiver.dir, getOldestCheckpointIndex(checkpointDir, snapIndex),
+		snapIndex, cutTs)
+	if err != nil {
+		return nil, err
+	}
+	ckIndex := snapIndex
+	if hasNewer {
+		ckIndex = cutIndex
+	}
+	ckName := rockredis.GetLatestCheckpoint(checkpointDir, 0, func(name string) bool {
+		_, index, err := parseCheckpointName(path.Base(name))
+		return err == nil && index <= ckIndex
+	})
+	if ckName == "" {
+		return nil, errBackupCheckpointNotFound
+	}
+	term, index, err := parseCheckpointName(path.Base(ckName))
+	if err != nil {
+		return nil, err
+	}
+	if !hasNewer {
+		cutIndex = index
+	} else if index < archiveStart {
+		// no archived logs to replay from the checkpoint
+		return nil, errBackupCheckpointNotFound
+	}
+	// link the checkpoint to avoid being purged by the new snapshots while exporting
+	stagingDir := path.Join(nd.store.GetBackupBase(), backupExportStagingDir, path.Base(ckName))
+	os.RemoveAll(stagingDir)
+	defer os.RemoveAll(stagingDir)
+	err = copyCheckpoint(ckName, stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	_, pid := common.GetNamespaceAndPartition(nd.ns)
+	info := &common.PartitionBackupInfo{
+		Partition: pid,
+		Term:      term,
+		Index:     index,
+		Dir:       nd.ns,
+		CutIndex:  cutIndex,
+	}
+	dstDir := path.Join(backupDir, info.Dir)
+	os.RemoveAll(dstDir)
+	info.Files, err = common.ExportBackupFiles(stagingDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if cutIndex > index {
+		archiveStaging := stagingDir + "-" + raftArchiveDirName
+		defer os.RemoveAll(archiveStaging)
+		err = copyRaftArchive(kvsm.archiver.dir, index+1, cutIndex, archiveStaging)
+		if err != nil {
+			return nil, err
+		}
+		info.ArchiveDir = nd.ns + "-" + raftArchiveDirName
+		archiveDstDir := path.Join(backupDir, info.ArchiveDir)
+		os.RemoveAll(archiveDstDir)
+		info.ArchiveFiles, err = common.ExportBackupFiles(archiveStaging, archiveDstDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nd.rn.Infof("node %v exported backup %v-%v (cut at %v, %v) to %v: %v files, %v archive files",
+		nd.ns, term, index, cutIndex, cutTs, dstDir, len(info.Files), len(info.ArchiveFiles))
+	return info, nil
+}
+
+// the oldest local checkpoint before the index, the backup cut should be found after it
+func getOldestCheckpointIndex(checkpointDir string, beforeIndex uint64) uint64 {
+	checkpointList, _ := filepath.Glob(path.Join(checkpointDir, "*-*"))
+	minIndex := beforeIndex
+	for _, ck := range checkpointList {
+		_, index, err := parseCheckpointName(path.Base(ck))
+		if err == nil && index < minIndex {
+			minIndex = index
+		}
+	}
+	return minIndex
+}
+
+// find the last raft index in (startIndex, endIndex] before the first write newer than the
+// cut timestamp, return true if such newer write is found. The start index is moved to the
+// first archived log if the archive is enabled after the start.
+func findBackupCut(archiveDir string, startIndex uint64, endIndex uint64, cutTs int64) (uint64, uint64, bool, error) {
+	cutIndex := startIndex
+	hasNewer := false
+	first := true
+	err := readRaftArchive(archiveDir, startIndex+1, func(rl *syncerpb.RaftLogData) (bool, error) {
+		if rl.Index <= startIndex {
+			return true, nil
+		}
+		if rl.Index > endIndex {
+			return false, nil
+		}
+		if first && rl.Index > cutIndex+1 {
+			startIndex = rl.Index - 1
+			cutIndex = startIndex
+		}
+		first = false
+		if rl.Index != cutIndex+1 {
+			return false, fmt.Errorf("%v: expect %v, got %v", errRaftArchiveGap, cutIndex+1, rl.Index)
+		}
+		if len(rl.Data) > 0 && rl.RaftTimestamp > cutTs {
+			var reqList BatchInternalRaftRequest
+			err := reqList.Unmarshal(rl.Data)
+			if err != nil {
+				return false, err
+			}
+			if !isBackupProposal(reqList) {
+				hasNewer = true
+				return false, nil
+			}
+		}
+		cutIndex = rl.Index
+		return true, nil
+	})
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !hasNewer && cutIndex < endIndex {
+		return 0, 0, false, fmt.Errorf("%v: archived logs end at %v before %v", errRaftArchiveGap, cutIndex, endIndex)
+	}
+	return startIndex, cutIndex, hasNewer, nil
+}
+
+// the backup proposal has no data change, so it is not counted as a write after the cut
+func isBackupProposal(reqList BatchInternalRaftRequest) bool {
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(CustomReq) {
+			return false
+		}
+		var p customProposeData
+		if err := json.Unmarshal(req.Data, &p); err != nil || p.ProposeOp != ProposeOp_Backup {
+			return false
+		}
+	}
+	return true
+}
+
+// IsRestoreSeeding return true if the data is seeded from the backup or the point-in-time
+// restore and no snapshot saved yet.
+func (nd *KVNode) IsRestoreSeeding() bool {
+	if nd.store == nil {
+		return false
+	}
+	return nd.store.isRestoreSeeding()
+}
+
+// prepare the local data for the new namespace restored from the namespace backup, all
+// the replicas of the partition are seeded from the same checkpoint in the backup.
+func (nsm *NamespaceMgr) prepareBackupRestoreSeed(conf *NamespaceConfig, kvOpts *KVOptions) error {
+	if conf.RestoreFrom == "" {
+		return nil
+	}
+	if _, err := os.Stat(kvOpts.DataDir); err == nil {
+		return nil
+	}
+	m, err := common.LoadBackupManifest(conf.RestoreFrom)
+	if err != nil {
+		nodeLog.Infof("namespace %v load backup manifest from %v failed: %v", conf.Name, conf.RestoreFrom, err)
+		return err
+	}
+	if m.PartitionNum != conf.PartitionNum {
+		return errBackupPartitionNumMismatch
+	}
+	_, pid := common.GetNamespaceAndPartition(conf.Name)
+	part, err := m.GetPartition(pid)
+	if err != nil {
+		return err
+	}
+	dataDir, err := engine.GetDataDirFromBase(kvOpts.RockOpts.EngineType, kvOpts.DataDir)
+	if err != nil {
+		return err
+	}
+	tmpDir := kvOpts.DataDir + "-restoring"
+	os.RemoveAll(tmpDir)
+	srcDir := path.Join(conf.RestoreFrom, part.Dir)
+	err = common.ImportBackupFiles(srcDir, path.Join(tmpDir, path.Base(dataDir)), part.Files)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	info := &RestoreInfo{
+		SrcDataDir:      srcDir,
+		CheckpointTerm:  part.Term,
+		CheckpointIndex: part.Index,
+		Term:            part.Term,
+		Index:           part.Index,
+		Timestamp:       m.CutTs,
+	}
+	if part.CutIndex > part.Index {
+		// replay the archived logs to the common cut of all the partitions
+		archiveDir := tmpDir + "-" + raftArchiveDirName
+		os.RemoveAll(archiveDir)
+		defer os.RemoveAll(archiveDir)
+		err = common.ImportBackupFiles(path.Join(conf.RestoreFrom, part.ArchiveDir), archiveDir, part.ArchiveFiles)
+		if err == nil {
+			err = replayBackupArchive(kvOpts, tmpDir, archiveDir, info, part.CutIndex)
+		}
+		if err != nil {
+			nodeLog.Infof("namespace %v replay backup archive failed: %v", conf.Name, err)
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+	d, _ := json.Marshal(info)
+	err = ioutil.WriteFile(getRestoreSeedInfoFileName(tmpDir), d, common.FILE_PERM)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	nodeLog.Infof("namespace %v seeded from backup: %v", conf.Name, string(d))
+	return os.Rename(tmpDir, kvOpts.DataDir)
+}
+
+func replayBackupArchive(kvOpts *KVOptions, dataDir string, archiveDir string, info *RestoreInfo, cutIndex uint64) error {
+	opts := *kvOpts
+	opts.DataDir = dataDir
+	sm, err := NewKVStoreSM(&opts, MachineConfig{}, 0, path.Base(kvOpts.DataDir), nil, nil)
+	if err != nil {
+		return err
+	}
+	sm.w = wait.New()
+	err = replayRaftArchive(sm, archiveDir, info, cutIndex, nil)
+	sm.Close()
+	return err
+}
@@ -0,0 +1,319 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+// the client blocked on the list keys until any of them is pushed
+type listBlockWaiter struct {
+	keys    [][]byte
+	mu      sync.Mutex
+	pushed  map[string]bool
+	notifyC chan struct{}
+	errC    chan error
+}
+
+func (w *listBlockWaiter) notify(key string) bool {
+	w.mu.Lock()
+	if w.pushed[key] {
+		w.mu.Unlock()
+		return false
+	}
+	w.pushed[key] = true
+	w.mu.Unlock()
+	select {
+	case w.notifyC <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// return the pushed keys in the order of the waiting keys
+func (w *listBlockWaiter) takePushed() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pushed) == 0 {
+		return nil
+	}
+	keys := make([][]byte, 0, len(w.pushed))
+	for _, k := range w.keys {
+		if w.pushed[string(k)] {
+			keys = append(keys, k)
+		}
+	}
+	w.pushed = make(map[string]bool)
+	return keys
+}
+
+// the waiters for the blocking list commands on the partition leader, the waiters
+// for the same key are woken in the order of registering.
+type listBlockWaiters struct {
+	mu      sync.Mutex
+	waiters map[string][]*listBlockWaiter
+}
+
+func newListBlockWaiters() *listBlockWaiters {
+	return &listBlockWaiters{
+		waiters: make(map[string][]*listBlockWaiter),
+	}
+}
+
+func (lw *listBlockWaiters) register(keys [][]byte) *listBlockWaiter {
+	w := &listBlockWaiter{
+		keys:    keys,
+		pushed:  make(map[string]bool),
+		notifyC: make(chan struct{}, 1),
+		errC:    make(chan error, 1),
+	}
+	lw.mu.Lock()
+	for _, k := range keys {
+		lw.waiters[string(k)] = append(lw.waiters[string(k)], w)
+	}
+	lw.mu.Unlock()
+	return w
+}
+
+func (lw *listBlockWaiters) unregister(w *listBlockWaiter) {
+	lw.mu.Lock()
+	for _, k := range w.keys {
+		ws := lw.waiters[string(k)]
+		for i, old := range ws {
+			if old == w {
+				ws = append(ws[:i], ws[i+1:]...)
+				break
+			}
+		}
+		if len(ws) == 0 {
+			delete(lw.waiters, string(k))
+		} else {
+			lw.waiters[string(k)] = ws
+		}
+	}
+	lw.mu.Unlock()
+	// the pushed elements not consumed by this waiter should be handled by others
+	for _, k := range w.takePushed() {
+		lw.wake(k, 1)
+	}
+}
+
+// wake at most n waiters for the pushed key
+func (lw *listBlockWaiters) wake(key []byte, n int) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for _, w := range lw.waiters[string(key)] {
+		if n <= 0 {
+			return
+		}
+		if w.notify(string(key)) {
+			n--
+		}
+	}
+}
+
+func (lw *listBlockWaiters) failAll(err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for _, ws := range lw.waiters {
+		for _, w := range ws {
+			select {
+			case w.errC <- err:
+			default:
+			}
+		}
+	}
+}
+
+// wake the blocked clients after the list is pushed or the members are added to the zset on the leader
+func (kvsm *kvStoreSM) wakeListWaiters(cmdName string, cmd redcon.Command) {
+	if kvsm.listWaiters == nil || !kvsm.isLeaderNode() {
+		return
+	}
+	switch cmdName {
+	case "lpush", "rpush":
+		if len(cmd.Args) > 2 {
+			kvsm.listWaiters.wake(cmd.Args[1], len(cmd.Args)-2)
+		}
+	case "rpoplpush", "lmove":
+		if len(cmd.Args) > 2 {
+			kvsm.listWaiters.wake(cmd.Args[2], 1)
+		}
+	case "zadd":
+		if len(cmd.Args) > 3 {
+			kvsm.listWaiters.wake(cmd.Args[1], (len(cmd.Args)-2)/2)
+		}
+	case "zincrby":
+		if len(cmd.Args) > 1 {
+			kvsm.listWaiters.wake(cmd.Args[1], 1)
+		}
+	case "zunionstore", "zinterstore":
+		// the number of the stored members is unknown, wake all the waiters
+		if len(cmd.Args) > 1 {
+			kvsm.listWaiters.wake(cmd.Args[1], common.MAX_BATCH_NUM)
+		}
+	}
+}
+
+func (nd *KVNode) proposeListPop(args ...[]byte) ([]byte, error) {
+	cmd := buildCommand(args)
+	rsp, err := nd.RedisPropose(cmd.Raw)
+	if err != nil {
+		return nil, err
+	}
+	v, err := checkAndRewriteBulkRsp(cmd, rsp)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// block until tryPop success for any of the keys. The pop will be tried on all the
+// non-empty lists at first, and then retried on the list after it is pushed. Return
+// false if timeout or the client is closed.
+func (nd *KVNode) blockingListOp(keys [][]byte, timeout time.Duration, closeC <-chan struct{},
+	tryPop func(key []byte) (bool, error)) (bool, error) {
+	return nd.blockingPopOp(keys, timeout, closeC, nd.store.LLen, tryPop)
+}
+
+func isClientClosed(closeC <-chan struct{}) bool {
+	select {
+	case <-closeC:
+		return true
+	default:
+		return false
+	}
+}
+
+// same as blockingListOp, the size is used to check whether the key is empty
+func (nd *KVNode) blockingPopOp(keys [][]byte, timeout time.Duration, closeC <-chan struct{},
+	size func(key []byte) (int64, error), tryPop func(key []byte) (bool, error)) (bool, error) {
+	if !nd.IsLead() {
+		return false, ErrNamespaceNotLeader
+	}
+	// register before checking the lists, so we will not miss the push between them
+	w := nd.listWaiters.register(keys)
+	defer nd.listWaiters.unregister(w)
+	for _, k := range keys {
+		n, err := size(k)
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			continue
+		}
+		if isClientClosed(closeC) {
+			return false, nil
+		}
+		done, err := tryPop(k)
+		if err != nil || done {
+			return done, err
+		}
+	}
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutC = t.C
+	}
+	for {
+		select {
+		case <-w.notifyC:
+			// the pushed data may be still in the write batch, so we propose the
+			// pop directly which will be applied after the push.
+			// the popped element will be lost if the client is gone, leave it to
+			// the other waiters which will be woken while unregistering.
+			if isClientClosed(closeC) {
+				return false, nil
+			}
+			for _, k := range w.takePushed() {
+				done, err := tryPop(k)
+				if err != nil || done {
+					return done, err
+				}
+			}
+		case err := <-w.errC:
+			return false, err
+		case <-timeoutC:
+			return false, nil
+		case <-closeC:
+			return false, nil
+		case <-nd.stopChan:
+			return false, errStopping
+		}
+	}
+}
+
+// BlockingPop pop the element from the first non-empty list in the keys, and block
+// until timeout if all the lists are empty. The keys should be in the same partition
+// without namespace, the timeout 0 means blocking forever and the closeC should be closed after
+// the client is gone. The returned key is nil if timeout.
+func (nd *KVNode) BlockingPop(keys [][]byte, left bool, timeout time.Duration, closeC <-chan struct{}) ([]byte, []byte, error) {
+	popCmd := []byte("rpop")
+	if left {
+		popCmd = []byte("lpop")
+	}
+	var popKey, popValue []byte
+	done, err := nd.blockingListOp(keys, timeout, closeC, func(key []byte) (bool, error) {
+		v, err := nd.proposeListPop(popCmd, key)
+		if err != nil || v == nil {
+			return false, err
+		}
+		popKey = key
+		popValue = v
+		return true, nil
+	})
+	if err != nil || !done {
+		return nil, nil, err
+	}
+	return popKey, popValue, nil
+}
+
+// BlockingRPopLPush is the blocking version of rpoplpush, the element is moved from source to
+// destination in the same raft proposal. Return nil if timeout.
+func (nd *KVNode) BlockingRPopLPush(src []byte, dst []byte, timeout time.Duration, closeC <-chan struct{}) ([]byte, error) {
+	var popValue []byte
+	done, err := nd.blockingListOp([][]byte{src}, timeout, closeC, func(key []byte) (bool, error) {
+		v, err := nd.proposeListPop([]byte("rpoplpush"), src, dst)
+		if err != nil || v == nil {
+			return false, err
+		}
+		popValue = v
+		return true, nil
+	})
+	if err != nil || !done {
+		return nil, err
+	}
+	return popValue, nil
+}
+
+// BlockingZPopMin pop the member with the lowest score from the first non-empty zset in the keys,
+// and block until timeout if all the zsets are empty. The keys should be in the same partition
+// without namespace. Return the popped key, member and score, the key is nil if timeout.
+func (nd *KVNode) BlockingZPopMin(keys [][]byte, timeout time.Duration, closeC <-chan struct{}) ([]byte, [][]byte, error) {
+	var popKey []byte
+	var popValue [][]byte
+	done, err := nd.blockingPopOp(keys, timeout, closeC, nd.store.ZCard, func(key []byte) (bool, error) {
+		cmd := buildCommand([][]byte{[]byte("zpopmin"), key})
+		rsp, err := nd.RedisPropose(cmd.Raw)
+		if err != nil {
+			return false, err
+		}
+		v, ok := rsp.([][]byte)
+		if !ok {
+			return false, errInvalidResponse
+		}
+		if len(v) == 0 {
+			return false, nil
+		}
+		popKey = key
+		popValue = v
+		return true, nil
+	})
+	if err != nil || !done {
+		return nil, nil, err
+	}
+	return popKey, popValue, nil
+}
@@ -0,0 +1,845 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/raft/raftpb"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+const (
+	cdcDirName             = "cdc"
+	cdcConsumerDirName     = "consumers"
+	cdcStateFileName       = "state"
+	cdcFileSuffix          = ".log"
+	cdcSegmentSize         = 64 * 1024 * 1024
+	cdcDefaultKeepSegments = 16
+	cdcReadBufferSize      = 256 * 1024
+	cdcSubscribeBatch      = 256
+	cdcSubscribeIdleWait   = time.Second
+)
+
+var (
+	errCDCNotEnabled       = errors.New("the change data capture is not enabled on the node")
+	errCDCPositionLost     = errors.New("the change events at the position are purged or skipped by the snapshot")
+	errCDCInvalidConsumer  = errors.New("invalid change data capture consumer name")
+	errCDCPositionMismatch = errors.New("the position is not for this raft group")
+)
+
+// build the per-key change events from the write commands really applied by the raft log, the
+// keys are in the format of table:key and the args are the arguments following the key in the command.
+func buildCDCEvents(ns string, pid int, cmds []redcon.Command, ts int64, term uint64, index uint64) []syncerpb.CDCEvent {
+	var events []syncerpb.CDCEvent
+	for _, cmd := range cmds {
+		args := cmd.Args
+		if len(args) < 2 {
+			continue
+		}
+		cmdName := strings.ToLower(string(args[0]))
+		keyIndexes := make([]int, 0, 1)
+		forEachWriteKeyIndex(cmdName, args, func(i int) bool {
+			keyIndexes = append(keyIndexes, i)
+			return true
+		})
+		for n, i := range keyIndexes {
+			end := len(args)
+			if n+1 < len(keyIndexes) {
+				end = keyIndexes[n+1]
+			}
+			e := syncerpb.CDCEvent{
+				Namespace: ns,
+				Partition: int32(pid),
+				Key:       args[i],
+				Command:   cmdName,
+				Term:      term,
+				Index:     index,
+				Timestamp: ts,
+			}
+			if table, _, err := common.ExtractTable(args[i]); err == nil {
+				e.Table = string(table)
+			}
+			if i+1 < end {
+				e.Args = args[i+1 : end]
+			}
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+type cdcSegment struct {
+	firstIndex uint64
+	fileName   string
+}
+
+// list the change event segments sorted by the first raft index covered by each segment
+func listCDCSegments(dir string) ([]cdcSegment, error) {
+	fileList, err := filepath.Glob(path.Join(dir, "*"+cdcFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]cdcSegment, 0, len(fileList))
+	for _, fn := range fileList {
+		index, err := strconv.ParseUint(strings.TrimSuffix(path.Base(fn), cdcFileSuffix), 16, 64)
+		if err != nil {
+			nodeLog.Infof("ignore invalid cdc file: %v", fn)
+			continue
+		}
+		segs = append(segs, cdcSegment{firstIndex: index, fileName: fn})
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].firstIndex < segs[j].firstIndex
+	})
+	return segs, nil
+}
+
+// read the complete event lines in the file from the offset, the partial line at the end is ignored.
+// The callback return false to stop reading before the line, and the offset after the last
+// line accepted is returned.
+func readCDCLines(r *bufio.Reader, offset int64, fn func(e *syncerpb.CDCEvent) (bool, error)) (int64, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		var e syncerpb.CDCEvent
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return offset, fmt.Errorf("invalid cdc event at offset %v: %v", offset, err)
+		}
+		accepted, err := fn(&e)
+		if err != nil || !accepted {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
+
+type cdcState struct {
+	// the events before the first index may be purged or skipped by the snapshot
+	FirstIndex uint64 `json:"first_index"`
+	// all the raft logs before the snapshot index have been written to the segments
+	SnapIndex uint64 `json:"snap_index"`
+}
+
+// cdcLog write the change events as json lines to the rolling segment files, each segment
+// is named by the first raft index it covers. The readers tail the segments while writing.
+type cdcLog struct {
+	sync.Mutex
+	dir        string
+	grpName    string
+	keepSegs   int
+	f          *os.File
+	fileSize   int64
+	lastIndex  uint64
+	firstIndex uint64
+	snapIndex  uint64
+	buf        bytes.Buffer
+	notifyC    chan struct{}
+	stopC      chan struct{}
+	stopOnce   sync.Once
+}
+
+func newCDCLog(dir string, grpName string, keepSegs int) (*cdcLog, error) {
+	if keepSegs <= 0 {
+		keepSegs = cdcDefaultKeepSegments
+	}
+	cl := &cdcLog{
+		dir:      dir,
+		grpName:  grpName,
+		keepSegs: keepSegs,
+		notifyC:  make(chan struct{}),
+		stopC:    make(chan struct{}),
+	}
+	err := os.MkdirAll(path.Join(dir, cdcConsumerDirName), common.DIR_PERM)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ioutil.ReadFile(path.Join(dir, cdcStateFileName))
+	if err == nil {
+		var state cdcState
+		err = json.Unmarshal(d, &state)
+		if err != nil {
+			return nil, err
+		}
+		cl.firstIndex = state.FirstIndex
+		cl.snapIndex = state.SnapIndex
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	segs, err := listCDCSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) > 0 {
+		err = cl.openSegment(segs[len(segs)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cl.snapIndex > cl.lastIndex {
+		cl.lastIndex = cl.snapIndex
+	}
+	nodeLog.Infof("%v cdc log opened, first index: %v, last index: %v", grpName, cl.firstIndex, cl.lastIndex)
+	return cl, nil
+}
+
+// open the segment for append and remove the partial line at the end
+func (cl *cdcLog) openSegment(seg cdcSegment) error {
+	f, err := os.OpenFile(seg.fileName, os.O_RDWR, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	offset, err := readCDCLines(bufio.NewReaderSize(f, cdcReadBufferSize), 0, func(e *syncerpb.CDCEvent) (bool, error) {
+		cl.lastIndex = e.Index
+		return true, nil
+	})
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	cl.f = f
+	cl.fileSize = offset
+	if seg.firstIndex > cl.lastIndex+1 {
+		cl.lastIndex = seg.firstIndex - 1
+	}
+	return nil
+}
+
+func (cl *cdcLog) saveState() error {
+	d, _ := json.Marshal(cdcState{FirstIndex: cl.firstIndex, SnapIndex: cl.snapIndex})
+	fileName := path.Join(cl.dir, cdcStateFileName)
+	err := ioutil.WriteFile(fileName+".tmp", d, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+func (cl *cdcLog) getLastIndex() uint64 {
+	return atomic.LoadUint64(&cl.lastIndex)
+}
+
+func (cl *cdcLog) getFirstIndex() uint64 {
+	return atomic.LoadUint64(&cl.firstIndex)
+}
+
+func (cl *cdcLog) getNotify() chan struct{} {
+	cl.Lock()
+	ch := cl.notifyC
+	cl.Unlock()
+	return ch
+}
+
+func (cl *cdcLog) notifyReaders() {
+	close(cl.notifyC)
+	cl.notifyC = make(chan struct{})
+}
+
+func (cl *cdcLog) closeSegment() error {
+	if cl.f == nil {
+		return nil
+	}
+	err := cl.f.Sync()
+	cl.f.Close()
+	cl.f = nil
+	cl.fileSize = 0
+	return err
+}
+
+func (cl *cdcLog) rotate(index uint64) error {
+	err := cl.closeSegment()
+	if err != nil {
+		return err
+	}
+	fileName := path.Join(cl.dir, fmt.Sprintf("%016x%s", index, cdcFileSuffix))
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	cl.f = f
+	cl.fileSize = 0
+	cl.purge()
+	return nil
+}
+
+// purge the oldest segments exceeding the retention, the consumers behind the purged
+// segments will lose the position.
+func (cl *cdcLog) purge() {
+	segs, err := listCDCSegments(cl.dir)
+	if err != nil || len(segs) <= cl.keepSegs {
+		return
+	}
+	purged := segs[:len(segs)-cl.keepSegs]
+	atomic.StoreUint64(&cl.firstIndex, segs[len(purged)].firstIndex)
+	err = cl.saveState()
+	if err != nil {
+		nodeLog.Warningf("%v save cdc state failed: %v", cl.grpName, err)
+		return
+	}
+	for _, seg := range purged {
+		nodeLog.Infof("%v purge cdc segment: %v", cl.grpName, seg.fileName)
+		os.Remove(seg.fileName)
+	}
+}
+
+// append the change events of the raft log, the raft log without any change event should
+// also be appended to advance the index. The log already written will be ignored while replaying.
+func (cl *cdcLog) append(index uint64, events []syncerpb.CDCEvent) error {
+	cl.Lock()
+	defer cl.Unlock()
+	if index <= cl.lastIndex {
+		return nil
+	}
+	if cl.lastIndex > 0 && index != cl.lastIndex+1 {
+		// some events may be lost since the last write failed
+		nodeLog.Warningf("%v cdc log skipped from %v to %v", cl.grpName, cl.lastIndex, index)
+		atomic.StoreUint64(&cl.firstIndex, index)
+		if err := cl.saveState(); err != nil {
+			return err
+		}
+		if err := cl.rotate(index); err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		atomic.StoreUint64(&cl.lastIndex, index)
+		return nil
+	}
+	if cl.f == nil || cl.fileSize >= cdcSegmentSize {
+		err := cl.rotate(cl.lastIndex + 1)
+		if err != nil {
+			return err
+		}
+	}
+	cl.buf.Reset()
+	enc := json.NewEncoder(&cl.buf)
+	for i := range events {
+		err := enc.Encode(&events[i])
+		if err != nil {
+			return err
+		}
+	}
+	// the events of one raft log are written at once, so the readers will not see the partial log
+	// before the last index updated.
+	_, err := cl.f.Write(cl.buf.Bytes())
+	if err != nil {
+		cl.f.Truncate(cl.fileSize)
+		cl.f.Seek(cl.fileSize, io.SeekStart)
+		return err
+	}
+	cl.fileSize += int64(cl.buf.Len())
+	atomic.StoreUint64(&cl.lastIndex, index)
+	cl.notifyReaders()
+	return nil
+}
+
+// sync the written events to disk and remember the snapshot index, so the raft logs
+// before the snapshot will not be lost after restart.
+func (cl *cdcLog) sync(snapIndex uint64) error {
+	cl.Lock()
+	defer cl.Unlock()
+	if cl.f != nil {
+		err := cl.f.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	if snapIndex <= cl.snapIndex {
+		return nil
+	}
+	cl.snapIndex = snapIndex
+	return cl.saveState()
+}
+
+// restore to the snapshot index. The events after the snapshot are removed since the
+// raft logs after the snapshot will be replayed. If the snapshot is newer than the
+// written events, the events before the snapshot are skipped and all the segments are removed.
+func (cl *cdcLog) restore(snapIndex uint64) error {
+	cl.Lock()
+	defer cl.Unlock()
+	defer cl.notifyReaders()
+	if snapIndex > cl.lastIndex {
+		nodeLog.Infof("%v cdc log skipped from %v to snapshot %v", cl.grpName, cl.lastIndex, snapIndex)
+		cl.closeSegment()
+		atomic.StoreUint64(&cl.firstIndex, snapIndex+1)
+		atomic.StoreUint64(&cl.lastIndex, snapIndex)
+		cl.snapIndex = snapIndex
+		err := cl.saveState()
+		if err != nil {
+			return err
+		}
+		segs, err := listCDCSegments(cl.dir)
+		if err != nil {
+			return err
+		}
+		for _, seg := range segs {
+			os.Remove(seg.fileName)
+		}
+		return nil
+	}
+	return cl.truncateAfter(snapIndex)
+}
+
+// remove the events after the index
+func (cl *cdcLog) truncateAfter(index uint64) error {
+	if index >= cl.lastIndex {
+		return nil
+	}
+	cl.closeSegment()
+	segs, err := listCDCSegments(cl.dir)
+	if err != nil {
+		return err
+	}
+	for len(segs) > 0 && segs[len(segs)-1].firstIndex > index {
+		os.Remove(segs[len(segs)-1].fileName)
+		segs = segs[:len(segs)-1]
+	}
+	atomic.StoreUint64(&cl.lastIndex, index)
+	if cl.snapIndex > index {
+		cl.snapIndex = index
+		err = cl.saveState()
+		if err != nil {
+			return err
+		}
+	}
+	if len(segs) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(segs[len(segs)-1].fileName, os.O_RDWR, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	offset, err := readCDCLines(bufio.NewReaderSize(f, cdcReadBufferSize), 0, func(e *syncerpb.CDCEvent) (bool, error) {
+		return e.Index <= index, nil
+	})
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	cl.f = f
+	cl.fileSize = offset
+	nodeLog.Infof("%v cdc log truncated after %v", cl.grpName, index)
+	return nil
+}
+
+func (cl *cdcLog) close() error {
+	cl.stopOnce.Do(func() {
+		close(cl.stopC)
+	})
+	cl.Lock()
+	defer cl.Unlock()
+	return cl.closeSegment()
+}
+
+// find the segment to read, the first segment after the current one if switching
+// to the next, or the segment which may contain the index.
+func findCDCSegment(segs []cdcSegment, index uint64, current *cdcSegment) (cdcSegment, bool) {
+	if current != nil {
+		for _, seg := range segs {
+			if seg.firstIndex > current.firstIndex {
+				return seg, true
+			}
+		}
+		return cdcSegment{}, false
+	}
+	if len(segs) == 0 {
+		return cdcSegment{}, false
+	}
+	found := segs[0]
+	for _, seg := range segs {
+		if seg.firstIndex > index {
+			break
+		}
+		found = seg
+	}
+	return found, true
+}
+
+// subscribe the change events from the start index, the events of the same raft log
+// are always in the same batch. It will wait the new events until stopped or the callback
+// return error.
+func (cl *cdcLog) subscribe(startIndex uint64, stop <-chan struct{}, fn func([]syncerpb.CDCEvent) error) error {
+	next := startIndex
+	var cur *cdcSegment
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	var offset int64
+	r := bufio.NewReaderSize(nil, cdcReadBufferSize)
+	batch := make([]syncerpb.CDCEvent, 0, cdcSubscribeBatch)
+	for {
+		if next < cl.getFirstIndex() {
+			return errCDCPositionLost
+		}
+		notify := cl.getNotify()
+		segs, err := listCDCSegments(cl.dir)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			seg, ok := findCDCSegment(segs, next, cur)
+			if ok {
+				f, err = os.Open(seg.fileName)
+				if os.IsNotExist(err) {
+					// purged while switching
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				cur = &seg
+				offset = 0
+			}
+		}
+		if f != nil {
+			// the segment will not be written anymore if there is newer one, it should be
+			// checked before loading the last index to make sure we read all the events in it.
+			hasNewer := segs[len(segs)-1].firstIndex > cur.firstIndex
+			written := cl.getLastIndex()
+			_, err = f.Seek(offset, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			r.Reset(f)
+			batch = batch[:0]
+			newOffset, err := readCDCLines(r, offset, func(e *syncerpb.CDCEvent) (bool, error) {
+				if e.Index > written {
+					return false, nil
+				}
+				if e.Index < next {
+					return true, nil
+				}
+				if len(batch) >= cdcSubscribeBatch && e.Index != batch[len(batch)-1].Index {
+					return false, nil
+				}
+				batch = append(batch, *e)
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(batch) > 0 {
+				err = fn(batch)
+				if err != nil {
+					return err
+				}
+				next = batch[len(batch)-1].Index + 1
+			}
+			if newOffset > offset {
+				offset = newOffset
+				continue
+			}
+			if hasNewer {
+				f.Close()
+				f = nil
+				continue
+			}
+		}
+		select {
+		case <-stop:
+			return common.ErrStopped
+		case <-cl.stopC:
+			return common.ErrStopped
+		case <-notify:
+		case <-time.After(cdcSubscribeIdleWait):
+		}
+	}
+}
+
+func (cl *cdcLog) consumerFile(consumer string) (string, error) {
+	if !common.IsValidNamespaceName(consumer) {
+		return "", errCDCInvalidConsumer
+	}
+	return path.Join(cl.dir, cdcConsumerDirName, consumer+".json"), nil
+}
+
+// save the position of the consumer, the subscribe will resume after it if no start index
+func (cl *cdcLog) commitPosition(pos *syncerpb.CDCPosition) error {
+	fileName, err := cl.consumerFile(pos.Consumer)
+	if err != nil {
+		return err
+	}
+	d, _ := json.Marshal(pos)
+	err = ioutil.WriteFile(fileName+".tmp", d, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// get the committed position of the consumer, the index is 0 if never committed
+func (cl *cdcLog) getPosition(consumer string) (*syncerpb.CDCPosition, error) {
+	fileName, err := cl.consumerFile(consumer)
+	if err != nil {
+		return nil, err
+	}
+	pos := &syncerpb.CDCPosition{Consumer: consumer, RaftGroupName: cl.grpName}
+	d, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return pos, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(d, pos)
+	return pos, err
+}
+
+// cdcSM is the state machine for the cdc learner, it applies the committed raft logs to the
+// local data replica, and writes the per-key change events of the writes really applied to the
+// local files for the consumers. So the aborted transactions, the failed scripts, the discarded
+// conflict writes and the writes refused by the split fence will have no event.
+type cdcSM struct {
+	fullNS        string
+	ns            string
+	pid           int
+	machineConfig MachineConfig
+	ID            uint64
+	eventCnt      int64
+	log           *cdcLog
+	kvsm          *kvStoreSM
+	applied       []redcon.Command
+}
+
+func NewCDCSM(opts *KVOptions, machineConfig MachineConfig, localID uint64, fullNS string,
+	clusterInfo common.IClusterInfo, w wait.Wait, sl *SlowLimiter) (*cdcSM, error) {
+	ns, pid := common.GetNamespaceAndPartition(fullNS)
+	cl, err := newCDCLog(path.Join(opts.DataDir, cdcDirName), fullNS, machineConfig.CDCKeepSegments)
+	if err != nil {
+		return nil, err
+	}
+	kvsm, err := NewKVStoreSM(opts, machineConfig, localID, fullNS, clusterInfo, sl)
+	if err != nil {
+		cl.close()
+		return nil, err
+	}
+	kvsm.w = w
+	sm := &cdcSM{
+		fullNS:        fullNS,
+		ns:            ns,
+		pid:           pid,
+		machineConfig: machineConfig,
+		ID:            localID,
+		log:           cl,
+		kvsm:          kvsm,
+	}
+	kvsm.appliedRecorder = func(cmdName string, cmd redcon.Command) {
+		sm.applied = append(sm.applied, cmd)
+	}
+	return sm, nil
+}
+
+func (sm *cdcSM) Infof(f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	nodeLog.InfoDepth(1, fmt.Sprintf("%v-%v: %s", sm.fullNS, sm.ID, msg))
+}
+
+func (sm *cdcSM) Errorf(f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	nodeLog.ErrorDepth(1, fmt.Sprintf("%v-%v: %s", sm.fullNS, sm.ID, msg))
+}
+
+func (sm *cdcSM) Optimize(t string) {
+	sm.kvsm.Optimize(t)
+}
+func (sm *cdcSM) OptimizeAnyRange(r CompactAPIRange) {
+	sm.kvsm.OptimizeAnyRange(r)
+}
+func (sm *cdcSM) DisableOptimize(disable bool) {
+	sm.kvsm.DisableOptimize(disable)
+}
+func (sm *cdcSM) OptimizeExpire() {
+	sm.kvsm.OptimizeExpire()
+}
+func (sm *cdcSM) ClearTopn() {
+}
+func (sm *cdcSM) EnableTopn(on bool) {
+}
+
+func (sm *cdcSM) GetStats(table string, needTableDetail bool) metric.NamespaceStats {
+	ns := sm.kvsm.GetStats(table, needTableDetail)
+	stat := make(map[string]interface{})
+	for k, v := range ns.InternalStats {
+		stat[k] = v
+	}
+	stat["role"] = sm.machineConfig.LearnerRole
+	stat["events"] = atomic.LoadInt64(&sm.eventCnt)
+	stat["first_index"] = sm.log.getFirstIndex()
+	stat["last_index"] = sm.log.getLastIndex()
+	ns.InternalStats = stat
+	return ns
+}
+
+// the raft logs will be replayed from the beginning if no snapshot
+func (sm *cdcSM) CleanData() error {
+	err := sm.kvsm.CleanData()
+	if err != nil {
+		return err
+	}
+	sm.log.Lock()
+	defer sm.log.Unlock()
+	return sm.log.truncateAfter(0)
+}
+
+func (sm *cdcSM) Destroy() {
+	sm.kvsm.Destroy()
+}
+
+func (sm *cdcSM) GetBatchOperator() IBatchOperator {
+	return sm.kvsm.GetBatchOperator()
+}
+
+func (sm *cdcSM) Start() error {
+	return sm.kvsm.Start()
+}
+
+func (sm *cdcSM) Close() {
+	sm.kvsm.Close()
+	err := sm.log.close()
+	if err != nil {
+		sm.Errorf("close cdc log failed: %v", err)
+	}
+}
+
+func (sm *cdcSM) GetSnapshot(term uint64, index uint64) (*KVSnapInfo, error) {
+	si, err := sm.kvsm.GetSnapshot(term, index)
+	if err != nil {
+		return si, err
+	}
+	return si, sm.log.sync(index)
+}
+
+func (sm *cdcSM) UpdateSnapshotState(term uint64, index uint64) {
+	sm.kvsm.UpdateSnapshotState(term, index)
+}
+
+func (sm *cdcSM) PrepareSnapshot(raftSnapshot raftpb.Snapshot, stop chan struct{}) error {
+	return sm.kvsm.PrepareSnapshot(raftSnapshot, stop)
+}
+
+// the events before the snapshot will be skipped if not written yet
+func (sm *cdcSM) RestoreFromSnapshot(raftSnapshot raftpb.Snapshot, stop chan struct{}) error {
+	err := sm.kvsm.RestoreFromSnapshot(raftSnapshot, stop)
+	if err != nil {
+		return err
+	}
+	return sm.log.restore(raftSnapshot.Metadata.Index)
+}
+
+func (sm *cdcSM) ApplyRaftConfRequest(req raftpb.ConfChange, term uint64, index uint64, stop chan struct{}) error {
+	err := sm.kvsm.ApplyRaftConfRequest(req, term, index, stop)
+	if err != nil {
+		return err
+	}
+	return sm.log.append(index, nil)
+}
+
+func (sm *cdcSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator, reqList BatchInternalRaftRequest, term uint64, index uint64, stop chan struct{}) (bool, error) {
+	sm.applied = sm.applied[:0]
+	forceBackup, retErr := sm.kvsm.ApplyRaftRequest(isReplaying, batch, reqList, term, index, stop)
+	// the batched writes should be committed to know which of them are really applied by this raft log
+	batch.CommitBatch()
+	ts := reqList.Timestamp
+	if ts == 0 && len(reqList.Reqs) > 0 {
+		ts = reqList.Reqs[0].Header.Timestamp
+	}
+	events := buildCDCEvents(sm.ns, sm.pid, sm.applied, ts, term, index)
+	for i := range sm.applied {
+		sm.applied[i] = redcon.Command{}
+	}
+	err := sm.log.append(index, events)
+	if err != nil {
+		sm.Errorf("write cdc events at %v-%v failed: %v", term, index, err)
+		return forceBackup, err
+	}
+	atomic.AddInt64(&sm.eventCnt, int64(len(events)))
+	return forceBackup, retErr
+}
+
+func (nd *KVNode) getCDCSM() (*cdcSM, error) {
+	sm, ok := nd.sm.(*cdcSM)
+	if !ok {
+		return nil, errCDCNotEnabled
+	}
+	return sm, nil
+}
+
+// SubscribeCDC stream the change events of the partition to the callback. The events start
+// from the start index, or after the committed position of the consumer if the start index is 0.
+func (nd *KVNode) SubscribeCDC(consumer string, startIndex uint64, stop <-chan struct{}, fn func([]syncerpb.CDCEvent) error) error {
+	sm, err := nd.getCDCSM()
+	if err != nil {
+		return err
+	}
+	if startIndex == 0 {
+		pos, err := sm.log.getPosition(consumer)
+		if err != nil {
+			return err
+		}
+		if pos.Index > 0 {
+			startIndex = pos.Index + 1
+		} else {
+			startIndex = sm.log.getFirstIndex()
+		}
+	}
+	nd.rn.Infof("consumer %v subscribe cdc events from %v", consumer, startIndex)
+	return sm.log.subscribe(startIndex, stop, fn)
+}
+
+// CommitCDCPosition save the position of the last event handled by the consumer
+func (nd *KVNode) CommitCDCPosition(pos *syncerpb.CDCPosition) error {
+	sm, err := nd.getCDCSM()
+	if err != nil {
+		return err
+	}
+	if pos.RaftGroupName != nd.ns {
+		return errCDCPositionMismatch
+	}
+	return sm.log.commitPosition(pos)
+}
+
+func (nd *KVNode) GetCDCPosition(consumer string) (*syncerpb.CDCPosition, error) {
+	sm, err := nd.getCDCSM()
+	if err != nil {
+		return nil, err
+	}
+	return sm.log.getPosition(consumer)
+}
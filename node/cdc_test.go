@@ -0,0 +1,252 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/rockredis"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+func buildCDCTestCmd(args ...string) redcon.Command {
+	cmdArgs := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, []byte(arg))
+	}
+	return buildCommand(cmdArgs)
+}
+
+func TestCDCBuildEvents(t *testing.T) {
+	cmds := []redcon.Command{
+		buildCDCTestCmd("SET", "tb1:k1", "v1"),
+		buildCDCTestCmd("hset", "tb2:k2", "f1", "v2"),
+		buildCDCTestCmd("mset", "tb1:k3", "v3", "tb1:k4", "v4"),
+		buildCDCTestCmd("del", "tb1:k5", "tb3:k6"),
+	}
+	events := buildCDCEvents("test", 1, cmds, 100, 2, 10)
+	assert.Equal(t, 6, len(events))
+	for _, e := range events {
+		assert.Equal(t, "test", e.Namespace)
+		assert.Equal(t, int32(1), e.Partition)
+		assert.Equal(t, uint64(2), e.Term)
+		assert.Equal(t, uint64(10), e.Index)
+		assert.Equal(t, int64(100), e.Timestamp)
+	}
+	assert.Equal(t, "set", events[0].Command)
+	assert.Equal(t, "tb1", events[0].Table)
+	assert.Equal(t, "tb1:k1", string(events[0].Key))
+	assert.Equal(t, [][]byte{[]byte("v1")}, events[0].Args)
+	assert.Equal(t, "tb2", events[1].Table)
+	assert.Equal(t, "tb2:k2", string(events[1].Key))
+	assert.Equal(t, 2, len(events[1].Args))
+	assert.Equal(t, "tb1:k4", string(events[3].Key))
+	assert.Equal(t, [][]byte{[]byte("v4")}, events[3].Args)
+	assert.Equal(t, "tb3", events[5].Table)
+	assert.Equal(t, 0, len(events[5].Args))
+}
+
+func TestCDCOnlyAppliedEvents(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("cdc-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	kvOpts := &KVOptions{
+		DataDir:          tmpDir,
+		EngType:          rockredis.EngType,
+		ExpirationPolicy: common.LocalDeletion,
+	}
+	engine.FillDefaultOptions(&kvOpts.RockOpts)
+	sm, err := NewCDCSM(kvOpts, MachineConfig{LearnerRole: common.LearnerRoleCDC}, 1, "test-0", nil, wait.New(), nil)
+	assert.Nil(t, err)
+	defer sm.Close()
+
+	index := uint64(0)
+	apply := func(ts int64, reqs ...InternalRaftRequest) {
+		index++
+		batch := sm.GetBatchOperator()
+		_, err := sm.ApplyRaftRequest(false, batch, BatchInternalRaftRequest{Timestamp: ts, Reqs: reqs}, 1, index, nil)
+		assert.Nil(t, err)
+	}
+	buildMultiReqs := func(ts int64, watchVer int64, args ...string) []InternalRaftRequest {
+		d, err := json.Marshal(multiExecMeta{
+			WatchKeys: [][]byte{[]byte("test:k1")},
+			WatchVers: []int64{watchVer},
+		})
+		assert.Nil(t, err)
+		return []InternalRaftRequest{
+			{Header: RequestHeader{DataType: int32(MultiExecReq), Timestamp: ts}, Data: d},
+			buildTestSyncReq(ts, args),
+		}
+	}
+	apply(100, buildTestSyncReq(100, []string{"set", "test:k1", "v1"}))
+	// aborted by the watched key
+	apply(200, buildMultiReqs(200, 50, "set", "test:k2", "v2")...)
+	// failed since not an integer
+	apply(300, buildTestSyncReq(300, []string{"incr", "test:k1"}))
+	apply(400, buildMultiReqs(400, 100, "set", "test:k3", "v3")...)
+	apply(500, buildTestSyncReq(500, []string{"set", "test:k4", "v4"}))
+
+	events, err := collectCDCEvents(t, sm.log, 1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(events))
+	keys := make([]string, 0, len(events))
+	indexes := make([]uint64, 0, len(events))
+	for _, e := range events {
+		keys = append(keys, string(e.Key))
+		indexes = append(indexes, e.Index)
+	}
+	assert.Equal(t, []string{"test:k1", "test:k3", "test:k4"}, keys)
+	assert.Equal(t, []uint64{1, 4, 5}, indexes)
+	assert.Equal(t, uint64(5), sm.log.getLastIndex())
+	v, err := sm.kvsm.store.KVGet([]byte("test:k3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", string(v))
+}
+
+func collectCDCEvents(t *testing.T, cl *cdcLog, start uint64, num int) ([]syncerpb.CDCEvent, error) {
+	var all []syncerpb.CDCEvent
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.subscribe(start, stop, func(events []syncerpb.CDCEvent) error {
+			for i, e := range events {
+				if i > 0 {
+					// the events of one raft log should not be split into different batches
+					assert.True(t, e.Index >= events[i-1].Index)
+				}
+			}
+			all = append(all, events...)
+			if len(all) >= num {
+				close(stop)
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		return all, err
+	case <-time.After(time.Second * 10):
+		close(stop)
+		<-done
+		t.Errorf("wait cdc events timeout")
+		return all, nil
+	}
+}
+
+func TestCDCLogSubscribeAndResume(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("cdc-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cl, err := newCDCLog(tmpDir, "test-0", 2)
+	assert.Nil(t, err)
+	for i := uint64(1); i <= 10; i++ {
+		var events []syncerpb.CDCEvent
+		if i%2 == 0 {
+			events = append(events, syncerpb.CDCEvent{Key: []byte("tb1:k"), Command: "set", Index: i},
+				syncerpb.CDCEvent{Key: []byte("tb1:k2"), Command: "set", Index: i})
+		}
+		err = cl.append(i, events)
+		assert.Nil(t, err)
+	}
+	// duplicate while replaying should be ignored
+	err = cl.append(4, []syncerpb.CDCEvent{{Index: 4}})
+	assert.Nil(t, err)
+
+	events, err := collectCDCEvents(t, cl, 1, 10)
+	assert.Equal(t, common.ErrStopped, err)
+	assert.Equal(t, 10, len(events))
+	assert.Equal(t, uint64(2), events[0].Index)
+	assert.Equal(t, uint64(10), events[9].Index)
+
+	// tail the new events written while subscribing
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		cl.append(11, []syncerpb.CDCEvent{{Key: []byte("tb1:k"), Command: "del", Index: 11}})
+	}()
+	events, err = collectCDCEvents(t, cl, 9, 3)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, uint64(11), events[2].Index)
+
+	pos, err := cl.getPosition("consumer1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), pos.Index)
+	err = cl.commitPosition(&syncerpb.CDCPosition{Consumer: "consumer1", RaftGroupName: "test-0", Term: 1, Index: 8})
+	assert.Nil(t, err)
+	_, err = cl.getPosition("../invalid")
+	assert.Equal(t, errCDCInvalidConsumer, err)
+
+	// reopen with the partial line and the events after the snapshot should be truncated
+	assert.Nil(t, cl.sync(8))
+	assert.Nil(t, cl.close())
+	segs, err := listCDCSegments(tmpDir)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(segs[len(segs)-1].fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	f.Write([]byte("{\"namespace\":"))
+	f.Close()
+	cl, err = newCDCLog(tmpDir, "test-0", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), cl.getLastIndex())
+	assert.Nil(t, cl.restore(8))
+	assert.Equal(t, uint64(8), cl.getLastIndex())
+	pos, err = cl.getPosition("consumer1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), pos.Index)
+	for i := uint64(9); i <= 12; i++ {
+		err = cl.append(i, []syncerpb.CDCEvent{{Key: []byte("tb1:k"), Command: "set", Index: i}})
+		assert.Nil(t, err)
+	}
+	events, err = collectCDCEvents(t, cl, pos.Index+1, 4)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, uint64(9), events[0].Index)
+	assert.Equal(t, uint64(12), events[3].Index)
+
+	// installing the newer snapshot will skip the events
+	assert.Nil(t, cl.restore(20))
+	assert.Equal(t, uint64(21), cl.getFirstIndex())
+	err = cl.subscribe(pos.Index+1, nil, func([]syncerpb.CDCEvent) error { return nil })
+	assert.Equal(t, errCDCPositionLost, err)
+	err = cl.append(21, []syncerpb.CDCEvent{{Key: []byte("tb1:k"), Command: "set", Index: 21}})
+	assert.Nil(t, err)
+	events, err = collectCDCEvents(t, cl, cl.getFirstIndex(), 1)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, uint64(21), events[0].Index)
+	assert.Nil(t, cl.close())
+	_, err = os.Stat(path.Join(tmpDir, cdcConsumerDirName, "consumer1.json"))
+	assert.Nil(t, err)
+}
+
+func TestCDCLogPurgeSegments(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("cdc-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cl, err := newCDCLog(tmpDir, "test-0", 2)
+	assert.Nil(t, err)
+	defer cl.close()
+	for i := uint64(1); i <= 4; i++ {
+		// force rotate for each log
+		cl.fileSize = cdcSegmentSize
+		err = cl.append(i, []syncerpb.CDCEvent{{Key: []byte("tb1:k"), Command: "set", Index: i}})
+		assert.Nil(t, err)
+	}
+	segs, err := listCDCSegments(tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(segs))
+	assert.Equal(t, uint64(3), cl.getFirstIndex())
+	err = cl.subscribe(1, nil, func([]syncerpb.CDCEvent) error { return nil })
+	assert.Equal(t, errCDCPositionLost, err)
+	events, err := collectCDCEvents(t, cl, cl.getFirstIndex(), 2)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, uint64(3), events[0].Index)
+}
@@ -19,6 +19,10 @@ type NamespaceConfig struct {
 	RaftGroupConf    RaftGroupConfig `json:"raft_group_conf"`
 	ExpirationPolicy string          `json:"expiration_policy"`
 	DataVersion      string          `json:"data_version"`
+	// the time range in seconds of each bucket under the periodical rotation policy
+	ExpirationRotationPeriod int64 `json:"expiration_rotation_period"`
+	// the namespace backup directory to seed the data for the new namespace
+	RestoreFrom string `json:"restore_from"`
 }
 
 func NewNSConfig() *NamespaceConfig {
@@ -30,7 +34,10 @@ func NewNSConfig() *NamespaceConfig {
 }
 
 type NamespaceDynamicConf struct {
-	Replicator int
+	Replicator   int
+	PartitionNum int
+	// the quota for the whole namespace, should be divided to each partition
+	Quota *common.NamespaceQuota
 }
 
 type RaftGroupConfig struct {
@@ -54,10 +61,19 @@ type MachineConfig struct {
 	LearnerRole            string             `json:"learner_role"`
 	RemoteSyncCluster      string             `json:"remote_sync_cluster"`
 	StateMachineType       string             `json:"state_machine_type"`
+	UseRsyncTransfer       bool               `json:"use_rsync_transfer"`
+	RaftLogArchive         bool               `json:"raft_log_archive"`
+	CDCKeepSegments        int                `json:"cdc_keep_segments"`
 	RocksDBOpts            engine.RockOptions `json:"rocksdb_opts"`
 	RocksDBSharedConfig    engine.SharedRockConfig
 	WALRocksDBOpts         engine.RockOptions `json:"wal_rocksdb_opts"`
 	WALRocksDBSharedConfig engine.SharedRockConfig
+	// the keys of this namespace are placed by the redis cluster slot
+	RedisClusterNamespace string `json:"redis_cluster_namespace"`
+	// the root dir of the archived raft logs, default is the raft_archive under the data root dir
+	RaftLogArchiveDir string `json:"raft_log_archive_dir"`
+	// the hours to keep the archived raft logs
+	RaftLogArchiveKeepHours int `json:"raft_log_archive_keep_hours"`
 }
 
 type ReplicaInfo struct {
@@ -1,11 +1,56 @@
 package node
 
 import (
+	"errors"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/absolute8511/redcon"
+	ps "github.com/prometheus/client_golang/prometheus"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/rockredis"
 )
 
+// ErrActiveActiveDeniedCmd is returned for the commands not allowed in the active-active mode
+var ErrActiveActiveDeniedCmd = errors.New("ERR the command is not allowed while the active-active sync is enabled")
+
+// the result of these commands depends on the current state such as the list position or the
+// current members, so they can not converge if applied in different order in the clusters.
+var activeActiveDeniedCmds = map[string]bool{
+	"append":           true,
+	"setrange":         true,
+	"lpush":            true,
+	"rpush":            true,
+	"lpop":             true,
+	"rpop":             true,
+	"lset":             true,
+	"ltrim":            true,
+	"lrem":             true,
+	"linsert":          true,
+	"rpoplpush":        true,
+	"lmove":            true,
+	"blpop":            true,
+	"brpop":            true,
+	"brpoplpush":       true,
+	"spop":             true,
+	"zpopmin":          true,
+	"zpopmax":          true,
+	"bzpopmin":         true,
+	"zremrangebyrank":  true,
+	"zremrangebyscore": true,
+	"zremrangebylex":   true,
+}
+
+// CheckActiveActiveCmd check whether the write command is allowed in the active-active mode
+func CheckActiveActiveCmd(cmdName string) error {
+	if IsActiveActiveSync() && activeActiveDeniedCmds[cmdName] {
+		return ErrActiveActiveDeniedCmd
+	}
+	return nil
+}
+
 type ConflictState int
 
 const (
@@ -16,13 +61,39 @@ const (
 
 type ConflictCheckFunc func(redcon.Command, int64) ConflictState
 
+type ConflictResolution int
+
+const (
+	// no concurrent write in local, the remote write is applied
+	ResolveApplied ConflictResolution = iota
+	// the remote write is merged with the newer local writes
+	ResolveMerged
+	// only the part of the remote write newer than local is applied
+	ResolvePartial
+	// the remote write is older than local and discarded
+	ResolveDiscarded
+)
+
+var conflictResolutionNames = []string{
+	"applied",
+	"merged",
+	"partial",
+	"discarded",
+}
+
+// ConflictResolveFunc resolve the write from the other cluster in the active-active mode,
+// the command may be rewritten to apply only the part newer than local.
+type ConflictResolveFunc func(redcon.Command, int64, string) (ConflictResolution, redcon.Command)
+
 type conflictRouter struct {
-	checkCmds map[string]ConflictCheckFunc
+	checkCmds   map[string]ConflictCheckFunc
+	resolveCmds map[string]ConflictResolveFunc
 }
 
 func NewConflictRouter() *conflictRouter {
 	return &conflictRouter{
-		checkCmds: make(map[string]ConflictCheckFunc),
+		checkCmds:   make(map[string]ConflictCheckFunc),
+		resolveCmds: make(map[string]ConflictResolveFunc),
 	}
 }
 
@@ -39,6 +110,19 @@ func (r *conflictRouter) GetHandler(name string) (ConflictCheckFunc, bool) {
 	return v, ok
 }
 
+func (r *conflictRouter) RegisterResolver(name string, f ConflictResolveFunc) bool {
+	if _, ok := r.resolveCmds[strings.ToLower(name)]; ok {
+		return false
+	}
+	r.resolveCmds[name] = f
+	return true
+}
+
+func (r *conflictRouter) GetResolver(name string) (ConflictResolveFunc, bool) {
+	v, ok := r.resolveCmds[strings.ToLower(name)]
+	return v, ok
+}
+
 func (kvsm *kvStoreSM) checkKVConflict(cmd redcon.Command, reqTs int64) ConflictState {
 	oldTs, err := kvsm.store.KVGetVer(cmd.Args[1])
 	if err != nil {
@@ -112,6 +196,15 @@ func (kvsm *kvStoreSM) checkListConflict(cmd redcon.Command, reqTs int64) Confli
 	return Conflict
 }
 
+// check both the source and destination list
+func (kvsm *kvStoreSM) checkListMoveConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	state := kvsm.checkListConflict(cmd, reqTs)
+	if state != NoConflict || len(cmd.Args) < 3 {
+		return state
+	}
+	return kvsm.checkListConflict(redcon.Command{Args: [][]byte{cmd.Args[0], cmd.Args[2]}}, reqTs)
+}
+
 func (kvsm *kvStoreSM) checkBitmapConflict(cmd redcon.Command, reqTs int64) ConflictState {
 	oldTs, err := kvsm.store.BitGetVer(cmd.Args[1])
 	if err != nil {
@@ -142,6 +235,26 @@ func (kvsm *kvStoreSM) checkSetConflict(cmd redcon.Command, reqTs int64) Conflic
 	return MaybeConflict
 }
 
+// check both the source and destination set
+func (kvsm *kvStoreSM) checkSetMoveConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	state := kvsm.checkSetConflict(cmd, reqTs)
+	if state != NoConflict || len(cmd.Args) < 3 {
+		return state
+	}
+	return kvsm.checkSetConflict(redcon.Command{Args: [][]byte{cmd.Args[0], cmd.Args[2]}}, reqTs)
+}
+
+func (kvsm *kvStoreSM) checkStreamConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	oldTs, err := kvsm.store.XGetVer(cmd.Args[1])
+	if err != nil {
+		kvsm.Infof("key %v failed to get modify version: %v", cmd.Args[1], err)
+	}
+	if oldTs < reqTs {
+		return NoConflict
+	}
+	return Conflict
+}
+
 func (kvsm *kvStoreSM) checkZSetConflict(cmd redcon.Command, reqTs int64) ConflictState {
 	oldTs, err := kvsm.store.ZGetVer(cmd.Args[1])
 	if err != nil {
@@ -164,3 +277,485 @@ func (kvsm *kvStoreSM) checkHLLConflict(cmd redcon.Command, reqTs int64) Conflic
 func (kvsm *kvStoreSM) checkJsonConflict(cmd redcon.Command, reqTs int64) ConflictState {
 	return Conflict
 }
+
+// the watched key may be any data type, so we check all the modify versions of the key.
+// It is conflicted if the key is changed after the watch timestamp.
+// the modify version of the key for each data type, the kv version is checked by the bitmap
+func keyVerFuncs(store *KVStore) []func([]byte) (int64, error) {
+	return []func([]byte) (int64, error){
+		store.BitGetVer,
+		store.HKeyVer,
+		store.LVer,
+		store.SGetVer,
+		store.ZGetVer,
+		store.XGetVer,
+		store.JGetVer,
+	}
+}
+
+// get the latest modify version of the key in all the data types, 0 if the key not exist
+func getKeyVer(store *KVStore, key []byte) (int64, error) {
+	var ver int64
+	for _, getVer := range keyVerFuncs(store) {
+		v, err := getVer(key)
+		if err != nil {
+			return 0, err
+		}
+		if v > ver {
+			ver = v
+		}
+	}
+	return ver, nil
+}
+
+func (kvsm *kvStoreSM) checkWatchConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	key := cmd.Args[1]
+	for _, getVer := range keyVerFuncs(kvsm.store) {
+		oldTs, err := getVer(key)
+		if err != nil {
+			kvsm.Infof("key %v failed to get modify version: %v", string(key), err)
+			return Conflict
+		}
+		if oldTs >= reqTs {
+			return Conflict
+		}
+	}
+	return NoConflict
+}
+
+func (kvsm *kvStoreSM) localClusterName() string {
+	if kvsm.clusterInfo == nil {
+		return ""
+	}
+	return kvsm.clusterInfo.GetClusterName()
+}
+
+// last writer wins, for the same timestamp the write from the cluster with the greater
+// name wins so both clusters will choose the same write.
+func (kvsm *kvStoreSM) isRemoteWriteNewer(oldTs int64, reqTs int64, origCluster string) bool {
+	if oldTs != reqTs {
+		return reqTs > oldTs
+	}
+	return origCluster > kvsm.localClusterName()
+}
+
+// resolve the write from the other cluster in the active-active mode, return false if the
+// write should be discarded. The commands without resolver are checked as the one way sync.
+func (kvsm *kvStoreSM) resolveRemoteWrite(cmd redcon.Command, reqTs int64, origCluster string) (redcon.Command, bool) {
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	var res ConflictResolution
+	h, ok := kvsm.cRouter.GetResolver(cmdName)
+	if ok {
+		res, cmd = h(cmd, reqTs, origCluster)
+	} else if kvsm.preCheckConflict(cmd, reqTs) == Conflict {
+		res = ResolveDiscarded
+	}
+	if res != ResolveApplied {
+		metric.ClusterSyncConflictCnt.With(ps.Labels{
+			"namespace":  kvsm.fullNS,
+			"cmd":        cmdName,
+			"resolution": conflictResolutionNames[res],
+		}).Inc()
+		if nodeLog.Level() >= common.LOG_DEBUG {
+			kvsm.Debugf("resolved write from cluster %v: %v, %v, %v", origCluster, conflictResolutionNames[res], string(cmd.Raw), reqTs)
+		}
+	}
+	return cmd, res != ResolveDiscarded
+}
+
+// the current modify version of the key or the hash field
+func (kvsm *kvStoreSM) getCurrentVer(dt byte, key []byte, field []byte) (int64, error) {
+	switch dt {
+	case rockredis.KVType:
+		return kvsm.store.KVGetVer(key)
+	case rockredis.HashType:
+		if field != nil {
+			return kvsm.store.HGetVer(key, field)
+		}
+		return kvsm.store.HKeyVer(key)
+	case rockredis.ListType:
+		return kvsm.store.LVer(key)
+	case rockredis.SetType, rockredis.ZSetType:
+		if field != nil {
+			// no version for the member, the conflict meta is always kept for the changed member
+			return 0, nil
+		}
+		if dt == rockredis.SetType {
+			return kvsm.store.SGetVer(key)
+		}
+		return kvsm.store.ZGetVer(key)
+	case rockredis.StreamType:
+		return kvsm.store.XGetVer(key)
+	case rockredis.BitmapType:
+		return kvsm.store.BitGetVer(key)
+	}
+	return 0, nil
+}
+
+// get the conflict meta of the key or the hash field, return false if no meta stored or the key has been
+// changed by the write not tracked after the meta, in which case the current version is used as the
+// last assignment.
+func (kvsm *kvStoreSM) getConflictMeta(dt byte, key []byte, field []byte) (*rockredis.ConflictMeta, bool) {
+	curVer, err := kvsm.getCurrentVer(dt, key, field)
+	if err != nil {
+		kvsm.Infof("key %v failed to get modify version: %v", string(key), err)
+	}
+	m, err := kvsm.store.GetConflictMeta(dt, key, field)
+	if err != nil {
+		kvsm.Infof("key %v failed to get conflict meta: %v", string(key), err)
+	}
+	if m == nil || curVer > m.LastTs() {
+		return &rockredis.ConflictMeta{AssignTs: curVer}, false
+	}
+	return m, true
+}
+
+// get the version to compare with the remote write, the deleted key or field use the deletion timestamp
+// and the fields (or members) in the cleared collection use the clear timestamp. If assignOnly, the increments
+// after the last assignment are not counted since they will be replayed after the newer assignment.
+func (kvsm *kvStoreSM) getConflictVer(dt byte, key []byte, field []byte, assignOnly bool) int64 {
+	m, _ := kvsm.getConflictMeta(dt, key, field)
+	ver := m.LastTs()
+	if assignOnly {
+		ver = m.AssignTs
+	}
+	if field != nil {
+		km, stored := kvsm.getConflictMeta(dt, key, nil)
+		if stored && km.Deleted && km.AssignTs > ver {
+			ver = km.AssignTs
+		}
+	}
+	return ver
+}
+
+// the whole key is replaced by the newer write
+func (kvsm *kvStoreSM) lwwResolver(dt byte, assignOnly bool) ConflictResolveFunc {
+	return func(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+		oldTs := kvsm.getConflictVer(dt, cmd.Args[1], nil, assignOnly)
+		if kvsm.isRemoteWriteNewer(oldTs, reqTs, origCluster) {
+			return ResolveApplied, cmd
+		}
+		return ResolveDiscarded, cmd
+	}
+}
+
+// the operations such as adding members are commutative, so the remote write is applied and
+// merged with the local writes unless the key is deleted after it.
+func (kvsm *kvStoreSM) mergeResolver(dt byte) ConflictResolveFunc {
+	return func(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+		m, stored := kvsm.getConflictMeta(dt, cmd.Args[1], nil)
+		if stored && m.Deleted && !kvsm.isRemoteWriteNewer(m.AssignTs, reqTs, origCluster) {
+			return ResolveDiscarded, cmd
+		}
+		if m.LastTs() >= reqTs {
+			return ResolveMerged, cmd
+		}
+		return ResolveApplied, cmd
+	}
+}
+
+// the increment is applied only if it is newer than the last assignment, and for the same timestamp
+// the assignment wins. The increments newer than the assignment will be replayed after the assignment
+// so both clusters have the same value.
+func (kvsm *kvStoreSM) counterResolver(dt byte, key []byte, field []byte, reqTs int64) ConflictResolution {
+	if reqTs <= kvsm.getConflictVer(dt, key, field, true) {
+		return ResolveDiscarded
+	}
+	curVer, _ := kvsm.getCurrentVer(dt, key, field)
+	if curVer >= reqTs {
+		return ResolveMerged
+	}
+	return ResolveApplied
+}
+
+// filter the args from the start position by the version of each item, step is the arg number of each item
+// and the version is got by the arg at the offset of the item.
+func (kvsm *kvStoreSM) filterNewerArgs(cmd redcon.Command, start int, step int, offset int, reqTs int64, origCluster string,
+	getVer func(item []byte) int64) (ConflictResolution, redcon.Command) {
+	args := make([][]byte, 0, len(cmd.Args))
+	args = append(args, cmd.Args[:start]...)
+	for i := start; i+step <= len(cmd.Args); i += step {
+		oldTs := getVer(cmd.Args[i+offset])
+		if kvsm.isRemoteWriteNewer(oldTs, reqTs, origCluster) {
+			args = append(args, cmd.Args[i:i+step]...)
+		}
+	}
+	if len(args) == start {
+		return ResolveDiscarded, cmd
+	}
+	if len(args) == len(cmd.Args) {
+		return ResolveApplied, cmd
+	}
+	return ResolvePartial, common.BuildCommand(args)
+}
+
+func (kvsm *kvStoreSM) resolveKVKeys(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	return kvsm.filterNewerArgs(cmd, 1, 1, 0, reqTs, origCluster, func(key []byte) int64 {
+		return kvsm.getConflictVer(rockredis.KVType, key, nil, true)
+	})
+}
+
+func (kvsm *kvStoreSM) resolveKVKV(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	return kvsm.filterNewerArgs(cmd, 1, 2, 0, reqTs, origCluster, func(key []byte) int64 {
+		return kvsm.getConflictVer(rockredis.KVType, key, nil, true)
+	})
+}
+
+func (kvsm *kvStoreSM) resolveKVCounter(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	return kvsm.counterResolver(rockredis.KVType, cmd.Args[1], nil, reqTs), cmd
+}
+
+func (kvsm *kvStoreSM) resolveHashKFV(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	return kvsm.filterNewerArgs(cmd, 2, 2, 0, reqTs, origCluster, func(field []byte) int64 {
+		return kvsm.getConflictVer(rockredis.HashType, cmd.Args[1], field, true)
+	})
+}
+
+func (kvsm *kvStoreSM) resolveHashKFF(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	return kvsm.filterNewerArgs(cmd, 2, 1, 0, reqTs, origCluster, func(field []byte) int64 {
+		return kvsm.getConflictVer(rockredis.HashType, cmd.Args[1], field, true)
+	})
+}
+
+func (kvsm *kvStoreSM) resolveHashCounter(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	if len(cmd.Args) < 3 {
+		return ResolveApplied, cmd
+	}
+	return kvsm.counterResolver(rockredis.HashType, cmd.Args[1], cmd.Args[2], reqTs), cmd
+}
+
+// the adding and removing of the set or zset members are resolved by the timestamps kept for each member,
+// so the member is added or removed by the last write in both clusters.
+func (kvsm *kvStoreSM) memberResolver(dt byte, step int, offset int) ConflictResolveFunc {
+	return func(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+		return kvsm.filterNewerArgs(cmd, 2, step, offset, reqTs, origCluster, func(member []byte) int64 {
+			return kvsm.getConflictVer(dt, cmd.Args[1], member, false)
+		})
+	}
+}
+
+// check the member in both the source and destination set
+func (kvsm *kvStoreSM) resolveSetMove(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	if len(cmd.Args) < 4 {
+		return ResolveApplied, cmd
+	}
+	for _, key := range cmd.Args[1:3] {
+		oldTs := kvsm.getConflictVer(rockredis.SetType, key, cmd.Args[3], false)
+		if !kvsm.isRemoteWriteNewer(oldTs, reqTs, origCluster) {
+			return ResolveDiscarded, cmd
+		}
+	}
+	return ResolveApplied, cmd
+}
+
+// check both the source and destination list
+func (kvsm *kvStoreSM) resolveListMove(cmd redcon.Command, reqTs int64, origCluster string) (ConflictResolution, redcon.Command) {
+	lww := kvsm.lwwResolver(rockredis.ListType, false)
+	res, _ := lww(cmd, reqTs, origCluster)
+	if res != ResolveApplied || len(cmd.Args) < 3 {
+		return res, cmd
+	}
+	res, _ = lww(redcon.Command{Args: [][]byte{cmd.Args[0], cmd.Args[2]}}, reqTs, origCluster)
+	return res, cmd
+}
+
+const (
+	conflictAssign = iota
+	conflictDelete
+	conflictIncr
+)
+
+// the key or the hash field changed by the write, the conflict meta is kept for it in the active-active mode
+type conflictTarget struct {
+	dt    byte
+	key   []byte
+	field []byte
+	op    int
+	delta []byte
+	// the conflict meta before the write
+	meta   *rockredis.ConflictMeta
+	stored bool
+}
+
+// the key level deletion for the collections, the tombstone is kept for the key
+var collClearCmds = map[string]byte{
+	"hclear":   rockredis.HashType,
+	"lclear":   rockredis.ListType,
+	"sclear":   rockredis.SetType,
+	"zclear":   rockredis.ZSetType,
+	"xclear":   rockredis.StreamType,
+	"bitclear": rockredis.BitmapType,
+}
+
+func getConflictTargets(cmdName string, args [][]byte) []conflictTarget {
+	var targets []conflictTarget
+	if len(args) < 2 {
+		return nil
+	}
+	switch cmdName {
+	case "set", "setex", "getset":
+		targets = append(targets, conflictTarget{dt: rockredis.KVType, key: args[1], op: conflictAssign})
+	case "mset", "plset":
+		for i := 1; i+1 < len(args); i += 2 {
+			targets = append(targets, conflictTarget{dt: rockredis.KVType, key: args[i], op: conflictAssign})
+		}
+	case "del":
+		for _, key := range args[1:] {
+			targets = append(targets, conflictTarget{dt: rockredis.KVType, key: key, op: conflictDelete})
+		}
+	case "incr", "decr":
+		delta := []byte("1")
+		if cmdName == "decr" {
+			delta = []byte("-1")
+		}
+		targets = append(targets, conflictTarget{dt: rockredis.KVType, key: args[1], op: conflictIncr, delta: delta})
+	case "incrby", "incrbyfloat", "decrby":
+		if len(args) < 3 {
+			return nil
+		}
+		delta := args[2]
+		if cmdName == "decrby" {
+			v, err := strconv.ParseInt(string(args[2]), 10, 64)
+			if err != nil || v == math.MinInt64 {
+				return nil
+			}
+			delta = []byte(strconv.FormatInt(-v, 10))
+		}
+		targets = append(targets, conflictTarget{dt: rockredis.KVType, key: args[1], op: conflictIncr, delta: delta})
+	case "hset", "hmset":
+		for i := 2; i+1 < len(args); i += 2 {
+			targets = append(targets, conflictTarget{dt: rockredis.HashType, key: args[1], field: args[i], op: conflictAssign})
+		}
+	case "hdel":
+		for _, field := range args[2:] {
+			targets = append(targets, conflictTarget{dt: rockredis.HashType, key: args[1], field: field, op: conflictDelete})
+		}
+	case "hincrby", "hincrbyfloat":
+		if len(args) < 4 {
+			return nil
+		}
+		targets = append(targets, conflictTarget{dt: rockredis.HashType, key: args[1], field: args[2], op: conflictIncr, delta: args[3]})
+	case "sadd", "srem":
+		op := conflictAssign
+		if cmdName == "srem" {
+			op = conflictDelete
+		}
+		for _, member := range args[2:] {
+			targets = append(targets, conflictTarget{dt: rockredis.SetType, key: args[1], field: member, op: op})
+		}
+	case "smove":
+		if len(args) < 4 {
+			return nil
+		}
+		targets = append(targets, conflictTarget{dt: rockredis.SetType, key: args[1], field: args[3], op: conflictDelete})
+		targets = append(targets, conflictTarget{dt: rockredis.SetType, key: args[2], field: args[3], op: conflictAssign})
+	case "zadd":
+		for i := 3; i < len(args); i += 2 {
+			targets = append(targets, conflictTarget{dt: rockredis.ZSetType, key: args[1], field: args[i], op: conflictAssign})
+		}
+	case "zrem":
+		for _, member := range args[2:] {
+			targets = append(targets, conflictTarget{dt: rockredis.ZSetType, key: args[1], field: member, op: conflictDelete})
+		}
+	default:
+		if dt, ok := collClearCmds[cmdName]; ok {
+			targets = append(targets, conflictTarget{dt: dt, key: args[1], op: conflictDelete})
+		}
+	}
+	return targets
+}
+
+// load the conflict meta before the write, return true if the increments need be replayed after the write,
+// in which case the write should not be batched since the replay need read the written value.
+func (kvsm *kvStoreSM) prepareConflictMeta(cmdName string, cmd redcon.Command, reqTs int64) ([]conflictTarget, bool) {
+	targets := getConflictTargets(cmdName, cmd.Args)
+	needReplay := false
+	for i := range targets {
+		t := &targets[i]
+		t.meta, t.stored = kvsm.getConflictMeta(t.dt, t.key, t.field)
+		if t.op == conflictIncr {
+			continue
+		}
+		for _, incr := range t.meta.Incrs {
+			if incr.Ts > reqTs {
+				needReplay = true
+			}
+		}
+	}
+	return targets, needReplay
+}
+
+// update the conflict meta after the write applied. For the assignment or deletion, the increments
+// newer than it are applied again so the value is the same as the other cluster which applied the
+// increments after the assignment.
+func (kvsm *kvStoreSM) updateConflictMeta(cmdName string, rsp interface{}, targets []conflictTarget, reqTs int64) {
+	if cmdName == "set" && rsp == int64(0) {
+		// not changed for nx or xx
+		return
+	}
+	for i := range targets {
+		t := &targets[i]
+		m := t.meta
+		if t.op == conflictIncr {
+			m.AddIncr(reqTs, t.delta)
+		} else {
+			if !t.stored && t.op == conflictAssign && !isMemberTarget(t) {
+				// the modify version is enough if no tracked writes
+				continue
+			}
+			var newer []rockredis.ConflictIncr
+			for _, incr := range m.Incrs {
+				if incr.Ts > reqTs {
+					newer = append(newer, incr)
+				}
+			}
+			m = &rockredis.ConflictMeta{AssignTs: reqTs, Deleted: t.op == conflictDelete, Incrs: newer}
+			if len(newer) > 0 {
+				if err := kvsm.replayConflictIncrs(t, newer); err != nil {
+					kvsm.Infof("key %v failed to replay the increments after %v: %v", string(t.key), reqTs, err)
+				}
+			}
+		}
+		if err := kvsm.store.SetConflictMeta(t.dt, t.key, t.field, m); err != nil {
+			kvsm.Infof("key %v failed to update conflict meta: %v", string(t.key), err)
+		}
+	}
+}
+
+// the set or zset member has no modify version, so the conflict meta is kept for each changed member
+func isMemberTarget(t *conflictTarget) bool {
+	return t.field != nil && (t.dt == rockredis.SetType || t.dt == rockredis.ZSetType)
+}
+
+func (kvsm *kvStoreSM) replayConflictIncrs(t *conflictTarget, incrs []rockredis.ConflictIncr) error {
+	isFloat := false
+	var sum int64
+	var fsum float64
+	for _, incr := range incrs {
+		v, err := strconv.ParseInt(string(incr.Delta), 10, 64)
+		if err != nil {
+			isFloat = true
+		}
+		sum += v
+		fv, err := strconv.ParseFloat(string(incr.Delta), 64)
+		if err != nil {
+			return err
+		}
+		fsum += fv
+	}
+	// use the timestamp of the last increment so the version is the same as the other cluster
+	ts := incrs[len(incrs)-1].Ts
+	var err error
+	if t.dt == rockredis.HashType {
+		if isFloat {
+			_, err = kvsm.store.HIncrByFloat(ts, t.key, t.field, fsum)
+		} else {
+			_, err = kvsm.store.HIncrBy(ts, t.key, t.field, sum)
+		}
+	} else if isFloat {
+		_, err = kvsm.store.IncrByFloat(ts, t.key, fsum)
+	} else {
+		_, err = kvsm.store.IncrBy(ts, t.key, sum)
+	}
+	return err
+}
@@ -0,0 +1,309 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+func TestConflictResolveRemoteWrite(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	kvsm := nd.sm.(*kvStoreSM)
+
+	testKey1 := []byte("test:conflict1")
+	testKey2 := []byte("test:conflict2")
+	err := kvsm.store.KVSet(100, testKey1, []byte("1"))
+	assert.Nil(t, err)
+	err = kvsm.store.KVSet(200, testKey2, []byte("2"))
+	assert.Nil(t, err)
+
+	// last writer wins
+	cmd := buildCommand([][]byte{[]byte("set"), testKey1, []byte("v")})
+	_, ok := kvsm.resolveRemoteWrite(cmd, 99, "remote")
+	assert.False(t, ok)
+	_, ok = kvsm.resolveRemoteWrite(cmd, 101, "remote")
+	assert.True(t, ok)
+	// the same timestamp should be resolved by the cluster name
+	assert.True(t, kvsm.isRemoteWriteNewer(100, 100, "remote"))
+	assert.False(t, kvsm.isRemoteWriteNewer(100, 100, ""))
+
+	// counter is merged only if newer than the last assignment
+	cmd = buildCommand([][]byte{[]byte("incr"), testKey2})
+	_, ok = kvsm.resolveRemoteWrite(cmd, 150, "remote")
+	assert.False(t, ok)
+	_, ok = kvsm.resolveRemoteWrite(cmd, 200, "remote")
+	assert.False(t, ok)
+	_, ok = kvsm.resolveRemoteWrite(cmd, 250, "remote")
+	assert.True(t, ok)
+
+	// only the older keys are written
+	cmd = buildCommand([][]byte{[]byte("mset"), testKey1, []byte("v1"), testKey2, []byte("v2")})
+	newCmd, ok := kvsm.resolveRemoteWrite(cmd, 150, "remote")
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(newCmd.Args))
+	assert.Equal(t, testKey1, newCmd.Args[1])
+	assert.Equal(t, []byte("v1"), newCmd.Args[2])
+
+	cmd = buildCommand([][]byte{[]byte("del"), testKey1, testKey2})
+	newCmd, ok = kvsm.resolveRemoteWrite(cmd, 300, "remote")
+	assert.True(t, ok)
+	assert.Equal(t, cmd.Args, newCmd.Args)
+	_, ok = kvsm.resolveRemoteWrite(cmd, 50, "remote")
+	assert.False(t, ok)
+}
+
+type testClusterInfo struct {
+	name string
+}
+
+func (ci *testClusterInfo) GetClusterName() string {
+	return ci.name
+}
+
+func (ci *testClusterInfo) GetSnapshotSyncInfo(fullNS string) ([]common.SnapshotSyncInfo, error) {
+	return nil, nil
+}
+
+func (ci *testClusterInfo) UpdateMeForNamespaceLeader(fullNS string) (bool, error) {
+	return false, nil
+}
+
+type testSyncCluster struct {
+	name  string
+	sm    *kvStoreSM
+	index uint64
+	// the local writes not synced to the other cluster yet
+	pending []testSyncWrite
+}
+
+type testSyncWrite struct {
+	ts   int64
+	args []string
+}
+
+func newTestSyncCluster(t *testing.T, dir string, name string) *testSyncCluster {
+	kvOpts := &KVOptions{
+		DataDir:          path.Join(dir, name),
+		EngType:          rockredis.EngType,
+		ExpirationPolicy: common.LocalDeletion,
+	}
+	engine.FillDefaultOptions(&kvOpts.RockOpts)
+	sm, err := NewKVStoreSM(kvOpts, MachineConfig{}, 1, "test-0", &testClusterInfo{name: name}, nil)
+	assert.Nil(t, err)
+	sm.w = wait.New()
+	return &testSyncCluster{name: name, sm: sm}
+}
+
+func buildTestSyncReq(ts int64, args []string) InternalRaftRequest {
+	cargs := make([][]byte, 0, len(args))
+	for _, a := range args {
+		cargs = append(cargs, []byte(a))
+	}
+	return InternalRaftRequest{
+		Header: RequestHeader{DataType: int32(RedisReq), Timestamp: ts},
+		Data:   buildCommand(cargs).Raw,
+	}
+}
+
+func (c *testSyncCluster) apply(t *testing.T, origCluster string, ts int64, args ...string) {
+	c.applyReqs(t, origCluster, ts, []InternalRaftRequest{buildTestSyncReq(ts, args)})
+}
+
+func (c *testSyncCluster) applyReqs(t *testing.T, origCluster string, ts int64, reqs []InternalRaftRequest) {
+	var reqList BatchInternalRaftRequest
+	reqList.Timestamp = ts
+	reqList.ReqNum = int32(len(reqs))
+	if origCluster != "" {
+		reqList.Type = FromClusterSyncer
+		reqList.OrigCluster = origCluster
+	}
+	reqList.Reqs = reqs
+	c.index++
+	batch := c.sm.GetBatchOperator()
+	_, err := c.sm.ApplyRaftRequest(false, batch, reqList, 1, c.index, nil)
+	batch.CommitBatch()
+	assert.Nil(t, err)
+}
+
+func (c *testSyncCluster) write(t *testing.T, ts int64, args ...string) {
+	c.apply(t, "", ts, args...)
+	c.pending = append(c.pending, testSyncWrite{ts: ts, args: args})
+}
+
+// sync the local writes to the other cluster in order
+func (c *testSyncCluster) syncTo(t *testing.T, other *testSyncCluster) {
+	for _, w := range c.pending {
+		other.apply(t, c.name, w.ts, w.args...)
+	}
+	c.pending = nil
+}
+
+func TestConflictActiveActiveConverge(t *testing.T) {
+	SetActiveActiveSync(true)
+	defer SetActiveActiveSync(false)
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("conflict-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	ca := newTestSyncCluster(t, tmpDir, "cluster-a")
+	defer ca.sm.Close()
+	cb := newTestSyncCluster(t, tmpDir, "cluster-b")
+	defer cb.sm.Close()
+
+	// the increment newer than the set is kept on both sides
+	ca.write(t, 10, "set", "test:k1", "1")
+	ca.syncTo(t, cb)
+	ca.write(t, 100, "set", "test:k1", "10")
+	cb.write(t, 150, "incr", "test:k1")
+	cb.write(t, 160, "incrby", "test:k1", "5")
+	// the increment older than the set is discarded on both sides
+	ca.write(t, 200, "set", "test:k2", "10")
+	cb.write(t, 150, "incr", "test:k2")
+	// the set wins for the same timestamp
+	ca.write(t, 300, "set", "test:k3", "10")
+	cb.write(t, 300, "incr", "test:k3")
+	// the deleted key keeps the tombstone
+	cb.write(t, 250, "set", "test:k4", "v")
+	ca.write(t, 300, "del", "test:k4")
+	// the increment after the deletion
+	ca.write(t, 300, "del", "test:k5")
+	cb.write(t, 350, "incr", "test:k5")
+	// the deleted hash field keeps the tombstone
+	cb.write(t, 250, "hset", "test:h1", "f1", "v1")
+	cb.write(t, 250, "hset", "test:h1", "f2", "v2")
+	ca.write(t, 300, "hdel", "test:h1", "f1")
+	// the cleared hash keeps the tombstone
+	cb.write(t, 250, "hset", "test:h2", "f1", "v1")
+	ca.write(t, 300, "hclear", "test:h2")
+	cb.write(t, 350, "hincrby", "test:h3", "f1", "2")
+	ca.write(t, 300, "hset", "test:h3", "f1", "10")
+	// the set and zset members are added or removed by the last write of each member
+	ca.write(t, 100, "sadd", "test:s1", "m1")
+	ca.write(t, 100, "zadd", "test:z1", "1", "m1")
+	ca.syncTo(t, cb)
+	ca.write(t, 200, "srem", "test:s1", "m1")
+	cb.write(t, 150, "sadd", "test:s1", "m1", "m2")
+	ca.write(t, 300, "sadd", "test:s2", "m1")
+	cb.write(t, 200, "srem", "test:s2", "m1")
+	ca.write(t, 300, "zadd", "test:z1", "5", "m1")
+	cb.write(t, 200, "zrem", "test:z1", "m1")
+	cb.write(t, 250, "zadd", "test:z1", "2", "m2")
+	ca.write(t, 260, "zrem", "test:z1", "m2")
+	// the member removed by the other cluster before the set cleared
+	cb.write(t, 300, "sadd", "test:s3", "m1")
+	ca.write(t, 350, "sclear", "test:s3")
+	// the set is synced after the increment in the other cluster
+	ca.syncTo(t, cb)
+	cb.syncTo(t, ca)
+
+	for _, c := range []*testSyncCluster{ca, cb} {
+		v, err := c.sm.store.KVGet([]byte("test:k1"))
+		assert.Nil(t, err)
+		assert.Equal(t, "16", string(v), c.name)
+		v, err = c.sm.store.KVGet([]byte("test:k2"))
+		assert.Nil(t, err)
+		assert.Equal(t, "10", string(v), c.name)
+		v, err = c.sm.store.KVGet([]byte("test:k3"))
+		assert.Nil(t, err)
+		assert.Equal(t, "10", string(v), c.name)
+		v, err = c.sm.store.KVGet([]byte("test:k4"))
+		assert.Nil(t, err)
+		assert.Nil(t, v, c.name)
+		v, err = c.sm.store.KVGet([]byte("test:k5"))
+		assert.Nil(t, err)
+		assert.Equal(t, "1", string(v), c.name)
+		v, err = c.sm.store.HGet([]byte("test:h1"), []byte("f1"))
+		assert.Nil(t, err)
+		assert.Nil(t, v, c.name)
+		v, err = c.sm.store.HGet([]byte("test:h1"), []byte("f2"))
+		assert.Nil(t, err)
+		assert.Equal(t, "v2", string(v), c.name)
+		v, err = c.sm.store.HGet([]byte("test:h2"), []byte("f1"))
+		assert.Nil(t, err)
+		assert.Nil(t, v, c.name)
+		v, err = c.sm.store.HGet([]byte("test:h3"), []byte("f1"))
+		assert.Nil(t, err)
+		assert.Equal(t, "12", string(v), c.name)
+		n, err := c.sm.store.SIsMember([]byte("test:s1"), []byte("m1"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), n, c.name)
+		n, err = c.sm.store.SIsMember([]byte("test:s1"), []byte("m2"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n, c.name)
+		n, err = c.sm.store.SIsMember([]byte("test:s2"), []byte("m1"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n, c.name)
+		n, err = c.sm.store.SIsMember([]byte("test:s3"), []byte("m1"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), n, c.name)
+		score, err := c.sm.store.ZScore([]byte("test:z1"), []byte("m1"))
+		assert.Nil(t, err)
+		assert.Equal(t, float64(5), score, c.name)
+		_, err = c.sm.store.ZScore([]byte("test:z1"), []byte("m2"))
+		assert.NotNil(t, err, c.name)
+	}
+}
+
+func TestConflictActiveActiveDeniedCmd(t *testing.T) {
+	assert.Nil(t, CheckActiveActiveCmd("lpush"))
+	SetActiveActiveSync(true)
+	defer SetActiveActiveSync(false)
+	for _, cmdName := range []string{"append", "lpush", "rpush", "lpop", "blpop", "spop", "zpopmin", "zremrangebyscore"} {
+		assert.Equal(t, ErrActiveActiveDeniedCmd, CheckActiveActiveCmd(cmdName), cmdName)
+	}
+	for _, cmdName := range []string{"set", "sadd", "srem", "zadd", "zrem", "hset", "lclear"} {
+		assert.Nil(t, CheckActiveActiveCmd(cmdName), cmdName)
+	}
+}
+
+func TestSyncMultiExecAbortedByWatch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("conflict-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	src := newTestSyncCluster(t, tmpDir, "cluster-a")
+	defer src.sm.Close()
+	dst := newTestSyncCluster(t, tmpDir, "cluster-b")
+	defer dst.sm.Close()
+
+	src.write(t, 100, "set", "test:watched", "1")
+	src.syncTo(t, dst)
+	buildMultiReqs := func(ts int64, watchVer int64, args ...string) []InternalRaftRequest {
+		d, err := json.Marshal(multiExecMeta{
+			WatchKeys: [][]byte{[]byte("test:watched")},
+			WatchVers: []int64{watchVer},
+		})
+		assert.Nil(t, err)
+		return []InternalRaftRequest{
+			{Header: RequestHeader{DataType: int32(MultiExecReq), Timestamp: ts}, Data: d},
+			buildTestSyncReq(ts, args),
+		}
+	}
+	// the watched key is changed after watched, so it is aborted in the source cluster
+	// and the same raft log synced should be aborted in the remote cluster.
+	aborted := buildMultiReqs(200, 50, "set", "test:multi1", "v1")
+	committed := buildMultiReqs(300, 100, "set", "test:multi2", "v2")
+	for _, reqs := range [][]InternalRaftRequest{aborted, committed} {
+		src.applyReqs(t, "", reqs[0].Header.Timestamp, reqs)
+		dst.applyReqs(t, src.name, reqs[0].Header.Timestamp, reqs)
+	}
+	for _, c := range []*testSyncCluster{src, dst} {
+		v, err := c.sm.store.KVGet([]byte("test:multi1"))
+		assert.Nil(t, err)
+		assert.Nil(t, v, c.name)
+		v, err = c.sm.store.KVGet([]byte("test:multi2"))
+		assert.Nil(t, err)
+		assert.Equal(t, "v2", string(v), c.name)
+	}
+}
@@ -160,6 +160,14 @@ func (kvsm *kvStoreSM) localHIncrbyCommand(cmd redcon.Command, ts int64) (interf
 	return ret, err
 }
 
+func (kvsm *kvStoreSM) localHIncrbyFloatCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	v, err := parseFloatIncrement(cmd.Args[3])
+	if err != nil {
+		return 0, err
+	}
+	return kvsm.store.HIncrByFloat(ts, cmd.Args[1], cmd.Args[2], v)
+}
+
 func (kvsm *kvStoreSM) localHDelCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	n, err := kvsm.store.HDel(ts, cmd.Args[1], cmd.Args[2:]...)
 	if err != nil {
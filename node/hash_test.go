@@ -30,6 +30,7 @@ func TestKVNode_hashCommand(t *testing.T) {
 		{"hmset", buildCommand([][]byte{[]byte("hmset"), testKey, testField, testKeyValue, testField2, testKey2Value})},
 		{"hdel", buildCommand([][]byte{[]byte("hdel"), testKey, testField})},
 		{"hincrby", buildCommand([][]byte{[]byte("hincrby"), testKey, testField2, []byte("1")})},
+		{"hincrbyfloat", buildCommand([][]byte{[]byte("hincrbyfloat"), testKey, testField, []byte("0.5")})},
 		{"hget", buildCommand([][]byte{[]byte("hget"), testKey, testField})},
 		{"hmget", buildCommand([][]byte{[]byte("hmget"), testKey, testField, testField2})},
 		{"hgetall", buildCommand([][]byte{[]byte("hgetall"), testKey})},
@@ -3,6 +3,7 @@ package node
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -219,11 +220,175 @@ func (nd *KVNode) bitcountCommand(conn redcon.Conn, cmd redcon.Command) {
 	conn.WriteInt64(val)
 }
 
+// bitpos key bit [start [end]]
+func (nd *KVNode) bitposCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) > 5 {
+		conn.WriteError(errWrongNumberArgs.Error())
+		return
+	}
+	on, err := strconv.Atoi(string(cmd.Args[2]))
+	if err != nil || (on & ^1) != 0 {
+		conn.WriteError(errBitValue.Error())
+		return
+	}
+	start, end := int64(0), int64(-1)
+	if len(cmd.Args) >= 4 {
+		start, err = strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	if len(cmd.Args) == 5 {
+		end, err = strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	val, err := nd.store.BitPos(cmd.Args[1], on, start, end, len(cmd.Args) == 5)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteInt64(val)
+}
+
+func parseBitFieldType(t []byte, op *rockredis.BitFieldOp) error {
+	if len(t) < 2 {
+		return errBitFieldType
+	}
+	switch t[0] {
+	case 'i', 'I':
+		op.Signed = true
+	case 'u', 'U':
+	default:
+		return errBitFieldType
+	}
+	n, err := strconv.Atoi(string(t[1:]))
+	if err != nil || n < 1 || n > 64 || (!op.Signed && n > 63) {
+		return errBitFieldType
+	}
+	op.Bits = uint(n)
+	return nil
+}
+
+// the offset prefixed with # is multiplied by the type width
+func parseBitFieldOffset(o []byte, op *rockredis.BitFieldOp) error {
+	mul := int64(1)
+	if len(o) > 0 && o[0] == '#' {
+		mul = int64(op.Bits)
+		o = o[1:]
+	}
+	offset, err := strconv.ParseInt(string(o), 10, 64)
+	if err != nil || offset < 0 || offset > rockredis.MaxBitOffsetV2/mul {
+		return errBitOffset
+	}
+	op.Offset = offset * mul
+	if op.Offset+int64(op.Bits)-1 > rockredis.MaxBitOffsetV2 {
+		return errBitOffset
+	}
+	return nil
+}
+
+// parse the subcommands of bitfield:
+// [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+// and return whether all the subcommands are get.
+func parseBitFieldArgs(args [][]byte) ([]rockredis.BitFieldOp, bool, error) {
+	ops := make([]rockredis.BitFieldOp, 0, len(args)/3)
+	readOnly := true
+	overflow := rockredis.BitFieldOverflowWrap
+	for i := 0; i < len(args); {
+		sub := strings.ToLower(string(args[i]))
+		if sub == "overflow" {
+			if i+1 >= len(args) {
+				return nil, false, errSyntaxError
+			}
+			switch strings.ToLower(string(args[i+1])) {
+			case "wrap":
+				overflow = rockredis.BitFieldOverflowWrap
+			case "sat":
+				overflow = rockredis.BitFieldOverflowSat
+			case "fail":
+				overflow = rockredis.BitFieldOverflowFail
+			default:
+				return nil, false, errBitFieldOverflow
+			}
+			i += 2
+			continue
+		}
+		var op rockredis.BitFieldOp
+		argNum := 4
+		switch sub {
+		case "get":
+			op.Op = rockredis.BitFieldGet
+			argNum = 3
+		case "set":
+			op.Op = rockredis.BitFieldSet
+		case "incrby":
+			op.Op = rockredis.BitFieldIncrBy
+		default:
+			return nil, false, errSyntaxError
+		}
+		if i+argNum > len(args) {
+			return nil, false, errSyntaxError
+		}
+		if err := parseBitFieldType(args[i+1], &op); err != nil {
+			return nil, false, err
+		}
+		if err := parseBitFieldOffset(args[i+2], &op); err != nil {
+			return nil, false, err
+		}
+		if op.Op != rockredis.BitFieldGet {
+			v, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, false, err
+			}
+			op.Value = v
+			op.Overflow = overflow
+			readOnly = false
+		}
+		ops = append(ops, op)
+		i += argNum
+	}
+	return ops, readOnly, nil
+}
+
+func writeBitFieldRsp(conn redcon.Conn, rets []interface{}) {
+	conn.WriteArray(len(rets))
+	for _, v := range rets {
+		if n, ok := v.(int64); ok {
+			conn.WriteInt64(n)
+		} else {
+			conn.WriteNull()
+		}
+	}
+}
+
+func (nd *KVNode) bitfieldROCommand(conn redcon.Conn, cmd redcon.Command) {
+	ops, readOnly, err := parseBitFieldArgs(cmd.Args[2:])
+	if err == nil && !readOnly {
+		err = errBitFieldRO
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	rets, err := nd.store.BitFieldRO(cmd.Args[1], ops)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	writeBitFieldRsp(conn, rets)
+}
+
 func (nd *KVNode) mgetCommand(conn redcon.Conn, cmd redcon.Command) {
-	vals, _ := nd.store.MGet(cmd.Args[1:]...)
+	vals, errs := nd.store.MGet(cmd.Args[1:]...)
 	conn.WriteArray(len(vals))
-	for _, v := range vals {
-		if v == nil {
+	for i, v := range vals {
+		if errs[i] != nil {
+			conn.WriteError("ERR :" + errs[i].Error())
+		} else if v == nil {
 			conn.WriteNull()
 		} else {
 			conn.WriteBulk(v)
@@ -231,6 +396,21 @@ func (nd *KVNode) mgetCommand(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+// mget for the keys in the same partition while merging the keys across partitions,
+// the response for each key is the value or the error for the key.
+func (nd *KVNode) mgetMergeCommand(cmd redcon.Command) (interface{}, error) {
+	vals, errs := nd.store.MGet(cmd.Args[1:]...)
+	rets := make([]interface{}, len(vals))
+	for i, v := range vals {
+		if errs[i] != nil {
+			rets[i] = errs[i]
+		} else {
+			rets[i] = v
+		}
+	}
+	return rets, nil
+}
+
 // current we restrict the pfcount to single key to avoid merge,
 // since merge keys may across multi partitions on different nodes
 func (nd *KVNode) pfcountCommand(conn redcon.Conn, cmd redcon.Command) {
@@ -375,6 +555,58 @@ func (nd *KVNode) setbitCommand(cmd redcon.Command) (interface{}, error) {
 	return v, nil
 }
 
+func (nd *KVNode) bitfieldCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 2 {
+		return nil, errWrongNumberArgs
+	}
+	ops, readOnly, err := parseBitFieldArgs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		// no need propose if only get the bitfield
+		key, err := common.CutNamesapce(cmd.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return nd.store.BitFieldRO(key, ops)
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, nil)
+}
+
+func parseBitOpName(name []byte) (byte, error) {
+	switch strings.ToLower(string(name)) {
+	case "bitopand":
+		return rockredis.BitOpAnd, nil
+	case "bitopor":
+		return rockredis.BitOpOr, nil
+	case "bitopxor":
+		return rockredis.BitOpXor, nil
+	case "bitopnot":
+		return rockredis.BitOpNot, nil
+	}
+	return 0, errSyntaxError
+}
+
+// bitopand|bitopor|bitopxor|bitopnot destkey key [key ...]
+// the redis bitop command is rewritten as above so the destination is the first key.
+func (nd *KVNode) bitopCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 3 {
+		return nil, errWrongNumberArgs
+	}
+	op, err := parseBitOpName(cmd.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if op == rockredis.BitOpNot && len(cmd.Args) != 3 {
+		return nil, errBitOpNot
+	}
+	if len(cmd.Args[2:]) > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	return rebuildKeysAndPropose(nd, cmd, len(cmd.Args)-1, checkAndRewriteIntRsp)
+}
+
 func (nd *KVNode) delCommand(cmd redcon.Command, v interface{}) (interface{}, error) {
 	if rsp, ok := v.(int64); ok {
 		return rsp, nil
@@ -458,6 +690,29 @@ func (kvsm *kvStoreSM) localIncrByCommand(cmd redcon.Command, ts int64) (interfa
 	return ret, err
 }
 
+func (kvsm *kvStoreSM) localIncrByFloatCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	v, err := parseFloatIncrement(cmd.Args[2])
+	if err != nil {
+		return 0, err
+	}
+	return kvsm.store.IncrByFloat(ts, cmd.Args[1], v)
+}
+
+func (kvsm *kvStoreSM) localDecrCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.IncrBy(ts, cmd.Args[1], -1)
+}
+
+func (kvsm *kvStoreSM) localDecrByCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	v, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v == math.MinInt64 {
+		return 0, errDecrOverflow
+	}
+	return kvsm.store.IncrBy(ts, cmd.Args[1], -v)
+}
+
 func (kvsm *kvStoreSM) localDelCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	cnt, err := kvsm.store.DelKeys(cmd.Args[1:]...)
 	if err != nil {
@@ -497,6 +752,22 @@ func (kvsm *kvStoreSM) localBitClearCommand(cmd redcon.Command, ts int64) (inter
 	return kvsm.store.BitClear(ts, cmd.Args[1])
 }
 
+func (kvsm *kvStoreSM) localBitFieldCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	ops, _, err := parseBitFieldArgs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.BitField(ts, cmd.Args[1], ops)
+}
+
+func (kvsm *kvStoreSM) localBitOpCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	op, err := parseBitOpName(cmd.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.BitOp(ts, op, cmd.Args[1], cmd.Args[2:]...)
+}
+
 func (kvsm *kvStoreSM) localAppendCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	ret, err := kvsm.store.Append(ts, cmd.Args[1], cmd.Args[2])
 	return ret, err
@@ -197,11 +197,14 @@ func TestKVNode_kvCommand(t *testing.T) {
 		{"getset", buildCommand([][]byte{[]byte("getset"), testKey, testKeyValue})},
 		{"setnx", buildCommand([][]byte{[]byte("setnx"), testKey, testKeyValue})},
 		{"setnx", buildCommand([][]byte{[]byte("setnx"), testKey2, testKey2Value})},
-		//{"mset", buildCommand([][]byte{[]byte("mset"), testKey, testKeyValue, testKey2, testKey2Value})},
+		{"mset", buildCommand([][]byte{[]byte("mset"), testKey, testKeyValue, testKey2, testKey2Value})},
 		{"plset", buildCommand([][]byte{[]byte("mset"), testKey, testKeyValue, testKey2, testKey2Value})},
 		{"del", buildCommand([][]byte{[]byte("del"), testKey, testKey2})},
 		{"incr", buildCommand([][]byte{[]byte("incr"), testKey})},
 		{"incrby", buildCommand([][]byte{[]byte("incrby"), testKey, testKey2Value})},
+		{"decr", buildCommand([][]byte{[]byte("decr"), testKey})},
+		{"decrby", buildCommand([][]byte{[]byte("decrby"), testKey, testKey2Value})},
+		{"incrbyfloat", buildCommand([][]byte{[]byte("incrbyfloat"), testKey, []byte("1.5")})},
 		{"get", buildCommand([][]byte{[]byte("get"), testKey})},
 		{"mget", buildCommand([][]byte{[]byte("mget"), testKey, testKey2})},
 		{"exists", buildCommand([][]byte{[]byte("exists"), testKey})},
@@ -245,6 +248,28 @@ func TestKVNode_kvCommand(t *testing.T) {
 	}
 }
 
+func TestKVNode_mgetMergeKeyErrors(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+
+	testKey := []byte("default:test:mget1")
+	whandler, _ := nd.router.GetWCmdHandler("set")
+	_, err := whandler(buildCommand([][]byte{[]byte("set"), testKey, []byte("1")}))
+	assert.Nil(t, err)
+	handler, _, _ := nd.router.GetMergeCmdHandler("mget")
+	// the key without table is invalid
+	rsp, err := handler(buildCommand([][]byte{[]byte("mget"), testKey, []byte("default:notable"), []byte("default:test:mget2")}))
+	assert.Nil(t, err)
+	rets := rsp.([]interface{})
+	assert.Equal(t, 3, len(rets))
+	assert.Equal(t, []byte("1"), rets[0])
+	_, isErr := rets[1].(error)
+	assert.True(t, isErr)
+	assert.Nil(t, rets[2])
+}
+
 func TestKVNode_kvCommandWhileNoLeader(t *testing.T) {
 	nd, dataDir, stopC := getTestKVNodeWith(t, true)
 	testKey := []byte("default:test:noleader1")
@@ -267,6 +292,9 @@ func TestKVNode_kvCommandWhileNoLeader(t *testing.T) {
 		{"del", buildCommand([][]byte{[]byte("del"), testKey, testKey2})},
 		{"incr", buildCommand([][]byte{[]byte("incr"), testKey})},
 		{"incrby", buildCommand([][]byte{[]byte("incrby"), testKey, testKey2Value})},
+		{"decr", buildCommand([][]byte{[]byte("decr"), testKey})},
+		{"decrby", buildCommand([][]byte{[]byte("decrby"), testKey, testKey2Value})},
+		{"incrbyfloat", buildCommand([][]byte{[]byte("incrbyfloat"), testKey, []byte("1.5")})},
 		{"get", buildCommand([][]byte{[]byte("get"), testKey})},
 		{"mget", buildCommand([][]byte{[]byte("mget"), testKey, testKey2})},
 		{"exists", buildCommand([][]byte{[]byte("exists"), testKey})},
@@ -421,6 +449,7 @@ func TestKVNode_batchWithNonBatchCommand(t *testing.T) {
 func TestKVNode_bitV2Command(t *testing.T) {
 	nd, dataDir, stopC := getTestKVNode(t)
 	testBitKey := []byte("default:test:bitv2_1")
+	testBitKey2 := []byte("default:test:bitv2_2")
 	tests := []struct {
 		name string
 		args redcon.Command
@@ -432,6 +461,13 @@ func TestKVNode_bitV2Command(t *testing.T) {
 		{"bkeyexist", buildCommand([][]byte{[]byte("bkeyexist"), testBitKey})},
 		{"bexpire", buildCommand([][]byte{[]byte("bexpire"), testBitKey, []byte("10")})},
 		{"bpersist", buildCommand([][]byte{[]byte("bpersist"), testBitKey})},
+		{"bitpos", buildCommand([][]byte{[]byte("bitpos"), testBitKey, []byte("1"), []byte("0"), []byte("-1")})},
+		{"bitfield", buildCommand([][]byte{[]byte("bitfield"), testBitKey, []byte("overflow"), []byte("sat"),
+			[]byte("incrby"), []byte("u8"), []byte("#1"), []byte("1"), []byte("get"), []byte("i4"), []byte("0")})},
+		{"bitfield", buildCommand([][]byte{[]byte("bitfield"), testBitKey, []byte("get"), []byte("u8"), []byte("8")})},
+		{"bitfield_ro", buildCommand([][]byte{[]byte("bitfield_ro"), testBitKey, []byte("get"), []byte("u8"), []byte("8")})},
+		{"bitopor", buildCommand([][]byte{[]byte("bitopor"), testBitKey2, testBitKey})},
+		{"bitopnot", buildCommand([][]byte{[]byte("bitopnot"), testBitKey2, testBitKey})},
 		{"bitclear", buildCommand([][]byte{[]byte("bitclear"), testBitKey})},
 	}
 	defer os.RemoveAll(dataDir)
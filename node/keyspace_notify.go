@@ -0,0 +1,121 @@
+package node
+
+import (
+	"sync/atomic"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const keyEventExpired = "expired"
+
+// KeyspaceNotifier will be called on the leader after the key is changed. The ns is the namespace
+// without partition and the key is in the format of table:key. It should not block since it is
+// called while applying the raft logs.
+type KeyspaceNotifier func(ns string, event string, key []byte)
+
+var keyspaceNotifier atomic.Value
+
+// SetKeyspaceNotifier set the notifier for the key changes, nil to disable the notification
+func SetKeyspaceNotifier(fn KeyspaceNotifier) {
+	keyspaceNotifier.Store(fn)
+}
+
+func getKeyspaceNotifier() KeyspaceNotifier {
+	v := keyspaceNotifier.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(KeyspaceNotifier)
+}
+
+// call fn for each key written by the command until fn return false
+func forEachWriteKey(cmdName string, cmd redcon.Command, fn func(key []byte) bool) {
+	forEachWriteKeyIndex(cmdName, cmd.Args, func(i int) bool {
+		return fn(cmd.Args[i])
+	})
+}
+
+// same as forEachWriteKey but the index of the key in args is passed to fn
+func forEachWriteKeyIndex(cmdName string, args [][]byte, fn func(i int) bool) {
+	switch cmdName {
+	case "del":
+		for i := 1; i < len(args); i++ {
+			if !fn(i) {
+				return
+			}
+		}
+	case "rpoplpush", "lmove", "smove":
+		for i := 1; i < len(args) && i <= 2; i++ {
+			if !fn(i) {
+				return
+			}
+		}
+	case "plset", "mset":
+		for i := 1; i < len(args); i += 2 {
+			if !fn(i) {
+				return
+			}
+		}
+	default:
+		if len(args) > 1 {
+			fn(1)
+		}
+	}
+}
+
+// same as forEachWriteKeyIndex but the source keys only read by the store commands are included
+func forEachKeyIndex(cmdName string, args [][]byte, fn func(i int) bool) {
+	switch cmdName {
+	case "sinterstore", "sunionstore", "sdiffstore", "bitopand", "bitopor", "bitopxor", "bitopnot":
+		for i := 1; i < len(args); i++ {
+			if !fn(i) {
+				return
+			}
+		}
+	case "zunionstore", "zinterstore":
+		if len(args) < 2 || !fn(1) {
+			return
+		}
+		for i := range ZStoreSrcKeys(args) {
+			if !fn(3 + i) {
+				return
+			}
+		}
+	default:
+		forEachWriteKeyIndex(cmdName, args, fn)
+	}
+}
+
+func (kvsm *kvStoreSM) isLeaderNode() bool {
+	checker, ok := kvsm.leaderChecker.Load().(func() bool)
+	return ok && checker()
+}
+
+func (kvsm *kvStoreSM) notifyKeyspace(cmdName string, cmd redcon.Command) {
+	fn := getKeyspaceNotifier()
+	if fn == nil || !kvsm.isLeaderNode() {
+		return
+	}
+	event := cmdName
+	if cmdName == "plset" || cmdName == "mset" {
+		event = "set"
+	}
+	ns, _ := common.GetNamespaceAndPartition(kvsm.fullNS)
+	forEachWriteKey(cmdName, cmd, func(k []byte) bool {
+		fn(ns, event, k)
+		return true
+	})
+}
+
+// notify the keys deleted by the local expiration checker
+func (kvsm *kvStoreSM) notifyExpired(keys [][]byte) {
+	fn := getKeyspaceNotifier()
+	if fn == nil || !kvsm.isLeaderNode() {
+		return
+	}
+	ns, _ := common.GetNamespaceAndPartition(kvsm.fullNS)
+	for _, k := range keys {
+		fn(ns, keyEventExpired, k)
+	}
+}
@@ -23,6 +23,11 @@ type KVOptions struct {
 	DataVersion      common.DataVersionT
 	RockOpts         engine.RockOptions
 	SharedConfig     engine.SharedRockConfig
+	ExpiredNotifier  func(keys [][]byte)
+	// the partition of the primary key, nil for the default hash placement
+	KeyPartition func(pk []byte, pnum int) int
+	// the time range in seconds of each rotation bucket, 0 for the default
+	ExpirationRotationPeriod int64
 }
 
 func NewKVStore(kvopts *KVOptions) (*KVStore, error) {
@@ -44,9 +49,11 @@ func (s *KVStore) openDB() error {
 		cfg.DataDir = s.opts.DataDir
 		cfg.RockOptions = s.opts.RockOpts
 		cfg.ExpirationPolicy = s.opts.ExpirationPolicy
+		cfg.ExpirationRotationPeriod = s.opts.ExpirationRotationPeriod
 		cfg.DataVersion = s.opts.DataVersion
 		cfg.SharedConfig = s.opts.SharedConfig
 		cfg.KeepBackup = s.opts.KeepBackup
+		cfg.ExpiredNotifier = s.opts.ExpiredNotifier
 		s.RockDB, err = rockredis.OpenRockDB(cfg)
 		if err != nil {
 			nodeLog.Warningf("failed to open rocksdb: %v, %v", err, cfg.DataDir)
@@ -62,6 +69,14 @@ func (s *KVStore) CleanData() error {
 		nodeLog.Warningf("the db is not opened while clean data")
 		return nil
 	}
+	if seeded, err := s.handleSplitSeed(); seeded {
+		nodeLog.Infof("the store %v is seeded by split, keep the data: %v", s.opts.DataDir, err)
+		return err
+	}
+	if s.isRestoreSeeding() {
+		nodeLog.Infof("the store %v is seeded by point-in-time restore, keep the data", s.opts.DataDir)
+		return nil
+	}
 	nodeLog.Infof("the store %v is cleaning data", s.opts.DataDir)
 	dataPath := s.GetDataDir()
 	s.Close()
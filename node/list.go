@@ -1,13 +1,18 @@
 package node
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/absolute8511/redcon"
 	"github.com/youzan/ZanRedisDB/common"
 )
 
+var errLPosRank = errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+
 func (nd *KVNode) lindexCommand(conn redcon.Conn, cmd redcon.Command) {
 	index, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
@@ -119,6 +124,177 @@ func (nd *KVNode) ltrimCommand(cmd redcon.Command) (interface{}, error) {
 	return rsp, nil
 }
 
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (nd *KVNode) lposCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args)%2 != 1 {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	rank := int64(1)
+	count := int64(-1)
+	maxLen := int64(0)
+	for i := 3; i < len(cmd.Args); i += 2 {
+		v, err := strconv.ParseInt(string(cmd.Args[i+1]), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		switch strings.ToLower(string(cmd.Args[i])) {
+		case "rank":
+			if v == 0 || v == math.MinInt64 {
+				conn.WriteError(errLPosRank.Error())
+				return
+			}
+			rank = v
+		case "count":
+			if v < 0 {
+				conn.WriteError("ERR COUNT can't be negative")
+				return
+			}
+			count = v
+		case "maxlen":
+			if v < 0 {
+				conn.WriteError("ERR MAXLEN can't be negative")
+				return
+			}
+			maxLen = v
+		default:
+			conn.WriteError(errSyntaxError.Error())
+			return
+		}
+	}
+	matchNum := count
+	if count < 0 {
+		matchNum = 1
+	}
+	pos, err := nd.store.LPos(cmd.Args[1], cmd.Args[2], rank, matchNum, maxLen)
+	if err != nil {
+		conn.WriteError("Err: " + err.Error())
+		return
+	}
+	// return the single index if no count
+	if count < 0 {
+		if len(pos) == 0 {
+			conn.WriteNull()
+		} else {
+			conn.WriteInt64(pos[0])
+		}
+		return
+	}
+	conn.WriteArray(len(pos))
+	for _, p := range pos {
+		conn.WriteInt64(p)
+	}
+}
+
+// return true for left and false for right
+func parseListDirection(where []byte) (bool, error) {
+	switch strings.ToLower(string(where)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, errSyntaxError
+}
+
+// return true for before and false for after
+func parseListInsertWhere(where []byte) (bool, error) {
+	switch strings.ToLower(string(where)) {
+	case "before":
+		return true, nil
+	case "after":
+		return false, nil
+	}
+	return false, errSyntaxError
+}
+
+// lrem key count element
+func (nd *KVNode) lremCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 4 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	_, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	key, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	needContinue, _, err := nd.preCheckListLength(key)
+	if err != nil {
+		return nil, err
+	}
+	if !needContinue {
+		return int64(0), nil
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, checkAndRewriteIntRsp)
+}
+
+// linsert key BEFORE|AFTER pivot element
+func (nd *KVNode) linsertCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 5 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if _, err := parseListInsertWhere(cmd.Args[2]); err != nil {
+		return nil, err
+	}
+	key, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	needContinue, _, err := nd.preCheckListLength(key)
+	if err != nil {
+		return nil, err
+	}
+	if !needContinue {
+		return int64(0), nil
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, checkAndRewriteIntRsp)
+}
+
+// rpoplpush source destination
+func (nd *KVNode) rpoplpushCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 3 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	return nd.listMoveCommand(cmd)
+}
+
+// lmove source destination LEFT|RIGHT LEFT|RIGHT
+func (nd *KVNode) lmoveCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 5 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	for _, where := range cmd.Args[3:] {
+		if _, err := parseListDirection(where); err != nil {
+			return nil, err
+		}
+	}
+	return nd.listMoveCommand(cmd)
+}
+
+func (nd *KVNode) listMoveCommand(cmd redcon.Command) (interface{}, error) {
+	src, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	// no need propose if the source list is empty
+	needContinue, _, err := nd.preCheckListLength(src)
+	if err != nil {
+		return nil, err
+	}
+	if !needContinue {
+		return nil, nil
+	}
+	return rebuildKeysAndPropose(nd, cmd, 2, checkAndRewriteBulkRsp)
+}
+
 // local write command execute only on follower or on the local commit of leader
 // the return value of follower is ignored, return value of local leader will be
 // return to the future response.
@@ -161,6 +337,38 @@ func (kvsm *kvStoreSM) localRpopCommand(cmd redcon.Command, ts int64) (interface
 	return kvsm.store.RPop(ts, cmd.Args[1])
 }
 
+func (kvsm *kvStoreSM) localRpoplpushCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.RPopLPush(ts, cmd.Args[1], cmd.Args[2])
+}
+
+func (kvsm *kvStoreSM) localLmoveCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	srcLeft, err := parseListDirection(cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	dstLeft, err := parseListDirection(cmd.Args[4])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.LMove(ts, cmd.Args[1], cmd.Args[2], srcLeft, dstLeft)
+}
+
+func (kvsm *kvStoreSM) localLremCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	count, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.LRem(ts, cmd.Args[1], count, cmd.Args[3])
+}
+
+func (kvsm *kvStoreSM) localLinsertCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	before, err := parseListInsertWhere(cmd.Args[2])
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.LInsert(ts, cmd.Args[1], before, cmd.Args[3], cmd.Args[4])
+}
+
 func (kvsm *kvStoreSM) localRpushCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	return kvsm.store.RPush(ts, cmd.Args[1], cmd.Args[2:]...)
 }
@@ -33,6 +33,11 @@ func TestKVNode_listCommand(t *testing.T) {
 		{"lfixkey", buildCommand([][]byte{[]byte("lfixkey"), testKey})},
 		{"rpop", buildCommand([][]byte{[]byte("rpop"), testKey})},
 		{"rpush", buildCommand([][]byte{[]byte("rpush"), testKey, testKeyValue})},
+		{"lpos", buildCommand([][]byte{[]byte("lpos"), testKey, testKeyValue, []byte("rank"), []byte("-1")})},
+		{"linsert", buildCommand([][]byte{[]byte("linsert"), testKey, []byte("before"), testKeyValue, testKeyValue})},
+		{"lrem", buildCommand([][]byte{[]byte("lrem"), testKey, []byte("1"), testKeyValue})},
+		{"rpoplpush", buildCommand([][]byte{[]byte("rpoplpush"), testKey, testKey})},
+		{"lmove", buildCommand([][]byte{[]byte("lmove"), testKey, testKey, []byte("left"), []byte("right")})},
 		{"lttl", buildCommand([][]byte{[]byte("lttl"), testKey})},
 		{"lkeyexist", buildCommand([][]byte{[]byte("lkeyexist"), testKey})},
 		{"lexpire", buildCommand([][]byte{[]byte("lexpire"), testKey, []byte("10")})},
@@ -13,6 +13,7 @@ import (
 	"github.com/youzan/ZanRedisDB/syncerpb"
 	"github.com/youzan/go-zanredisdb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -100,7 +101,11 @@ func (s *RemoteLogSender) getClientFromAddr(addr string) syncerpb.CrossClusterAP
 	if c, ok := s.connPool[addr]; ok {
 		return c.client
 	}
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	dialOpt := grpc.WithInsecure()
+	if tlsConf := common.GetClientTLS(); tlsConf != nil {
+		dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConf))
+	}
+	conn, err := grpc.Dial(addr, dialOpt)
 	if err != nil {
 		nodeLog.Infof("failed to get grpc client: %v, %v", addr, err)
 		return nil
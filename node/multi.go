@@ -1,12 +1,83 @@
 package node
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/absolute8511/redcon"
 	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/slow"
+
+	ps "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrMultiExecDupKey = errors.New("ERR the same key can not be written by more than one command in a transaction")
+	errMultiExecEmpty  = errors.New("ERR no command in the transaction")
 )
 
+// the first request in the multi exec raft proposal, the queued commands
+// will be followed as the redis requests.
+type multiExecMeta struct {
+	WatchKeys [][]byte `json:"watch_keys,omitempty"`
+	// the versions of the watched keys while watching
+	WatchVers []int64 `json:"watch_vers,omitempty"`
+}
+
+// the hyperloglog write is cached and flushed later in its own write batch,
+// so it can not be rolled back with the other commands in the transaction.
+// The geoadd is converted to zadd before proposed, which is not handled in
+// the transaction. The set and zset store commands read the source keys which
+// may be written by the previous commands in the same write batch, and so does the bitop.
+var multiExecDeniedCmds = map[string]bool{
+	"pfadd":       true,
+	"geoadd":      true,
+	"sinterstore": true,
+	"sunionstore": true,
+	"sdiffstore":  true,
+	"zunionstore": true,
+	"zinterstore": true,
+	"bitopand":    true,
+	"bitopor":     true,
+	"bitopxor":    true,
+	"bitopnot":    true,
+}
+
+// the response of the queued command in the state machine may be different from the redis
+// response, so we need rewrite it the same as the write handler.
+var multiExecRspFuncs = map[string]common.CommandRspFunc{
+	"set": func(cmd redcon.Command, rsp interface{}) (interface{}, error) {
+		if v, ok := rsp.(int64); ok && v == 0 {
+			return nil, nil
+		}
+		return "OK", nil
+	},
+	"setex":        checkOKRsp,
+	"hmset":        checkOKRsp,
+	"json.set":     checkOKRsp,
+	"lset":         checkOKRsp,
+	"ltrim":        checkOKRsp,
+	"lfixkey":      checkOKRsp,
+	"zfixkey":      checkOKRsp,
+	"plset":        checkOKRsp,
+	"mset":         checkOKRsp,
+	"noopwrite":    checkOKRsp,
+	"incrbyfloat":  checkAndRewriteFloatRsp,
+	"hincrbyfloat": checkAndRewriteFloatRsp,
+	"zincrby": func(cmd redcon.Command, rsp interface{}) (interface{}, error) {
+		if v, ok := rsp.(float64); ok {
+			return []byte(strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+		return rsp, nil
+	},
+}
+
 func (nd *KVNode) plsetCommand(cmd redcon.Command, rsp interface{}) (interface{}, error) {
 	return rsp, nil
 }
@@ -23,3 +94,312 @@ func (kvsm *kvStoreSM) localPlsetCommand(cmd redcon.Command, ts int64) (interfac
 	err := kvsm.store.MSet(ts, kvpairs...)
 	return nil, err
 }
+
+// WriteKeys return all the keys written by the command
+func WriteKeys(cmdName string, cmd redcon.Command) [][]byte {
+	var keys [][]byte
+	forEachWriteKey(cmdName, cmd, func(k []byte) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// IsMultiExecCmd check whether the command can be queued in the multi exec transaction,
+// only the write commands are allowed.
+func (nd *KVNode) IsMultiExecCmd(cmdName string) bool {
+	if multiExecDeniedCmds[cmdName] {
+		return false
+	}
+	if _, ok := nd.router.GetWCmdHandler(cmdName); ok {
+		return true
+	}
+	_, isWrite, ok := nd.router.GetMergeCmdHandler(cmdName)
+	return ok && isWrite
+}
+
+// GetWatchVersion return the modify version of the key while watching, the version
+// should be passed to MultiExec.
+func (nd *KVNode) GetWatchVersion(key []byte) (int64, error) {
+	pk, err := common.CutNamesapce(key)
+	if err != nil {
+		return 0, err
+	}
+	return getKeyVer(nd.store, pk)
+}
+
+// MultiExec propose all the queued commands as one raft request and they will be applied
+// in one write batch. If the version of any watched key is changed since watched, nothing will
+// be written and the response will be nil. Otherwise the response is the list of the
+// responses for the queued commands.
+// All the keys should be in the same partition, and each key can only be written by one command
+// since the command in the write batch can not read the data written by the previous command.
+func (nd *KVNode) MultiExec(watchKeys [][]byte, watchVers []int64, cmds []redcon.Command) (*FutureRsp, error) {
+	if len(cmds) == 0 {
+		return nil, errMultiExecEmpty
+	}
+	if len(cmds) > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	if len(watchKeys) != len(watchVers) {
+		return nil, common.ErrInvalidArgs
+	}
+	var meta multiExecMeta
+	meta.WatchVers = watchVers
+	for _, k := range watchKeys {
+		key, err := common.CutNamesapce(k)
+		if err != nil {
+			return nil, err
+		}
+		meta.WatchKeys = append(meta.WatchKeys, key)
+	}
+	d, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	var reqList BatchInternalRaftRequest
+	reqList.Timestamp = start.UnixNano()
+	reqList.Reqs = append(reqList.Reqs, InternalRaftRequest{
+		Header: RequestHeader{
+			ID:        nd.rn.reqIDGen.Next(),
+			DataType:  int32(MultiExecReq),
+			Timestamp: reqList.Timestamp,
+		},
+		Data: d,
+	})
+	written := make(map[string]bool)
+	cmdNames := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		cmdName := strings.ToLower(string(cmd.Args[0]))
+		if !nd.IsMultiExecCmd(cmdName) {
+			return nil, common.ErrInvalidCommand
+		}
+		// the command may have several keys, so we need cut the namespace for all the keys
+		args := make([][]byte, len(cmd.Args))
+		copy(args, cmd.Args)
+		forEachWriteKeyIndex(cmdName, args, func(i int) bool {
+			if err = common.CheckKey(args[i]); err != nil {
+				return false
+			}
+			args[i], err = common.CutNamesapce(args[i])
+			if err != nil {
+				return false
+			}
+			if written[string(args[i])] {
+				err = ErrMultiExecDupKey
+				return false
+			}
+			written[string(args[i])] = true
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		cmdNames = append(cmdNames, cmdName)
+		reqList.Reqs = append(reqList.Reqs, InternalRaftRequest{
+			Header: RequestHeader{
+				DataType:  int32(RedisReq),
+				Timestamp: reqList.Timestamp,
+			},
+			Data: buildCommand(args).Raw,
+		})
+	}
+	reqList.ReqNum = int32(len(reqList.Reqs))
+	rsp, err := nd.proposeInternalReqs(start, &reqList)
+	if err != nil {
+		return nil, err
+	}
+	rsp.rspHandle = func(r interface{}) (interface{}, error) {
+		rsps, ok := r.([]interface{})
+		if !ok {
+			// aborted by the watched keys
+			return nil, nil
+		}
+		for i, v := range rsps {
+			f, ok := multiExecRspFuncs[cmdNames[i]]
+			if !ok {
+				continue
+			}
+			if nv, err := f(cmds[i], v); err == nil {
+				rsps[i] = nv
+			}
+		}
+		return rsps, nil
+	}
+	return rsp, nil
+}
+
+// propose the requests as one raft log, and wait the response for the first request
+func (nd *KVNode) proposeInternalReqs(start time.Time, reqList *BatchInternalRaftRequest) (*FutureRsp, error) {
+	if !nd.IsWriteReady() {
+		return nil, errRaftNotReadyForWrite
+	}
+	if !nd.rn.HasLead() {
+		return nil, ErrNodeNoLeader
+	}
+	buffer, err := reqList.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	reqID := reqList.Reqs[0].Header.ID
+	// must register before propose
+	wr := nd.w.Register(reqID)
+	ctx, cancel := context.WithTimeout(context.Background(), proposeTimeout)
+	err = nd.rn.node.ProposeWithDrop(ctx, buffer, cancel)
+	if err != nil {
+		cancel()
+		nd.rn.Infof("propose internal requests failed : %v", err.Error())
+		metric.ErrorCnt.With(ps.Labels{
+			"namespace":  nd.GetFullName(),
+			"error_info": "raft_propose_failed",
+		}).Inc()
+		nd.w.Trigger(reqID, err)
+		return nil, err
+	}
+	var futureRsp FutureRsp
+	futureRsp.waitFunc = func() (interface{}, error) {
+		var rsp interface{}
+		// will always return a response, timed out or get a error
+		select {
+		case <-ctx.Done():
+			err := ctx.Err()
+			if err == context.Canceled {
+				// proposal canceled can be caused by leader transfer or no leader
+				err = ErrProposalCanceled
+			}
+			nd.w.Trigger(reqID, err)
+			rsp = err
+		case <-wr.WaitC():
+			rsp = wr.GetResult()
+		}
+		cancel()
+		if err, ok := rsp.(error); ok {
+			return nil, err
+		}
+		cost := time.Since(start)
+		if cost >= time.Millisecond*100 {
+			nd.rn.Infof("slow for internal requests: %v, cost %v", len(reqList.Reqs), cost)
+		}
+		return rsp, nil
+	}
+	return &futureRsp, nil
+}
+
+// the queued commands is not checked by the write handler before proposed, so
+// the invalid arguments may cause panic while handling the command.
+func (kvsm *kvStoreSM) handleMultiCmd(h common.InternalCommandFunc, cmd redcon.Command, ts int64) (v interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("ERR invalid arguments for '%s' command: %v", string(cmd.Args[0]), e)
+		}
+	}()
+	return h(cmd, ts)
+}
+
+// apply the multi exec transaction, the reqs are the queued commands after the meta request
+func (kvsm *kvStoreSM) applyMultiExec(isReplaying bool, fromSyncer bool, batch IBatchOperator,
+	metaReq InternalRaftRequest, reqs []InternalRaftRequest, reqTs int64, index uint64) {
+	reqID := metaReq.Header.ID
+	var meta multiExecMeta
+	err := json.Unmarshal(metaReq.Data, &meta)
+	if err != nil {
+		kvsm.Infof("invalid multi exec data: %v, %v", string(metaReq.Data), err)
+		kvsm.w.Trigger(reqID, err)
+		return
+	}
+	cmds := make([]redcon.Command, 0, len(reqs))
+	for _, req := range reqs {
+		cmd, err := redcon.Parse(req.Data)
+		if err != nil {
+			kvsm.w.Trigger(reqID, err)
+			return
+		}
+		if len(cmd.Args) < 2 {
+			kvsm.w.Trigger(reqID, errWrongNumberArgs)
+			return
+		}
+		cmdName := strings.ToLower(string(cmd.Args[0]))
+		if err := kvsm.checkSplitFence(cmdName, cmd, index); err != nil {
+			kvsm.w.Trigger(reqID, err)
+			return
+		}
+		cmds = append(cmds, cmd)
+	}
+	if fromSyncer {
+		if !isReplaying && !IsSyncerOnly() {
+			for _, cmd := range cmds {
+				if kvsm.preCheckConflict(cmd, reqTs) == Conflict {
+					kvsm.Infof("conflict sync multi exec: %v, %v", string(cmd.Raw), reqTs)
+					kvsm.w.Trigger(reqID, nil)
+					metric.EventCnt.With(ps.Labels{
+						"namespace":  kvsm.fullNS,
+						"event_name": "cluster_syncer_conflicted",
+					}).Inc()
+					return
+				}
+			}
+		}
+	}
+	// the versions are compared on the same applied state in all the replicas. The raft log
+	// synced to the remote cluster is the same even the transaction is aborted in the source
+	// cluster, and the writes before it are all synced with the same timestamps, so the
+	// remote cluster will abort it the same way by comparing the replicated versions.
+	for i, key := range meta.WatchKeys {
+		ver, err := getKeyVer(kvsm.store, key)
+		if err != nil {
+			kvsm.Infof("key %v failed to get modify version: %v", string(key), err)
+		}
+		if err != nil || i >= len(meta.WatchVers) || ver != meta.WatchVers[i] {
+			if fromSyncer {
+				metric.EventCnt.With(ps.Labels{
+					"namespace":  kvsm.fullNS,
+					"event_name": "cluster_syncer_multi_exec_aborted",
+				}).Inc()
+			}
+			// abort the transaction with nil response
+			kvsm.w.Trigger(reqID, nil)
+			return
+		}
+	}
+
+	cmdStart := time.Now()
+	err = batch.BeginBatch()
+	if err != nil {
+		kvsm.Infof("begin batch for multi exec failed: %v", err)
+		kvsm.w.Trigger(reqID, err)
+		return
+	}
+	rsps := make([]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		cmdName := strings.ToLower(string(cmd.Args[0]))
+		h, ok := kvsm.router.GetInternalCmdHandler(cmdName)
+		if !ok {
+			err = common.ErrInvalidCommand
+		} else {
+			if kvsm.topnWrites != nil {
+				kvsm.topnWrites.HitWrite(cmd.Args[1])
+			}
+			var v interface{}
+			v, err = kvsm.handleMultiCmd(h, cmd, reqTs)
+			rsps = append(rsps, v)
+		}
+		if err != nil {
+			kvsm.Errorf("redis command %v in multi exec error: %v, cmd: %v", cmdName, err, string(cmd.Raw))
+			if isUnrecoveryError(err) {
+				panic(err)
+			}
+			// nothing will be written if any command failed
+			batch.AbortBatchForError(err)
+			kvsm.w.Trigger(reqID, fmt.Errorf("EXECABORT Transaction discarded because of: %v", err.Error()))
+			return
+		}
+	}
+	batch.AddBatchRsp(reqID, rsps)
+	batch.CommitBatch()
+	cmdCost := time.Since(cmdStart)
+	slow.LogSlowDBWrite(cmdCost, slow.NewSlowLogInfo(kvsm.fullNS, "multi exec", strconv.Itoa(len(cmds))))
+	for _, cmd := range cmds {
+		kvsm.onCmdApplied(isReplaying, strings.ToLower(string(cmd.Args[0])), cmd)
+	}
+}
@@ -535,18 +535,22 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	if expPolicy == common.WaitCompact && dv == common.DefaultDataVer {
 		return nil, errors.New("can not use compact ttl for old data version")
 	}
+	if expPolicy == common.PeriodicalRotation && dv == common.DefaultDataVer {
+		return nil, errors.New("can not use periodical rotation ttl for old data version")
+	}
 	if dv != common.DefaultDataVer {
 		nodeLog.Infof("namespace %v data version: %v, expire policy: %v", conf.Name, conf.DataVersion, expPolicy)
 	}
 
 	kvOpts := &KVOptions{
-		DataDir:          path.Join(nsm.machineConf.DataRootDir, conf.Name),
-		KeepBackup:       nsm.machineConf.KeepBackup,
-		EngType:          conf.EngType,
-		RockOpts:         nsm.machineConf.RocksDBOpts,
-		ExpirationPolicy: expPolicy,
-		DataVersion:      dv,
-		SharedConfig:     nsm.machineConf.RocksDBSharedConfig,
+		DataDir:                  path.Join(nsm.machineConf.DataRootDir, conf.Name),
+		KeepBackup:               nsm.machineConf.KeepBackup,
+		EngType:                  conf.EngType,
+		RockOpts:                 nsm.machineConf.RocksDBOpts,
+		ExpirationPolicy:         expPolicy,
+		ExpirationRotationPeriod: conf.ExpirationRotationPeriod,
+		DataVersion:              dv,
+		SharedConfig:             nsm.machineConf.RocksDBSharedConfig,
 	}
 	engine.FillDefaultOptions(&kvOpts.RockOpts)
 
@@ -570,6 +574,14 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	if n, ok := nsm.kvNodes[conf.Name]; ok {
 		return n, ErrNamespaceAlreadyExist
 	}
+	// the new partition created by split should be seeded from the parent partition
+	if err := nsm.prepareSplitSeed(conf, kvOpts); err != nil {
+		return nil, err
+	}
+	// the new namespace restored from backup should be seeded from the backup files
+	if err := nsm.prepareBackupRestoreSeed(conf, kvOpts); err != nil {
+		return nil, err
+	}
 
 	d, _ := json.MarshalIndent(&conf, "", " ")
 	nodeLog.Infof("namespace load config: %v", string(d))
@@ -600,7 +612,13 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 		nsm.nsMetas[conf.BaseName] = meta
 		nodeLog.Infof("namespace meta init: %v", conf)
 	} else {
-		if oldMeta.PartitionNum != conf.PartitionNum {
+		if oldMeta.PartitionNum != conf.PartitionNum && nsm.hasNamespaceNodes(conf.BaseName) {
+			// the partition number changed by split, other partitions are still running
+			// on the old meta, so we just update it.
+			nodeLog.Infof("namespace meta partition changed: %v, old: %v", conf, oldMeta)
+			oldMeta.PartitionNum = conf.PartitionNum
+			meta = oldMeta
+		} else if oldMeta.PartitionNum != conf.PartitionNum {
 			nodeLog.Errorf("namespace meta mismatch: %v, old: %v", conf, oldMeta)
 			// update the meta if mismatch, it may happen if create the same namespace with different
 			// config for old deleted namespace
@@ -643,6 +661,25 @@ func GetHashedPartitionID(pk []byte, pnum int) int {
 	return HashedKey(pk) % pnum
 }
 
+// SlotHashedKey return the redis cluster slot of the key (namespace:pk), the keys in the redis
+// cluster namespace are placed by the slot.
+func SlotHashedKey(nsBaseName string, pk []byte) int {
+	rawKey := make([]byte, 0, len(nsBaseName)+1+len(pk))
+	rawKey = append(rawKey, nsBaseName...)
+	rawKey = append(rawKey, common.NamespaceTableSeperator)
+	rawKey = append(rawKey, pk...)
+	return common.KeyHashSlot(rawKey)
+}
+
+// GetPartitionID return the partition of the primary key, the pkSum is the default hash sum
+// of the primary key.
+func (nsm *NamespaceMgr) GetPartitionID(nsBaseName string, pk []byte, pkSum int, pnum int) int {
+	if nsBaseName != "" && nsBaseName == nsm.machineConf.RedisClusterNamespace {
+		return common.SlotPartition(SlotHashedKey(nsBaseName, pk), pnum)
+	}
+	return pkSum % pnum
+}
+
 func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKeySum(nsBaseName string, pk []byte, pkSum int) (*NamespaceNode, error) {
 	nsm.mutex.RLock()
 	defer nsm.mutex.RUnlock()
@@ -651,7 +688,7 @@ func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKeySum(nsBaseName string, pk
 		nodeLog.Infof("namespace %v meta not found", nsBaseName)
 		return nil, ErrNamespaceNotFound
 	}
-	pid := pkSum % v.PartitionNum
+	pid := nsm.GetPartitionID(nsBaseName, pk, pkSum, v.PartitionNum)
 	fullName := common.GetNsDesp(nsBaseName, pid)
 	n, ok := nsm.kvNodes[fullName]
 	if !ok {
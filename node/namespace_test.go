@@ -263,3 +263,17 @@ func BenchmarkNamespaceMgr_GetNamespaceNodeWithPrimaryKey(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+func TestUpdateNamespacePartitionNum(t *testing.T) {
+	nsm := &NamespaceMgr{
+		nsMetas: map[string]*NamespaceMeta{"test_split": {PartitionNum: 4}},
+	}
+	nsm.UpdateNamespacePartitionNum("test_split", 8)
+	assert.Equal(t, 8, nsm.nsMetas["test_split"].PartitionNum)
+	// the older partition number read from the register should be ignored
+	nsm.UpdateNamespacePartitionNum("test_split", 4)
+	assert.Equal(t, 8, nsm.nsMetas["test_split"].PartitionNum)
+	nsm.UpdateNamespacePartitionNum("test_none", 8)
+	_, ok := nsm.nsMetas["test_none"]
+	assert.False(t, ok)
+}
@@ -61,6 +61,14 @@ var (
 	ErrReadIndexTimeout      = errors.New("wait read index timeout")
 	ErrNotLeader             = errors.New("not raft leader")
 	ErrTransferLeaderSelfErr = errors.New("transfer leader to self not allowed")
+	errInvalidFloat          = errors.New("ERR value is not a valid float")
+	errDecrOverflow          = errors.New("ERR decrement would overflow")
+	errBitValue              = errors.New("ERR The bit argument must be 1 or 0.")
+	errBitOffset             = errors.New("ERR bit offset is not an integer or out of range")
+	errBitFieldType          = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	errBitFieldOverflow      = errors.New("ERR Invalid OVERFLOW type specified")
+	errBitFieldRO            = errors.New("ERR BITFIELD_RO only supports the GET subcommand")
+	errBitOpNot              = errors.New("ERR BITOP NOT must be called with a single source key.")
 )
 
 const (
@@ -68,6 +76,8 @@ const (
 	CustomReq            int8 = 1
 	SchemaChangeReq      int8 = 2
 	RedisV2Req           int8 = 3
+	MultiExecReq         int8 = 4
+	ScriptReq            int8 = 5
 	proposeTimeout            = time.Second * 4
 	raftSlow                  = time.Millisecond * 200
 	maxPoolIDLen              = 256
@@ -83,6 +93,7 @@ const (
 	ProposeOp_RemoteConfChange       int = 4
 	ProposeOp_ApplySkippedRemoteSnap int = 5
 	ProposeOp_DeleteTable            int = 6
+	ProposeOp_SplitBarrier           int = 7
 )
 
 type CompactAPIRange struct {
@@ -235,6 +246,8 @@ type KVNode struct {
 	slowLimiter         *SlowLimiter
 	lastFailedSnapIndex uint64
 	applyingSnapshot int32
+	listWaiters      *listBlockWaiters
+	quota            *quotaChecker
 }
 
 type KVSnapInfo struct {
@@ -290,15 +303,22 @@ func NewKVNode(kvopts *KVOptions, config *RaftConfig,
 		readNotifier:       newNotifier(),
 		wrPools:            newWaitReqPoolArray(),
 		slowLimiter:        sl,
+		listWaiters:        newListBlockWaiters(),
+		quota:              newQuotaChecker(config.GroupName),
 	}
 
 	if kvsm, ok := sm.(*kvStoreSM); ok {
 		s.store = kvsm.store
+		kvsm.listWaiters = s.listWaiters
 	}
 
 	s.clusterInfo = clusterInfo
 
 	s.registerHandler()
+	if kvsm, ok := sm.(*kvStoreSM); ok {
+		// the script in state machine need call the read commands
+		kvsm.readRouter = s.router
+	}
 
 	var rs raft.IExtRaftStorage
 	if config.nodeConfig.UseRocksWAL && config.rockEng != nil {
@@ -317,6 +337,9 @@ func NewKVNode(kvopts *KVOptions, config *RaftConfig,
 	}
 	raftNode.slowLimiter = s.slowLimiter
 	s.rn = raftNode
+	if kvsm, ok := sm.(*kvStoreSM); ok {
+		kvsm.leaderChecker.Store(s.IsLead)
+	}
 	s.commitC = commitC
 	return s, nil
 }
@@ -359,6 +382,11 @@ func (nd *KVNode) Start(standalone bool) error {
 		defer nd.wg.Done()
 		nd.readIndexLoop()
 	}()
+	nd.wg.Add(1)
+	go func() {
+		defer nd.wg.Done()
+		nd.quotaUsageLoop()
+	}()
 
 	nd.slowLimiter.Start()
 	return nil
@@ -659,6 +687,7 @@ func (nd *KVNode) SetDynamicInfo(dync NamespaceDynamicConf) {
 	if nd.rn != nil && nd.rn.config != nil {
 		atomic.StoreInt32(&nd.rn.config.Replicator, int32(dync.Replicator))
 	}
+	nd.quota.setQuota(dync.Quota, dync.PartitionNum)
 }
 
 func (nd *KVNode) IsWriteReady() bool {
@@ -1114,6 +1143,12 @@ func (nd *KVNode) linearizableReadNotify(ctx context.Context) error {
 	}
 }
 
+// WaitReadIndex get the read index from the leader and wait until the local applied index
+// reached it, so the read after this is linearizable even on the follower.
+func (nd *KVNode) WaitReadIndex(ctx context.Context) error {
+	return nd.linearizableReadNotify(ctx)
+}
+
 func (nd *KVNode) readIndexLoop() {
 	var rs raft.ReadState
 	to := time.Second * 5
@@ -1150,7 +1185,7 @@ func (nd *KVNode) readIndexLoop() {
 		)
 		for !timeout && !done {
 			select {
-			case rs := <-nd.rn.readStateC:
+			case rs = <-nd.rn.readStateC:
 				done = bytes.Equal(rs.RequestCtx, req)
 				if !done {
 					// a previous request might time out. now we should ignore the response of it and
@@ -1311,6 +1346,9 @@ func (nd *KVNode) applyEntry(evnt raftpb.Entry, isReplaying bool, batch IBatchOp
 				if reqList.ReqId > 0 {
 					nd.w.Trigger(reqList.ReqId, nil)
 				}
+				if kvsm, ok := nd.sm.(*kvStoreSM); ok {
+					kvsm.archiveRaftLog(nil, evnt.Term, evnt.Index, 0)
+				}
 				return false
 			}
 			isRemoteSnapTransfer, isRemoteSnapApply = nd.preprocessRemoteSnapApply(reqList)
@@ -1533,6 +1571,11 @@ func (nd *KVNode) maybeTriggerSnapshot(np *nodeProgress, confChanged bool, force
 
 	np.snapi = np.appliedi
 	nd.SetLastSnapIndex(np.snapi)
+	if nd.store != nil {
+		// the seed data by split or restore is in snapshot now
+		nd.store.clearSplitSeed()
+		nd.store.clearRestoreSeed()
+	}
 }
 
 func (nd *KVNode) GetSnapshot(term uint64, index uint64) (Snapshot, error) {
@@ -1628,6 +1671,11 @@ func (nd *KVNode) ReportMeLeaderToCluster() {
 func (nd *KVNode) OnRaftLeaderChanged() {
 	if nd.rn.IsLead() {
 		go nd.ReportMeLeaderToCluster()
+		// the usage is only refreshed on the leader, so it may be out of date
+		nd.quota.triggerRefresh()
+	} else {
+		// the blocked clients should retry on the new leader
+		nd.listWaiters.failAll(ErrNamespaceNotLeader)
 	}
 }
 
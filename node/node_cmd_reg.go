@@ -1,18 +1,28 @@
 package node
 
+import (
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
 func getWriteCmdType(cmd string) string {
 	switch cmd {
-	case "zadd", "zfixkey", "zincrby", "zrem", "zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zclear", "zmclear", "zexpire", "zpersist":
+	case "zadd", "zfixkey", "zincrby", "zrem", "zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zclear", "zmclear",
+		"zunionstore", "zinterstore", "zpopmin", "zpopmax", "zexpire", "zpersist":
 		return "zset"
-	case "sadd", "srem", "sclear", "smclear", "spop", "sexpire", "spersist":
+	case "sadd", "srem", "sclear", "smclear", "spop", "smove", "sinterstore", "sunionstore", "sdiffstore", "sexpire", "spersist":
 		return "set"
-	case "lfixkey", "lpush", "lpop", "lset", "ltrim", "rpop", "rpush", "lclear", "lmclear", "lexpire", "lpersist":
+	case "lfixkey", "lpush", "lpop", "lset", "ltrim", "rpop", "rpush", "rpoplpush", "lmove", "lrem", "linsert", "lclear", "lmclear", "lexpire", "lpersist":
 		return "list"
+	case "xadd", "xdel", "xtrim", "xgroupcreate", "xgroupsetid", "xgroupdestroy", "xreadgroup", "xack", "xclaim", "xclear", "xmclear", "xexpire", "xpersist":
+		return "stream"
 	default:
 		return "default"
 	}
 }
 
+// the internal commands rewritten from the redis bitop command
+var bitOpCmds = []string{"bitopand", "bitopor", "bitopxor", "bitopnot"}
+
 func (kvsm *kvStoreSM) registerHandlers() {
 
 	kvsm.router.RegisterInternal("noopwrite", kvsm.localNoOpWriteCommand)
@@ -31,11 +41,18 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("mset", kvsm.localMSetCommand)
 	kvsm.router.RegisterInternal("incr", kvsm.localIncrCommand)
 	kvsm.router.RegisterInternal("incrby", kvsm.localIncrByCommand)
+	kvsm.router.RegisterInternal("incrbyfloat", kvsm.localIncrByFloatCommand)
+	kvsm.router.RegisterInternal("decr", kvsm.localDecrCommand)
+	kvsm.router.RegisterInternal("decrby", kvsm.localDecrByCommand)
 	kvsm.router.RegisterInternal("plset", kvsm.localPlsetCommand)
 	kvsm.router.RegisterInternal("pfadd", kvsm.localPFAddCommand)
 	//kvsm.router.RegisterInternal("pfcount", kvsm.localPFCountCommand)
 	// bitmap
 	kvsm.router.RegisterInternal("bitclear", kvsm.localBitClearCommand)
+	kvsm.router.RegisterInternal("bitfield", kvsm.localBitFieldCommand)
+	for _, name := range bitOpCmds {
+		kvsm.router.RegisterInternal(name, kvsm.localBitOpCommand)
+	}
 
 	// hash
 	kvsm.router.RegisterInternal("hset", kvsm.localHSetCommand)
@@ -43,6 +60,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("hmset", kvsm.localHMsetCommand)
 	kvsm.router.RegisterInternal("hdel", kvsm.localHDelCommand)
 	kvsm.router.RegisterInternal("hincrby", kvsm.localHIncrbyCommand)
+	kvsm.router.RegisterInternal("hincrbyfloat", kvsm.localHIncrbyFloatCommand)
 	kvsm.router.RegisterInternal("hclear", kvsm.localHclearCommand)
 	kvsm.router.RegisterInternal("hmclear", kvsm.localHMClearCommand)
 	// for json
@@ -58,6 +76,10 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("ltrim", kvsm.localLtrimCommand)
 	kvsm.router.RegisterInternal("rpop", kvsm.localRpopCommand)
 	kvsm.router.RegisterInternal("rpush", kvsm.localRpushCommand)
+	kvsm.router.RegisterInternal("rpoplpush", kvsm.localRpoplpushCommand)
+	kvsm.router.RegisterInternal("lmove", kvsm.localLmoveCommand)
+	kvsm.router.RegisterInternal("lrem", kvsm.localLremCommand)
+	kvsm.router.RegisterInternal("linsert", kvsm.localLinsertCommand)
 	kvsm.router.RegisterInternal("lclear", kvsm.localLclearCommand)
 	kvsm.router.RegisterInternal("lmclear", kvsm.localLMClearCommand)
 	// zset
@@ -70,12 +92,32 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("zremrangebylex", kvsm.localZremrangebylexCommand)
 	kvsm.router.RegisterInternal("zclear", kvsm.localZclearCommand)
 	kvsm.router.RegisterInternal("zmclear", kvsm.localZMClearCommand)
+	kvsm.router.RegisterInternal("zunionstore", kvsm.localZunionstoreCommand)
+	kvsm.router.RegisterInternal("zinterstore", kvsm.localZinterstoreCommand)
+	kvsm.router.RegisterInternal("zpopmin", kvsm.localZpopminCommand)
+	kvsm.router.RegisterInternal("zpopmax", kvsm.localZpopmaxCommand)
 	// set
 	kvsm.router.RegisterInternal("sadd", kvsm.localSadd)
 	kvsm.router.RegisterInternal("srem", kvsm.localSrem)
 	kvsm.router.RegisterInternal("sclear", kvsm.localSclear)
 	kvsm.router.RegisterInternal("smclear", kvsm.localSmclear)
 	kvsm.router.RegisterInternal("spop", kvsm.localSpop)
+	kvsm.router.RegisterInternal("smove", kvsm.localSmove)
+	kvsm.router.RegisterInternal("sinterstore", kvsm.localSinterstore)
+	kvsm.router.RegisterInternal("sunionstore", kvsm.localSunionstore)
+	kvsm.router.RegisterInternal("sdiffstore", kvsm.localSdiffstore)
+	// stream
+	kvsm.router.RegisterInternal("xadd", kvsm.localXaddCommand)
+	kvsm.router.RegisterInternal("xdel", kvsm.localXdelCommand)
+	kvsm.router.RegisterInternal("xtrim", kvsm.localXtrimCommand)
+	kvsm.router.RegisterInternal("xgroupcreate", kvsm.localXgroupCreateCommand)
+	kvsm.router.RegisterInternal("xgroupsetid", kvsm.localXgroupSetIDCommand)
+	kvsm.router.RegisterInternal("xgroupdestroy", kvsm.localXgroupDestroyCommand)
+	kvsm.router.RegisterInternal("xreadgroup", kvsm.localXreadgroupCommand)
+	kvsm.router.RegisterInternal("xack", kvsm.localXackCommand)
+	kvsm.router.RegisterInternal("xclaim", kvsm.localXclaimCommand)
+	kvsm.router.RegisterInternal("xclear", kvsm.localXclearCommand)
+	kvsm.router.RegisterInternal("xmclear", kvsm.localXmclearCommand)
 	// expire&persist
 	kvsm.router.RegisterInternal("setex", kvsm.localSetexCommand)
 	kvsm.router.RegisterInternal("expire", kvsm.localExpireCommand)
@@ -83,6 +125,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("hexpire", kvsm.localHashExpireCommand)
 	kvsm.router.RegisterInternal("sexpire", kvsm.localSetExpireCommand)
 	kvsm.router.RegisterInternal("zexpire", kvsm.localZSetExpireCommand)
+	kvsm.router.RegisterInternal("xexpire", kvsm.localStreamExpireCommand)
 	kvsm.router.RegisterInternal("bexpire", kvsm.localBitExpireCommand)
 
 	kvsm.router.RegisterInternal("persist", kvsm.localPersistCommand)
@@ -90,6 +133,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("lpersist", kvsm.localListPersistCommand)
 	kvsm.router.RegisterInternal("spersist", kvsm.localSetPersistCommand)
 	kvsm.router.RegisterInternal("zpersist", kvsm.localZSetPersistCommand)
+	kvsm.router.RegisterInternal("xpersist", kvsm.localStreamPersistCommand)
 	kvsm.router.RegisterInternal("bpersist", kvsm.localBitPersistCommand)
 
 	if enableSlowLimiterTest && kvsm.slowLimiter != nil {
@@ -117,6 +161,8 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("getnolock", wrapReadCommandK(nd.getNoLockCommand))
 	nd.router.RegisterRead("getbit", wrapReadCommandKAnySubkeyN(nd.getbitCommand, 1))
 	nd.router.RegisterRead("bitcount", wrapReadCommandKAnySubkey(nd.bitcountCommand))
+	nd.router.RegisterRead("bitpos", wrapReadCommandKAnySubkeyN(nd.bitposCommand, 1))
+	nd.router.RegisterRead("bitfield_ro", wrapReadCommandKAnySubkey(nd.bitfieldROCommand))
 	nd.router.RegisterRead("mget", wrapReadCommandKK(nd.mgetCommand))
 	nd.router.RegisterWrite("set", nd.setCommand)
 	nd.router.RegisterWrite("append", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
@@ -129,9 +175,16 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("delifeq", nd.delIfEQCommand)
 	nd.router.RegisterWrite("incr", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("incrby", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("incrbyfloat", wrapWriteCommandKV(nd, checkAndRewriteFloatRsp))
+	nd.router.RegisterWrite("decr", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("decrby", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("pfadd", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 0))
 	nd.router.RegisterRead("pfcount", wrapReadCommandK(nd.pfcountCommand))
 	nd.router.RegisterWrite("bitclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("bitfield", nd.bitfieldCommand)
+	for _, name := range bitOpCmds {
+		nd.router.RegisterWrite(name, nd.bitopCommand)
+	}
 	// for hash
 	nd.router.RegisterRead("hget", wrapReadCommandKSubkey(nd.hgetCommand))
 	nd.router.RegisterRead("stale.hget.version", wrapReadCommandKSubkey(nd.hgetVerCommand))
@@ -148,6 +201,7 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("hmset", wrapWriteCommandKSubkeyVSubkeyV(nd, checkOKRsp))
 	nd.router.RegisterWrite("hdel", wrapWriteCommandKSubkeySubkey(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("hincrby", wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("hincrbyfloat", wrapWriteCommandKSubkeyV(nd, checkAndRewriteFloatRsp))
 	nd.router.RegisterWrite("hclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	// for json
 	nd.router.RegisterRead("json.get", wrapReadCommandKAnySubkey(nd.jsonGetCommand))
@@ -166,11 +220,16 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("lindex", wrapReadCommandKSubkey(nd.lindexCommand))
 	nd.router.RegisterRead("llen", wrapReadCommandK(nd.llenCommand))
 	nd.router.RegisterRead("lrange", wrapReadCommandKAnySubkey(nd.lrangeCommand))
+	nd.router.RegisterRead("lpos", wrapReadCommandKAnySubkeyN(nd.lposCommand, 1))
 	nd.router.RegisterWrite("lfixkey", wrapWriteCommandK(nd, nil, checkOKRsp))
 	nd.router.RegisterWrite("lpop", wrapWriteCommandK(nd, nd.preCheckListLength, checkAndRewriteBulkRsp))
 	nd.router.RegisterWrite("lpush", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 1))
 	nd.router.RegisterWrite("lset", nd.lsetCommand)
 	nd.router.RegisterWrite("ltrim", nd.ltrimCommand)
+	nd.router.RegisterWrite("lrem", nd.lremCommand)
+	nd.router.RegisterWrite("linsert", nd.linsertCommand)
+	nd.router.RegisterWrite("rpoplpush", nd.rpoplpushCommand)
+	nd.router.RegisterWrite("lmove", nd.lmoveCommand)
 	nd.router.RegisterWrite("rpop", wrapWriteCommandK(nd, nd.preCheckListLength, checkAndRewriteBulkRsp))
 	nd.router.RegisterWrite("rpush", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 1))
 	nd.router.RegisterWrite("lclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
@@ -195,6 +254,10 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("zremrangebyscore", nd.zremrangebyscoreCommand)
 	nd.router.RegisterWrite("zremrangebylex", nd.zremrangebylexCommand)
 	nd.router.RegisterWrite("zclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("zpopmin", nd.zpopCommand)
+	nd.router.RegisterWrite("zpopmax", nd.zpopCommand)
+	nd.router.RegisterWrite("zunionstore", nd.zsetStoreCommand)
+	nd.router.RegisterWrite("zinterstore", nd.zsetStoreCommand)
 	// for set
 	nd.router.RegisterRead("scard", wrapReadCommandK(nd.scardCommand))
 	nd.router.RegisterRead("sismember", wrapReadCommandKSubkey(nd.sismemberCommand))
@@ -204,6 +267,25 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("sadd", nd.saddCommand)
 	nd.router.RegisterWrite("srem", nd.sremCommand)
 	nd.router.RegisterWrite("sclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
+	// all the keys should be in the same partition, it is checked before the command is handled
+	nd.router.RegisterWrite("smove", nd.smoveCommand)
+	nd.router.RegisterWrite("sinterstore", nd.setStoreCommand)
+	nd.router.RegisterWrite("sunionstore", nd.setStoreCommand)
+	nd.router.RegisterWrite("sdiffstore", nd.setStoreCommand)
+	// for stream
+	nd.router.RegisterRead("xlen", wrapReadCommandK(nd.xlenCommand))
+	nd.router.RegisterRead("xrange", wrapReadCommandKAnySubkeyN(nd.xrangeCommand, 2))
+	nd.router.RegisterRead("xrevrange", wrapReadCommandKAnySubkeyN(nd.xrevrangeCommand, 2))
+	nd.router.RegisterRead("xpending", wrapReadCommandKAnySubkeyN(nd.xpendingCommand, 1))
+	nd.router.RegisterWrite("xadd", nd.xaddCommand)
+	nd.router.RegisterWrite("xdel", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 1))
+	nd.router.RegisterWrite("xtrim", nd.xtrimCommand)
+	nd.router.RegisterWrite("xgroupcreate", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 2, 3))
+	nd.router.RegisterWrite("xgroupsetid", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 2, 2))
+	nd.router.RegisterWrite("xgroupdestroy", wrapWriteCommandKSubkey(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("xack", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 2))
+	nd.router.RegisterWrite("xclaim", wrapWriteCommandKAnySubkey(nd, nil, 4))
+	nd.router.RegisterWrite("xclear", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	// for ttl
 	nd.router.RegisterRead("ttl", wrapReadCommandK(nd.ttlCommand))
 	nd.router.RegisterRead("httl", wrapReadCommandK(nd.httlCommand))
@@ -211,12 +293,14 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("sttl", wrapReadCommandK(nd.sttlCommand))
 	nd.router.RegisterRead("zttl", wrapReadCommandK(nd.zttlCommand))
 	nd.router.RegisterRead("bttl", wrapReadCommandK(nd.bttlCommand))
+	nd.router.RegisterRead("xttl", wrapReadCommandK(nd.xttlCommand))
 	// extended exist
 	nd.router.RegisterRead("hkeyexist", wrapReadCommandK(nd.hKeyExistCommand))
 	nd.router.RegisterRead("lkeyexist", wrapReadCommandK(nd.lKeyExistCommand))
 	nd.router.RegisterRead("skeyexist", wrapReadCommandK(nd.sKeyExistCommand))
 	nd.router.RegisterRead("zkeyexist", wrapReadCommandK(nd.zKeyExistCommand))
 	nd.router.RegisterRead("bkeyexist", wrapReadCommandK(nd.bKeyExistCommand))
+	nd.router.RegisterRead("xkeyexist", wrapReadCommandK(nd.xKeyExistCommand))
 
 	nd.router.RegisterWrite("setex", wrapWriteCommandKVV(nd, checkOKRsp))
 	nd.router.RegisterWrite("expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
@@ -225,6 +309,7 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("sexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("zexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("bexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("xexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 
 	nd.router.RegisterWrite("persist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("hpersist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
@@ -232,6 +317,7 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("spersist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("zpersist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("bpersist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("xpersist", wrapWriteCommandK(nd, nil, checkAndRewriteIntRsp))
 
 	// for scan
 	nd.router.RegisterRead("hscan", wrapReadCommandKAnySubkey(nd.hscanCommand))
@@ -256,11 +342,16 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterMerge("advrevscan", nd.advanceScanCommand)
 	nd.router.RegisterMerge("fullscan", nd.fullScanCommand)
 	nd.router.RegisterMerge("hidx.from", nd.hindexSearchCommand)
+	nd.router.RegisterMerge("jidx.from", nd.jindexSearchCommand)
 
 	nd.router.RegisterMerge("exists", wrapMergeCommandKK(nd.existsCommand))
+	nd.router.RegisterMerge("mget", wrapMergeCommandKK(nd.mgetMergeCommand))
+	nd.router.RegisterMerge("sinter", wrapMergeCommandKK(nd.smembersMergeCommand))
+	nd.router.RegisterMerge("sunion", wrapMergeCommandKK(nd.smembersMergeCommand))
+	nd.router.RegisterMerge("sdiff", wrapMergeCommandKK(nd.smembersMergeCommand))
 	// make sure the merged write command will be stopped if cluster is not allowed to write
 	nd.router.RegisterWriteMerge("del", wrapWriteMergeCommandKK(nd, checkAndRewriteIntRsp))
-	//nd.router.RegisterWriteMerge("mset", nd.msetCommand)
+	nd.router.RegisterWriteMerge("mset", wrapWriteMergeCommandKVKV(nd, nil))
 	nd.router.RegisterWriteMerge("plset", wrapWriteMergeCommandKVKV(nd, nil))
 
 	if enableSlowLimiterTest {
@@ -283,19 +374,28 @@ func (kvsm *kvStoreSM) registerConflictHandlers() {
 	kvsm.cRouter.Register("setnx", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("incr", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("incrby", kvsm.checkKVConflict)
+	kvsm.cRouter.Register("incrbyfloat", kvsm.checkKVConflict)
+	kvsm.cRouter.Register("decr", kvsm.checkKVConflict)
+	kvsm.cRouter.Register("decrby", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("plset", kvsm.checkKVKVConflict)
+	kvsm.cRouter.Register("mset", kvsm.checkKVKVConflict)
 	// hll
 	kvsm.cRouter.Register("pfadd", kvsm.checkHLLConflict)
 	// bitmap
 	kvsm.cRouter.Register("setbitv2", kvsm.checkBitmapConflict)
 	kvsm.cRouter.Register("setbit", kvsm.checkBitmapConflict)
 	kvsm.cRouter.Register("bitclear", kvsm.checkBitmapConflict)
+	kvsm.cRouter.Register("bitfield", kvsm.checkBitmapConflict)
+	for _, name := range bitOpCmds {
+		kvsm.cRouter.Register(name, kvsm.checkBitmapConflict)
+	}
 	kvsm.cRouter.Register("bexpire", kvsm.checkBitmapConflict)
 	kvsm.cRouter.Register("bpersist", kvsm.checkBitmapConflict)
 	// hash
 	kvsm.cRouter.Register("hset", kvsm.checkHashKFVConflict)
 	kvsm.cRouter.Register("hsetnx", kvsm.checkHashKFVConflict)
 	kvsm.cRouter.Register("hincrby", kvsm.checkHashKFVConflict)
+	kvsm.cRouter.Register("hincrbyfloat", kvsm.checkHashKFVConflict)
 	kvsm.cRouter.Register("hmset", kvsm.checkHashKFVConflict)
 	kvsm.cRouter.Register("hdel", kvsm.checkHashKFFConflict)
 	kvsm.cRouter.Register("hincrby", kvsm.checkHashKFVConflict)
@@ -311,6 +411,10 @@ func (kvsm *kvStoreSM) registerConflictHandlers() {
 	kvsm.cRouter.Register("ltrim", kvsm.checkListConflict)
 	kvsm.cRouter.Register("rpop", kvsm.checkListConflict)
 	kvsm.cRouter.Register("rpush", kvsm.checkListConflict)
+	kvsm.cRouter.Register("rpoplpush", kvsm.checkListMoveConflict)
+	kvsm.cRouter.Register("lmove", kvsm.checkListMoveConflict)
+	kvsm.cRouter.Register("lrem", kvsm.checkListConflict)
+	kvsm.cRouter.Register("linsert", kvsm.checkListConflict)
 	kvsm.cRouter.Register("lclear", kvsm.checkListConflict)
 	kvsm.cRouter.Register("lexpire", kvsm.checkListConflict)
 	kvsm.cRouter.Register("lpersist", kvsm.checkListConflict)
@@ -324,16 +428,138 @@ func (kvsm *kvStoreSM) registerConflictHandlers() {
 	kvsm.cRouter.Register("zclear", kvsm.checkZSetConflict)
 	kvsm.cRouter.Register("zexpire", kvsm.checkZSetConflict)
 	kvsm.cRouter.Register("zpersist", kvsm.checkZSetConflict)
+	kvsm.cRouter.Register("zpopmin", kvsm.checkZSetConflict)
+	kvsm.cRouter.Register("zpopmax", kvsm.checkZSetConflict)
+	kvsm.cRouter.Register("zunionstore", kvsm.checkZSetConflict)
+	kvsm.cRouter.Register("zinterstore", kvsm.checkZSetConflict)
 	// set
 	kvsm.cRouter.Register("sadd", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("srem", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("spop", kvsm.checkSetConflict)
+	kvsm.cRouter.Register("smove", kvsm.checkSetMoveConflict)
+	kvsm.cRouter.Register("sinterstore", kvsm.checkSetConflict)
+	kvsm.cRouter.Register("sunionstore", kvsm.checkSetConflict)
+	kvsm.cRouter.Register("sdiffstore", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("sclear", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("sexpire", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("spersist", kvsm.checkSetConflict)
+	// stream
+	kvsm.cRouter.Register("xadd", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xdel", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xtrim", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xgroupcreate", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xgroupsetid", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xgroupdestroy", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xreadgroup", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xack", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xclaim", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xclear", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xexpire", kvsm.checkStreamConflict)
+	kvsm.cRouter.Register("xpersist", kvsm.checkStreamConflict)
 	// expire
 	kvsm.cRouter.Register("setex", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("expire", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("persist", kvsm.checkKVConflict)
+	// used for the watched keys in the multi exec transaction
+	kvsm.cRouter.Register("watch", kvsm.checkWatchConflict)
 	// for json
 }
+
+// the resolvers for the writes from the other cluster in the active-active mode
+func (kvsm *kvStoreSM) registerConflictResolvers() {
+	// kv
+	kvLWW := kvsm.lwwResolver(rockredis.KVType, false)
+	// the increments after the assignment are replayed after the newer remote assignment
+	kvAssignLWW := kvsm.lwwResolver(rockredis.KVType, true)
+	kvsm.cRouter.RegisterResolver("del", kvsm.resolveKVKeys)
+	kvsm.cRouter.RegisterResolver("delifeq", kvLWW)
+	kvsm.cRouter.RegisterResolver("set", kvAssignLWW)
+	kvsm.cRouter.RegisterResolver("setifeq", kvLWW)
+	kvsm.cRouter.RegisterResolver("append", kvLWW)
+	kvsm.cRouter.RegisterResolver("setrange", kvLWW)
+	kvsm.cRouter.RegisterResolver("getset", kvAssignLWW)
+	kvsm.cRouter.RegisterResolver("setnx", kvLWW)
+	kvsm.cRouter.RegisterResolver("setex", kvAssignLWW)
+	kvsm.cRouter.RegisterResolver("expire", kvLWW)
+	kvsm.cRouter.RegisterResolver("persist", kvLWW)
+	kvsm.cRouter.RegisterResolver("incr", kvsm.resolveKVCounter)
+	kvsm.cRouter.RegisterResolver("incrby", kvsm.resolveKVCounter)
+	kvsm.cRouter.RegisterResolver("incrbyfloat", kvsm.resolveKVCounter)
+	kvsm.cRouter.RegisterResolver("decr", kvsm.resolveKVCounter)
+	kvsm.cRouter.RegisterResolver("decrby", kvsm.resolveKVCounter)
+	kvsm.cRouter.RegisterResolver("plset", kvsm.resolveKVKV)
+	kvsm.cRouter.RegisterResolver("mset", kvsm.resolveKVKV)
+	// bitmap
+	bitLWW := kvsm.lwwResolver(rockredis.BitmapType, false)
+	kvsm.cRouter.RegisterResolver("setbitv2", kvsm.mergeResolver(rockredis.BitmapType))
+	kvsm.cRouter.RegisterResolver("setbit", kvsm.mergeResolver(rockredis.BitmapType))
+	kvsm.cRouter.RegisterResolver("bitclear", bitLWW)
+	kvsm.cRouter.RegisterResolver("bitfield", kvsm.mergeResolver(rockredis.BitmapType))
+	for _, name := range bitOpCmds {
+		kvsm.cRouter.RegisterResolver(name, bitLWW)
+	}
+	kvsm.cRouter.RegisterResolver("bexpire", bitLWW)
+	kvsm.cRouter.RegisterResolver("bpersist", bitLWW)
+	// hash
+	hashLWW := kvsm.lwwResolver(rockredis.HashType, false)
+	kvsm.cRouter.RegisterResolver("hset", kvsm.resolveHashKFV)
+	kvsm.cRouter.RegisterResolver("hsetnx", kvsm.resolveHashKFV)
+	kvsm.cRouter.RegisterResolver("hmset", kvsm.resolveHashKFV)
+	kvsm.cRouter.RegisterResolver("hdel", kvsm.resolveHashKFF)
+	kvsm.cRouter.RegisterResolver("hincrby", kvsm.resolveHashCounter)
+	kvsm.cRouter.RegisterResolver("hincrbyfloat", kvsm.resolveHashCounter)
+	kvsm.cRouter.RegisterResolver("hclear", hashLWW)
+	kvsm.cRouter.RegisterResolver("hexpire", hashLWW)
+	kvsm.cRouter.RegisterResolver("hpersist", hashLWW)
+	// list, the local writes depending on the list position are denied in the active-active mode
+	listLWW := kvsm.lwwResolver(rockredis.ListType, false)
+	kvsm.cRouter.RegisterResolver("lpop", listLWW)
+	kvsm.cRouter.RegisterResolver("lpush", listLWW)
+	kvsm.cRouter.RegisterResolver("lset", listLWW)
+	kvsm.cRouter.RegisterResolver("ltrim", listLWW)
+	kvsm.cRouter.RegisterResolver("rpop", listLWW)
+	kvsm.cRouter.RegisterResolver("rpush", listLWW)
+	kvsm.cRouter.RegisterResolver("rpoplpush", kvsm.resolveListMove)
+	kvsm.cRouter.RegisterResolver("lmove", kvsm.resolveListMove)
+	kvsm.cRouter.RegisterResolver("lrem", listLWW)
+	kvsm.cRouter.RegisterResolver("linsert", listLWW)
+	kvsm.cRouter.RegisterResolver("lclear", listLWW)
+	kvsm.cRouter.RegisterResolver("lexpire", listLWW)
+	kvsm.cRouter.RegisterResolver("lpersist", listLWW)
+	// zset, the members are resolved by the timestamps of each member
+	zsetLWW := kvsm.lwwResolver(rockredis.ZSetType, false)
+	kvsm.cRouter.RegisterResolver("zadd", kvsm.memberResolver(rockredis.ZSetType, 2, 1))
+	kvsm.cRouter.RegisterResolver("geoadd", kvsm.mergeResolver(rockredis.ZSetType))
+	kvsm.cRouter.RegisterResolver("zincrby", kvsm.mergeResolver(rockredis.ZSetType))
+	kvsm.cRouter.RegisterResolver("zrem", kvsm.memberResolver(rockredis.ZSetType, 1, 0))
+	kvsm.cRouter.RegisterResolver("zremrangebyrank", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zremrangebyscore", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zremrangebylex", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zclear", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zexpire", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zpersist", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zpopmin", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zpopmax", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zunionstore", zsetLWW)
+	kvsm.cRouter.RegisterResolver("zinterstore", zsetLWW)
+	// set
+	setLWW := kvsm.lwwResolver(rockredis.SetType, false)
+	kvsm.cRouter.RegisterResolver("sadd", kvsm.memberResolver(rockredis.SetType, 1, 0))
+	kvsm.cRouter.RegisterResolver("srem", kvsm.memberResolver(rockredis.SetType, 1, 0))
+	kvsm.cRouter.RegisterResolver("spop", setLWW)
+	kvsm.cRouter.RegisterResolver("smove", kvsm.resolveSetMove)
+	kvsm.cRouter.RegisterResolver("sinterstore", setLWW)
+	kvsm.cRouter.RegisterResolver("sunionstore", setLWW)
+	kvsm.cRouter.RegisterResolver("sdiffstore", setLWW)
+	kvsm.cRouter.RegisterResolver("sclear", setLWW)
+	kvsm.cRouter.RegisterResolver("sexpire", setLWW)
+	kvsm.cRouter.RegisterResolver("spersist", setLWW)
+	// stream
+	streamLWW := kvsm.lwwResolver(rockredis.StreamType, false)
+	kvsm.cRouter.RegisterResolver("xadd", streamLWW)
+	kvsm.cRouter.RegisterResolver("xdel", streamLWW)
+	kvsm.cRouter.RegisterResolver("xtrim", streamLWW)
+	kvsm.cRouter.RegisterResolver("xclear", streamLWW)
+	kvsm.cRouter.RegisterResolver("xexpire", streamLWW)
+	kvsm.cRouter.RegisterResolver("xpersist", streamLWW)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/youzan/ZanRedisDB/engine"
 	"github.com/youzan/ZanRedisDB/pkg/idutil"
 	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/raft"
 	"github.com/youzan/ZanRedisDB/rockredis"
 )
 
@@ -129,3 +130,66 @@ func BenchmarkRequestMarshal(b *testing.B) {
 		}
 	})
 }
+
+type readIndexRecorder struct {
+	*nodeRecorder
+	reqC chan []byte
+}
+
+func (n *readIndexRecorder) ReadIndex(ctx context.Context, rctx []byte) error {
+	n.reqC <- rctx
+	return nil
+}
+
+func TestReadIndexWaitApply(t *testing.T) {
+	rn := &readIndexRecorder{nodeRecorder: newNodeRecorder(), reqC: make(chan []byte, 1)}
+	nd := &KVNode{
+		rn: &raftNode{
+			config:     &RaftConfig{GroupID: 1, GroupName: "testgroup", ID: 1},
+			node:       rn,
+			readStateC: make(chan raft.ReadState, 3),
+			reqIDGen:   idutil.NewGenerator(uint16(1), time.Now()),
+		},
+		stopChan:     make(chan struct{}),
+		readWaitC:    make(chan struct{}, 1),
+		readNotifier: newNotifier(),
+		applyWait:    wait.NewTimeList(),
+	}
+	defer close(nd.stopChan)
+	go nd.readIndexLoop()
+	nd.SetAppliedIndex(5)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- nd.WaitReadIndex(context.Background())
+	}()
+	rctx := <-rn.reqC
+	// the follower has not applied the read index from leader yet
+	nd.rn.readStateC <- raft.ReadState{Index: 10, RequestCtx: rctx}
+	select {
+	case <-done:
+		t.Fatalf("the read should wait until the read index applied")
+	case <-time.After(time.Millisecond * 500):
+	}
+	nd.SetAppliedIndex(10)
+	nd.applyWait.Trigger(10)
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatalf("the read should be done after the read index applied")
+	}
+
+	// no need to wait if already applied
+	go func() {
+		done <- nd.WaitReadIndex(context.Background())
+	}()
+	rctx = <-rn.reqC
+	nd.rn.readStateC <- raft.ReadState{Index: 8, RequestCtx: rctx}
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatalf("the read should be done since the read index already applied")
+	}
+}
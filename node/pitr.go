@@ -0,0 +1,250 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/rockredis"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+const (
+	restoreSeedInfoFile = "restore_seed"
+)
+
+var (
+	errRestoreTargetMissing   = errors.New("the target raft index or timestamp for restore is missing")
+	errRestoreNoCheckpoint    = errors.New("no checkpoint found before the restore target")
+	errRestoreDataDirExist    = errors.New("the data dir for restore already exist")
+	errRestoreRemoteSnapApply = errors.New("the remote snapshot applied after the checkpoint, restore from the later checkpoint")
+)
+
+// RestoreInfo is saved in the data dir of the restored partition, the restored data
+// will be kept while the partition is started until the first snapshot saved.
+type RestoreInfo struct {
+	SrcDataDir      string `json:"src_data_dir"`
+	CheckpointTerm  uint64 `json:"checkpoint_term"`
+	CheckpointIndex uint64 `json:"checkpoint_index"`
+	Term            uint64 `json:"term"`
+	Index           uint64 `json:"index"`
+	Timestamp       int64  `json:"timestamp"`
+}
+
+func getRestoreSeedInfoFileName(dataDir string) string {
+	return path.Join(dataDir, restoreSeedInfoFile)
+}
+
+func (s *KVStore) isRestoreSeeding() bool {
+	_, err := os.Stat(getRestoreSeedInfoFileName(s.opts.DataDir))
+	return err == nil
+}
+
+func (s *KVStore) clearRestoreSeed() {
+	fileName := getRestoreSeedInfoFileName(s.opts.DataDir)
+	if _, err := os.Stat(fileName); err != nil {
+		return
+	}
+	nodeLog.Infof("the store %v clear restore seed info since snapshot saved", s.opts.DataDir)
+	os.Remove(fileName)
+}
+
+// find the last archived raft index before the timestamp
+func findRaftArchiveIndexByTime(archiveDir string, ts int64) (uint64, error) {
+	index := uint64(0)
+	err := readRaftArchive(archiveDir, 0, func(rl *syncerpb.RaftLogData) (bool, error) {
+		// the logs without data (conf change and so on) have no timestamp
+		if rl.RaftTimestamp > ts {
+			return false, nil
+		}
+		index = rl.Index
+		return true, nil
+	})
+	return index, err
+}
+
+func copyCheckpoint(src string, dst string) error {
+	return filepath.Walk(src, func(fn string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, fn)
+		if err != nil {
+			return err
+		}
+		// the checkpoint files will never be changed, so hard link is enough
+		return common.CopyFileForHardLink(fn, filepath.Join(dst, rel))
+	})
+}
+
+// RestorePointInTime restore the data of the partition to the raft index or the
+// timestamp (the smaller one if both given) from the local checkpoints in the source data
+// dir and the archived raft logs under the archive root dir (the default root is used if
+// empty). The restored data is written to the data dir in kvOpts which should be a new
+// partition data dir.
+func RestorePointInTime(kvOpts *KVOptions, srcDataDir string, archiveRoot string, toIndex uint64, toTs int64,
+	stop chan struct{}) (*RestoreInfo, error) {
+	if toIndex == 0 && toTs <= 0 {
+		return nil, errRestoreTargetMissing
+	}
+	if _, err := os.Stat(kvOpts.DataDir); err == nil {
+		return nil, errRestoreDataDirExist
+	}
+	archiveDir := getRaftArchiveDir(archiveRoot, srcDataDir)
+	targetIndex := toIndex
+	if toTs > 0 {
+		index, err := findRaftArchiveIndexByTime(archiveDir, toTs)
+		if err != nil {
+			return nil, err
+		}
+		if targetIndex == 0 || index < targetIndex {
+			targetIndex = index
+		}
+	}
+	nodeLog.Infof("restore %v to raft index: %v (%v, %v)", srcDataDir, targetIndex, toIndex, toTs)
+
+	srcBackupDir := rockredis.GetBackupDir(srcDataDir)
+	ckName := rockredis.GetLatestCheckpoint(srcBackupDir, 0, func(name string) bool {
+		_, index, err := parseCheckpointName(path.Base(name))
+		return err == nil && index <= targetIndex
+	})
+	if ckName == "" {
+		return nil, errRestoreNoCheckpoint
+	}
+	ckTerm, ckIndex, err := parseCheckpointName(path.Base(ckName))
+	if err != nil {
+		return nil, err
+	}
+	info := &RestoreInfo{
+		SrcDataDir:      srcDataDir,
+		CheckpointTerm:  ckTerm,
+		CheckpointIndex: ckIndex,
+		Term:            ckTerm,
+		Index:           ckIndex,
+	}
+	nodeLog.Infof("restore %v from checkpoint: %v", srcDataDir, ckName)
+
+	// restore to the temp dir first, and rename to the data dir only if all done
+	dstDataDir := kvOpts.DataDir
+	tmpDir := dstDataDir + "-restoring"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	dstBackupDir := rockredis.GetBackupDir(tmpDir)
+	err = copyCheckpoint(ckName, path.Join(dstBackupDir, path.Base(ckName)))
+	if err != nil {
+		return nil, err
+	}
+	opts := *kvOpts
+	opts.DataDir = tmpDir
+	sm, err := NewKVStoreSM(&opts, MachineConfig{}, 0, path.Base(dstDataDir), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sm.w = wait.New()
+	err = sm.store.Restore(ckTerm, ckIndex)
+	if err != nil {
+		sm.Close()
+		return nil, err
+	}
+	err = replayRaftArchive(sm, archiveDir, info, targetIndex, stop)
+	sm.Close()
+	if err != nil {
+		return nil, err
+	}
+	// the checkpoint from the source partition should not be used by the new partition
+	os.RemoveAll(dstBackupDir)
+
+	d, _ := json.Marshal(info)
+	err = ioutil.WriteFile(getRestoreSeedInfoFileName(tmpDir), d, common.FILE_PERM)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmpDir, dstDataDir)
+	if err != nil {
+		return nil, err
+	}
+	nodeLog.Infof("restore %v to %v done: %v", srcDataDir, dstDataDir, string(d))
+	return info, nil
+}
+
+func replayRaftArchive(sm *kvStoreSM, archiveDir string, info *RestoreInfo,
+	targetIndex uint64, stop chan struct{}) error {
+	if targetIndex <= info.Index {
+		return nil
+	}
+	err := readRaftArchive(archiveDir, info.Index+1, func(rl *syncerpb.RaftLogData) (bool, error) {
+		if rl.Index <= info.Index {
+			return true, nil
+		}
+		if rl.Index > targetIndex {
+			return false, nil
+		}
+		select {
+		case <-stop:
+			return false, common.ErrStopped
+		default:
+		}
+		if rl.Index != info.Index+1 {
+			return false, fmt.Errorf("%v: expect %v, got %v", errRaftArchiveGap, info.Index+1, rl.Index)
+		}
+		if len(rl.Data) > 0 {
+			var reqList BatchInternalRaftRequest
+			err := reqList.Unmarshal(rl.Data)
+			if err != nil {
+				return false, err
+			}
+			skip, err := checkRestoreCustomRequest(reqList)
+			if err != nil {
+				return false, fmt.Errorf("%v at %v-%v", err, rl.Term, rl.Index)
+			}
+			if !skip {
+				batch := sm.GetBatchOperator()
+				_, err = sm.ApplyRaftRequest(true, batch, reqList, rl.Term, rl.Index, stop)
+				batch.CommitBatch()
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+		info.Term = rl.Term
+		info.Index = rl.Index
+		if rl.RaftTimestamp > 0 {
+			info.Timestamp = rl.RaftTimestamp
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if info.Index < targetIndex {
+		return fmt.Errorf("%v: archived logs end at %v before target %v", errRaftArchiveGap, info.Index, targetIndex)
+	}
+	return nil
+}
+
+// the custom requests which depend on the remote data can not be replayed
+func checkRestoreCustomRequest(reqList BatchInternalRaftRequest) (bool, error) {
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(CustomReq) {
+			continue
+		}
+		var p customProposeData
+		err := json.Unmarshal(req.Data, &p)
+		if err != nil {
+			return false, err
+		}
+		switch p.ProposeOp {
+		case ProposeOp_TransferRemoteSnap:
+			return true, nil
+		case ProposeOp_ApplyRemoteSnap:
+			return false, errRestoreRemoteSnapApply
+		}
+	}
+	return false, nil
+}
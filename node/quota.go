@@ -0,0 +1,287 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+
+	ps "github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrQuotaExceeded indicated the request is refused since the namespace or table quota is exceeded.
+var ErrQuotaExceeded = errors.New("QUOTA exceeded")
+
+const quotaUsageRefreshInterval = time.Second * 5
+
+const (
+	quotaTypeKeys      = "max_keys"
+	quotaTypeDiskBytes = "max_disk_bytes"
+	quotaTypeReadQPS   = "max_read_qps"
+	quotaTypeWriteQPS  = "max_write_qps"
+)
+
+// the write commands which only free the data, they are allowed even
+// the keys or disk bytes quota is exceeded.
+var quotaFreeCmds map[string]bool
+
+func init() {
+	quotaFreeCmds = make(map[string]bool, 40)
+	for _, cmd := range []string{
+		"del", "delifeq", "bitclear",
+		"hdel", "hclear", "json.del", "json.arrpop",
+		"lpop", "rpop", "ltrim", "lclear",
+		"zrem", "zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zclear", "zpopmin", "zpopmax",
+		"spop", "srem", "sclear",
+		"xdel", "xtrim", "xclear", "xgroupdestroy",
+		"expire", "hexpire", "lexpire", "sexpire", "zexpire", "bexpire", "xexpire",
+	} {
+		quotaFreeCmds[cmd] = true
+	}
+}
+
+type quotaUsage struct {
+	keys      int64
+	diskBytes int64
+}
+
+// count the requests in the current second
+type qpsCounter struct {
+	sec int64
+	cnt int64
+}
+
+func (qc *qpsCounter) incr(sec int64) int64 {
+	if qc.sec != sec {
+		qc.sec = sec
+		qc.cnt = 0
+	}
+	qc.cnt++
+	return qc.cnt
+}
+
+// quotaChecker check the keys, disk bytes and qps quota for the namespace partition. The
+// namespace quota is divided to each partition since the partition only knows the local usage,
+// so it is approximate if the data is not well distributed.
+type quotaChecker struct {
+	ns          string
+	mutex       sync.Mutex
+	enabled     bool
+	nsLimit     common.QuotaLimit
+	tableLimits map[string]common.QuotaLimit
+	nsUsage     quotaUsage
+	tableUsages map[string]quotaUsage
+	nsReads     qpsCounter
+	nsWrites    qpsCounter
+	tableReads  map[string]*qpsCounter
+	tableWrites map[string]*qpsCounter
+	// refresh the usage immediately, such as the partition become leader
+	refreshC chan struct{}
+}
+
+func newQuotaChecker(ns string) *quotaChecker {
+	return &quotaChecker{
+		ns:          ns,
+		tableUsages: make(map[string]quotaUsage),
+		tableReads:  make(map[string]*qpsCounter),
+		tableWrites: make(map[string]*qpsCounter),
+		refreshC:    make(chan struct{}, 1),
+	}
+}
+
+func (qc *quotaChecker) setQuota(quota *common.NamespaceQuota, partitionNum int) {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	if quota.IsEmpty() {
+		qc.enabled = false
+		qc.nsLimit = common.QuotaLimit{}
+		qc.tableLimits = nil
+		return
+	}
+	qc.enabled = true
+	qc.nsLimit = quota.QuotaLimit.PerPartition(partitionNum)
+	qc.tableLimits = make(map[string]common.QuotaLimit, len(quota.Tables))
+	for t, l := range quota.Tables {
+		qc.tableLimits[t] = l.PerPartition(partitionNum)
+	}
+}
+
+func (qc *quotaChecker) isEnabled() bool {
+	qc.mutex.Lock()
+	e := qc.enabled
+	qc.mutex.Unlock()
+	return e
+}
+
+func (qc *quotaChecker) triggerRefresh() {
+	select {
+	case qc.refreshC <- struct{}{}:
+	default:
+	}
+}
+
+func (qc *quotaChecker) updateUsage(nsUsage quotaUsage, tableUsages map[string]quotaUsage) {
+	qc.mutex.Lock()
+	qc.nsUsage = nsUsage
+	qc.tableUsages = tableUsages
+	qc.mutex.Unlock()
+}
+
+func (qc *quotaChecker) check(now time.Time, cmd string, table string, isWrite bool) error {
+	var tables []string
+	if table != "" {
+		tables = []string{table}
+	}
+	return qc.checkCmds(now, []string{cmd}, tables, isWrite)
+}
+
+// check the quota once for the commands handled together, the namespace qps is counted once
+// and the qps of each table is counted once no matter how many keys in the table.
+func (qc *quotaChecker) checkCmds(now time.Time, cmds []string, tables []string, isWrite bool) error {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	if !qc.enabled {
+		return nil
+	}
+	sec := now.Unix()
+	// the keys and disk quota is ignored only if all the commands free the data
+	free := true
+	for _, cmd := range cmds {
+		if !quotaFreeCmds[cmd] {
+			free = false
+			break
+		}
+	}
+	var err error
+	if isWrite {
+		err = qc.checkWrite(sec, free, "", qc.nsLimit, qc.nsUsage, &qc.nsWrites)
+	} else {
+		err = qc.checkRead(sec, "", qc.nsLimit, &qc.nsReads)
+	}
+	if err != nil {
+		return err
+	}
+	for i, table := range tables {
+		if table == "" || hasTableBefore(tables, i) {
+			continue
+		}
+		tl, ok := qc.tableLimits[table]
+		if !ok {
+			continue
+		}
+		if isWrite {
+			cnt, ok := qc.tableWrites[table]
+			if !ok {
+				cnt = &qpsCounter{}
+				qc.tableWrites[table] = cnt
+			}
+			err = qc.checkWrite(sec, free, table, tl, qc.tableUsages[table], cnt)
+		} else {
+			cnt, ok := qc.tableReads[table]
+			if !ok {
+				cnt = &qpsCounter{}
+				qc.tableReads[table] = cnt
+			}
+			err = qc.checkRead(sec, table, tl, cnt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasTableBefore(tables []string, i int) bool {
+	for _, t := range tables[:i] {
+		if t == tables[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (qc *quotaChecker) checkWrite(sec int64, free bool, table string, limit common.QuotaLimit,
+	usage quotaUsage, cnt *qpsCounter) error {
+	if !free {
+		if limit.MaxKeys > 0 && usage.keys >= limit.MaxKeys {
+			return qc.refuse(table, quotaTypeKeys)
+		}
+		if limit.MaxDiskBytes > 0 && usage.diskBytes >= limit.MaxDiskBytes {
+			return qc.refuse(table, quotaTypeDiskBytes)
+		}
+	}
+	if limit.MaxWriteQPS > 0 && cnt.incr(sec) > limit.MaxWriteQPS {
+		return qc.refuse(table, quotaTypeWriteQPS)
+	}
+	return nil
+}
+
+func (qc *quotaChecker) checkRead(sec int64, table string, limit common.QuotaLimit, cnt *qpsCounter) error {
+	if limit.MaxReadQPS > 0 && cnt.incr(sec) > limit.MaxReadQPS {
+		return qc.refuse(table, quotaTypeReadQPS)
+	}
+	return nil
+}
+
+func (qc *quotaChecker) refuse(table string, quotaType string) error {
+	metric.QuotaRefusedCnt.With(ps.Labels{
+		"namespace":  qc.ns,
+		"table":      table,
+		"quota_type": quotaType,
+	}).Inc()
+	if table == "" {
+		return fmt.Errorf("%s: %s of namespace %s", ErrQuotaExceeded.Error(), quotaType, qc.ns)
+	}
+	return fmt.Errorf("%s: %s of table %s in namespace %s", ErrQuotaExceeded.Error(), quotaType, table, qc.ns)
+}
+
+// CheckQuota should be called before the request proposed or handled, the table
+// can be empty if the command has no table.
+func (nd *KVNode) CheckQuota(cmd string, table string, isWrite bool) error {
+	return nd.quota.check(time.Now(), cmd, table, isWrite)
+}
+
+// CheckMultiQuota should be called once for the commands or the keys handled together on this
+// partition, such as the merged keys, the transaction and the script.
+func (nd *KVNode) CheckMultiQuota(cmds []string, tables []string, isWrite bool) error {
+	return nd.quota.checkCmds(time.Now(), cmds, tables, isWrite)
+}
+
+func (nd *KVNode) refreshQuotaUsage() {
+	if nd.store == nil || !nd.quota.isEnabled() || !nd.IsLead() {
+		return
+	}
+	tbs := nd.store.GetTables()
+	diskUsages := nd.store.GetBTablesSizes(tbs)
+	var nsUsage quotaUsage
+	tableUsages := make(map[string]quotaUsage, len(tbs))
+	for i, t := range tbs {
+		cnt, _ := nd.store.GetTableKeyCount(t)
+		if cnt <= 0 {
+			cnt = nd.store.GetTableApproximateNumInRange(string(t), nil, nil)
+		}
+		u := quotaUsage{keys: cnt, diskBytes: diskUsages[i]}
+		tableUsages[string(t)] = u
+		nsUsage.keys += u.keys
+		nsUsage.diskBytes += u.diskBytes
+	}
+	nd.quota.updateUsage(nsUsage, tableUsages)
+}
+
+func (nd *KVNode) quotaUsageLoop() {
+	ticker := time.NewTicker(quotaUsageRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			nd.refreshQuotaUsage()
+		case <-nd.quota.refreshC:
+			nd.refreshQuotaUsage()
+		case <-nd.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestQuotaChecker(t *testing.T) {
+	qc := newQuotaChecker("test-0")
+	now := time.Now()
+	assert.Nil(t, qc.check(now, "set", "t1", true))
+
+	qc.setQuota(&common.NamespaceQuota{
+		QuotaLimit: common.QuotaLimit{MaxKeys: 100, MaxReadQPS: 4},
+		Tables: map[string]common.QuotaLimit{
+			"t1": {MaxDiskBytes: 1000, MaxWriteQPS: 4},
+		},
+	}, 2)
+	assert.True(t, qc.isEnabled())
+
+	// the qps limit is divided to each partition
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, qc.check(now, "set", "t1", true))
+		assert.Nil(t, qc.check(now, "get", "t2", false))
+	}
+	err := qc.check(now, "set", "t1", true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrQuotaExceeded.Error())
+	assert.Contains(t, err.Error(), quotaTypeWriteQPS)
+	assert.NotNil(t, qc.check(now, "get", "t2", false))
+	// other table has no write qps limit
+	assert.Nil(t, qc.check(now, "set", "t2", true))
+	// the counter is reset in the next second
+	now = now.Add(time.Second)
+	assert.Nil(t, qc.check(now, "set", "t1", true))
+	assert.Nil(t, qc.check(now, "get", "t2", false))
+
+	qc.updateUsage(quotaUsage{keys: 10, diskBytes: 600},
+		map[string]quotaUsage{"t1": {keys: 5, diskBytes: 500}, "t2": {keys: 5, diskBytes: 100}})
+	now = now.Add(time.Second)
+	err = qc.check(now, "set", "t1", true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), quotaTypeDiskBytes)
+	// the write to free the data is allowed
+	assert.Nil(t, qc.check(now, "del", "t1", true))
+	assert.Nil(t, qc.check(now, "set", "t2", true))
+
+	qc.updateUsage(quotaUsage{keys: 50, diskBytes: 600}, nil)
+	err = qc.check(now, "set", "t2", true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), quotaTypeKeys)
+	assert.Nil(t, qc.check(now, "hdel", "t2", true))
+
+	// remove the quota
+	qc.setQuota(nil, 2)
+	assert.False(t, qc.isEnabled())
+	assert.Nil(t, qc.check(now, "set", "t2", true))
+}
+
+func TestQuotaCheckCmds(t *testing.T) {
+	qc := newQuotaChecker("test-0")
+	now := time.Now()
+	qc.setQuota(&common.NamespaceQuota{
+		QuotaLimit: common.QuotaLimit{MaxWriteQPS: 2},
+		Tables: map[string]common.QuotaLimit{
+			"t1": {MaxKeys: 10, MaxWriteQPS: 2},
+		},
+	}, 1)
+	// the qps is counted once for all the keys in the same table
+	assert.Nil(t, qc.checkCmds(now, []string{"mset"}, []string{"t1", "t1", "t2"}, true))
+	assert.Nil(t, qc.checkCmds(now, []string{"mset"}, []string{"t1", "t2", "t1"}, true))
+	err := qc.checkCmds(now, []string{"mset"}, []string{"t1"}, true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), quotaTypeWriteQPS)
+
+	now = now.Add(time.Second)
+	qc.updateUsage(quotaUsage{}, map[string]quotaUsage{"t1": {keys: 10}})
+	// the transaction is refused if any command is not free
+	err = qc.checkCmds(now, []string{"del", "set"}, []string{"t1"}, true)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), quotaTypeKeys)
+	assert.Nil(t, qc.checkCmds(now, []string{"del", "hdel"}, []string{"t1"}, true))
+
+	qc.triggerRefresh()
+	qc.triggerRefresh()
+	assert.Equal(t, 1, len(qc.refreshC))
+}
@@ -0,0 +1,384 @@
+package node
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+const (
+	raftArchiveDirName     = "raft_archive"
+	raftArchiveFileSuffix  = ".archive"
+	raftArchiveSegmentSize = 64 * 1024 * 1024
+	raftArchiveHeaderLen   = 8
+	raftArchiveBufferSize  = 256 * 1024
+	// the default hours to keep the archived logs
+	defaultRaftArchiveKeepHours = 24 * 3
+)
+
+var (
+	errRaftArchiveCorrupt = errors.New("raft log archive is corrupt")
+	errRaftArchiveGap     = errors.New("raft log archive is not continuous")
+)
+
+var raftArchiveCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// the archived raft logs of the partition are saved under the archive root dir, and the
+// default root is the raft_archive dir under the data root dir. The archive is kept out
+// of the checkpoint dir, so the retention is not limited by the checkpoint rotation.
+func getRaftArchiveDir(archiveRoot string, dataDir string) string {
+	if archiveRoot == "" {
+		archiveRoot = path.Join(path.Dir(dataDir), raftArchiveDirName)
+	}
+	return path.Join(archiveRoot, path.Base(dataDir))
+}
+
+type raftArchiveSegment struct {
+	firstIndex uint64
+	fileName   string
+}
+
+// list the archive segments sorted by the first raft index in each segment
+func listRaftArchiveSegments(dir string) ([]raftArchiveSegment, error) {
+	fileList, err := filepath.Glob(path.Join(dir, "*"+raftArchiveFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]raftArchiveSegment, 0, len(fileList))
+	for _, fn := range fileList {
+		name := strings.TrimSuffix(path.Base(fn), raftArchiveFileSuffix)
+		index, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			nodeLog.Infof("ignore invalid raft archive file: %v", fn)
+			continue
+		}
+		segs = append(segs, raftArchiveSegment{firstIndex: index, fileName: fn})
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].firstIndex < segs[j].firstIndex
+	})
+	return segs, nil
+}
+
+// read the raft logs in the segment file, return the offset after the last valid log.
+// The partial log at the end of file is ignored since it may be not flushed while crashed.
+func readRaftArchiveFile(fileName string, fn func(*syncerpb.RaftLogData) (bool, error)) (int64, bool, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, raftArchiveBufferSize)
+	var header [raftArchiveHeaderLen]byte
+	var buf []byte
+	offset := int64(0)
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, true, nil
+		}
+		if err != nil {
+			return offset, false, err
+		}
+		dataLen := int(binary.BigEndian.Uint32(header[:4]))
+		crc := binary.BigEndian.Uint32(header[4:])
+		if cap(buf) < dataLen {
+			buf = make([]byte, dataLen)
+		}
+		buf = buf[:dataLen]
+		_, err = io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, true, nil
+		}
+		if err != nil {
+			return offset, false, err
+		}
+		if crc32.Checksum(buf, raftArchiveCRCTable) != crc {
+			return offset, false, fmt.Errorf("%v: %v at offset %v", errRaftArchiveCorrupt, fileName, offset)
+		}
+		var rl syncerpb.RaftLogData
+		err = rl.Unmarshal(buf)
+		if err != nil {
+			return offset, false, err
+		}
+		offset += int64(raftArchiveHeaderLen + dataLen)
+		cont, err := fn(&rl)
+		if err != nil || !cont {
+			return offset, false, err
+		}
+	}
+}
+
+// iterate the archived raft logs from the segment which may contain the start index,
+// the iteration is stopped if the callback return false or error.
+func readRaftArchive(dir string, startIndex uint64, fn func(*syncerpb.RaftLogData) (bool, error)) error {
+	segs, err := listRaftArchiveSegments(dir)
+	if err != nil {
+		return err
+	}
+	for i, seg := range segs {
+		if i+1 < len(segs) && segs[i+1].firstIndex <= startIndex {
+			continue
+		}
+		_, cont, err := readRaftArchiveFile(seg.fileName, fn)
+		if err != nil {
+			return err
+		}
+		if !cont {
+			return nil
+		}
+	}
+	return nil
+}
+
+// copy the archive segments which contain the raft logs in [startIndex, endIndex] to the dir, the
+// segments are copied instead of linked since the last segment may be still appending.
+func copyRaftArchive(archiveDir string, startIndex uint64, endIndex uint64, dstDir string) error {
+	segs, err := listRaftArchiveSegments(archiveDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dstDir, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	for i, seg := range segs {
+		if i+1 < len(segs) && segs[i+1].firstIndex <= startIndex {
+			continue
+		}
+		if seg.firstIndex > endIndex {
+			break
+		}
+		err = common.CopyFile(seg.fileName, path.Join(dstDir, path.Base(seg.fileName)), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raftLogArchiver append the committed raft logs to the archive segment files, and
+// the segments older than the keep time will be purged while rotating.
+type raftLogArchiver struct {
+	sync.Mutex
+	dir       string
+	grpName   string
+	keep      time.Duration
+	f         *os.File
+	w         *bufio.Writer
+	fileSize  int64
+	lastIndex uint64
+	buf       []byte
+}
+
+func newRaftLogArchiver(dir string, grpName string, keepHours int) (*raftLogArchiver, error) {
+	if keepHours <= 0 {
+		keepHours = defaultRaftArchiveKeepHours
+	}
+	ra := &raftLogArchiver{
+		dir:     dir,
+		grpName: grpName,
+		keep:    time.Duration(keepHours) * time.Hour,
+	}
+	err := os.MkdirAll(ra.dir, common.DIR_PERM)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := listRaftArchiveSegments(ra.dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		return ra, nil
+	}
+	last := segs[len(segs)-1]
+	offset, _, err := readRaftArchiveFile(last.fileName, func(rl *syncerpb.RaftLogData) (bool, error) {
+		ra.lastIndex = rl.Index
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(last.fileName, os.O_RDWR, common.FILE_PERM)
+	if err != nil {
+		return nil, err
+	}
+	// remove the partial log at the end
+	err = f.Truncate(offset)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ra.f = f
+	ra.w = bufio.NewWriterSize(f, raftArchiveBufferSize)
+	ra.fileSize = offset
+	nodeLog.Infof("%v raft log archive opened at %v, last index: %v", grpName, last.fileName, ra.lastIndex)
+	return ra, nil
+}
+
+func (ra *raftLogArchiver) closeSegment() error {
+	if ra.f == nil {
+		return nil
+	}
+	err := ra.w.Flush()
+	if err == nil {
+		err = ra.f.Sync()
+	}
+	ra.f.Close()
+	ra.f = nil
+	ra.w = nil
+	ra.fileSize = 0
+	return err
+}
+
+func (ra *raftLogArchiver) rotate(index uint64) error {
+	err := ra.closeSegment()
+	if err != nil {
+		return err
+	}
+	fileName := path.Join(ra.dir, fmt.Sprintf("%016x%s", index, raftArchiveFileSuffix))
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	ra.f = f
+	ra.w = bufio.NewWriterSize(f, raftArchiveBufferSize)
+	ra.purge()
+	return nil
+}
+
+// purge the segments which are not written in the keep time, the last segment
+// is always kept since it may be still appending.
+func (ra *raftLogArchiver) purge() {
+	segs, err := listRaftArchiveSegments(ra.dir)
+	if err != nil {
+		return
+	}
+	expired := time.Now().Add(-1 * ra.keep)
+	for i := 0; i+1 < len(segs); i++ {
+		fi, err := os.Stat(segs[i].fileName)
+		if err != nil || fi.ModTime().After(expired) {
+			break
+		}
+		nodeLog.Infof("%v purge raft log archive: %v", ra.grpName, segs[i].fileName)
+		os.Remove(segs[i].fileName)
+	}
+}
+
+// append the raft log to the archive, the log already archived will be ignored
+// while replaying after restart.
+func (ra *raftLogArchiver) append(term uint64, index uint64, ts int64, data []byte) error {
+	ra.Lock()
+	defer ra.Unlock()
+	if index <= ra.lastIndex {
+		return nil
+	}
+	if ra.f == nil || ra.fileSize >= raftArchiveSegmentSize ||
+		(ra.lastIndex > 0 && index != ra.lastIndex+1) {
+		if ra.lastIndex > 0 && index != ra.lastIndex+1 {
+			// the logs are skipped by installing the snapshot, the restore should
+			// start from the checkpoint after the gap
+			nodeLog.Infof("%v raft log archive skipped from %v to %v", ra.grpName, ra.lastIndex, index)
+		}
+		err := ra.rotate(index)
+		if err != nil {
+			return err
+		}
+	}
+	rl := syncerpb.RaftLogData{
+		Type:          syncerpb.EntryNormalRaw,
+		RaftGroupName: ra.grpName,
+		Term:          term,
+		Index:         index,
+		RaftTimestamp: ts,
+		Data:          data,
+	}
+	sz := rl.Size()
+	if cap(ra.buf) < sz+raftArchiveHeaderLen {
+		ra.buf = make([]byte, sz+raftArchiveHeaderLen)
+	}
+	buf := ra.buf[:sz+raftArchiveHeaderLen]
+	_, err := rl.MarshalTo(buf[raftArchiveHeaderLen:])
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], uint32(sz))
+	binary.BigEndian.PutUint32(buf[4:raftArchiveHeaderLen], crc32.Checksum(buf[raftArchiveHeaderLen:], raftArchiveCRCTable))
+	_, err = ra.w.Write(buf)
+	if err != nil {
+		// the next log will be written to the new segment after the gap
+		ra.closeSegment()
+		return err
+	}
+	ra.fileSize += int64(len(buf))
+	ra.lastIndex = index
+	return nil
+}
+
+// flush the buffered logs to disk, should be called before the raft logs compacted
+func (ra *raftLogArchiver) flush() error {
+	ra.Lock()
+	defer ra.Unlock()
+	if ra.f == nil {
+		return nil
+	}
+	err := ra.w.Flush()
+	if err != nil {
+		return err
+	}
+	return ra.f.Sync()
+}
+
+// reset will remove all the archived logs, the raft logs will start from the
+// beginning after the data is cleaned.
+func (ra *raftLogArchiver) reset() error {
+	ra.Lock()
+	defer ra.Unlock()
+	ra.closeSegment()
+	ra.lastIndex = 0
+	nodeLog.Infof("%v raft log archive is reset", ra.grpName)
+	err := os.RemoveAll(ra.dir)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(ra.dir, common.DIR_PERM)
+}
+
+func (ra *raftLogArchiver) close() error {
+	ra.Lock()
+	defer ra.Unlock()
+	return ra.closeSegment()
+}
+
+func parseCheckpointName(name string) (uint64, uint64, error) {
+	subs := strings.Split(name, "-")
+	if len(subs) != 2 {
+		return 0, 0, errors.New("invalid checkpoint name: " + name)
+	}
+	term, err := strconv.ParseUint(subs[0], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	index, err := strconv.ParseUint(subs[1], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return term, index, nil
+}
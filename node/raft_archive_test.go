@@ -0,0 +1,253 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/wait"
+	"github.com/youzan/ZanRedisDB/rockredis"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+func readAllArchivedIndex(t *testing.T, dir string, start uint64) []uint64 {
+	indexes := make([]uint64, 0)
+	err := readRaftArchive(dir, start, func(rl *syncerpb.RaftLogData) (bool, error) {
+		indexes = append(indexes, rl.Index)
+		return true, nil
+	})
+	assert.Nil(t, err)
+	return indexes
+}
+
+func TestRaftLogArchiver(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("archive-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	dir := getRaftArchiveDir("", path.Join(tmpDir, "test-0"))
+	assert.Equal(t, path.Join(tmpDir, raftArchiveDirName, "test-0"), dir)
+	ra, err := newRaftLogArchiver(dir, "test-0", 0)
+	assert.Nil(t, err)
+	for i := uint64(1); i <= 10; i++ {
+		err = ra.append(1, i, int64(i), []byte("data"))
+		assert.Nil(t, err)
+	}
+	// duplicate while replaying should be ignored
+	err = ra.append(1, 5, 5, []byte("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, ra.close())
+
+	// reopen and continue with a partial log at the end
+	segs, err := listRaftArchiveSegments(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(segs))
+	f, err := os.OpenFile(segs[0].fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	f.Write([]byte{0, 0, 0, 100, 1})
+	f.Close()
+	ra, err = newRaftLogArchiver(dir, "test-0", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), ra.lastIndex)
+	err = ra.append(1, 11, 11, nil)
+	assert.Nil(t, err)
+	// gap by installing snapshot should start a new segment
+	err = ra.append(2, 20, 20, []byte("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, ra.flush())
+
+	segs, err = listRaftArchiveSegments(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(segs))
+	assert.Equal(t, uint64(20), segs[1].firstIndex)
+	indexes := readAllArchivedIndex(t, dir, 0)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 20}, indexes)
+	indexes = readAllArchivedIndex(t, dir, 20)
+	assert.Equal(t, []uint64{20}, indexes)
+	index, err := findRaftArchiveIndexByTime(dir, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), index)
+
+	// the segment not written in the keep time should be purged even no checkpoint
+	err = ra.append(2, 22, 22, nil)
+	assert.Nil(t, err)
+	expired := time.Now().Add(-2 * ra.keep)
+	assert.Nil(t, os.Chtimes(segs[0].fileName, expired, expired))
+	ra.Lock()
+	err = ra.rotate(23)
+	ra.Unlock()
+	assert.Nil(t, err)
+	segs, err = listRaftArchiveSegments(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(segs))
+	assert.Equal(t, uint64(20), segs[0].firstIndex)
+
+	assert.Nil(t, ra.reset())
+	assert.Equal(t, uint64(0), ra.lastIndex)
+	indexes = readAllArchivedIndex(t, dir, 0)
+	assert.Equal(t, 0, len(indexes))
+	ra.close()
+}
+
+func applyTestRedisReq(t *testing.T, sm *kvStoreSM, term uint64, index uint64, ts int64, args ...string) {
+	cargs := make([][]byte, 0, len(args))
+	for _, a := range args {
+		cargs = append(cargs, []byte(a))
+	}
+	var reqList BatchInternalRaftRequest
+	reqList.Timestamp = ts
+	reqList.ReqNum = 1
+	reqList.Reqs = append(reqList.Reqs, InternalRaftRequest{
+		Header: RequestHeader{DataType: int32(RedisReq), Timestamp: ts},
+		Data:   buildCommand(cargs).Raw,
+	})
+	batch := sm.GetBatchOperator()
+	_, err := sm.ApplyRaftRequest(false, batch, reqList, term, index, nil)
+	batch.CommitBatch()
+	assert.Nil(t, err)
+}
+
+func TestRestorePointInTime(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("pitr-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	kvOpts := &KVOptions{
+		DataDir:          path.Join(tmpDir, "test-0"),
+		EngType:          rockredis.EngType,
+		ExpirationPolicy: common.LocalDeletion,
+	}
+	engine.FillDefaultOptions(&kvOpts.RockOpts)
+	sm, err := NewKVStoreSM(kvOpts, MachineConfig{RaftLogArchive: true}, 1, "test-0", nil, nil)
+	assert.Nil(t, err)
+	sm.w = wait.New()
+
+	applyTestRedisReq(t, sm, 1, 1, 100, "set", "test:k1", "v1")
+	applyTestRedisReq(t, sm, 1, 2, 200, "set", "test:k2", "v2")
+	_, err = sm.GetSnapshot(1, 2)
+	assert.Nil(t, err)
+	applyTestRedisReq(t, sm, 1, 3, 300, "set", "test:k1", "v1-new")
+	applyTestRedisReq(t, sm, 1, 4, 400, "del", "test:k2")
+	applyTestRedisReq(t, sm, 1, 5, 500, "set", "test:k3", "v3")
+	sm.Close()
+
+	restoreAndCheck := func(name string, toIndex uint64, toTs int64, expectIndex uint64, expects map[string]string) {
+		opts := *kvOpts
+		opts.DataDir = path.Join(tmpDir, name)
+		info, err := RestorePointInTime(&opts, kvOpts.DataDir, "", toIndex, toTs, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), info.CheckpointIndex)
+		assert.Equal(t, expectIndex, info.Index)
+		_, err = os.Stat(getRestoreSeedInfoFileName(opts.DataDir))
+		assert.Nil(t, err)
+
+		store, err := NewKVStore(&opts)
+		assert.Nil(t, err)
+		defer store.Close()
+		assert.True(t, store.isRestoreSeeding())
+		for k, v := range expects {
+			val, err := store.KVGet([]byte(k))
+			assert.Nil(t, err)
+			if v == "" {
+				assert.Nil(t, val)
+			} else {
+				assert.Equal(t, v, string(val))
+			}
+		}
+		// the seeded data should be kept while starting as the new raft group
+		assert.Nil(t, store.CleanData())
+		val, err := store.KVGet([]byte("test:k1"))
+		assert.Nil(t, err)
+		assert.Equal(t, expects["test:k1"], string(val))
+	}
+	restoreAndCheck("restore-index-3", 3, 0, 3, map[string]string{
+		"test:k1": "v1-new",
+		"test:k2": "v2",
+		"test:k3": "",
+	})
+	restoreAndCheck("restore-time-400", 0, 450, 4, map[string]string{
+		"test:k1": "v1-new",
+		"test:k2": "",
+		"test:k3": "",
+	})
+
+	opts := *kvOpts
+	opts.DataDir = path.Join(tmpDir, "restore-no-target")
+	_, err = RestorePointInTime(&opts, kvOpts.DataDir, "", 0, 0, nil)
+	assert.Equal(t, errRestoreTargetMissing, err)
+	// no checkpoint before index 1
+	_, err = RestorePointInTime(&opts, kvOpts.DataDir, "", 1, 0, nil)
+	assert.Equal(t, errRestoreNoCheckpoint, err)
+	// beyond the archived logs
+	_, err = RestorePointInTime(&opts, kvOpts.DataDir, "", 10, 0, nil)
+	assert.NotNil(t, err)
+	_, err = os.Stat(opts.DataDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFindBackupCut(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("backup-cut-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	dir := getRaftArchiveDir("", path.Join(tmpDir, "test-0"))
+	ra, err := newRaftLogArchiver(dir, "test-0", 0)
+	assert.Nil(t, err)
+	appendReq := func(index uint64, ts int64, dt int8, data []byte) {
+		var reqList BatchInternalRaftRequest
+		reqList.Reqs = append(reqList.Reqs, InternalRaftRequest{
+			Header: RequestHeader{DataType: int32(dt), Timestamp: ts},
+			Data:   data,
+		})
+		d, err := reqList.Marshal()
+		assert.Nil(t, err)
+		assert.Nil(t, ra.append(1, index, ts, d))
+	}
+	backupData, _ := json.Marshal(&customProposeData{ProposeOp: ProposeOp_Backup, NeedBackup: true})
+	appendReq(11, 100, RedisReq, buildCommand([][]byte{[]byte("set"), []byte("test:k1"), []byte("v1")}).Raw)
+	appendReq(12, 200, RedisReq, buildCommand([][]byte{[]byte("set"), []byte("test:k2"), []byte("v2")}).Raw)
+	// the conf change has no timestamp
+	assert.Nil(t, ra.append(1, 13, 0, nil))
+	appendReq(14, 400, CustomReq, backupData)
+	appendReq(15, 500, RedisReq, buildCommand([][]byte{[]byte("set"), []byte("test:k3"), []byte("v3")}).Raw)
+	appendReq(16, 600, CustomReq, backupData)
+	assert.Nil(t, ra.flush())
+
+	// the backup proposal is not the write after the cut
+	start, cut, hasNewer, err := findBackupCut(dir, 10, 14, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), start)
+	assert.Equal(t, uint64(14), cut)
+	assert.False(t, hasNewer)
+	_, cut, hasNewer, err = findBackupCut(dir, 10, 16, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(14), cut)
+	assert.True(t, hasNewer)
+	_, cut, hasNewer, err = findBackupCut(dir, 10, 16, 150)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), cut)
+	assert.True(t, hasNewer)
+	// the archive started after the oldest checkpoint
+	start, cut, hasNewer, err = findBackupCut(dir, 5, 16, 150)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), start)
+	assert.Equal(t, uint64(11), cut)
+	assert.True(t, hasNewer)
+	// the archive is not enough to the end
+	_, _, _, err = findBackupCut(dir, 10, 20, 1000)
+	assert.NotNil(t, err)
+
+	copyDir := path.Join(tmpDir, "copied")
+	err = copyRaftArchive(dir, 12, 14, copyDir)
+	assert.Nil(t, err)
+	indexes := readAllArchivedIndex(t, copyDir, 0)
+	assert.Equal(t, []uint64{11, 12, 13, 14, 15, 16}, indexes)
+	ra.close()
+}
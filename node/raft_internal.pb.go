@@ -53,18 +53,27 @@ const (
 	SchemaChangeAddHsetIndex    SchemaChangeType = 0
 	SchemaChangeUpdateHsetIndex SchemaChangeType = 1
 	SchemaChangeDeleteHsetIndex SchemaChangeType = 2
+	SchemaChangeAddJSONIndex    SchemaChangeType = 3
+	SchemaChangeUpdateJSONIndex SchemaChangeType = 4
+	SchemaChangeDeleteJSONIndex SchemaChangeType = 5
 )
 
 var SchemaChangeType_name = map[int32]string{
 	0: "SchemaChangeAddHsetIndex",
 	1: "SchemaChangeUpdateHsetIndex",
 	2: "SchemaChangeDeleteHsetIndex",
+	3: "SchemaChangeAddJSONIndex",
+	4: "SchemaChangeUpdateJSONIndex",
+	5: "SchemaChangeDeleteJSONIndex",
 }
 
 var SchemaChangeType_value = map[string]int32{
 	"SchemaChangeAddHsetIndex":    0,
 	"SchemaChangeUpdateHsetIndex": 1,
 	"SchemaChangeDeleteHsetIndex": 2,
+	"SchemaChangeAddJSONIndex":    3,
+	"SchemaChangeUpdateJSONIndex": 4,
+	"SchemaChangeDeleteJSONIndex": 5,
 }
 
 func (x SchemaChangeType) String() string {
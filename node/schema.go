@@ -34,6 +34,18 @@ func (kvsm *kvStoreSM) handleSchemaUpdate(sc SchemaChange) error {
 			err = kvsm.store.UpdateHsetIndexState(sc.Table, &hindex)
 		}
 		return err
+	case SchemaChangeAddJSONIndex, SchemaChangeUpdateJSONIndex, SchemaChangeDeleteJSONIndex:
+		var jindex common.JSONIndexSchema
+		err := json.Unmarshal(sc.SchemaData, &jindex)
+		if err != nil {
+			return err
+		}
+		if sc.Type == SchemaChangeAddJSONIndex {
+			err = kvsm.store.AddJSONIndex(sc.Table, &jindex)
+		} else {
+			err = kvsm.store.UpdateJSONIndexState(sc.Table, &jindex)
+		}
+		return err
 	default:
 		return errors.New("unknown schema change type")
 	}
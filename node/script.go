@@ -0,0 +1,806 @@
+package node
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	ps "github.com/prometheus/client_golang/prometheus"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/slow"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var (
+	ErrScriptNoKeys         = errors.New("ERR the keys used in the script should be declared")
+	errScriptUndeclaredKey  = errors.New("ERR the key accessed from the script is not declared in the keys")
+	errScriptDeniedCmd      = errors.New("ERR this command is not allowed from scripts")
+	errScriptUnknownCmd     = errors.New("ERR unknown command called from script")
+	errScriptWrongArgs      = errors.New("ERR wrong number of arguments for redis.call or redis.pcall")
+	errScriptInvalidArgType = errors.New("ERR lua redis() command arguments must be strings or integers")
+	errScriptTooManySteps   = errors.New("ERR script killed since running too many instructions")
+	errScriptKeyRewritten   = errors.New("ERR the key written in the script can not be accessed again")
+	errScriptInvalidRspType = errors.New("ERR invalid response type from script command")
+	errScriptStringTooLong  = errors.New("ERR the string created in the script is too long")
+)
+
+const (
+	// the instructions are counted by the lua vm instead of the wall clock, so the
+	// script is killed at the same instruction on all the replicas and while replaying.
+	scriptMaxSteps         = 50000000
+	maxScriptProtoCacheNum = 1024
+	scriptCallStackSize    = 256
+	scriptRegistrySize     = 1024 * 20
+	// the max length of the string created by string.rep, table.concat and string.format
+	scriptMaxStringLen = common.MaxValueSize
+)
+
+// the format width or precision such as %999999999s may allocate the huge memory
+var scriptFormatWidthRegexp = regexp.MustCompile(`%[-+ #0]*([0-9]*)(?:\.([0-9]*))?`)
+
+// the commands can not be called from the script. The random and the ttl commands are
+// not deterministic on the replicas, and the hyperloglog write is cached and flushed later.
+var scriptDeniedCmds = map[string]bool{
+	"pfadd":                 true,
+	"srandmember":           true,
+	"ttl":                   true,
+	"httl":                  true,
+	"lttl":                  true,
+	"sttl":                  true,
+	"zttl":                  true,
+	"bttl":                  true,
+	"xttl":                  true,
+	"stale.getexpired":      true,
+	"stale.hgetall.expired": true,
+	"stale.hmget.expired":   true,
+}
+
+// the lua functions removed from the base and math library, since they can
+// load the code from outside or are not deterministic.
+var scriptDeniedFuncs = map[string][]string{
+	lua.BaseLibName: {"dofile", "loadfile", "load", "loadstring", "require", "module",
+		"print", "_printregs", "collectgarbage", "newproxy", "getfenv", "setfenv"},
+	lua.MathLibName: {"random", "randomseed"},
+}
+
+// the raft proposal for the script, the keys should all be in the same partition
+type scriptMeta struct {
+	Script string   `json:"script"`
+	Keys   [][]byte `json:"keys,omitempty"`
+	Args   [][]byte `json:"args,omitempty"`
+}
+
+// ScriptSHA1 return the sha1 digest of the script used by evalsha
+func ScriptSHA1(script string) string {
+	d := sha1.Sum([]byte(script))
+	return hex.EncodeToString(d[:])
+}
+
+// CompileScript check the syntax and compile the script
+func CompileScript(script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), "@user_script")
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling script: %v", err)
+	}
+	proto, err := lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling script: %v", err)
+	}
+	return proto, nil
+}
+
+// EvalScript propose the script as one raft request and it will be run in the state machine
+// while applying. All the keys read or written by the script should be declared in the keys,
+// and the keys should have the namespace and be in the same partition.
+func (nd *KVNode) EvalScript(script string, keys [][]byte, args [][]byte) (*FutureRsp, error) {
+	if len(keys) == 0 {
+		return nil, ErrScriptNoKeys
+	}
+	for _, k := range keys {
+		if err := common.CheckKey(k); err != nil {
+			return nil, err
+		}
+		if _, err := common.CutNamesapce(k); err != nil {
+			return nil, err
+		}
+	}
+	// check the syntax before propose to avoid the invalid script in the raft log
+	if _, err := CompileScript(script); err != nil {
+		return nil, err
+	}
+	d, err := json.Marshal(scriptMeta{Script: script, Keys: keys, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	var reqList BatchInternalRaftRequest
+	reqList.Timestamp = start.UnixNano()
+	reqList.Reqs = append(reqList.Reqs, InternalRaftRequest{
+		Header: RequestHeader{
+			ID:        nd.rn.reqIDGen.Next(),
+			DataType:  int32(ScriptReq),
+			Timestamp: reqList.Timestamp,
+		},
+		Data: d,
+	})
+	reqList.ReqNum = 1
+	return nd.proposeInternalReqs(start, &reqList)
+}
+
+// run the script on the state machine, all the writes from the script are buffered in one
+// write batch and committed only if the script succeeds, so nothing is written if the script
+// failed. Since the command in the write batch can not read the data written by the previous
+// command, the key written in the script can not be read or written again, the same as the
+// multi exec transaction.
+func (kvsm *kvStoreSM) applyScript(isReplaying bool, fromSyncer bool, batch IBatchOperator,
+	req InternalRaftRequest, reqID uint64, reqTs int64, index uint64) {
+	var meta scriptMeta
+	err := json.Unmarshal(req.Data, &meta)
+	if err != nil {
+		kvsm.Infof("invalid script data: %v, %v", string(req.Data), err)
+		kvsm.w.Trigger(reqID, err)
+		return
+	}
+	// check all the declared keys as the multi keys delete for the split fence
+	pks := make([][]byte, 0, len(meta.Keys)+1)
+	pks = append(pks, []byte("del"))
+	for _, k := range meta.Keys {
+		pk, err := common.CutNamesapce(k)
+		if err != nil {
+			kvsm.w.Trigger(reqID, err)
+			return
+		}
+		pks = append(pks, pk)
+	}
+	if err := kvsm.checkSplitFence("del", buildCommand(pks), index); err != nil {
+		kvsm.w.Trigger(reqID, err)
+		return
+	}
+	if fromSyncer && !isReplaying && !IsSyncerOnly() {
+		for _, pk := range pks[1:] {
+			watchCmd := buildCommand([][]byte{[]byte("watch"), pk})
+			if kvsm.preCheckConflict(watchCmd, reqTs) == Conflict {
+				kvsm.Infof("conflict sync script: %v, %v", string(pk), reqTs)
+				kvsm.w.Trigger(reqID, nil)
+				metric.EventCnt.With(ps.Labels{
+					"namespace":  kvsm.fullNS,
+					"event_name": "cluster_syncer_conflicted",
+				}).Inc()
+				return
+			}
+		}
+	}
+	start := time.Now()
+	err = batch.BeginBatch()
+	if err != nil {
+		kvsm.Infof("begin batch for script failed: %v", err)
+		kvsm.w.Trigger(reqID, err)
+		return
+	}
+	se, v, err := kvsm.runScript(isReplaying, &meta, reqTs)
+	if err != nil {
+		kvsm.Infof("run script failed: %v, sha: %v", err, ScriptSHA1(meta.Script))
+		batch.AbortBatchForError(err)
+		kvsm.w.Trigger(reqID, err)
+	} else {
+		batch.AddBatchRsp(reqID, v)
+		batch.CommitBatch()
+		for _, cmd := range se.writes {
+			kvsm.onCmdApplied(isReplaying, strings.ToLower(string(cmd.Args[0])), cmd)
+		}
+	}
+	cost := time.Since(start)
+	slow.LogSlowDBWrite(cost, slow.NewSlowLogInfo(kvsm.fullNS, "script "+ScriptSHA1(meta.Script), strconv.Itoa(len(meta.Keys))))
+	kvsm.dbWriteStats.UpdateWriteStats(int64(len(req.Data)), cost.Microseconds())
+}
+
+// the compiled script is only used in the apply loop, so no lock is needed
+func (kvsm *kvStoreSM) getScriptProto(script string) (*lua.FunctionProto, error) {
+	sha := ScriptSHA1(script)
+	if p, ok := kvsm.scriptProtos[sha]; ok {
+		return p, nil
+	}
+	p, err := CompileScript(script)
+	if err != nil {
+		return nil, err
+	}
+	if kvsm.scriptProtos == nil || len(kvsm.scriptProtos) >= maxScriptProtoCacheNum {
+		kvsm.scriptProtos = make(map[string]*lua.FunctionProto)
+	}
+	kvsm.scriptProtos[sha] = p
+	return p, nil
+}
+
+// scriptBudget is used as the context of the lua state to limit the instructions, since
+// the vm checks the done channel before running each instruction.
+type scriptBudget struct {
+	context.Context
+	left int64
+	done chan struct{}
+}
+
+func newScriptBudget(steps int64) *scriptBudget {
+	return &scriptBudget{
+		Context: context.Background(),
+		left:    steps,
+		done:    make(chan struct{}),
+	}
+}
+
+func (b *scriptBudget) Done() <-chan struct{} {
+	if b.left >= 0 {
+		b.left--
+		if b.left < 0 {
+			close(b.done)
+		}
+	}
+	return b.done
+}
+
+func (b *scriptBudget) Err() error {
+	if b.exceeded() {
+		return errScriptTooManySteps
+	}
+	return nil
+}
+
+func (b *scriptBudget) exceeded() bool {
+	return b.left < 0
+}
+
+func (kvsm *kvStoreSM) runScript(isReplaying bool, meta *scriptMeta, reqTs int64) (*scriptExec, interface{}, error) {
+	proto, err := kvsm.getScriptProto(meta.Script)
+	if err != nil {
+		return nil, nil, err
+	}
+	se := &scriptExec{
+		kvsm:        kvsm,
+		isReplaying: isReplaying,
+		ts:          reqTs,
+		keys:        make(map[string]bool, len(meta.Keys)),
+		written:     make(map[string]bool, len(meta.Keys)),
+	}
+	for _, k := range meta.Keys {
+		se.keys[string(k)] = true
+	}
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:  true,
+		CallStackSize: scriptCallStackSize,
+		RegistrySize:  scriptRegistrySize,
+	})
+	defer L.Close()
+	se.L = L
+	budget := newScriptBudget(scriptMaxSteps)
+	L.SetContext(budget)
+	se.initEnv(meta)
+
+	L.Push(L.NewFunctionFromProto(proto))
+	err = L.PCall(0, 1, nil)
+	if se.fatalErr != nil {
+		// the panic in the go function is recovered by the lua vm
+		panic(se.fatalErr)
+	}
+	if err != nil {
+		if budget.exceeded() {
+			return nil, nil, errScriptTooManySteps
+		}
+		if se.writeErr != nil {
+			return nil, nil, se.writeErr
+		}
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+				// the error reply raised by redis.call
+				if e := tbl.RawGetString("err"); e.Type() == lua.LTString {
+					return nil, nil, errors.New(e.String())
+				}
+			}
+		}
+		return nil, nil, fmt.Errorf("ERR Error running script: %v", err)
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return se, luaToRsp(ret, 0), nil
+}
+
+type scriptExec struct {
+	kvsm        *kvStoreSM
+	L           *lua.LState
+	isReplaying bool
+	ts          int64
+	keys        map[string]bool
+	// the keys written in the batch and the write commands to notify after committed
+	written  map[string]bool
+	writes   []redcon.Command
+	writeErr error
+	fatalErr error
+	// the sequence id for the tables and functions converted to string, instead of the
+	// memory address which is different on the replicas
+	refIDs map[lua.LValue]int
+}
+
+func (se *scriptExec) initEnv(meta *scriptMeta) {
+	L := se.L
+	for _, lib := range []struct {
+		name string
+		f    lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.f))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for libName, funcs := range scriptDeniedFuncs {
+		var lib lua.LValue = L.G.Global
+		if libName != lua.BaseLibName {
+			lib = L.GetGlobal(libName)
+		}
+		tbl, ok := lib.(*lua.LTable)
+		if !ok {
+			continue
+		}
+		for _, name := range funcs {
+			tbl.RawSetString(name, lua.LNil)
+		}
+	}
+	se.overrideBuiltins()
+	keys := L.CreateTable(len(meta.Keys), 0)
+	for _, k := range meta.Keys {
+		keys.Append(lua.LString(k))
+	}
+	L.SetGlobal("KEYS", keys)
+	argv := L.CreateTable(len(meta.Args), 0)
+	for _, arg := range meta.Args {
+		argv.Append(lua.LString(arg))
+	}
+	L.SetGlobal("ARGV", argv)
+
+	redisMod := L.NewTable()
+	L.SetFuncs(redisMod, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return se.call(true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return se.call(false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			tbl := L.NewTable()
+			tbl.RawSetString("err", lua.LString(L.CheckString(1)))
+			L.Push(tbl)
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			tbl := L.NewTable()
+			tbl.RawSetString("ok", lua.LString(L.CheckString(1)))
+			L.Push(tbl)
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(ScriptSHA1(L.CheckString(1))))
+			return 1
+		},
+		// the raft request timestamp is used as the clock, so it is the same on all the replicas
+		"time": func(L *lua.LState) int {
+			tbl := L.CreateTable(2, 0)
+			tbl.Append(lua.LString(strconv.FormatInt(se.ts/int64(time.Second), 10)))
+			tbl.Append(lua.LString(strconv.FormatInt((se.ts%int64(time.Second))/int64(time.Microsecond), 10)))
+			L.Push(tbl)
+			return 1
+		},
+	})
+	L.SetGlobal("redis", redisMod)
+}
+
+// convert the value to string the same as tostring, but the reference types without __tostring
+// use the sequence id instead of the address, so the result is the same on all the replicas.
+func (se *scriptExec) toString(v lua.LValue) lua.LValue {
+	switch v.Type() {
+	case lua.LTNil, lua.LTBool, lua.LTNumber, lua.LTString:
+		return lua.LString(v.String())
+	}
+	if fn := se.L.GetMetaField(v, "__tostring"); fn != lua.LNil {
+		se.L.Push(fn)
+		se.L.Push(v)
+		se.L.Call(1, 1)
+		ret := se.L.Get(-1)
+		se.L.Pop(1)
+		return ret
+	}
+	if se.refIDs == nil {
+		se.refIDs = make(map[lua.LValue]int)
+	}
+	id, ok := se.refIDs[v]
+	if !ok {
+		id = len(se.refIDs) + 1
+		se.refIDs[v] = id
+	}
+	return lua.LString(v.Type().String() + ": " + strconv.Itoa(id))
+}
+
+// replace the builtin functions which are not deterministic or may allocate unlimited memory
+func (se *scriptExec) overrideBuiltins() {
+	L := se.L
+	L.SetGlobal("tostring", L.NewFunction(func(L *lua.LState) int {
+		v := se.toString(L.CheckAny(1))
+		L.Push(v)
+		return 1
+	}))
+	if strLib, ok := L.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		origFormat := strLib.RawGetString("format")
+		strLib.RawSetString("format", L.NewFunction(func(L *lua.LState) int {
+			format := L.CheckString(1)
+			for _, m := range scriptFormatWidthRegexp.FindAllStringSubmatch(format, -1) {
+				for _, n := range m[1:] {
+					if w, err := strconv.Atoi(n); err == nil && w > scriptMaxStringLen {
+						L.RaiseError(errScriptStringTooLong.Error())
+					}
+				}
+			}
+			args := make([]lua.LValue, 0, L.GetTop())
+			args = append(args, lua.LString(format))
+			for i := 2; i <= L.GetTop(); i++ {
+				v := L.Get(i)
+				switch v.Type() {
+				case lua.LTNil, lua.LTBool, lua.LTNumber, lua.LTString:
+				default:
+					v = se.toString(v)
+				}
+				args = append(args, v)
+			}
+			L.Push(origFormat)
+			for _, arg := range args {
+				L.Push(arg)
+			}
+			L.Call(len(args), 1)
+			return 1
+		}))
+		strLib.RawSetString("rep", L.NewFunction(func(L *lua.LState) int {
+			str := L.CheckString(1)
+			n := L.CheckInt(2)
+			if n <= 0 {
+				L.Push(lua.LString(""))
+				return 1
+			}
+			if len(str) > 0 && n > scriptMaxStringLen/len(str) {
+				L.RaiseError(errScriptStringTooLong.Error())
+			}
+			L.Push(lua.LString(strings.Repeat(str, n)))
+			return 1
+		}))
+	}
+	if tabLib, ok := L.GetGlobal(lua.TabLibName).(*lua.LTable); ok {
+		origConcat := tabLib.RawGetString("concat")
+		tabLib.RawSetString("concat", L.NewFunction(func(L *lua.LState) int {
+			tbl := L.CheckTable(1)
+			sep := L.OptString(2, "")
+			i := L.OptInt(3, 1)
+			j := L.OptInt(4, tbl.Len())
+			if i < 1 {
+				i = 1
+			}
+			total := 0
+			for k := i; k <= j && k <= tbl.Len(); k++ {
+				total += len(tbl.RawGetInt(k).String()) + len(sep)
+				if total > scriptMaxStringLen {
+					L.RaiseError(errScriptStringTooLong.Error())
+				}
+			}
+			top := L.GetTop()
+			L.Push(origConcat)
+			for k := 1; k <= top; k++ {
+				L.Push(L.Get(k))
+			}
+			L.Call(top, 1)
+			return 1
+		}))
+	}
+}
+
+func (se *scriptExec) errorReply(raise bool, err error) int {
+	tbl := se.L.NewTable()
+	tbl.RawSetString("err", lua.LString(err.Error()))
+	if raise {
+		se.L.Error(tbl, 1)
+		return 0
+	}
+	se.L.Push(tbl)
+	return 1
+}
+
+// redis.call and redis.pcall, the error will be raised for call and returned as
+// the error reply table for pcall
+func (se *scriptExec) call(raise bool) int {
+	L := se.L
+	n := L.GetTop()
+	if n == 0 {
+		return se.errorReply(raise, errScriptWrongArgs)
+	}
+	args := make([][]byte, 0, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args = append(args, []byte(string(v)))
+		case lua.LNumber:
+			args = append(args, []byte(v.String()))
+		default:
+			return se.errorReply(raise, errScriptInvalidArgType)
+		}
+	}
+	cmdName := strings.ToLower(string(args[0]))
+	if len(args) < 2 {
+		return se.errorReply(raise, errWrongNumberArgs)
+	}
+	if scriptDeniedCmds[cmdName] {
+		return se.errorReply(raise, errScriptDeniedCmd)
+	}
+	if err := CheckActiveActiveCmd(cmdName); err != nil {
+		return se.errorReply(raise, err)
+	}
+	var v lua.LValue
+	var err error
+	if h, ok := se.kvsm.router.GetInternalCmdHandler(cmdName); ok {
+		v, err = se.write(h, cmdName, args)
+		if se.writeErr != nil {
+			// the write batch may be changed by the failed command, so the
+			// error is always raised and the script fails even using pcall
+			return se.errorReply(true, err)
+		}
+	} else if se.kvsm.readRouter != nil {
+		h, ok := se.kvsm.readRouter.GetCmdHandler(cmdName)
+		if !ok {
+			return se.errorReply(raise, errScriptUnknownCmd)
+		}
+		v, err = se.read(h, cmdName, args)
+	} else {
+		return se.errorReply(raise, errScriptUnknownCmd)
+	}
+	if err != nil {
+		return se.errorReply(raise, err)
+	}
+	if tbl, ok := v.(*lua.LTable); ok && raise {
+		// the error reply from the read command
+		if e := tbl.RawGetString("err"); e.Type() == lua.LTString {
+			L.Error(tbl, 1)
+			return 0
+		}
+	}
+	L.Push(v)
+	return 1
+}
+
+func (se *scriptExec) checkKeys(indexes []int, args [][]byte) error {
+	for _, i := range indexes {
+		if !se.keys[string(args[i])] {
+			return errScriptUndeclaredKey
+		}
+		if se.written[string(args[i])] {
+			return errScriptKeyRewritten
+		}
+	}
+	return nil
+}
+
+func (se *scriptExec) write(h common.InternalCommandFunc, cmdName string, args [][]byte) (lua.LValue, error) {
+	var indexes []int
+	forEachKeyIndex(cmdName, args, func(i int) bool {
+		indexes = append(indexes, i)
+		return true
+	})
+	if err := se.checkKeys(indexes, args); err != nil {
+		return nil, err
+	}
+	for _, i := range indexes {
+		se.written[string(args[i])] = true
+		pk, err := common.CutNamesapce(args[i])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = pk
+	}
+	kvsm := se.kvsm
+	cmd := buildCommand(args)
+	if kvsm.topnWrites != nil {
+		kvsm.topnWrites.HitWrite(cmd.Args[1])
+	}
+	v, err := kvsm.handleMultiCmd(h, cmd, se.ts)
+	if err != nil {
+		kvsm.Errorf("redis command %v in script error: %v, cmd: %v", cmdName, err, string(cmd.Raw))
+		if isUnrecoveryError(err) {
+			se.fatalErr = err
+		}
+		se.writeErr = err
+		return nil, err
+	}
+	if f, ok := multiExecRspFuncs[cmdName]; ok {
+		if nv, err := f(cmd, v); err == nil {
+			v = nv
+		}
+	}
+	se.writes = append(se.writes, cmd)
+	return se.rspToLua(v)
+}
+
+func (se *scriptExec) read(h common.CommandFunc, cmdName string, args [][]byte) (lua.LValue, error) {
+	indexes := []int{1}
+	if cmdName == "mget" {
+		indexes = indexes[:0]
+		for i := 1; i < len(args); i++ {
+			indexes = append(indexes, i)
+		}
+	}
+	if err := se.checkKeys(indexes, args); err != nil {
+		return nil, err
+	}
+	conn := &scriptConn{L: se.L}
+	h(conn, buildCommand(args))
+	if conn.reply == nil || len(conn.stack) > 0 {
+		return nil, errScriptInvalidRspType
+	}
+	return conn.reply, nil
+}
+
+// convert the response of the internal write command to the lua value
+func (se *scriptExec) rspToLua(v interface{}) (lua.LValue, error) {
+	L := se.L
+	switch rv := v.(type) {
+	case nil:
+		return lua.LFalse, nil
+	case error:
+		return nil, rv
+	case string:
+		tbl := L.NewTable()
+		tbl.RawSetString("ok", lua.LString(rv))
+		return tbl, nil
+	case []byte:
+		if rv == nil {
+			return lua.LFalse, nil
+		}
+		return lua.LString(rv), nil
+	case int64:
+		return lua.LNumber(rv), nil
+	case int:
+		return lua.LNumber(rv), nil
+	case float64:
+		return lua.LString(strconv.FormatFloat(rv, 'g', -1, 64)), nil
+	case [][]byte:
+		tbl := L.CreateTable(len(rv), 0)
+		for _, d := range rv {
+			if d == nil {
+				tbl.Append(lua.LFalse)
+			} else {
+				tbl.Append(lua.LString(d))
+			}
+		}
+		return tbl, nil
+	case []interface{}:
+		tbl := L.CreateTable(len(rv), 0)
+		for _, d := range rv {
+			lv, err := se.rspToLua(d)
+			if err != nil {
+				return nil, err
+			}
+			tbl.Append(lv)
+		}
+		return tbl, nil
+	default:
+		return nil, errScriptInvalidRspType
+	}
+}
+
+// convert the lua value returned by the script to the redis response, the same as redis:
+// number is converted to integer, table with err or ok field is converted to error or status,
+// and the array table is converted until the first nil.
+func luaToRsp(v lua.LValue, depth int) interface{} {
+	switch lv := v.(type) {
+	case lua.LNumber:
+		return int64(lv)
+	case lua.LString:
+		return []byte(string(lv))
+	case lua.LBool:
+		if bool(lv) {
+			return int64(1)
+		}
+		return nil
+	case *lua.LTable:
+		if e := lv.RawGetString("err"); e.Type() == lua.LTString {
+			return errors.New(e.String())
+		}
+		if ok := lv.RawGetString("ok"); ok.Type() == lua.LTString {
+			return ok.String()
+		}
+		if depth > scriptCallStackSize {
+			return errScriptInvalidRspType
+		}
+		rsps := make([]interface{}, 0, lv.Len())
+		for i := 1; ; i++ {
+			item := lv.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			rsps = append(rsps, luaToRsp(item, depth+1))
+		}
+		return rsps
+	default:
+		return nil
+	}
+}
+
+// scriptConn collect the response of the read command as the lua value
+type scriptConn struct {
+	L     *lua.LState
+	reply lua.LValue
+	// the arrays waiting for the items
+	stack []*scriptConnArray
+}
+
+type scriptConnArray struct {
+	tbl  *lua.LTable
+	left int
+}
+
+func (c *scriptConn) add(v lua.LValue) {
+	for len(c.stack) > 0 {
+		top := c.stack[len(c.stack)-1]
+		top.tbl.Append(v)
+		top.left--
+		if top.left > 0 {
+			return
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+		v = top.tbl
+	}
+	c.reply = v
+}
+
+func (c *scriptConn) RemoteAddr() string { return "" }
+func (c *scriptConn) Close() error       { return nil }
+func (c *scriptConn) WriteError(msg string) {
+	tbl := c.L.NewTable()
+	tbl.RawSetString("err", lua.LString(msg))
+	c.add(tbl)
+}
+func (c *scriptConn) WriteString(str string) {
+	tbl := c.L.NewTable()
+	tbl.RawSetString("ok", lua.LString(str))
+	c.add(tbl)
+}
+func (c *scriptConn) WriteBulk(bulk []byte)       { c.add(lua.LString(bulk)) }
+func (c *scriptConn) WriteBulkString(bulk string) { c.add(lua.LString(bulk)) }
+func (c *scriptConn) WriteInt(num int)            { c.add(lua.LNumber(num)) }
+func (c *scriptConn) WriteInt64(num int64)        { c.add(lua.LNumber(num)) }
+func (c *scriptConn) WriteArray(count int) {
+	if count < 0 {
+		c.add(lua.LFalse)
+		return
+	}
+	tbl := c.L.CreateTable(count, 0)
+	if count == 0 {
+		c.add(tbl)
+		return
+	}
+	c.stack = append(c.stack, &scriptConnArray{tbl: tbl, left: count})
+}
+func (c *scriptConn) WriteNull()                     { c.add(lua.LFalse) }
+func (c *scriptConn) WriteRaw(data []byte)           { c.add(lua.LString(data)) }
+func (c *scriptConn) Context() interface{}           { return nil }
+func (c *scriptConn) SetContext(v interface{})       {}
+func (c *scriptConn) SetReadBuffer(bytes int)        {}
+func (c *scriptConn) Detach() redcon.DetachedConn    { return nil }
+func (c *scriptConn) ReadPipeline() []redcon.Command { return nil }
+func (c *scriptConn) PeekPipeline() []redcon.Command { return nil }
+func (c *scriptConn) NetConn() net.Conn              { return nil }
+func (c *scriptConn) Flush() error                   { return nil }
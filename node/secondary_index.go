@@ -92,40 +92,50 @@ func parseIndexQueryLimit(args [][]byte) (int, int, error) {
 	return offset, count, nil
 }
 
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] HGETALL $
-// HIDX.FROM {namespace:table} WHERE {WHERE clause} [LIMIT offset num] [ANY HASH REDIS COMMAND]
-// handle (xx and xx) or (xx and xx), get the min and max range and iterator in the possible range,
-// match all the conditions to decide whether the cursor should be returned
-func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+// parse the index search command, return the table, the index field (or json path),
+// the search condition and the left post command args
+func (nd *KVNode) parseIndexSearchCommand(cmd redcon.Command) ([]byte, []byte, *rockredis.IndexCondition, [][]byte, error) {
 	if len(cmd.Args) < 4 {
-		return nil, common.ErrInvalidArgs
+		return nil, nil, nil, nil, common.ErrInvalidArgs
 	}
 	table, err := common.CutNamesapce(cmd.Args[1])
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, nil, err
 	}
 	cmd.Args[1] = table
 
 	if strings.ToLower(string(cmd.Args[2])) != "where" {
-		return nil, common.ErrInvalidArgs
+		return nil, nil, nil, nil, common.ErrInvalidArgs
 	}
 	nd.rn.Debugf("parsing where condition: %v", string(cmd.Args[3]))
 	field, cond, err := parseIndexQueryWhere(cmd.Args[3])
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, nil, err
 	}
 	args := cmd.Args[4:]
 	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("limit")) {
 		offset, count, err := parseIndexQueryLimit(args)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
 		cond.Offset = offset
 		cond.Limit = count
 		args = args[3:]
 	}
 	nd.rn.Debugf("table %v parsing where condition result: %v, field: %v", string(table), cond, string(field))
+	return table, field, cond, args, nil
+}
+
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] HGETALL $
+// HIDX.FROM {namespace:table} WHERE {WHERE clause} [LIMIT offset num] [ANY HASH REDIS COMMAND]
+// handle (xx and xx) or (xx and xx), get the min and max range and iterator in the possible range,
+// match all the conditions to decide whether the cursor should be returned
+func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+	table, field, cond, args, err := nd.parseIndexSearchCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
 	vt, _, pkList, err := nd.store.HsetIndexSearch(table, field, cond, false)
 	if err != nil {
 		nd.rn.Infof("search %v, %v error: %v", string(table), string(field), err)
@@ -202,3 +212,47 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 		return &HindexSearchResults{Table: string(table), Rets: rets}, nil
 	}
 }
+
+// JIDX.FROM ns:table where "path > 1 and path < 2" [LIMIT offset num] [JSON.GET $ path1 path2]
+// the same as the hset index search, while the field in where condition is the json path
+func (nd *KVNode) jindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+	table, path, cond, args, err := nd.parseIndexSearchCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	vt, _, pkList, err := nd.store.JSONIndexSearch(table, path, cond, false)
+	if err != nil {
+		nd.rn.Infof("search %v, %v error: %v", string(table), string(path), err)
+		return nil, err
+	}
+	nd.rn.Debugf("search result count: %v", len(pkList))
+	rets := make([]common.HIndexRespWithValues, 0, len(pkList))
+	var postPaths [][]byte
+	if len(args) > 0 {
+		if len(args) < 3 {
+			return nil, common.ErrInvalidArgs
+		}
+		if strings.ToLower(string(args[0])) != "json.get" {
+			return nil, common.ErrNotSupport
+		}
+		postPaths = args[2:]
+	}
+	for _, pk := range pkList {
+		rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue}
+		if vt == rockredis.Int64V || vt == rockredis.Int32V {
+			rspV.IndexV = pk.IndexIntValue
+		}
+		if len(postPaths) > 0 {
+			vals, err := nd.store.JGet(pk.PKey, postPaths...)
+			if err != nil {
+				continue
+			}
+			rspV.HsetValues = make([][]byte, 0, len(vals))
+			for _, v := range vals {
+				rspV.HsetValues = append(rspV.HsetValues, []byte(v))
+			}
+		}
+		rets = append(rets, rspV)
+	}
+	return &HindexSearchResults{Table: string(table), Rets: rets}, nil
+}
@@ -185,6 +185,45 @@ func (nd *KVNode) spopCommand(cmd redcon.Command) (interface{}, error) {
 	return v, nil
 }
 
+// return the members for each key in the same partition, the members will be merged
+// with the other partitions for sinter, sunion and sdiff.
+func (nd *KVNode) smembersMergeCommand(cmd redcon.Command) (interface{}, error) {
+	return nd.store.SMembersMulti(cmd.Args[1:]...)
+}
+
+// smove source destination member
+func (nd *KVNode) smoveCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 4 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	src, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	// no need propose if the member is not in the source set
+	n, err := nd.store.SIsMember(src, cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return int64(0), nil
+	}
+	return rebuildKeysAndPropose(nd, cmd, 2, checkAndRewriteIntRsp)
+}
+
+// sinterstore|sunionstore|sdiffstore destination key [key ...]
+func (nd *KVNode) setStoreCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 3 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if len(cmd.Args[2:]) > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	return rebuildKeysAndPropose(nd, cmd, len(cmd.Args)-1, checkAndRewriteIntRsp)
+}
+
 func (kvsm *kvStoreSM) localSadd(cmd redcon.Command, ts int64) (interface{}, error) {
 	return kvsm.store.SAdd(ts, cmd.Args[1], cmd.Args[2:]...)
 }
@@ -217,3 +256,19 @@ func (kvsm *kvStoreSM) localSclear(cmd redcon.Command, ts int64) (interface{}, e
 func (kvsm *kvStoreSM) localSmclear(cmd redcon.Command, ts int64) (interface{}, error) {
 	return kvsm.store.SMclear(cmd.Args[1:]...)
 }
+
+func (kvsm *kvStoreSM) localSmove(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.SMove(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3])
+}
+
+func (kvsm *kvStoreSM) localSinterstore(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.SInterStore(ts, cmd.Args[1], cmd.Args[2:]...)
+}
+
+func (kvsm *kvStoreSM) localSunionstore(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.SUnionStore(ts, cmd.Args[1], cmd.Args[2:]...)
+}
+
+func (kvsm *kvStoreSM) localSdiffstore(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.SDiffStore(ts, cmd.Args[1], cmd.Args[2:]...)
+}
@@ -53,7 +53,14 @@ func init() {
 	maybeSlowCmd["zremrangebyrank"] = true
 	maybeSlowCmd["zremrangebyscore"] = true
 	maybeSlowCmd["zremrangebylex"] = true
+	maybeSlowCmd["zunionstore"] = true
+	maybeSlowCmd["zinterstore"] = true
 	maybeSlowCmd["ltrim"] = true
+	maybeSlowCmd["lrem"] = true
+	maybeSlowCmd["linsert"] = true
+	for _, name := range bitOpCmds {
+		maybeSlowCmd[name] = true
+	}
 	// remove below if compact ttl is enabled by default
 	maybeSlowCmd["sclear"] = true
 	maybeSlowCmd["zclear"] = true
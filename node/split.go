@@ -0,0 +1,426 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+const (
+	splitStagingDir   = "split"
+	splitSeedInfoFile = "split_seed"
+)
+
+var (
+	// the client should refresh the partition routing and retry
+	ErrPartitionKeyMoved   = errors.New("ERR_CLUSTER_CHANGED: the key is moved to the new partition by split")
+	ErrSplitSeedNotReady   = errors.New("split seed data for the new partition is not ready")
+	errInvalidSplitBarrier = errors.New("invalid split barrier")
+
+	// the slots of the redis cluster namespace are assigned by contiguous blocks, the parent
+	// partition can not keep its id while the block is divided for the new partition.
+	ErrSplitNotSupported = errors.New("the redis cluster namespace can not be split")
+)
+
+// splitState is saved in the db of the split partition, after the split barrier
+// all the writes for the keys not owned by this partition will be refused.
+type splitState struct {
+	SplitNum  int `json:"split_num"`
+	Partition int `json:"partition"`
+	// the raft index of the split barrier, the writes before this index
+	// should be applied as usual while replaying the logs.
+	Index   uint64 `json:"index"`
+	Cleaned bool   `json:"cleaned"`
+	// the partition of the primary key if not the default
+	keyPartition func(pk []byte, pnum int) int
+}
+
+func (st *splitState) isOwned(pk []byte) bool {
+	if st.keyPartition != nil {
+		return st.keyPartition(pk, st.SplitNum) == st.Partition
+	}
+	return GetHashedPartitionID(pk, st.SplitNum) == st.Partition
+}
+
+type splitBarrier struct {
+	SplitNum  int `json:"split_num"`
+	Partition int `json:"partition"`
+}
+
+// splitSeedInfo is saved in the data dir of the new partition which is seeded
+// from the checkpoint of the parent partition.
+type splitSeedInfo struct {
+	Partition    int  `json:"partition"`
+	PartitionNum int  `json:"partition_num"`
+	Filtered     bool `json:"filtered"`
+	// the raft index of the split barrier in the parent partition
+	SeedIndex uint64 `json:"seed_index"`
+}
+
+func getSplitStagingDir(parentDataDir string, childName string) string {
+	return path.Join(parentDataDir, splitStagingDir, childName)
+}
+
+func getSplitSeedInfoFileName(dataDir string) string {
+	return path.Join(dataDir, splitSeedInfoFile)
+}
+
+func loadSplitSeedInfo(fileName string) (*splitSeedInfo, error) {
+	d, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var info splitSeedInfo
+	err = json.Unmarshal(d, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func saveSplitSeedInfo(fileName string, info *splitSeedInfo) error {
+	d, _ := json.Marshal(info)
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(d)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// handleSplitSeed filter the data seeded from the parent partition to keep only the keys
+// owned by this partition. The seeded data should be kept until the first snapshot
+// since the raft logs of the new partition do not have the seeded data.
+func (s *KVStore) handleSplitSeed() (bool, error) {
+	fileName := getSplitSeedInfoFileName(s.opts.DataDir)
+	info, err := loadSplitSeedInfo(fileName)
+	if err != nil {
+		return false, err
+	}
+	if info == nil {
+		return false, nil
+	}
+	if info.Filtered {
+		return true, nil
+	}
+	// the split state in the seed is saved by the parent while applying the barrier
+	if v, err := s.GetSplitState(); err == nil && v != nil {
+		var pst splitState
+		if json.Unmarshal(v, &pst) == nil {
+			info.SeedIndex = pst.Index
+		}
+	}
+	st := &splitState{
+		SplitNum:     info.PartitionNum,
+		Partition:    info.Partition,
+		Cleaned:      true,
+		keyPartition: s.opts.KeyPartition,
+	}
+	n, err := s.DeleteUnownedKeys(st.isOwned, nil)
+	if err != nil {
+		return true, err
+	}
+	nodeLog.Infof("the store %v seeded by split filtered %v keys", s.opts.DataDir, n)
+	d, _ := json.Marshal(st)
+	err = s.SetSplitState(d)
+	if err != nil {
+		return true, err
+	}
+	info.Filtered = true
+	return true, saveSplitSeedInfo(fileName, info)
+}
+
+func (s *KVStore) isSplitSeeding() bool {
+	_, err := os.Stat(getSplitSeedInfoFileName(s.opts.DataDir))
+	return err == nil
+}
+
+func (s *KVStore) clearSplitSeed() {
+	fileName := getSplitSeedInfoFileName(s.opts.DataDir)
+	if _, err := os.Stat(fileName); err != nil {
+		return
+	}
+	nodeLog.Infof("the store %v clear split seed info since snapshot saved", s.opts.DataDir)
+	os.Remove(fileName)
+}
+
+func (kvsm *kvStoreSM) loadSplitState() {
+	var st *splitState
+	v, err := kvsm.store.GetSplitState()
+	if err != nil {
+		kvsm.Infof("load split state failed: %v", err)
+	} else if v != nil {
+		st = &splitState{keyPartition: kvsm.store.opts.KeyPartition}
+		err = json.Unmarshal(v, st)
+		if err != nil {
+			kvsm.Infof("invalid split state %v: %v", string(v), err)
+			st = nil
+		}
+	}
+	kvsm.splitState.Store(st)
+}
+
+func (kvsm *kvStoreSM) getSplitState() *splitState {
+	st, _ := kvsm.splitState.Load().(*splitState)
+	return st
+}
+
+func (kvsm *kvStoreSM) saveSplitState(st *splitState) error {
+	d, _ := json.Marshal(st)
+	err := kvsm.store.SetSplitState(d)
+	if err != nil {
+		return err
+	}
+	kvsm.splitState.Store(st)
+	return nil
+}
+
+// check the keys of the write command, the command should be refused if any of the key
+// is moved to the new partition after the split barrier.
+func (kvsm *kvStoreSM) checkSplitFence(cmdName string, cmd redcon.Command, index uint64) error {
+	st := kvsm.getSplitState()
+	if st == nil || index <= st.Index {
+		return nil
+	}
+	var err error
+	forEachWriteKey(cmdName, cmd, func(k []byte) bool {
+		if !st.isOwned(k) {
+			err = ErrPartitionKeyMoved
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// handleSplitBarrier will be applied on all the replicas at the same raft index, so
+// the fence and the checkpoint for the new partition are the same on all the replicas.
+func (kvsm *kvStoreSM) handleSplitBarrier(data []byte, index uint64) error {
+	var b splitBarrier
+	err := json.Unmarshal(data, &b)
+	if err != nil {
+		return err
+	}
+	if kvsm.store.opts.KeyPartition != nil {
+		kvsm.Infof("split barrier %v ignored: %v", b, ErrSplitNotSupported)
+		return ErrSplitNotSupported
+	}
+	base, pid := common.GetNamespaceAndPartition(kvsm.fullNS)
+	if b.SplitNum <= 0 || b.SplitNum%2 != 0 || b.Partition != pid || pid >= b.SplitNum/2 {
+		kvsm.Infof("invalid split barrier: %v", b)
+		return errInvalidSplitBarrier
+	}
+	childName := common.GetNsDesp(base, b.Partition+b.SplitNum/2)
+	stagingDir := getSplitStagingDir(kvsm.store.GetBackupBase(), childName)
+	st := kvsm.getSplitState()
+	if st == nil || st.SplitNum != b.SplitNum {
+		st = &splitState{
+			SplitNum:     b.SplitNum,
+			Partition:    b.Partition,
+			Index:        index,
+			keyPartition: kvsm.store.opts.KeyPartition,
+		}
+		err = kvsm.saveSplitState(st)
+		if err != nil {
+			return err
+		}
+	} else if kvsm.isSplitSeedSaved(stagingDir, childName) {
+		// the barrier may be proposed more than once, the seed saved by the first one
+		// may be in use by the new partition.
+		kvsm.Infof("split barrier %v at %v ignored since seed already saved", b, index)
+		return nil
+	}
+	err = os.MkdirAll(path.Dir(stagingDir), common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = kvsm.store.SaveCheckpoint(stagingDir)
+	kvsm.Infof("split barrier %v at %v, seed for %v saved (cost %v): %v", b, index, childName,
+		time.Since(start), err)
+	return err
+}
+
+func (kvsm *kvStoreSM) isSplitSeedSaved(stagingDir string, childName string) bool {
+	if _, err := os.Stat(stagingDir); err == nil {
+		return true
+	}
+	_, err := os.Stat(path.Join(path.Dir(kvsm.store.GetBackupBase()), childName))
+	return err == nil
+}
+
+// clean the keys moved to the new partition after the routing switched
+func (kvsm *kvStoreSM) cleanSplitMovedKeys(pnum int, stopC <-chan struct{}) error {
+	st := kvsm.getSplitState()
+	if st == nil || st.Cleaned || st.SplitNum != pnum {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&kvsm.splitCleaning, 0, 1) {
+		return nil
+	}
+	defer atomic.StoreInt32(&kvsm.splitCleaning, 0)
+	n, err := kvsm.store.DeleteUnownedKeys(st.isOwned, stopC)
+	if err != nil {
+		kvsm.Infof("clean the keys moved by split failed: %v", err)
+		return err
+	}
+	kvsm.Infof("clean the keys moved by split done: %v", n)
+	os.RemoveAll(path.Join(kvsm.store.GetBackupBase(), splitStagingDir))
+	newSt := *st
+	newSt.Cleaned = true
+	return kvsm.saveSplitState(&newSt)
+}
+
+// ProposeSplitBarrier propose the split barrier to the parent partition, after that the
+// writes for the keys moved to the new partition will be refused.
+func (nd *KVNode) ProposeSplitBarrier(splitNum int, partition int) error {
+	if kvsm, ok := nd.sm.(*kvStoreSM); ok && kvsm.store.opts.KeyPartition != nil {
+		return ErrSplitNotSupported
+	}
+	d, _ := json.Marshal(&splitBarrier{SplitNum: splitNum, Partition: partition})
+	p := &customProposeData{
+		ProposeOp:  ProposeOp_SplitBarrier,
+		NeedBackup: false,
+		Data:       d,
+	}
+	dd, _ := json.Marshal(p)
+	_, err := nd.CustomPropose(dd)
+	nd.rn.Infof("node %v propose split barrier (%v-%v): %v", nd.ns, splitNum, partition, err)
+	return err
+}
+
+// CleanSplitMovedKeys clean the keys moved to the new partition in background
+// after the split is done with the new partition number.
+func (nd *KVNode) CleanSplitMovedKeys(pnum int) {
+	kvsm, ok := nd.sm.(*kvStoreSM)
+	if !ok {
+		return
+	}
+	st := kvsm.getSplitState()
+	if st == nil || st.Cleaned || st.SplitNum != pnum {
+		return
+	}
+	nd.wg.Add(1)
+	go func() {
+		defer nd.wg.Done()
+		kvsm.cleanSplitMovedKeys(pnum, nd.stopChan)
+	}()
+}
+
+// IsSplitSeeding return true if the data is seeded from the parent partition and
+// no snapshot saved yet.
+func (nd *KVNode) IsSplitSeeding() bool {
+	if nd.store == nil {
+		return false
+	}
+	return nd.store.isSplitSeeding()
+}
+
+// IsSplitSeedApplied return true if this node is the leader of the new partition and all the
+// committed logs are applied on the seed data, the routing can be switched to it without
+// waiting the followers. The raft index of the split barrier in the parent is also returned.
+func (nd *KVNode) IsSplitSeedApplied() (uint64, bool) {
+	if nd.store == nil || !nd.IsLead() || !nd.rn.IsReplayFinished() || !nd.IsRaftSynced(true) {
+		return 0, false
+	}
+	info, err := loadSplitSeedInfo(getSplitSeedInfoFileName(nd.store.opts.DataDir))
+	if err != nil {
+		return 0, false
+	}
+	if info == nil {
+		// the seed is already saved in snapshot
+		return 0, true
+	}
+	return info.SeedIndex, info.Filtered
+}
+
+// prepare the local data for the new partition by moving the split checkpoint
+// saved by the parent partition.
+func (nsm *NamespaceMgr) prepareSplitSeed(conf *NamespaceConfig, kvOpts *KVOptions) error {
+	_, pid := common.GetNamespaceAndPartition(conf.Name)
+	if pid < conf.PartitionNum {
+		return nil
+	}
+	if _, err := os.Stat(kvOpts.DataDir); err == nil {
+		return nil
+	}
+	parentName := common.GetNsDesp(conf.BaseName, pid-conf.PartitionNum)
+	stagingDir := getSplitStagingDir(path.Join(nsm.machineConf.DataRootDir, parentName), conf.Name)
+	if _, err := os.Stat(stagingDir); err != nil {
+		nodeLog.Infof("namespace %v split seed not ready: %v", conf.Name, err)
+		return ErrSplitSeedNotReady
+	}
+	dataDir, err := engine.GetDataDirFromBase(kvOpts.RockOpts.EngineType, kvOpts.DataDir)
+	if err != nil {
+		return err
+	}
+	tmpDir := kvOpts.DataDir + "-splitting"
+	os.RemoveAll(tmpDir)
+	err = os.MkdirAll(tmpDir, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	info := &splitSeedInfo{
+		Partition:    pid,
+		PartitionNum: conf.PartitionNum * 2,
+	}
+	err = saveSplitSeedInfo(getSplitSeedInfoFileName(tmpDir), info)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(stagingDir, path.Join(tmpDir, path.Base(dataDir)))
+	if err != nil {
+		return err
+	}
+	nodeLog.Infof("namespace %v seeded from split checkpoint: %v", conf.Name, stagingDir)
+	return os.Rename(tmpDir, kvOpts.DataDir)
+}
+
+// IsSplitSeedReady check whether the local data for the new partition can be
+// seeded from the parent partition
+func (nsm *NamespaceMgr) IsSplitSeedReady(parentName string, childName string) bool {
+	if _, err := os.Stat(path.Join(nsm.machineConf.DataRootDir, childName)); err == nil {
+		return true
+	}
+	stagingDir := getSplitStagingDir(path.Join(nsm.machineConf.DataRootDir, parentName), childName)
+	_, err := os.Stat(stagingDir)
+	return err == nil
+}
+
+// UpdateNamespacePartitionNum update the routing partition number after split, the partition
+// number only grows so the older info from the register is ignored.
+func (nsm *NamespaceMgr) UpdateNamespacePartitionNum(nsBaseName string, pnum int) {
+	nsm.mutex.Lock()
+	defer nsm.mutex.Unlock()
+	meta, ok := nsm.nsMetas[nsBaseName]
+	if !ok || meta.PartitionNum >= pnum {
+		return
+	}
+	nodeLog.Infof("namespace %v partition number changed from %v to %v", nsBaseName, meta.PartitionNum, pnum)
+	meta.PartitionNum = pnum
+}
+
+// should be called while holding the lock
+func (nsm *NamespaceMgr) hasNamespaceNodes(nsBaseName string) bool {
+	for _, n := range nsm.kvNodes {
+		if n.conf.BaseName == nsBaseName {
+			return true
+		}
+	}
+	return false
+}
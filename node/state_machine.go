@@ -23,6 +23,7 @@ import (
 	"github.com/youzan/ZanRedisDB/raft/raftpb"
 	"github.com/youzan/ZanRedisDB/rockredis"
 	"github.com/youzan/ZanRedisDB/slow"
+	lua "github.com/yuin/gopher-lua"
 )
 
 const (
@@ -84,6 +85,8 @@ func NewStateMachine(opts *KVOptions, machineConfig MachineConfig, localID uint6
 		}
 		lssm.w = w
 		return lssm, err
+	} else if common.IsRoleCDC(machineConfig.LearnerRole) {
+		return NewCDCSM(opts, machineConfig, localID, fullNS, clusterInfo, w, sl)
 	} else {
 		return nil, errors.New("unknown learner role")
 	}
@@ -95,6 +98,7 @@ type IBatchOperator interface {
 	BeginBatch() error
 	AddBatchKey(string)
 	AddBatchRsp(uint64, interface{})
+	AddBatchNotify(string, redcon.Command, bool)
 	IsBatchable(string, string, [][]byte) bool
 	CommitBatch()
 	AbortBatchForError(err error)
@@ -107,6 +111,14 @@ type kvbatchOperator struct {
 	batching        bool
 	dupCheckMap     map[string]bool
 	kvsm            *kvStoreSM
+	// the keyspace notify and the blocking waiters should be fired after the batch committed
+	batchNotifyList []batchNotify
+}
+
+type batchNotify struct {
+	cmdName   string
+	cmd       redcon.Command
+	replaying bool
 }
 
 func (bo *kvbatchOperator) SetBatched(b bool) {
@@ -138,6 +150,18 @@ func (bo *kvbatchOperator) AddBatchRsp(reqID uint64, v interface{}) {
 	bo.batchReqRspList = append(bo.batchReqRspList, v)
 }
 
+func (bo *kvbatchOperator) AddBatchNotify(cmdName string, cmd redcon.Command, replaying bool) {
+	bo.batchNotifyList = append(bo.batchNotifyList, batchNotify{cmdName: cmdName, cmd: cmd, replaying: replaying})
+}
+
+func (bo *kvbatchOperator) fireBatchNotify() {
+	for i, n := range bo.batchNotifyList {
+		bo.kvsm.onCmdApplied(n.replaying, n.cmdName, n.cmd)
+		bo.batchNotifyList[i] = batchNotify{}
+	}
+	bo.batchNotifyList = bo.batchNotifyList[:0]
+}
+
 func (bo *kvbatchOperator) IsBatchable(cmdName string, pk string, args [][]byte) bool {
 	if cmdName == "del" && len(args) > 2 {
 		// del for multi keys, no batch
@@ -155,6 +179,7 @@ func (bo *kvbatchOperator) IsBatchable(cmdName string, pk string, args [][]byte)
 func (bo *kvbatchOperator) AbortBatchForError(err error) {
 	// we need clean write batch even no batched
 	bo.kvsm.store.AbortBatch()
+	bo.batchNotifyList = bo.batchNotifyList[:0]
 	if !bo.IsBatched() {
 		return
 	}
@@ -188,6 +213,11 @@ func (bo *kvbatchOperator) CommitBatch() {
 			bo.kvsm.w.Trigger(rid, bo.batchReqRspList[idx])
 		}
 	}
+	if err == nil {
+		bo.fireBatchNotify()
+	} else {
+		bo.batchNotifyList = bo.batchNotifyList[:0]
+	}
 	if len(bo.batchReqIDList) > 0 {
 		bk := "batched: "
 		// just use one of the batched keys as log
@@ -306,27 +336,54 @@ type kvStoreSM struct {
 	cRouter       *conflictRouter
 	slowLimiter   *SlowLimiter
 	topnWrites    *metric.TopNHot
+	splitState    atomic.Value
+	splitCleaning int32
+	// func() bool to check if the local node is leader
+	leaderChecker atomic.Value
+	listWaiters   *listBlockWaiters
+	archiver      *raftLogArchiver
+	readRouter    *common.CmdRouter
+	scriptProtos  map[string]*lua.FunctionProto
+	// record the write commands committed to db, including the replayed ones
+	appliedRecorder func(cmdName string, cmd redcon.Command)
 }
 
 func NewKVStoreSM(opts *KVOptions, machineConfig MachineConfig, localID uint64, ns string,
 	clusterInfo common.IClusterInfo, sl *SlowLimiter) (*kvStoreSM, error) {
-	store, err := NewKVStore(opts)
-	if err != nil {
-		return nil, err
-	}
 	sm := &kvStoreSM{
 		fullNS:        ns,
 		machineConfig: machineConfig,
 		ID:            localID,
 		clusterInfo:   clusterInfo,
-		store:         store,
 		router:        common.NewSMCmdRouter(),
 		cRouter:       NewConflictRouter(),
 		slowLimiter:   sl,
 		topnWrites:    metric.NewTopNHot(),
 	}
+	storeOpts := *opts
+	storeOpts.ExpiredNotifier = sm.notifyExpired
+	if base, _ := common.GetNamespaceAndPartition(ns); base != "" && base == machineConfig.RedisClusterNamespace {
+		storeOpts.KeyPartition = func(pk []byte, pnum int) int {
+			return common.SlotPartition(SlotHashedKey(base, pk), pnum)
+		}
+	}
+	store, err := NewKVStore(&storeOpts)
+	if err != nil {
+		return nil, err
+	}
+	sm.store = store
+	if machineConfig.RaftLogArchive {
+		sm.archiver, err = newRaftLogArchiver(getRaftArchiveDir(machineConfig.RaftLogArchiveDir, storeOpts.DataDir),
+			ns, machineConfig.RaftLogArchiveKeepHours)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
 	sm.registerHandlers()
 	sm.registerConflictHandlers()
+	sm.registerConflictResolvers()
+	sm.loadSplitState()
 	return sm, nil
 }
 
@@ -354,6 +411,9 @@ func (kvsm *kvStoreSM) Close() {
 		return
 	}
 	kvsm.store.Close()
+	if kvsm.archiver != nil {
+		kvsm.archiver.close()
+	}
 }
 
 func (kvsm *kvStoreSM) GetBatchOperator() IBatchOperator {
@@ -435,7 +495,14 @@ func (kvsm *kvStoreSM) GetStats(table string, needDetail bool) metric.NamespaceS
 }
 
 func (kvsm *kvStoreSM) CleanData() error {
-	return kvsm.store.CleanData()
+	err := kvsm.store.CleanData()
+	kvsm.loadSplitState()
+	if kvsm.archiver != nil {
+		if rerr := kvsm.archiver.reset(); rerr != nil {
+			kvsm.Errorf("reset raft log archive failed: %v", rerr)
+		}
+	}
+	return err
 }
 
 func (kvsm *kvStoreSM) Destroy() {
@@ -450,6 +517,12 @@ func (kvsm *kvStoreSM) UpdateSnapshotState(term uint64, index uint64) {
 
 func (kvsm *kvStoreSM) GetSnapshot(term uint64, index uint64) (*KVSnapInfo, error) {
 	var si KVSnapInfo
+	// the archived logs before the snapshot should be saved before the raft logs compacted
+	if kvsm.archiver != nil {
+		if err := kvsm.archiver.flush(); err != nil {
+			kvsm.Errorf("flush raft log archive failed: %v", err)
+		}
+	}
 	// use the rocksdb backup/checkpoint interface to backup data
 	si.BackupInfo = kvsm.store.Backup(term, index)
 	if si.BackupInfo == nil {
@@ -545,6 +618,22 @@ func prepareSnapshotForStore(store *KVStore, machineConfig MachineConfig,
 	return err
 }
 
+// for remote snapshot, we transfer the files from the http api of the remote node by default,
+// and the path is relative to the data root of the remote node.
+// If rsync is configured or the remote node is not upgraded to support the http api,
+// we do rsync from remote module.
+func getRemoteSyncAddr(machineConfig MachineConfig, ssi common.SnapshotSyncInfo, fullNS string) (string, string) {
+	if machineConfig.UseRsyncTransfer {
+		return ssi.RemoteAddr, path.Join(ssi.RsyncModule, fullNS)
+	}
+	httpAddr := common.HTTPScheme() + "://" + ssi.RemoteAddr + ":" + ssi.HttpAPIPort
+	if !common.IsNativeFileSyncSupported(httpAddr) {
+		nodeLog.Infof("remote node %v has no snapshot file api, fall back to rsync", httpAddr)
+		return ssi.RemoteAddr, path.Join(ssi.RsyncModule, fullNS)
+	}
+	return httpAddr, fullNS
+}
+
 func GetValidBackupInfo(machineConfig MachineConfig,
 	clusterInfo common.IClusterInfo, fullNS string,
 	localID uint64, stopChan chan struct{},
@@ -583,7 +672,7 @@ func GetValidBackupInfo(machineConfig MachineConfig,
 		}
 
 		body, _ := raftSnapshot.Marshal()
-		uri := "http://" + ssi.RemoteAddr + ":" +
+		uri := common.HTTPScheme() + "://" + ssi.RemoteAddr + ":" +
 			ssi.HttpAPIPort + common.APICheckBackup + "/" + fullNS
 
 		// check may use long time, so we need use large timeout here, some slow disk
@@ -605,17 +694,18 @@ func GetValidBackupInfo(machineConfig MachineConfig,
 				continue
 			}
 			if useRsyncForLocal {
-				syncAddrList = append(syncAddrList, ssi.RemoteAddr)
-				syncDirList = append(syncDirList, path.Join(ssi.RsyncModule, fullNS))
+				addr, dir := getRemoteSyncAddr(machineConfig, ssi, fullNS)
+				syncAddrList = append(syncAddrList, addr)
+				syncDirList = append(syncDirList, dir)
 			} else {
 				// local node with different directory
 				syncAddrList = append(syncAddrList, "")
 				syncDirList = append(syncDirList, path.Join(ssi.DataRoot, fullNS))
 			}
 		} else {
-			// for remote snapshot, we do rsync from remote module
-			syncAddrList = append(syncAddrList, ssi.RemoteAddr)
-			syncDirList = append(syncDirList, path.Join(ssi.RsyncModule, fullNS))
+			addr, dir := getRemoteSyncAddr(machineConfig, ssi, fullNS)
+			syncAddrList = append(syncAddrList, addr)
+			syncDirList = append(syncDirList, dir)
 		}
 	}
 	if len(syncAddrList) > 0 {
@@ -665,13 +755,57 @@ func (kvsm *kvStoreSM) RestoreFromSnapshot(raftSnapshot raftpb.Snapshot, stop ch
 	if enableSnapApplyRestoreStorageTest {
 		return errors.New("failed to restore from snapshot in failed test")
 	}
-	return kvsm.store.Restore(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index)
+	err := kvsm.store.Restore(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index)
+	kvsm.loadSplitState()
+	return err
 }
 
 func (kvsm *kvStoreSM) ApplyRaftConfRequest(req raftpb.ConfChange, term uint64, index uint64, stop chan struct{}) error {
+	// keep the archived logs continuous
+	kvsm.archiveRaftLog(nil, term, index, 0)
 	return nil
 }
 
+func (kvsm *kvStoreSM) archiveRaftLog(reqList *BatchInternalRaftRequest, term uint64, index uint64, ts int64) {
+	if kvsm.archiver == nil {
+		return
+	}
+	var data []byte
+	if reqList != nil && len(reqList.Reqs) > 0 {
+		var err error
+		data, err = reqList.Marshal()
+		if err != nil {
+			kvsm.Errorf("marshal raft log %v-%v for archive failed: %v", term, index, err)
+			return
+		}
+		if ts == 0 {
+			ts = reqList.Reqs[0].Header.Timestamp
+		}
+	}
+	err := kvsm.archiver.append(term, index, ts, data)
+	if err != nil {
+		// the archive will have a gap, and the restore can not go across it
+		kvsm.Errorf("archive raft log %v-%v failed: %v", term, index, err)
+		metric.ErrorCnt.With(ps.Labels{
+			"namespace":  kvsm.fullNS,
+			"error_info": "raft_log_archive_failed",
+		}).Inc()
+	}
+}
+
+// should be called after the write command is committed to db, the notifications are
+// only fired for the new writes.
+func (kvsm *kvStoreSM) onCmdApplied(isReplaying bool, cmdName string, cmd redcon.Command) {
+	if kvsm.appliedRecorder != nil {
+		kvsm.appliedRecorder(cmdName, cmd)
+	}
+	if isReplaying {
+		return
+	}
+	kvsm.notifyKeyspace(cmdName, cmd)
+	kvsm.wakeListWaiters(cmdName, cmd)
+}
+
 func (kvsm *kvStoreSM) preCheckConflict(cmd redcon.Command, reqTs int64) ConflictState {
 	cmdName := strings.ToLower(string(cmd.Args[0]))
 	h, ok := kvsm.cRouter.GetHandler(cmdName)
@@ -704,7 +838,7 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 	}
 	// TODO: maybe we can merge the same write with same key and value to avoid too much hot write on the same key-value
 	var retErr error
-	for _, req := range reqList.Reqs {
+	for i, req := range reqList.Reqs {
 		reqTs := ts
 		if reqTs == 0 {
 			reqTs = req.Header.Timestamp
@@ -713,6 +847,17 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 		if reqID == 0 {
 			reqID = reqList.ReqId
 		}
+		if req.Header.DataType == int32(MultiExecReq) {
+			// all the requests after the multi exec meta are the queued commands
+			batch.CommitBatch()
+			kvsm.applyMultiExec(isReplaying, reqList.Type == FromClusterSyncer, batch, req, reqList.Reqs[i+1:], reqTs, index)
+			break
+		}
+		if req.Header.DataType == int32(ScriptReq) {
+			batch.CommitBatch()
+			kvsm.applyScript(isReplaying, reqList.Type == FromClusterSyncer, batch, req, reqID, reqTs, index)
+			continue
+		}
 		if req.Header.DataType == int32(RedisReq) || req.Header.DataType == int32(RedisV2Req) {
 			cmd, err := redcon.Parse(req.Data)
 			if err != nil {
@@ -726,7 +871,18 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 				// we need compare the key timestamp in this cluster and the timestamp from raft request to handle
 				// the conflict change between two cluster.
 				//
-				if !isReplaying && reqList.Type == FromClusterSyncer && !IsSyncerOnly() {
+				if reqList.Type == FromClusterSyncer && !IsSyncerOnly() && IsActiveActiveSync() {
+					// both clusters are writable, the write from the other cluster is resolved with the local writes.
+					// The conflict meta is kept in db, so it is resolved the same while replaying. The batched writes
+					// should be committed first to read the newest versions.
+					batch.CommitBatch()
+					var apply bool
+					cmd, apply = kvsm.resolveRemoteWrite(cmd, reqTs, reqList.OrigCluster)
+					if !apply {
+						kvsm.w.Trigger(reqID, nil)
+						continue
+					}
+				} else if !isReplaying && reqList.Type == FromClusterSyncer && !IsSyncerOnly() {
 					// syncer only no need check conflict since it will be no write from redis api
 					conflict := kvsm.preCheckConflict(cmd, reqTs)
 					if conflict == Conflict {
@@ -749,7 +905,24 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 				cmdStart := time.Now()
 				cmdName := strings.ToLower(string(cmd.Args[0]))
 				pk := cmd.Args[1]
-				if batch.IsBatchable(cmdName, string(pk), cmd.Args) {
+				if err := kvsm.checkSplitFence(cmdName, cmd, index); err != nil {
+					kvsm.w.Trigger(reqID, err)
+					continue
+				}
+				batchable := batch.IsBatchable(cmdName, string(pk), cmd.Args)
+				if !batchable {
+					batch.CommitBatch()
+				}
+				var conflictTargets []conflictTarget
+				if !IsSyncerOnly() && IsActiveActiveSync() {
+					var needReplay bool
+					conflictTargets, needReplay = kvsm.prepareConflictMeta(cmdName, cmd, reqTs)
+					if needReplay && batchable {
+						batch.CommitBatch()
+						batchable = false
+					}
+				}
+				if batchable {
 					if !batch.IsBatched() {
 						err := batch.BeginBatch()
 						if err != nil {
@@ -758,8 +931,6 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 							continue
 						}
 					}
-				} else {
-					batch.CommitBatch()
 				}
 				h, ok := kvsm.router.GetInternalCmdHandler(cmdName)
 				if !ok {
@@ -788,13 +959,19 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 								"namespace": kvsm.fullNS,
 							}).Observe(float64(len(cmd.Raw)))
 						}
+						if len(conflictTargets) > 0 {
+							kvsm.updateConflictMeta(cmdName, v, conflictTargets, reqTs)
+						}
 						if batch.IsBatched() {
+							batch.AddBatchNotify(cmdName, cmd, isReplaying)
 							batch.AddBatchRsp(reqID, v)
 							if nodeLog.Level() > common.LOG_DETAIL {
 								kvsm.Infof("batching write command:%v, %v", cmdName, string(cmd.Raw))
 							}
 							kvsm.dbWriteStats.UpdateSizeStats(int64(len(cmd.Raw)))
 						} else {
+							// not batched write is committed by the handler
+							kvsm.onCmdApplied(isReplaying, cmdName, cmd)
 							kvsm.w.Trigger(reqID, v)
 							cmdCost := time.Since(cmdStart)
 							slow.LogSlowDBWrite(cmdCost, slow.NewSlowLogInfo(kvsm.fullNS, string(cmd.Raw), ""))
@@ -816,7 +993,7 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 			batch.CommitBatch()
 
 			if req.Header.DataType == int32(CustomReq) {
-				forceBackup, retErr = kvsm.handleCustomRequest(reqList.Type == FromClusterSyncer, &req, reqID, stop)
+				forceBackup, retErr = kvsm.handleCustomRequest(reqList.Type == FromClusterSyncer, &req, reqID, index, stop)
 			} else if req.Header.DataType == int32(SchemaChangeReq) {
 				kvsm.Infof("handle schema change: %v", string(req.Data))
 				var sc SchemaChange
@@ -856,10 +1033,11 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 	if reqList.ReqId > 0 {
 		kvsm.w.Trigger(reqList.ReqId, nil)
 	}
+	kvsm.archiveRaftLog(&reqList, term, index, ts)
 	return forceBackup, retErr
 }
 
-func (kvsm *kvStoreSM) handleCustomRequest(fromClusterSyncer bool, req *InternalRaftRequest, reqID uint64, stop chan struct{}) (bool, error) {
+func (kvsm *kvStoreSM) handleCustomRequest(fromClusterSyncer bool, req *InternalRaftRequest, reqID uint64, index uint64, stop chan struct{}) (bool, error) {
 	var p customProposeData
 	var forceBackup bool
 	var retErr error
@@ -938,6 +1116,15 @@ func (kvsm *kvStoreSM) handleCustomRequest(fromClusterSyncer bool, req *Internal
 	} else if p.ProposeOp == ProposeOp_ApplySkippedRemoteSnap {
 		kvsm.Infof("apply remote skip snap %v ", p)
 		kvsm.w.Trigger(reqID, nil)
+	} else if p.ProposeOp == ProposeOp_SplitBarrier {
+		if fromClusterSyncer {
+			// the partitions in remote cluster may be different
+			kvsm.Infof("ignore split barrier from cluster syncer: %v", string(p.Data))
+			err = nil
+		} else {
+			err = kvsm.handleSplitBarrier(p.Data, index)
+		}
+		kvsm.w.Trigger(reqID, err)
 	} else {
 		kvsm.w.Trigger(reqID, errUnknownData)
 	}
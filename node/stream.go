@@ -0,0 +1,498 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var errStreamOptionNotSupported = errors.New("ERR the stream option is not supported")
+
+// WriteStreamEntries write the entries as the redis stream reply, the deleted entry
+// in the pending history is written as the id with nil fields.
+func WriteStreamEntries(conn redcon.Conn, entries []rockredis.StreamEntry) {
+	conn.WriteArray(len(entries))
+	for _, e := range entries {
+		conn.WriteArray(2)
+		conn.WriteBulkString(e.ID.String())
+		if e.Fields == nil {
+			conn.WriteArray(-1)
+			continue
+		}
+		conn.WriteArray(len(e.Fields))
+		for _, f := range e.Fields {
+			conn.WriteBulk(f)
+		}
+	}
+}
+
+// parse the id in the xrange, '-' and '+' is the min and max id, the id with '(' prefix
+// is exclusive. Return false if the exclusive id is out of range.
+func parseStreamRangeID(arg []byte, isStart bool) (rockredis.StreamID, bool, error) {
+	if len(arg) == 1 && arg[0] == '-' {
+		return rockredis.MinStreamID, true, nil
+	}
+	if len(arg) == 1 && arg[0] == '+' {
+		return rockredis.MaxStreamID, true, nil
+	}
+	exclusive := false
+	if len(arg) > 0 && arg[0] == '(' {
+		exclusive = true
+		arg = arg[1:]
+	}
+	var missingSeq uint64
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	id, err := rockredis.ParseStreamID(arg, missingSeq)
+	if err != nil || !exclusive {
+		return id, true, err
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Next()
+	} else {
+		id, ok = id.Prev()
+	}
+	return id, ok, nil
+}
+
+// parse the id for the consumer group, '$' means the last entry id
+func parseStreamGroupID(arg []byte) (rockredis.StreamID, bool, error) {
+	if len(arg) == 1 && arg[0] == '$' {
+		return rockredis.StreamID{}, true, nil
+	}
+	id, err := rockredis.ParseStreamID(arg, 0)
+	return id, false, err
+}
+
+func parseStreamIDs(args [][]byte) ([]rockredis.StreamID, error) {
+	ids := make([]rockredis.StreamID, 0, len(args))
+	for _, arg := range args {
+		id, err := rockredis.ParseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// xadd key [MAXLEN [=|~] threshold] id field value [field value ...]
+// the approximate trimming is handled as the exact trimming.
+func parseXAddArgs(args [][]byte) (int64, []byte, [][]byte, error) {
+	maxLen := int64(-1)
+	i := 2
+	for i < len(args) && strings.ToLower(string(args[i])) == "maxlen" {
+		i++
+		if i < len(args) && (string(args[i]) == "~" || string(args[i]) == "=") {
+			i++
+		}
+		if i >= len(args) {
+			return 0, nil, nil, common.ErrInvalidArgs
+		}
+		var err error
+		maxLen, err = strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil || maxLen < 0 {
+			return 0, nil, nil, common.ErrInvalidArgs
+		}
+		i++
+	}
+	if i >= len(args) {
+		return 0, nil, nil, common.ErrInvalidArgs
+	}
+	id := args[i]
+	fvs := args[i+1:]
+	if len(fvs) == 0 || len(fvs)%2 != 0 {
+		return 0, nil, nil, fmt.Errorf("ERR wrong number arguments for '%v' command", string(args[0]))
+	}
+	return maxLen, id, fvs, nil
+}
+
+// xtrim key MAXLEN|MINID [=|~] threshold
+func parseXTrimArgs(args [][]byte) (int64, rockredis.StreamID, error) {
+	if len(args) != 4 && len(args) != 5 {
+		return 0, rockredis.StreamID{}, fmt.Errorf("ERR wrong number arguments for '%v' command", string(args[0]))
+	}
+	threshold := args[len(args)-1]
+	if len(args) == 5 && string(args[3]) != "~" && string(args[3]) != "=" {
+		return 0, rockredis.StreamID{}, common.ErrInvalidArgs
+	}
+	switch strings.ToLower(string(args[2])) {
+	case "maxlen":
+		maxLen, err := strconv.ParseInt(string(threshold), 10, 64)
+		if err != nil || maxLen < 0 {
+			return 0, rockredis.StreamID{}, common.ErrInvalidArgs
+		}
+		return maxLen, rockredis.StreamID{}, nil
+	case "minid":
+		minID, err := rockredis.ParseStreamID(threshold, 0)
+		return -1, minID, err
+	default:
+		return 0, rockredis.StreamID{}, common.ErrInvalidArgs
+	}
+}
+
+// xclaim key group consumer min-idle-time id [id ...] [JUSTID]
+func parseXClaimArgs(args [][]byte) (int64, []rockredis.StreamID, bool, error) {
+	minIdle, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil {
+		return 0, nil, false, common.ErrInvalidArgs
+	}
+	ids := make([]rockredis.StreamID, 0, len(args)-5)
+	justID := false
+	for _, arg := range args[5:] {
+		if strings.ToLower(string(arg)) == "justid" {
+			justID = true
+			continue
+		}
+		if justID {
+			return 0, nil, false, errStreamOptionNotSupported
+		}
+		id, err := rockredis.ParseStreamID(arg, 0)
+		if err != nil {
+			return 0, nil, false, errStreamOptionNotSupported
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return 0, nil, false, common.ErrInvalidArgs
+	}
+	return minIdle, ids, justID, nil
+}
+
+func (nd *KVNode) xlenCommand(conn redcon.Conn, cmd redcon.Command) {
+	n, err := nd.store.XLen(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteInt64(n)
+}
+
+func (nd *KVNode) xrangeFunc(conn redcon.Conn, cmd redcon.Command, reverse bool) {
+	if len(cmd.Args) != 4 && len(cmd.Args) != 6 {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	startArg, endArg := cmd.Args[2], cmd.Args[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, ok1, err := parseStreamRangeID(startArg, true)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	end, ok2, err := parseStreamRangeID(endArg, false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	count := 0
+	if len(cmd.Args) == 6 {
+		if strings.ToLower(string(cmd.Args[4])) != "count" {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		if count, err = strconv.Atoi(string(cmd.Args[5])); err != nil {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		if count <= 0 {
+			conn.WriteArray(0)
+			return
+		}
+	}
+	if !ok1 || !ok2 {
+		conn.WriteArray(0)
+		return
+	}
+	entries, err := nd.store.XRange(cmd.Args[1], start, end, count, reverse)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	WriteStreamEntries(conn, entries)
+}
+
+func (nd *KVNode) xrangeCommand(conn redcon.Conn, cmd redcon.Command) {
+	nd.xrangeFunc(conn, cmd, false)
+}
+
+func (nd *KVNode) xrevrangeCommand(conn redcon.Conn, cmd redcon.Command) {
+	nd.xrangeFunc(conn, cmd, true)
+}
+
+// xpending key group [start end count [consumer]]
+func (nd *KVNode) xpendingCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) == 3 {
+		summary, err := nd.store.XPendingSummary(cmd.Args[1], cmd.Args[2])
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteArray(4)
+		conn.WriteInt64(summary.Count)
+		if summary.Count == 0 {
+			conn.WriteNull()
+			conn.WriteNull()
+			conn.WriteArray(-1)
+			return
+		}
+		conn.WriteBulkString(summary.MinID.String())
+		conn.WriteBulkString(summary.MaxID.String())
+		conn.WriteArray(len(summary.Consumers))
+		for _, c := range summary.Consumers {
+			conn.WriteArray(2)
+			conn.WriteBulk(c.Consumer)
+			conn.WriteBulkString(strconv.FormatInt(c.Count, 10))
+		}
+		return
+	}
+	if len(cmd.Args) != 6 && len(cmd.Args) != 7 {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	start, ok1, err := parseStreamRangeID(cmd.Args[3], true)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	end, ok2, err := parseStreamRangeID(cmd.Args[4], false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	count, err := strconv.Atoi(string(cmd.Args[5]))
+	if err != nil {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	if count <= 0 || !ok1 || !ok2 {
+		conn.WriteArray(0)
+		return
+	}
+	var consumer []byte
+	if len(cmd.Args) == 7 {
+		consumer = cmd.Args[6]
+	}
+	pendings, err := nd.store.XPending(cmd.Args[1], cmd.Args[2], start, end, count, consumer)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	conn.WriteArray(len(pendings))
+	for _, p := range pendings {
+		conn.WriteArray(4)
+		conn.WriteBulkString(p.ID.String())
+		conn.WriteBulk(p.Consumer)
+		idle := now - p.DeliveryTime
+		if idle < 0 {
+			idle = 0
+		}
+		conn.WriteInt64(idle)
+		conn.WriteInt64(p.DeliveryCount)
+	}
+}
+
+func (nd *KVNode) xttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.StreamTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) xKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.XKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) xaddCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 5 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if err := common.CheckKey(cmd.Args[1]); err != nil {
+		return nil, err
+	}
+	// check the arguments before propose to raft
+	_, id, _, err := parseXAddArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	if len(id) != 1 || id[0] != '*' {
+		if _, err := rockredis.ParseStreamID(bytes.TrimSuffix(id, []byte("-*")), 0); err != nil {
+			return nil, err
+		}
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, checkAndRewriteBulkRsp)
+}
+
+func (nd *KVNode) xtrimCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 4 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if err := common.CheckKey(cmd.Args[1]); err != nil {
+		return nil, err
+	}
+	if _, _, err := parseXTrimArgs(cmd.Args); err != nil {
+		return nil, err
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, checkAndRewriteIntRsp)
+}
+
+// StreamRead read at most count entries after the id from the stream key without namespace,
+// the id '$' means only the new added entries which will always return empty since blocking
+// is not supported.
+func (nd *KVNode) StreamRead(key []byte, id []byte, count int) ([]rockredis.StreamEntry, error) {
+	if len(id) == 1 && id[0] == '$' {
+		return nil, nil
+	}
+	start, err := rockredis.ParseStreamID(id, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, ok := start.Next()
+	if !ok {
+		return nil, nil
+	}
+	if count <= 0 || count > rockredis.MAX_BATCH_NUM {
+		count = rockredis.MAX_BATCH_NUM
+	}
+	return nd.store.XRange(key, start, rockredis.MaxStreamID, count, false)
+}
+
+// StreamReadGroup read the entries for the consumer in the group from the stream key without
+// namespace. Since the last delivered id and the pending list will be changed, the read will be
+// proposed to raft.
+func (nd *KVNode) StreamReadGroup(key []byte, group []byte, consumer []byte, id []byte,
+	count int, noAck bool) ([]rockredis.StreamEntry, error) {
+	noAckArg := []byte("0")
+	if noAck {
+		noAckArg = []byte("1")
+	}
+	cmd := buildCommand([][]byte{[]byte("xreadgroup"), key, group, consumer, id,
+		[]byte(strconv.Itoa(count)), noAckArg})
+	rsp, err := nd.RedisPropose(cmd.Raw)
+	if err != nil {
+		return nil, err
+	}
+	entries, ok := rsp.([]rockredis.StreamEntry)
+	if !ok {
+		return nil, errInvalidResponse
+	}
+	return entries, nil
+}
+
+func (kvsm *kvStoreSM) localXaddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	maxLen, id, fvs, err := parseXAddArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.XAdd(ts, cmd.Args[1], id, maxLen, fvs...)
+}
+
+func (kvsm *kvStoreSM) localXdelCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	ids, err := parseStreamIDs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.XDel(ts, cmd.Args[1], ids...)
+}
+
+func (kvsm *kvStoreSM) localXtrimCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	maxLen, minID, err := parseXTrimArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.XTrim(ts, cmd.Args[1], maxLen, minID)
+}
+
+// xgroupcreate key group id|$ [mkstream]
+func (kvsm *kvStoreSM) localXgroupCreateCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	id, lastEntry, err := parseStreamGroupID(cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	mkStream := false
+	if len(cmd.Args) > 4 {
+		if strings.ToLower(string(cmd.Args[4])) != "mkstream" {
+			return nil, common.ErrInvalidArgs
+		}
+		mkStream = true
+	}
+	return nil, kvsm.store.XGroupCreate(ts, cmd.Args[1], cmd.Args[2], id, lastEntry, mkStream)
+}
+
+// xgroupsetid key group id|$
+func (kvsm *kvStoreSM) localXgroupSetIDCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	id, lastEntry, err := parseStreamGroupID(cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	return nil, kvsm.store.XGroupSetID(ts, cmd.Args[1], cmd.Args[2], id, lastEntry)
+}
+
+func (kvsm *kvStoreSM) localXgroupDestroyCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.XGroupDestroy(ts, cmd.Args[1], cmd.Args[2])
+}
+
+// xreadgroup key group consumer id count noack
+func (kvsm *kvStoreSM) localXreadgroupCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if len(cmd.Args) != 7 {
+		return nil, common.ErrInvalidArgs
+	}
+	count, err := strconv.Atoi(string(cmd.Args[5]))
+	if err != nil {
+		return nil, common.ErrInvalidArgs
+	}
+	noAck := string(cmd.Args[6]) == "1"
+	return kvsm.store.XReadGroup(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3], cmd.Args[4], count, noAck)
+}
+
+func (kvsm *kvStoreSM) localXackCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	ids, err := parseStreamIDs(cmd.Args[3:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.XAck(ts, cmd.Args[1], cmd.Args[2], ids...)
+}
+
+func (kvsm *kvStoreSM) localXclaimCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	minIdle, ids, justID, err := parseXClaimArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := kvsm.store.XClaim(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3], minIdle, justID, ids...)
+	if err != nil || !justID {
+		return entries, err
+	}
+	claimed := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		claimed = append(claimed, []byte(e.ID.String()))
+	}
+	return claimed, nil
+}
+
+func (kvsm *kvStoreSM) localXclearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.XClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localXmclearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.XMclear(cmd.Args[1:]...)
+}
@@ -26,6 +26,7 @@ func init() {
 	expireCmds[common.LIST] = []byte("lmclear")
 	expireCmds[common.SET] = []byte("smclear")
 	expireCmds[common.ZSET] = []byte("zmclear")
+	expireCmds[common.STREAM] = []byte("xmclear")
 }
 
 func (kvsm *kvStoreSM) localSetexCommand(cmd redcon.Command, ts int64) (interface{}, error) {
@@ -76,6 +77,14 @@ func (kvsm *kvStoreSM) localZSetExpireCommand(cmd redcon.Command, ts int64) (int
 	}
 }
 
+func (kvsm *kvStoreSM) localStreamExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if duration, err := strconv.Atoi(string(cmd.Args[2])); err != nil {
+		return int64(0), err
+	} else {
+		return kvsm.store.XExpire(ts, cmd.Args[1], int64(duration))
+	}
+}
+
 func (kvsm *kvStoreSM) localBitExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	if duration, err := strconv.Atoi(string(cmd.Args[2])); err != nil {
 		return int64(0), err
@@ -104,6 +113,10 @@ func (kvsm *kvStoreSM) localZSetPersistCommand(cmd redcon.Command, ts int64) (in
 	return kvsm.store.ZPersist(ts, cmd.Args[1])
 }
 
+func (kvsm *kvStoreSM) localStreamPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.XPersist(ts, cmd.Args[1])
+}
+
 func (kvsm *kvStoreSM) localBitPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	return kvsm.store.BitPersist(ts, cmd.Args[1])
 }
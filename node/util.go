@@ -2,6 +2,8 @@ package node
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -13,6 +15,7 @@ var nodeLog = common.NewLevelLogger(common.LOG_INFO, common.NewLogger())
 var syncerOnly int32
 var logMaybeConflictDisabled int32
 var syncerOnlyChangedTs int64
+var activeActiveSync int32
 
 func SetLogLevel(level int) {
 	nodeLog.SetLevel(int32(level))
@@ -52,6 +55,20 @@ func IsSyncerOnly() bool {
 	return atomic.LoadInt32(&syncerOnly) == 1
 }
 
+// SetActiveActiveSync enable the bidirectional sync between clusters, both clusters are
+// writable and the writes from the other cluster are resolved with the local writes.
+func SetActiveActiveSync(enable bool) {
+	if enable {
+		atomic.StoreInt32(&activeActiveSync, 1)
+	} else {
+		atomic.StoreInt32(&activeActiveSync, 0)
+	}
+}
+
+func IsActiveActiveSync() bool {
+	return atomic.LoadInt32(&activeActiveSync) == 1
+}
+
 func checkOKRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
 	return "OK", nil
 }
@@ -63,6 +80,22 @@ func checkAndRewriteIntRsp(cmd redcon.Command, v interface{}) (interface{}, erro
 	return nil, errInvalidResponse
 }
 
+// the float is returned as the bulk string the same as stored
+func checkAndRewriteFloatRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
+	if rsp, ok := v.(float64); ok {
+		return []byte(strconv.FormatFloat(rsp, 'f', -1, 64)), nil
+	}
+	return nil, errInvalidResponse
+}
+
+func parseFloatIncrement(v []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errInvalidFloat
+	}
+	return f, nil
+}
+
 func checkAndRewriteBulkRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
 	if v == nil {
 		return nil, nil
@@ -109,6 +142,42 @@ func rebuildFirstKeyAndPropose(kvn *KVNode, cmd redcon.Command, f common.Command
 	return rsp, err
 }
 
+// the namespace of the first keyNum keys in the command will be cut before propose,
+// the command with multi keys should make sure all the keys are in the same partition.
+func rebuildKeysAndPropose(kvn *KVNode, cmd redcon.Command, keyNum int, f common.CommandRspFunc) (interface{}, error) {
+	indexes := make([]int, 0, keyNum)
+	for i := 1; i <= keyNum; i++ {
+		indexes = append(indexes, i)
+	}
+	return rebuildKeyIndexesAndPropose(kvn, cmd, indexes, f)
+}
+
+// same as rebuildKeysAndPropose, but the keys are at the given indexes in the command
+func rebuildKeyIndexesAndPropose(kvn *KVNode, cmd redcon.Command, indexes []int, f common.CommandRspFunc) (interface{}, error) {
+	args := make([][]byte, len(cmd.Args))
+	copy(args, cmd.Args)
+	for _, i := range indexes {
+		if i >= len(args) {
+			break
+		}
+		key, err := common.CutNamesapce(args[i])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = key
+	}
+	rsp, err := kvn.RedisProposeAsync(buildCommand(args).Raw)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		rsp.rspHandle = func(r interface{}) (interface{}, error) {
+			return f(cmd, r)
+		}
+	}
+	return rsp, nil
+}
+
 func wrapReadCommandK(f common.CommandFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 2 {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -13,7 +14,9 @@ import (
 )
 
 var (
-	errInvalidRange = errors.New("Invalid range string")
+	errInvalidRange        = errors.New("Invalid range string")
+	errZStoreNoKey         = errors.New("ERR at least 1 input key is needed for zunionstore/zinterstore")
+	errZStoreInvalidWeight = errors.New("ERR weight value is not a float")
 )
 
 func getScoreRange(left []byte, right []byte) (float64, float64, error) {
@@ -483,6 +486,134 @@ func (nd *KVNode) zremrangebylexCommand(cmd redcon.Command) (interface{}, error)
 	return v, nil
 }
 
+// ZStoreSrcKeys return the source keys of zunionstore and zinterstore, nil if the numkeys is invalid.
+// zunionstore destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func ZStoreSrcKeys(args [][]byte) [][]byte {
+	if len(args) < 4 {
+		return nil
+	}
+	n, err := strconv.Atoi(string(args[2]))
+	if err != nil || n < 1 || n > len(args)-3 {
+		return nil
+	}
+	return args[3 : 3+n]
+}
+
+func parseZStoreArgs(args [][]byte) ([][]byte, []float64, byte, error) {
+	if len(args) < 4 {
+		return nil, nil, 0, fmt.Errorf("ERR wrong number arguments for '%v' command", string(args[0]))
+	}
+	n, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, nil, 0, common.ErrInvalidArgs
+	}
+	if n < 1 {
+		return nil, nil, 0, errZStoreNoKey
+	}
+	keys := ZStoreSrcKeys(args)
+	if keys == nil {
+		return nil, nil, 0, errSyntaxError
+	}
+	var weights []float64
+	aggregate := rockredis.AggregateSum
+	opts := args[3+n:]
+	for len(opts) > 0 {
+		switch strings.ToLower(string(opts[0])) {
+		case "weights":
+			if len(opts) < n+1 {
+				return nil, nil, 0, errSyntaxError
+			}
+			weights = make([]float64, 0, n)
+			for _, w := range opts[1 : n+1] {
+				v, err := strconv.ParseFloat(string(w), 64)
+				if err != nil || math.IsNaN(v) {
+					return nil, nil, 0, errZStoreInvalidWeight
+				}
+				weights = append(weights, v)
+			}
+			opts = opts[n+1:]
+		case "aggregate":
+			if len(opts) < 2 {
+				return nil, nil, 0, errSyntaxError
+			}
+			switch strings.ToLower(string(opts[1])) {
+			case "sum":
+				aggregate = rockredis.AggregateSum
+			case "min":
+				aggregate = rockredis.AggregateMin
+			case "max":
+				aggregate = rockredis.AggregateMax
+			default:
+				return nil, nil, 0, errSyntaxError
+			}
+			opts = opts[2:]
+		default:
+			return nil, nil, 0, errSyntaxError
+		}
+	}
+	return keys, weights, aggregate, nil
+}
+
+// all the keys should be in the same partition, it is checked before the command is handled
+func (nd *KVNode) zsetStoreCommand(cmd redcon.Command) (interface{}, error) {
+	keys, _, _, err := parseZStoreArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	indexes := make([]int, 0, len(keys)+1)
+	indexes = append(indexes, 1)
+	for i := range keys {
+		indexes = append(indexes, 3+i)
+	}
+	return rebuildKeyIndexesAndPropose(nd, cmd, indexes, checkAndRewriteIntRsp)
+}
+
+// zpopmin key [count]
+// zpopmax key [count]
+func (nd *KVNode) zpopCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 3 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if len(cmd.Args) == 3 {
+		cnt, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil || cnt < 0 {
+			return nil, common.ErrInvalidArgs
+		}
+		if cnt > common.MAX_BATCH_NUM {
+			return nil, errTooMuchBatchSize
+		}
+		if cnt == 0 {
+			return [][]byte{}, nil
+		}
+	}
+	key, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	// no need propose for the empty zset
+	n, err := nd.store.ZCard(key)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return [][]byte{}, nil
+	}
+	return rebuildFirstKeyAndPropose(nd, cmd, nil)
+}
+
+// the popped members and scores in the redis response format
+func zpopRsp(vals []common.ScorePair) [][]byte {
+	rsp := make([][]byte, 0, len(vals)*2)
+	for _, v := range vals {
+		rsp = append(rsp, v.Member, []byte(strconv.FormatFloat(v.Score, 'g', -1, 64)))
+	}
+	return rsp
+}
+
 func getScorePairs(args [][]byte) ([]common.ScorePair, error) {
 	mlist := make([]common.ScorePair, 0, len(args)/2)
 	for i := 0; i < len(args); i += 2 {
@@ -553,6 +684,48 @@ func (kvsm *kvStoreSM) localZremrangebylexCommand(cmd redcon.Command, ts int64)
 	return kvsm.store.ZRemRangeByLex(ts, cmd.Args[1], min, max, rt)
 }
 
+func (kvsm *kvStoreSM) localZunionstoreCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	keys, weights, aggregate, err := parseZStoreArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.ZUnionStore(ts, cmd.Args[1], keys, weights, aggregate)
+}
+
+func (kvsm *kvStoreSM) localZinterstoreCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	keys, weights, aggregate, err := parseZStoreArgs(cmd.Args)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.ZInterStore(ts, cmd.Args[1], keys, weights, aggregate)
+}
+
+func (kvsm *kvStoreSM) localZpopCommand(cmd redcon.Command, ts int64, reverse bool) (interface{}, error) {
+	cnt := 1
+	if len(cmd.Args) == 3 {
+		cnt, _ = strconv.Atoi(string(cmd.Args[2]))
+	}
+	var vals []common.ScorePair
+	var err error
+	if reverse {
+		vals, err = kvsm.store.ZPopMax(ts, cmd.Args[1], cnt)
+	} else {
+		vals, err = kvsm.store.ZPopMin(ts, cmd.Args[1], cnt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zpopRsp(vals), nil
+}
+
+func (kvsm *kvStoreSM) localZpopminCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.localZpopCommand(cmd, ts, false)
+}
+
+func (kvsm *kvStoreSM) localZpopmaxCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.localZpopCommand(cmd, ts, true)
+}
+
 func (kvsm *kvStoreSM) localZclearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	if len(cmd.Args) != 2 {
 		return nil, common.ErrInvalidArgs
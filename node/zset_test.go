@@ -11,6 +11,7 @@ import (
 func TestKVNode_zsetCommand(t *testing.T) {
 	nd, dataDir, stopC := getTestKVNode(t)
 	testKey := []byte("default:test:1")
+	testDestKey := []byte("default:test:dest")
 	testMember := []byte("1")
 	testScore := []byte("1")
 	testLrange := []byte("(1")
@@ -56,6 +57,10 @@ func TestKVNode_zsetCommand(t *testing.T) {
 		{"zkeyexist", buildCommand([][]byte{[]byte("zkeyexist"), testKey})},
 		{"zexpire", buildCommand([][]byte{[]byte("zexpire"), testKey, []byte("10")})},
 		{"zpersist", buildCommand([][]byte{[]byte("zpersist"), testKey})},
+		{"zunionstore", buildCommand([][]byte{[]byte("zunionstore"), testDestKey, []byte("1"), testKey, []byte("weights"), []byte("2"), []byte("aggregate"), []byte("max")})},
+		{"zinterstore", buildCommand([][]byte{[]byte("zinterstore"), testDestKey, []byte("2"), testKey, testDestKey})},
+		{"zpopmin", buildCommand([][]byte{[]byte("zpopmin"), testDestKey})},
+		{"zpopmax", buildCommand([][]byte{[]byte("zpopmax"), testKey, []byte("2")})},
 		{"zclear", buildCommand([][]byte{[]byte("zclear"), testKey})},
 	}
 	defer os.RemoveAll(dataDir)
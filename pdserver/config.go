@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/youzan/ZanRedisDB/cluster/pdnode_coord"
+	"github.com/youzan/ZanRedisDB/common"
 )
 
 type ServerConfig struct {
@@ -27,6 +28,25 @@ type ServerConfig struct {
 	LearnerRole      string `flag:"learner-role" cfg:"learner_role"`
 	FilterNamespaces string `flag:"filter-namespaces" cfg:"filter_namespaces"`
 	BalanceVer       string `flag:"balance-ver" cfg:"balance_ver"`
+
+	// the certificates used to access the data nodes with tls enabled
+	TLSCertFile       string `flag:"tls-cert-file" cfg:"tls_cert_file"`
+	TLSKeyFile        string `flag:"tls-key-file" cfg:"tls_key_file"`
+	TLSCAFile         string `flag:"tls-ca-file" cfg:"tls_ca_file"`
+	TLSServerName     string `flag:"tls-server-name" cfg:"tls_server_name"`
+	TLSClientCertAuth bool   `flag:"tls-client-cert-auth" cfg:"tls_client_cert_auth"`
+	// serve the http api of placedriver with tls, the clients should query with https
+	TLSHTTPAPI bool `flag:"tls-http-api" cfg:"tls_http_api"`
+}
+
+func (c *ServerConfig) GetTLSConfig() common.TLSConfig {
+	return common.TLSConfig{
+		CertFile:       c.TLSCertFile,
+		KeyFile:        c.TLSKeyFile,
+		CAFile:         c.TLSCAFile,
+		ServerName:     c.TLSServerName,
+		ClientCertAuth: c.TLSClientCertAuth,
+	}
 }
 
 func NewServerConfig() *ServerConfig {
@@ -1,6 +1,7 @@
 package pdserver
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -93,10 +95,18 @@ func (s *Server) initHttpHandler() {
 	router.Handle("POST", "/cluster/upgrade/done", common.Decorate(s.doClusterFinishUpgrade, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/create", common.Decorate(s.doCreateNamespace, log, common.V1))
 	router.Handle("DELETE", "/cluster/namespace/delete", common.Decorate(s.doDeleteNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/split", common.Decorate(s.doSplitNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/backup", common.Decorate(s.doBackupNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/restore", common.Decorate(s.doRestoreNamespace, log, common.V1))
 	router.Handle("POST", "/cluster/schema/index/add", common.Decorate(s.doAddIndexSchema, log, common.V1))
 	router.Handle("DELETE", "/cluster/schema/index/del", common.Decorate(s.doDelIndexSchema, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/meta/update", common.Decorate(s.doUpdateNamespaceMeta, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/quota/update", common.Decorate(s.doUpdateNamespaceQuota, log, common.V1))
 	router.Handle("POST", "/stable/nodenum", common.Decorate(s.doSetStableNodeNum, log, common.V1))
+	router.Handle("GET", "/cluster/auth", common.Decorate(s.getClusterAuth, log, common.V1))
+	router.Handle("POST", "/cluster/auth/switch", common.Decorate(s.doSwitchClusterAuth, log, common.V1))
+	router.Handle("POST", "/cluster/auth/user/update", common.Decorate(s.doUpdateAuthUser, log, common.V1))
+	router.Handle("DELETE", "/cluster/auth/user/del", common.Decorate(s.doDelAuthUser, log, common.V1))
 
 	router.Handle("POST", "/loglevel/set", common.Decorate(s.doSetLogLevel, log, common.V1))
 	s.router = router
@@ -196,7 +206,7 @@ func (s *Server) doQueryTableStats(w http.ResponseWriter, req *http.Request, ps
 		TableStats map[string]metric.TableStats `json:"table_stats"`
 	}
 	for _, n := range dns {
-		uri := fmt.Sprintf("http://%s:%v%v?leader_only=%v&table=%v", n.Hostname, n.HttpPort, common.APITableStats, leaderOnly, table)
+		uri := fmt.Sprintf("%s://%s:%v%v?leader_only=%v&table=%v", common.HTTPScheme(), n.Hostname, n.HttpPort, common.APITableStats, leaderOnly, table)
 		var tableStats TableStatsType
 		rspCode, err := common.APIRequest("GET", uri, nil, time.Second*10, &tableStats)
 		if err != nil {
@@ -269,6 +279,10 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 		ex = nsInfo.ExpirationPolicy
 		useFsync = nsInfo.OptimizedFsync
 		engType = nsInfo.EngType
+		if nsInfo.Partition >= nsInfo.PartitionNum {
+			// the new partition while splitting is not used until the split is done
+			continue
+		}
 		var pn PartitionNodeInfo
 		for _, nid := range nsInfo.RaftNodes {
 			n, ok := dns[nid]
@@ -489,9 +503,16 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 	} else if _, err := common.StringToExpirationPolicy(expPolicy); err != nil {
 		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_EXPIRATION_POLICY"}
 	}
-	if expPolicy == common.WaitCompactExpirationPolicy {
+	if expPolicy == common.WaitCompactExpirationPolicy || expPolicy == common.PeriodicalRotationExpirationPolicy {
 		if dataVersion != common.ValueHeaderV1Str {
-			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_EXPIRATION_POLICY data version must be v1 in compact ttl"}
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_EXPIRATION_POLICY data version must be v1 in " + expPolicy}
+		}
+	}
+	var rotationPeriod int64
+	if periodStr := reqParams.Get("expiration_rotation_period"); periodStr != "" {
+		rotationPeriod, err = strconv.ParseInt(periodStr, 10, 64)
+		if err != nil || rotationPeriod <= 0 || expPolicy != common.PeriodicalRotationExpirationPolicy {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_EXPIRATION_ROTATION_PERIOD"}
 		}
 	}
 
@@ -514,6 +535,7 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 	meta.Replica = replicator
 	meta.EngType = engType
 	meta.ExpirationPolicy = expPolicy
+	meta.ExpirationRotationPeriod = rotationPeriod
 	meta.DataVersion = dataVersion
 	meta.Tags = make(map[string]interface{})
 	for _, tag := range tagList {
@@ -558,6 +580,119 @@ func (s *Server) doDeleteNamespace(w http.ResponseWriter, req *http.Request, ps
 	return nil, nil
 }
 
+func (s *Server) doSplitNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+
+	sLog.Infof("splitting namespace (%s)", ns)
+	err = s.pdCoord.SplitNamespacePartitions(ns)
+	if err != nil {
+		sLog.Infof("split namespace (%s) failed : %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doBackupNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	target := reqParams.Get("target")
+	if target == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_TARGET"}
+	}
+	if !filepath.IsAbs(target) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_TARGET"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+
+	sLog.Infof("backup namespace (%s) to %v", ns, target)
+	backupDir, m, err := s.pdCoord.BackupNamespace(ns, target)
+	if err != nil {
+		sLog.Infof("backup namespace (%s) failed : %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return struct {
+		BackupDir string                          `json:"backup_dir"`
+		Manifest  *common.NamespaceBackupManifest `json:"manifest"`
+	}{backupDir, m}, nil
+}
+
+func (s *Server) doRestoreNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	backupDir := reqParams.Get("backup_dir")
+	if backupDir == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_BACKUP_DIR"}
+	}
+	if !filepath.IsAbs(backupDir) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_BACKUP_DIR"}
+	}
+	// use the replicator in the backup if not specified
+	replicator := 0
+	replicatorStr := reqParams.Get("replicator")
+	if replicatorStr != "" {
+		replicator, err = GetValidReplicator(replicatorStr)
+		if err != nil {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_REPLICATOR"}
+		}
+	}
+	tags := make(map[string]interface{})
+	tagStr := reqParams.Get("tags")
+	if tagStr != "" {
+		for _, tag := range strings.Split(tagStr, ",") {
+			if strings.TrimSpace(tag) != "" {
+				tags[strings.TrimSpace(tag)] = true
+			}
+		}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+
+	sLog.Infof("restore namespace (%s) from %v", ns, backupDir)
+	err = s.pdCoord.RestoreNamespace(ns, backupDir, replicator, tags)
+	if err != nil {
+		sLog.Infof("restore namespace (%s) failed : %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
 func (s *Server) doAddIndexSchema(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -605,7 +740,23 @@ func (s *Server) doAddIndexSchema(w http.ResponseWriter, req *http.Request, ps h
 			return nil, common.HttpErr{Code: 500, Text: err.Error()}
 		}
 	} else if indexType == "json_secondary" {
-		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			sLog.Infof("read schema body error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		var meta common.JSONIndexSchema
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			sLog.Infof("schema body unmarshal error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		sLog.Infof("add json index : %v, %v", ns, meta)
+		err = s.pdCoord.AddJSONIndexSchema(ns, table, &meta)
+		if err != nil {
+			sLog.Infof("add json index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else {
 		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
 	}
@@ -655,7 +806,12 @@ func (s *Server) doDelIndexSchema(w http.ResponseWriter, req *http.Request, ps h
 			return nil, common.HttpErr{Code: 500, Text: err.Error()}
 		}
 	} else if indexType == "json_secondary" {
-		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
+		sLog.Infof("del json index : %v, %v", ns, indexName)
+		err = s.pdCoord.DelJSONIndexSchema(ns, table, indexName)
+		if err != nil {
+			sLog.Infof("del json index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else {
 		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
 	}
@@ -709,6 +865,52 @@ func (s *Server) doUpdateNamespaceMeta(w http.ResponseWriter, req *http.Request,
 
 }
 
+func (s *Server) doUpdateNamespaceQuota(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	// empty table for the whole namespace
+	table := reqParams.Get("table")
+	var limit common.QuotaLimit
+	for _, arg := range []struct {
+		name string
+		v    *int64
+	}{
+		{"max_keys", &limit.MaxKeys},
+		{"max_disk_bytes", &limit.MaxDiskBytes},
+		{"max_read_qps", &limit.MaxReadQPS},
+		{"max_write_qps", &limit.MaxWriteQPS},
+	} {
+		str := reqParams.Get(arg.name)
+		if str == "" {
+			continue
+		}
+		*arg.v, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || *arg.v < 0 {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_" + strings.ToUpper(arg.name)}
+		}
+	}
+
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.ChangeNamespaceQuota(ns, table, limit)
+	if err != nil {
+		sLog.Infof("update namespace quota failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
 func (s *Server) doStopLearner(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	err := s.pdCoord.SwitchStartLearner(false)
 	if err != nil {
@@ -781,6 +983,108 @@ func (s *Server) doSetStableNodeNum(w http.ResponseWriter, req *http.Request, ps
 	return nil, nil
 }
 
+type authUserUpdateReq struct {
+	Name     string           `json:"name"`
+	Password string           `json:"password"`
+	Disabled bool             `json:"disabled"`
+	ACLs     []common.AuthACL `json:"acls"`
+}
+
+func (s *Server) getClusterAuth(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	info, err := s.pdCoord.GetClusterAuthInfo()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	users := make([]string, 0, len(info.Users))
+	acls := make(map[string][]common.AuthACL, len(info.Users))
+	for _, u := range info.Users {
+		users = append(users, u.Name)
+		acls[u.Name] = u.ACLs
+	}
+	// never return the password hash
+	return map[string]interface{}{
+		"enabled": info.Enabled,
+		"users":   users,
+		"acls":    acls,
+	}, nil
+}
+
+func (s *Server) doSwitchClusterAuth(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	enable := reqParams.Get("enable")
+	if enable == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG"}
+	}
+	err = s.pdCoord.SwitchClusterAuth(enable == "true")
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doUpdateAuthUser(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var ureq authUserUpdateReq
+	err = json.Unmarshal(data, &ureq)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	if ureq.Name == "" || ureq.Password == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_USER_OR_PASSWORD"}
+	}
+	for _, acl := range ureq.ACLs {
+		if acl.Namespace != common.AuthMatchAll && !common.IsValidNamespaceName(acl.Namespace) {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_ARG_NAMESPACE"}
+		}
+	}
+	u := common.AuthUser{
+		Name:         ureq.Name,
+		PasswordHash: common.HashAuthPassword(ureq.Password),
+		Disabled:     ureq.Disabled,
+		ACLs:         ureq.ACLs,
+	}
+	err = s.pdCoord.AddOrUpdateAuthUser(u)
+	if err != nil {
+		sLog.Infof("update auth user %v failed: %v", ureq.Name, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doDelAuthUser(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	name := reqParams.Get("user")
+	if name == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_USER"}
+	}
+	err = s.pdCoord.DelAuthUser(name)
+	if err == cluster.ErrKeyNotFound {
+		return nil, common.HttpErr{Code: 404, Text: err.Error()}
+	}
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
 func (s *Server) doSetLogLevel(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -835,6 +1139,10 @@ func (s *Server) serveHttpAPI(addr string, stopC <-chan struct{}) {
 	if err != nil {
 		panic(err)
 	}
-	err = srv.Serve(l)
+	if s.conf.TLSHTTPAPI {
+		err = srv.Serve(tls.NewListener(l, s.tlsReloader.ServerConfig()))
+	} else {
+		err = srv.Serve(l)
+	}
 	sLog.Infof("http server stopped: %v", err)
 }
@@ -34,6 +34,7 @@ type Server struct {
 	pdCoord          *pdnode_coord.PDCoordinator
 	dataMutex        sync.Mutex
 	tombstonePDNodes map[string]bool
+	tlsReloader      *common.TLSReloader
 }
 
 func NewServer(conf *ServerConfig) (*Server, error) {
@@ -98,6 +99,17 @@ func NewServer(conf *ServerConfig) (*Server, error) {
 		tombstonePDNodes: make(map[string]bool),
 	}
 
+	if tlsConf := conf.GetTLSConfig(); tlsConf.IsEnabled() {
+		s.tlsReloader, err = common.NewTLSReloader(tlsConf)
+		if err != nil {
+			sLog.Errorf("failed to load tls certificates: %v", err)
+			return nil, err
+		}
+		common.SetClientTLS(s.tlsReloader.ClientConfig())
+	} else if conf.TLSHTTPAPI {
+		return nil, errors.New("the tls certificates should be configured for the tls http api")
+	}
+
 	r, err := cluster.NewPDEtcdRegister(conf.ClusterLeadershipAddresses)
 	if err != nil {
 		sLog.Errorf("failed to init register: %v", err)
@@ -121,6 +133,9 @@ func (s *Server) Stop() {
 	close(s.stopC)
 	s.pdCoord.Stop()
 	s.wg.Wait()
+	if s.tlsReloader != nil {
+		s.tlsReloader.Stop()
+	}
 	sLog.Infof("server stopped")
 }
 
@@ -130,6 +145,9 @@ func (s *Server) Start() {
 		sLog.Errorf("FATAL: start coordinator failed - %s", err)
 		os.Exit(1)
 	}
+	if s.tlsReloader != nil {
+		s.tlsReloader.Start()
+	}
 
 	s.wg.Add(1)
 	go func() {
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	sdk "github.com/youzan/go-zanredisdb"
+)
+
+// the read commands can be run by the user with the read only acl, all the others
+// are treated as write while checking the acl.
+var readCmds = map[string]bool{
+	"get": true, "strlen": true, "getrange": true, "getbit": true, "bitcount": true, "bitpos": true,
+	"mget": true, "exists": true, "pfcount": true,
+	"hget": true, "hgetall": true, "hkeys": true, "hvals": true, "hexists": true, "hmget": true, "hlen": true,
+	"json.get": true, "json.keyexists": true, "json.mkget": true, "json.type": true, "json.arrlen": true,
+	"json.objkeys": true, "json.objlen": true,
+	"lindex": true, "llen": true, "lrange": true, "lpos": true,
+	"zscore": true, "zcount": true, "zcard": true, "zlexcount": true, "zrange": true, "zrevrange": true,
+	"zrangebylex": true, "zrangebyscore": true, "zrevrangebyscore": true, "zrank": true, "zrevrank": true,
+	"scard": true, "sismember": true, "smembers": true, "srandmember": true,
+	"sinter": true, "sunion": true, "sdiff": true,
+	"xlen": true, "xrange": true, "xrevrange": true, "xpending": true,
+	"ttl": true, "httl": true, "lttl": true, "sttl": true, "zttl": true, "bttl": true, "xttl": true,
+	"hkeyexist": true, "lkeyexist": true, "skeyexist": true, "zkeyexist": true, "bkeyexist": true, "xkeyexist": true,
+	"hscan": true, "sscan": true, "zscan": true, "hrevscan": true, "srevscan": true, "zrevscan": true,
+	"geohash": true, "geodist": true, "geopos": true, "georadius": true, "georadiusbymember": true,
+}
+
+// load the users and acls from the auth file which is in the same json format as the cluster
+// auth info. If no auth file, the require pass is used as the password of the default user
+// which can access all the namespaces.
+func loadAuthInfo(conf *ServerConfig) (*common.AuthInfo, error) {
+	if conf.AuthFile != "" {
+		d, err := ioutil.ReadFile(conf.AuthFile)
+		if err != nil {
+			return nil, err
+		}
+		var info common.AuthInfo
+		err = json.Unmarshal(d, &info)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range info.Users {
+			if !u.IsValid() {
+				return nil, common.ErrAuthInvalidUser
+			}
+		}
+		return &info, nil
+	}
+	if conf.RequirePass == "" {
+		return nil, nil
+	}
+	return &common.AuthInfo{
+		Enabled: true,
+		Users: []common.AuthUser{
+			{
+				Name:         common.DefaultAuthUser,
+				PasswordHash: common.HashAuthPassword(conf.RequirePass),
+				ACLs:         []common.AuthACL{{Namespace: common.AuthMatchAll}},
+			},
+		},
+	}, nil
+}
+
+func (s *Server) isAuthEnabled() bool {
+	return s.authInfo != nil && s.authInfo.Enabled
+}
+
+// auth the connection with the password of the default user or the user name and password
+func (s *Server) doAuth(ctx *connContext, cmd redcon.Command) error {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 3 {
+		return errWrongNumberOfArg
+	}
+	if !s.isAuthEnabled() {
+		ctx.authed = true
+		return nil
+	}
+	name := common.DefaultAuthUser
+	pass := string(cmd.Args[1])
+	if len(cmd.Args) == 3 {
+		name = string(cmd.Args[1])
+		pass = string(cmd.Args[2])
+	}
+	u, err := s.authInfo.Authenticate(name, pass)
+	if err != nil {
+		ctx.authed = false
+		ctx.user = nil
+		return err
+	}
+	ctx.authed = true
+	ctx.user = u
+	return nil
+}
+
+// the keys of eval are after the numkeys
+func getEvalKeys(cmd redcon.Command) ([][]byte, error) {
+	if len(cmd.Args) < 3 {
+		return nil, errWrongNumberOfArg
+	}
+	n, err := strconv.Atoi(string(cmd.Args[2]))
+	if err != nil || n < 0 || 3+n > len(cmd.Args) {
+		return nil, errWrongNumberOfArg
+	}
+	return cmd.Args[3 : 3+n], nil
+}
+
+// check the user acl for all the keys in the command before forwarding to the data node
+func checkUserAccess(u *common.AuthUser, cmdName string, pks []*sdk.PKey) error {
+	if u == nil {
+		return nil
+	}
+	isWrite := !readCmds[cmdName]
+	for _, pk := range pks {
+		if err := u.CheckAccess(pk.Namespace, pk.Set, isWrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package proxy
+
+type ServerConfig struct {
+	RedisAddress  string `flag:"redis-address" cfg:"redis_address"`
+	MetricAddress string `flag:"metric-address" cfg:"metric_address"`
+	ProfilePort   string `flag:"profile-port" cfg:"profile_port"`
+
+	// the placedriver http address list, used to query the partition leaders
+	LookupList []string `flag:"lookup-list" cfg:"lookup_list"`
+	// the namespaces allowed to access through the proxy, empty means all
+	Namespaces []string `flag:"namespaces" cfg:"namespaces"`
+	// the password used to auth the data nodes
+	Password string `flag:"password" cfg:"password"`
+	// the password the redis client should auth before any command, empty means no auth
+	RequirePass string `flag:"require-pass" cfg:"require_pass"`
+	// the json file with the users and acls in the same format as the cluster auth info,
+	// the client should auth with the user name and password if set, and require pass is ignored
+	AuthFile string `flag:"auth-file" cfg:"auth_file"`
+
+	MaxActiveConn  int   `flag:"max-active-conn" cfg:"max_active_conn"`
+	MaxIdleConn    int   `flag:"max-idle-conn" cfg:"max_idle_conn"`
+	DialTimeoutMs  int   `flag:"dial-timeout-ms" cfg:"dial_timeout_ms"`
+	ReadTimeoutMs  int   `flag:"read-timeout-ms" cfg:"read_timeout_ms"`
+	WriteTimeoutMs int   `flag:"write-timeout-ms" cfg:"write_timeout_ms"`
+	TendInterval   int64 `flag:"tend-interval" cfg:"tend_interval"`
+
+	LogLevel int32  `flag:"log-level" cfg:"log_level"`
+	LogDir   string `flag:"log-dir" cfg:"log_dir"`
+}
+
+func NewServerConfig() *ServerConfig {
+	return &ServerConfig{
+		RedisAddress:  "0.0.0.0:16379",
+		MetricAddress: ":8801",
+		ProfilePort:   "6668",
+
+		MaxActiveConn:  100,
+		MaxIdleConn:    20,
+		DialTimeoutMs:  3000,
+		ReadTimeoutMs:  5000,
+		WriteTimeoutMs: 5000,
+		TendInterval:   3,
+
+		LogLevel: 1,
+		LogDir:   "",
+	}
+}
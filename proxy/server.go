@@ -0,0 +1,446 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/absolute8511/redigo/redis"
+	ps "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+	sdk "github.com/youzan/go-zanredisdb"
+)
+
+var sLog = common.NewLevelLogger(common.LOG_INFO, common.NewLogger())
+
+func SetLogger(level int32, logger common.Logger) {
+	sLog.SetLevel(level)
+	sLog.Logger = logger
+}
+
+var (
+	errAuthRequired     = errors.New("NOAUTH Authentication required")
+	errUnsupportedCmd   = errors.New("ERR command not supported by proxy")
+	errNamespaceDenied  = errors.New("ERR namespace not allowed in proxy")
+	errCrossNamespace   = errors.New("ERR all the keys should be in the same namespace")
+	errWrongNumberOfArg = errors.New("ERR wrong number of arguments")
+)
+
+// the commands need the connection state on the data node or need merge the
+// cursor from all the partitions, which can not be forwarded by the stateless proxy.
+var unsupportedCmds = map[string]bool{
+	"subscribe":    true,
+	"psubscribe":   true,
+	"unsubscribe":  true,
+	"punsubscribe": true,
+	"publish":      true,
+	"pubsub":       true,
+	"multi":        true,
+	"exec":         true,
+	"discard":      true,
+	"watch":        true,
+	"unwatch":      true,
+	"blpop":        true,
+	"brpop":        true,
+	"brpoplpush":   true,
+	"bzpopmin":     true,
+	"xread":        true,
+	"xreadgroup":   true,
+	"script":       true,
+	"select":       true,
+	"cluster":      true,
+	"detach":       true,
+}
+
+type connContext struct {
+	client string
+	authed bool
+	// nil if the auth is not enabled
+	user *common.AuthUser
+}
+
+type Server struct {
+	conf      *ServerConfig
+	stopC     chan struct{}
+	wg        sync.WaitGroup
+	allowedNS map[string]bool
+	mutex     sync.Mutex
+	clients   map[string]*sdk.ZanRedisClient
+	authInfo  *common.AuthInfo
+}
+
+func NewServer(conf *ServerConfig) (*Server, error) {
+	if len(conf.LookupList) == 0 {
+		return nil, errors.New("empty lookup list")
+	}
+	if _, _, err := net.SplitHostPort(conf.RedisAddress); err != nil {
+		return nil, err
+	}
+	sLog.SetLevel(conf.LogLevel)
+	s := &Server{
+		conf:      conf,
+		stopC:     make(chan struct{}),
+		allowedNS: make(map[string]bool, len(conf.Namespaces)),
+		clients:   make(map[string]*sdk.ZanRedisClient),
+	}
+	for _, ns := range conf.Namespaces {
+		if ns != "" {
+			s.allowedNS[ns] = true
+		}
+	}
+	var err error
+	s.authInfo, err = loadAuthInfo(conf)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) Start() {
+	metricAddr := s.conf.MetricAddress
+	if metricAddr == "" {
+		metricAddr = ":8801"
+	}
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		http.ListenAndServe(metricAddr, mux)
+	}()
+	if s.conf.ProfilePort != "" {
+		go http.ListenAndServe(":"+s.conf.ProfilePort, nil)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveRedisAPI(s.conf.RedisAddress, s.stopC)
+	}()
+}
+
+func (s *Server) Stop() {
+	close(s.stopC)
+	s.wg.Wait()
+	s.mutex.Lock()
+	for ns, c := range s.clients {
+		c.Stop()
+		delete(s.clients, ns)
+	}
+	s.mutex.Unlock()
+	sLog.Infof("proxy server stopped")
+}
+
+func (s *Server) serveRedisAPI(addr string, stopC <-chan struct{}) {
+	redisS := redcon.NewServer(
+		addr,
+		s.serveRedis,
+		func(conn redcon.Conn) bool {
+			client, _, _ := net.SplitHostPort(conn.RemoteAddr())
+			conn.SetContext(&connContext{client: client, authed: !s.isAuthEnabled()})
+			metric.ProxyClientConnNum.With(ps.Labels{"client": client}).Inc()
+			return true
+		},
+		func(conn redcon.Conn, err error) {
+			if ctx, ok := conn.Context().(*connContext); ok {
+				metric.ProxyClientConnNum.With(ps.Labels{"client": ctx.client}).Dec()
+			}
+			if err != nil {
+				sLog.Infof("closed: %s, err: %v", conn.RemoteAddr(), err)
+			}
+		},
+	)
+	go func() {
+		err := redisS.ListenAndServe()
+		if err != nil {
+			sLog.Fatalf("failed to start the proxy redis server: %v", err)
+		}
+	}()
+	<-stopC
+	redisS.Close()
+	sLog.Infof("proxy redis api server exit\n")
+}
+
+func (s *Server) getClient(ns string) (*sdk.ZanRedisClient, error) {
+	if len(s.allowedNS) > 0 && !s.allowedNS[ns] {
+		return nil, errNamespaceDenied
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c, ok := s.clients[ns]; ok {
+		return c, nil
+	}
+	conf := sdk.NewDefaultConf()
+	conf.LookupList = s.conf.LookupList
+	conf.Namespace = ns
+	conf.Password = s.conf.Password
+	conf.MaxActiveConn = s.conf.MaxActiveConn
+	conf.MaxIdleConn = s.conf.MaxIdleConn
+	conf.DialTimeout = time.Duration(s.conf.DialTimeoutMs) * time.Millisecond
+	conf.ReadTimeout = time.Duration(s.conf.ReadTimeoutMs) * time.Millisecond
+	conf.WriteTimeout = time.Duration(s.conf.WriteTimeoutMs) * time.Millisecond
+	conf.TendInterval = s.conf.TendInterval
+	c, err := sdk.NewZanRedisClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	c.Start()
+	s.clients[ns] = c
+	sLog.Infof("client for namespace %v started", ns)
+	return c, nil
+}
+
+func (s *Server) serveRedis(conn redcon.Conn, cmd redcon.Command) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			n := runtime.Stack(buf, false)
+			buf = buf[0:n]
+			sLog.Infof("handle proxy command %v panic: %s:%v", string(cmd.Args[0]), buf, e)
+			conn.Close()
+		}
+	}()
+
+	ctx, _ := conn.Context().(*connContext)
+	if ctx == nil {
+		ctx = &connContext{authed: !s.isAuthEnabled()}
+		conn.SetContext(ctx)
+	}
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	switch cmdName {
+	case "auth":
+		if err := s.doAuth(ctx, cmd); err != nil {
+			conn.WriteError(err.Error())
+		} else {
+			conn.WriteString("OK")
+		}
+		return
+	case "quit":
+		conn.WriteString("OK")
+		conn.Close()
+		return
+	}
+	if !ctx.authed {
+		conn.WriteError(errAuthRequired.Error())
+		return
+	}
+	if cmdName == "ping" {
+		conn.WriteString("PONG")
+		return
+	}
+
+	start := time.Now()
+	ns, rsp, err := s.handleCommand(ctx.user, cmdName, cmd)
+	metric.ProxyClientCmdCounter.With(ps.Labels{"client": ctx.client, "namespace": ns}).Inc()
+	if err != nil {
+		metric.ProxyClientErrCounter.With(ps.Labels{"client": ctx.client, "namespace": ns}).Inc()
+		writeError(conn, err)
+		return
+	}
+	metric.ProxyCmdLatency.With(ps.Labels{"namespace": ns}).Observe(float64(time.Since(start).Milliseconds()))
+	writeReply(conn, rsp)
+}
+
+// handleCommand forward the command to the leader of the partition for the key,
+// the merge command will be split to the partitions and the results are merged.
+// The acl of the user is checked for all the keys before forwarding.
+func (s *Server) handleCommand(u *common.AuthUser, cmdName string, cmd redcon.Command) (string, interface{}, error) {
+	if unsupportedCmds[cmdName] ||
+		common.IsMergeScanCommand(cmdName) || common.IsMergeIndexSearchCommand(cmdName) {
+		return "", nil, errUnsupportedCmd
+	}
+	if common.IsMergeKeysCommand(cmdName) {
+		return s.handleMergeKeysCommand(u, cmdName, cmd)
+	}
+	keyIndex := 1
+	switch cmdName {
+	case "eval", "evalsha":
+		// eval script numkeys key [key ...] arg [arg ...]
+		keyIndex = 3
+	case "bitop":
+		// bitop operation destkey key [key ...]
+		keyIndex = 2
+	}
+	if len(cmd.Args) <= keyIndex {
+		return "", nil, errWrongNumberOfArg
+	}
+	keys := cmd.Args[keyIndex : keyIndex+1]
+	if cmdName == "eval" || cmdName == "evalsha" {
+		var err error
+		keys, err = getEvalKeys(cmd)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if cmdName == "bitop" {
+		keys = cmd.Args[keyIndex:]
+	}
+	if len(keys) == 0 {
+		// the proxy need the key to find the partition
+		return "", nil, errWrongNumberOfArg
+	}
+	pks, err := parseSameNamespaceKeys(keys, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	pk := pks[0]
+	if err := checkUserAccess(u, cmdName, pks); err != nil {
+		return pk.Namespace, nil, err
+	}
+	c, err := s.getClient(pk.Namespace)
+	if err != nil {
+		return pk.Namespace, nil, err
+	}
+	rsp, err := c.DoRedis(cmdName, pk.ShardingKey(), true, toCmdArgs(cmd.Args[1:])...)
+	return pk.Namespace, rsp, err
+}
+
+func (s *Server) handleMergeKeysCommand(u *common.AuthUser, cmdName string, cmd redcon.Command) (string, interface{}, error) {
+	step := 1
+	if cmdName == "mset" || cmdName == "plset" {
+		step = 2
+	}
+	if len(cmd.Args) < 2 || (len(cmd.Args)-1)%step != 0 {
+		return "", nil, errWrongNumberOfArg
+	}
+	pks, err := parseSameNamespaceKeys(cmd.Args[1:], step)
+	if err != nil {
+		return "", nil, err
+	}
+	ns := pks[0].Namespace
+	if err := checkUserAccess(u, cmdName, pks); err != nil {
+		return ns, nil, err
+	}
+	c, err := s.getClient(ns)
+	if err != nil {
+		return ns, nil, err
+	}
+	switch cmdName {
+	case "mget":
+		vals, err := c.KVMGet(true, pks...)
+		if err != nil {
+			return ns, nil, err
+		}
+		rsp := make([]interface{}, 0, len(vals))
+		for _, v := range vals {
+			if v == nil {
+				rsp = append(rsp, nil)
+			} else {
+				rsp = append(rsp, v)
+			}
+		}
+		return ns, rsp, nil
+	case "del":
+		n, err := c.KVMDel(true, pks...)
+		return ns, n, err
+	case "exists":
+		n, err := c.KVMExists(true, pks...)
+		return ns, n, err
+	case "sinter", "sunion", "sdiff":
+		var pl sdk.PipelineCmdList
+		for _, pk := range pks {
+			pl.Add("smembers", pk.ShardingKey(), true, pk.RawKey)
+		}
+		rsps, errs := c.FlushAndWaitPipelineCmd(pl)
+		sets := make([][][]byte, 0, len(rsps))
+		for i, rsp := range rsps {
+			members, err := redis.ByteSlices(rsp, errs[i])
+			if err != nil && err != redis.ErrNil {
+				return ns, nil, err
+			}
+			sets = append(sets, members)
+		}
+		members := common.MergeSets(cmdName, sets)
+		rsp := make([]interface{}, 0, len(members))
+		for _, m := range members {
+			rsp = append(rsp, m)
+		}
+		return ns, rsp, nil
+	default:
+		var pl sdk.PipelineCmdList
+		singleCmd := "set"
+		if cmdName == "plset" {
+			singleCmd = cmdName
+		}
+		for i, pk := range pks {
+			pl.Add(singleCmd, pk.ShardingKey(), true, pk.RawKey, cmd.Args[2+i*2])
+		}
+		_, errs := c.FlushAndWaitPipelineCmd(pl)
+		for _, err := range errs {
+			if err != nil {
+				return ns, nil, err
+			}
+		}
+		return ns, "OK", nil
+	}
+}
+
+// parseSameNamespaceKeys parse the keys at every step position in args,
+// all the keys should be in the same namespace.
+func parseSameNamespaceKeys(args [][]byte, step int) ([]*sdk.PKey, error) {
+	pks := make([]*sdk.PKey, 0, len(args)/step)
+	for i := 0; i < len(args); i += step {
+		pk, err := sdk.ParsePKey(string(args[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(pks) > 0 && pk.Namespace != pks[0].Namespace {
+			return nil, errCrossNamespace
+		}
+		pks = append(pks, pk)
+	}
+	return pks, nil
+}
+
+func toCmdArgs(args [][]byte) []interface{} {
+	cmdArgs := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, arg)
+	}
+	return cmdArgs
+}
+
+func writeError(conn redcon.Conn, err error) {
+	if rerr, ok := err.(redis.Error); ok {
+		conn.WriteError(string(rerr))
+		return
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "ERR") && !strings.HasPrefix(msg, "NOAUTH") && !strings.HasPrefix(msg, "NOPERM") {
+		msg = "ERR " + msg
+	}
+	conn.WriteError(msg)
+}
+
+// writeReply convert the reply from the data node back to the resp
+func writeReply(conn redcon.Conn, rsp interface{}) {
+	switch v := rsp.(type) {
+	case nil:
+		conn.WriteNull()
+	case redis.Error:
+		conn.WriteError(string(v))
+	case error:
+		writeError(conn, v)
+	case string:
+		conn.WriteString(v)
+	case []byte:
+		conn.WriteBulk(v)
+	case int64:
+		conn.WriteInt64(v)
+	case int:
+		conn.WriteInt(v)
+	case []interface{}:
+		conn.WriteArray(len(v))
+		for _, sub := range v {
+			writeReply(conn, sub)
+		}
+	default:
+		conn.WriteError(fmt.Sprintf("ERR unknown reply type %T", v))
+	}
+}
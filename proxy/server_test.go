@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func getFreeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestProxyLocalCommands(t *testing.T) {
+	conf := NewServerConfig()
+	conf.RedisAddress = getFreeAddr(t)
+	conf.MetricAddress = getFreeAddr(t)
+	conf.ProfilePort = ""
+	conf.LookupList = []string{"127.0.0.1:0"}
+	conf.Namespaces = []string{"default"}
+	conf.RequirePass = "testpass"
+	s, err := NewServer(conf)
+	assert.Nil(t, err)
+	s.Start()
+	defer s.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	c, err := redis.Dial("tcp", conf.RedisAddress)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Do("get", "default:test:k1")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "NOAUTH")
+	_, err = c.Do("auth", "wrongpass")
+	assert.NotNil(t, err)
+	rsp, err := redis.String(c.Do("auth", "testpass"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", rsp)
+
+	rsp, err = redis.String(c.Do("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", rsp)
+
+	_, err = c.Do("subscribe", "default:test:ch")
+	assert.Equal(t, errUnsupportedCmd.Error(), err.Error())
+	_, err = c.Do("scan", "default:test:")
+	assert.Equal(t, errUnsupportedCmd.Error(), err.Error())
+	_, err = c.Do("get", "invalidkey")
+	assert.NotNil(t, err)
+	_, err = c.Do("get", "otherns:test:k1")
+	assert.Equal(t, errNamespaceDenied.Error(), err.Error())
+	_, err = c.Do("mget", "default:test:k1", "otherns:test:k2")
+	assert.Equal(t, errCrossNamespace.Error(), err.Error())
+	_, err = c.Do("mset", "default:test:k1", "v1", "default:test:k2")
+	assert.Equal(t, errWrongNumberOfArg.Error(), err.Error())
+	_, err = c.Do("eval", "return 1", "0")
+	assert.Equal(t, errWrongNumberOfArg.Error(), err.Error())
+}
+
+func TestProxyUserACL(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "proxy-auth-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	info := common.AuthInfo{
+		Enabled: true,
+		Users: []common.AuthUser{
+			{
+				Name:         "reader",
+				PasswordHash: common.HashAuthPassword("reader_pass"),
+				ACLs:         []common.AuthACL{{Namespace: "default", Tables: []string{"t1"}, ReadOnly: true}},
+			},
+		},
+	}
+	d, _ := json.Marshal(info)
+	authFile := path.Join(tmpDir, "auth.json")
+	assert.Nil(t, ioutil.WriteFile(authFile, d, 0644))
+
+	conf := NewServerConfig()
+	conf.RedisAddress = getFreeAddr(t)
+	conf.MetricAddress = getFreeAddr(t)
+	conf.ProfilePort = ""
+	conf.LookupList = []string{"127.0.0.1:0"}
+	// the require pass is ignored if the auth file is set
+	conf.RequirePass = "testpass"
+	conf.AuthFile = authFile
+	s, err := NewServer(conf)
+	assert.Nil(t, err)
+	s.Start()
+	defer s.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	c, err := redis.Dial("tcp", conf.RedisAddress)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Do("auth", "testpass")
+	assert.Equal(t, common.ErrAuthFailed.Error(), err.Error())
+	_, err = c.Do("auth", "reader", "wrongpass")
+	assert.Equal(t, common.ErrAuthFailed.Error(), err.Error())
+	_, err = c.Do("get", "default:t1:k1")
+	assert.Contains(t, err.Error(), "NOAUTH")
+	rsp, err := redis.String(c.Do("auth", "reader", "reader_pass"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", rsp)
+
+	// the acl is checked before forwarding to the data node
+	_, err = c.Do("set", "default:t1:k1", "v1")
+	assert.Equal(t, common.ErrAuthReadOnly.Error(), err.Error())
+	_, err = c.Do("get", "default:t2:k1")
+	assert.Equal(t, common.ErrAuthNoPerm.Error(), err.Error())
+	_, err = c.Do("get", "otherns:t1:k1")
+	assert.Equal(t, common.ErrAuthNoPerm.Error(), err.Error())
+	_, err = c.Do("mget", "default:t1:k1", "default:t2:k2")
+	assert.Equal(t, common.ErrAuthNoPerm.Error(), err.Error())
+	_, err = c.Do("eval", "return 1", "2", "default:t1:k1", "default:t2:k2")
+	assert.Equal(t, common.ErrAuthReadOnly.Error(), err.Error())
+	_, err = c.Do("eval", "return 1", "0", "arg1")
+	assert.Equal(t, errWrongNumberOfArg.Error(), err.Error())
+}
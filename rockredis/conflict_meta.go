@@ -0,0 +1,166 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var errConflictMetaKey = errors.New("invalid conflict meta key")
+var errConflictMetaValue = errors.New("invalid conflict meta value")
+
+// the conflict meta not changed for a long time will be cleaned while compacting, since
+// the sync delay between the clusters should be much less than it.
+var conflictMetaKeepTime = time.Hour * 24
+
+// the max increments kept after the last assignment
+const maxConflictIncrNum = 1024
+
+// ConflictIncr is the increment applied after the last assignment
+type ConflictIncr struct {
+	Ts    int64
+	Delta []byte
+}
+
+// ConflictMeta is the last assignment (set or delete) and the increments after it for the key
+// or the hash field. It is used to resolve the writes from the other cluster in the active-active
+// mode, the deleted key keeps the meta as the tombstone.
+type ConflictMeta struct {
+	AssignTs int64
+	Deleted  bool
+	Incrs    []ConflictIncr
+}
+
+// the last timestamp changed by the assignment or the increments
+func (m *ConflictMeta) LastTs() int64 {
+	// the increments are sorted by the timestamp
+	if len(m.Incrs) > 0 && m.Incrs[len(m.Incrs)-1].Ts > m.AssignTs {
+		return m.Incrs[len(m.Incrs)-1].Ts
+	}
+	return m.AssignTs
+}
+
+// add the increment in the timestamp order and remove the increments too old to be conflicted
+func (m *ConflictMeta) AddIncr(ts int64, delta []byte) {
+	pos := len(m.Incrs)
+	for pos > 0 && m.Incrs[pos-1].Ts > ts {
+		pos--
+	}
+	m.Incrs = append(m.Incrs, ConflictIncr{})
+	copy(m.Incrs[pos+1:], m.Incrs[pos:])
+	m.Incrs[pos] = ConflictIncr{Ts: ts, Delta: delta}
+	start := 0
+	for start < len(m.Incrs)-1 && m.Incrs[start].Ts+conflictMetaKeepTime.Nanoseconds() < ts {
+		start++
+	}
+	if len(m.Incrs)-start > maxConflictIncrNum {
+		start = len(m.Incrs) - maxConflictIncrNum
+	}
+	m.Incrs = m.Incrs[start:]
+}
+
+/*
+the coded format of the conflict meta key:
+bytes:  -0-|-1-|-2-3-|-4----x-|-(x+1)---y-|
+data :  104| dt| klen|  key   |   field   |
+*/
+func encodeConflictMetaKey(dt byte, key []byte, field []byte) []byte {
+	buf := make([]byte, 1+1+2+len(key)+len(field))
+	buf[0] = ConflictMetaType
+	buf[1] = dt
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(key)))
+	copy(buf[4:], key)
+	copy(buf[4+len(key):], field)
+	return buf
+}
+
+func decodeConflictMetaKey(mk []byte) (byte, []byte, []byte, error) {
+	if len(mk) < 1+1+2 || mk[0] != ConflictMetaType {
+		return 0, nil, nil, errConflictMetaKey
+	}
+	klen := int(binary.BigEndian.Uint16(mk[2:]))
+	if len(mk) < 4+klen {
+		return 0, nil, nil, errConflictMetaKey
+	}
+	return mk[1], mk[4 : 4+klen], mk[4+klen:], nil
+}
+
+func encodeConflictMeta(m *ConflictMeta) []byte {
+	size := 1 + 8 + 2
+	for _, incr := range m.Incrs {
+		size += 8 + 2 + len(incr.Delta)
+	}
+	buf := make([]byte, size)
+	if m.Deleted {
+		buf[0] = 1
+	}
+	binary.BigEndian.PutUint64(buf[1:], uint64(m.AssignTs))
+	binary.BigEndian.PutUint16(buf[9:], uint16(len(m.Incrs)))
+	pos := 11
+	for _, incr := range m.Incrs {
+		binary.BigEndian.PutUint64(buf[pos:], uint64(incr.Ts))
+		binary.BigEndian.PutUint16(buf[pos+8:], uint16(len(incr.Delta)))
+		pos += 10
+		pos += copy(buf[pos:], incr.Delta)
+	}
+	return buf
+}
+
+func decodeConflictMeta(v []byte) (*ConflictMeta, error) {
+	if len(v) < 1+8+2 {
+		return nil, errConflictMetaValue
+	}
+	m := &ConflictMeta{
+		Deleted:  v[0] == 1,
+		AssignTs: int64(binary.BigEndian.Uint64(v[1:])),
+	}
+	n := int(binary.BigEndian.Uint16(v[9:]))
+	pos := 11
+	for i := 0; i < n; i++ {
+		if len(v) < pos+10 {
+			return nil, errConflictMetaValue
+		}
+		var incr ConflictIncr
+		incr.Ts = int64(binary.BigEndian.Uint64(v[pos:]))
+		dlen := int(binary.BigEndian.Uint16(v[pos+8:]))
+		pos += 10
+		if len(v) < pos+dlen {
+			return nil, errConflictMetaValue
+		}
+		incr.Delta = append([]byte(nil), v[pos:pos+dlen]...)
+		pos += dlen
+		m.Incrs = append(m.Incrs, incr)
+	}
+	return m, nil
+}
+
+// GetConflictMeta return nil if no conflict meta for the key or the hash field, the field is
+// nil for the whole key.
+func (db *RockDB) GetConflictMeta(dt byte, key []byte, field []byte) (*ConflictMeta, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	v, err := db.GetBytes(encodeConflictMetaKey(dt, key, field))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return decodeConflictMeta(v)
+}
+
+// SetConflictMeta write the conflict meta to the write batch, it will be committed with the
+// write command in the same batch.
+func (db *RockDB) SetConflictMeta(dt byte, key []byte, field []byte, m *ConflictMeta) error {
+	if err := checkKeySize(key); err != nil {
+		return err
+	}
+	db.wb.Put(encodeConflictMetaKey(dt, key, field), encodeConflictMeta(m))
+	return db.MaybeCommitBatch()
+}
+
+func isConflictMetaStale(v []byte, now int64) bool {
+	m, err := decodeConflictMeta(v)
+	if err != nil {
+		return false
+	}
+	return m.LastTs()+conflictMetaKeepTime.Nanoseconds() < now
+}
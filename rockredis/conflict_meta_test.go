@@ -0,0 +1,73 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflictMetaEncode(t *testing.T) {
+	m := &ConflictMeta{AssignTs: 100, Deleted: true}
+	m.AddIncr(300, []byte("3"))
+	m.AddIncr(200, []byte("-2"))
+	m.AddIncr(400, []byte("1.5"))
+	assert.Equal(t, int64(400), m.LastTs())
+	assert.Equal(t, int64(200), m.Incrs[0].Ts)
+	assert.Equal(t, int64(300), m.Incrs[1].Ts)
+
+	m2, err := decodeConflictMeta(encodeConflictMeta(m))
+	assert.Nil(t, err)
+	assert.Equal(t, m, m2)
+
+	mk := encodeConflictMetaKey(HashType, []byte("test:key"), []byte("field"))
+	dt, key, field, err := decodeConflictMetaKey(mk)
+	assert.Nil(t, err)
+	assert.Equal(t, HashType, dt)
+	assert.Equal(t, "test:key", string(key))
+	assert.Equal(t, "field", string(field))
+
+	_, err = decodeConflictMeta([]byte("short"))
+	assert.NotNil(t, err)
+
+	// the too old increments are removed
+	now := time.Now().UnixNano()
+	m = &ConflictMeta{}
+	m.AddIncr(now-2*conflictMetaKeepTime.Nanoseconds(), []byte("1"))
+	m.AddIncr(now, []byte("1"))
+	assert.Equal(t, 1, len(m.Incrs))
+	assert.False(t, isConflictMetaStale(encodeConflictMeta(m), now))
+	assert.True(t, isConflictMetaStale(encodeConflictMeta(m), now+2*conflictMetaKeepTime.Nanoseconds()))
+}
+
+func TestConflictMetaGetSet(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:conflict_key")
+	m, err := db.GetConflictMeta(KVType, key, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	err = db.SetConflictMeta(KVType, key, nil, &ConflictMeta{AssignTs: 10, Deleted: true})
+	assert.Nil(t, err)
+	err = db.SetConflictMeta(HashType, key, []byte("f1"), &ConflictMeta{AssignTs: 20})
+	assert.Nil(t, err)
+	m, err = db.GetConflictMeta(KVType, key, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), m.AssignTs)
+	assert.True(t, m.Deleted)
+	m, err = db.GetConflictMeta(HashType, key, []byte("f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), m.AssignTs)
+	assert.False(t, m.Deleted)
+	m, err = db.GetConflictMeta(HashType, key, []byte("f2"))
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	pk, _, err := db.decodeDataKeyPK(encodeConflictMetaKey(HashType, key, []byte("f1")), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, key, pk)
+}
@@ -20,6 +20,8 @@ const (
 const (
 	NoneType byte = 0
 	// 0~10 reserved for system usage
+	// the partition state (such as split) of the whole db
+	SysMetaType byte = 1
 
 	// table count, stats, index, schema, and etc.
 	TableMetaType      byte = 10
@@ -41,6 +43,8 @@ const (
 	JSONType       byte = 31
 	BitmapType     byte = 32
 	BitmapMetaType byte = 33
+	StreamType     byte = 34
+	StreamMetaType byte = 35
 
 	ColumnType byte = 38 // used for column store for OLAP
 
@@ -62,21 +66,29 @@ const (
 	// and scan periodically to delete the expired keys
 	ExpTimeType byte = 101
 	ExpMetaType byte = 102
+	// the kv value with ttl stored in the time rotated buckets under
+	// the periodical rotation policy
+	ExpRotationType byte = 103
+	// the tombstone and the increments for the key or hash field
+	// used to resolve the conflict in the active-active mode
+	ConflictMetaType byte = 104
 )
 
 var (
 	TypeName = map[byte]string{
-		KVType:     "kv",
-		HashType:   "hash",
-		HSizeType:  "hsize",
-		ListType:   "list",
-		LMetaType:  "lmeta",
-		ZSetType:   "zset",
-		ZSizeType:  "zsize",
-		ZScoreType: "zscore",
-		SetType:    "set",
-		SSizeType:  "ssize",
-		JSONType:   "json",
+		KVType:         "kv",
+		HashType:       "hash",
+		HSizeType:      "hsize",
+		ListType:       "list",
+		LMetaType:      "lmeta",
+		ZSetType:       "zset",
+		ZSizeType:      "zsize",
+		ZScoreType:     "zscore",
+		SetType:        "set",
+		SSizeType:      "ssize",
+		JSONType:       "json",
+		StreamType:     "stream",
+		StreamMetaType: "streammeta",
 	}
 )
 
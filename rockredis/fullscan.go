@@ -93,7 +93,10 @@ func (db *RockDB) kvFullScan(key []byte, count int,
 			} else if r != nil && !r.Match(string(k)) {
 				return nil, errNotMatch
 			} else {
-				v := it.Value()
+				v, err := db.getRotatedKVValue(it.Key(), it.Value(), true)
+				if err != nil {
+					return nil, err
+				}
 				return &ItemContainer{t, k, v, nil}, nil
 			}
 		})
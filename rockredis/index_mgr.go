@@ -18,11 +18,6 @@ var (
 	buildIndexBlock = 1000
 )
 
-type JSONIndex struct {
-	Table []byte
-	HsetIndexInfo
-}
-
 type TableIndexContainer struct {
 	sync.RWMutex
 	// field -> index name, to convert "secondaryindex.select * from table where field = xxx" to scan(/hindex/table/indexname/xxx)
@@ -73,9 +68,35 @@ func (tic *TableIndexContainer) unmarshalHsetIndexes(table []byte, data []byte)
 	return nil
 }
 
+// the json index info use the same storage format as the hset index,
+// while the index field is the json path
+func (tic *TableIndexContainer) marshalJSONIndexes() ([]byte, error) {
+	var indexList HsetIndexList
+	for _, v := range tic.jsonIndexes {
+		indexList.HsetIndexes = append(indexList.HsetIndexes, v.HsetIndexInfo)
+	}
+	return indexList.Marshal()
+}
+
+func (tic *TableIndexContainer) unmarshalJSONIndexes(table []byte, data []byte) error {
+	var indexList HsetIndexList
+	err := indexList.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	tic.jsonIndexes = make(map[string]*JSONIndex)
+	for _, v := range indexList.HsetIndexes {
+		var ji JSONIndex
+		ji.HsetIndexInfo = v
+		ji.Table = table
+		tic.jsonIndexes[string(v.IndexField)] = &ji
+	}
+	dbLog.Infof("load json index: %v", indexList.String())
+	return nil
+}
+
 func (tic *TableIndexContainer) GetJSONIndexNoLock(path string) *JSONIndex {
-	// TODO: path need to be converted to canonical form
-	index, ok := tic.jsonIndexes[path]
+	index, ok := tic.jsonIndexes[convertJSONPath([]byte(path))]
 	if !ok {
 		return nil
 	}
@@ -121,9 +142,16 @@ func (im *IndexMgr) GetAllIndexSchemaInfo(db *RockDB) (map[string]*common.IndexS
 				State:      common.IndexState(v.State),
 			})
 		}
-		//for _, v := range t.jsonIndexes {
-		//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
-		//}
+		for _, v := range t.jsonIndexes {
+			schema.JSONIndexes = append(schema.JSONIndexes, &common.JSONIndexSchema{
+				Name:      string(v.Name),
+				IndexPath: string(v.IndexField),
+				PrefixLen: v.PrefixLen,
+				Unique:    v.Unique,
+				ValueType: common.IndexPropertyDType(v.ValueType),
+				State:     common.IndexState(v.State),
+			})
+		}
 		t.RUnlock()
 		schemas[name] = &schema
 	}
@@ -154,9 +182,16 @@ func (im *IndexMgr) GetIndexSchemaInfo(db *RockDB, table string) (*common.IndexS
 			State:      common.IndexState(v.State),
 		})
 	}
-	//for _, v := range t.jsonIndexes {
-	//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
-	//}
+	for _, v := range t.jsonIndexes {
+		schema.JSONIndexes = append(schema.JSONIndexes, &common.JSONIndexSchema{
+			Name:      string(v.Name),
+			IndexPath: string(v.IndexField),
+			PrefixLen: v.PrefixLen,
+			Unique:    v.Unique,
+			ValueType: common.IndexPropertyDType(v.ValueType),
+			State:     common.IndexState(v.State),
+		})
+	}
 	t.RUnlock()
 	return &schema, nil
 }
@@ -186,6 +221,33 @@ func (im *IndexMgr) LoadIndexes(db *RockDB) error {
 		im.tableIndexes[string(t)] = indexes
 		im.Unlock()
 	}
+	tables = db.GetJSONIndexTables()
+	for _, t := range tables {
+		d, err := db.GetTableJSONIndexValue(t)
+		if err != nil {
+			dbLog.Infof("get table %v json index failed: %v", string(t), err)
+			continue
+		}
+		if d == nil {
+			dbLog.Infof("get table %v json index empty", string(t))
+			continue
+		}
+		im.Lock()
+		indexes, ok := im.tableIndexes[string(t)]
+		if !ok {
+			indexes = NewIndexContainer()
+			im.tableIndexes[string(t)] = indexes
+		}
+		im.Unlock()
+		indexes.Lock()
+		err = indexes.unmarshalJSONIndexes(t, d)
+		indexes.Unlock()
+		if err != nil {
+			dbLog.Infof("unmarshal table %v json indexes failed: %v", string(t), err)
+			return err
+		}
+		dbLog.Infof("table %v load %v json indexes", string(t), len(indexes.jsonIndexes))
+	}
 
 	im.Lock()
 	if im.closeChan != nil {
@@ -374,6 +436,138 @@ func (im *IndexMgr) GetHsetIndex(table string, field string) (*HsetIndex, error)
 	return index, nil
 }
 
+func (im *IndexMgr) AddJSONIndex(db *RockDB, jindex *JSONIndex) error {
+	jindex.IndexField = []byte(convertJSONPath(jindex.IndexField))
+	im.Lock()
+	indexes, ok := im.tableIndexes[string(jindex.Table)]
+	if !ok {
+		indexes = NewIndexContainer()
+		im.tableIndexes[string(jindex.Table)] = indexes
+	}
+	im.Unlock()
+	indexes.Lock()
+	defer indexes.Unlock()
+	_, ok = indexes.jsonIndexes[string(jindex.IndexField)]
+	if ok {
+		return ErrIndexExist
+	}
+	jindex.State = InitIndex
+	indexes.jsonIndexes[string(jindex.IndexField)] = jindex
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		indexes.jsonIndexes[string(jindex.IndexField)] = nil
+		delete(indexes.jsonIndexes, string(jindex.IndexField))
+		return err
+	}
+	err = db.SetTableJSONIndexValue(jindex.Table, d)
+	if err != nil {
+		indexes.jsonIndexes[string(jindex.IndexField)] = nil
+		delete(indexes.jsonIndexes, string(jindex.IndexField))
+		return err
+	}
+	dbLog.Infof("table %v add json index %v", string(jindex.Table), jindex.String())
+	return err
+}
+
+func (im *IndexMgr) UpdateJSONIndexState(db *RockDB, table string, path string, state IndexState) error {
+	im.RLock()
+	isClosed := im.closeChan == nil
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+	if isClosed {
+		return ErrIndexClosed
+	}
+
+	path = convertJSONPath([]byte(path))
+	indexes.Lock()
+	defer indexes.Unlock()
+	index, ok := indexes.jsonIndexes[path]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if index.State == state {
+		return nil
+	}
+	oldState := index.State
+	index.State = state
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	err = db.SetTableJSONIndexValue([]byte(table), d)
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	dbLog.Infof("table %v json index %v state updated from %v to %v", table, path, oldState, state)
+	if index.State == DeletedIndex {
+		im.wg.Add(1)
+		go func() {
+			defer im.wg.Done()
+			err := index.cleanAll(db, im.closeChan)
+			if err != nil {
+				dbLog.Infof("failed to clean index: %v", err)
+			} else {
+				im.deleteJSONIndex(db, string(index.Table), string(index.IndexField))
+			}
+		}()
+	} else if index.State == BuildingIndex {
+		select {
+		case im.indexBuildChan <- 1:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (im *IndexMgr) deleteJSONIndex(db *RockDB, table string, path string) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[table]
+	im.Unlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	jindex, ok := indexes.jsonIndexes[path]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if jindex.State != DeletedIndex {
+		return ErrIndexDeleteNotInDeleted
+	}
+	indexes.jsonIndexes[path] = nil
+	delete(indexes.jsonIndexes, path)
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		return err
+	}
+	return db.SetTableJSONIndexValue([]byte(table), d)
+}
+
+func (im *IndexMgr) GetJSONIndex(table string, path string) (*JSONIndex, error) {
+	im.RLock()
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return nil, ErrIndexTableNotExist
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	index, ok := indexes.jsonIndexes[convertJSONPath([]byte(path))]
+	if !ok {
+		return nil, ErrIndexNotExist
+	}
+	return index, nil
+}
+
 func (im *IndexMgr) buildIndexes(db *RockDB, stopChan chan struct{}) {
 	for {
 		select {
@@ -396,7 +590,34 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 				tmpHsetIndexes = append(tmpHsetIndexes, hindex)
 			}
 		}
+		tmpJSONIndexes := make([]*JSONIndex, 0)
+		for _, jindex := range v.jsonIndexes {
+			if jindex.State == BuildingIndex {
+				tmpJSONIndexes = append(tmpJSONIndexes, jindex)
+			}
+		}
 		v.RUnlock()
+		if len(tmpJSONIndexes) > 0 {
+			buildWg.Add(1)
+			go func(buildTable string, t *TableIndexContainer) {
+				defer buildWg.Done()
+				dbLog.Infof("begin rebuild json index for table %v", buildTable)
+				cnt, err := db.buildTableJSONIndexes(buildTable, t, tmpJSONIndexes, stopChan)
+				dbLog.Infof("finish rebuild json index for table %v, total: %v, err: %v", buildTable, cnt, err)
+				t.Lock()
+				for _, jindex := range tmpJSONIndexes {
+					if jindex.State != BuildingIndex {
+						continue
+					}
+					if err != nil {
+						jindex.State = InitIndex
+					} else {
+						jindex.State = BuildDoneIndex
+					}
+				}
+				t.Unlock()
+			}(table, v)
+		}
 		if len(tmpHsetIndexes) == 0 {
 			continue
 		}
@@ -61,7 +61,11 @@ type RockRedisDBConfig struct {
 	// this will ignore all update and non-exist delete
 	EstimateTableCounter bool
 	ExpirationPolicy     common.ExpirationPolicy
-	DataVersion          common.DataVersionT
+	// the time range in seconds of each bucket under the periodical rotation policy, 0 for the default
+	ExpirationRotationPeriod int64
+	DataVersion              common.DataVersionT
+	// called after the expired keys are deleted by the local expiration checker
+	ExpiredNotifier func(keys [][]byte)
 }
 
 func NewRockRedisDBConfig() *RockRedisDBConfig {
@@ -211,14 +215,20 @@ func (cf *rockCompactFilter) Filter(level int, key, value []byte) (bool, []byte)
 	}
 	newCnt := atomic.AddInt64(&cf.checkedCnt, 1)
 	switch key[0] {
-	case KVType, HSizeType, LMetaType, SSizeType, ZSizeType, BitmapMetaType:
+	case KVType, HSizeType, LMetaType, SSizeType, ZSizeType, BitmapMetaType, StreamMetaType, ExpRotationType:
 		var h headerMetaValue
 		_, err := h.decode(value)
 		if err != nil {
 			return false, nil
 		}
 		return cf.lazyExpireCheck(h, newCnt), nil
-	case HashType, ListType, SetType, ZSetType, ZScoreType, BitmapType:
+	case ConflictMetaType:
+		if isConflictMetaStale(value, time.Now().UnixNano()) {
+			atomic.AddInt64(&cf.DelCleanCnt, 1)
+			return true, nil
+		}
+		return false, nil
+	case HashType, ListType, SetType, ZSetType, ZScoreType, BitmapType, StreamType:
 		dt, rawKey, ver, err := convertCollDBKeyToRawKey(key)
 		if err != nil {
 			return false, nil
@@ -285,6 +295,8 @@ type RockDB struct {
 	latestSnapIndex   uint64
 	topLargeCollKeys  *metric.CollSizeHeap
 	compactFilter     *rockCompactFilter
+	// the rotation buckets of the kv values changed in wb but not committed
+	pendingKVBuckets map[string]int64
 }
 
 func OpenRockDB(cfg *RockRedisDBConfig) (*RockDB, error) {
@@ -310,6 +322,10 @@ func OpenRockDB(cfg *RockRedisDBConfig) (*RockDB, error) {
 		db.expiration = newCompactExpiration(db)
 		// register the compact callback to lazy clean the expired data
 		db.RegisterCompactCallback()
+	case common.PeriodicalRotation:
+		db.expiration = newRotationExpiration(db)
+		// the header of the rotated kv and the collections are cleaned by compact
+		db.RegisterCompactCallback()
 	default:
 		return nil, errors.New("unsupported ExpirationPolicy")
 	}
@@ -1139,6 +1155,26 @@ func (r *RockDB) UpdateHsetIndexState(table string, hindex *common.HsetIndexSche
 	return r.indexMgr.UpdateHsetIndexState(r, table, hindex.IndexField, IndexState(hindex.State))
 }
 
+func (r *RockDB) AddJSONIndex(table string, jindex *common.JSONIndexSchema) error {
+	indexInfo := HsetIndexInfo{
+		Name:       []byte(jindex.Name),
+		IndexField: []byte(jindex.IndexPath),
+		PrefixLen:  jindex.PrefixLen,
+		Unique:     jindex.Unique,
+		ValueType:  IndexPropertyDType(jindex.ValueType),
+		State:      IndexState(jindex.State),
+	}
+	index := &JSONIndex{
+		Table:         []byte(table),
+		HsetIndexInfo: indexInfo,
+	}
+	return r.indexMgr.AddJSONIndex(r, index)
+}
+
+func (r *RockDB) UpdateJSONIndexState(table string, jindex *common.JSONIndexSchema) error {
+	return r.indexMgr.UpdateJSONIndexState(r, table, jindex.IndexPath, IndexState(jindex.State))
+}
+
 func (r *RockDB) BeginBatchWrite() error {
 	if atomic.CompareAndSwapInt32(&r.isBatching, 0, 1) {
 		return nil
@@ -1151,25 +1187,39 @@ func (r *RockDB) MaybeCommitBatch() error {
 		return nil
 	}
 	err := r.rockEng.Write(r.wb)
-	r.wb.Clear()
+	r.clearWriteBatch()
 	return err
 }
 
+// clear the write buffer if not batching, the batched write should
+// be committed or aborted by the batch owner
+func (r *RockDB) MaybeClearBatch() {
+	if atomic.LoadInt32(&r.isBatching) == 1 {
+		return
+	}
+	r.clearWriteBatch()
+}
+
 func (r *RockDB) CommitBatchWrite() error {
 	err := r.rockEng.Write(r.wb)
 	if err != nil {
 		dbLog.Infof("commit write error: %v", err)
 	}
-	r.wb.Clear()
+	r.clearWriteBatch()
 	atomic.StoreInt32(&r.isBatching, 0)
 	return err
 }
 
 func (r *RockDB) AbortBatch() {
-	r.wb.Clear()
+	r.clearWriteBatch()
 	atomic.StoreInt32(&r.isBatching, 0)
 }
 
+func (r *RockDB) clearWriteBatch() {
+	r.wb.Clear()
+	r.pendingKVBuckets = nil
+}
+
 func IsNeedAbortError(err error) bool {
 	// for the error which will not touch write batch no need abort
 	// since it will not affect the write buffer in batch
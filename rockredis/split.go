@@ -0,0 +1,199 @@
+package rockredis
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const splitCleanBlock = 1000
+
+var errSplitCleanStopped = errors.New("split clean stopped")
+
+var splitStateKey = append([]byte{SysMetaType}, []byte("split_state")...)
+
+// GetSplitState return the split state saved in db, the state will be
+// in checkpoint so the replica restored from snapshot will have the same state.
+func (r *RockDB) GetSplitState() ([]byte, error) {
+	return r.GetBytes(splitStateKey)
+}
+
+func (r *RockDB) SetSplitState(state []byte) error {
+	wb := r.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	if state == nil {
+		wb.Delete(splitStateKey)
+	} else {
+		wb.Put(splitStateKey, state)
+	}
+	return r.rockEng.Write(wb)
+}
+
+// SaveCheckpoint save the checkpoint of the current db to the given dir synchronously,
+// the dir should not exist. It is used to seed the new partition while splitting.
+func (r *RockDB) SaveCheckpoint(dir string) error {
+	ck, err := r.rockEng.NewCheckpoint(false)
+	if err != nil {
+		return err
+	}
+	r.checkpointDirLock.Lock()
+	defer r.checkpointDirLock.Unlock()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		dbLog.Infof("checkpoint exist: %v, remove it", dir)
+		os.RemoveAll(dir)
+	}
+	return ck.Save(dir, nil)
+}
+
+// decode the primary key (table:key) for the data key, return nil
+// if the key is the metadata which is not belong to any primary key.
+func (db *RockDB) decodeDataKeyPK(dbk []byte, value []byte) ([]byte, bool, error) {
+	if len(dbk) < 1 {
+		return nil, false, errDataType
+	}
+	switch dbk[0] {
+	case KVType:
+		pk, err := decodeKVKey(dbk)
+		return pk, true, err
+	case HSizeType:
+		pk, err := hDecodeSizeKey(dbk)
+		return pk, true, err
+	case LMetaType:
+		pk, err := lDecodeMetaKey(dbk)
+		return pk, true, err
+	case SSizeType:
+		pk, err := sDecodeSizeKey(dbk)
+		return pk, true, err
+	case ZSizeType:
+		pk, err := zDecodeSizeKey(dbk)
+		return pk, true, err
+	case BitmapMetaType:
+		pk, err := bitDecodeMetaKey(dbk)
+		return pk, true, err
+	case StreamMetaType:
+		pk, err := xDecodeMetaKey(dbk)
+		return pk, true, err
+	case JSONType:
+		table, rk, err := decodeJSONKey(dbk)
+		if err != nil {
+			return nil, false, err
+		}
+		return packRedisKey(table, rk), true, nil
+	case HashType, SetType, ZSetType, ListType, ZScoreType, BitmapType, StreamType:
+		var table, verk []byte
+		var err error
+		dt := dbk[0]
+		switch dt {
+		case ListType:
+			table, verk, _, err = lDecodeListKey(dbk)
+		case ZScoreType:
+			dt = ZSetType
+			table, verk, _, _, err = zDecodeScoreKey(dbk)
+		case BitmapType:
+			table, verk, _, err = decodeBitmapKey(dbk)
+		default:
+			_, table, verk, _, err = decodeCollSubKey(dbk)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		rk, _, err := db.expiration.decodeFromVersionKey(dt, verk)
+		if err != nil {
+			return nil, false, err
+		}
+		return packRedisKey(table, rk), false, nil
+	case ExpMetaType:
+		_, pk, err := expDecodeMetaKey(dbk)
+		return pk, false, err
+	case ExpTimeType:
+		_, pk, _, err := expDecodeTimeKey(dbk)
+		return pk, false, err
+	case ExpRotationType:
+		_, kk, err := decodeRotationKey(dbk)
+		if err != nil {
+			return nil, false, err
+		}
+		pk, err := decodeKVKey(kk)
+		return pk, false, err
+	case ConflictMetaType:
+		_, pk, _, err := decodeConflictMetaKey(dbk)
+		return pk, false, err
+	case IndexDataType:
+		if len(dbk) < 2 {
+			return nil, false, errHsetIndexKey
+		}
+		var pk []byte
+		var err error
+		_, _, _, pk, err = decodeIndexStringKey(dbk[1], dbk)
+		if err == ErrIndexValueType {
+			_, _, _, pk, err = decodeIndexNumberKey(dbk[1], dbk)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if pk == nil {
+			// unique index has the pk in value
+			pk = value
+		}
+		return pk, false, nil
+	}
+	return nil, false, nil
+}
+
+// DeleteUnownedKeys scan all the data and delete the keys whose primary key is not
+// owned by this db anymore (the keys moved to other partition after split).
+// The caller should make sure no write for the unowned keys while cleaning.
+func (r *RockDB) DeleteUnownedKeys(isOwned func(pk []byte) bool, stopC <-chan struct{}) (int64, error) {
+	start := time.Now()
+	var startKey []byte
+	deleted := int64(0)
+	for {
+		select {
+		case <-stopC:
+			return deleted, errSplitCleanStopped
+		default:
+		}
+		it, err := r.NewDBRangeLimitIterator(startKey, nil, 0, 0, splitCleanBlock, false)
+		if err != nil {
+			return deleted, err
+		}
+		wb := r.rockEng.NewWriteBatch()
+		cnt := 0
+		var lastKey []byte
+		for ; it.Valid(); it.Next() {
+			cnt++
+			lastKey = it.Key()
+			pk, isPrimary, err := r.decodeDataKeyPK(lastKey, it.Value())
+			if err != nil {
+				dbLog.Infof("decode key %v failed while clean unowned keys: %v", lastKey, err)
+				continue
+			}
+			if pk == nil || isOwned(pk) {
+				continue
+			}
+			wb.Delete(lastKey)
+			deleted++
+			if isPrimary {
+				table, _, err := extractTableFromRedisKey(pk)
+				if err == nil {
+					r.IncrTableKeyCount(table, -1, wb)
+				}
+			}
+		}
+		it.Close()
+		if cnt > 0 {
+			err = r.rockEng.Write(wb)
+		}
+		wb.Destroy()
+		if err != nil {
+			return deleted, err
+		}
+		if cnt < splitCleanBlock {
+			break
+		}
+		// the last key is deleted or owned, so we can skip it at the next block
+		startKey = append(lastKey, 0)
+	}
+	dbLog.Infof("db %v clean unowned keys done, deleted: %v, cost: %v", r.GetDataDir(), deleted, time.Since(start))
+	return deleted, nil
+}
@@ -0,0 +1,81 @@
+package rockredis
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestDBDeleteUnownedKeys(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	owned := []byte("test:split_owned")
+	moved := []byte("test:split_moved")
+	for _, key := range [][]byte{owned, moved} {
+		err := db.KVSet(0, key, []byte("v"))
+		assert.Nil(t, err)
+		hkey := append(append([]byte{}, key...), []byte("_h")...)
+		_, err = db.HSet(0, false, hkey, []byte("f1"), []byte("v1"))
+		assert.Nil(t, err)
+		lkey := append(append([]byte{}, key...), []byte("_l")...)
+		_, err = db.RPush(0, lkey, []byte("a"), []byte("b"))
+		assert.Nil(t, err)
+		skey := append(append([]byte{}, key...), []byte("_s")...)
+		_, err = db.SAdd(0, skey, []byte("m1"), []byte("m2"))
+		assert.Nil(t, err)
+		zkey := append(append([]byte{}, key...), []byte("_z")...)
+		_, err = db.ZAdd(0, zkey, common.ScorePair{Score: 1, Member: []byte("m1")})
+		assert.Nil(t, err)
+	}
+	num, err := db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), num)
+
+	err = db.SetSplitState([]byte("state"))
+	assert.Nil(t, err)
+
+	isOwned := func(pk []byte) bool {
+		return bytes.HasPrefix(pk, owned)
+	}
+	n, err := db.DeleteUnownedKeys(isOwned, nil)
+	assert.Nil(t, err)
+	assert.True(t, n > 5)
+
+	v, err := db.KVGet(owned)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+	v, err = db.KVGet(moved)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	cnt, err := db.HLen(append(append([]byte{}, owned...), []byte("_h")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = db.HLen(append(append([]byte{}, moved...), []byte("_h")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+	cnt, err = db.LLen(append(append([]byte{}, moved...), []byte("_l")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+	cnt, err = db.SCard(append(append([]byte{}, moved...), []byte("_s")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+	cnt, err = db.ZCard(append(append([]byte{}, owned...), []byte("_z")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = db.ZCard(append(append([]byte{}, moved...), []byte("_z")...))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+
+	num, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), num)
+	// the system meta should not be removed
+	st, err := db.GetSplitState()
+	assert.Nil(t, err)
+	assert.Equal(t, "state", string(st))
+}
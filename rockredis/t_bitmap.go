@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	math "math"
+	"math/bits"
 	"time"
 
 	"github.com/youzan/ZanRedisDB/common"
@@ -164,23 +165,25 @@ func (db *RockDB) BitSetV2(ts int64, key []byte, offset int64, on int) (int64, e
 		return 0, err
 	}
 	if !ok {
-		// convert old data to new
-		table, oldkey, err := convertRedisKeyToDBKVKey(key)
+		// convert old data to new, the old kv value may be moved to the rotated bucket
+		// and has the header, so read it as the kv value.
+		oldInfo, v, err := db.getDBKVRealValueAndHeader(ts, key, false)
 		if err != nil {
 			return 0, err
 		}
-		var v []byte
-		if v, err = db.GetBytesNoLock(oldkey); err != nil {
-			return 0, err
-		}
 		if v == nil {
-			db.IncrTableKeyCount(table, 1, wb)
-		} else if len(v) >= tsLen {
-			v = v[:len(v)-tsLen]
-			table, rk, _ := extractTableFromRedisKey(key)
+			db.IncrTableKeyCount(oldInfo.Table, 1, wb)
+		} else {
+			keyInfo, err := db.prepareCollKeyForWrite(ts, BitmapType, key, nil)
+			if err != nil {
+				return 0, err
+			}
+			if oldInfo.Expired {
+				v = nil
+			}
 			for i := 0; i < len(v); i += bitmapSegBytes {
 				index := int64(i)
-				bmk, err := encodeBitmapKey(table, rk, index)
+				bmk, err := encodeBitmapKey(keyInfo.Table, keyInfo.VerKey, index)
 				if err != nil {
 					return 0, err
 				}
@@ -196,7 +199,8 @@ func (db *RockDB) BitSetV2(ts int64, key []byte, offset int64, on int) (int64, e
 			if int64(len(v)) != bmSize {
 				panic(fmt.Errorf("bitmap size mismatch: %v, %v ", v, bmSize))
 			}
-			wb.Delete(oldkey)
+			db.delKVValue(oldInfo.VerKey, wb)
+			db.delExpire(KVType, key, nil, false, wb)
 			// we need flush write batch before we modify new bit
 			err = db.MaybeCommitBatch()
 			if err != nil {
@@ -375,24 +379,12 @@ func (db *RockDB) BitClear(ts int64, key []byte) (int64, error) {
 	if bmSize > 0 {
 		db.IncrTableKeyCount(table, -1, wb)
 	}
-	if db.cfg.ExpirationPolicy == common.WaitCompact {
+	if db.isCompactTTLPolicy() {
 		// for compact ttl , we can just delete the meta
 	} else {
 		rk = db.expiration.encodeToVersionKey(BitmapType, oldh, rk)
-		iterStart, _ := encodeBitmapStartKey(table, rk, 0)
-		iterStop, _ := encodeBitmapStopKey(table, rk)
-		if bmSize/bitmapSegBytes > RangeDeleteNum {
-			wb.DeleteRange(iterStart, iterStop)
-		} else {
-			it, err := db.NewDBRangeIterator(iterStart, iterStop, common.RangeROpen, false)
-			if err != nil {
-				return 0, err
-			}
-			for ; it.Valid(); it.Next() {
-				rawk := it.RefKey()
-				wb.Delete(rawk)
-			}
-			it.Close()
+		if err := db.bitDeleteChunks(wb, table, rk, bmSize); err != nil {
+			return 0, err
 		}
 
 		db.delExpire(BitmapType, key, nil, false, wb)
@@ -401,6 +393,24 @@ func (db *RockDB) BitClear(ts int64, key []byte) (int64, error) {
 	return 1, err
 }
 
+func (db *RockDB) bitDeleteChunks(wb engine.WriteBatch, table []byte, rk []byte, bmSize int64) error {
+	iterStart, _ := encodeBitmapStartKey(table, rk, 0)
+	iterStop, _ := encodeBitmapStopKey(table, rk)
+	if bmSize/bitmapSegBytes > RangeDeleteNum {
+		wb.DeleteRange(iterStart, iterStop)
+		return nil
+	}
+	it, err := db.NewDBRangeIterator(iterStart, iterStop, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		wb.Delete(it.RefKey())
+	}
+	return nil
+}
+
 func (db *RockDB) BitKeyExist(key []byte) (int64, error) {
 	n, err := db.collKeyExists(BitmapType, key)
 	if err != nil {
@@ -419,3 +429,676 @@ func (db *RockDB) BitExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
 func (db *RockDB) BitPersist(ts int64, key []byte) (int64, error) {
 	return db.collPersist(ts, BitmapType, key)
 }
+
+// bitmapReader read the bitmap chunks for both the old kv format and the new chunked format,
+// the old kv value is split to the chunks in the same way as the new format.
+type bitmapReader struct {
+	db    *RockDB
+	lock  bool
+	size  int64
+	isV2  bool
+	old   []byte
+	table []byte
+	rk    []byte
+	// the chunks loaded for the bitfield, it may be modified and written back
+	chunks map[int64][]byte
+	dirty  map[int64]bool
+}
+
+func (db *RockDB) newBitmapReader(tn int64, key []byte, lock bool) (*bitmapReader, error) {
+	r := &bitmapReader{db: db, lock: lock}
+	oldh, bmSize, _, ok, err := db.getBitmapMeta(tn, key, lock)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		table, rk, err := extractTableFromRedisKey(key)
+		if err != nil {
+			return nil, err
+		}
+		r.isV2 = true
+		r.size = bmSize
+		r.table = table
+		r.rk = db.expiration.encodeToVersionKey(BitmapType, oldh, rk)
+		return r, nil
+	}
+	keyInfo, v, err := db.getDBKVRealValueAndHeader(tn, key, lock)
+	if err != nil {
+		return nil, err
+	}
+	if !keyInfo.Expired {
+		r.old = v
+		r.size = int64(len(v))
+	}
+	return r, nil
+}
+
+// iterate the stored chunks from the start index, the missing chunks are all zero bits
+// and will be skipped. The chunk passed to fn is only valid before fn returned.
+func (r *bitmapReader) forEachChunk(start int64, fn func(index int64, chunk []byte) bool) error {
+	start = start / bitmapSegBytes * bitmapSegBytes
+	if !r.isV2 {
+		for i := start; i < int64(len(r.old)); i += bitmapSegBytes {
+			end := i + bitmapSegBytes
+			if end > int64(len(r.old)) {
+				end = int64(len(r.old))
+			}
+			if !fn(i, r.old[i:end]) {
+				return nil
+			}
+		}
+		return nil
+	}
+	iterStart, _ := encodeBitmapStartKey(r.table, r.rk, start)
+	iterStop, _ := encodeBitmapStopKey(r.table, r.rk)
+	it, err := r.db.NewDBRangeIterator(iterStart, iterStop, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		_, _, index, err := decodeBitmapKey(it.RefKey())
+		if err != nil {
+			return err
+		}
+		if !fn(index, it.RefValue()) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *bitmapReader) chunk(index int64) ([]byte, error) {
+	if v, ok := r.chunks[index]; ok {
+		return v, nil
+	}
+	var v []byte
+	if r.isV2 {
+		bmk, err := encodeBitmapKey(r.table, r.rk, index)
+		if err != nil {
+			return nil, err
+		}
+		if r.lock {
+			v, err = r.db.GetBytes(bmk)
+		} else {
+			v, err = r.db.GetBytesNoLock(bmk)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if index < int64(len(r.old)) {
+		end := index + bitmapSegBytes
+		if end > int64(len(r.old)) {
+			end = int64(len(r.old))
+		}
+		v = append([]byte{}, r.old[index:end]...)
+	}
+	if r.chunks == nil {
+		r.chunks = make(map[int64][]byte)
+	}
+	r.chunks[index] = v
+	return v, nil
+}
+
+func (r *bitmapReader) getBit(offset int64) (uint64, error) {
+	index := (offset / bitmapSegBits) * bitmapSegBytes
+	v, err := r.chunk(index)
+	if err != nil {
+		return 0, err
+	}
+	byteOffset := int((offset / 8) % bitmapSegBytes)
+	if byteOffset >= len(v) {
+		return 0, nil
+	}
+	bit := 7 - uint8(uint32(offset)&0x7)
+	return uint64(v[byteOffset]>>bit) & 1, nil
+}
+
+func (r *bitmapReader) setBit(offset int64, on uint64) error {
+	index := (offset / bitmapSegBits) * bitmapSegBytes
+	v, err := r.chunk(index)
+	if err != nil {
+		return err
+	}
+	byteOffset := int((offset / 8) % bitmapSegBytes)
+	if byteOffset >= len(v) {
+		v = append(v, make([]byte, byteOffset-len(v)+1)...)
+		r.chunks[index] = v
+		if index+int64(len(v)) > r.size {
+			r.size = index + int64(len(v))
+		}
+	}
+	bit := 7 - uint8(uint32(offset)&0x7)
+	v[byteOffset] &= ^(1 << bit)
+	v[byteOffset] |= uint8(on&0x1) << bit
+	if r.dirty == nil {
+		r.dirty = make(map[int64]bool)
+	}
+	r.dirty[index] = true
+	return nil
+}
+
+const (
+	BitOpAnd byte = 0
+	BitOpOr  byte = 1
+	BitOpXor byte = 2
+	BitOpNot byte = 3
+)
+
+var (
+	errBitOpNotKeys = errors.New("BITOP NOT must be called with a single source key")
+	errBitOpInvalid = errors.New("invalid bitop operation")
+)
+
+func isZeroBytes(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BitOp do the bit operation between the source bitmaps and store the result to the destination.
+// The bitmaps are handled chunk by chunk and the chunks with all zero bits are not stored,
+// so the sparse bitmaps only need read and write the chunks with the bits set. The size of the result
+// is the same as the longest source bitmap, and the destination is deleted if all the sources are empty.
+func (db *RockDB) BitOp(ts int64, op byte, dest []byte, keys ...[]byte) (int64, error) {
+	if len(keys) == 0 {
+		return 0, common.ErrInvalidArgs
+	}
+	if len(keys) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	if op == BitOpNot && len(keys) != 1 {
+		return 0, errBitOpNotKeys
+	}
+	if err := checkKeySize(dest); err != nil {
+		return 0, err
+	}
+	readers := make([]*bitmapReader, 0, len(keys))
+	maxSize := int64(0)
+	for _, key := range keys {
+		r, err := db.newBitmapReader(ts, key, true)
+		if err != nil {
+			return 0, err
+		}
+		if r.size > maxSize {
+			maxSize = r.size
+		}
+		readers = append(readers, r)
+	}
+	var result map[int64][]byte
+	var err error
+	switch op {
+	case BitOpAnd:
+		result, err = bitOpAnd(readers)
+	case BitOpOr, BitOpXor:
+		result, err = bitOpOrXor(readers, op == BitOpXor)
+	case BitOpNot:
+		result, err = bitOpNot(readers[0])
+	default:
+		return 0, errBitOpInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	for index, v := range result {
+		if isZeroBytes(v) {
+			delete(result, index)
+		}
+	}
+	err = db.bitReplaceChunks(ts, dest, maxSize, result)
+	return maxSize, err
+}
+
+func bitOpAnd(readers []*bitmapReader) (map[int64][]byte, error) {
+	var result map[int64][]byte
+	for i, r := range readers {
+		if r.size == 0 {
+			return nil, nil
+		}
+		merged := make(map[int64][]byte)
+		err := r.forEachChunk(0, func(index int64, chunk []byte) bool {
+			if i == 0 {
+				merged[index] = append([]byte{}, chunk...)
+				return len(merged) <= MAX_BATCH_NUM
+			}
+			v, ok := result[index]
+			if !ok {
+				return true
+			}
+			// the bytes after the shorter chunk are all zero
+			if len(chunk) < len(v) {
+				v = v[:len(chunk)]
+			}
+			for j := range v {
+				v[j] &= chunk[j]
+			}
+			merged[index] = v
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(merged) > MAX_BATCH_NUM {
+			return nil, errTooMuchBatchSize
+		}
+		result = merged
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result, nil
+}
+
+func bitOpOrXor(readers []*bitmapReader, isXor bool) (map[int64][]byte, error) {
+	result := make(map[int64][]byte)
+	for _, r := range readers {
+		err := r.forEachChunk(0, func(index int64, chunk []byte) bool {
+			v := result[index]
+			if len(v) < len(chunk) {
+				v = append(v, make([]byte, len(chunk)-len(v))...)
+			}
+			for j := range chunk {
+				if isXor {
+					v[j] ^= chunk[j]
+				} else {
+					v[j] |= chunk[j]
+				}
+			}
+			result[index] = v
+			return len(result) <= MAX_BATCH_NUM
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(result) > MAX_BATCH_NUM {
+			return nil, errTooMuchBatchSize
+		}
+	}
+	return result, nil
+}
+
+func bitOpNot(r *bitmapReader) (map[int64][]byte, error) {
+	// all the missing chunks will be filled with the bits set
+	if (r.size+bitmapSegBytes-1)/bitmapSegBytes > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	result := make(map[int64][]byte)
+	for index := int64(0); index < r.size; index += bitmapSegBytes {
+		l := r.size - index
+		if l > bitmapSegBytes {
+			l = bitmapSegBytes
+		}
+		v := make([]byte, l)
+		for j := range v {
+			v[j] = 0xff
+		}
+		result[index] = v
+	}
+	err := r.forEachChunk(0, func(index int64, chunk []byte) bool {
+		v := result[index]
+		for j := 0; j < len(chunk) && j < len(v); j++ {
+			v[j] = ^chunk[j]
+		}
+		return true
+	})
+	return result, err
+}
+
+// overwrite the bitmap with the new chunks, the old chunks, the old kv format data
+// and the ttl will be removed. The bitmap is deleted if the new size is 0.
+func (db *RockDB) bitReplaceChunks(ts int64, key []byte, bmSize int64, chunks map[int64][]byte) error {
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	_, oldSize, _, ok, err := db.getBitmapMeta(ts, key, false)
+	if err != nil {
+		return err
+	}
+	existed := ok
+	if !ok {
+		oldInfo, oldV, err := db.getDBKVRealValueAndHeader(ts, key, false)
+		if err != nil {
+			return err
+		}
+		if oldV != nil {
+			db.delKVValue(oldInfo.VerKey, wb)
+			db.delExpire(KVType, key, nil, false, wb)
+			existed = true
+		}
+	}
+	keyInfo, err := db.prepareCollKeyForWrite(ts, BitmapType, key, nil)
+	if err != nil {
+		return err
+	}
+	table := keyInfo.Table
+	if oldSize > 0 {
+		if err := db.bitDeleteChunks(wb, table, keyInfo.VerKey, oldSize); err != nil {
+			return err
+		}
+	}
+	if !db.isCompactTTLPolicy() {
+		db.delExpire(BitmapType, key, nil, false, wb)
+	}
+	if bmSize == 0 {
+		wb.Delete(bitEncodeMetaKey(key))
+		if existed {
+			db.IncrTableKeyCount(table, -1, wb)
+		}
+		return db.MaybeCommitBatch()
+	}
+	for index, v := range chunks {
+		bmk, err := encodeBitmapKey(table, keyInfo.VerKey, index)
+		if err != nil {
+			return err
+		}
+		wb.Put(bmk, v)
+	}
+	// the destination is overwritten, so the ttl should be removed as redis
+	oldh := keyInfo.OldHeader
+	oldh.ExpireAt = 0
+	db.updateBitmapMeta(ts, wb, oldh, key, bmSize)
+	if !existed {
+		db.IncrTableKeyCount(table, 1, wb)
+	}
+	return db.MaybeCommitBatch()
+}
+
+// BitPos return the position of the first bit set to 1 or 0 in the byte range [start, end].
+// Only the stored chunks are scanned, and the missing chunks between them are all zero bits.
+func (db *RockDB) BitPos(key []byte, on int, start int64, end int64, endGiven bool) (int64, error) {
+	if (on & ^1) != 0 {
+		return 0, fmt.Errorf("bit should be 0 or 1, got %d", on)
+	}
+	r, err := db.newBitmapReader(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return 0, err
+	}
+	if r.size == 0 {
+		if on == 1 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	start, end = getRange(start, end, r.size)
+	if start > end {
+		return -1, nil
+	}
+	pos := int64(-1)
+	// the next byte not checked, all the bytes before it have no matched bit
+	next := start
+	err = r.forEachChunk(start, func(index int64, chunk []byte) bool {
+		if index > end {
+			return false
+		}
+		if on == 0 && next < index {
+			pos = next * 8
+			return false
+		}
+		from := int64(0)
+		if index < next {
+			from = next - index
+		}
+		to := int64(len(chunk))
+		if index+to > end+1 {
+			to = end + 1 - index
+		}
+		for i := from; i < to; i++ {
+			b := chunk[i]
+			if on == 0 {
+				b = ^b
+			}
+			if b != 0 {
+				pos = (index+i)*8 + int64(bits.LeadingZeros8(b))
+				return false
+			}
+		}
+		if index+to > next {
+			next = index + to
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if pos >= 0 || on == 1 {
+		return pos, nil
+	}
+	if next <= end {
+		return next * 8, nil
+	}
+	// the bits after the bitmap are treated as zero if the end is not given
+	if endGiven {
+		return -1, nil
+	}
+	return r.size * 8, nil
+}
+
+const (
+	BitFieldGet    byte = 0
+	BitFieldSet    byte = 1
+	BitFieldIncrBy byte = 2
+
+	BitFieldOverflowWrap byte = 0
+	BitFieldOverflowSat  byte = 1
+	BitFieldOverflowFail byte = 2
+)
+
+// BitFieldOp is the operation in the bitfield command, the value is the new value for set
+// and the increment for incrby.
+type BitFieldOp struct {
+	Op       byte
+	Signed   bool
+	Bits     uint
+	Offset   int64
+	Value    int64
+	Overflow byte
+}
+
+func (r *bitmapReader) getBitField(offset int64, nbits uint, signed bool) (int64, error) {
+	var v uint64
+	for i := uint(0); i < nbits; i++ {
+		b, err := r.getBit(offset + int64(i))
+		if err != nil {
+			return 0, err
+		}
+		v = (v << 1) | b
+	}
+	if signed && nbits < 64 && v&(1<<(nbits-1)) != 0 {
+		v |= ^uint64(0) << nbits
+	}
+	return int64(v), nil
+}
+
+func (r *bitmapReader) setBitField(offset int64, nbits uint, v uint64) error {
+	for i := uint(0); i < nbits; i++ {
+		if err := r.setBit(offset+int64(i), (v>>(nbits-1-i))&1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// return the new value after increment with the overflow handled, false will be returned
+// if overflow with the fail policy. It is the same as the redis checkUnsignedBitfieldOverflow.
+func bitFieldUnsignedIncr(value uint64, incr int64, nbits uint, overflow byte) (uint64, bool) {
+	max := uint64(1)<<nbits - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+	var limit uint64
+	if value > max || incr > maxIncr {
+		limit = max
+	} else if incr < 0 && incr < minIncr {
+		limit = 0
+	} else {
+		return value + uint64(incr), true
+	}
+	switch overflow {
+	case BitFieldOverflowWrap:
+		return (value + uint64(incr)) & max, true
+	case BitFieldOverflowSat:
+		return limit, true
+	}
+	return 0, false
+}
+
+// same as bitFieldUnsignedIncr for the signed integer, as redis checkSignedBitfieldOverflow.
+func bitFieldSignedIncr(value int64, incr int64, nbits uint, overflow byte) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if nbits < 64 {
+		max = int64(1)<<(nbits-1) - 1
+	}
+	min := -max - 1
+	maxIncr := max - value
+	minIncr := min - value
+	var limit int64
+	if value > max || (nbits != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		limit = max
+	} else if value < min || (nbits != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		limit = min
+	} else {
+		return value + incr, true
+	}
+	switch overflow {
+	case BitFieldOverflowWrap:
+		c := uint64(value) + uint64(incr)
+		if nbits < 64 {
+			mask := ^uint64(0) << nbits
+			if c&(1<<(nbits-1)) != 0 {
+				c |= mask
+			} else {
+				c &= ^mask
+			}
+		}
+		return int64(c), true
+	case BitFieldOverflowSat:
+		return limit, true
+	}
+	return 0, false
+}
+
+func checkBitFieldOps(ops []BitFieldOp) error {
+	for _, op := range ops {
+		if op.Bits == 0 || op.Bits > 64 || (!op.Signed && op.Bits > 63) {
+			return errors.New("invalid bitfield type")
+		}
+		if op.Offset < 0 || op.Offset+int64(op.Bits)-1 > MaxBitOffsetV2 {
+			return ErrBitOverflow
+		}
+	}
+	return nil
+}
+
+func (r *bitmapReader) doBitFieldOps(ops []BitFieldOp) ([]interface{}, error) {
+	rets := make([]interface{}, 0, len(ops))
+	for _, op := range ops {
+		old, err := r.getBitField(op.Offset, op.Bits, op.Signed)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == BitFieldGet {
+			rets = append(rets, old)
+			continue
+		}
+		value, incr := old, op.Value
+		if op.Op == BitFieldSet {
+			value, incr = op.Value, 0
+		}
+		var nv int64
+		var ok bool
+		if op.Signed {
+			nv, ok = bitFieldSignedIncr(value, incr, op.Bits, op.Overflow)
+		} else {
+			var unv uint64
+			unv, ok = bitFieldUnsignedIncr(uint64(value), incr, op.Bits, op.Overflow)
+			nv = int64(unv)
+		}
+		if !ok {
+			rets = append(rets, nil)
+			continue
+		}
+		if err := r.setBitField(op.Offset, op.Bits, uint64(nv)); err != nil {
+			return nil, err
+		}
+		if op.Op == BitFieldSet {
+			rets = append(rets, old)
+		} else {
+			rets = append(rets, nv)
+		}
+	}
+	return rets, nil
+}
+
+// BitFieldRO only run the get operations in the bitfield
+func (db *RockDB) BitFieldRO(key []byte, ops []BitFieldOp) ([]interface{}, error) {
+	if err := checkBitFieldOps(ops); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.Op != BitFieldGet {
+			return nil, errors.New("only the get operation is allowed in the read only bitfield")
+		}
+	}
+	r, err := db.newBitmapReader(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.doBitFieldOps(ops)
+}
+
+// BitField run the operations in the bitfield, only the chunks changed will be written.
+// The old kv format data will be converted to the chunks if changed.
+func (db *RockDB) BitField(ts int64, key []byte, ops []BitFieldOp) ([]interface{}, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	if err := checkBitFieldOps(ops); err != nil {
+		return nil, err
+	}
+	r, err := db.newBitmapReader(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	rets, err := r.doBitFieldOps(ops)
+	if err != nil || len(r.dirty) == 0 {
+		return rets, err
+	}
+
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, err := db.prepareCollKeyForWrite(ts, BitmapType, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	table := keyInfo.Table
+	if !r.isV2 {
+		if r.old != nil {
+			// convert the old data to the chunks
+			for index := int64(0); index < int64(len(r.old)); index += bitmapSegBytes {
+				if _, err := r.chunk(index); err != nil {
+					return nil, err
+				}
+				r.dirty[index] = true
+			}
+			_, oldkey, err := convertRedisKeyToDBKVKey(key)
+			if err != nil {
+				return nil, err
+			}
+			db.delKVValue(oldkey, wb)
+			db.delExpire(KVType, key, nil, false, wb)
+		} else {
+			db.IncrTableKeyCount(table, 1, wb)
+		}
+	}
+	for index := range r.dirty {
+		bmk, err := encodeBitmapKey(table, keyInfo.VerKey, index)
+		if err != nil {
+			return nil, err
+		}
+		wb.Put(bmk, r.chunks[index])
+	}
+	db.updateBitmapMeta(ts, wb, keyInfo.OldHeader, key, r.size)
+	err = db.MaybeCommitBatch()
+	return rets, err
+}
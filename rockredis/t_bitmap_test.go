@@ -585,3 +585,249 @@ func BenchmarkBitGetV2(b *testing.B) {
 		}
 	}
 }
+
+func TestBitmapV2BitOp(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_bitop_1")
+	key2 := []byte("test:testdb_bitop_2")
+	oldKey := []byte("test:testdb_bitop_old")
+	dest := []byte("test:testdb_bitop_dest")
+	tn := time.Now().UnixNano()
+	// the sparse bitmaps with the bits in the far chunks
+	for _, pos := range []int64{1, 9, bitmapSegBits * 100, bitmapSegBits*100 + 3} {
+		_, err := db.BitSetV2(tn, key1, pos, 1)
+		assert.Nil(t, err)
+	}
+	for _, pos := range []int64{1, bitmapSegBits * 100, bitmapSegBits * 200} {
+		_, err := db.BitSetV2(tn, key2, pos, 1)
+		assert.Nil(t, err)
+	}
+	_, err := db.BitSetOld(tn, oldKey, 9, 1)
+	assert.Nil(t, err)
+
+	n, err := db.BitOp(tn, BitOpAnd, dest, key1, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBytes*200+1), n)
+	n, err = db.BitCountV2(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	for _, pos := range []int64{1, bitmapSegBits * 100} {
+		n, err = db.BitGetV2(dest, pos)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+	}
+
+	n, err = db.BitOp(tn, BitOpOr, dest, key1, key2, oldKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBytes*200+1), n)
+	n, err = db.BitCountV2(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+
+	n, err = db.BitOp(tn, BitOpXor, dest, key1, key2, oldKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBytes*200+1), n)
+	n, err = db.BitCountV2(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	for _, pos := range []int64{bitmapSegBits*100 + 3, bitmapSegBits * 200} {
+		n, err = db.BitGetV2(dest, pos)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+	}
+	n, err = db.BitGetV2(dest, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	_, err = db.BitOp(tn, BitOpNot, dest, key1, key2)
+	assert.NotNil(t, err)
+	n, err = db.BitOp(tn, BitOpNot, dest, oldKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = db.BitCountV2(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), n)
+	n, err = db.BitGetV2(dest, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// the result with all zero bits still keep the size
+	n, err = db.BitOp(tn, BitOpAnd, dest, key2, oldKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBytes*200+1), n)
+	n, err = db.BitCountV2(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.BitKeyExist(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// the destination should be deleted if all the sources are empty
+	n, err = db.BitOp(tn, BitOpOr, dest, []byte("test:testdb_bitop_nokey"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.BitKeyExist(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// the old format destination should be replaced
+	n, err = db.BitOp(tn, BitOpAnd, oldKey, key1, oldKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBytes*100+1), n)
+	n, err = db.BitCountV2(oldKey, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.bitGetOld(oldKey, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestBitmapV2BitPos(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_bitpos")
+	n, err := db.BitPos(key, 1, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	n, err = db.BitPos(key, 0, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	tn := time.Now().UnixNano()
+	for _, pos := range []int64{0, 1, bitmapSegBits * 10, bitmapSegBits*20 + 7} {
+		_, err = db.BitSetV2(tn, key, pos, 1)
+		assert.Nil(t, err)
+	}
+	n, err = db.BitPos(key, 1, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.BitPos(key, 0, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = db.BitPos(key, 1, 1, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBits*10), n)
+	n, err = db.BitPos(key, 1, bitmapSegBytes*10+1, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBits*20+7), n)
+	n, err = db.BitPos(key, 1, 1, bitmapSegBytes*10-1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	// the missing chunk is all zero bits
+	n, err = db.BitPos(key, 0, bitmapSegBytes*10, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBits*10+1), n)
+	n, err = db.BitPos(key, 0, bitmapSegBytes*5, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBits*5), n)
+	n, err = db.BitPos(key, 1, -1, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(bitmapSegBits*20+7), n)
+	n, err = db.BitPos(key, 1, 10, 5, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+
+	full := []byte("test:testdb_bitpos_full")
+	for i := int64(0); i < 16; i++ {
+		_, err = db.BitSetV2(tn, full, i, 1)
+		assert.Nil(t, err)
+	}
+	n, err = db.BitPos(full, 0, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(16), n)
+	n, err = db.BitPos(full, 0, 0, -1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+
+	old := []byte("test:testdb_bitpos_old")
+	_, err = db.BitSetOld(tn, old, 20, 1)
+	assert.Nil(t, err)
+	n, err = db.BitPos(old, 1, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), n)
+	n, err = db.BitPos(old, 0, 2, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(16), n)
+}
+
+func TestBitmapV2BitField(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_bitfield")
+	tn := time.Now().UnixNano()
+	rets, err := db.BitField(tn, key, []BitFieldOp{
+		{Op: BitFieldGet, Bits: 8, Offset: 0},
+		{Op: BitFieldSet, Bits: 8, Offset: 0, Value: 255},
+		{Op: BitFieldGet, Bits: 8, Offset: 0},
+		{Op: BitFieldGet, Signed: true, Bits: 8, Offset: 0},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(0), int64(255), int64(-1)}, rets)
+	n, err := db.BitCountV2(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), n)
+
+	rets, err = db.BitField(tn, key, []BitFieldOp{
+		{Op: BitFieldIncrBy, Bits: 8, Offset: 0, Value: 1},
+		{Op: BitFieldIncrBy, Bits: 8, Offset: 0, Value: 300, Overflow: BitFieldOverflowSat},
+		{Op: BitFieldIncrBy, Bits: 8, Offset: 0, Value: 1, Overflow: BitFieldOverflowFail},
+		{Op: BitFieldIncrBy, Signed: true, Bits: 4, Offset: 100, Value: 7},
+		{Op: BitFieldIncrBy, Signed: true, Bits: 4, Offset: 100, Value: 1},
+		{Op: BitFieldIncrBy, Signed: true, Bits: 4, Offset: 100, Value: -20, Overflow: BitFieldOverflowSat},
+		{Op: BitFieldSet, Signed: true, Bits: 64, Offset: 200, Value: -2},
+		{Op: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 200, Value: 3},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(255), nil, int64(7), int64(-8), int64(-8),
+		int64(0), int64(1)}, rets)
+
+	// the packed counter across the chunks
+	offset := int64(bitmapSegBits*100 - 5)
+	rets, err = db.BitField(tn, key, []BitFieldOp{
+		{Op: BitFieldIncrBy, Bits: 16, Offset: offset, Value: 1000},
+		{Op: BitFieldIncrBy, Bits: 16, Offset: offset, Value: 1000},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1000), int64(2000)}, rets)
+	rets, err = db.BitFieldRO(key, []BitFieldOp{
+		{Op: BitFieldGet, Bits: 16, Offset: offset},
+		{Op: BitFieldGet, Bits: 8, Offset: 0},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(2000), int64(255)}, rets)
+	_, err = db.BitFieldRO(key, []BitFieldOp{{Op: BitFieldSet, Bits: 8, Offset: 0}})
+	assert.NotNil(t, err)
+	_, err = db.BitField(tn, key, []BitFieldOp{{Op: BitFieldGet, Bits: 64, Offset: 0}})
+	assert.NotNil(t, err)
+	_, err = db.BitField(tn, key, []BitFieldOp{{Op: BitFieldGet, Signed: true, Bits: 8, Offset: MaxBitOffsetV2}})
+	assert.NotNil(t, err)
+
+	// the get only bitfield will not create the key
+	noKey := []byte("test:testdb_bitfield_nokey")
+	rets, err = db.BitField(tn, noKey, []BitFieldOp{{Op: BitFieldGet, Bits: 8, Offset: 0}})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0)}, rets)
+	n, err = db.BitKeyExist(noKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	old := []byte("test:testdb_bitfield_old")
+	_, err = db.BitSetOld(tn, old, 7, 1)
+	assert.Nil(t, err)
+	rets, err = db.BitField(tn, old, []BitFieldOp{{Op: BitFieldIncrBy, Bits: 8, Offset: 8, Value: 3}})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(3)}, rets)
+	n, err = db.BitCountV2(old, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = db.bitGetOld(old, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
@@ -21,7 +21,7 @@ var (
 
 // note for list/bitmap/zscore subkey is different
 func encodeCollSubKey(dt byte, table []byte, key []byte, subkey []byte) []byte {
-	if dt != HashType && dt != SetType && dt != ZSetType {
+	if dt != HashType && dt != SetType && dt != ZSetType && dt != StreamType {
 		panic(errDataType)
 	}
 	buf := make([]byte, getDataTablePrefixBufLen(dt, table)+len(key)+len(subkey)+1+2)
@@ -47,7 +47,7 @@ func decodeCollSubKey(dbk []byte) (byte, []byte, []byte, []byte, error) {
 		return 0, nil, nil, nil, errDataType
 	}
 	dt := dbk[0]
-	if dt != HashType && dt != SetType && dt != ZSetType {
+	if dt != HashType && dt != SetType && dt != ZSetType && dt != StreamType {
 		return dt, nil, nil, nil, errDataType
 	}
 	table, pos, err := decodeDataTablePrefixFromBuf(dbk, dt)
@@ -87,7 +87,7 @@ func convertCollDBKeyToRawKey(dbk []byte) (byte, []byte, int64, error) {
 	var verk []byte
 	var err error
 	switch dt {
-	case HashType, SetType, ZSetType:
+	case HashType, SetType, ZSetType, StreamType:
 		_, table, verk, _, err = decodeCollSubKey(dbk)
 	case ListType:
 		table, verk, _, err = lDecodeListKey(dbk)
@@ -145,6 +145,8 @@ func encodeMetaKey(dt byte, key []byte) ([]byte, error) {
 		key = lEncodeMetaKey(key)
 	case ZSetType, ZSizeType, ZScoreType:
 		key = zEncodeSizeKey(key)
+	case StreamType, StreamMetaType:
+		key = xEncodeMetaKey(key)
 	default:
 		return nil, errDataType
 	}
@@ -166,6 +168,9 @@ func (db *RockDB) getCollVerKeyForRange(ts int64, dt byte, key []byte, useLock b
 	case ZSetType:
 		info.RangeStart = zEncodeStartKey(info.Table, info.VerKey)
 		info.RangeEnd = zEncodeStopKey(info.Table, info.VerKey)
+	case StreamType:
+		info.RangeStart = xEncodeStartKey(info.Table, info.VerKey)
+		info.RangeEnd = xEncodeStopKey(info.Table, info.VerKey)
 	default:
 	}
 	return info, nil
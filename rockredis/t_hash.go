@@ -3,6 +3,7 @@ package rockredis
 import (
 	"bytes"
 	"errors"
+	"math"
 	"time"
 
 	ps "github.com/prometheus/client_golang/prometheus"
@@ -315,6 +316,41 @@ func (db *RockDB) HGetVer(key []byte, field []byte) (int64, error) {
 	return int64(ts), err
 }
 
+// HKeyVer return the newest modify version of all the fields in the hash,
+// note the deleted fields will not be counted.
+func (db *RockDB) HKeyVer(key []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	keyInfo, err := db.getCollVerKeyForRange(0, HashType, key, true)
+	if err != nil {
+		return 0, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return 0, nil
+	}
+	it, err := db.NewDBRangeIterator(keyInfo.RangeStart, keyInfo.RangeEnd, common.RangeROpen, false)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var maxTs int64
+	for ; it.Valid(); it.Next() {
+		v := it.Value()
+		if len(v) < tsLen {
+			continue
+		}
+		ts, err := Uint64(v[len(v)-tsLen:], nil)
+		if err != nil {
+			return 0, err
+		}
+		if int64(ts) > maxTs {
+			maxTs = int64(ts)
+		}
+	}
+	return maxTs, nil
+}
+
 func (db *RockDB) HGetWithOp(key []byte, field []byte, op func([]byte) error) error {
 	tn := time.Now().UnixNano()
 	if err := checkCollKFSize(key, field); err != nil {
@@ -477,7 +513,7 @@ func (db *RockDB) hDeleteAll(ts int64, hkey []byte, hlen int64, wb engine.WriteB
 	sk := hEncodeSizeKey(hkey)
 	wb.Delete(sk)
 	db.topLargeCollKeys.Update(hkey, int(0))
-	if db.cfg.ExpirationPolicy == common.WaitCompact && tableIndexes == nil {
+	if db.isCompactTTLPolicy() && tableIndexes == nil {
 		// for compact ttl , we can just delete the meta
 		return nil
 	}
@@ -635,6 +671,52 @@ func (db *RockDB) HIncrBy(ts int64, key []byte, field []byte, delta int64) (int6
 	return n, err
 }
 
+func (db *RockDB) HIncrByFloat(ts int64, key []byte, field []byte, delta float64) (float64, error) {
+	if err := checkCollKFSize(key, field); err != nil {
+		return 0, err
+	}
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	fv, err := db.hGetRawFieldValue(ts, key, field, true, false)
+	if err != nil {
+		return 0, err
+	}
+
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	var hindex *HsetIndex
+	if tableIndexes != nil {
+		tableIndexes.Lock()
+		defer tableIndexes.Unlock()
+		hindex = tableIndexes.GetHIndexNoLock(string(field))
+	}
+
+	var n float64
+	if fv != nil {
+		if len(fv) >= tsLen {
+			fv = fv[:len(fv)-tsLen]
+		}
+		if n, err = StrFloat64(fv, err); err != nil {
+			return 0, err
+		}
+	}
+
+	n += delta
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, errFloatNaNOrInf
+	}
+
+	_, err = db.hSetField(ts, false, key, field, FormatFloat64ToSlice(n), db.wb, hindex)
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.MaybeCommitBatch()
+	return n, err
+}
+
 func (db *RockDB) HGetAll(key []byte) (int64, []common.KVRecordRet, error) {
 	return db.hGetAll(key, false)
 }
@@ -25,12 +25,17 @@ var (
 )
 
 func encodeHsetIndexNumberKey(table []byte, indexName []byte,
+	indexValue int64, pk []byte, stopKey bool) ([]byte, error) {
+	return encodeIndexNumberKey(hsetIndexDataType, table, indexName, indexValue, pk, stopKey)
+}
+
+func encodeIndexNumberKey(itype byte, table []byte, indexName []byte,
 	indexValue int64, pk []byte, stopKey bool) ([]byte, error) {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = itype
 	pos++
 
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
@@ -57,12 +62,17 @@ func encodeHsetIndexNumberKey(table []byte, indexName []byte,
 }
 
 func encodeHsetIndexStringKey(table []byte, indexName []byte,
+	indexValue []byte, pk []byte, stopKey bool) ([]byte, error) {
+	return encodeIndexStringKey(hsetIndexDataType, table, indexName, indexValue, pk, stopKey)
+}
+
+func encodeIndexStringKey(itype byte, table []byte, indexName []byte,
 	indexValue []byte, pk []byte, stopKey bool) ([]byte, error) {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = itype
 	pos++
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
 	pos += 2
@@ -86,11 +96,15 @@ func encodeHsetIndexStringKey(table []byte, indexName []byte,
 }
 
 func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, error) {
+	return decodeIndexNumberKey(hsetIndexDataType, rawKey)
+}
+
+func decodeIndexNumberKey(itype byte, rawKey []byte) ([]byte, []byte, int64, []byte, error) {
 	pos := 0
 	if len(rawKey) < pos+2+2+1+2+1 {
 		return nil, nil, 0, nil, errHsetIndexKey
 	}
-	if rawKey[0] != IndexDataType || rawKey[1] != hsetIndexDataType {
+	if rawKey[0] != IndexDataType || rawKey[1] != itype {
 		return nil, nil, 0, nil, errHsetIndexKey
 	}
 	pos += 2
@@ -138,11 +152,15 @@ func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, err
 }
 
 func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, error) {
+	return decodeIndexStringKey(hsetIndexDataType, rawKey)
+}
+
+func decodeIndexStringKey(itype byte, rawKey []byte) ([]byte, []byte, []byte, []byte, error) {
 	pos := 0
 	if len(rawKey) < pos+2+2+1+2+1 {
 		return nil, nil, nil, nil, errHsetIndexKey
 	}
-	if rawKey[0] != IndexDataType || rawKey[1] != hsetIndexDataType {
+	if rawKey[0] != IndexDataType || rawKey[1] != itype {
 		return nil, nil, nil, nil, errHsetIndexKey
 	}
 	pos += 2
@@ -190,11 +208,15 @@ func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, er
 }
 
 func encodeHsetIndexStartKey(table []byte, indexName []byte) []byte {
+	return encodeIndexStartKey(hsetIndexDataType, table, indexName)
+}
+
+func encodeIndexStartKey(itype byte, table []byte, indexName []byte) []byte {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = itype
 	pos++
 
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
@@ -212,37 +234,41 @@ func encodeHsetIndexStartKey(table []byte, indexName []byte) []byte {
 }
 
 func encodeHsetIndexStopKey(table []byte, indexName []byte) []byte {
-	k := encodeHsetIndexStartKey(table, indexName)
+	return encodeIndexStopKey(hsetIndexDataType, table, indexName)
+}
+
+func encodeIndexStopKey(itype byte, table []byte, indexName []byte) []byte {
+	k := encodeIndexStartKey(itype, table, indexName)
 	k[len(k)-1] = k[len(k)-1] + 1
 	return k
 }
 
-func encodeHsetIndexNumberStartKey(table []byte, indexName []byte, indexValue int64) ([]byte, error) {
-	return encodeHsetIndexNumberKey(table, indexName, indexValue, nil, false)
+func encodeIndexNumberStartKey(itype byte, table []byte, indexName []byte, indexValue int64) ([]byte, error) {
+	return encodeIndexNumberKey(itype, table, indexName, indexValue, nil, false)
 }
 
-func encodeHsetIndexNumberStopKey(table []byte, indexName []byte, indexValue int64) ([]byte, error) {
-	k, err := encodeHsetIndexNumberKey(table, indexName, indexValue, nil, true)
+func encodeIndexNumberStopKey(itype byte, table []byte, indexName []byte, indexValue int64) ([]byte, error) {
+	k, err := encodeIndexNumberKey(itype, table, indexName, indexValue, nil, true)
 	if err != nil {
 		return nil, err
 	}
 	return k, nil
 }
 
-func encodeHsetIndexStringStartKey(table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
-	return encodeHsetIndexStringKey(table, indexName, indexValue, nil, false)
+func encodeIndexStringStartKey(itype byte, table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
+	return encodeIndexStringKey(itype, table, indexName, indexValue, nil, false)
 }
 
-func encodeHsetIndexStringStopKey(table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
-	k, err := encodeHsetIndexStringKey(table, indexName, indexValue, nil, true)
+func encodeIndexStringStopKey(itype byte, table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
+	k, err := encodeIndexStringKey(itype, table, indexName, indexValue, nil, true)
 	if err != nil {
 		return nil, err
 	}
 	return k, nil
 }
 
-func hsetIndexAddNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
+func indexAddNumberRec(itype byte, table []byte, indexName []byte, indexValue int64, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeIndexNumberKey(itype, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -250,8 +276,8 @@ func hsetIndexAddNumberRec(table []byte, indexName []byte, indexValue int64, pk
 	return nil
 }
 
-func hsetIndexRemoveNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
+func indexRemoveNumberRec(itype byte, table []byte, indexName []byte, indexValue int64, pk []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeIndexNumberKey(itype, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -259,8 +285,8 @@ func hsetIndexRemoveNumberRec(table []byte, indexName []byte, indexValue int64,
 	return nil
 }
 
-func hsetIndexAddStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
+func indexAddStringRec(itype byte, table []byte, indexName []byte, indexValue []byte, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeIndexStringKey(itype, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -268,8 +294,8 @@ func hsetIndexAddStringRec(table []byte, indexName []byte, indexValue []byte, pk
 	return nil
 }
 
-func hsetIndexRemoveStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
+func indexRemoveStringRec(itype byte, table []byte, indexName []byte, indexValue []byte, pk []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeIndexStringKey(itype, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -410,18 +436,37 @@ type HsetIndex struct {
 }
 
 func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	return searchIndexRec(db, hsetIndexDataType, self.Table, &self.HsetIndexInfo, cond, countOnly)
+}
+
+func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
+	return updateIndexRec(hsetIndexDataType, self.Table, &self.HsetIndexInfo, oldvalue, value, pk, wb)
+}
+
+func (self *HsetIndex) RemoveRec(value []byte, pk []byte, wb engine.WriteBatch) {
+	removeIndexRec(hsetIndexDataType, self.Table, &self.HsetIndexInfo, value, pk, wb)
+}
+
+func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
+	return cleanIndexAll(db, hsetIndexDataType, self.Table, &self.HsetIndexInfo)
+}
+
+// the index functions shared by all the secondary index types, the index records for
+// different types are stored in different key ranges by itype
+func searchIndexRec(db *RockDB, itype byte, table []byte, info *HsetIndexInfo,
+	cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
 	var n int64
 	pkList := make([]HIndexResp, 0, 32)
 	var min []byte
 	var max []byte
 	rt := common.RangeClose
 	if cond.StartKey == nil {
-		min = encodeHsetIndexStartKey(self.Table, self.Name)
+		min = encodeIndexStartKey(itype, table, info.Name)
 	}
 	if cond.EndKey == nil {
-		max = encodeHsetIndexStopKey(self.Table, self.Name)
+		max = encodeIndexStopKey(itype, table, info.Name)
 	}
-	if self.ValueType == Int64V || self.ValueType == Int32V {
+	if info.ValueType == Int64V || info.ValueType == Int32V {
 		if cond.StartKey != nil {
 			sn, err := strconv.ParseInt(string(cond.StartKey), 10, 64)
 			if err != nil {
@@ -430,7 +475,7 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 			if !cond.IncludeStart {
 				sn++
 			}
-			min, err = encodeHsetIndexNumberStartKey(self.Table, self.Name, sn)
+			min, err = encodeIndexNumberStartKey(itype, table, info.Name, sn)
 			if err != nil {
 				return n, nil, err
 			}
@@ -443,12 +488,12 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 			if !cond.IncludeEnd {
 				en--
 			}
-			max, err = encodeHsetIndexNumberStopKey(self.Table, self.Name, en)
+			max, err = encodeIndexNumberStopKey(itype, table, info.Name, en)
 			if err != nil {
 				return n, nil, err
 			}
 		}
-	} else if self.ValueType == StringV {
+	} else if info.ValueType == StringV {
 		isLOpen := cond.StartKey != nil && !cond.IncludeStart
 		isROpen := cond.EndKey != nil && !cond.IncludeEnd
 		if isLOpen && isROpen {
@@ -461,12 +506,12 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		var err error
 		if cond.StartKey != nil {
 			if (rt & common.RangeLOpen) > 0 {
-				min, err = encodeHsetIndexStringStopKey(self.Table, self.Name, cond.StartKey)
+				min, err = encodeIndexStringStopKey(itype, table, info.Name, cond.StartKey)
 				if err != nil {
 					return n, nil, err
 				}
 			} else {
-				min, err = encodeHsetIndexStringStartKey(self.Table, self.Name, cond.StartKey)
+				min, err = encodeIndexStringStartKey(itype, table, info.Name, cond.StartKey)
 				if err != nil {
 					return n, nil, err
 				}
@@ -474,12 +519,12 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		}
 		if cond.EndKey != nil {
 			if (rt & common.RangeROpen) > 0 {
-				max, err = encodeHsetIndexStringStartKey(self.Table, self.Name, cond.EndKey)
+				max, err = encodeIndexStringStartKey(itype, table, info.Name, cond.EndKey)
 				if err != nil {
 					return n, nil, err
 				}
 			} else {
-				max, err = encodeHsetIndexStringStopKey(self.Table, self.Name, cond.EndKey)
+				max, err = encodeIndexStringStopKey(itype, table, info.Name, cond.EndKey)
 				if err != nil {
 					return n, nil, err
 				}
@@ -487,7 +532,7 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		}
 	}
 	if dbLog.Level() >= common.LOG_DEBUG {
-		dbLog.Debugf("begin search index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name), string(self.IndexField), min, max)
+		dbLog.Debugf("begin search index: %v-%v-%v, %v~%v", string(table), string(info.Name), string(info.IndexField), min, max)
 	}
 	it, err := db.NewDBRangeLimitIterator(min, max, rt, cond.Offset, cond.Limit, false)
 	if err != nil {
@@ -502,17 +547,17 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		var pk []byte
 		var iv []byte
 		var nv int64
-		if self.ValueType == Int64V || self.ValueType == Int32V {
-			_, _, nv, pk, err = decodeHsetIndexNumberKey(it.Key())
-		} else if self.ValueType == StringV {
-			_, _, iv, pk, err = decodeHsetIndexStringKey(it.Key())
+		if info.ValueType == Int64V || info.ValueType == Int32V {
+			_, _, nv, pk, err = decodeIndexNumberKey(itype, it.Key())
+		} else if info.ValueType == StringV {
+			_, _, iv, pk, err = decodeIndexStringKey(itype, it.Key())
 		} else {
 			continue
 		}
 		if err != nil {
 			continue
 		}
-		if self.Unique == 1 {
+		if info.Unique == 1 {
 			pk = it.Value()
 		}
 		if dbLog.Level() > common.LOG_DETAIL {
@@ -523,65 +568,67 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 	return n, pkList, nil
 }
 
-func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
-	if self.State == DeletedIndex {
+func updateIndexRec(itype byte, table []byte, info *HsetIndexInfo,
+	oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
+	if info.State == DeletedIndex {
 		return nil
 	}
 	pkkey := pk
 	pkvalue := emptyValue
-	if self.Unique == 1 {
+	if info.Unique == 1 {
 		pkkey = nil
 		pkvalue = pk
 	}
 	if oldvalue != nil {
-		self.RemoveRec(oldvalue, pkkey, wb)
+		removeIndexRec(itype, table, info, oldvalue, pkkey, wb)
 	}
 	if len(value) == 0 {
 		return nil
 	}
-	if self.ValueType == Int64V || self.ValueType == Int32V {
+	if info.ValueType == Int64V || info.ValueType == Int32V {
 		n, err := strconv.ParseInt(string(value), 10, 64)
 		if err != nil {
 			return err
 		}
-		hsetIndexAddNumberRec(self.Table, self.Name, n, pkkey, pkvalue, wb)
-	} else if self.ValueType == StringV {
-		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
-			value = value[:self.PrefixLen]
+		indexAddNumberRec(itype, table, info.Name, n, pkkey, pkvalue, wb)
+	} else if info.ValueType == StringV {
+		if info.PrefixLen > 0 && int32(len(value)) > info.PrefixLen {
+			value = value[:info.PrefixLen]
 		}
-		hsetIndexAddStringRec(self.Table, self.Name, value, pkkey, pkvalue, wb)
+		indexAddStringRec(itype, table, info.Name, value, pkkey, pkvalue, wb)
 	}
 	return nil
 }
 
-func (self *HsetIndex) RemoveRec(value []byte, pk []byte, wb engine.WriteBatch) {
+func removeIndexRec(itype byte, table []byte, info *HsetIndexInfo,
+	value []byte, pk []byte, wb engine.WriteBatch) {
 	if value == nil {
 		return
 	}
-	if self.Unique == 1 {
+	if info.Unique == 1 {
 		pk = nil
 	}
-	if self.ValueType == Int64V || self.ValueType == Int32V {
+	if info.ValueType == Int64V || info.ValueType == Int32V {
 		n, err := strconv.ParseInt(string(value), 10, 64)
 		if err != nil {
 			return
 		}
 
-		hsetIndexRemoveNumberRec(self.Table, self.Name, n, pk, wb)
-	} else if self.ValueType == StringV {
-		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
-			value = value[:self.PrefixLen]
+		indexRemoveNumberRec(itype, table, info.Name, n, pk, wb)
+	} else if info.ValueType == StringV {
+		if info.PrefixLen > 0 && int32(len(value)) > info.PrefixLen {
+			value = value[:info.PrefixLen]
 		}
 
-		hsetIndexRemoveStringRec(self.Table, self.Name, value, pk, wb)
+		indexRemoveStringRec(itype, table, info.Name, value, pk, wb)
 	}
 }
 
-func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
-	min := encodeHsetIndexStartKey(self.Table, self.Name)
-	max := encodeHsetIndexStopKey(self.Table, self.Name)
+func cleanIndexAll(db *RockDB, itype byte, table []byte, info *HsetIndexInfo) error {
+	min := encodeIndexStartKey(itype, table, info.Name)
+	max := encodeIndexStopKey(itype, table, info.Name)
 
-	dbLog.Infof("begin clean index: %v-%v-%v", string(self.Table), string(self.Name), string(self.IndexField))
+	dbLog.Infof("begin clean index: %v-%v-%v", string(table), string(info.Name), string(info.IndexField))
 
 	wb := db.rockEng.NewWriteBatch()
 	defer wb.Destroy()
@@ -590,10 +637,10 @@ func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
 
 	err := db.rockEng.Write(wb)
 	if err != nil {
-		dbLog.Infof("clean index %v, %v error: %v", string(self.Table), string(self.Name), err)
+		dbLog.Infof("clean index %v, %v error: %v", string(table), string(info.Name), err)
 	} else {
-		dbLog.Infof("clean index: %v-%v-%v done, delete range: %v-%v", string(self.Table),
-			string(self.Name), string(self.IndexField), min, max)
+		dbLog.Infof("clean index: %v-%v-%v done, delete range: %v-%v", string(table),
+			string(info.Name), string(info.IndexField), min, max)
 	}
 	return nil
 }
@@ -2,6 +2,7 @@ package rockredis
 
 import (
 	"bytes"
+	"math"
 	"os"
 	"strconv"
 	"testing"
@@ -231,6 +232,35 @@ func TestHashKeyIncrBy(t *testing.T) {
 	}
 }
 
+func TestHashKeyIncrByFloat(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key := []byte("test:hkey_incrfloat_test")
+	if _, err := db.HSet(0, false, key, []byte("hello"), []byte("1.5")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	r, err := db.HIncrByFloat(0, key, []byte("hello"), 0.25)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.75, r)
+	r, err = db.HIncrByFloat(0, key, []byte("hello"), -3)
+	assert.Nil(t, err)
+	assert.Equal(t, -1.25, r)
+	v, err := db.HGet(key, []byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-1.25", string(v))
+	r, err = db.HIncrByFloat(0, key, []byte("world"), 2e3)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(2000), r)
+
+	_, err = db.HIncrByFloat(0, key, []byte("world"), math.Inf(-1))
+	assert.NotNil(t, err)
+	db.HSet(0, false, key, []byte("hello"), []byte("nan"))
+	_, err = db.HIncrByFloat(0, key, []byte("hello"), 1)
+	assert.NotNil(t, err)
+}
+
 func TestHashIndexLoad(t *testing.T) {
 	db := getTestDB(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -317,6 +317,9 @@ func (c *hllCache) onEvicted(rawKey interface{}, value interface{}) {
 	wb := c.db.rockEng.NewWriteBatch()
 	defer wb.Destroy()
 	oldV, _ := c.db.GetBytesNoLock(key)
+	if oldV != nil {
+		oldV, _ = c.db.getRotatedKVValue(key, oldV, false)
+	}
 
 	if c.db.cfg.EnableTableCounter && oldV == nil {
 		c.db.IncrTableKeyCount(table, 1, wb)
@@ -331,7 +334,10 @@ func (c *hllCache) onEvicted(rawKey interface{}, value interface{}) {
 	binary.BigEndian.PutUint64(oldV[1:1+8], oldCnt)
 	oldV = append(oldV, newV...)
 	oldV = append(oldV, tsBuf...)
-	wb.Put(key, oldV)
+	if err := c.db.putKVValue(key, oldV, wb); err != nil {
+		dbLog.Warningf("failed to put %v hll: %v", rawKey, err.Error())
+		return
+	}
 	c.db.rockEng.Write(wb)
 	cost := time.Since(s)
 	slow.LogSlowDBWrite(cost, slow.NewSlowLogInfo(c.db.cfg.DataDir, string(key), "flush pfadd"))
@@ -409,8 +415,14 @@ func (db *RockDB) PFCount(ts int64, keys ...[]byte) (int64, error) {
 			return cntFromItem(ts, item)
 		}
 	}
+	dbKeys := make([][]byte, len(keyList))
+	copy(dbKeys, keyList)
 	db.MultiGetBytes(keyList, keyList, errs)
 	for i, v := range keyList {
+		if errs[i] == nil && v != nil {
+			v, errs[i] = db.getRotatedKVValue(dbKeys[i], v, true)
+			keyList[i] = v
+		}
 		if errs[i] == nil && len(v) >= tsLen {
 			keyList[i] = keyList[i][:len(v)-tsLen]
 		}
@@ -494,6 +506,12 @@ func (db *RockDB) PFAdd(ts int64, rawKey []byte, elems ...[]byte) (int64, error)
 	changed := false
 	if !ok {
 		oldV, _ := db.GetBytesNoLock(key)
+		if oldV != nil {
+			oldV, err = db.getRotatedKVValue(key, oldV, false)
+			if err != nil {
+				return 0, err
+			}
+		}
 		if oldV != nil {
 			if len(oldV) < 8+1+tsLen {
 				return 0, errInvalidHLLData
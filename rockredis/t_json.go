@@ -101,6 +101,23 @@ func (db *RockDB) getOldJSON(table []byte, rk []byte) ([]byte, []byte, bool, err
 	return ek, oldV, true, nil
 }
 
+func (db *RockDB) JGetVer(key []byte) (int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, err
+	}
+	ek, err := encodeJSONKey(table, rk)
+	if err != nil {
+		return 0, err
+	}
+	var ts uint64
+	v, err := db.GetBytes(ek)
+	if len(v) >= tsLen {
+		ts, err = Uint64(v[len(v)-tsLen:], err)
+	}
+	return int64(ts), err
+}
+
 func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64, error) {
 	if !gjson.Valid(string(value)) {
 		dbLog.Debugf("invalid json: %v", string(value))
@@ -113,17 +130,16 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 
 	// index lock should before any db read or write since it may be changed by indexing
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
-	var index *JSONIndex
 	if tableIndexes != nil {
 		tableIndexes.Lock()
 		defer tableIndexes.Unlock()
-		index = tableIndexes.GetJSONIndexNoLock(string(path))
 	}
 
 	ek, oldV, isExist, err := db.getOldJSON(table, rk)
 	if err != nil {
 		return 0, err
 	}
+	origV := oldV
 
 	oldV, err = db.jSetPath(oldV, convertJSONPath(path), value)
 	if err != nil {
@@ -137,15 +153,17 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 		dbLog.Infof("invalid json: %v", string(value))
 		return 0, errInvalidJSONValue
 	}
-	// TODO: update index for path
-	_ = index
+	err = db.jsonIndexUpdateRecs(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	if isExist {
 		return 0, err
 	}
@@ -173,18 +191,13 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if err != nil {
 		return err
 	}
+	origV := oldV
 
 	for i := 0; i < len(args); i++ {
 		path := args[i].Key
 		oldV, err = db.jSetPath(oldV, convertJSONPath(path), args[i].Value)
-		if tableIndexes != nil {
-			if index := tableIndexes.GetJSONIndexNoLock(string(path)); index != nil {
-				//oldPathV := gjson.GetBytes(oldV, string(path))
-				//err = index.UpdateRec(oldPathV, args[i].Value, key, db.wb)
-				//if err != nil {
-				//	return err
-				//}
-			}
+		if err != nil {
+			return err
 		}
 	}
 	if err := checkJSONValueSize(oldV); err != nil {
@@ -193,13 +206,17 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if !gjson.Valid(string(oldV)) {
 		return errInvalidJSONValue
 	}
+	err = db.jsonIndexUpdateRecs(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return err
+	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return err
 }
 
@@ -279,6 +296,10 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 	jpath := convertJSONPath(path)
 	if jpath == "" {
 		// delete whole json
+		err = db.jsonIndexUpdateRecs(tableIndexes, key, oldV, nil, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		db.wb.Delete(ek)
 		db.IncrTableKeyCount(table, -1, db.wb)
 	} else {
@@ -289,12 +310,16 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 		if bytes.Equal(newV, oldV) {
 			return 0, nil
 		}
+		err = db.jsonIndexUpdateRecs(tableIndexes, key, oldV, newV, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		oldV = newV
 		tsBuf := PutInt64(ts)
 		oldV = append(oldV, tsBuf...)
 		db.wb.Put(ek, oldV)
 	}
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return 1, err
 }
 
@@ -340,6 +365,7 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	} else {
 		jpath += ".-1"
 	}
+	origV := oldV
 	for _, json := range jsons {
 		oldV, err = db.jSetPath(oldV, jpath, json)
 		if err != nil {
@@ -353,13 +379,17 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if !gjson.Valid(string(oldV)) {
 		return 0, errInvalidJSONValue
 	}
+	err = db.jsonIndexUpdateRecs(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return int64(arrySize), err
 }
 
@@ -404,14 +434,19 @@ func (db *RockDB) JArrayPop(ts int64, key []byte, path []byte) (string, error) {
 		jpath += ".-1"
 	}
 	poped := oldJSON.Array()[arrySize-1].String()
-	oldV, err = sjson.DeleteBytes(oldV, jpath)
+	newV, err := sjson.DeleteBytes(oldV, jpath)
+	if err != nil {
+		return "", err
+	}
+	err = db.jsonIndexUpdateRecs(tableIndexes, key, oldV, newV, db.wb)
 	if err != nil {
 		return "", err
 	}
+	oldV = newV
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return poped, err
 }
 
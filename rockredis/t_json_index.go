@@ -0,0 +1,160 @@
+package rockredis
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// JSONIndex is the secondary index on the json path, the index field
+// in the index info is the canonical json path (converted by convertJSONPath)
+type JSONIndex struct {
+	Table []byte
+	HsetIndexInfo
+}
+
+func (self *JSONIndex) getPathValue(jdata []byte) []byte {
+	if len(jdata) == 0 {
+		return nil
+	}
+	r := gjson.GetBytes(jdata, string(self.IndexField))
+	if !r.Exists() || r.Type == gjson.Null {
+		return nil
+	}
+	if (self.ValueType == Int64V || self.ValueType == Int32V) && r.Type == gjson.Number {
+		return []byte(strconv.FormatInt(r.Int(), 10))
+	}
+	return []byte(r.String())
+}
+
+func (self *JSONIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	return searchIndexRec(db, jsonIndexDataType, self.Table, &self.HsetIndexInfo, cond, countOnly)
+}
+
+// UpdateRec update the index record using the value at index path in the old and new json
+func (self *JSONIndex) UpdateRec(oldJSON []byte, newJSON []byte, pk []byte, wb engine.WriteBatch) error {
+	oldv := self.getPathValue(oldJSON)
+	newv := self.getPathValue(newJSON)
+	if oldv != nil && newv != nil && bytes.Equal(oldv, newv) {
+		return nil
+	}
+	if oldv == nil && newv == nil {
+		return nil
+	}
+	return updateIndexRec(jsonIndexDataType, self.Table, &self.HsetIndexInfo, oldv, newv, pk, wb)
+}
+
+func (self *JSONIndex) RemoveRec(oldJSON []byte, pk []byte, wb engine.WriteBatch) {
+	removeIndexRec(jsonIndexDataType, self.Table, &self.HsetIndexInfo, self.getPathValue(oldJSON), pk, wb)
+}
+
+func (self *JSONIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
+	return cleanIndexAll(db, jsonIndexDataType, self.Table, &self.HsetIndexInfo)
+}
+
+// should be called while holding the table indexes lock
+func (db *RockDB) jsonIndexUpdateRecs(tableIndexes *TableIndexContainer, pk []byte,
+	oldJSON []byte, newJSON []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, index := range tableIndexes.jsonIndexes {
+		if index.State == InitIndex {
+			continue
+		}
+		err := index.UpdateRec(oldJSON, newJSON, pk, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONIndexSearch return the json keys for matching json path value
+func (db *RockDB) JSONIndexSearch(table []byte, path []byte, cond *IndexCondition, countOnly bool) (IndexPropertyDType, int64, []HIndexResp, error) {
+	jindex, err := db.getIndexer().GetJSONIndex(string(table), string(path))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if jindex.State == DeletedIndex {
+		return jindex.ValueType, 0, nil, ErrIndexDeleted
+	}
+
+	n, ret, err := jindex.SearchRec(db, cond, countOnly)
+	return jindex.ValueType, n, ret, err
+}
+
+// scan all the json keys in table to build the json indexes, return the total keys
+func (db *RockDB) buildTableJSONIndexes(table string, t *TableIndexContainer,
+	indexes []*JSONIndex, stopChan chan struct{}) (int, error) {
+	startKey, err := encodeJSONStartKey([]byte(table))
+	if err != nil {
+		return 0, err
+	}
+	stopKey := encodeJSONStopKey([]byte(table), nil)
+	rt := common.RangeROpen
+	indexPKCnt := 0
+	for {
+		done, err := func() (bool, error) {
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				dbLog.Infof("rebuild json index for table %v stopped", table)
+				return true, ErrIndexClosed
+			default:
+			}
+			it, err := db.NewDBRangeLimitIterator(startKey, stopKey, rt, 0, buildIndexBlock, false)
+			if err != nil {
+				return true, err
+			}
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			cnt := 0
+			var lastKey []byte
+			for ; it.Valid(); it.Next() {
+				cnt++
+				lastKey = it.Key()
+				_, rk, err := decodeJSONKey(lastKey)
+				if err != nil {
+					dbLog.Infof("rebuild json index for table %v decode key %v error %v ", table, lastKey, err)
+					continue
+				}
+				v := it.Value()
+				if len(v) >= tsLen {
+					v = v[:len(v)-tsLen]
+				}
+				pk := packRedisKey([]byte(table), rk)
+				for _, jindex := range indexes {
+					err = jindex.UpdateRec(nil, v, pk, wb)
+					if err != nil {
+						it.Close()
+						dbLog.Infof("rebuild json index for table %v error %v ", table, err)
+						return true, err
+					}
+				}
+			}
+			it.Close()
+			indexPKCnt += cnt
+			if cnt > 0 {
+				err = db.rockEng.Write(wb)
+				if err != nil {
+					return true, err
+				}
+			}
+			if cnt < buildIndexBlock {
+				return true, nil
+			}
+			startKey = lastKey
+			rt = common.RangeOpen
+			dbLog.Infof("rebuilding json index for table %v current cnt: %v", table, indexPKCnt)
+			return false, nil
+		}()
+		if done {
+			return indexPKCnt, err
+		}
+	}
+}
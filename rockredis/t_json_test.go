@@ -3,6 +3,7 @@ package rockredis
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
@@ -369,3 +370,96 @@ func TestDBJSONKeyArrayOp(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), n)
 }
+
+func TestJSONIndexBuildAndSearch(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var jindex JSONIndex
+	jindex.Table = []byte("test_jindex_table")
+	jindex.Name = []byte("jindex1")
+	jindex.IndexField = []byte(".user.age")
+	jindex.ValueType = Int64V
+
+	key1 := []byte(string(jindex.Table) + ":testdb_json_a")
+	key2 := []byte(string(jindex.Table) + ":testdb_json_b")
+	key3 := []byte(string(jindex.Table) + ":testdb_json_c")
+	_, err := db.JSet(0, key1, []byte(""), []byte(`{"user":{"age":10}}`))
+	assert.Nil(t, err)
+	_, err = db.JSet(0, key2, []byte(""), []byte(`{"user":{"age":20}}`))
+	assert.Nil(t, err)
+
+	err = db.indexMgr.AddJSONIndex(db, &jindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.AddJSONIndex(db, &jindex)
+	assert.Equal(t, ErrIndexExist, err)
+	err = db.indexMgr.UpdateJSONIndexState(db, string(jindex.Table), "user.age", BuildingIndex)
+	assert.Nil(t, err)
+	buildStart := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		index, err := db.indexMgr.GetJSONIndex(string(jindex.Table), ".user.age")
+		assert.Nil(t, err)
+		if index.State == BuildDoneIndex {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("building index timeout")
+			break
+		}
+	}
+	condAll := &IndexCondition{
+		Offset: 0,
+		Limit:  -1,
+	}
+	_, cnt, _, err := db.JSONIndexSearch(jindex.Table, []byte("user.age"), condAll, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+
+	// index should be updated while writing the json
+	_, err = db.JSet(0, key3, []byte(""), []byte(`{"user":{"age":30}}`))
+	assert.Nil(t, err)
+	_, err = db.JSet(0, key1, []byte("user.age"), []byte(`15`))
+	assert.Nil(t, err)
+	_, err = db.JDel(0, key2, []byte(""))
+	assert.Nil(t, err)
+
+	condGt := &IndexCondition{
+		StartKey:     []byte("10"),
+		IncludeStart: false,
+		Offset:       0,
+		Limit:        -1,
+	}
+	_, cnt, pkList, err := db.JSONIndexSearch(jindex.Table, []byte("user.age"), condGt, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+	assert.Equal(t, key1, pkList[0].PKey)
+	assert.Equal(t, int64(15), pkList[0].IndexIntValue)
+	assert.Equal(t, key3, pkList[1].PKey)
+	assert.Equal(t, int64(30), pkList[1].IndexIntValue)
+
+	_, err = db.JDel(0, key3, []byte("user.age"))
+	assert.Nil(t, err)
+	_, cnt, _, err = db.JSONIndexSearch(jindex.Table, []byte("user.age"), condAll, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+
+	schema, err := db.GetIndexSchema(string(jindex.Table))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(schema.JSONIndexes))
+	assert.Equal(t, "user.age", schema.JSONIndexes[0].IndexPath)
+
+	err = db.indexMgr.UpdateJSONIndexState(db, string(jindex.Table), "user.age", DeletedIndex)
+	assert.Nil(t, err)
+	buildStart = time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		_, err := db.indexMgr.GetJSONIndex(string(jindex.Table), "user.age")
+		if err == ErrIndexNotExist {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("clean index timeout")
+			break
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/bits"
 	"time"
 
@@ -242,6 +243,10 @@ func (db *RockDB) getRawDBKVValue(ts int64, rawKey []byte, useLock bool) ([]byte
 	if v == nil {
 		return table, key, nil, false, nil
 	}
+	v, err = db.getRotatedKVValue(key, v, useLock)
+	if err != nil {
+		return table, key, nil, false, err
+	}
 	expired, err := db.expiration.isExpired(ts, KVType, rawKey, v, useLock)
 	if err != nil {
 		return table, key, v, expired, err
@@ -268,12 +273,46 @@ func (db *RockDB) incr(ts int64, key []byte, delta int64) (int64, error) {
 	n += delta
 	buf := FormatInt64ToSlice(n)
 	buf = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, buf)
-	db.wb.Put(keyInfo.VerKey, buf)
+	if err := db.putKVValue(keyInfo.VerKey, buf, db.wb); err != nil {
+		return 0, err
+	}
+	if created {
+		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
+	}
+
+	err = db.MaybeCommitBatch()
+	return n, err
+}
+
+func (db *RockDB) incrFloat(ts int64, key []byte, delta float64) (float64, error) {
+	keyInfo, realV, err := db.prepareKVValueForWrite(ts, key, false)
+	if err != nil {
+		return 0, err
+	}
+	created := false
+	n := float64(0)
+	if realV == nil || keyInfo.Expired {
+		created = (realV == nil)
+	} else {
+		n, err = StrFloat64(realV, err)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, errFloatNaNOrInf
+	}
+	buf := FormatFloat64ToSlice(n)
+	buf = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, buf)
+	if err := db.putKVValue(keyInfo.VerKey, buf, db.wb); err != nil {
+		return 0, err
+	}
 	if created {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	}
 
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return n, err
 }
 
@@ -298,7 +337,7 @@ func (db *RockDB) kvDel(key []byte, wb engine.WriteBatch) (int64, error) {
 			db.IncrTableKeyCount(table, -1, wb)
 		}
 	}
-	wb.Delete(key)
+	db.delKVValue(key, wb)
 	// fixme: if del is batched, the deleted key may be in write batch while removing cache
 	// and removed cache may be reload by read before the write batch is committed.
 	db.delPFCache(rawKey)
@@ -320,7 +359,7 @@ func (db *RockDB) KVDelWithBatch(key []byte, wb engine.WriteBatch) error {
 			db.IncrTableKeyCount(table, -1, wb)
 		}
 	}
-	wb.Delete(key)
+	db.delKVValue(key, wb)
 	return nil
 }
 
@@ -406,6 +445,10 @@ func (db *RockDB) GetValueWithOpNoLock(rawKey []byte,
 	}
 	return db.rockEng.GetValueWithOpNoLock(key, func(v []byte) error {
 		ts := time.Now().UnixNano()
+		v, err := db.getRotatedKVValue(key, v, false)
+		if err != nil {
+			return err
+		}
 		expired, realV, err := db.getAndCheckExpRealValue(ts, rawKey, v, false)
 		if err != nil {
 			return err
@@ -425,6 +468,10 @@ func (db *RockDB) GetValueWithOp(rawKey []byte,
 	}
 	return db.rockEng.GetValueWithOp(key, func(v []byte) error {
 		ts := time.Now().UnixNano()
+		v, err := db.getRotatedKVValue(key, v, true)
+		if err != nil {
+			return err
+		}
 		expired, realV, err := db.getAndCheckExpRealValue(ts, rawKey, v, false)
 		if err != nil {
 			return err
@@ -469,6 +516,10 @@ func (db *RockDB) IncrBy(ts int64, key []byte, increment int64) (int64, error) {
 	return db.incr(ts, key, increment)
 }
 
+func (db *RockDB) IncrByFloat(ts int64, key []byte, increment float64) (float64, error) {
+	return db.incrFloat(ts, key, increment)
+}
+
 func (db *RockDB) MGet(keys ...[]byte) ([][]byte, []error) {
 	keyList := make([][]byte, len(keys))
 	valueList := make([][]byte, len(keys))
@@ -486,6 +537,9 @@ func (db *RockDB) MGet(keys ...[]byte) ([][]byte, []error) {
 	db.MultiGetBytes(keyList, valueList, errs)
 	//log.Printf("mget: %v", keyList)
 	for i, v := range valueList {
+		if errs[i] == nil && v != nil {
+			v, errs[i] = db.getRotatedKVValue(keyList[i], v, true)
+		}
 		if errs[i] == nil {
 			expired, realV, err := db.getAndCheckExpRealValue(tn, keys[i], v, true)
 			if err != nil {
@@ -538,7 +592,9 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 		if err != nil {
 			return err
 		}
-		db.wb.Put(key, value)
+		if err := db.putKVValue(key, value, db.wb); err != nil {
+			return err
+		}
 	}
 	for t, num := range tableCnt {
 		db.IncrTableKeyCount([]byte(t), int64(num), db.wb)
@@ -575,7 +631,9 @@ func (db *RockDB) KVSetWithOpts(ts int64, rawKey []byte, value []byte, duration
 	// however, we still need del the old expire meta data since it may store the
 	// expire meta data in different place under different expire policy.
 	value, err = db.resetWithNewKVValue(ts, rawKey, value, duration, db.wb)
-	db.wb.Put(keyInfo.VerKey, value)
+	if err := db.putKVValue(keyInfo.VerKey, value, db.wb); err != nil {
+		return 0, err
+	}
 	err = db.MaybeCommitBatch()
 	return 1, err
 }
@@ -600,7 +658,9 @@ func (db *RockDB) setKV(ts int64, rawKey []byte, value []byte, duration int64) e
 	if err != nil {
 		return err
 	}
-	db.wb.Put(key, value)
+	if err := db.putKVValue(key, value, db.wb); err != nil {
+		return err
+	}
 	err = db.MaybeCommitBatch()
 
 	return err
@@ -623,7 +683,9 @@ func (db *RockDB) KVGetSet(ts int64, rawKey []byte, value []byte) ([]byte, error
 	if err != nil {
 		return nil, err
 	}
-	db.wb.Put(keyInfo.VerKey, value)
+	if err := db.putKVValue(keyInfo.VerKey, value, db.wb); err != nil {
+		return nil, err
+	}
 
 	err = db.MaybeCommitBatch()
 	if err != nil {
@@ -667,7 +729,9 @@ func (db *RockDB) SetIfEQ(ts int64, rawKey []byte, oldV []byte, value []byte, du
 		// however, we still need del the old expire meta data since it may store the
 		// expire meta data in different place under different expire policy.
 		value, err = db.resetWithNewKVValue(ts, rawKey, value, duration, db.wb)
-		db.wb.Put(keyInfo.VerKey, value)
+		if err := db.putKVValue(keyInfo.VerKey, value, db.wb); err != nil {
+			return 0, err
+		}
 		err = db.MaybeCommitBatch()
 	}
 	return n, err
@@ -711,9 +775,11 @@ func (db *RockDB) SetRange(ts int64, rawKey []byte, offset int, value []byte) (i
 	retn := len(realV)
 
 	realV = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
-	db.wb.Put(keyInfo.VerKey, realV)
+	if err := db.putKVValue(keyInfo.VerKey, realV, db.wb); err != nil {
+		return 0, err
+	}
 
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 
 	if err != nil {
 		return 0, err
@@ -791,8 +857,10 @@ func (db *RockDB) Append(ts int64, rawKey []byte, value []byte) (int64, error) {
 	dbv := db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
 	// TODO: do we need make sure delete the old expire meta to avoid expire the rewritten new data?
 
-	db.wb.Put(keyInfo.VerKey, dbv)
-	err = db.CommitBatchWrite()
+	if err := db.putKVValue(keyInfo.VerKey, dbv, db.wb); err != nil {
+		return 0, err
+	}
+	err = db.MaybeCommitBatch()
 	if err != nil {
 		return 0, err
 	}
@@ -839,8 +907,10 @@ func (db *RockDB) BitSetOld(ts int64, key []byte, offset int64, on int) (int64,
 	realV[byteOffset] = byteVal
 
 	realV = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
-	db.wb.Put(keyInfo.VerKey, realV)
-	err = db.CommitBatchWrite()
+	if err := db.putKVValue(keyInfo.VerKey, realV, db.wb); err != nil {
+		return 0, err
+	}
+	err = db.MaybeCommitBatch()
 	if err != nil {
 		return 0, err
 	}
@@ -1,6 +1,7 @@
 package rockredis
 
 import (
+	"math"
 	"os"
 	"strconv"
 	"testing"
@@ -161,6 +162,46 @@ func TestDBKV(t *testing.T) {
 	}
 }
 
+func TestDBKVIncrByFloat(t *testing.T) {
+	testIncrByFloat := func(db *RockDB) {
+		defer os.RemoveAll(db.cfg.DataDir)
+		defer db.Close()
+		key := []byte("test:testdb_kv_incrbyfloat")
+		n, err := db.IncrByFloat(0, key, 10.5)
+		assert.Nil(t, err)
+		assert.Equal(t, 10.5, n)
+		n, err = db.IncrByFloat(0, key, 0.1)
+		assert.Nil(t, err)
+		assert.Equal(t, 10.6, n)
+		v, err := db.KVGet(key)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.6", string(v))
+		// the float value can not be used as the integer
+		_, err = db.Incr(0, key)
+		assert.NotNil(t, err)
+		n, err = db.IncrByFloat(0, key, -5.6)
+		assert.Nil(t, err)
+		assert.Equal(t, float64(5), n)
+		c, err := db.IncrBy(0, key, -7)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(-2), c)
+		num, err := db.GetTableKeyCount([]byte("test"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), num)
+
+		_, err = db.IncrByFloat(0, key, math.Inf(1))
+		assert.NotNil(t, err)
+		db.KVSet(0, key, []byte("abc"))
+		_, err = db.IncrByFloat(0, key, 1)
+		assert.NotNil(t, err)
+		v, err = db.KVGet(key)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", string(v))
+	}
+	testIncrByFloat(getTestDB(t))
+	testIncrByFloat(getTestDBWithCompactTTL(t))
+}
+
 func TestDBKVSetIF(t *testing.T) {
 	db := getTestDBWithCompactTTL(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -1,6 +1,7 @@
 package rockredis
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -174,9 +175,9 @@ func (db *RockDB) scanfixListKey(ts int64, key []byte, wb engine.WriteBatch) {
 }
 
 func (db *RockDB) fixListKey(ts int64, key []byte) {
-	defer db.wb.Clear()
+	defer db.MaybeClearBatch()
 	db.scanfixListKey(ts, key, db.wb)
-	db.rockEng.Write(db.wb)
+	db.MaybeCommitBatch()
 }
 
 func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (int64, error) {
@@ -185,7 +186,7 @@ func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (i
 	}
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 	keyInfo, err := db.prepareCollKeyForWrite(ts, ListType, key, nil)
 	if err != nil {
 		return 0, err
@@ -255,7 +256,7 @@ func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (i
 		db.fixListKey(ts, key)
 		return 0, err
 	}
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 
 	newNum := int64(size) + int64(pushCnt)
 	db.topLargeCollKeys.Update(key, int(newNum))
@@ -291,7 +292,7 @@ func (db *RockDB) lpop(ts int64, key []byte, whereSeq int64) ([]byte, error) {
 	}
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 	var value []byte
 
 	var seq int64 = headSeq
@@ -333,7 +334,7 @@ func (db *RockDB) lpop(ts int64, key []byte, whereSeq int64) ([]byte, error) {
 		db.delExpire(ListType, key, nil, false, wb)
 	}
 	db.topLargeCollKeys.Update(key, int(newNum))
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return value, err
 }
 
@@ -352,7 +353,7 @@ func (db *RockDB) ltrim2(ts int64, key []byte, startP, stopP int64) error {
 	table := keyInfo.Table
 	rk := keyInfo.VerKey
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 
 	start := int64(startP)
 	stop := int64(stopP)
@@ -410,7 +411,7 @@ func (db *RockDB) ltrim2(ts int64, key []byte, startP, stopP int64) error {
 	}
 
 	db.topLargeCollKeys.Update(key, int(newLen))
-	return db.rockEng.Write(wb)
+	return db.MaybeCommitBatch()
 }
 
 func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64, error) {
@@ -452,7 +453,7 @@ func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64,
 	}
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 	if trimEndSeq-trimStartSeq > RangeDeleteNum {
 		itemStartKey := lEncodeListKey(table, rk, trimStartSeq)
 		itemEndKey := lEncodeListKey(table, rk, trimEndSeq)
@@ -478,7 +479,7 @@ func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64,
 	}
 
 	db.topLargeCollKeys.Update(key, int(newLen))
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return trimEndSeq - trimStartSeq + 1, err
 }
 
@@ -501,7 +502,7 @@ func (db *RockDB) lDelete(ts int64, key []byte, wb engine.WriteBatch) int64 {
 		db.IncrTableKeyCount(table, -1, wb)
 	}
 	db.topLargeCollKeys.Update(key, int(0))
-	if db.cfg.ExpirationPolicy == common.WaitCompact {
+	if db.isCompactTTLPolicy() {
 		// for compact ttl , we can just delete the meta
 		return size
 	}
@@ -689,7 +690,7 @@ func (db *RockDB) LSet(ts int64, key []byte, index int64, value []byte) error {
 	sk := lEncodeListKey(table, rk, seq)
 	db.lSetMeta(key, keyInfo.OldHeader, headSeq, tailSeq, ts, wb)
 	wb.Put(sk, value)
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	return err
 }
 
@@ -753,6 +754,326 @@ func (db *RockDB) RPop(ts int64, key []byte) ([]byte, error) {
 	return db.lpop(ts, key, listTailSeq)
 }
 
+// RPopLPush pop the tail element from src and push it to the head of dst in the same write batch
+func (db *RockDB) RPopLPush(ts int64, src []byte, dst []byte) ([]byte, error) {
+	return db.lmove(ts, src, dst, listTailSeq, listHeadSeq)
+}
+
+func (db *RockDB) lmove(ts int64, src []byte, dst []byte, srcWhere int64, dstWhere int64) ([]byte, error) {
+	if bytes.Equal(src, dst) {
+		return db.lrotate(ts, src, srcWhere, dstWhere)
+	}
+	if err := checkKeySize(dst); err != nil {
+		return nil, err
+	}
+	// the pop and push should be committed together, if we are already in batching
+	// the batch owner will commit them.
+	owned := db.BeginBatchWrite() == nil
+	v, err := db.lpop(ts, src, srcWhere)
+	if err == nil && v != nil {
+		_, err = db.lpush(ts, dst, dstWhere, v)
+	}
+	if !owned {
+		return v, err
+	}
+	if err != nil {
+		db.AbortBatch()
+		return nil, err
+	}
+	return v, db.CommitBatchWrite()
+}
+
+// move the element from one side to the other side in the same list
+func (db *RockDB) lrotate(ts int64, key []byte, srcWhere int64, dstWhere int64) ([]byte, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	keyInfo, headSeq, tailSeq, size, _, err := db.lHeaderAndMeta(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() || size == 0 {
+		return nil, nil
+	}
+	table := keyInfo.Table
+	rk := keyInfo.VerKey
+	seq := headSeq
+	if srcWhere == listTailSeq {
+		seq = tailSeq
+	}
+	itemKey := lEncodeListKey(table, rk, seq)
+	value, err := db.GetBytesNoLock(itemKey)
+	if err != nil || value == nil {
+		dbLog.Warningf("list %v rotate error: %v, meta: %v, %v, %v", string(key), err,
+			seq, headSeq, tailSeq)
+		db.fixListKey(ts, key)
+		return nil, err
+	}
+	if size == 1 || srcWhere == dstWhere {
+		return value, nil
+	}
+
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	var newSeq int64
+	if srcWhere == listTailSeq {
+		headSeq--
+		tailSeq--
+		newSeq = headSeq
+	} else {
+		headSeq++
+		tailSeq++
+		newSeq = tailSeq
+	}
+	if newSeq <= listMinSeq || newSeq >= listMaxSeq {
+		return nil, errListSeq
+	}
+	wb.Delete(itemKey)
+	wb.Put(lEncodeListKey(table, rk, newSeq), value)
+	_, err = db.lSetMeta(key, keyInfo.OldHeader, headSeq, tailSeq, ts, wb)
+	if err != nil {
+		db.fixListKey(ts, key)
+		return nil, err
+	}
+	err = db.MaybeCommitBatch()
+	return value, err
+}
+
+// LMove pop the element from the head (srcLeft) or tail of src and push it to the head (dstLeft) or tail of dst
+func (db *RockDB) LMove(ts int64, src []byte, dst []byte, srcLeft bool, dstLeft bool) ([]byte, error) {
+	srcWhere := listTailSeq
+	if srcLeft {
+		srcWhere = listHeadSeq
+	}
+	dstWhere := listTailSeq
+	if dstLeft {
+		dstWhere = listHeadSeq
+	}
+	return db.lmove(ts, src, dst, srcWhere, dstWhere)
+}
+
+// read all the elements for the list editing, the list should be small enough to be
+// rewritten in one write batch
+func (db *RockDB) lLoadForEdit(ts int64, key []byte) (collVerKeyInfo, int64, int64, [][]byte, error) {
+	keyInfo, headSeq, tailSeq, size, _, err := db.lHeaderAndMeta(ts, key, false)
+	if err != nil {
+		return keyInfo, 0, 0, nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() || size == 0 {
+		return keyInfo, 0, 0, nil, nil
+	}
+	slow.LogLargeCollection(int(size), slow.NewSlowLogInfo(string(keyInfo.Table), string(key), "list edit"))
+	if size > MAX_BATCH_NUM {
+		return keyInfo, 0, 0, nil, errTooMuchBatchSize
+	}
+	rk := keyInfo.VerKey
+	startKey := lEncodeListKey(keyInfo.Table, rk, headSeq)
+	stopKey := lEncodeListKey(keyInfo.Table, rk, tailSeq)
+	rit, err := db.NewDBRangeLimitIterator(startKey, stopKey, common.RangeClose, 0, int(size), false)
+	if err != nil {
+		return keyInfo, 0, 0, nil, err
+	}
+	values := make([][]byte, 0, size)
+	for ; rit.Valid(); rit.Next() {
+		values = append(values, rit.Value())
+	}
+	rit.Close()
+	if int64(len(values)) != size {
+		dbLog.Warningf("list %v elements number %v mismatch the meta: %v, %v", string(key), len(values),
+			headSeq, tailSeq)
+		db.fixListKey(ts, key)
+		return keyInfo, 0, 0, nil, errListMeta
+	}
+	return keyInfo, headSeq, tailSeq, values, nil
+}
+
+// LRem remove the first count elements equal to value from the head if count > 0, or from
+// the tail if count < 0, all the equal elements are removed if count is 0. The elements after
+// the first removed one are moved forward to keep the sequence continuous.
+func (db *RockDB) LRem(ts int64, key []byte, count int64, value []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	keyInfo, headSeq, tailSeq, values, err := db.lLoadForEdit(ts, key)
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	table := keyInfo.Table
+	rk := keyInfo.VerKey
+
+	size := int64(len(values))
+	limit := size
+	if count > 0 && count < limit {
+		limit = count
+	} else if count < 0 && count > -limit {
+		limit = -count
+	}
+	removed := make([]bool, size)
+	var n int64
+	for i := int64(0); i < size && n < limit; i++ {
+		idx := i
+		if count < 0 {
+			idx = size - 1 - i
+		}
+		if bytes.Equal(values[idx], value) {
+			removed[idx] = true
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	seq := headSeq
+	for i, v := range values {
+		if removed[i] {
+			continue
+		}
+		if seq != headSeq+int64(i) {
+			wb.Put(lEncodeListKey(table, rk, seq), v)
+		}
+		seq++
+	}
+	for delSeq := seq; delSeq <= tailSeq; delSeq++ {
+		wb.Delete(lEncodeListKey(table, rk, delSeq))
+	}
+	newLen, err := db.lSetMeta(key, keyInfo.OldHeader, headSeq, seq-1, ts, wb)
+	if err != nil {
+		db.fixListKey(ts, key)
+		return 0, err
+	}
+	if newLen == 0 {
+		db.IncrTableKeyCount(table, -1, wb)
+		db.delExpire(ListType, key, nil, false, wb)
+	}
+	db.topLargeCollKeys.Update(key, int(newLen))
+	err = db.MaybeCommitBatch()
+	return n, err
+}
+
+// LInsert insert the value before or after the first pivot from the head, the elements on
+// the shorter side of the pivot are moved to make room for the value. Return -1 if the pivot
+// is not found and 0 if the list is empty.
+func (db *RockDB) LInsert(ts int64, key []byte, before bool, pivot []byte, value []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	keyInfo, headSeq, tailSeq, values, err := db.lLoadForEdit(ts, key)
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	table := keyInfo.Table
+	rk := keyInfo.VerKey
+
+	size := int64(len(values))
+	pos := int64(-1)
+	for i, v := range values {
+		if bytes.Equal(v, pivot) {
+			pos = int64(i)
+			break
+		}
+	}
+	if pos < 0 {
+		return -1, nil
+	}
+	if !before {
+		pos++
+	}
+
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	if pos <= size/2 {
+		headSeq--
+		if headSeq <= listMinSeq {
+			return 0, errListSeq
+		}
+		for i := int64(0); i < pos; i++ {
+			wb.Put(lEncodeListKey(table, rk, headSeq+i), values[i])
+		}
+	} else {
+		tailSeq++
+		if tailSeq >= listMaxSeq {
+			return 0, errListSeq
+		}
+		for i := size - 1; i >= pos; i-- {
+			wb.Put(lEncodeListKey(table, rk, headSeq+i+1), values[i])
+		}
+	}
+	wb.Put(lEncodeListKey(table, rk, headSeq+pos), value)
+	newLen, err := db.lSetMeta(key, keyInfo.OldHeader, headSeq, tailSeq, ts, wb)
+	if err != nil {
+		db.fixListKey(ts, key)
+		return 0, err
+	}
+	db.topLargeCollKeys.Update(key, int(newLen))
+	err = db.MaybeCommitBatch()
+	return newLen, err
+}
+
+// LPos return the indexes of the elements equal to value. The matches are skipped until the
+// rank-th match, negative rank means searching from the tail. All the matches are returned if
+// count is 0, and at most maxLen elements are compared if maxLen is not 0.
+func (db *RockDB) LPos(key []byte, value []byte, rank int64, count int64, maxLen int64) ([]int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	ts := time.Now().UnixNano()
+	keyInfo, headSeq, tailSeq, size, _, err := db.lHeaderAndMeta(ts, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() || size == 0 {
+		return nil, nil
+	}
+	scanLen := size
+	if maxLen > 0 && maxLen < scanLen {
+		scanLen = maxLen
+	}
+	if scanLen > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	reverse := rank < 0
+	startSeq := headSeq
+	stopSeq := headSeq + scanLen - 1
+	if reverse {
+		startSeq = tailSeq - scanLen + 1
+		stopSeq = tailSeq
+	}
+	skip := rank - 1
+	if reverse {
+		skip = -rank - 1
+	}
+
+	startKey := lEncodeListKey(keyInfo.Table, keyInfo.VerKey, startSeq)
+	stopKey := lEncodeListKey(keyInfo.Table, keyInfo.VerKey, stopSeq)
+	rit, err := db.NewDBRangeLimitIterator(startKey, stopKey, common.RangeClose, 0, int(scanLen), reverse)
+	if err != nil {
+		return nil, err
+	}
+	defer rit.Close()
+	var matched []int64
+	for i := int64(0); rit.Valid(); rit.Next() {
+		if bytes.Equal(rit.RefValue(), value) {
+			if skip > 0 {
+				skip--
+			} else {
+				idx := i
+				if reverse {
+					idx = size - 1 - i
+				}
+				matched = append(matched, idx)
+				if count > 0 && int64(len(matched)) >= count {
+					break
+				}
+			}
+		}
+		i++
+	}
+	return matched, nil
+}
+
 func (db *RockDB) RPush(ts int64, key []byte, args ...[]byte) (int64, error) {
 	if len(args) > MAX_BATCH_NUM {
 		return 0, errTooMuchBatchSize
@@ -767,7 +1088,7 @@ func (db *RockDB) LClear(ts int64, key []byte) (int64, error) {
 	num := db.lDelete(ts, key, db.wb)
 	//delete the expire data related to the list key
 	db.delExpire(ListType, key, nil, false, db.wb)
-	err := db.CommitBatchWrite()
+	err := db.MaybeCommitBatch()
 	// num should be the deleted key number
 	if num > 0 {
 		return 1, err
@@ -787,7 +1108,7 @@ func (db *RockDB) LMclear(keys ...[]byte) (int64, error) {
 		db.lDelete(0, key, db.wb)
 		db.delExpire(ListType, key, nil, false, db.wb)
 	}
-	err := db.CommitBatchWrite()
+	err := db.MaybeCommitBatch()
 	if err != nil {
 		// TODO: log here , the list maybe corrupt
 	}
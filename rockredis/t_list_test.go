@@ -294,6 +294,218 @@ func TestListPop(t *testing.T) {
 	}
 }
 
+func TestListRPopLPush(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	src := []byte("test:rpoplpush_src")
+	dst := []byte("test:rpoplpush_dst")
+	v, err := db.RPopLPush(0, src, dst)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	_, err = db.RPush(0, src, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	// rotate in the same list
+	v, err = db.RPopLPush(0, src, src)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), v)
+	vlist, err := db.LRange(src, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a"), []byte("b")}, vlist)
+
+	v, err = db.RPopLPush(0, src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), v)
+	v, err = db.RPopLPush(0, src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), v)
+	vlist, err = db.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, vlist)
+	n, err := db.LLen(src)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	v, err = db.RPopLPush(0, src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), v)
+	n, err = db.LLen(src)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.LKeyExists(src)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	vlist, err = db.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a"), []byte("b")}, vlist)
+}
+
+func toByteSlices(strs ...string) [][]byte {
+	bs := make([][]byte, 0, len(strs))
+	for _, str := range strs {
+		bs = append(bs, []byte(str))
+	}
+	return bs
+}
+
+func TestListLMove(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	src := []byte("test:lmove_src")
+	dst := []byte("test:lmove_dst")
+	_, err := db.RPush(0, src, toByteSlices("a", "b", "c")...)
+	assert.Nil(t, err)
+	v, err := db.LMove(0, src, dst, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), v)
+	v, err = db.LMove(0, src, dst, true, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), v)
+	vlist, err := db.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("b", "a"), vlist)
+	v, err = db.LMove(0, dst, dst, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), v)
+	vlist, err = db.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("a", "b"), vlist)
+}
+
+func TestListLRem(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:lrem")
+	n, err := db.LRem(0, key, 0, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	_, err = db.RPush(0, key, toByteSlices("a", "b", "a", "c", "a", "b")...)
+	assert.Nil(t, err)
+
+	n, err = db.LRem(0, key, 1, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	vlist, err := db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("b", "a", "c", "a", "b"), vlist)
+
+	n, err = db.LRem(0, key, -1, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	vlist, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("b", "a", "c", "a"), vlist)
+
+	n, err = db.LRem(0, key, 0, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	vlist, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("b", "c"), vlist)
+	n, err = db.LRem(0, key, 0, []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// push and pop should work after compacted
+	_, err = db.RPush(0, key, []byte("d"))
+	assert.Nil(t, err)
+	v, err := db.LPop(0, key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), v)
+	vlist, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("c", "d"), vlist)
+
+	n, err = db.LRem(0, key, -10, []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.LRem(0, key, 10, []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.LKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestListLInsert(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:linsert")
+	n, err := db.LInsert(0, key, true, []byte("a"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	_, err = db.RPush(0, key, toByteSlices("a", "b", "c", "d")...)
+	assert.Nil(t, err)
+
+	n, err = db.LInsert(0, key, true, []byte("e"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	n, err = db.LInsert(0, key, true, []byte("a"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = db.LInsert(0, key, false, []byte("a"), []byte("y"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), n)
+	n, err = db.LInsert(0, key, true, []byte("d"), []byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), n)
+	n, err = db.LInsert(0, key, false, []byte("d"), []byte("w"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), n)
+	vlist, err := db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toByteSlices("x", "a", "y", "b", "c", "z", "d", "w"), vlist)
+	v, err := db.LIndex(key, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x"), v)
+	v, err = db.LIndex(key, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("w"), v)
+}
+
+func TestListLPos(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:lpos")
+	pos, err := db.LPos(key, []byte("a"), 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pos))
+	_, err = db.RPush(0, key, toByteSlices("a", "b", "c", "a", "b", "a")...)
+	assert.Nil(t, err)
+
+	pos, err = db.LPos(key, []byte("a"), 1, 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0}, pos)
+	pos, err = db.LPos(key, []byte("a"), 2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3, 5}, pos)
+	pos, err = db.LPos(key, []byte("a"), -1, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 3}, pos)
+	pos, err = db.LPos(key, []byte("b"), -2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, pos)
+	pos, err = db.LPos(key, []byte("c"), 1, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pos))
+	pos, err = db.LPos(key, []byte("c"), 1, 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, pos)
+}
+
 func TestListLPushEmpty(t *testing.T) {
 	db := getTestDB(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -1,6 +1,7 @@
 package rockredis
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -89,7 +90,7 @@ func (db *RockDB) sDelete(tn int64, key []byte, wb engine.WriteBatch) (int64, er
 	wb.Delete(sk)
 
 	db.topLargeCollKeys.Update(key, int(0))
-	if db.cfg.ExpirationPolicy == common.WaitCompact {
+	if db.isCompactTTLPolicy() {
 		// for compact ttl , we can just delete the meta
 		return num, nil
 	}
@@ -191,7 +192,7 @@ func (db *RockDB) SAdd(ts int64, key []byte, args ...[]byte) (int64, error) {
 	}
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 
 	keyInfo, err := db.prepareCollKeyForWrite(ts, SetType, key, nil)
 	if err != nil {
@@ -232,7 +233,7 @@ func (db *RockDB) SAdd(ts int64, key []byte, args ...[]byte) (int64, error) {
 		}).Observe(float64(newNum))
 	}
 
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return num, err
 }
 
@@ -343,6 +344,84 @@ func (db *RockDB) sMembersN(tn int64, key []byte, num int) ([][]byte, error) {
 	return v, nil
 }
 
+// SMembersMulti return the members for each of the keys, all the sets are read from
+// the same db snapshot so they are consistent with each other.
+func (db *RockDB) SMembersMulti(keys ...[]byte) ([][][]byte, error) {
+	if len(keys) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	it, err := db.rockEng.GetIterator(engine.IteratorOpts{WithSnap: true})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	tn := time.Now().UnixNano()
+	sets := make([][][]byte, 0, len(keys))
+	for _, key := range keys {
+		v, err := db.sMembersFromIter(it, tn, key)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, v)
+	}
+	return sets, nil
+}
+
+// read the set meta and members from the iterator to make sure they are in the same snapshot
+func (db *RockDB) sMembersFromIter(it engine.Iterator, tn int64, key []byte) ([][]byte, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(table) == 0 {
+		return nil, errTableName
+	}
+	if err := checkKeySize(rk); err != nil {
+		return nil, err
+	}
+	sk := sEncodeSizeKey(key)
+	var metaV []byte
+	it.Seek(sk)
+	if it.Valid() && bytes.Equal(it.RefKey(), sk) {
+		metaV = it.Value()
+	}
+	h, err := db.expiration.decodeRawValue(SetType, metaV)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := db.expiration.isExpired(tn, SetType, key, metaV, false)
+	if err != nil {
+		return nil, err
+	}
+	if expired || len(h.UserData) == 0 {
+		return [][]byte{}, nil
+	}
+	if len(h.UserData) < 8 {
+		return nil, errIntNumber
+	}
+	n, err := Int64(h.UserData[:8], nil)
+	if err != nil {
+		return nil, err
+	}
+	if n > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	verKey := db.expiration.encodeToVersionKey(SetType, h, rk)
+	stop := sEncodeStopKey(table, verKey)
+	v := make([][]byte, 0, n)
+	for it.Seek(sEncodeStartKey(table, verKey)); it.Valid(); it.Next() {
+		if bytes.Compare(it.RefKey(), stop) >= 0 {
+			break
+		}
+		_, _, m, err := sDecodeSetKey(it.Key())
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, m)
+	}
+	return v, nil
+}
+
 func (db *RockDB) SPop(ts int64, key []byte, count int) ([][]byte, error) {
 	vals, err := db.sMembersN(ts, key, count)
 	if err != nil {
@@ -361,7 +440,7 @@ func (db *RockDB) SRem(ts int64, key []byte, args ...[]byte) (int64, error) {
 		return 0, errTooMuchBatchSize
 	}
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 	keyInfo, err := db.GetCollVersionKey(ts, SetType, key, false)
 	if err != nil {
 		return 0, err
@@ -407,10 +486,139 @@ func (db *RockDB) SRem(ts int64, key []byte, args ...[]byte) (int64, error) {
 	}
 	db.topLargeCollKeys.Update(key, int(newNum))
 
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return num, err
 }
 
+// SMove move the member from src to dst in the same write batch, return 1 if the member is moved
+func (db *RockDB) SMove(ts int64, src []byte, dst []byte, member []byte) (int64, error) {
+	if bytes.Equal(src, dst) {
+		return db.SIsMember(src, member)
+	}
+	if err := checkCollKFSize(dst, member); err != nil {
+		return 0, err
+	}
+	owned := db.BeginBatchWrite() == nil
+	n, err := db.SRem(ts, src, member)
+	if err == nil && n > 0 {
+		_, err = db.SAdd(ts, dst, member)
+	}
+	if !owned {
+		return n, err
+	}
+	if err != nil {
+		db.AbortBatch()
+		return 0, err
+	}
+	return n, db.CommitBatchWrite()
+}
+
+// SInterStore store the intersection of the sets to dest, return the number of the members in dest
+func (db *RockDB) SInterStore(ts int64, dest []byte, keys ...[]byte) (int64, error) {
+	return db.sStore(ts, dest, common.SetInter, keys)
+}
+
+// SUnionStore store the union of the sets to dest, return the number of the members in dest
+func (db *RockDB) SUnionStore(ts int64, dest []byte, keys ...[]byte) (int64, error) {
+	return db.sStore(ts, dest, common.SetUnion, keys)
+}
+
+// SDiffStore store the members of the first set which are not in the other sets to dest,
+// return the number of the members in dest
+func (db *RockDB) SDiffStore(ts int64, dest []byte, keys ...[]byte) (int64, error) {
+	return db.sStore(ts, dest, common.SetDiff, keys)
+}
+
+func (db *RockDB) sStore(ts int64, dest []byte, op func([][][]byte) [][]byte, keys [][]byte) (int64, error) {
+	if len(keys) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	if err := checkKeySize(dest); err != nil {
+		return 0, err
+	}
+	sets := make([][][]byte, 0, len(keys))
+	for _, key := range keys {
+		v, err := db.SMembers(key)
+		if err != nil {
+			return 0, err
+		}
+		sets = append(sets, v)
+	}
+	return db.sReplaceMembers(ts, dest, op(sets))
+}
+
+// overwrite the set with the members, the old members not in the new members will be removed.
+func (db *RockDB) sReplaceMembers(ts int64, key []byte, members [][]byte) (int64, error) {
+	if len(members) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	if len(members) == 0 {
+		if _, err := db.sDelete(ts, key, wb); err != nil {
+			return 0, err
+		}
+		return 0, db.MaybeCommitBatch()
+	}
+	newMembers := make(map[string]bool, len(members))
+	for _, m := range members {
+		if err := checkCollKFSize(key, m); err != nil {
+			return 0, err
+		}
+		newMembers[string(m)] = true
+	}
+	keyInfo, err := db.prepareCollKeyForWrite(ts, SetType, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	table := keyInfo.Table
+	rk := keyInfo.VerKey
+	oldh := keyInfo.OldHeader
+
+	var num int64
+	if !keyInfo.IsNotExistOrExpired() {
+		it, err := db.NewDBRangeIterator(sEncodeStartKey(table, rk), sEncodeStopKey(table, rk), common.RangeROpen, false)
+		if err != nil {
+			return 0, err
+		}
+		for ; it.Valid(); it.Next() {
+			ek := it.Key()
+			_, _, m, err := sDecodeSetKey(ek)
+			if err != nil {
+				it.Close()
+				return 0, err
+			}
+			if newMembers[string(m)] {
+				// already in the set
+				delete(newMembers, string(m))
+			} else {
+				wb.Delete(ek)
+				num--
+			}
+		}
+		it.Close()
+	}
+	for _, m := range members {
+		if !newMembers[string(m)] {
+			continue
+		}
+		delete(newMembers, string(m))
+		wb.Put(sEncodeSetKey(table, rk, m), nil)
+		num++
+	}
+	// the destination is overwritten, so the ttl should be removed as redis
+	oldh.ExpireAt = 0
+	newNum, err := db.sIncrSize(ts, key, oldh, num, wb)
+	if err != nil {
+		return 0, err
+	} else if newNum > 0 && newNum == num && !keyInfo.Expired {
+		db.IncrTableKeyCount(table, 1, wb)
+	}
+	db.topLargeCollKeys.Update(key, int(newNum))
+	err = db.MaybeCommitBatch()
+	return newNum, err
+}
+
 func (db *RockDB) SClear(ts int64, key []byte) (int64, error) {
 	if err := checkKeySize(key); err != nil {
 		return 0, err
@@ -420,7 +628,7 @@ func (db *RockDB) SClear(ts int64, key []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	err = db.CommitBatchWrite()
+	err = db.MaybeCommitBatch()
 	if num > 0 {
 		return 1, err
 	}
@@ -377,6 +377,75 @@ func TestDBSPop(t *testing.T) {
 	assert.Equal(t, int64(0), n)
 }
 
+func TestDBSetAlgebra(t *testing.T) {
+	db := getTestDBWithCompactTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key1 := []byte("test:salgebra_1")
+	key2 := []byte("test:salgebra_2")
+	key3 := []byte("other:salgebra_3")
+	dest := []byte("test:salgebra_dest")
+	ts := time.Now().UnixNano()
+	db.SAdd(ts, key1, []byte("a"), []byte("b"), []byte("c"))
+	db.SAdd(ts, key2, []byte("b"), []byte("c"), []byte("d"))
+
+	sets, err := db.SMembersMulti(key1, key2, key3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(sets))
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, sets[0])
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c"), []byte("d")}, sets[1])
+	assert.Equal(t, 0, len(sets[2]))
+
+	db.SAdd(ts, dest, []byte("x"), []byte("b"))
+	_, err = db.SExpire(ts, dest, 100)
+	assert.Nil(t, err)
+	n, err := db.SInterStore(ts, dest, key1, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	v, err := db.SMembers(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, v)
+	ttl, err := db.SetTtl(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+
+	n, err = db.SUnionStore(ts, dest, key1, key2, key3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	n, err = db.SCard(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+
+	// the dest can be one of the source sets
+	n, err = db.SDiffStore(ts, dest, dest, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	v, err = db.SMembers(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a")}, v)
+
+	n, err = db.SInterStore(ts, dest, key1, key3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.SKeyExists(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = db.SMove(ts, key1, key3, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.SMove(ts, key1, key3, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.SMove(ts, key2, key2, []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	sets, err = db.SMembersMulti(key1, key3)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, sets[0])
+	assert.Equal(t, [][]byte{[]byte("a")}, sets[1])
+}
+
 func BenchmarkSIsMember(b *testing.B) {
 	db := getTestDBForBench()
 	defer os.RemoveAll(db.cfg.DataDir)
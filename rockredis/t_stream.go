@@ -0,0 +1,1112 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	ps "github.com/prometheus/client_golang/prometheus"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/slow"
+)
+
+var (
+	errStreamKey     = errors.New("invalid stream key")
+	errStreamMetaKey = errors.New("invalid stream meta key")
+	errStreamValue   = errors.New("invalid stream value")
+)
+
+var (
+	ErrStreamIDInvalid  = errors.New("ERR Invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamNoGroup    = errors.New("NOGROUP No such key or consumer group")
+	ErrStreamGroupExist = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrStreamNotExist   = errors.New("ERR The XGROUP subcommand requires the key to exist")
+)
+
+// all the sub keys of the stream are stored under the same versioned
+// collection key, and seperated by the sub type after the collection separator.
+const (
+	streamEntrySep   byte = 'e'
+	streamGroupSep   byte = 'g'
+	streamPendingSep byte = 'p'
+
+	streamIDLen = 16
+	// length, last id, modify timestamp
+	streamMetaLen = 8 + streamIDLen + 8
+)
+
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinStreamID = StreamID{}
+	MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// return false if the id is already the max id
+func (id StreamID) Next() (StreamID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return StreamID{Ms: id.Ms + 1, Seq: 0}, true
+	}
+	return id, false
+}
+
+// return false if the id is already the min id
+func (id StreamID) Prev() (StreamID, bool) {
+	if id.Seq > 0 {
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+func (id StreamID) encodeTo(buf []byte) {
+	binary.BigEndian.PutUint64(buf, id.Ms)
+	binary.BigEndian.PutUint64(buf[8:], id.Seq)
+}
+
+func decodeStreamID(buf []byte) (StreamID, error) {
+	if len(buf) < streamIDLen {
+		return StreamID{}, errStreamValue
+	}
+	return StreamID{Ms: binary.BigEndian.Uint64(buf), Seq: binary.BigEndian.Uint64(buf[8:])}, nil
+}
+
+// ParseStreamID parse the id in the format of ms-seq, the seq will be set
+// to the missingSeq if only the ms part is given.
+func ParseStreamID(b []byte, missingSeq uint64) (StreamID, error) {
+	var id StreamID
+	var err error
+	s := string(b)
+	idx := bytes.IndexByte(b, '-')
+	if idx == -1 {
+		id.Ms, err = strconv.ParseUint(s, 10, 64)
+		id.Seq = missingSeq
+	} else {
+		id.Ms, err = strconv.ParseUint(s[:idx], 10, 64)
+		if err == nil {
+			id.Seq, err = strconv.ParseUint(s[idx+1:], 10, 64)
+		}
+	}
+	if err != nil {
+		return id, ErrStreamIDInvalid
+	}
+	return id, nil
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// nil if the entry has been deleted while reading the pending history
+	Fields [][]byte
+}
+
+type StreamPending struct {
+	ID       StreamID
+	Consumer []byte
+	// the last delivery time in millisecond
+	DeliveryTime  int64
+	DeliveryCount int64
+}
+
+type StreamConsumerPending struct {
+	Consumer []byte
+	Count    int64
+}
+
+type StreamPendingSummary struct {
+	Count     int64
+	MinID     StreamID
+	MaxID     StreamID
+	Consumers []StreamConsumerPending
+}
+
+type streamMeta struct {
+	length int64
+	lastID StreamID
+}
+
+func xEncodeMetaKey(key []byte) []byte {
+	buf := make([]byte, len(key)+1+len(metaPrefix))
+	pos := 0
+	buf[pos] = StreamMetaType
+	pos++
+	copy(buf[pos:], metaPrefix)
+	pos += len(metaPrefix)
+
+	copy(buf[pos:], key)
+	return buf
+}
+
+func xDecodeMetaKey(ek []byte) ([]byte, error) {
+	pos := 0
+	if pos+1+len(metaPrefix) > len(ek) || ek[pos] != StreamMetaType {
+		return nil, errStreamMetaKey
+	}
+	pos++
+	pos += len(metaPrefix)
+
+	return ek[pos:], nil
+}
+
+func xEncodeStartKey(table []byte, key []byte) []byte {
+	return encodeCollSubKey(StreamType, table, key, nil)
+}
+
+func xEncodeStopKey(table []byte, key []byte) []byte {
+	k := encodeCollSubKey(StreamType, table, key, nil)
+	k[len(k)-1] = collStopSep
+	return k
+}
+
+func xEncodeEntryKey(table []byte, key []byte, id StreamID) []byte {
+	sub := make([]byte, 1+streamIDLen)
+	sub[0] = streamEntrySep
+	id.encodeTo(sub[1:])
+	return encodeCollSubKey(StreamType, table, key, sub)
+}
+
+func xDecodeEntryKey(ek []byte) (StreamID, error) {
+	_, _, _, sub, err := decodeCollSubKey(ek)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if len(sub) != 1+streamIDLen || sub[0] != streamEntrySep {
+		return StreamID{}, errStreamKey
+	}
+	return decodeStreamID(sub[1:])
+}
+
+func xEncodeGroupKey(table []byte, key []byte, group []byte) []byte {
+	sub := make([]byte, 1+len(group))
+	sub[0] = streamGroupSep
+	copy(sub[1:], group)
+	return encodeCollSubKey(StreamType, table, key, sub)
+}
+
+func xEncodePendingKey(table []byte, key []byte, group []byte, id StreamID) []byte {
+	sub := make([]byte, 1+2+len(group)+streamIDLen)
+	pos := 0
+	sub[pos] = streamPendingSep
+	pos++
+	binary.BigEndian.PutUint16(sub[pos:], uint16(len(group)))
+	pos += 2
+	copy(sub[pos:], group)
+	pos += len(group)
+	id.encodeTo(sub[pos:])
+	return encodeCollSubKey(StreamType, table, key, sub)
+}
+
+func xDecodePendingKey(ek []byte) (StreamID, error) {
+	_, _, _, sub, err := decodeCollSubKey(ek)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if len(sub) < 1+2+streamIDLen || sub[0] != streamPendingSep {
+		return StreamID{}, errStreamKey
+	}
+	return decodeStreamID(sub[len(sub)-streamIDLen:])
+}
+
+// the field and value pairs are encoded as length prefixed bytes
+func encodeStreamFields(fvs [][]byte) []byte {
+	size := 0
+	for _, v := range fvs {
+		size += 4 + len(v)
+	}
+	buf := make([]byte, size)
+	pos := 0
+	for _, v := range fvs {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(v)))
+		pos += 4
+		copy(buf[pos:], v)
+		pos += len(v)
+	}
+	return buf
+}
+
+func decodeStreamFields(buf []byte) ([][]byte, error) {
+	fvs := make([][]byte, 0, 2)
+	for pos := 0; pos < len(buf); {
+		if pos+4 > len(buf) {
+			return nil, errStreamValue
+		}
+		l := int(binary.BigEndian.Uint32(buf[pos:]))
+		pos += 4
+		if pos+l > len(buf) {
+			return nil, errStreamValue
+		}
+		fvs = append(fvs, buf[pos:pos+l])
+		pos += l
+	}
+	return fvs, nil
+}
+
+/*
+the coded format of the pending value:
+bytes:  -0-1-2-3-4-5-6-7-|-8-----------15-|-16-------x-|
+data :   delivery time   | delivery count |  consumer  |
+*/
+func encodeStreamPending(p StreamPending) []byte {
+	buf := make([]byte, 16+len(p.Consumer))
+	binary.BigEndian.PutUint64(buf, uint64(p.DeliveryTime))
+	binary.BigEndian.PutUint64(buf[8:], uint64(p.DeliveryCount))
+	copy(buf[16:], p.Consumer)
+	return buf
+}
+
+func decodeStreamPending(id StreamID, buf []byte) (StreamPending, error) {
+	var p StreamPending
+	if len(buf) < 16 {
+		return p, errStreamValue
+	}
+	p.ID = id
+	p.DeliveryTime = int64(binary.BigEndian.Uint64(buf))
+	p.DeliveryCount = int64(binary.BigEndian.Uint64(buf[8:]))
+	p.Consumer = buf[16:]
+	return p, nil
+}
+
+func decodeStreamMeta(data []byte) (streamMeta, error) {
+	var meta streamMeta
+	if len(data) == 0 {
+		return meta, nil
+	}
+	if len(data) < streamMetaLen {
+		return meta, errStreamValue
+	}
+	meta.length = int64(binary.BigEndian.Uint64(data))
+	meta.lastID, _ = decodeStreamID(data[8:])
+	return meta, nil
+}
+
+// meta data include the stream length, last id and the modify timestamp
+func (db *RockDB) xPutMeta(ts int64, key []byte, oldh *headerMetaValue, meta streamMeta, wb engine.WriteBatch) {
+	buf := make([]byte, streamMetaLen)
+	binary.BigEndian.PutUint64(buf, uint64(meta.length))
+	meta.lastID.encodeTo(buf[8:])
+	binary.BigEndian.PutUint64(buf[8+streamIDLen:], uint64(ts))
+	oldh.UserData = buf
+	wb.Put(xEncodeMetaKey(key), oldh.encodeWithData())
+}
+
+func (db *RockDB) xGetMeta(ts int64, key []byte, useLock bool) (collVerKeyInfo, streamMeta, error) {
+	var meta streamMeta
+	keyInfo, err := db.getCollVerKeyForRange(ts, StreamType, key, useLock)
+	if err != nil {
+		return keyInfo, meta, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return keyInfo, meta, nil
+	}
+	meta, err = decodeStreamMeta(keyInfo.MetaData())
+	return keyInfo, meta, err
+}
+
+// XGetVer return the modify timestamp of the stream, the consumer group changes will not
+// change the version.
+func (db *RockDB) XGetVer(key []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	oldh, _, err := db.collHeaderMeta(time.Now().UnixNano(), StreamType, key, true)
+	if err != nil {
+		return 0, err
+	}
+	if len(oldh.UserData) == 0 {
+		return 0, nil
+	}
+	if len(oldh.UserData) < streamMetaLen {
+		return 0, errStreamValue
+	}
+	return int64(binary.BigEndian.Uint64(oldh.UserData[8+streamIDLen:])), nil
+}
+
+func (db *RockDB) xGetGroupLastID(table []byte, verKey []byte, group []byte, useLock bool) (StreamID, bool, error) {
+	var v []byte
+	var err error
+	gk := xEncodeGroupKey(table, verKey, group)
+	if useLock {
+		v, err = db.GetBytes(gk)
+	} else {
+		v, err = db.GetBytesNoLock(gk)
+	}
+	if err != nil || v == nil {
+		return StreamID{}, false, err
+	}
+	id, err := decodeStreamID(v)
+	return id, true, err
+}
+
+func (db *RockDB) xPutGroupLastID(table []byte, verKey []byte, group []byte, id StreamID, wb engine.WriteBatch) {
+	buf := make([]byte, streamIDLen)
+	id.encodeTo(buf)
+	wb.Put(xEncodeGroupKey(table, verKey, group), buf)
+}
+
+func (db *RockDB) xNewID(ts int64, meta streamMeta, id []byte) (StreamID, error) {
+	if len(id) == 1 && id[0] == '*' {
+		newID := StreamID{Ms: uint64(ts / int64(time.Millisecond))}
+		if !meta.lastID.Less(newID) {
+			var ok bool
+			newID, ok = meta.lastID.Next()
+			if !ok {
+				return newID, ErrStreamIDTooSmall
+			}
+		}
+		return newID, nil
+	}
+	var newID StreamID
+	var err error
+	if bytes.HasSuffix(id, []byte("-*")) {
+		newID, err = ParseStreamID(id[:len(id)-2], 0)
+		if err != nil {
+			return newID, err
+		}
+		if newID.Ms == meta.lastID.Ms {
+			if meta.lastID.Seq == math.MaxUint64 {
+				return newID, ErrStreamIDTooSmall
+			}
+			newID.Seq = meta.lastID.Seq + 1
+		}
+	} else {
+		newID, err = ParseStreamID(id, 0)
+		if err != nil {
+			return newID, err
+		}
+	}
+	if newID == MinStreamID {
+		return newID, ErrStreamIDZero
+	}
+	if !meta.lastID.Less(newID) {
+		return newID, ErrStreamIDTooSmall
+	}
+	return newID, nil
+}
+
+// delete the entries from the oldest until the length is no more than maxLen
+// or the id is not less than the minID
+func (db *RockDB) xTrimEntries(keyInfo collVerKeyInfo, meta *streamMeta, maxLen int64,
+	minID StreamID, wb engine.WriteBatch) (int64, error) {
+	start := xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, MinStreamID)
+	stop := xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, MaxStreamID)
+	it, err := db.NewDBRangeIterator(start, stop, common.RangeClose, false)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var num int64
+	for ; it.Valid(); it.Next() {
+		if maxLen >= 0 && meta.length-num <= maxLen {
+			break
+		}
+		id, err := xDecodeEntryKey(it.RefKey())
+		if err != nil {
+			return 0, err
+		}
+		if maxLen < 0 && !id.Less(minID) {
+			break
+		}
+		wb.Delete(it.Key())
+		num++
+	}
+	meta.length -= num
+	return num, nil
+}
+
+// XAdd append the entry to the stream and return the id of the new entry, the id will be generated
+// from the ts if the given id is '*'. The oldest entries will be trimmed if maxLen is not negative.
+func (db *RockDB) XAdd(ts int64, key []byte, id []byte, maxLen int64, fvs ...[]byte) ([]byte, error) {
+	if len(fvs) == 0 || len(fvs)%2 != 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	if len(fvs) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	for _, v := range fvs {
+		if len(v) > MaxValueSize {
+			return nil, errValueSize
+		}
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+
+	keyInfo, err := db.prepareCollKeyForWrite(ts, StreamType, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the expired key is still counted in the table
+	isNew := keyInfo.MetaData() == nil && !keyInfo.Expired
+	var meta streamMeta
+	if !keyInfo.IsNotExistOrExpired() {
+		meta, err = decodeStreamMeta(keyInfo.MetaData())
+		if err != nil {
+			return nil, err
+		}
+	}
+	newID, err := db.xNewID(ts, meta, id)
+	if err != nil {
+		return nil, err
+	}
+	table := keyInfo.Table
+	ek := xEncodeEntryKey(table, keyInfo.VerKey, newID)
+	wb.Put(ek, encodeStreamFields(fvs))
+	oldLen := meta.length
+	meta.length++
+	meta.lastID = newID
+	if maxLen >= 0 && meta.length > maxLen {
+		if _, err := db.xTrimEntries(keyInfo, &meta, maxLen, MinStreamID, wb); err != nil {
+			return nil, err
+		}
+		if meta.length > maxLen {
+			// all the old entries are trimmed, and the new entry should also be trimmed
+			wb.Delete(ek)
+			meta.length = 0
+		}
+	}
+	db.xPutMeta(ts, key, keyInfo.OldHeader, meta, wb)
+	if isNew {
+		db.IncrTableKeyCount(table, 1, wb)
+	}
+	if meta.length != oldLen {
+		db.topLargeCollKeys.Update(key, int(meta.length))
+		slow.LogLargeCollection(int(meta.length), slow.NewSlowLogInfo(string(table), string(key), "stream"))
+		if meta.length > collectionLengthForMetric {
+			metric.CollectionLenDist.With(ps.Labels{
+				"table": string(table),
+			}).Observe(float64(meta.length))
+		}
+	}
+	err = db.MaybeCommitBatch()
+	return []byte(newID.String()), err
+}
+
+func (db *RockDB) XLen(key []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	_, meta, err := db.xGetMeta(time.Now().UnixNano(), key, true)
+	return meta.length, err
+}
+
+func (db *RockDB) xRange(keyInfo collVerKeyInfo, start StreamID, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	entries := make([]StreamEntry, 0, count)
+	if end.Less(start) {
+		return entries, nil
+	}
+	min := xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, start)
+	max := xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, end)
+	it, err := db.NewDBRangeLimitIterator(min, max, common.RangeClose, 0, count, reverse)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		id, err := xDecodeEntryKey(it.RefKey())
+		if err != nil {
+			return nil, err
+		}
+		fvs, err := decodeStreamFields(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, StreamEntry{ID: id, Fields: fvs})
+	}
+	return entries, nil
+}
+
+// XRange return the entries between start and end (both inclusive), all the entries in
+// the range will be returned if count is not positive.
+func (db *RockDB) XRange(key []byte, start StreamID, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	keyInfo, meta, err := db.xGetMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() || meta.length == 0 {
+		return []StreamEntry{}, nil
+	}
+	if count <= 0 || int64(count) > meta.length {
+		count = int(meta.length)
+	}
+	if count > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	return db.xRange(keyInfo, start, end, count, reverse)
+}
+
+func (db *RockDB) XDel(ts int64, key []byte, ids ...StreamID) (int64, error) {
+	if len(ids) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, meta, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return 0, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return 0, nil
+	}
+	var num int64
+	deleted := make(map[StreamID]bool, len(ids))
+	for _, id := range ids {
+		if deleted[id] {
+			continue
+		}
+		ek := xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, id)
+		if vok, err := db.ExistNoLock(ek); err != nil {
+			return 0, err
+		} else if vok {
+			num++
+			deleted[id] = true
+			wb.Delete(ek)
+		}
+	}
+	if num == 0 {
+		return 0, nil
+	}
+	// the empty stream is kept, the same as redis
+	meta.length -= num
+	db.xPutMeta(ts, key, keyInfo.OldHeader, meta, wb)
+	db.topLargeCollKeys.Update(key, int(meta.length))
+	err = db.MaybeCommitBatch()
+	return num, err
+}
+
+// XTrim delete the oldest entries until the length is no more than maxLen if maxLen is not negative,
+// otherwise delete the entries with id less than minID.
+func (db *RockDB) XTrim(ts int64, key []byte, maxLen int64, minID StreamID) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, meta, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return 0, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return 0, nil
+	}
+	num, err := db.xTrimEntries(keyInfo, &meta, maxLen, minID, wb)
+	if err != nil || num == 0 {
+		return 0, err
+	}
+	db.xPutMeta(ts, key, keyInfo.OldHeader, meta, wb)
+	db.topLargeCollKeys.Update(key, int(meta.length))
+	err = db.MaybeCommitBatch()
+	return num, err
+}
+
+// XGroupCreate create the consumer group with the last delivered id, the last entry id will
+// be used if lastEntry is true. The empty stream will be created if mkStream is true.
+func (db *RockDB) XGroupCreate(ts int64, key []byte, group []byte, id StreamID, lastEntry bool, mkStream bool) error {
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, err := db.prepareCollKeyForWrite(ts, StreamType, key, group)
+	if err != nil {
+		return err
+	}
+	var meta streamMeta
+	if keyInfo.IsNotExistOrExpired() {
+		if !mkStream {
+			return ErrStreamNotExist
+		}
+		if keyInfo.MetaData() == nil && !keyInfo.Expired {
+			db.IncrTableKeyCount(keyInfo.Table, 1, wb)
+		}
+		db.xPutMeta(ts, key, keyInfo.OldHeader, meta, wb)
+	} else {
+		meta, err = decodeStreamMeta(keyInfo.MetaData())
+		if err != nil {
+			return err
+		}
+		_, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, false)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return ErrStreamGroupExist
+		}
+	}
+	if lastEntry {
+		id = meta.lastID
+	}
+	db.xPutGroupLastID(keyInfo.Table, keyInfo.VerKey, group, id, wb)
+	return db.MaybeCommitBatch()
+}
+
+func (db *RockDB) XGroupSetID(ts int64, key []byte, group []byte, id StreamID, lastEntry bool) error {
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, meta, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return ErrStreamNoGroup
+	}
+	_, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, false)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return ErrStreamNoGroup
+	}
+	if lastEntry {
+		id = meta.lastID
+	}
+	db.xPutGroupLastID(keyInfo.Table, keyInfo.VerKey, group, id, wb)
+	return db.MaybeCommitBatch()
+}
+
+// XGroupDestroy delete the consumer group and all the pending entries of the group
+func (db *RockDB) XGroupDestroy(ts int64, key []byte, group []byte) (int64, error) {
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, _, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return 0, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return 0, nil
+	}
+	_, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, false)
+	if err != nil || !exist {
+		return 0, err
+	}
+	wb.Delete(xEncodeGroupKey(keyInfo.Table, keyInfo.VerKey, group))
+	start := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, MinStreamID)
+	stop := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, MaxStreamID)
+	it, err := db.NewDBRangeIterator(start, stop, common.RangeClose, false)
+	if err != nil {
+		return 0, err
+	}
+	for ; it.Valid(); it.Next() {
+		wb.Delete(it.Key())
+	}
+	it.Close()
+	return 1, db.MaybeCommitBatch()
+}
+
+// iterate the pending entries of the group between start and end, the iteration is
+// stopped if the callback return false.
+func (db *RockDB) xIterPendings(keyInfo collVerKeyInfo, group []byte, start StreamID, end StreamID,
+	fn func(p StreamPending) bool) error {
+	if end.Less(start) {
+		return nil
+	}
+	min := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, start)
+	max := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, end)
+	it, err := db.NewDBRangeIterator(min, max, common.RangeClose, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		id, err := xDecodePendingKey(it.RefKey())
+		if err != nil {
+			return err
+		}
+		p, err := decodeStreamPending(id, it.Value())
+		if err != nil {
+			return err
+		}
+		if !fn(p) {
+			break
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) xGetPendings(keyInfo collVerKeyInfo, group []byte, start StreamID, end StreamID,
+	count int, consumer []byte) ([]StreamPending, error) {
+	pendings := make([]StreamPending, 0)
+	err := db.xIterPendings(keyInfo, group, start, end, func(p StreamPending) bool {
+		if consumer != nil && !bytes.Equal(consumer, p.Consumer) {
+			return true
+		}
+		pendings = append(pendings, p)
+		return count <= 0 || len(pendings) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pendings, nil
+}
+
+func (db *RockDB) xGetEntry(keyInfo collVerKeyInfo, id StreamID) (StreamEntry, error) {
+	entry := StreamEntry{ID: id}
+	v, err := db.GetBytesNoLock(xEncodeEntryKey(keyInfo.Table, keyInfo.VerKey, id))
+	if err != nil || v == nil {
+		return entry, err
+	}
+	entry.Fields, err = decodeStreamFields(v)
+	return entry, err
+}
+
+// XReadGroup read the entries for the consumer in the group. If the id is '>', the new entries
+// never delivered to other consumers will be returned and added to the pending list if noAck is
+// false, otherwise the pending entries of the consumer with id greater than the given id will
+// be returned. At most MAX_BATCH_NUM entries will be returned in one call.
+func (db *RockDB) XReadGroup(ts int64, key []byte, group []byte, consumer []byte, id []byte,
+	count int, noAck bool) ([]StreamEntry, error) {
+	if count <= 0 || count > MAX_BATCH_NUM {
+		count = MAX_BATCH_NUM
+	}
+	if err := checkCollKFSize(key, consumer); err != nil {
+		return nil, err
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, _, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return nil, ErrStreamNoGroup
+	}
+	lastID, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, false)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrStreamNoGroup
+	}
+	if len(id) != 1 || id[0] != '>' {
+		// read the pending history of the consumer
+		start, err := ParseStreamID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		start, ok := start.Next()
+		if !ok {
+			return []StreamEntry{}, nil
+		}
+		pendings, err := db.xGetPendings(keyInfo, group, start, MaxStreamID, count, consumer)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]StreamEntry, 0, len(pendings))
+		for _, p := range pendings {
+			entry, err := db.xGetEntry(keyInfo, p.ID)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+	start, ok := lastID.Next()
+	if !ok {
+		return []StreamEntry{}, nil
+	}
+	entries, err := db.xRange(keyInfo, start, MaxStreamID, count, false)
+	if err != nil || len(entries) == 0 {
+		return entries, err
+	}
+	if !noAck {
+		for _, e := range entries {
+			p := StreamPending{
+				Consumer:      consumer,
+				DeliveryTime:  ts / int64(time.Millisecond),
+				DeliveryCount: 1,
+			}
+			wb.Put(xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, e.ID), encodeStreamPending(p))
+		}
+	}
+	db.xPutGroupLastID(keyInfo.Table, keyInfo.VerKey, group, entries[len(entries)-1].ID, wb)
+	err = db.MaybeCommitBatch()
+	return entries, err
+}
+
+// XAck remove the entries from the pending list of the group
+func (db *RockDB) XAck(ts int64, key []byte, group []byte, ids ...StreamID) (int64, error) {
+	if len(ids) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, _, err := db.xGetMeta(ts, key, false)
+	if err != nil || keyInfo.IsNotExistOrExpired() {
+		return 0, err
+	}
+	var num int64
+	acked := make(map[StreamID]bool, len(ids))
+	for _, id := range ids {
+		if acked[id] {
+			continue
+		}
+		pk := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, id)
+		if vok, err := db.ExistNoLock(pk); err != nil {
+			return 0, err
+		} else if vok {
+			num++
+			acked[id] = true
+			wb.Delete(pk)
+		}
+	}
+	if num == 0 {
+		return 0, nil
+	}
+	err = db.MaybeCommitBatch()
+	return num, err
+}
+
+func (db *RockDB) xGetGroupForRead(key []byte, group []byte) (collVerKeyInfo, error) {
+	if err := checkKeySize(key); err != nil {
+		return collVerKeyInfo{}, err
+	}
+	keyInfo, _, err := db.xGetMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return keyInfo, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return keyInfo, ErrStreamNoGroup
+	}
+	_, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, true)
+	if err != nil {
+		return keyInfo, err
+	}
+	if !exist {
+		return keyInfo, ErrStreamNoGroup
+	}
+	return keyInfo, nil
+}
+
+// XPendingSummary return the pending count, the min and max id and the pending count of each
+// consumer in the group. The summary is counted while iterating, so it is not limited by the
+// pending number of the group.
+func (db *RockDB) XPendingSummary(key []byte, group []byte) (StreamPendingSummary, error) {
+	var summary StreamPendingSummary
+	keyInfo, err := db.xGetGroupForRead(key, group)
+	if err != nil {
+		return summary, err
+	}
+	counts := make(map[string]int64)
+	err = db.xIterPendings(keyInfo, group, MinStreamID, MaxStreamID, func(p StreamPending) bool {
+		if summary.Count == 0 {
+			summary.MinID = p.ID
+		}
+		summary.MaxID = p.ID
+		summary.Count++
+		counts[string(p.Consumer)]++
+		return true
+	})
+	if err != nil {
+		return summary, err
+	}
+	for c, n := range counts {
+		summary.Consumers = append(summary.Consumers, StreamConsumerPending{Consumer: []byte(c), Count: n})
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool {
+		return bytes.Compare(summary.Consumers[i].Consumer, summary.Consumers[j].Consumer) < 0
+	})
+	return summary, nil
+}
+
+// XPending return the pending entries of the group between start and end, only the pending
+// entries of the consumer will be returned if consumer is not nil.
+func (db *RockDB) XPending(key []byte, group []byte, start StreamID, end StreamID,
+	count int, consumer []byte) ([]StreamPending, error) {
+	if count <= 0 || count > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	keyInfo, err := db.xGetGroupForRead(key, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.xGetPendings(keyInfo, group, start, end, count, consumer)
+}
+
+// XClaim change the owner of the pending entries which are idle more than minIdle milliseconds
+// to the consumer. The delivery count will not be increased if justID is true. The pending entry
+// will be removed if the entry has been deleted from the stream.
+func (db *RockDB) XClaim(ts int64, key []byte, group []byte, consumer []byte, minIdle int64,
+	justID bool, ids ...StreamID) ([]StreamEntry, error) {
+	if len(ids) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	if err := checkCollKFSize(key, consumer); err != nil {
+		return nil, err
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	keyInfo, _, err := db.xGetMeta(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return nil, ErrStreamNoGroup
+	}
+	_, exist, err := db.xGetGroupLastID(keyInfo.Table, keyInfo.VerKey, group, false)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrStreamNoGroup
+	}
+	now := ts / int64(time.Millisecond)
+	entries := make([]StreamEntry, 0, len(ids))
+	claimed := make(map[StreamID]bool, len(ids))
+	for _, id := range ids {
+		if claimed[id] {
+			continue
+		}
+		pk := xEncodePendingKey(keyInfo.Table, keyInfo.VerKey, group, id)
+		v, err := db.GetBytesNoLock(pk)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		p, err := decodeStreamPending(id, v)
+		if err != nil {
+			return nil, err
+		}
+		if now-p.DeliveryTime < minIdle {
+			continue
+		}
+		entry, err := db.xGetEntry(keyInfo, id)
+		if err != nil {
+			return nil, err
+		}
+		claimed[id] = true
+		if entry.Fields == nil {
+			wb.Delete(pk)
+			continue
+		}
+		p.Consumer = consumer
+		p.DeliveryTime = now
+		if !justID {
+			p.DeliveryCount++
+		}
+		wb.Put(pk, encodeStreamPending(p))
+		entries = append(entries, entry)
+	}
+	if len(claimed) == 0 {
+		return entries, nil
+	}
+	err = db.MaybeCommitBatch()
+	return entries, err
+}
+
+func (db *RockDB) xDelete(ts int64, key []byte, wb engine.WriteBatch) (int64, error) {
+	keyInfo, err := db.getCollVerKeyForRange(ts, StreamType, key, false)
+	if err != nil {
+		return 0, err
+	}
+	// no need delete if expired
+	if keyInfo.IsNotExistOrExpired() {
+		return 0, nil
+	}
+	db.IncrTableKeyCount(keyInfo.Table, -1, wb)
+	wb.Delete(xEncodeMetaKey(key))
+
+	db.topLargeCollKeys.Update(key, int(0))
+	if db.isCompactTTLPolicy() {
+		// for compact ttl , we can just delete the meta
+		return 1, nil
+	}
+	// the groups and pending entries may be much more than the entries, so
+	// we always delete the whole stream by range
+	wb.DeleteRange(keyInfo.RangeStart, keyInfo.RangeEnd)
+
+	_, err = db.delExpire(StreamType, key, nil, false, wb)
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (db *RockDB) XClear(ts int64, key []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	num, err := db.xDelete(ts, key, db.wb)
+	if err != nil {
+		return 0, err
+	}
+	err = db.MaybeCommitBatch()
+	return num, err
+}
+
+func (db *RockDB) XMclear(keys ...[]byte) (int64, error) {
+	if len(keys) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	for _, key := range keys {
+		if err := checkKeySize(key); err != nil {
+			return 0, err
+		}
+		if _, err := db.xDelete(0, key, wb); err != nil {
+			return 0, err
+		}
+	}
+	err := db.MaybeCommitBatch()
+	return int64(len(keys)), err
+}
+
+func (db *RockDB) xMclearWithBatch(wb engine.WriteBatch, keys ...[]byte) error {
+	if len(keys) > MAX_BATCH_NUM {
+		return errTooMuchBatchSize
+	}
+	for _, key := range keys {
+		if err := checkKeySize(key); err != nil {
+			return err
+		}
+		if _, err := db.xDelete(0, key, wb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) XKeyExists(key []byte) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+	return db.collKeyExists(StreamType, key)
+}
+
+func (db *RockDB) XExpire(ts int64, key []byte, duration int64) (int64, error) {
+	return db.collExpire(ts, StreamType, key, duration)
+}
+
+func (db *RockDB) XPersist(ts int64, key []byte) (int64, error) {
+	return db.collPersist(ts, StreamType, key)
+}
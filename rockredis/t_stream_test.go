@@ -0,0 +1,288 @@
+package rockredis
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamCodec(t *testing.T) {
+	key := []byte("test:key")
+	ek := xEncodeMetaKey(key)
+	k, err := xDecodeMetaKey(ek)
+	assert.Nil(t, err)
+	assert.Equal(t, key, k)
+
+	id := StreamID{Ms: 1000, Seq: 2}
+	ek = xEncodeEntryKey([]byte("test"), []byte("key"), id)
+	did, err := xDecodeEntryKey(ek)
+	assert.Nil(t, err)
+	assert.Equal(t, id, did)
+	// the entry keys should be ordered by the id
+	ek2 := xEncodeEntryKey([]byte("test"), []byte("key"), StreamID{Ms: 1001})
+	assert.True(t, string(ek) < string(ek2))
+
+	pk := xEncodePendingKey([]byte("test"), []byte("key"), []byte("group"), id)
+	did, err = xDecodePendingKey(pk)
+	assert.Nil(t, err)
+	assert.Equal(t, id, did)
+
+	fvs := [][]byte{[]byte("f1"), []byte(""), []byte("f2"), []byte("v2")}
+	dfvs, err := decodeStreamFields(encodeStreamFields(fvs))
+	assert.Nil(t, err)
+	assert.Equal(t, fvs, dfvs)
+
+	pid, err := ParseStreamID([]byte("123"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, StreamID{Ms: 123, Seq: 5}, pid)
+	pid, err = ParseStreamID([]byte("123-4"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, StreamID{Ms: 123, Seq: 4}, pid)
+	_, err = ParseStreamID([]byte("123-a"), 0)
+	assert.Equal(t, ErrStreamIDInvalid, err)
+}
+
+func TestDBStream(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_stream_a")
+	tn := time.Now().UnixNano()
+	id1, err := db.XAdd(tn, key, []byte("*"), -1, []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	// the auto id should be increased even the time is the same
+	id2, err := db.XAdd(tn, key, []byte("*"), -1, []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	pid1, _ := ParseStreamID(id1, 0)
+	pid2, _ := ParseStreamID(id2, 0)
+	assert.True(t, pid1.Less(pid2))
+	assert.Equal(t, pid1.Ms, pid2.Ms)
+
+	_, err = db.XAdd(tn, key, id2, -1, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+	_, err = db.XAdd(tn, key, []byte("*"), -1, []byte("f"))
+	assert.NotNil(t, err)
+	id3, err := db.XAdd(tn, key, []byte(strconv.FormatUint(pid2.Ms, 10)+"-*"), -1, []byte("f3"), []byte("v3"))
+	assert.Nil(t, err)
+	pid3, _ := ParseStreamID(id3, 0)
+	assert.Equal(t, pid2.Seq+1, pid3.Seq)
+
+	n, err := db.XLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	entries, err := db.XRange(key, MinStreamID, MaxStreamID, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, pid1, entries[0].ID)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("v1")}, entries[0].Fields)
+	assert.Equal(t, pid3, entries[2].ID)
+	entries, err = db.XRange(key, MinStreamID, MaxStreamID, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, pid3, entries[0].ID)
+	assert.Equal(t, pid2, entries[1].ID)
+	entries, err = db.XRange(key, pid2, pid2, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	n, err = db.XDel(tn, key, pid2, pid2, StreamID{Ms: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.XLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// add with maxlen
+	_, err = db.XAdd(tn, key, []byte("*"), 2, []byte("f4"), []byte("v4"))
+	assert.Nil(t, err)
+	entries, err = db.XRange(key, MinStreamID, MaxStreamID, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, pid3, entries[0].ID)
+
+	n, err = db.XTrim(tn, key, 1, MinStreamID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.XTrim(tn, key, -1, MaxStreamID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	// the empty stream should be kept
+	n, err = db.XLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.XKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = db.XClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.XKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	// the small id is allowed after the stream is cleared
+	_, err = db.XAdd(tn, key, []byte("1-1"), -1, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+}
+
+func TestDBStreamGroup(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_stream_group")
+	group := []byte("g1")
+	tn := time.Now().UnixNano()
+	err := db.XGroupCreate(tn, key, group, MinStreamID, false, false)
+	assert.Equal(t, ErrStreamNotExist, err)
+	err = db.XGroupCreate(tn, key, group, MinStreamID, false, true)
+	assert.Nil(t, err)
+	err = db.XGroupCreate(tn, key, group, MinStreamID, false, true)
+	assert.Equal(t, ErrStreamGroupExist, err)
+
+	for i := 1; i <= 3; i++ {
+		_, err := db.XAdd(tn, key, []byte("*"), -1, []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+	entries, err := db.XReadGroup(tn, key, group, []byte("c1"), []byte(">"), 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	entries2, err := db.XReadGroup(tn, key, group, []byte("c2"), []byte(">"), 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries2))
+	entries3, err := db.XReadGroup(tn, key, group, []byte("c2"), []byte(">"), 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries3))
+	_, err = db.XReadGroup(tn, key, []byte("nogroup"), []byte("c2"), []byte(">"), 0, false)
+	assert.Equal(t, ErrStreamNoGroup, err)
+
+	// read the pending history
+	history, err := db.XReadGroup(tn, key, group, []byte("c1"), []byte("0"), 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, entries, history)
+
+	summary, err := db.XPendingSummary(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), summary.Count)
+	assert.Equal(t, entries[0].ID, summary.MinID)
+	assert.Equal(t, entries2[0].ID, summary.MaxID)
+	assert.Equal(t, 2, len(summary.Consumers))
+	assert.Equal(t, []byte("c1"), summary.Consumers[0].Consumer)
+	assert.Equal(t, int64(2), summary.Consumers[0].Count)
+
+	pendings, err := db.XPending(key, group, MinStreamID, MaxStreamID, 10, []byte("c2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, entries2[0].ID, pendings[0].ID)
+	assert.Equal(t, int64(1), pendings[0].DeliveryCount)
+
+	// claim should check the idle time
+	claimed, err := db.XClaim(tn, key, group, []byte("c2"), 1000, false, entries[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(claimed))
+	claimed, err = db.XClaim(tn+int64(time.Second*2), key, group, []byte("c2"), 1000, false, entries[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(claimed))
+	pendings, err = db.XPending(key, group, MinStreamID, MaxStreamID, 10, []byte("c2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pendings))
+	assert.Equal(t, int64(2), pendings[0].DeliveryCount)
+
+	n, err := db.XAck(tn, key, group, entries[0].ID, entries[1].ID, entries[1].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	summary, err = db.XPendingSummary(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), summary.Count)
+
+	err = db.XGroupSetID(tn, key, group, MinStreamID, false)
+	assert.Nil(t, err)
+	entries, err = db.XReadGroup(tn, key, group, []byte("c3"), []byte(">"), 0, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	// no ack read should not change the pending list
+	summary, err = db.XPendingSummary(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), summary.Count)
+
+	n, err = db.XGroupDestroy(tn, key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = db.XPendingSummary(key, group)
+	assert.Equal(t, ErrStreamNoGroup, err)
+}
+
+func TestDBStreamPendingSummaryLarge(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_stream_pending_large")
+	group := []byte("g1")
+	tn := time.Now().UnixNano()
+	err := db.XGroupCreate(tn, key, group, MinStreamID, false, true)
+	assert.Nil(t, err)
+	total := MAX_BATCH_NUM + 10
+	for i := 0; i < total; i++ {
+		_, err := db.XAdd(tn, key, []byte("*"), -1, []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+	entries, err := db.XReadGroup(tn, key, group, []byte("c1"), []byte(">"), 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, MAX_BATCH_NUM, len(entries))
+	entries2, err := db.XReadGroup(tn, key, group, []byte("c2"), []byte(">"), 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(entries2))
+
+	// the summary should not be limited by the batch size
+	summary, err := db.XPendingSummary(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(total), summary.Count)
+	assert.Equal(t, entries[0].ID, summary.MinID)
+	assert.Equal(t, entries2[len(entries2)-1].ID, summary.MaxID)
+	assert.Equal(t, []StreamConsumerPending{
+		{Consumer: []byte("c1"), Count: int64(MAX_BATCH_NUM)},
+		{Consumer: []byte("c2"), Count: 10},
+	}, summary.Consumers)
+}
+
+func TestDBStreamWithCompactTTL(t *testing.T) {
+	db := getTestDBWithCompactTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_stream_ttl")
+	tn := time.Now().UnixNano()
+	_, err := db.XAdd(tn, key, []byte("*"), -1, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	n, err := db.XExpire(tn, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	ttl, err := db.StreamTtl(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl >= 0 && ttl <= 1)
+
+	time.Sleep(time.Second * 2)
+	n, err = db.XLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.XKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// the new stream after expired should not see the old entries
+	_, err = db.XAdd(time.Now().UnixNano(), key, []byte("*"), -1, []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	entries, err := db.XRange(key, MinStreamID, MaxStreamID, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, []byte("f2"), entries[0].Fields[0])
+	ttl, err = db.StreamTtl(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+}
@@ -246,9 +246,17 @@ func encodeTableIndexMetaStopKey(itype byte) []byte {
 }
 
 func (db *RockDB) GetHsetIndexTables() [][]byte {
+	return db.getIndexTables(hsetIndexMeta)
+}
+
+func (db *RockDB) GetJSONIndexTables() [][]byte {
+	return db.getIndexTables(jsonIndexMeta)
+}
+
+func (db *RockDB) getIndexTables(itype byte) [][]byte {
 	ch := make([][]byte, 0, 100)
-	s := encodeTableIndexMetaStartKey(hsetIndexMeta)
-	e := encodeTableIndexMetaStopKey(hsetIndexMeta)
+	s := encodeTableIndexMetaStartKey(itype)
+	e := encodeTableIndexMetaStopKey(itype)
 	it, err := db.NewDBRangeIterator(s, e, common.RangeOpen, false)
 	if err != nil {
 		return nil
@@ -281,3 +289,18 @@ func (db *RockDB) SetTableHsetIndexValue(table []byte, value []byte) error {
 	wb.Put(key, value)
 	return db.rockEng.Write(wb)
 }
+
+func (db *RockDB) GetTableJSONIndexValue(table []byte) ([]byte, error) {
+	key := encodeTableIndexMetaKey(table, jsonIndexMeta)
+	return db.GetBytes(key)
+}
+
+func (db *RockDB) SetTableJSONIndexValue(table []byte, value []byte) error {
+	// this may not run in raft loop
+	// so we should use new db write batch here
+	key := encodeTableIndexMetaKey(table, jsonIndexMeta)
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(key, value)
+	return db.rockEng.Write(wb)
+}
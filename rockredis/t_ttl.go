@@ -185,6 +185,15 @@ func (db *RockDB) ZSetTtl(key []byte) (t int64, err error) {
 	return db.ttl(tn, ZSetType, key, v)
 }
 
+func (db *RockDB) StreamTtl(key []byte) (t int64, err error) {
+	tn := time.Now().UnixNano()
+	v, err := db.expiration.getRawValueForHeader(tn, StreamType, key)
+	if err != nil {
+		return -1, err
+	}
+	return db.ttl(tn, StreamType, key, v)
+}
+
 type TTLChecker struct {
 	sync.Mutex
 
@@ -154,7 +154,7 @@ func decodeVerKey(b []byte) ([]byte, int64, error) {
 
 func (exp *compactExpiration) encodeToVersionKey(dt byte, h *headerMetaValue, key []byte) []byte {
 	switch dt {
-	case HashType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		return encodeVerKey(h, key)
 	default:
 		return exp.localExp.encodeToVersionKey(dt, h, key)
@@ -163,7 +163,7 @@ func (exp *compactExpiration) encodeToVersionKey(dt byte, h *headerMetaValue, ke
 
 func (exp *compactExpiration) decodeFromVersionKey(dt byte, key []byte) ([]byte, int64, error) {
 	switch dt {
-	case HashType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		return decodeVerKey(key)
 	default:
 		return exp.localExp.decodeFromVersionKey(dt, key)
@@ -172,7 +172,7 @@ func (exp *compactExpiration) decodeFromVersionKey(dt byte, key []byte) ([]byte,
 
 func (exp *compactExpiration) encodeToRawValue(dataType byte, h *headerMetaValue) []byte {
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		if h == nil {
 			h = newHeaderMetaV1()
 		}
@@ -186,7 +186,7 @@ func (exp *compactExpiration) encodeToRawValue(dataType byte, h *headerMetaValue
 func (exp *compactExpiration) decodeRawValue(dataType byte, rawValue []byte) (*headerMetaValue, error) {
 	h := newHeaderMetaV1()
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		if rawValue == nil {
 			return h, nil
 		}
@@ -211,7 +211,7 @@ func (exp *compactExpiration) getRawValueForHeader(ts int64, dataType byte, key
 			return nil, nil
 		}
 		return v, nil
-	case HashType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		metaKey, _ := encodeMetaKey(dataType, key)
 		return exp.db.GetBytes(metaKey)
 	default:
@@ -221,7 +221,7 @@ func (exp *compactExpiration) getRawValueForHeader(ts int64, dataType byte, key
 
 func (exp *compactExpiration) isExpired(ts int64, dataType byte, key []byte, rawValue []byte, useLock bool) (bool, error) {
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		if rawValue == nil {
 			return false, nil
 		}
@@ -238,9 +238,9 @@ func (exp *compactExpiration) isExpired(ts int64, dataType byte, key []byte, raw
 
 func (exp *compactExpiration) ExpireAt(dataType byte, key []byte, rawValue []byte, when int64) (int64, error) {
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		wb := exp.db.wb
-		defer wb.Clear()
+		defer exp.db.MaybeClearBatch()
 		if rawValue == nil {
 			// key not exist
 			return 0, nil
@@ -254,7 +254,7 @@ func (exp *compactExpiration) ExpireAt(dataType byte, key []byte, rawValue []byt
 			return 0, err
 		}
 		wb.Put(key, newValue)
-		if err := exp.db.rockEng.Write(wb); err != nil {
+		if err := exp.db.MaybeCommitBatch(); err != nil {
 			return 0, err
 		}
 		return 1, nil
@@ -265,7 +265,7 @@ func (exp *compactExpiration) ExpireAt(dataType byte, key []byte, rawValue []byt
 
 func (exp *compactExpiration) rawExpireAt(dataType byte, key []byte, rawValue []byte, when int64, wb engine.WriteBatch) ([]byte, error) {
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		h := newHeaderMetaV1()
 		if when >= int64(math.MaxUint32-1) {
 			return nil, errExpOverflow
@@ -284,7 +284,7 @@ func (exp *compactExpiration) rawExpireAt(dataType byte, key []byte, rawValue []
 
 func (exp *compactExpiration) ttl(ts int64, dataType byte, key []byte, rawValue []byte) (int64, error) {
 	switch dataType {
-	case KVType, HashType, SetType, BitmapType, ListType, ZSetType:
+	case KVType, HashType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		if rawValue == nil {
 			return -1, nil
 		}
@@ -304,7 +304,7 @@ func (exp *compactExpiration) renewOnExpired(ts int64, dataType byte, key []byte
 		return
 	}
 	switch dataType {
-	case KVType, HashType, SetType, BitmapType, ListType, ZSetType:
+	case KVType, HashType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		oldh.ExpireAt = 0
 		oldh.UserData = nil
 		oldh.ValueVersion = ts
@@ -328,7 +328,7 @@ func (exp *compactExpiration) Stop() {
 
 func (exp *compactExpiration) delExpire(dataType byte, key []byte, rawValue []byte, keepValue bool, wb engine.WriteBatch) ([]byte, error) {
 	switch dataType {
-	case HashType, KVType, SetType, BitmapType, ListType, ZSetType:
+	case HashType, KVType, SetType, BitmapType, ListType, ZSetType, StreamType:
 		if !keepValue {
 			return rawValue, nil
 		}
@@ -73,12 +73,12 @@ func (exp *localExpiration) ExpireAt(dataType byte, key []byte, rawValue []byte,
 		return 0, errChangeTTLNotSupported
 	}
 	wb := exp.db.wb
-	defer wb.Clear()
+	defer exp.db.MaybeClearBatch()
 	_, err := exp.rawExpireAt(dataType, key, rawValue, when, wb)
 	if err != nil {
 		return 0, err
 	}
-	if err := exp.db.rockEng.Write(wb); err != nil {
+	if err := exp.db.MaybeCommitBatch(); err != nil {
 		return 0, err
 	}
 	return 1, nil
@@ -177,7 +177,7 @@ func newLocalBatchedBuffer(db *RockDB, cap int) *localBatchedBuffer {
 	}
 
 	types := []common.DataType{common.KV, common.LIST, common.HASH,
-		common.SET, common.ZSET}
+		common.SET, common.ZSET, common.STREAM}
 
 	for _, t := range types {
 		batchedBuff.batched[t] = newLocalBatch(db, t)
@@ -313,6 +313,14 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb engine.WriteBatch) fu
 			}
 			return db.rockEng.Write(wb)
 		}
+	case common.STREAM:
+		return func(keys [][]byte) error {
+			defer wb.Clear()
+			if err := db.xMclearWithBatch(wb, keys...); err != nil {
+				return err
+			}
+			return db.rockEng.Write(wb)
+		}
 	default:
 		// TODO: currently bitmap/json is not handled
 		return nil
@@ -324,6 +332,7 @@ type localBatch struct {
 	dt         common.DataType
 	wb         engine.WriteBatch
 	localDelFn func([][]byte) error
+	notifyFn   func([][]byte)
 }
 
 func newLocalBatch(db *RockDB, dt common.DataType) *localBatch {
@@ -333,6 +342,7 @@ func newLocalBatch(db *RockDB, dt common.DataType) *localBatch {
 		keys: make([][]byte, 0, localBatchedMaxKeysNum),
 	}
 	batch.localDelFn = createLocalDelFunc(dt, db, batch.wb)
+	batch.notifyFn = db.cfg.ExpiredNotifier
 	return batch
 }
 
@@ -354,6 +364,9 @@ func (batch *localBatch) commit() error {
 		return nil
 	}
 	err := batch.localDelFn(batch.keys)
+	if err == nil && batch.notifyFn != nil {
+		batch.notifyFn(batch.keys)
+	}
 	batch.keys = batch.keys[:0]
 	return err
 }
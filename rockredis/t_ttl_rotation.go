@@ -0,0 +1,290 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+var errRotationKey = errors.New("invalid rotation key")
+var errRotationCollectionTTL = errors.New("ERR the ttl of the collection is not supported under the periodical_rotation expiration policy")
+
+// the default time range of each rotation bucket in seconds
+const defaultRotationPeriodSecs int64 = 3600
+
+var rotationCheckInterval = time.Minute
+
+/*
+the coded format of the rotated kv key:
+bytes:  -0-|-1-2-3-4-5-6-7-8-|-9----------x-|
+data :  103|     bucket      |   kv db key  |
+*/
+func encodeRotationKey(bucket int64, dbKey []byte) []byte {
+	buf := make([]byte, 1+8+len(dbKey))
+	buf[0] = ExpRotationType
+	binary.BigEndian.PutUint64(buf[1:], uint64(bucket))
+	copy(buf[1+8:], dbKey)
+	return buf
+}
+
+func decodeRotationKey(rk []byte) (int64, []byte, error) {
+	if len(rk) < 1+8 || rk[0] != ExpRotationType {
+		return 0, nil, errRotationKey
+	}
+	return int64(binary.BigEndian.Uint64(rk[1:])), rk[1+8:], nil
+}
+
+// the time range of each rotation bucket in seconds, it should not be changed after the
+// namespace created since the bucket of the stored value is computed by it.
+func (db *RockDB) rotationPeriod() int64 {
+	if db.cfg.ExpirationRotationPeriod > 0 {
+		return db.cfg.ExpirationRotationPeriod
+	}
+	return defaultRotationPeriodSecs
+}
+
+func (db *RockDB) rotationBucket(expireAt int64) int64 {
+	return expireAt / db.rotationPeriod()
+}
+
+// rotationExpiration store the ttl in the value header the same as the compact policy, and
+// the kv value with ttl is moved to the bucket decided by the expire time. Only the header
+// is kept in the kv key to find the bucket. So we can drop the whole bucket after all the
+// keys in it expired, and the left headers will be cleaned while compacting.
+// The collections can not be rotated by buckets, so the ttl on them is refused, otherwise
+// the expired collections would only be cleaned by compacting without any notice.
+type rotationExpiration struct {
+	*compactExpiration
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	running int32
+	// all the buckets before it have been dropped
+	droppedBucket int64
+}
+
+func newRotationExpiration(db *RockDB) *rotationExpiration {
+	return &rotationExpiration{
+		compactExpiration: newCompactExpiration(db),
+	}
+}
+
+func (exp *rotationExpiration) ExpireAt(dataType byte, key []byte, rawValue []byte, when int64) (int64, error) {
+	if dataType != KVType {
+		if when != 0 {
+			return 0, errRotationCollectionTTL
+		}
+		return exp.compactExpiration.ExpireAt(dataType, key, rawValue, when)
+	}
+	wb := exp.db.wb
+	defer exp.db.MaybeClearBatch()
+	if rawValue == nil {
+		// key not exist
+		return 0, nil
+	}
+	newValue, err := exp.rawExpireAt(dataType, key, rawValue, when, wb)
+	if err != nil {
+		return 0, err
+	}
+	dbKey, err := encodeMetaKey(dataType, key)
+	if err != nil {
+		return 0, err
+	}
+	// the value may be moved to another bucket
+	if err := exp.db.putKVValue(dbKey, newValue, wb); err != nil {
+		return 0, err
+	}
+	if err := exp.db.MaybeCommitBatch(); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (exp *rotationExpiration) Start() {
+	exp.compactExpiration.Start()
+	if atomic.CompareAndSwapInt32(&exp.running, 0, 1) {
+		exp.stopCh = make(chan struct{})
+		exp.wg.Add(1)
+		go func() {
+			defer exp.wg.Done()
+			exp.applyRotation(exp.stopCh)
+		}()
+	}
+}
+
+func (exp *rotationExpiration) Stop() {
+	if atomic.CompareAndSwapInt32(&exp.running, 1, 0) {
+		close(exp.stopCh)
+		exp.wg.Wait()
+	}
+	exp.compactExpiration.Stop()
+}
+
+func (exp *rotationExpiration) Destroy() {
+	exp.Stop()
+}
+
+func (exp *rotationExpiration) applyRotation(stop chan struct{}) {
+	dbLog.Infof("start to apply-expiration using Periodical-Rotation policy")
+	defer dbLog.Infof("apply-expiration using Periodical-Rotation policy exit")
+
+	t := time.NewTicker(rotationCheckInterval)
+	defer t.Stop()
+	for {
+		err := exp.dropExpiredBuckets()
+		if err != nil {
+			dbLog.Errorf("drop expired buckets failed: %v", err.Error())
+		}
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// drop all the buckets whose keys are all expired. We keep the expired buckets
+// for a while the same as the lazy compact clean, since the raft logs replayed
+// after restart may still read the expired data.
+func (exp *rotationExpiration) dropExpiredBuckets() error {
+	bucket := exp.db.rotationBucket(time.Now().Add(-1 * lazyCleanExpired).Unix())
+	if bucket <= atomic.LoadInt64(&exp.droppedBucket) {
+		return nil
+	}
+	start := encodeRotationKey(0, nil)
+	end := encodeRotationKey(bucket, nil)
+	// the whole sst files in the range can be removed directly, and the left
+	// data will be deleted by the range delete.
+	exp.db.rockEng.DeleteFilesInRange(engine.CRange{Start: start, Limit: end})
+	wb := exp.db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.DeleteRange(start, end)
+	if err := exp.db.rockEng.Write(wb); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&exp.droppedBucket, bucket)
+	dbLog.Infof("db %v dropped the rotation buckets before: %v", exp.db.GetDataDir(),
+		time.Unix(bucket*exp.db.rotationPeriod(), 0).Format(logTimeFormatStr))
+	return nil
+}
+
+// the ttl is stored in the value header and the expired data will be cleaned while compacting
+func (db *RockDB) isCompactTTLPolicy() bool {
+	return db.cfg.ExpirationPolicy == common.WaitCompact ||
+		db.cfg.ExpirationPolicy == common.PeriodicalRotation
+}
+
+func (db *RockDB) isRotationPolicy() bool {
+	return db.cfg.ExpirationPolicy == common.PeriodicalRotation
+}
+
+// return the bucket of the rotated kv value, -1 if the value is not rotated
+func (db *RockDB) getKVRotationBucket(v []byte) int64 {
+	if len(v) < headerV1Len {
+		return -1
+	}
+	var h headerMetaValue
+	if _, err := h.decode(v); err != nil || h.ExpireAt == 0 {
+		return -1
+	}
+	return db.rotationBucket(int64(h.ExpireAt))
+}
+
+// read the rotated kv value if the value in kv key is only the header
+func (db *RockDB) getRotatedKVValue(dbKey []byte, v []byte, useLock bool) ([]byte, error) {
+	if !db.isRotationPolicy() {
+		return v, nil
+	}
+	bucket := db.getKVRotationBucket(v)
+	if bucket < 0 {
+		return v, nil
+	}
+	var rv []byte
+	var err error
+	rk := encodeRotationKey(bucket, dbKey)
+	if useLock {
+		rv, err = db.GetBytes(rk)
+	} else {
+		rv, err = db.GetBytesNoLock(rk)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rv == nil {
+		// the bucket has been dropped, the header is enough to check the expired state
+		return v, nil
+	}
+	return rv, nil
+}
+
+// put the kv db value to the write batch, under the rotation policy the value with ttl will be
+// put to the rotated bucket, and only the header and modify time is kept in the kv key.
+func (db *RockDB) putKVValue(dbKey []byte, value []byte, wb engine.WriteBatch) error {
+	if !db.isRotationPolicy() {
+		wb.Put(dbKey, value)
+		return nil
+	}
+	if len(value) < headerV1Len+tsLen {
+		return errHeaderMetaValue
+	}
+	oldBucket, err := db.getKVBucketForWrite(dbKey, wb)
+	if err != nil {
+		return err
+	}
+	newBucket := db.getKVRotationBucket(value)
+	if oldBucket >= 0 && oldBucket != newBucket {
+		wb.Delete(encodeRotationKey(oldBucket, dbKey))
+	}
+	db.setPendingKVBucket(dbKey, newBucket, wb)
+	if newBucket < 0 {
+		wb.Put(dbKey, value)
+		return nil
+	}
+	wb.Put(encodeRotationKey(newBucket, dbKey), value)
+	hv := make([]byte, 0, headerV1Len+tsLen)
+	hv = append(hv, value[:headerV1Len]...)
+	hv = append(hv, value[len(value)-tsLen:]...)
+	wb.Put(dbKey, hv)
+	return nil
+}
+
+// delete the kv db key and the rotated value
+func (db *RockDB) delKVValue(dbKey []byte, wb engine.WriteBatch) {
+	if db.isRotationPolicy() {
+		bucket, _ := db.getKVBucketForWrite(dbKey, wb)
+		if bucket >= 0 {
+			wb.Delete(encodeRotationKey(bucket, dbKey))
+		}
+		db.setPendingKVBucket(dbKey, -1, wb)
+	}
+	wb.Delete(dbKey)
+}
+
+// get the current bucket of the kv value, the value may be changed in the write batch
+// by the previous batched command and not committed to db yet.
+func (db *RockDB) getKVBucketForWrite(dbKey []byte, wb engine.WriteBatch) (int64, error) {
+	if wb == db.wb {
+		if bucket, ok := db.pendingKVBuckets[string(dbKey)]; ok {
+			return bucket, nil
+		}
+	}
+	oldV, err := db.GetBytesNoLock(dbKey)
+	if err != nil {
+		return -1, err
+	}
+	return db.getKVRotationBucket(oldV), nil
+}
+
+func (db *RockDB) setPendingKVBucket(dbKey []byte, bucket int64, wb engine.WriteBatch) {
+	if wb != db.wb {
+		return
+	}
+	if db.pendingKVBuckets == nil {
+		db.pendingKVBuckets = make(map[string]int64)
+	}
+	db.pendingKVBuckets[string(dbKey)] = bucket
+}
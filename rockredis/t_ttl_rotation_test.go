@@ -0,0 +1,331 @@
+package rockredis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func getTestDBWithRotationTTL(t *testing.T) *RockDB {
+	cfg := NewRockRedisDBConfig()
+	cfg.ExpirationPolicy = common.PeriodicalRotation
+	cfg.ExpirationRotationPeriod = 1
+	cfg.EnableTableCounter = true
+	cfg.DataVersion = common.ValueHeaderV1
+
+	var err error
+	cfg.DataDir, err = ioutil.TempDir("", fmt.Sprintf("rockredis-test-%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDB, err := OpenRockDB(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return testDB
+}
+
+func TestKVRotationTTL(t *testing.T) {
+	db := getTestDBWithRotationTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_rotation_kv1")
+	key2 := []byte("test:testdb_rotation_kv2")
+	key3 := []byte("test:testdb_rotation_kv3")
+	tn := time.Now().UnixNano()
+	err := db.KVSet(tn, key1, []byte("hello world 1"))
+	assert.Nil(t, err)
+	err = db.SetEx(tn, key2, 2, []byte("hello world 2"))
+	assert.Nil(t, err)
+	err = db.KVSet(tn, key3, []byte("hello world 3"))
+	assert.Nil(t, err)
+	n, err := db.Expire(tn, key3, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	getRotated := func(key []byte) []byte {
+		_, dbKey, err := convertRedisKeyToDBKVKey(key)
+		assert.Nil(t, err)
+		v, err := db.GetBytes(dbKey)
+		assert.Nil(t, err)
+		bucket := db.getKVRotationBucket(v)
+		if bucket < 0 {
+			return nil
+		}
+		// only the header and modify time should be kept in the kv key
+		assert.Equal(t, headerV1Len+tsLen, len(v))
+		rv, err := db.GetBytes(encodeRotationKey(bucket, dbKey))
+		assert.Nil(t, err)
+		return rv
+	}
+	assert.Nil(t, getRotated(key1))
+	assert.NotNil(t, getRotated(key2))
+	assert.NotNil(t, getRotated(key3))
+
+	v, err := db.KVGet(key2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 2"), v)
+	vlist, errs := db.MGet(key1, key2, key3)
+	assert.Nil(t, errs[0])
+	assert.Equal(t, []byte("hello world 1"), vlist[0])
+	assert.Equal(t, []byte("hello world 2"), vlist[1])
+	assert.Equal(t, []byte("hello world 3"), vlist[2])
+	ttl, err := db.KVTtl(key3)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 90)
+
+	// update the value should keep the ttl
+	_, err = db.Append(tn, key3, []byte(" appended"))
+	assert.Nil(t, err)
+	v, err = db.KVGet(key3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 3 appended"), v)
+	// persist should move the value back
+	n, err = db.Persist(tn, key3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Nil(t, getRotated(key3))
+	v, err = db.KVGet(key3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 3 appended"), v)
+
+	// delete should remove the rotated value
+	n, err = db.Expire(tn, key1, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, dbKey1, _ := convertRedisKeyToDBKVKey(key1)
+	hv, _ := db.GetBytes(dbKey1)
+	bucket1 := db.getKVRotationBucket(hv)
+	assert.True(t, bucket1 > 0)
+	_, err = db.DelKeys(key1)
+	assert.Nil(t, err)
+	rv, err := db.GetBytes(encodeRotationKey(bucket1, dbKey1))
+	assert.Nil(t, err)
+	assert.Nil(t, rv)
+
+	time.Sleep(time.Second * 3)
+	v, err = db.KVGet(key2)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	assert.NotNil(t, getRotated(key2))
+
+	// wait lazy clean period and drop the expired buckets
+	time.Sleep(lazyCleanExpired)
+	exp := db.expiration.(*rotationExpiration)
+	err = exp.dropExpiredBuckets()
+	assert.Nil(t, err)
+	assert.Nil(t, getRotated(key2))
+	v, err = db.KVGet(key2)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	n, err = db.KVExists(key2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	v, err = db.KVGet(key3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 3 appended"), v)
+
+	// set the expired key again should be ok
+	err = db.SetEx(tn, key2, 100, []byte("hello world 2 new"))
+	assert.Nil(t, err)
+	v, err = db.KVGet(key2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 2 new"), v)
+}
+
+func TestKVRotationTTLInBatch(t *testing.T) {
+	db := getTestDBWithRotationTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_rotation_batch")
+	_, dbKey, _ := convertRedisKeyToDBKVKey(key)
+	tn := time.Now().UnixNano()
+	err := db.BeginBatchWrite()
+	assert.Nil(t, err)
+	err = db.SetEx(tn, key, 100, []byte("hello world 1"))
+	assert.Nil(t, err)
+	// the old bucket should be found in the write batch
+	err = db.SetEx(tn, key, 200, []byte("hello world 2"))
+	assert.Nil(t, err)
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+
+	oldBucket := db.rotationBucket(tn/int64(time.Second) + 100)
+	rv, err := db.GetBytes(encodeRotationKey(oldBucket, dbKey))
+	assert.Nil(t, err)
+	assert.Nil(t, rv)
+	v, err := db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 2"), v)
+
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	_, err = db.DelKeys(key)
+	assert.Nil(t, err)
+	err = db.SetEx(tn, key, 300, []byte("hello world 3"))
+	assert.Nil(t, err)
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	// the deleted bucket should not be deleted again
+	rv, err = db.GetBytes(encodeRotationKey(db.rotationBucket(tn/int64(time.Second)+300), dbKey))
+	assert.Nil(t, err)
+	assert.NotNil(t, rv)
+	v, err = db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello world 3"), v)
+}
+
+func TestPFAddAndSetBitRotationTTL(t *testing.T) {
+	db := getTestDBWithRotationTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	getBucket := func(dbKey []byte) int64 {
+		v, err := db.GetBytes(dbKey)
+		assert.Nil(t, err)
+		return db.getKVRotationBucket(v)
+	}
+	tn := time.Now().UnixNano()
+	hllKey := []byte("test:testdb_rotation_hll")
+	_, hllDBKey, _ := convertRedisKeyToDBKVKey(hllKey)
+	n, err := db.PFAdd(tn, hllKey, []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	db.hllCache.Flush()
+	n, err = db.Expire(tn, hllKey, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	bucket := getBucket(hllDBKey)
+	assert.True(t, bucket > 0)
+
+	// the hll should be loaded from the rotated bucket
+	db.delPFCache(hllKey)
+	n, err = db.PFAdd(tn, hllKey, []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	db.hllCache.Flush()
+	if newBucket := getBucket(hllDBKey); newBucket != bucket {
+		rv, err := db.GetBytes(encodeRotationKey(bucket, hllDBKey))
+		assert.Nil(t, err)
+		assert.Nil(t, rv)
+	}
+	db.delPFCache(hllKey)
+	n, err = db.PFCount(tn, hllKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	bitKey := []byte("test:testdb_rotation_bit")
+	_, bitDBKey, _ := convertRedisKeyToDBKVKey(bitKey)
+	n, err = db.BitSetOld(tn, bitKey, 5, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.Expire(tn, bitKey, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	bucket = getBucket(bitDBKey)
+	assert.True(t, bucket > 0)
+
+	// the old data in the rotated bucket should be converted
+	n, err = db.BitSetV2(tn, bitKey, 6, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.BitGetV2(bitKey, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.BitCountV2(bitKey, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	v, err := db.GetBytes(bitDBKey)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	rv, err := db.GetBytes(encodeRotationKey(bucket, bitDBKey))
+	assert.Nil(t, err)
+	assert.Nil(t, rv)
+}
+
+func TestBitOpAndBitFieldRotationTTL(t *testing.T) {
+	db := getTestDBWithRotationTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	tn := time.Now().UnixNano()
+	setOldWithTTL := func(key []byte) ([]byte, int64) {
+		_, dbKey, _ := convertRedisKeyToDBKVKey(key)
+		_, err := db.BitSetOld(tn, key, 5, 1)
+		assert.Nil(t, err)
+		n, err := db.Expire(tn, key, 100)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		v, err := db.GetBytes(dbKey)
+		assert.Nil(t, err)
+		bucket := db.getKVRotationBucket(v)
+		assert.True(t, bucket > 0)
+		return dbKey, bucket
+	}
+	checkRemoved := func(dbKey []byte, bucket int64) {
+		v, err := db.GetBytes(dbKey)
+		assert.Nil(t, err)
+		assert.Nil(t, v)
+		rv, err := db.GetBytes(encodeRotationKey(bucket, dbKey))
+		assert.Nil(t, err)
+		assert.Nil(t, rv)
+	}
+
+	fieldKey := []byte("test:testdb_rotation_bitfield")
+	dbKey, bucket := setOldWithTTL(fieldKey)
+	rets, err := db.BitField(tn, fieldKey, []BitFieldOp{
+		{Op: BitFieldSet, Bits: 1, Offset: 6, Value: 1},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0)}, rets)
+	n, err := db.BitCountV2(fieldKey, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	checkRemoved(dbKey, bucket)
+
+	srcKey := []byte("test:testdb_rotation_bitop_src")
+	_, err = db.BitSetV2(tn, srcKey, 7, 1)
+	assert.Nil(t, err)
+	destKey := []byte("test:testdb_rotation_bitop_dest")
+	dbKey, bucket = setOldWithTTL(destKey)
+	n, err = db.BitOp(tn, BitOpOr, destKey, srcKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.BitCountV2(destKey, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	checkRemoved(dbKey, bucket)
+}
+
+func TestCollectionRotationTTL(t *testing.T) {
+	db := getTestDBWithRotationTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	assert.Equal(t, int64(1), db.rotationPeriod())
+	tn := time.Now().UnixNano()
+	key := []byte("test:testdb_rotation_hash")
+	_, err := db.HSet(tn, false, key, []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	// the ttl on the collection is refused since it can not be rotated
+	n, err := db.HExpire(tn, key, 100)
+	assert.Equal(t, errRotationCollectionTTL, err)
+	assert.Equal(t, int64(0), n)
+	ttl, err := db.HashTtl(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	_, err = db.HPersist(tn, key)
+	assert.Nil(t, err)
+
+	db.cfg.ExpirationRotationPeriod = 0
+	assert.Equal(t, defaultRotationPeriodSecs, db.rotationPeriod())
+	assert.Equal(t, int64(2), db.rotationBucket(2*defaultRotationPeriodSecs+1))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
 	"time"
 
 	ps "github.com/prometheus/client_golang/prometheus"
@@ -306,7 +307,7 @@ func (db *RockDB) ZAdd(ts int64, key []byte, args ...common.ScorePair) (int64, e
 	table := keyInfo.Table
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 
 	var num int64
 	for i := 0; i < len(args); i++ {
@@ -338,7 +339,7 @@ func (db *RockDB) ZAdd(ts int64, key []byte, args ...common.ScorePair) (int64, e
 			"table": string(table),
 		}).Observe(float64(newNum))
 	}
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return num, err
 }
 
@@ -356,7 +357,7 @@ func (db *RockDB) ZFixKey(ts int64, key []byte) error {
 	if len(elems) != int(n) {
 		dbLog.Infof("unmatched length : %v, %v, detail: %v", n, len(elems), elems)
 		db.zSetSize(ts, key, oldh, int64(len(elems)), db.wb)
-		err = db.CommitBatchWrite()
+		err = db.MaybeCommitBatch()
 		if err != nil {
 			return err
 		}
@@ -464,7 +465,7 @@ func (db *RockDB) ZRem(ts int64, key []byte, members ...[]byte) (int64, error) {
 	table := keyInfo.Table
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 
 	var num int64 = 0
 	for i := 0; i < len(members); i++ {
@@ -489,7 +490,7 @@ func (db *RockDB) ZRem(ts int64, key []byte, members ...[]byte) (int64, error) {
 	}
 	db.topLargeCollKeys.Update(key, int(newNum))
 
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return num, err
 }
 
@@ -507,7 +508,7 @@ func (db *RockDB) ZIncrBy(ts int64, key []byte, delta float64, member []byte) (f
 	rk := keyInfo.VerKey
 
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 
 	ek := zEncodeSetKey(table, rk, member)
 
@@ -541,7 +542,7 @@ func (db *RockDB) ZIncrBy(ts int64, key []byte, delta float64, member []byte) (f
 		wb.Delete(oldSk)
 	}
 
-	err = db.rockEng.Write(wb)
+	err = db.MaybeCommitBatch()
 	return score, err
 }
 
@@ -655,7 +656,7 @@ func (db *RockDB) zRemAll(ts int64, key []byte, wb engine.WriteBatch) (int64, er
 		return 0, nil
 	}
 	db.topLargeCollKeys.Update(key, int(0))
-	if db.cfg.ExpirationPolicy == common.WaitCompact {
+	if db.isCompactTTLPolicy() {
 		// for compact ttl , we can just delete the meta
 		sk := zEncodeSizeKey(key)
 		wb.Delete(sk)
@@ -894,11 +895,11 @@ func (db *RockDB) zParseLimit(total int64, start int, stop int) (offset int, cou
 }
 
 func (db *RockDB) ZClear(ts int64, key []byte) (int64, error) {
-	defer db.wb.Clear()
+	defer db.MaybeClearBatch()
 
 	rmCnt, err := db.zRemAll(ts, key, db.wb)
 	if err == nil {
-		err = db.rockEng.Write(db.wb)
+		err = db.MaybeCommitBatch()
 	}
 	if rmCnt > 0 {
 		return 1, err
@@ -915,10 +916,10 @@ func (db *RockDB) ZMclear(keys ...[]byte) (int64, error) {
 		// note: the zRemAll can not be batched, so we need clear and commit
 		// after each key.
 		if _, err := db.zRemAll(0, key, db.wb); err != nil {
-			db.wb.Clear()
+			db.clearWriteBatch()
 			return deleted, err
 		}
-		err := db.CommitBatchWrite()
+		err := db.MaybeCommitBatch()
 		if err != nil {
 			return deleted, err
 		}
@@ -972,22 +973,22 @@ func (db *RockDB) ZRemRangeByRank(ts int64, key []byte, start int, stop int) (in
 	}
 
 	var rmCnt int64
-	defer db.wb.Clear()
+	defer db.MaybeClearBatch()
 
 	rmCnt, err = db.zRemRangeBytes(ts, key, keyInfo, offset, count, db.wb)
 	if err == nil {
-		err = db.rockEng.Write(db.wb)
+		err = db.MaybeCommitBatch()
 	}
 	return rmCnt, err
 }
 
 //min and max must be inclusive
 func (db *RockDB) ZRemRangeByScore(ts int64, key []byte, min float64, max float64) (int64, error) {
-	defer db.wb.Clear()
+	defer db.MaybeClearBatch()
 
 	rmCnt, err := db.zRemRange(ts, key, min, max, 0, -1, db.wb)
 	if err == nil {
-		err = db.rockEng.Write(db.wb)
+		err = db.MaybeCommitBatch()
 	}
 
 	return rmCnt, err
@@ -1035,21 +1036,26 @@ func (db *RockDB) ZRangeByScoreGeneric(key []byte, min float64, max float64,
 	return db.zRange(key, min, max, offset, count, reverse)
 }
 
-func getAggregateFunc(aggregate byte) func(int64, int64) int64 {
+func getAggregateFunc(aggregate byte) func(float64, float64) float64 {
 	switch aggregate {
 	case AggregateSum:
-		return func(a int64, b int64) int64 {
-			return a + b
+		return func(a float64, b float64) float64 {
+			v := a + b
+			// the sum of +inf and -inf is 0 as redis
+			if math.IsNaN(v) {
+				return 0
+			}
+			return v
 		}
 	case AggregateMax:
-		return func(a int64, b int64) int64 {
+		return func(a float64, b float64) float64 {
 			if a > b {
 				return a
 			}
 			return b
 		}
 	case AggregateMin:
-		return func(a int64, b int64) int64 {
+		return func(a float64, b float64) float64 {
 			if a > b {
 				return b
 			}
@@ -1059,6 +1065,222 @@ func getAggregateFunc(aggregate byte) func(int64, int64) int64 {
 	return nil
 }
 
+// ZUnionStore store the union of the zsets to dest, the score of the member is aggregated
+// from the weighted scores in all the zsets. Return the number of the members in dest.
+func (db *RockDB) ZUnionStore(ts int64, dest []byte, keys [][]byte, weights []float64, aggregate byte) (int64, error) {
+	return db.zStore(ts, dest, keys, weights, aggregate, false)
+}
+
+// ZInterStore store the intersection of the zsets to dest, the score of the member is aggregated
+// from the weighted scores in all the zsets. Return the number of the members in dest.
+func (db *RockDB) ZInterStore(ts int64, dest []byte, keys [][]byte, weights []float64, aggregate byte) (int64, error) {
+	return db.zStore(ts, dest, keys, weights, aggregate, true)
+}
+
+func (db *RockDB) zStore(ts int64, dest []byte, keys [][]byte, weights []float64,
+	aggregate byte, inter bool) (int64, error) {
+	if len(keys) == 0 {
+		return 0, errInvalidSrcKeyNum
+	}
+	if len(keys) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	if weights != nil && len(weights) != len(keys) {
+		return 0, errInvalidWeightNum
+	}
+	aggFunc := getAggregateFunc(aggregate)
+	if aggFunc == nil {
+		return 0, errInvalidAggregate
+	}
+	if err := common.CheckKey(dest); err != nil {
+		return 0, err
+	}
+
+	var scores map[string]float64
+	// keep the order of the members in the source zsets
+	var members [][]byte
+	for i, key := range keys {
+		vals, err := db.ZRange(key, 0, -1)
+		if err != nil {
+			return 0, err
+		}
+		weight := float64(1)
+		if weights != nil {
+			weight = weights[i]
+		}
+		if i > 0 && inter {
+			if len(scores) == 0 {
+				break
+			}
+			nscores := make(map[string]float64, len(scores))
+			for _, v := range vals {
+				if old, ok := scores[string(v.Member)]; ok {
+					nscores[string(v.Member)] = aggFunc(old, weightedScore(v.Score, weight))
+				}
+			}
+			scores = nscores
+			continue
+		}
+		if scores == nil {
+			scores = make(map[string]float64, len(vals))
+		}
+		for _, v := range vals {
+			ws := weightedScore(v.Score, weight)
+			if old, ok := scores[string(v.Member)]; ok {
+				scores[string(v.Member)] = aggFunc(old, ws)
+			} else {
+				scores[string(v.Member)] = ws
+				members = append(members, v.Member)
+			}
+		}
+		if len(scores) > MAX_BATCH_NUM {
+			return 0, errTooMuchBatchSize
+		}
+	}
+	pairs := make([]common.ScorePair, 0, len(scores))
+	for _, m := range members {
+		if s, ok := scores[string(m)]; ok {
+			pairs = append(pairs, common.ScorePair{Member: m, Score: s})
+		}
+	}
+	return db.zReplaceMembers(ts, dest, pairs)
+}
+
+func weightedScore(score float64, weight float64) float64 {
+	v := score * weight
+	// 0 * inf is 0 as redis
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// overwrite the zset with the members, the old members not in the new members will be removed
+// from both the member and the score index.
+func (db *RockDB) zReplaceMembers(ts int64, key []byte, pairs []common.ScorePair) (int64, error) {
+	if len(pairs) > MAX_BATCH_NUM {
+		return 0, errTooMuchBatchSize
+	}
+	wb := db.wb
+	defer db.MaybeClearBatch()
+	if len(pairs) == 0 {
+		if _, err := db.zRemAll(ts, key, wb); err != nil {
+			return 0, err
+		}
+		return 0, db.MaybeCommitBatch()
+	}
+	newScores := make(map[string]float64, len(pairs))
+	for _, p := range pairs {
+		if err := common.CheckKeySubKey(key, p.Member); err != nil {
+			return 0, err
+		}
+		newScores[string(p.Member)] = p.Score
+	}
+	keyInfo, err := db.prepareCollKeyForWrite(ts, ZSetType, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	table := keyInfo.Table
+	rk := keyInfo.VerKey
+	oldh := keyInfo.OldHeader
+
+	var num int64
+	// the old members which only need update the score
+	updated := make(map[string]bool)
+	if !keyInfo.IsNotExistOrExpired() {
+		it, err := db.NewDBRangeIterator(zEncodeStartSetKey(table, rk), zEncodeStopSetKey(table, rk), common.RangeROpen, false)
+		if err != nil {
+			return 0, err
+		}
+		for ; it.Valid(); it.Next() {
+			ek := it.Key()
+			_, _, m, err := zDecodeSetKey(ek)
+			if err != nil {
+				it.Close()
+				return 0, err
+			}
+			s, err := Float64(it.Value(), nil)
+			if err != nil {
+				it.Close()
+				return 0, err
+			}
+			ns, ok := newScores[string(m)]
+			if ok && ns == s {
+				// the same score, nothing changed
+				delete(newScores, string(m))
+				continue
+			}
+			wb.Delete(zEncodeScoreKey(false, false, table, rk, m, s))
+			if ok {
+				updated[string(m)] = true
+			} else {
+				wb.Delete(ek)
+				num--
+			}
+		}
+		it.Close()
+	}
+	for _, p := range pairs {
+		s, ok := newScores[string(p.Member)]
+		if !ok {
+			continue
+		}
+		delete(newScores, string(p.Member))
+		if !updated[string(p.Member)] {
+			num++
+		}
+		wb.Put(zEncodeSetKey(table, rk, p.Member), PutFloat64(s))
+		wb.Put(zEncodeScoreKey(false, false, table, rk, p.Member, s), []byte{})
+	}
+	// the destination is overwritten, so the ttl should be removed as redis
+	oldh.ExpireAt = 0
+	newNum, err := db.zIncrSize(ts, key, oldh, num, wb)
+	if err != nil {
+		return 0, err
+	} else if newNum > 0 && newNum == num && !keyInfo.Expired {
+		db.IncrTableKeyCount(table, 1, wb)
+	}
+	db.topLargeCollKeys.Update(key, int(newNum))
+	err = db.MaybeCommitBatch()
+	return newNum, err
+}
+
+// ZPopMin remove and return at most count members with the lowest scores
+func (db *RockDB) ZPopMin(ts int64, key []byte, count int) ([]common.ScorePair, error) {
+	return db.zPop(ts, key, count, false)
+}
+
+// ZPopMax remove and return at most count members with the highest scores
+func (db *RockDB) ZPopMax(ts int64, key []byte, count int) ([]common.ScorePair, error) {
+	return db.zPop(ts, key, count, true)
+}
+
+func (db *RockDB) zPop(ts int64, key []byte, count int, reverse bool) ([]common.ScorePair, error) {
+	if count > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	keyInfo, err := db.getCollVerKeyForRange(ts, ZSetType, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return nil, nil
+	}
+	vals, err := db.zRangeBytes(ts, false, key, keyInfo.RangeStart, keyInfo.RangeEnd, 0, count, reverse)
+	if err != nil || len(vals) == 0 {
+		return nil, err
+	}
+	members := make([][]byte, 0, len(vals))
+	for _, v := range vals {
+		members = append(members, v.Member)
+	}
+	_, err = db.ZRem(ts, key, members...)
+	return vals, err
+}
+
 func (db *RockDB) ZRangeByLex(key []byte, min []byte, max []byte, rangeType uint8, offset int, count int) ([][]byte, error) {
 	if count > MAX_BATCH_NUM {
 		return nil, errTooMuchBatchSize
@@ -1154,13 +1376,13 @@ func (db *RockDB) internalZRemRangeByLex(ts int64, key []byte, min []byte, max [
 
 func (db *RockDB) ZRemRangeByLex(ts int64, key []byte, min []byte, max []byte, rangeType uint8) (int64, error) {
 	wb := db.wb
-	defer wb.Clear()
+	defer db.MaybeClearBatch()
 	if min == nil && max == nil {
 		cnt, err := db.zRemAll(ts, key, wb)
 		if err != nil {
 			return 0, err
 		}
-		if err := db.rockEng.Write(wb); err != nil {
+		if err := db.MaybeCommitBatch(); err != nil {
 			return 0, err
 		}
 		return cnt, nil
@@ -1171,7 +1393,7 @@ func (db *RockDB) ZRemRangeByLex(ts int64, key []byte, min []byte, max []byte, r
 		return 0, err
 	}
 
-	if err := db.rockEng.Write(wb); err != nil {
+	if err := db.MaybeCommitBatch(); err != nil {
 		return 0, err
 	}
 
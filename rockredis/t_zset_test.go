@@ -780,3 +780,116 @@ func BenchmarkZaddAndZRembyrange(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestDBZSetAggregateStore(t *testing.T) {
+	db := getTestDBWithCompactTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_zset_aggregate_1")
+	key2 := []byte("test:testdb_zset_aggregate_2")
+	key3 := []byte("test:testdb_zset_aggregate_3")
+	dest := []byte("test:testdb_zset_aggregate_dest")
+	ts := time.Now().UnixNano()
+	db.ZAdd(ts, key1, common.ScorePair{Score: 1, Member: []byte("a")},
+		common.ScorePair{Score: 2, Member: []byte("b")},
+		common.ScorePair{Score: 3, Member: []byte("c")})
+	db.ZAdd(ts, key2, common.ScorePair{Score: 10, Member: []byte("b")},
+		common.ScorePair{Score: 20, Member: []byte("c")},
+		common.ScorePair{Score: 30, Member: []byte("d")})
+
+	db.ZAdd(ts, dest, common.ScorePair{Score: 5, Member: []byte("b")},
+		common.ScorePair{Score: 6, Member: []byte("x")})
+	_, err := db.ZExpire(ts, dest, 100)
+	assert.Nil(t, err)
+	n, err := db.ZUnionStore(ts, dest, [][]byte{key1, key2}, nil, AggregateSum)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	vlist, err := db.ZRange(dest, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ScorePair{
+		{Score: 1, Member: []byte("a")},
+		{Score: 12, Member: []byte("b")},
+		{Score: 23, Member: []byte("c")},
+		{Score: 30, Member: []byte("d")},
+	}, vlist)
+	ttl, err := db.ZSetTtl(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	// the old score index should be removed
+	n, err = db.ZCount(dest, 5, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = db.ZInterStore(ts, dest, [][]byte{key1, key2}, []float64{2, 1}, AggregateMax)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	vlist, err = db.ZRangeByScore(dest, common.MinScore, common.MaxScore, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ScorePair{
+		{Score: 10, Member: []byte("b")},
+		{Score: 20, Member: []byte("c")},
+	}, vlist)
+	n, err = db.ZCard(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the dest can be one of the source zsets
+	n, err = db.ZUnionStore(ts, dest, [][]byte{dest, key1}, nil, AggregateMin)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	score, err := db.ZScore(dest, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(2), score)
+
+	n, err = db.ZInterStore(ts, dest, [][]byte{key1, key3}, nil, AggregateSum)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.ZKeyExists(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	_, err = db.ZUnionStore(ts, dest, [][]byte{key1, key2}, []float64{1}, AggregateSum)
+	assert.Equal(t, errInvalidWeightNum, err)
+	_, err = db.ZUnionStore(ts, dest, [][]byte{key1, key2}, nil, 10)
+	assert.Equal(t, errInvalidAggregate, err)
+}
+
+func TestDBZSetPop(t *testing.T) {
+	db := getTestDBWithCompactTTL(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_zset_pop")
+	ts := time.Now().UnixNano()
+	db.ZAdd(ts, key, common.ScorePair{Score: 1, Member: []byte("a")},
+		common.ScorePair{Score: 2, Member: []byte("b")},
+		common.ScorePair{Score: 3, Member: []byte("c")},
+		common.ScorePair{Score: 4, Member: []byte("d")})
+
+	vlist, err := db.ZPopMin(ts, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ScorePair{{Score: 1, Member: []byte("a")}}, vlist)
+	vlist, err = db.ZPopMax(ts, key, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ScorePair{
+		{Score: 4, Member: []byte("d")},
+		{Score: 3, Member: []byte("c")},
+	}, vlist)
+	n, err := db.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.ZCount(key, common.MinScore, common.MaxScore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	vlist, err = db.ZPopMin(ts, key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ScorePair{{Score: 2, Member: []byte("b")}}, vlist)
+	n, err = db.ZKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	vlist, err = db.ZPopMax(ts, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(vlist))
+}
@@ -11,6 +11,7 @@ import (
 
 var errIntNumber = errors.New("invalid integer")
 var errFloat64Number = errors.New("invalid float64")
+var errFloatNaNOrInf = errors.New("increment would produce NaN or Infinity")
 
 func Int64(v []byte, err error) (int64, error) {
 	n, err := Uint64(v, err)
@@ -33,6 +34,10 @@ func FormatInt64ToSlice(v int64) []byte {
 	return strconv.AppendInt(nil, int64(v), 10)
 }
 
+func FormatFloat64ToSlice(v float64) []byte {
+	return strconv.AppendFloat(nil, v, 'f', -1, 64)
+}
+
 func PutInt64ToBuf(v int64, b []byte) {
 	binary.BigEndian.PutUint64(b, uint64(v))
 }
@@ -73,6 +78,19 @@ func StrInt64(v []byte, err error) (int64, error) {
 	}
 }
 
+func StrFloat64(v []byte, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	} else if v == nil {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errFloat64Number
+	}
+	return f, nil
+}
+
 func StrUint64(v []byte, err error) (uint64, error) {
 	if err != nil {
 		return 0, err
@@ -277,6 +295,8 @@ func dataType2CommonType(t byte) common.DataType {
 		return common.SET
 	case ZSetType:
 		return common.ZSET
+	case StreamType:
+		return common.STREAM
 	default:
 		return common.NONE
 	}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var authRefreshInterval = time.Second * 5
+
+// the context bind to the redis connection
+type redisConnCtx struct {
+	authUser string
+	txn      multiExecState
+}
+
+func getRedisConnCtx(conn redcon.Conn) *redisConnCtx {
+	if ctx, ok := conn.Context().(*redisConnCtx); ok {
+		return ctx
+	}
+	ctx := &redisConnCtx{}
+	conn.SetContext(ctx)
+	return ctx
+}
+
+func (s *Server) getAuthInfo() *common.AuthInfo {
+	v := s.authInfo.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(*common.AuthInfo)
+}
+
+func (s *Server) isAuthEnabled() bool {
+	info := s.getAuthInfo()
+	return info != nil && info.Enabled
+}
+
+// the auth info from local config is only used while there is no register
+func (s *Server) initLocalAuthInfo() {
+	if s.conf.RequirePass == "" {
+		return
+	}
+	s.authInfo.Store(&common.AuthInfo{
+		Enabled: true,
+		Users: []common.AuthUser{
+			{
+				Name:         common.DefaultAuthUser,
+				PasswordHash: common.HashAuthPassword(s.conf.RequirePass),
+				ACLs:         []common.AuthACL{{Namespace: common.AuthMatchAll}},
+			},
+		},
+	})
+}
+
+func (s *Server) refreshAuthInfo() error {
+	if s.dataCoord == nil {
+		return nil
+	}
+	info, err := s.dataCoord.GetClusterAuthInfo()
+	if err != nil {
+		return err
+	}
+	old := s.getAuthInfo()
+	if old == nil || old.Enabled != info.Enabled || len(old.Users) != len(info.Users) {
+		sLog.Infof("cluster auth info changed, enabled: %v, users: %v", info.Enabled, len(info.Users))
+	}
+	s.authInfo.Store(info)
+	return nil
+}
+
+func (s *Server) authRefreshLoop(stopC <-chan struct{}) {
+	if s.dataCoord == nil {
+		return
+	}
+	ticker := time.NewTicker(authRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+			err := s.refreshAuthInfo()
+			if err != nil {
+				sLog.Infof("refresh cluster auth info failed: %v", err.Error())
+			}
+		}
+	}
+}
+
+func (s *Server) doAuth(conn redcon.Conn, cmd redcon.Command) {
+	info := s.getAuthInfo()
+	if info == nil || !info.Enabled {
+		// keep compatible with the old client which always send auth
+		conn.WriteString("OK")
+		return
+	}
+	var name, pass string
+	switch len(cmd.Args) {
+	case 2:
+		name = common.DefaultAuthUser
+		pass = string(cmd.Args[1])
+	case 3:
+		name = string(cmd.Args[1])
+		pass = string(cmd.Args[2])
+	default:
+		conn.WriteError("ERR wrong number of arguments for 'auth' command")
+		return
+	}
+	ctx := getRedisConnCtx(conn)
+	_, err := info.Authenticate(name, pass)
+	if err != nil {
+		sLog.Infof("auth user %v from %v failed: %v", name, conn.RemoteAddr(), err.Error())
+		ctx.authUser = ""
+		conn.WriteError(err.Error())
+		return
+	}
+	ctx.authUser = name
+	conn.WriteString("OK")
+}
+
+// return the authed user for the connection, nil user if auth is disabled
+func (s *Server) checkConnAuthed(conn redcon.Conn) (*common.AuthUser, error) {
+	info := s.getAuthInfo()
+	if info == nil || !info.Enabled {
+		return nil, nil
+	}
+	ctx, ok := conn.Context().(*redisConnCtx)
+	if !ok || ctx.authUser == "" {
+		return nil, common.ErrAuthRequired
+	}
+	// the user may be removed or disabled after authed
+	u := info.GetUser(ctx.authUser)
+	if u == nil || u.Disabled {
+		ctx.authUser = ""
+		return nil, common.ErrAuthRequired
+	}
+	return u, nil
+}
+
+func extractNsAndTable(rawKey []byte) (string, string, error) {
+	ns, realKey, err := common.ExtractNamesapce(rawKey)
+	if err != nil {
+		return "", "", err
+	}
+	table, _, err := common.ExtractTable(realKey)
+	if err != nil {
+		// no key after table, such as the index search or scan command
+		return ns, string(realKey), nil
+	}
+	return ns, string(table), nil
+}
+
+func checkUserAccessKeys(u *common.AuthUser, keys [][]byte, isWrite bool) error {
+	if u == nil {
+		return nil
+	}
+	for _, k := range keys {
+		ns, table, err := extractNsAndTable(k)
+		if err != nil {
+			return err
+		}
+		err = u.CheckAccess(ns, table, isWrite)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkUserAccessMergeCmd(u *common.AuthUser, cmdName string, cmd redcon.Command) error {
+	if u == nil {
+		return nil
+	}
+	if len(cmd.Args) < 2 {
+		return common.ErrInvalidArgs
+	}
+	if !common.IsMergeKeysCommand(cmdName) {
+		// scan and index search are all read in the single namespace table
+		return checkUserAccessKeys(u, cmd.Args[1:2], false)
+	}
+	switch cmdName {
+	case "plset", "mset":
+		keys := make([][]byte, 0, len(cmd.Args)/2)
+		for i := 1; i < len(cmd.Args); i += 2 {
+			keys = append(keys, cmd.Args[i])
+		}
+		return checkUserAccessKeys(u, keys, true)
+	case "exists", "mget", "sinter", "sunion", "sdiff":
+		return checkUserAccessKeys(u, cmd.Args[1:], false)
+	default:
+		return checkUserAccessKeys(u, cmd.Args[1:], true)
+	}
+}
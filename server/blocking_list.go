@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+var (
+	errBlockingTimeout         = errors.New("ERR timeout is not a float or out of range")
+	errBlockingTimeoutNegative = errors.New("ERR timeout is negative")
+	errBlockingCrossPartition  = errors.New("ERR all the keys in the blocking command should be in the same partition")
+	errBlockingConnClosed      = errors.New("blocking connection closed")
+)
+
+// the pending commands read while blocking, the reader will wait if full
+const blockingConnCmdBufSize = 128
+
+// blockingConn is the detached redis connection after the blocking command, the client
+// commands are read in the reader goroutine so we can find the closed client while blocking,
+// and they are served in order after the blocking command returned.
+type blockingConn struct {
+	redcon.DetachedConn
+	cmdC    chan redcon.Command
+	closedC chan struct{}
+	// detached again by the commands such as subscribe
+	detached bool
+}
+
+func newBlockingConn(dconn redcon.DetachedConn) *blockingConn {
+	// the idle deadline set by the server loop should not close the blocked client
+	if nc, ok := dconn.(interface{ NetConn() net.Conn }); ok {
+		nc.NetConn().SetReadDeadline(time.Time{})
+	}
+	bc := &blockingConn{
+		DetachedConn: dconn,
+		cmdC:         make(chan redcon.Command, blockingConnCmdBufSize),
+		closedC:      make(chan struct{}),
+	}
+	go bc.readLoop()
+	return bc
+}
+
+func (bc *blockingConn) readLoop() {
+	defer close(bc.closedC)
+	for {
+		cmd, err := bc.DetachedConn.ReadCommand()
+		if err != nil {
+			return
+		}
+		bc.cmdC <- cmd
+	}
+}
+
+// ReadCommand returns the commands read by the reader goroutine
+func (bc *blockingConn) ReadCommand() (redcon.Command, error) {
+	return bc.readCommand(nil)
+}
+
+// the pending commands are returned before the closed error
+func (bc *blockingConn) readCommand(stopC <-chan struct{}) (redcon.Command, error) {
+	select {
+	case cmd := <-bc.cmdC:
+		return cmd, nil
+	default:
+	}
+	select {
+	case cmd := <-bc.cmdC:
+		return cmd, nil
+	case <-bc.closedC:
+		return redcon.Command{}, errBlockingConnClosed
+	case <-stopC:
+		return redcon.Command{}, errBlockingConnClosed
+	}
+}
+
+// Detach hands over the connection to the caller, the commands are still read from
+// the same reader goroutine.
+func (bc *blockingConn) Detach() redcon.DetachedConn {
+	bc.detached = true
+	return bc
+}
+
+// serve the connection after the blocking command until the client is closed
+func (s *Server) serveBlockingConn(bc *blockingConn) {
+	for {
+		bc.Flush()
+		cmd, err := bc.readCommand(s.stopC)
+		if err != nil {
+			bc.Close()
+			return
+		}
+		s.serverRedis(bc, cmd)
+		if bc.detached {
+			return
+		}
+	}
+}
+
+func parseBlockingTimeout(arg []byte) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, errBlockingTimeout
+	}
+	if secs < 0 {
+		return 0, errBlockingTimeoutNegative
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// the blocking commands will hold the connection on the partition leader until
+// the list or zset is pushed or timeout, all the keys should be in the same partition.
+// blpop key [key ...] timeout
+// brpop key [key ...] timeout
+// brpoplpush source destination timeout
+// bzpopmin key [key ...] timeout
+// The connection is detached while blocking to watch the closed client, so the waiter can
+// be removed and no element is popped for the gone client.
+func (s *Server) doBlockingListCmd(conn redcon.Conn, authUser *common.AuthUser, cmdName string, cmd redcon.Command) {
+	if len(cmd.Args) < 3 || (cmdName == "brpoplpush" && len(cmd.Args) != 4) {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	timeout, err := parseBlockingTimeout(cmd.Args[len(cmd.Args)-1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	keys := cmd.Args[1 : len(cmd.Args)-1]
+	if err := checkUserAccessKeys(authUser, keys, true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if node.IsSyncerOnly() {
+		conn.WriteError("The cluster is only allowing syncer write : ERR handle command " + cmdName)
+		return
+	}
+	if err := node.CheckActiveActiveCmd(cmdName); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	var kvn *node.KVNode
+	pks := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		ns, pk, err := common.ExtractNamesapce(k)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, node.HashedKey(pk))
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		if kvn == nil {
+			kvn = n.Node
+		} else if kvn != n.Node {
+			conn.WriteError(errBlockingCrossPartition.Error())
+			return
+		}
+		pks = append(pks, pk)
+	}
+
+	if bc, ok := conn.(*blockingConn); ok {
+		// already detached by the previous blocking command
+		doBlockingPop(bc, kvn, cmdName, keys, pks, timeout)
+		return
+	}
+	bc := newBlockingConn(conn.Detach())
+	go func() {
+		doBlockingPop(bc, kvn, cmdName, keys, pks, timeout)
+		s.serveBlockingConn(bc)
+	}()
+}
+
+func doBlockingPop(bc *blockingConn, kvn *node.KVNode, cmdName string, keys [][]byte,
+	pks [][]byte, timeout time.Duration) {
+	if cmdName == "bzpopmin" {
+		popKey, v, err := kvn.BlockingZPopMin(pks, timeout, bc.closedC)
+		if err != nil {
+			bc.WriteError(err.Error())
+			return
+		}
+		if popKey == nil {
+			bc.WriteArray(-1)
+			return
+		}
+		bc.WriteArray(1 + len(v))
+		bc.WriteBulk(keys[indexOfKey(pks, popKey)])
+		for _, d := range v {
+			bc.WriteBulk(d)
+		}
+		return
+	}
+	if cmdName == "brpoplpush" {
+		v, err := kvn.BlockingRPopLPush(pks[0], pks[1], timeout, bc.closedC)
+		if err != nil {
+			bc.WriteError(err.Error())
+		} else if v == nil {
+			bc.WriteNull()
+		} else {
+			bc.WriteBulk(v)
+		}
+		return
+	}
+	popKey, v, err := kvn.BlockingPop(pks, cmdName == "blpop", timeout, bc.closedC)
+	if err != nil {
+		bc.WriteError(err.Error())
+		return
+	}
+	if popKey == nil {
+		bc.WriteArray(-1)
+		return
+	}
+	// return the key with namespace as the client given
+	bc.WriteArray(2)
+	bc.WriteBulk(keys[indexOfKey(pks, popKey)])
+	bc.WriteBulk(v)
+}
+
+// the popped key is always one of the keys
+func indexOfKey(pks [][]byte, key []byte) int {
+	for i, pk := range pks {
+		if string(pk) == string(key) {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+
+	context "golang.org/x/net/context"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/syncerpb"
+)
+
+func (s *Server) getCDCNamespace(raftGroupName string) (*node.NamespaceNode, error) {
+	if !common.IsRoleCDC(s.conf.LearnerRole) {
+		return nil, errCDCRoleRequired
+	}
+	kv := s.GetNamespaceFromFullName(raftGroupName)
+	if kv == nil || !kv.IsReady() {
+		return nil, errRaftGroupNotReady
+	}
+	return kv, nil
+}
+
+// Subscribe stream the change events of the partition until the client canceled
+func (s *Server) Subscribe(req *syncerpb.CDCSubscribeReq, stream syncerpb.CDCAPI_SubscribeServer) error {
+	kv, err := s.getCDCNamespace(req.RaftGroupName)
+	if err != nil {
+		return err
+	}
+	// the stream context is canceled after the handler returned
+	ctx := stream.Context()
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.stopC:
+		}
+		close(stop)
+	}()
+	var out syncerpb.CDCEventBatch
+	err = kv.Node.SubscribeCDC(req.Consumer, req.StartIndex, stop, func(events []syncerpb.CDCEvent) error {
+		out.Events = events
+		return stream.Send(&out)
+	})
+	if err != nil {
+		sLog.Infof("consumer %v subscribe cdc of %v stopped: %v", req.Consumer, req.RaftGroupName, err)
+	}
+	return err
+}
+
+func (s *Server) CommitPosition(ctx context.Context, pos *syncerpb.CDCPosition) (*syncerpb.RpcErr, error) {
+	var rpcErr syncerpb.RpcErr
+	kv, err := s.getCDCNamespace(pos.RaftGroupName)
+	if err != nil {
+		rpcErr.ErrCode = http.StatusNotFound
+		rpcErr.ErrMsg = err.Error()
+		return &rpcErr, nil
+	}
+	err = kv.Node.CommitCDCPosition(pos)
+	if err != nil {
+		rpcErr.ErrCode = http.StatusBadRequest
+		rpcErr.ErrMsg = err.Error()
+	}
+	return &rpcErr, nil
+}
+
+func (s *Server) GetPosition(ctx context.Context, req *syncerpb.CDCPositionReq) (*syncerpb.CDCPosition, error) {
+	kv, err := s.getCDCNamespace(req.RaftGroupName)
+	if err != nil {
+		return nil, err
+	}
+	return kv.Node.GetCDCPosition(req.Consumer)
+}
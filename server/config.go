@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/engine"
 )
 
@@ -36,6 +37,33 @@ type ServerConfig struct {
 	SharedRocksWAL          bool              `json:"shared_rocks_wal"`
 	UseRedisV2              bool              `json:"use_redis_v2"`
 	SlowLimiterRefuseCostMs int64             `json:"slow_limiter_refuse_cost_ms"`
+	// the password for the default user, only used if no etcd cluster,
+	// otherwise the auth info from placement driver will be used.
+	RequirePass string `json:"require_pass"`
+	// publish the keyspace notifications for the key changes on the partition leader
+	KeyspaceNotify bool `json:"keyspace_notify"`
+	// serve the linearizable read on the follower using the read index from the leader
+	FollowerRead bool `json:"follower_read"`
+	// transfer the snapshot using the rsync daemon instead of the http api
+	UseRsyncTransfer bool `json:"use_rsync_transfer"`
+	// archive the committed raft logs for the point-in-time restore
+	RaftLogArchive bool `json:"raft_log_archive"`
+	// the root dir of the archived raft logs, default is the raft_archive under the data dir
+	RaftLogArchiveDir string `json:"raft_log_archive_dir"`
+	// the archived raft logs older than the hours will be purged, default is 72 hours
+	RaftLogArchiveKeepHours int `json:"raft_log_archive_keep_hours"`
+	// the number of the change event segment files kept by the cdc learner
+	CDCKeepSegments int `json:"cdc_keep_segments"`
+	// both clusters are writable and synced to each other, the conflicts are resolved by data type
+	ActiveActiveSync bool `json:"active_active_sync"`
+	// answer the redis cluster commands with the slots mapped from the partitions of
+	// this namespace, and redirect the key to the node of the partition leader. The keys
+	// of this namespace are placed by the slot (slot % partition number), so it should be
+	// the same on all the nodes and can only be set for a new namespace.
+	RedisClusterNamespace string `json:"redis_cluster_namespace"`
+	// the certificates for the redis, http, raft and grpc api, the tls is disabled if empty.
+	// The raft tls should be enabled by the https scheme in local_raft_addr.
+	TLS common.TLSConfig `json:"tls"`
 
 	ElectionTick int `json:"election_tick"`
 	TickMs       int `json:"tick_ms"`
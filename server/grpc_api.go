@@ -10,11 +10,13 @@ import (
 
 	context "golang.org/x/net/context"
 
+	ps "github.com/prometheus/client_golang/prometheus"
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/metric"
 	"github.com/youzan/ZanRedisDB/node"
 	"github.com/youzan/ZanRedisDB/syncerpb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -25,6 +27,13 @@ var (
 var syncClusterNetStats metric.WriteStats
 var syncClusterTotalStats metric.WriteStats
 
+func (s *Server) localClusterName() string {
+	if s.dataCoord != nil {
+		return s.dataCoord.GetClusterName()
+	}
+	return s.conf.ClusterID
+}
+
 var applyStatusMapping = map[int]syncerpb.RaftApplySnapStatus{
 	0: syncerpb.ApplyUnknown,
 	1: syncerpb.ApplyWaitingBegin,
@@ -66,6 +75,7 @@ func (s *Server) ApplyRaftReqs(ctx context.Context, reqs *syncerpb.RaftReqs) (*s
 			f()
 		}
 	}()
+	localCluster := s.localClusterName()
 	for _, r := range reqs.RaftLog {
 		if sLog.Level() >= common.LOG_DETAIL {
 			sLog.Debugf("applying raft log from remote cluster syncer: %v", r.String())
@@ -108,6 +118,17 @@ func (s *Server) ApplyRaftReqs(ctx context.Context, reqs *syncerpb.RaftReqs) (*s
 			rpcErr.ErrMsg = err.Error()
 			return &rpcErr, nil
 		}
+		if r.ClusterName == localCluster || reqList.OrigCluster == localCluster {
+			// the log written by local cluster is synced back from the other cluster while both clusters
+			// are syncing to each other, ignore it to avoid the loop
+			sLog.Infof("%v raft log from cluster %v ignored since it is originally from local: %v-%v",
+				r.RaftGroupName, r.ClusterName, r.Term, r.Index)
+			metric.EventCnt.With(ps.Labels{
+				"namespace":  r.RaftGroupName,
+				"event_name": "cluster_syncer_loop_dropped",
+			}).Inc()
+			continue
+		}
 		if len(reqList.Reqs) == 0 {
 			// some events (such as leader transfer) has no reqs,
 			// however, we need to send to raft so we will not lost the event while this leader changed
@@ -241,11 +262,16 @@ func (s *Server) serveGRPCAPI(port int, stopC <-chan struct{}) error {
 		return err
 	}
 	sLog.Infof("begin grpc server at port: %v", port)
-	rpcServer := grpc.NewServer(
-		grpc.MaxRecvMsgSize(256<<20),
-		grpc.MaxSendMsgSize(256<<20),
-	)
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(256 << 20),
+		grpc.MaxSendMsgSize(256 << 20),
+	}
+	if s.tlsReloader != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsReloader.ServerConfig())))
+	}
+	rpcServer := grpc.NewServer(opts...)
 	syncerpb.RegisterCrossClusterAPIServer(rpcServer, s)
+	syncerpb.RegisterCDCAPIServer(rpcServer, s)
 	go func() {
 		<-stopC
 		sLog.Infof("begin stopping grpc server")
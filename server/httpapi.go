@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -29,6 +31,9 @@ import (
 
 var allowStaleRead int32
 
+// allow the linearizable read on the follower by waiting the read index from the leader
+var allowFollowerRead int32
+
 type RaftProgress struct {
 	Match uint64 `json:"match"`
 	Next  uint64 `json:"next"`
@@ -149,6 +154,32 @@ func (s *Server) doBackup(w http.ResponseWriter, req *http.Request, ps httproute
 	return nil, nil
 }
 
+func (s *Server) doBackupExport(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	dir := reqParams.Get("dir")
+	if dir == "" || !filepath.IsAbs(dir) {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_ARG_DIR"}
+	}
+	cutTs, err := strconv.ParseInt(reqParams.Get("cut_ts"), 10, 64)
+	if err != nil || cutTs <= 0 {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_ARG_CUT_TS"}
+	}
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	info, err := v.Node.ExportBackup(dir, cutTs)
+	if err != nil {
+		sLog.Infof("export backup %v to %v failed: %v", ns, dir, err)
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return info, nil
+}
+
 func (s *Server) doBackupAll(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	s.nsMgr.BackupDB("", false)
 	return nil, nil
@@ -378,9 +409,31 @@ func (s *Server) isNsNodeFullReady(w http.ResponseWriter, req *http.Request, ps
 	if !ok {
 		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "raft node is not synced yet"}
 	}
+	if v.Node.IsSplitSeeding() {
+		// the new partition by split is not ready until the seed data is saved in snapshot
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "split seed is not saved in snapshot yet"}
+	}
+	if v.Node.IsRestoreSeeding() {
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "restore seed is not saved in snapshot yet"}
+	}
 	return nil, nil
 }
 
+func (s *Server) isSplitSeedApplied(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	seedIndex, ok := v.Node.IsSplitSeedApplied()
+	if !ok {
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "split seed is not applied by leader yet"}
+	}
+	return struct {
+		SeedIndex uint64 `json:"seed_index"`
+	}{SeedIndex: seedIndex}, nil
+}
+
 func (s *Server) checkNodeBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
@@ -398,6 +451,78 @@ func (s *Server) checkNodeBackup(w http.ResponseWriter, req *http.Request, ps ht
 	return nil, nil
 }
 
+// the snapshot files can only be downloaded by the other nodes in the cluster, while tls
+// is enabled the request should have the client certificate verified by the cluster ca.
+func (s *Server) isFromVerifiedPeer(req *http.Request) bool {
+	if s.tlsReloader == nil {
+		return true
+	}
+	return req.TLS != nil && len(req.TLS.VerifiedChains) > 0
+}
+
+func (s *Server) getSnapFileList(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.isFromVerifiedPeer(req) {
+		return nil, common.HttpErr{Code: http.StatusForbidden, Text: "client certificate required"}
+	}
+	fullPath, err := common.GetSnapFilePath(s.conf.DataDir, req.URL.Query().Get("path"))
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	files, err := common.ListSnapFiles(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+		}
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return files, nil
+}
+
+func (s *Server) getSnapFileCRC(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.isFromVerifiedPeer(req) {
+		return nil, common.HttpErr{Code: http.StatusForbidden, Text: "client certificate required"}
+	}
+	fullPath, err := common.GetSnapFilePath(s.conf.DataDir, req.URL.Query().Get("path"))
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	info, err := common.GetSnapFileInfo(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+		}
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return info, nil
+}
+
+// the file content is written directly without the json wrapper
+func (s *Server) getSnapFile(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if !s.isFromVerifiedPeer(req) {
+		http.Error(w, "client certificate required", http.StatusForbidden)
+		return
+	}
+	reqParams := req.URL.Query()
+	fullPath, err := common.GetSnapFilePath(s.conf.DataDir, reqParams.Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := int64(0)
+	if offsetStr := reqParams.Get("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			http.Error(w, "BAD_ARG_STRING", http.StatusBadRequest)
+			return
+		}
+	}
+	sLog.Infof("sending snapshot file %v from offset %v to remote: %v", fullPath, offset, req.RemoteAddr)
+	err = common.ServeSnapFile(w, fullPath, offset)
+	if err != nil {
+		sLog.Infof("send snapshot file %v failed: %v", fullPath, err)
+	}
+}
+
 func (s *Server) pingHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	return "OK", nil
 }
@@ -510,6 +635,23 @@ func (s *Server) doSetStaleRead(w http.ResponseWriter, req *http.Request, ps htt
 	return nil, nil
 }
 
+func (s *Server) doSetFollowerRead(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	allowStr := reqParams.Get("allow")
+	if allowStr == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG"}
+	}
+	if allowStr == "true" {
+		atomic.StoreInt32(&allowFollowerRead, int32(1))
+	} else {
+		atomic.StoreInt32(&allowFollowerRead, int32(0))
+	}
+	return nil, nil
+}
+
 func (s *Server) getSyncerRunnings(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	if s.dataCoord == nil {
 		return nil, nil
@@ -803,8 +945,8 @@ func (s *Server) doLogSyncStats(w http.ResponseWriter, req *http.Request, ps htt
 				continue
 			}
 			for _, n := range ninfos {
-				uri := fmt.Sprintf("http://%s:%s/raft/stats?leader_only=true",
-					n.RemoteAddr, n.HttpAPIPort)
+				uri := fmt.Sprintf("%s://%s:%s/raft/stats?leader_only=true",
+					common.HTTPScheme(), n.RemoteAddr, n.HttpAPIPort)
 				allUrls[uri] = true
 			}
 		}
@@ -917,6 +1059,11 @@ func (s *Server) initHttpHandler() {
 	router.Handle("GET", common.APIGetIndexes+"/:namespace", common.Decorate(s.getIndexes, common.V1))
 	router.Handle("GET", common.APICheckBackup+"/:namespace", common.Decorate(s.checkNodeBackup, log, common.V1))
 	router.Handle("GET", common.APIIsRaftSynced+"/:namespace", common.Decorate(s.isNsNodeFullReady, common.V1))
+	router.Handle("GET", common.APIIsSplitSeedApplied+"/:namespace", common.Decorate(s.isSplitSeedApplied, common.V1))
+	router.Handle("GET", common.APISnapFileList, common.Decorate(s.getSnapFileList, log, common.V1))
+	router.Handle("GET", common.APISnapFileCRC, common.Decorate(s.getSnapFileCRC, common.V1))
+	router.Handle("GET", common.APISnapFile, s.getSnapFile)
+	router.Handle("POST", common.APIPubSubForward, common.Decorate(s.doPubSubForward, common.V1))
 	router.Handle("GET", "/kv/get/:namespace", common.Decorate(s.getKey, common.PlainText))
 	router.Handle("POST", "/kv/optimize/:namespace/:table", common.Decorate(s.doOptimizeTable, log, common.V1))
 	router.Handle("POST", "/kv/optimize/:namespace", common.Decorate(s.doOptimizeNS, log, common.V1))
@@ -927,6 +1074,7 @@ func (s *Server) initHttpHandler() {
 	router.Handle("POST", "/kv/enable_optimize", common.Decorate(s.enableOptimize, log, common.V1))
 	router.Handle("POST", "/kv/backup/:namespace", common.Decorate(s.doBackup, log, common.V1))
 	router.Handle("POST", "/kv/backup/", common.Decorate(s.doBackupAll, log, common.V1))
+	router.Handle("POST", common.APIBackupExport+"/:namespace", common.Decorate(s.doBackupExport, log, common.V1))
 	router.Handle("POST", "/cluster/raft/forcenew/:namespace", common.Decorate(s.doForceNewCluster, log, common.V1))
 	router.Handle("POST", "/cluster/raft/forceclean/:namespace", common.Decorate(s.doForceCleanRaftNode, log, common.V1))
 	router.Handle("POST", common.APIAddNode, common.Decorate(s.doAddNode, log, common.V1))
@@ -941,6 +1089,7 @@ func (s *Server) initHttpHandler() {
 	router.Handle("POST", "/costlevel/set", common.Decorate(s.doSetCostLevel, log, common.V1))
 	router.Handle("POST", "/rsynclimit", common.Decorate(s.doSetRsyncLimit, log, common.V1))
 	router.Handle("POST", "/staleread", common.Decorate(s.doSetStaleRead, log, common.V1))
+	router.Handle("POST", "/followerread", common.Decorate(s.doSetFollowerRead, log, common.V1))
 	router.Handle("POST", "/synceronly", common.Decorate(s.doSetSyncerOnly, log, common.V1))
 	router.Handle("POST", "/disableconflictlog", common.Decorate(s.doSwitchDisableConflictLog, log, common.V1))
 	router.Handle("GET", "/synceronly", common.Decorate(s.getSyncerOnlyState, log, common.V1))
@@ -981,7 +1130,11 @@ func (s *Server) serveHttpAPI(port int, stopC <-chan struct{}) {
 	if err != nil {
 		panic(err)
 	}
-	err = srv.Serve(l)
+	if s.tlsReloader != nil {
+		err = srv.Serve(tls.NewListener(l, s.tlsReloader.PeerServerConfig()))
+	} else {
+		err = srv.Serve(l)
+	}
 	// exit when raft goes down
 	sLog.Infof("http server stopped: %v", err)
 }
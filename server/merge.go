@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/absolute8511/redcon"
@@ -62,29 +61,51 @@ func (s *Server) doMergeCommand(conn redcon.Conn, cmd redcon.Command) {
 	} else if common.IsMergeIndexSearchCommand(cmdName) {
 		s.doMergeIndexSearch(conn, cmd)
 	} else if common.IsMergeKeysCommand(cmdName) {
-		// current we only handle the command which keys may across multi partitions and the
-		// response is all the same. So if the response order is need for keys, we can not handle
-		// it as simple merged keys. Maybe need to do in sdk.
+		// the keys may across multi partitions, the keys will be dispatched to each partition and
+		// the response for each key will be reassembled in the same order as the keys.
 		s.doMergeKeysCommand(conn, cmdName, cmd)
 	} else {
 		conn.WriteError("not supported merge command " + string(cmdName))
 	}
 }
 
-// return merge func, command, haswrite, err
+// the keys of the merged command are split by partition and each partition has its own command.
+// keyIndexes hold the index of the keys in the original command for each partition command, and
+// the keys which can not be handled in the partition (such as no leader) will be saved in keyErrs
+// so that the other keys can still be handled.
+type mergeKeysHandlers struct {
+	handlers   []common.MergeCommandFunc
+	cmds       []redcon.Command
+	keyIndexes [][]int
+	keyErrs    map[int]error
+	hasWrite   bool
+}
+
+func isKVPairsMergeCommand(cmdName string) bool {
+	return cmdName == "plset" || cmdName == "mset"
+}
+
 func (s *Server) getHandlersForKeys(cmdName string,
-	origArgs [][]byte) ([]common.MergeCommandFunc, []redcon.Command, bool, error) {
+	origArgs [][]byte) (*mergeKeysHandlers, error) {
 	cmdArgMap := make(map[string][][]byte)
 	handlerMap := make(map[string]common.MergeCommandFunc)
+	keyIndexMap := make(map[string][]int)
+	tableMap := make(map[string][]string)
+	nodeMap := make(map[string]*node.KVNode)
+	mh := &mergeKeysHandlers{
+		keyErrs: make(map[int]error),
+	}
 	var namespace string
-	hasWrite := false
 	hasRead := false
 	origKeys := origArgs
 	var vals [][]byte
-	if cmdName == "plset" {
+	if isKVPairsMergeCommand(cmdName) {
 		// for command which args is [key val key val]
 		if sLog.Level() >= common.LOG_DETAIL {
-			sLog.Debugf("merge plset command %v", origArgs)
+			sLog.Debugf("merge %v command %v", cmdName, origArgs)
+		}
+		if len(origArgs)%2 != 0 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", cmdName)
 		}
 		origKeys = make([][]byte, 0, len(origArgs)/2)
 		vals = make([][]byte, 0, len(origArgs)/2)
@@ -97,10 +118,10 @@ func (s *Server) getHandlersForKeys(cmdName string,
 		ns, realKey, err := common.ExtractNamesapce(arg)
 		if err != nil {
 			sLog.Infof("failed to get the namespace for key:%v", string(arg))
-			return nil, nil, hasWrite, err
+			return nil, err
 		}
 		if namespace != "" && ns != namespace {
-			return nil, nil, hasWrite, common.ErrInvalidArgs
+			return nil, common.ErrInvalidArgs
 		}
 		if namespace == "" {
 			namespace = ns
@@ -108,28 +129,29 @@ func (s *Server) getHandlersForKeys(cmdName string,
 		nsNode, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(ns, realKey)
 		if err != nil {
 			sLog.Infof("failed to get the namespace %s node for pk key:%v, rawkey: %v", ns, string(realKey), string(arg))
-			return nil, nil, hasWrite, err
+			mh.keyErrs[kindex] = err
+			continue
 		}
 		f, isWrite, ok := nsNode.Node.GetMergeHandler(cmdName)
 		if !ok {
-			return nil, nil, hasWrite, errInvalidCommand
+			return nil, errInvalidCommand
 		}
 		if isWrite {
-			hasWrite = true
+			mh.hasWrite = true
 		} else {
 			hasRead = true
 		}
-		if hasWrite && hasRead {
+		if mh.hasWrite && hasRead {
 			// never happen
-			return nil, nil, false, errInvalidCommand
+			return nil, errInvalidCommand
 		}
 		if nsNode.Node.IsStopping() {
-			return nil, nil, false, common.ErrStopped
-		}
-		if !isWrite && !nsNode.Node.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) {
-			// read only to leader to avoid stale read
-			return nil, nil, hasWrite, node.ErrNamespaceNotLeader
+			mh.keyErrs[kindex] = common.ErrStopped
+			continue
 		}
+		table, _, _ := common.ExtractTable(realKey)
+		tableMap[nsNode.FullName()] = append(tableMap[nsNode.FullName()], string(table))
+		nodeMap[nsNode.FullName()] = nsNode.Node
 		handlerMap[nsNode.FullName()] = f
 		cmdArgs, ok := cmdArgMap[nsNode.FullName()]
 		if !ok {
@@ -137,19 +159,98 @@ func (s *Server) getHandlersForKeys(cmdName string,
 			cmdArgs = append(cmdArgs, []byte(cmdName))
 		}
 		cmdArgs = append(cmdArgs, arg)
-		if cmdName == "plset" {
+		if isKVPairsMergeCommand(cmdName) {
 			cmdArgs = append(cmdArgs, vals[kindex])
 		}
 		cmdArgMap[nsNode.FullName()] = cmdArgs
+		keyIndexMap[nsNode.FullName()] = append(keyIndexMap[nsNode.FullName()], kindex)
 	}
 
-	handlers := make([]common.MergeCommandFunc, 0, len(handlerMap))
-	cmds := make([]redcon.Command, 0, len(handlerMap))
+	// the read index and the quota is checked once for each partition
+	if !mh.hasWrite {
+		for name, err := range checkReadOnNodes(nodeMap) {
+			for _, kindex := range keyIndexMap[name] {
+				mh.keyErrs[kindex] = err
+			}
+			delete(handlerMap, name)
+		}
+	}
+	for name, tables := range tableMap {
+		if _, ok := handlerMap[name]; !ok {
+			continue
+		}
+		if err := nodeMap[name].CheckMultiQuota([]string{cmdName}, tables, mh.hasWrite); err != nil {
+			for _, kindex := range keyIndexMap[name] {
+				mh.keyErrs[kindex] = err
+			}
+			delete(handlerMap, name)
+		}
+	}
+
+	mh.handlers = make([]common.MergeCommandFunc, 0, len(handlerMap))
+	mh.cmds = make([]redcon.Command, 0, len(handlerMap))
+	mh.keyIndexes = make([][]int, 0, len(handlerMap))
 	for name, handler := range handlerMap {
-		handlers = append(handlers, handler)
-		cmds = append(cmds, buildCommand(cmdArgMap[name]))
+		mh.handlers = append(mh.handlers, handler)
+		mh.cmds = append(mh.cmds, buildCommand(cmdArgMap[name]))
+		mh.keyIndexes = append(mh.keyIndexes, keyIndexMap[name])
+	}
+	return mh, nil
+}
+
+// dispatch the keys to the partitions in parallel and return the response for each key in the
+// original order and the responses for each partition. For mget the response for the key is the value or error,
+// for sinter, sunion and sdiff the response for the key is the members, and for the others the response is the partition response for all the keys in the same partition.
+// The error response for the key will be returned if the partition of the key failed.
+func (s *Server) dispatchAndWaitMergeKeysCmd(cmdName string, cmd redcon.Command) ([]interface{}, []interface{}, error) {
+	mh, err := s.getHandlersForKeys(cmdName, cmd.Args[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if mh.hasWrite && node.IsSyncerOnly() {
+		err = fmt.Errorf("The cluster is only allowing syncer write : ERR handle command " + string(cmd.Args[0]))
+		return nil, nil, err
+	}
+	keyNum := len(cmd.Args) - 1
+	if isKVPairsMergeCommand(cmdName) {
+		keyNum = keyNum / 2
+	}
+	keyRsps := make([]interface{}, keyNum)
+	for i, err := range mh.keyErrs {
+		keyRsps[i] = err
+	}
+	if len(mh.handlers) == 0 {
+		return keyRsps, nil, nil
+	}
+	results := dispatchHandlersAndWait(cmdName, mh.handlers, mh.cmds, true)
+	for i, ret := range results {
+		vals, isMget := ret.([]interface{})
+		sets, isSets := ret.([][][]byte)
+		for j, kindex := range mh.keyIndexes[i] {
+			if isMget && j < len(vals) {
+				keyRsps[kindex] = vals[j]
+			} else if isSets && j < len(sets) {
+				keyRsps[kindex] = sets[j]
+			} else {
+				keyRsps[kindex] = ret
+			}
+		}
+	}
+	return keyRsps, results, nil
+}
+
+func writeMergeKeysErr(conn redcon.Conn, cmdName string, cmd redcon.Command, keyRsps []interface{}, succ int64) {
+	failed := make([]string, 0)
+	step := 1
+	if isKVPairsMergeCommand(cmdName) {
+		step = 2
+	}
+	for i, ret := range keyRsps {
+		if err, ok := ret.(error); ok {
+			failed = append(failed, string(cmd.Args[1+i*step])+": "+err.Error())
+		}
 	}
-	return handlers, cmds, hasWrite, nil
+	conn.WriteError(fmt.Sprintf("ERR partial failed, succeeded: %v, failed keys: %v", succ, strings.Join(failed, "; ")))
 }
 
 func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon.Command) {
@@ -159,14 +260,14 @@ func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon
 		return
 	}
 
-	cmds, results, err := s.dispatchAndWaitMergeCmd(cmd)
+	keyRsps, results, err := s.dispatchAndWaitMergeKeysCmd(cmdName, cmd)
 	if err != nil {
 		sLog.Infof("merge command %v error:%v", string(cmd.Raw), err.Error())
 		conn.WriteError(err.Error())
 		return
 	}
 	if sLog.Level() >= common.LOG_DETAIL {
-		sLog.Debugf("merge command return %v", results)
+		sLog.Debugf("merge command return %v", keyRsps)
 	}
 	switch cmdName {
 	case "exists", "del":
@@ -176,21 +277,78 @@ func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon
 				cnt += v
 			}
 		}
+		hasErr := false
+		for _, ret := range keyRsps {
+			if _, ok := ret.(error); ok {
+				hasErr = true
+				break
+			}
+		}
+		if hasErr {
+			writeMergeKeysErr(conn, cmdName, cmd, keyRsps, cnt)
+			return
+		}
 		conn.WriteInt64(cnt)
 		return
+	case "mset":
+		succ := int64(0)
+		for _, ret := range keyRsps {
+			if _, ok := ret.(error); !ok {
+				succ++
+			}
+		}
+		if succ != int64(len(keyRsps)) {
+			writeMergeKeysErr(conn, cmdName, cmd, keyRsps, succ)
+			return
+		}
+		conn.WriteString("OK")
+		return
 	case "plset":
-		for i, ret := range results {
+		conn.WriteArray(len(keyRsps))
+		for _, ret := range keyRsps {
 			if err, ok := ret.(error); ok {
-				for ci := 1; ci < len(cmds[i].Args); ci += 2 {
-					conn.WriteError("ERR :" + err.Error())
-				}
+				conn.WriteError("ERR :" + err.Error())
 			} else {
-				for ci := 1; ci < len(cmds[i].Args); ci += 2 {
-					conn.WriteString("OK")
+				conn.WriteString("OK")
+			}
+		}
+		return
+	case "mget":
+		conn.WriteArray(len(keyRsps))
+		for _, ret := range keyRsps {
+			switch v := ret.(type) {
+			case error:
+				conn.WriteError("ERR :" + v.Error())
+			case []byte:
+				if v == nil {
+					conn.WriteNull()
+				} else {
+					conn.WriteBulk(v)
 				}
+			default:
+				conn.WriteNull()
 			}
 		}
 		return
+	case "sinter", "sunion", "sdiff":
+		sets := make([][][]byte, 0, len(keyRsps))
+		for _, ret := range keyRsps {
+			switch v := ret.(type) {
+			case error:
+				conn.WriteError("ERR :" + v.Error())
+				return
+			case [][]byte:
+				sets = append(sets, v)
+			default:
+				sets = append(sets, nil)
+			}
+		}
+		members := common.MergeSets(cmdName, sets)
+		conn.WriteArray(len(members))
+		for _, m := range members {
+			conn.WriteBulk(m)
+		}
+		return
 	default:
 		sLog.Infof("merge command error:%v", cmdName)
 		conn.WriteError(errInvalidCommand.Error())
@@ -241,11 +399,14 @@ func (s *Server) GetMergeHandlers(cmd redcon.Command) (bool, []common.MergeComma
 			return hasWrite, nil, nil, false, err
 		}
 	} else if common.IsMergeKeysCommand(cmdName) {
-		h, cmds, w, err := s.getHandlersForKeys(cmdName, cmd.Args[1:])
-		if w {
-			hasWrite = true
+		mh, err := s.getHandlersForKeys(cmdName, cmd.Args[1:])
+		if err != nil {
+			return hasWrite, nil, nil, true, err
+		}
+		for _, kerr := range mh.keyErrs {
+			return mh.hasWrite, nil, nil, true, kerr
 		}
-		return hasWrite, h, cmds, true, err
+		return mh.hasWrite, mh.handlers, mh.cmds, true, nil
 	} else {
 		cmds = make(map[string]redcon.Command)
 		for k := range nodes {
@@ -257,6 +418,15 @@ func (s *Server) GetMergeHandlers(cmd redcon.Command) (bool, []common.MergeComma
 	var handlers []common.MergeCommandFunc
 	var commands []redcon.Command
 	needConcurrent := true
+	readNodes := make(map[string]*node.KVNode)
+	for k, v := range nodes {
+		if _, isWrite, ok := v.Node.GetMergeHandler(cmdName); ok && !isWrite {
+			readNodes[k] = v.Node
+		}
+	}
+	for _, err := range checkReadOnNodes(readNodes) {
+		return hasWrite, nil, nil, needConcurrent, err
+	}
 	for k, v := range nodes {
 		newCmd := cmds[k]
 		h, isWrite, ok := v.Node.GetMergeHandler(cmdName)
@@ -264,10 +434,6 @@ func (s *Server) GetMergeHandlers(cmd redcon.Command) (bool, []common.MergeComma
 			if isWrite {
 				hasWrite = true
 			}
-			if !isWrite && !v.Node.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) {
-				// read only to leader to avoid stale read
-				return hasWrite, nil, nil, needConcurrent, node.ErrNamespaceNotLeader
-			}
 			if v.Node.IsStopping() {
 				return hasWrite, nil, nil, needConcurrent, common.ErrStopped
 			}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+var (
+	errMultiNested         = errors.New("ERR MULTI calls can not be nested")
+	errExecWithoutMulti    = errors.New("ERR EXEC without MULTI")
+	errDiscardWithoutMulti = errors.New("ERR DISCARD without MULTI")
+	errWatchInsideMulti    = errors.New("ERR WATCH inside MULTI is not allowed")
+	errExecAbort           = errors.New("EXECABORT Transaction discarded because of previous errors.")
+	errMultiCrossPartition = errors.New("ERR all the keys in the transaction should be in the same partition")
+)
+
+// the transaction state for the redis connection
+type multiExecState struct {
+	inMulti    bool
+	queueErr   bool
+	cmds       []redcon.Command
+	watchKeys  [][]byte
+	watchVers  []int64
+	watchedMap map[string]bool
+}
+
+func (ms *multiExecState) reset() {
+	ms.inMulti = false
+	ms.queueErr = false
+	ms.cmds = nil
+	ms.unwatch()
+}
+
+func (ms *multiExecState) unwatch() {
+	ms.watchKeys = nil
+	ms.watchVers = nil
+	ms.watchedMap = nil
+}
+
+// check if the command should be handled by the transaction, return true if handled
+func (s *Server) handleMultiExecState(conn redcon.Conn, cmdName string, cmd redcon.Command) bool {
+	switch cmdName {
+	case "multi", "exec", "discard", "watch", "unwatch":
+	default:
+		ctx, ok := conn.Context().(*redisConnCtx)
+		if !ok || !ctx.txn.inMulti || cmdName == "quit" {
+			return false
+		}
+	}
+	authUser, err := s.checkConnAuthed(conn)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return true
+	}
+	ctx := getRedisConnCtx(conn)
+	txn := &ctx.txn
+	switch cmdName {
+	case "multi":
+		if txn.inMulti {
+			conn.WriteError(errMultiNested.Error())
+			return true
+		}
+		txn.inMulti = true
+		conn.WriteString("OK")
+	case "discard":
+		if !txn.inMulti {
+			conn.WriteError(errDiscardWithoutMulti.Error())
+			return true
+		}
+		txn.reset()
+		conn.WriteString("OK")
+	case "watch":
+		if txn.inMulti {
+			conn.WriteError(errWatchInsideMulti.Error())
+			return true
+		}
+		if len(cmd.Args) < 2 {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return true
+		}
+		if err := checkUserAccessKeys(authUser, cmd.Args[1:], false); err != nil {
+			conn.WriteError(err.Error())
+			return true
+		}
+		if err := s.watchKeys(txn, cmd.Args[1:]); err != nil {
+			conn.WriteError(err.Error())
+			return true
+		}
+		conn.WriteString("OK")
+	case "unwatch":
+		// unwatch inside multi is ignored, the watched keys will be cleared after exec
+		if !txn.inMulti {
+			txn.unwatch()
+		}
+		conn.WriteString("OK")
+	case "exec":
+		if !txn.inMulti {
+			conn.WriteError(errExecWithoutMulti.Error())
+			return true
+		}
+		s.doExec(conn, authUser, txn)
+		txn.reset()
+	default:
+		s.queueMultiCmd(conn, authUser, txn, cmdName, cmd)
+	}
+	return true
+}
+
+// record the current versions of the keys, the transaction will be aborted if any version
+// is changed while exec.
+func (s *Server) watchKeys(txn *multiExecState, keys [][]byte) error {
+	vers := make([]int64, len(keys))
+	for i, k := range keys {
+		ns, pk, err := common.ExtractNamesapce(k)
+		if err != nil {
+			return err
+		}
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(ns, pk)
+		if err != nil {
+			return err
+		}
+		vers[i], err = n.Node.GetWatchVersion(k)
+		if err != nil {
+			return err
+		}
+	}
+	if txn.watchedMap == nil {
+		txn.watchedMap = make(map[string]bool)
+	}
+	for i, k := range keys {
+		if txn.watchedMap[string(k)] {
+			continue
+		}
+		txn.watchedMap[string(k)] = true
+		txn.watchKeys = append(txn.watchKeys, append([]byte(nil), k...))
+		txn.watchVers = append(txn.watchVers, vers[i])
+	}
+	return nil
+}
+
+func (s *Server) queueMultiCmd(conn redcon.Conn, authUser *common.AuthUser, txn *multiExecState,
+	cmdName string, cmd redcon.Command) {
+	_, err := s.checkMultiCmd(authUser, cmdName, cmd)
+	if err != nil {
+		// the transaction will be discarded while exec
+		txn.queueErr = true
+		conn.WriteError(err.Error() + " : ERR handle command " + string(cmd.Args[0]))
+		return
+	}
+	// the command buffer will be reused by the connection, so we need copy it
+	qcmd, err := redcon.Parse(append([]byte(nil), cmd.Raw...))
+	if err != nil {
+		txn.queueErr = true
+		conn.WriteError(err.Error())
+		return
+	}
+	txn.cmds = append(txn.cmds, qcmd)
+	conn.WriteString("QUEUED")
+}
+
+// only the write commands can be queued, and the user should have write access for all the keys
+func (s *Server) checkMultiCmd(authUser *common.AuthUser, cmdName string, cmd redcon.Command) (*node.KVNode, error) {
+	ns, pk, pkSum, err := GetPKAndHashSum(cmdName, cmd)
+	if err != nil {
+		return nil, err
+	}
+	kvn, err := s.GetHandleNode(ns, pk, pkSum, cmdName, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if !kvn.IsMultiExecCmd(cmdName) {
+		return nil, common.ErrInvalidCommand
+	}
+	if err := node.CheckActiveActiveCmd(cmdName); err != nil {
+		return nil, err
+	}
+	if err := checkUserAccessKeys(authUser, node.WriteKeys(cmdName, cmd), true); err != nil {
+		return nil, err
+	}
+	return kvn, nil
+}
+
+func (s *Server) doExec(conn redcon.Conn, authUser *common.AuthUser, txn *multiExecState) {
+	if txn.queueErr {
+		conn.WriteError(errExecAbort.Error())
+		return
+	}
+	if len(txn.cmds) == 0 {
+		conn.WriteArray(0)
+		return
+	}
+	if node.IsSyncerOnly() {
+		conn.WriteError("The cluster is only allowing syncer write : ERR handle command exec")
+		return
+	}
+	// the partition may be changed after queued, so we check again before exec
+	var kvn *node.KVNode
+	cmdNames := make([]string, 0, len(txn.cmds))
+	tables := make([]string, 0, len(txn.cmds))
+	for _, cmd := range txn.cmds {
+		cmdName := qcmdlower(cmd.Args[0])
+		n, err := s.checkMultiCmd(authUser, cmdName, cmd)
+		if err != nil {
+			conn.WriteError(err.Error() + " : ERR handle command " + string(cmd.Args[0]))
+			return
+		}
+		cmdNames = append(cmdNames, cmdName)
+		for _, k := range node.WriteKeys(cmdName, cmd) {
+			if err := s.checkSameMultiExecNode(n, k); err != nil {
+				conn.WriteError(err.Error())
+				return
+			}
+			_, pk, _ := common.ExtractNamesapce(k)
+			table, _, _ := common.ExtractTable(pk)
+			tables = append(tables, string(table))
+		}
+		if kvn == nil {
+			kvn = n
+		} else if kvn != n {
+			conn.WriteError(errMultiCrossPartition.Error())
+			return
+		}
+	}
+	for _, k := range txn.watchKeys {
+		if err := s.checkSameMultiExecNode(kvn, k); err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	if !kvn.IsLead() {
+		conn.WriteError(node.ErrNamespaceNotLeader.Error())
+		return
+	}
+	// the transaction is one write on the partition for the quota
+	if err := kvn.CheckMultiQuota(cmdNames, tables, true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	start := time.Now()
+	rsp, err := kvn.MultiExec(txn.watchKeys, txn.watchVers, txn.cmds)
+	var v interface{}
+	if err == nil {
+		v, err = rsp.WaitRsp()
+	}
+	cost := time.Since(start)
+	kvn.UpdateWriteStats(0, cost.Microseconds())
+	if cost >= slowClusterWriteLogTime {
+		sLog.Infof("slow multi exec with %v commands cost %v", len(txn.cmds), cost)
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	rsps, ok := v.([]interface{})
+	if !ok {
+		// aborted since the watched keys changed
+		conn.WriteArray(-1)
+		return
+	}
+	conn.WriteArray(len(rsps))
+	for _, r := range rsps {
+		writeRedisRsp(conn, r)
+	}
+}
+
+func (s *Server) checkSameMultiExecNode(kvn *node.KVNode, key []byte) error {
+	ns, pk, err := common.ExtractNamesapce(key)
+	if err != nil {
+		return err
+	}
+	n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, node.HashedKey(pk))
+	if err != nil {
+		return err
+	}
+	if n.Node != kvn {
+		return errMultiCrossPartition
+	}
+	return nil
+}
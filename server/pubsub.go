@@ -0,0 +1,589 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/absolute8511/redcon"
+	"github.com/gobwas/glob"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const (
+	pubSubConnBufSize     = 1024
+	keyspaceChannelPrefix = "__keyspace@"
+	keyeventChannelPrefix = "__keyevent@"
+)
+
+var (
+	errPubSubContext   = errors.New("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+	errReservedChannel = errors.New("ERR the keyspace notification channel is reserved")
+	errChannelNoNS     = errors.New("ERR the channel should be prefixed with the namespace while auth is enabled")
+)
+
+type pubSubMsg struct {
+	kind    string
+	pattern string
+	channel string
+	data    []byte
+	count   int
+}
+
+// pubSubConn is the detached redis connection in the subscribe mode, all the
+// replies and messages are written in the writer goroutine in order.
+type pubSubConn struct {
+	dconn     redcon.DetachedConn
+	authUser  string
+	msgC      chan *pubSubMsg
+	closeC    chan struct{}
+	closeOnce sync.Once
+	// changed only in the reader goroutine while holding the hub lock
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func newPubSubConn(dconn redcon.DetachedConn, authUser string) *pubSubConn {
+	return &pubSubConn{
+		dconn:    dconn,
+		authUser: authUser,
+		msgC:     make(chan *pubSubMsg, pubSubConnBufSize),
+		closeC:   make(chan struct{}),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func (psc *pubSubConn) close() {
+	psc.closeOnce.Do(func() {
+		close(psc.closeC)
+		psc.dconn.Close()
+	})
+}
+
+func (psc *pubSubConn) subCount() int {
+	return len(psc.channels) + len(psc.patterns)
+}
+
+// send the message without blocking, the slow subscriber will be closed if the buffer is full
+func (psc *pubSubConn) send(msg *pubSubMsg) bool {
+	select {
+	case psc.msgC <- msg:
+		return true
+	case <-psc.closeC:
+		return false
+	default:
+		sLog.Infof("pubsub connection %v closed since the output buffer is full", psc.dconn.RemoteAddr())
+		psc.close()
+		return false
+	}
+}
+
+func (psc *pubSubConn) writeMsg(msg *pubSubMsg) {
+	switch msg.kind {
+	case "error":
+		psc.dconn.WriteError(string(msg.data))
+	case "ok":
+		psc.dconn.WriteString("OK")
+	case "pong":
+		psc.dconn.WriteArray(2)
+		psc.dconn.WriteBulkString("pong")
+		psc.dconn.WriteBulk(msg.data)
+	case "message":
+		psc.dconn.WriteArray(3)
+		psc.dconn.WriteBulkString(msg.kind)
+		psc.dconn.WriteBulkString(msg.channel)
+		psc.dconn.WriteBulk(msg.data)
+	case "pmessage":
+		psc.dconn.WriteArray(4)
+		psc.dconn.WriteBulkString(msg.kind)
+		psc.dconn.WriteBulkString(msg.pattern)
+		psc.dconn.WriteBulkString(msg.channel)
+		psc.dconn.WriteBulk(msg.data)
+	default:
+		// the reply for (un)subscribe
+		psc.dconn.WriteArray(3)
+		psc.dconn.WriteBulkString(msg.kind)
+		if msg.channel == "" {
+			psc.dconn.WriteNull()
+		} else {
+			psc.dconn.WriteBulkString(msg.channel)
+		}
+		psc.dconn.WriteInt(msg.count)
+	}
+}
+
+func (psc *pubSubConn) writeLoop() {
+	defer psc.close()
+	for {
+		select {
+		case msg := <-psc.msgC:
+			psc.writeMsg(msg)
+			if len(psc.msgC) > 0 {
+				continue
+			}
+			if err := psc.dconn.Flush(); err != nil {
+				return
+			}
+		case <-psc.closeC:
+			return
+		}
+	}
+}
+
+type pubSubPattern struct {
+	g     glob.Glob
+	conns map[*pubSubConn]struct{}
+}
+
+type pubSubHub struct {
+	sync.RWMutex
+	channels map[string]map[*pubSubConn]struct{}
+	patterns map[string]*pubSubPattern
+	conns    map[*pubSubConn]struct{}
+	// the number of all the subscriptions, used to ignore the publish quickly
+	subCnt int64
+}
+
+func newPubSubHub() *pubSubHub {
+	return &pubSubHub{
+		channels: make(map[string]map[*pubSubConn]struct{}),
+		patterns: make(map[string]*pubSubPattern),
+		conns:    make(map[*pubSubConn]struct{}),
+	}
+}
+
+func (h *pubSubHub) hasSubscribers() bool {
+	return atomic.LoadInt64(&h.subCnt) > 0
+}
+
+func (h *pubSubHub) addConn(psc *pubSubConn) {
+	h.Lock()
+	h.conns[psc] = struct{}{}
+	h.Unlock()
+}
+
+func (h *pubSubHub) subscribe(psc *pubSubConn, channel string) int {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := psc.channels[channel]; !ok {
+		conns, ok := h.channels[channel]
+		if !ok {
+			conns = make(map[*pubSubConn]struct{})
+			h.channels[channel] = conns
+		}
+		conns[psc] = struct{}{}
+		psc.channels[channel] = struct{}{}
+		atomic.AddInt64(&h.subCnt, 1)
+	}
+	return psc.subCount()
+}
+
+func (h *pubSubHub) unsubscribe(psc *pubSubConn, channel string) int {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := psc.channels[channel]; ok {
+		delete(psc.channels, channel)
+		conns := h.channels[channel]
+		delete(conns, psc)
+		if len(conns) == 0 {
+			delete(h.channels, channel)
+		}
+		atomic.AddInt64(&h.subCnt, -1)
+	}
+	return psc.subCount()
+}
+
+func (h *pubSubHub) psubscribe(psc *pubSubConn, pattern string) (int, error) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := psc.patterns[pattern]; !ok {
+		p, ok := h.patterns[pattern]
+		if !ok {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return psc.subCount(), err
+			}
+			p = &pubSubPattern{g: g, conns: make(map[*pubSubConn]struct{})}
+			h.patterns[pattern] = p
+		}
+		p.conns[psc] = struct{}{}
+		psc.patterns[pattern] = struct{}{}
+		atomic.AddInt64(&h.subCnt, 1)
+	}
+	return psc.subCount(), nil
+}
+
+func (h *pubSubHub) punsubscribe(psc *pubSubConn, pattern string) int {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := psc.patterns[pattern]; ok {
+		delete(psc.patterns, pattern)
+		if p, ok := h.patterns[pattern]; ok {
+			delete(p.conns, psc)
+			if len(p.conns) == 0 {
+				delete(h.patterns, pattern)
+			}
+		}
+		atomic.AddInt64(&h.subCnt, -1)
+	}
+	return psc.subCount()
+}
+
+func (h *pubSubHub) removeConn(psc *pubSubConn) {
+	h.Lock()
+	defer h.Unlock()
+	for ch := range psc.channels {
+		conns := h.channels[ch]
+		delete(conns, psc)
+		if len(conns) == 0 {
+			delete(h.channels, ch)
+		}
+		atomic.AddInt64(&h.subCnt, -1)
+	}
+	for pattern := range psc.patterns {
+		if p, ok := h.patterns[pattern]; ok {
+			delete(p.conns, psc)
+			if len(p.conns) == 0 {
+				delete(h.patterns, pattern)
+			}
+		}
+		atomic.AddInt64(&h.subCnt, -1)
+	}
+	psc.channels = make(map[string]struct{})
+	psc.patterns = make(map[string]struct{})
+	delete(h.conns, psc)
+}
+
+func (h *pubSubHub) closeAll() {
+	h.RLock()
+	conns := make([]*pubSubConn, 0, len(h.conns))
+	for psc := range h.conns {
+		conns = append(conns, psc)
+	}
+	h.RUnlock()
+	for _, psc := range conns {
+		psc.close()
+	}
+}
+
+// publish the message to the local subscribers, return the number of the receivers.
+// The filter is used to check if the subscriber is allowed to receive the message.
+func (h *pubSubHub) publish(channel string, data []byte, filter func(*pubSubConn) bool) int {
+	if !h.hasSubscribers() {
+		return 0
+	}
+	cnt := 0
+	h.RLock()
+	defer h.RUnlock()
+	for psc := range h.channels[channel] {
+		if filter != nil && !filter(psc) {
+			continue
+		}
+		if psc.send(&pubSubMsg{kind: "message", channel: channel, data: data}) {
+			cnt++
+		}
+	}
+	for pattern, p := range h.patterns {
+		if !p.g.Match(channel) {
+			continue
+		}
+		for psc := range p.conns {
+			if filter != nil && !filter(psc) {
+				continue
+			}
+			if psc.send(&pubSubMsg{kind: "pmessage", pattern: pattern, channel: channel, data: data}) {
+				cnt++
+			}
+		}
+	}
+	return cnt
+}
+
+func (h *pubSubHub) getChannels(pattern string) ([]string, error) {
+	var g glob.Glob
+	if pattern != "" {
+		var err error
+		g, err = glob.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h.RLock()
+	defer h.RUnlock()
+	chs := make([]string, 0, len(h.channels))
+	for ch := range h.channels {
+		if g == nil || g.Match(ch) {
+			chs = append(chs, ch)
+		}
+	}
+	return chs, nil
+}
+
+func (h *pubSubHub) numSub(channel string) int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.channels[channel])
+}
+
+func (h *pubSubHub) numPat() int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.patterns)
+}
+
+func isKeyspaceChannel(ch string) bool {
+	return strings.HasPrefix(ch, keyspaceChannelPrefix) || strings.HasPrefix(ch, keyeventChannelPrefix)
+}
+
+// the channel is prefixed with the namespace as the key, and the part after the namespace
+// is matched as the table in the acl. The keyspace channels are checked for each message
+// while publishing, since the key in the channel is known only at that time.
+func checkChannelAccess(u *common.AuthUser, ch string, isPattern bool, isWrite bool) error {
+	if u == nil || isKeyspaceChannel(ch) {
+		return nil
+	}
+	ns, table, err := extractNsAndTable([]byte(ch))
+	if err != nil {
+		return errChannelNoNS
+	}
+	if isPattern {
+		// the glob in the namespace may match the channels in any namespace
+		if strings.ContainsAny(ns, `*?[]{}\`) {
+			return errChannelNoNS
+		}
+		if strings.ContainsAny(table, `*?[]{}\`) {
+			table = ""
+		}
+	}
+	return u.CheckAccess(ns, table, isWrite)
+}
+
+// the message is published to the local subscribers and forwarded to the other nodes, the
+// number of the local receivers is returned as redis cluster.
+func (s *Server) doPublish(conn redcon.Conn, authUser *common.AuthUser, cmd redcon.Command) {
+	if len(cmd.Args) != 3 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	// the keyspace notification can only be published by the server
+	ch := string(cmd.Args[1])
+	if isKeyspaceChannel(ch) {
+		conn.WriteError(errReservedChannel.Error())
+		return
+	}
+	if err := checkChannelAccess(authUser, ch, false, true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	data := append([]byte{}, cmd.Args[2]...)
+	n := s.pubSub.publish(ch, data, nil)
+	s.forwardPubSub(&pubSubForwardMsg{Channel: ch, Data: data})
+	conn.WriteInt(n)
+}
+
+func (s *Server) doPubSubInfo(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 2 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	switch qcmdlower(cmd.Args[1]) {
+	case "channels":
+		pattern := ""
+		if len(cmd.Args) > 2 {
+			pattern = string(cmd.Args[2])
+		}
+		chs, err := s.pubSub.getChannels(pattern)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteArray(len(chs))
+		for _, ch := range chs {
+			conn.WriteBulkString(ch)
+		}
+	case "numsub":
+		conn.WriteArray((len(cmd.Args) - 2) * 2)
+		for _, ch := range cmd.Args[2:] {
+			conn.WriteBulk(ch)
+			conn.WriteInt(s.pubSub.numSub(string(ch)))
+		}
+	case "numpat":
+		conn.WriteInt(s.pubSub.numPat())
+	default:
+		conn.WriteError(errInvalidCommand.Error())
+	}
+}
+
+// switch the connection to the subscribe mode, the connection will be detached from
+// the redis server loop and can only be used for pub/sub after that.
+func (s *Server) doSubscribe(conn redcon.Conn, cmd redcon.Command) {
+	authUser := ""
+	if ctx, ok := conn.Context().(*redisConnCtx); ok {
+		authUser = ctx.authUser
+	}
+	psc := newPubSubConn(conn.Detach(), authUser)
+	s.pubSub.addConn(psc)
+	go psc.writeLoop()
+	go s.servePubSubConn(psc, cmd)
+}
+
+func (s *Server) servePubSubConn(psc *pubSubConn, cmd redcon.Command) {
+	defer func() {
+		s.pubSub.removeConn(psc)
+		psc.close()
+	}()
+	for {
+		if !s.handlePubSubCmd(psc, cmd) {
+			return
+		}
+		var err error
+		cmd, err = psc.dconn.ReadCommand()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handlePubSubCmd(psc *pubSubConn, cmd redcon.Command) bool {
+	cmdName := qcmdlower(cmd.Args[0])
+	switch cmdName {
+	case "subscribe":
+		if len(cmd.Args) < 2 {
+			return psc.send(&pubSubMsg{kind: "error", data: []byte(common.ErrInvalidArgs.Error())})
+		}
+		u, err := s.getPubSubUser(psc)
+		if err != nil {
+			return psc.send(&pubSubMsg{kind: "error", data: []byte(err.Error())})
+		}
+		for _, ch := range cmd.Args[1:] {
+			if err := checkChannelAccess(u, string(ch), false, false); err != nil {
+				psc.send(&pubSubMsg{kind: "error", data: []byte(err.Error())})
+				continue
+			}
+			n := s.pubSub.subscribe(psc, string(ch))
+			psc.send(&pubSubMsg{kind: cmdName, channel: string(ch), count: n})
+		}
+	case "psubscribe":
+		if len(cmd.Args) < 2 {
+			return psc.send(&pubSubMsg{kind: "error", data: []byte(common.ErrInvalidArgs.Error())})
+		}
+		u, err := s.getPubSubUser(psc)
+		if err != nil {
+			return psc.send(&pubSubMsg{kind: "error", data: []byte(err.Error())})
+		}
+		for _, p := range cmd.Args[1:] {
+			if err := checkChannelAccess(u, string(p), true, false); err != nil {
+				psc.send(&pubSubMsg{kind: "error", data: []byte(err.Error())})
+				continue
+			}
+			n, err := s.pubSub.psubscribe(psc, string(p))
+			if err != nil {
+				psc.send(&pubSubMsg{kind: "error", data: []byte("ERR invalid pattern: " + err.Error())})
+				continue
+			}
+			psc.send(&pubSubMsg{kind: cmdName, channel: string(p), count: n})
+		}
+	case "unsubscribe":
+		chs := make([]string, 0, len(cmd.Args))
+		for _, ch := range cmd.Args[1:] {
+			chs = append(chs, string(ch))
+		}
+		if len(chs) == 0 {
+			s.pubSub.RLock()
+			for ch := range psc.channels {
+				chs = append(chs, ch)
+			}
+			s.pubSub.RUnlock()
+		}
+		if len(chs) == 0 {
+			psc.send(&pubSubMsg{kind: cmdName, count: psc.subCount()})
+		}
+		for _, ch := range chs {
+			n := s.pubSub.unsubscribe(psc, ch)
+			psc.send(&pubSubMsg{kind: cmdName, channel: ch, count: n})
+		}
+	case "punsubscribe":
+		patterns := make([]string, 0, len(cmd.Args))
+		for _, p := range cmd.Args[1:] {
+			patterns = append(patterns, string(p))
+		}
+		if len(patterns) == 0 {
+			s.pubSub.RLock()
+			for p := range psc.patterns {
+				patterns = append(patterns, p)
+			}
+			s.pubSub.RUnlock()
+		}
+		if len(patterns) == 0 {
+			psc.send(&pubSubMsg{kind: cmdName, count: psc.subCount()})
+		}
+		for _, p := range patterns {
+			n := s.pubSub.punsubscribe(psc, p)
+			psc.send(&pubSubMsg{kind: cmdName, channel: p, count: n})
+		}
+	case "ping":
+		var data []byte
+		if len(cmd.Args) > 1 {
+			data = append(data, cmd.Args[1]...)
+		}
+		return psc.send(&pubSubMsg{kind: "pong", data: data})
+	case "quit":
+		psc.send(&pubSubMsg{kind: "ok"})
+		return false
+	default:
+		return psc.send(&pubSubMsg{kind: "error", data: []byte(errPubSubContext.Error())})
+	}
+	return true
+}
+
+// return the authed user of the subscriber, nil if auth is disabled
+func (s *Server) getPubSubUser(psc *pubSubConn) (*common.AuthUser, error) {
+	info := s.getAuthInfo()
+	if info == nil || !info.Enabled {
+		return nil, nil
+	}
+	u := info.GetUser(psc.authUser)
+	if u == nil || u.Disabled {
+		return nil, common.ErrAuthRequired
+	}
+	return u, nil
+}
+
+// check if the subscriber can read the keyspace notification for the table in namespace
+func (s *Server) canReceiveKeyspaceEvent(psc *pubSubConn, ns string, table string) bool {
+	u, err := s.getPubSubUser(psc)
+	if err != nil {
+		return false
+	}
+	return u == nil || u.CheckAccess(ns, table, false) == nil
+}
+
+// notifyKeyspaceEvent publish the keyspace notification for the changed key to the
+// subscribers in the cluster, it is called by the partition leader while applying the writes.
+func (s *Server) notifyKeyspaceEvent(ns string, event string, key []byte) {
+	s.forwardPubSub(&pubSubForwardMsg{NS: ns, Event: event, Key: append([]byte{}, key...)})
+	s.publishKeyspaceEvent(ns, event, key)
+}
+
+// publish the keyspace notification to the local subscribers
+func (s *Server) publishKeyspaceEvent(ns string, event string, key []byte) {
+	if !s.pubSub.hasSubscribers() {
+		return
+	}
+	table := ""
+	if t, _, err := common.ExtractTable(key); err == nil {
+		table = string(t)
+	}
+	filter := func(psc *pubSubConn) bool {
+		return s.canReceiveKeyspaceEvent(psc, ns, table)
+	}
+	var ch strings.Builder
+	ch.WriteString(keyspaceChannelPrefix)
+	ch.WriteString(ns)
+	ch.WriteString("__:")
+	ch.Write(key)
+	s.pubSub.publish(ch.String(), []byte(event), filter)
+	s.pubSub.publish(keyeventChannelPrefix+ns+"__:"+event, append([]byte{}, key...), filter)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ps "github.com/prometheus/client_golang/prometheus"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/metric"
+)
+
+const (
+	pubSubPeerBufSize       = 10240
+	pubSubForwardBatch      = 256
+	pubSubForwardTimeout    = time.Second * 3
+	pubSubPeerRefreshPeriod = time.Second * 10
+)
+
+// pubSubForwardMsg is the message published on the node and forwarded to the others. The keyspace
+// notification is forwarded with the namespace and key, so the receiver can check the acl.
+type pubSubForwardMsg struct {
+	Channel string `json:"channel,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	NS      string `json:"ns,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Key     []byte `json:"key,omitempty"`
+}
+
+type pubSubPeer struct {
+	endpoint string
+	msgC     chan *pubSubForwardMsg
+	stopC    chan struct{}
+}
+
+func (p *pubSubPeer) sendLoop() {
+	batch := make([]*pubSubForwardMsg, 0, pubSubForwardBatch)
+	for {
+		select {
+		case msg := <-p.msgC:
+			batch = append(batch, msg)
+		case <-p.stopC:
+			return
+		}
+	collect:
+		for len(batch) < pubSubForwardBatch {
+			select {
+			case msg := <-p.msgC:
+				batch = append(batch, msg)
+			default:
+				break collect
+			}
+		}
+		d, _ := json.Marshal(batch)
+		_, err := common.APIRequest("POST", p.endpoint, bytes.NewReader(d), pubSubForwardTimeout, nil)
+		if err != nil {
+			sLog.Infof("forward %v pubsub messages failed: %v", len(batch), err)
+			metric.ErrorCnt.With(ps.Labels{
+				"namespace":  "",
+				"error_info": "pubsub_forward_failed",
+			}).Inc()
+		}
+		for i := range batch {
+			batch[i] = nil
+		}
+		batch = batch[:0]
+	}
+}
+
+// pubSubForwarder forwards the messages published on this node to the other data nodes, so
+// the subscribers connected to any node in the cluster will receive them. The messages are
+// sent in background at most once, and dropped if the peer is too slow.
+type pubSubForwarder struct {
+	sync.RWMutex
+	peers map[string]*pubSubPeer
+}
+
+func newPubSubForwarder() *pubSubForwarder {
+	return &pubSubForwarder{
+		peers: make(map[string]*pubSubPeer),
+	}
+}
+
+func (f *pubSubForwarder) forward(msg *pubSubForwardMsg) {
+	f.RLock()
+	defer f.RUnlock()
+	for _, p := range f.peers {
+		select {
+		case p.msgC <- msg:
+		default:
+			metric.EventCnt.With(ps.Labels{
+				"namespace":  "",
+				"event_name": "pubsub_forward_dropped",
+			}).Inc()
+		}
+	}
+}
+
+// update the peers to the current data nodes in the cluster
+func (f *pubSubForwarder) updatePeers(endpoints []string) {
+	f.Lock()
+	defer f.Unlock()
+	current := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		current[ep] = true
+		if _, ok := f.peers[ep]; ok {
+			continue
+		}
+		p := &pubSubPeer{
+			endpoint: ep,
+			msgC:     make(chan *pubSubForwardMsg, pubSubPeerBufSize),
+			stopC:    make(chan struct{}),
+		}
+		f.peers[ep] = p
+		go p.sendLoop()
+	}
+	for ep, p := range f.peers {
+		if !current[ep] {
+			close(p.stopC)
+			delete(f.peers, ep)
+		}
+	}
+}
+
+func (f *pubSubForwarder) stop() {
+	f.updatePeers(nil)
+}
+
+func (s *Server) refreshPubSubPeers() error {
+	nodes, err := s.dataCoord.GetPeerDataNodes()
+	if err != nil {
+		return err
+	}
+	endpoints := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		endpoints = append(endpoints, common.HTTPScheme()+"://"+
+			net.JoinHostPort(n.NodeIP, n.HttpPort)+common.APIPubSubForward)
+	}
+	s.pubSubFwd.updatePeers(endpoints)
+	return nil
+}
+
+func (s *Server) pubSubForwardLoop(stopC <-chan struct{}) {
+	if s.dataCoord == nil {
+		return
+	}
+	defer s.pubSubFwd.stop()
+	ticker := time.NewTicker(pubSubPeerRefreshPeriod)
+	defer ticker.Stop()
+	for {
+		err := s.refreshPubSubPeers()
+		if err != nil {
+			sLog.Infof("refresh the pubsub peers failed: %v", err.Error())
+		}
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) forwardPubSub(msg *pubSubForwardMsg) {
+	if s.dataCoord == nil {
+		return
+	}
+	s.pubSubFwd.forward(msg)
+}
+
+// the messages forwarded from the other nodes are only published to the local subscribers
+func (s *Server) doPubSubForward(w http.ResponseWriter, req *http.Request, _ httprouter.Params) (interface{}, error) {
+	if !s.isFromVerifiedPeer(req) {
+		return nil, common.HttpErr{Code: http.StatusForbidden, Text: "client certificate required"}
+	}
+	var msgs []pubSubForwardMsg
+	err := json.NewDecoder(req.Body).Decode(&msgs)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	for _, msg := range msgs {
+		if msg.NS != "" {
+			s.publishKeyspaceEvent(msg.NS, msg.Event, msg.Key)
+		} else {
+			s.pubSub.publish(msg.Channel, msg.Data, nil)
+		}
+	}
+	return nil, nil
+}
@@ -28,12 +28,35 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 		}
 	}()
 
+	if s.handleMultiExecState(conn, qcmdlower(cmd.Args[0]), cmd) {
+		return
+	}
 	_, cmd, err := pipelineCommand(conn, cmd)
 	if err != nil {
 		conn.WriteError("pipeline error '" + err.Error() + "'")
 		return
 	}
 	cmdName := qcmdlower(cmd.Args[0])
+	var authUser *common.AuthUser
+	if cmdName != "auth" && cmdName != "quit" {
+		authUser, err = s.checkConnAuthed(conn)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	// rewrite the command with the subcommand to make sure the key is the first argument
+	switch cmdName {
+	case "xgroup":
+		cmd, err = rewriteXGroupCommand(cmd)
+	case "bitop":
+		cmd, err = rewriteBitOpCommand(cmd)
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	cmdName = qcmdlower(cmd.Args[0])
 	switch cmdName {
 	case "detach":
 		hconn := conn.Detach()
@@ -45,17 +68,45 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 		}()
 	case "ping":
 		conn.WriteString("PONG")
+	case "subscribe", "psubscribe":
+		s.doSubscribe(conn, cmd)
+	case "publish":
+		s.doPublish(conn, authUser, cmd)
+	case "pubsub":
+		s.doPubSubInfo(conn, cmd)
+	case "blpop", "brpop", "brpoplpush", "bzpopmin":
+		s.doBlockingListCmd(conn, authUser, cmdName, cmd)
+	case "xread", "xreadgroup":
+		s.doStreamReadCmd(conn, authUser, cmdName, cmd)
+	case "eval", "evalsha":
+		s.doEvalCmd(conn, authUser, cmdName, cmd)
+	case "script":
+		s.doScriptCmd(conn, cmd)
 	case "auth":
-		conn.WriteString("OK")
+		s.doAuth(conn, cmd)
 	case "quit":
 		conn.WriteString("OK")
 		conn.Close()
+	case "cluster":
+		s.doRedisClusterCmd(conn, cmd)
+	case "asking", "readonly", "readwrite":
+		s.doRedisClusterConnCmd(conn)
 	case "info":
 		s := s.GetStats(false, false)
 		d, _ := json.MarshalIndent(s, "", " ")
 		conn.WriteBulkString(string(d))
 	default:
 		if common.IsMergeCommand(cmdName) {
+			if err := checkUserAccessMergeCmd(authUser, cmdName, cmd); err != nil {
+				conn.WriteError(err.Error() + " : ERR handle command " + string(cmd.Args[0]))
+				break
+			}
+			if common.IsMergeKeysCommand(cmdName) {
+				if err := s.checkRedisClusterRedirectForKey(cmdName, cmd); err != nil {
+					conn.WriteError(err.Error())
+					break
+				}
+			}
 			s.doMergeCommand(conn, cmd)
 		} else {
 			var start time.Time
@@ -77,9 +128,16 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 					}
 				}
 			}
+			if err := s.checkRedisClusterRedirect(ns, pk, pkSum, cmd.Args[1]); err != nil {
+				conn.WriteError(err.Error())
+				break
+			}
 			kvn, err := s.GetHandleNode(ns, pk, pkSum, cmdName, cmd)
 			if err == nil {
-				err = s.handleRedisSingleCmd(cmdName, pk, pkSum, kvn, conn, cmd)
+				err = s.checkSamePartitionKeys(kvn, authUser, cmdName, cmd)
+			}
+			if err == nil {
+				err = s.handleRedisSingleCmd(cmdName, ns, pk, pkSum, kvn, authUser, conn, cmd)
 			}
 			if err != nil {
 				conn.WriteError(err.Error() + " : ERR handle command " + cmdStr)
@@ -99,19 +157,22 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 }
 
 func (s *Server) serveRedisAPI(port int, stopC <-chan struct{}) {
-	redisS := redcon.NewServer(
-		":"+strconv.Itoa(port),
-		s.serverRedis,
-		func(conn redcon.Conn) bool {
-			//sLog.Infof("accept: %s", conn.RemoteAddr())
-			return true
-		},
-		func(conn redcon.Conn, err error) {
-			if err != nil {
-				sLog.Infof("closed: %s, err: %v", conn.RemoteAddr(), err)
-			}
-		},
-	)
+	accept := func(conn redcon.Conn) bool {
+		//sLog.Infof("accept: %s", conn.RemoteAddr())
+		return true
+	}
+	closed := func(conn redcon.Conn, err error) {
+		if err != nil {
+			sLog.Infof("closed: %s, err: %v", conn.RemoteAddr(), err)
+		}
+	}
+	var redisS redisListenServer
+	if s.tlsReloader != nil {
+		redisS = newTLSRedisServer(":"+strconv.Itoa(port), s.tlsReloader.ServerConfig(),
+			s.serverRedis, accept, closed)
+	} else {
+		redisS = redcon.NewServer(":"+strconv.Itoa(port), s.serverRedis, accept, closed)
+	}
 	redisS.SetIdleClose(time.Minute * 5)
 	go func() {
 		err := redisS.ListenAndServe()
@@ -121,5 +182,6 @@ func (s *Server) serveRedisAPI(port int, stopC <-chan struct{}) {
 	}()
 	<-stopC
 	redisS.Close()
+	s.pubSub.closeAll()
 	sLog.Infof("redis api server exit\n")
 }
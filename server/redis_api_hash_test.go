@@ -203,6 +203,20 @@ func TestHashIncr(t *testing.T) {
 	} else if n != 0 {
 		t.Fatal(err)
 	}
+
+	v, err := goredis.String(c.Do("hincrbyfloat", key, 1, "10.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.5", v)
+	v, err = goredis.String(c.Do("hincrbyfloat", key, 2, "-1.25"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-1.25", v)
+	v, err = goredis.String(c.Do("hget", key, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.5", v)
+	_, err = c.Do("hincrby", key, 1, 1)
+	assert.NotNil(t, err)
+	_, err = c.Do("hincrbyfloat", key, 1, "nan")
+	assert.NotNil(t, err)
 }
 
 func TestHashGetAll(t *testing.T) {
@@ -518,6 +518,36 @@ func TestKVIncrDecr(t *testing.T) {
 	} else if n != 2 {
 		t.Fatal(n)
 	}
+
+	if n, err := goredis.Int64(c.Do("decr", key)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int64(c.Do("decrby", key, 5)); err != nil {
+		t.Fatal(err)
+	} else if n != -4 {
+		t.Fatal(n)
+	}
+	_, err := c.Do("decrby", key, "-9223372036854775808")
+	assert.NotNil(t, err)
+
+	v, err := goredis.String(c.Do("incrbyfloat", key, "5.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.5", v)
+	v, err = goredis.String(c.Do("incrbyfloat", key, "0.25"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.75", v)
+	v, err = goredis.String(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.75", v)
+	_, err = c.Do("incr", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("incrbyfloat", key, "inf")
+	assert.NotNil(t, err)
+	_, err = c.Do("incrbyfloat", key, "abc")
+	assert.NotNil(t, err)
 }
 
 func TestKVBitOp(t *testing.T) {
@@ -597,6 +627,90 @@ func TestKVBitOp(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestKVBitOpPosField(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:kv_bitop_src1"
+	key2 := "default:test:kv_bitop_src2"
+	dest := "default:test:kv_bitop_dest"
+	for _, pos := range []int{1, 8, 8192 * 10} {
+		_, err := c.Do("setbitv2", key1, pos, 1)
+		assert.Nil(t, err)
+	}
+	for _, pos := range []int{1, 9} {
+		_, err := c.Do("setbitv2", key2, pos, 1)
+		assert.Nil(t, err)
+	}
+	n, err := goredis.Int64(c.Do("bitop", "and", dest, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10241), n)
+	n, err = goredis.Int64(c.Do("bitcount", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = goredis.Int64(c.Do("bitop", "OR", dest, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10241), n)
+	n, err = goredis.Int64(c.Do("bitcount", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	n, err = goredis.Int64(c.Do("bitop", "xor", dest, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10241), n)
+	n, err = goredis.Int64(c.Do("bitcount", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = goredis.Int64(c.Do("bitop", "not", dest, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = goredis.Int64(c.Do("bitcount", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(14), n)
+	_, err = c.Do("bitop", "not", dest, key1, key2)
+	assert.NotNil(t, err)
+	_, err = c.Do("bitop", "nand", dest, key1, key2)
+	assert.NotNil(t, err)
+
+	n, err = goredis.Int64(c.Do("bitpos", key1, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = goredis.Int64(c.Do("bitpos", key1, 1, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8192*10), n)
+	n, err = goredis.Int64(c.Do("bitpos", key1, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), n)
+	n, err = goredis.Int64(c.Do("bitpos", key1, 1, 2, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	n, err = goredis.Int64(c.Do("bitpos", "default:test:kv_bitpos_nokey", 0))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	_, err = c.Do("bitpos", key1, 2)
+	assert.NotNil(t, err)
+
+	counter := "default:test:kv_bitfield"
+	rets, err := goredis.MultiBulk(c.Do("bitfield", counter, "set", "u8", "#1", "200",
+		"incrby", "u8", "#1", "100", "overflow", "fail", "incrby", "u8", "#1", "250", "get", "u8", "8"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(44), nil, int64(44)}, rets)
+	rets, err = goredis.MultiBulk(c.Do("bitfield", counter, "overflow", "sat", "incrby", "i8", "#1", "-200"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(-128)}, rets)
+	rets, err = goredis.MultiBulk(c.Do("bitfield_ro", counter, "get", "u8", "#1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(128)}, rets)
+	rets, err = goredis.MultiBulk(c.Do("bitfield", counter, "get", "i8", "#1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(-128)}, rets)
+	_, err = c.Do("bitfield_ro", counter, "incrby", "u8", "0", "1")
+	assert.NotNil(t, err)
+	_, err = c.Do("bitfield", counter, "get", "u64", "0")
+	assert.NotNil(t, err)
+	_, err = c.Do("bitfield", counter, "get", "i8", "-1")
+	assert.NotNil(t, err)
+}
+
 func TestKVBitExpire(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
@@ -607,3 +607,45 @@ func TestKVRWMultiPart(t *testing.T) {
 		}
 	}
 }
+
+func TestKVMultiKeysCrossPart(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	args := make([]interface{}, 0, 40)
+	keys := make([]interface{}, 0, 20)
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("default:test_kv_multi_cross:kv%d", i)
+		keys = append(keys, k)
+		args = append(args, k, fmt.Sprintf("v%d", i))
+	}
+	ok, err := goredis.String(c.Do("mset", args...))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("mset", keys[0], "v0", keys[1])
+	assert.NotNil(t, err)
+
+	mgetArgs := append([]interface{}{"default:test_kv_multi_cross:nokey"}, keys...)
+	vals, err := goredis.MultiBulk(c.Do("mget", mgetArgs...))
+	assert.Nil(t, err)
+	assert.Equal(t, 21, len(vals))
+	assert.Nil(t, vals[0])
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, []byte(fmt.Sprintf("v%d", i)), vals[i+1])
+	}
+
+	n, err := goredis.Int(c.Do("exists", mgetArgs...))
+	assert.Nil(t, err)
+	assert.Equal(t, 20, n)
+	n, err = goredis.Int(c.Do("del", mgetArgs...))
+	assert.Nil(t, err)
+	assert.Equal(t, 20, n)
+	n, err = goredis.Int(c.Do("exists", keys...))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	vals, err = goredis.MultiBulk(c.Do("mget", keys...))
+	assert.Nil(t, err)
+	for _, v := range vals {
+		assert.Nil(t, v)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiExec(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_multi:exec_k1"
+	_, err := c.Do("exec")
+	assert.NotNil(t, err)
+
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = c.Do("multi")
+	assert.NotNil(t, err)
+	rsp, err := goredis.String(c.Do("hmset", key, "f1", "v1", "f2", "v2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUED", rsp)
+	rsp, err = goredis.String(c.Do("zadd", key+"_idx", "1", "f1", "2", "f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUED", rsp)
+	rsp, err = goredis.String(c.Do("set", key+"_kv", "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUED", rsp)
+	vals, err := goredis.MultiBulk(c.Do("exec"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(vals))
+	assert.Equal(t, "OK", vals[0])
+	assert.Equal(t, int64(2), vals[1])
+	assert.Equal(t, "OK", vals[2])
+
+	v, err := goredis.String(c.Do("hget", key, "f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", v)
+	n, err := goredis.Int64(c.Do("zcard", key+"_idx"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	v, err = goredis.String(c.Do("get", key+"_kv"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+}
+
+func TestMultiExecDiscardAndError(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_multi:discard_k1"
+	_, err := c.Do("discard")
+	assert.NotNil(t, err)
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	rsp, err := goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUED", rsp)
+	_, err = goredis.String(c.Do("discard"))
+	assert.Nil(t, err)
+	v, err := goredis.Bytes(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	// the read command can not be queued, and the transaction will be aborted
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+	_, err = c.Do("get", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("exec")
+	assert.NotNil(t, err)
+	v, err = goredis.Bytes(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	// the same key can not be written by different commands
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("setex", key, "100", "2"))
+	assert.Nil(t, err)
+	_, err = c.Do("exec")
+	assert.NotNil(t, err)
+	v, err = goredis.Bytes(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	// the error in any command will discard the whole transaction
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("zadd", key+"_z", "invalid", "m1"))
+	assert.Nil(t, err)
+	_, err = c.Do("exec")
+	assert.NotNil(t, err)
+	v, err = goredis.Bytes(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestMultiExecWatch(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+	c2 := getTestConn(t)
+	defer c2.Close()
+
+	key := "default:test_multi:watch_k1"
+	_, err := goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+
+	_, err = goredis.String(c.Do("watch", key))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = c.Do("watch", key)
+	assert.NotNil(t, err)
+	_, err = goredis.String(c.Do("set", key, "2"))
+	assert.Nil(t, err)
+	vals, err := goredis.MultiBulk(c.Do("exec"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	v, err := goredis.String(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+
+	// the watched key changed by other connection will abort the transaction
+	hkey := "default:test_multi:watch_h1"
+	_, err = goredis.String(c.Do("watch", key, hkey))
+	assert.Nil(t, err)
+	_, err = goredis.Int64(c2.Do("hset", hkey, "f1", "v1"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "3"))
+	assert.Nil(t, err)
+	_, err = goredis.MultiBulk(c.Do("exec"))
+	assert.Equal(t, goredis.ErrNil, err)
+	v, err = goredis.String(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+
+	// the watched keys is cleared after exec
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = goredis.String(c.Do("hset", hkey+strconv.Itoa(i), "f1", "v1"))
+		assert.Nil(t, err)
+	}
+	vals, err = goredis.MultiBulk(c.Do("exec"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(vals))
+
+	// the watched json key changed by other connection will abort the transaction
+	jkey := "default:test_multi:watch_j1"
+	_, err = goredis.String(c.Do("watch", jkey))
+	assert.Nil(t, err)
+	_, err = goredis.String(c2.Do("json.set", jkey, ".a", `"str"`))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "4"))
+	assert.Nil(t, err)
+	_, err = goredis.MultiBulk(c.Do("exec"))
+	assert.Equal(t, goredis.ErrNil, err)
+
+	// the unchanged watched key will not abort the transaction
+	_, err = goredis.String(c.Do("watch", jkey, key))
+	assert.Nil(t, err)
+	_, err = goredis.String(c2.Do("set", "default:test_multi:watch_other", "1"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("multi"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c.Do("set", key, "4"))
+	assert.Nil(t, err)
+	vals, err = goredis.MultiBulk(c.Do("exec"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	v, err = goredis.String(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "4", v)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+// convert the pub/sub reply to strings, the subscription count is converted to string
+func pubSubReply(reply interface{}, err error) ([]string, error) {
+	vals, err := goredis.MultiBulk(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(vals))
+	for _, v := range vals {
+		switch rv := v.(type) {
+		case []byte:
+			result = append(result, string(rv))
+		case int64:
+			result = append(result, strconv.FormatInt(rv, 10))
+		default:
+			result = append(result, "")
+		}
+	}
+	return result, nil
+}
+
+func TestPubSub(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	sub, err := goredis.Connect("127.0.0.1:" + strconv.Itoa(gredisport))
+	assert.Nil(t, err)
+	defer sub.Close()
+	sub.SetReadDeadline(time.Now().Add(time.Second * 10))
+
+	rsp, err := pubSubReply(sub.Do("subscribe", "test_channel"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"subscribe", "test_channel", "1"}, rsp)
+
+	n, err := goredis.Int64(c.Do("publish", "test_channel", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = goredis.Int64(c.Do("publish", "test_channel_none", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	// the keyspace notification channels are reserved
+	_, err = c.Do("publish", "__keyspace@default__:test_pubsub:k1", "set")
+	assert.NotNil(t, err)
+	_, err = c.Do("publish", "__keyevent@default__:set", "test_pubsub:k1")
+	assert.NotNil(t, err)
+
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"message", "test_channel", "hello"}, rsp)
+
+	chs, err := goredis.Strings(c.Do("pubsub", "channels", "test_*"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test_channel"}, chs)
+
+	// only pub/sub commands allowed in the subscribe mode
+	_, err = sub.Do("get", "default:test_pubsub:k1")
+	assert.NotNil(t, err)
+
+	rsp, err = pubSubReply(sub.Do("unsubscribe"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"unsubscribe", "test_channel", "0"}, rsp)
+	n, err = goredis.Int64(c.Do("publish", "test_channel", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestPubSubKeyspaceNotify(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	node.SetKeyspaceNotifier(gkvs.notifyKeyspaceEvent)
+	defer node.SetKeyspaceNotifier(nil)
+
+	sub, err := goredis.Connect("127.0.0.1:" + strconv.Itoa(gredisport))
+	assert.Nil(t, err)
+	defer sub.Close()
+	sub.SetReadDeadline(time.Now().Add(time.Second * 10))
+
+	pattern := "__keyspace@default__:test_pubsub:*"
+	rsp, err := pubSubReply(sub.Do("psubscribe", pattern))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"psubscribe", pattern, "1"}, rsp)
+	rsp, err = pubSubReply(sub.Do("subscribe", "__keyevent@default__:del"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"subscribe", "__keyevent@default__:del", "2"}, rsp)
+
+	key := "default:test_pubsub:k1"
+	_, err = goredis.String(c.Do("set", key, "1"))
+	assert.Nil(t, err)
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pmessage", pattern, "__keyspace@default__:test_pubsub:k1", "set"}, rsp)
+
+	_, err = goredis.Int64(c.Do("del", key))
+	assert.Nil(t, err)
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pmessage", pattern, "__keyspace@default__:test_pubsub:k1", "del"}, rsp)
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"message", "__keyevent@default__:del", "test_pubsub:k1"}, rsp)
+
+	rsp, err = pubSubReply(sub.Do("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pong", ""}, rsp)
+}
+
+func TestPubSubForward(t *testing.T) {
+	sub, err := goredis.Connect("127.0.0.1:" + strconv.Itoa(gredisport))
+	assert.Nil(t, err)
+	defer sub.Close()
+	sub.SetReadDeadline(time.Now().Add(time.Second * 10))
+
+	rsp, err := pubSubReply(sub.Do("subscribe", "test_forward_channel"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"subscribe", "test_forward_channel", "1"}, rsp)
+
+	// forward to the test server as the peer node
+	fwd := newPubSubForwarder()
+	defer fwd.stop()
+	fwd.updatePeers([]string{"http://127.0.0.1:" + strconv.Itoa(gredisport+1) + common.APIPubSubForward})
+	fwd.forward(&pubSubForwardMsg{Channel: "test_forward_channel", Data: []byte("hello")})
+
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"message", "test_forward_channel", "hello"}, rsp)
+
+	fwd.updatePeers(nil)
+	fwd.RLock()
+	assert.Equal(t, 0, len(fwd.peers))
+	fwd.RUnlock()
+}
+
+func TestPubSubACL(t *testing.T) {
+	old := gkvs.getAuthInfo()
+	defer func() {
+		if old == nil {
+			old = &common.AuthInfo{}
+		}
+		gkvs.authInfo.Store(old)
+	}()
+	gkvs.authInfo.Store(&common.AuthInfo{
+		Enabled: true,
+		Users: []common.AuthUser{
+			{
+				Name:         "test_user",
+				PasswordHash: common.HashAuthPassword("test_pass"),
+				ACLs: []common.AuthACL{
+					{Namespace: "default", Tables: []string{"test_chan"}},
+					{Namespace: "default", Tables: []string{"test_chan_ro"}, ReadOnly: true},
+					{Namespace: "test_pubsub_ns"},
+				},
+			},
+		},
+	})
+
+	c := getTestConn(t)
+	defer c.Close()
+	_, err := goredis.String(c.Do("auth", "test_user", "test_pass"))
+	assert.Nil(t, err)
+	sub, err := goredis.Connect("127.0.0.1:" + strconv.Itoa(gredisport))
+	assert.Nil(t, err)
+	defer sub.Close()
+	sub.SetReadDeadline(time.Now().Add(time.Second * 10))
+	_, err = goredis.String(sub.Do("auth", "test_user", "test_pass"))
+	assert.Nil(t, err)
+
+	// the channel without namespace or in the namespace not allowed is denied
+	_, err = sub.Do("subscribe", "test_chan")
+	assert.NotNil(t, err)
+	_, err = sub.Do("subscribe", "other:test_chan")
+	assert.NotNil(t, err)
+	_, err = sub.Do("psubscribe", "def*:test_chan")
+	assert.NotNil(t, err)
+	// the pattern may match any table, so only allowed for the whole namespace
+	_, err = sub.Do("psubscribe", "default:test_chan*")
+	assert.NotNil(t, err)
+	rsp, err := pubSubReply(sub.Do("subscribe", "default:test_chan_ro"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"subscribe", "default:test_chan_ro", "1"}, rsp)
+	rsp, err = pubSubReply(sub.Do("psubscribe", "test_pubsub_ns:*"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"psubscribe", "test_pubsub_ns:*", "2"}, rsp)
+
+	_, err = c.Do("publish", "test_chan", "hello")
+	assert.NotNil(t, err)
+	_, err = c.Do("publish", "default:test_chan_ro", "hello")
+	assert.NotNil(t, err)
+	n, err := goredis.Int64(c.Do("publish", "default:test_chan", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = goredis.Int64(c.Do("publish", "test_pubsub_ns:test_chan", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	rsp, err = pubSubReply(sub.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pmessage", "test_pubsub_ns:*", "test_pubsub_ns:test_chan", "hello"}, rsp)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptEval(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_script:eval_k1"
+	script := `local c = tonumber(redis.call('get', KEYS[1]) or '0') + tonumber(ARGV[1])
+if c > tonumber(ARGV[2]) then
+  return redis.error_reply('LIMITED')
+end
+local last = redis.call('hget', KEYS[2], 'last')
+redis.call('incrby', KEYS[1], ARGV[1])
+redis.call('hset', KEYS[2], 'last', c)
+return {c, last}`
+	for i := 1; i <= 3; i++ {
+		vals, err := goredis.MultiBulk(c.Do("eval", script, "2", key, key+"_h", "1", "3"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(vals))
+		assert.Equal(t, int64(i), vals[0])
+		if i == 1 {
+			assert.Nil(t, vals[1])
+		} else {
+			assert.Equal(t, []byte(string('0'+rune(i-1))), vals[1])
+		}
+	}
+	_, err := c.Do("eval", script, "2", key, key+"_h", "1", "3")
+	assert.NotNil(t, err)
+	assert.Equal(t, "LIMITED", err.Error())
+	v, err := goredis.String(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+
+	sha, err := goredis.String(c.Do("script", "load", "return redis.call('get', KEYS[1])"))
+	assert.Nil(t, err)
+	exists, err := goredis.MultiBulk(c.Do("script", "exists", sha, "notexist"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(0)}, exists)
+	v, err = goredis.String(c.Do("evalsha", sha, "1", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+	_, err = goredis.String(c.Do("script", "flush"))
+	assert.Nil(t, err)
+	_, err = c.Do("evalsha", sha, "1", key)
+	assert.NotNil(t, err)
+}
+
+func TestScriptEvalInvalid(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_script:invalid_k1"
+	// the keys should be declared
+	_, err := c.Do("eval", "return 1", "0")
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "return 1", "2", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "return redis.call('get', 'default:test_script:other')", "1", key)
+	assert.NotNil(t, err)
+	// syntax error
+	_, err = c.Do("eval", "return (", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("script", "load", "return (")
+	assert.NotNil(t, err)
+	// the nondeterministic functions are not allowed
+	_, err = c.Do("eval", "return math.random()", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "return os.time()", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "return redis.call('ttl', KEYS[1])", "1", key)
+	assert.NotNil(t, err)
+	// the key can not be accessed again after written
+	_, err = c.Do("eval", "redis.call('set', KEYS[1], 'v1'); return redis.call('get', KEYS[1])", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "redis.call('set', KEYS[1], 'v1'); return redis.call('set', KEYS[1], 'v2')", "1", key)
+	assert.NotNil(t, err)
+	// nothing is written if the script failed
+	key2 := "default:test_script:invalid_k2"
+	_, err = c.Do("set", key2, "v2")
+	assert.Nil(t, err)
+	_, err = c.Do("eval", "redis.call('set', KEYS[1], 'v1'); return redis.call('incr', KEYS[2])", "2", key, key2)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "redis.call('set', KEYS[1], 'v1'); redis.pcall('incr', KEYS[2]); return 1", "2", key, key2)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "redis.call('set', KEYS[1], 'v1'); while true do end", "1", key)
+	assert.NotNil(t, err)
+	v, err := goredis.Bytes(c.Do("get", key))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	n, err := goredis.Int64(c.Do("eval", "local r = redis.pcall('get', 'default:test_script:other'); if r.err then return 0 end; return 1", "1", key))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestScriptEvalBuiltins(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_script:builtin_k1"
+	// the tables and functions converted to string do not contain the address
+	script := `local t1 = {}
+local t2 = setmetatable({}, {__tostring = function() return 'custom' end})
+return {tostring(t1), tostring(t2), string.format('%s-%s', t1, print), tostring(t1), tostring(1)}`
+	vals, err := goredis.MultiBulk(c.Do("eval", script, "1", key))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("table: 1"), []byte("custom"), []byte("table: 1-nil"),
+		[]byte("table: 1"), []byte("1")}, vals)
+	v, err := goredis.String(c.Do("eval", "return string.format('%s', function() end)", "1", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "function: 1", v)
+
+	v, err = goredis.String(c.Do("eval", "return string.rep('ab', 3) .. table.concat({'a', 'b', 1}, ',')", "1", key))
+	assert.Nil(t, err)
+	assert.Equal(t, "abababa,b,1", v)
+	// the string too long is not allowed
+	_, err = c.Do("eval", "return string.rep('a', 1024 * 1024 * 1024)", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "local t = {}; local s = string.rep('a', 1024 * 1024); for i = 1, 100 do t[i] = s end; return table.concat(t)", "1", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("eval", "return string.format('%999999999d', 1)", "1", key)
+	assert.NotNil(t, err)
+}
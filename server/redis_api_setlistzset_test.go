@@ -491,6 +491,203 @@ func TestListLPushRPop(t *testing.T) {
 	}
 }
 
+func TestListBlockingPop(t *testing.T) {
+	c := getTestConn(t)
+	c2 := getTestConn(t)
+	defer c.Close()
+	defer c2.Close()
+
+	k1 := "default:test_blpop:1"
+	k2 := "default:test_blpop:2"
+	_, err := c.Do("blpop", k1, "-1")
+	assert.NotNil(t, err)
+	_, err = c.Do("blpop", k1)
+	assert.NotNil(t, err)
+	// timeout with null array
+	start := time.Now()
+	_, err = goredis.MultiBulk(c.Do("blpop", k1, k2, "0.2"))
+	assert.Equal(t, goredis.ErrNil, err)
+	assert.True(t, time.Since(start) >= time.Millisecond*200)
+
+	_, err = c.Do("rpush", k2, "a", "b")
+	assert.Nil(t, err)
+	vals, err := goredis.MultiBulk(c.Do("blpop", k1, k2, "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte(k2), []byte("a")}, vals)
+	vals, err = goredis.MultiBulk(c.Do("brpop", k1, k2, "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte(k2), []byte("b")}, vals)
+
+	// blocked until pushed by other connection
+	done := make(chan []interface{}, 1)
+	go func() {
+		vals, err := goredis.MultiBulk(c.Do("brpop", k1, k2, "0"))
+		assert.Nil(t, err)
+		done <- vals
+	}()
+	time.Sleep(time.Millisecond * 200)
+	select {
+	case <-done:
+		t.Fatal("should block")
+	default:
+	}
+	_, err = c2.Do("lpush", k1, "c")
+	assert.Nil(t, err)
+	select {
+	case vals = <-done:
+		assert.Equal(t, []interface{}{[]byte(k1), []byte("c")}, vals)
+	case <-time.After(time.Second * 3):
+		t.Fatal("should be woken after pushed")
+	}
+	n, err := goredis.Int(c.Do("llen", k1))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestListBlockingPopClientClosed(t *testing.T) {
+	c := getTestConn(t)
+	c2 := getTestConn(t)
+	defer c.Close()
+	defer c2.Close()
+
+	k1 := "default:test_blpop_closed:1"
+	// the pipelined commands should be served after the blocking command
+	c.Send("blpop", k1, "0.1")
+	c.Send("ping")
+	_, err := goredis.MultiBulk(c.Receive())
+	assert.Equal(t, goredis.ErrNil, err)
+	pong, err := goredis.String(c.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", pong)
+
+	c3 := getTestConn(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c3.Do("blpop", k1, "0")
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 200)
+	c3.Finalize()
+	<-done
+	time.Sleep(time.Millisecond * 200)
+	// the element should not be popped for the closed client
+	_, err = c2.Do("rpush", k1, "a")
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	n, err := goredis.Int(c2.Do("llen", k1))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	vals, err := goredis.MultiBulk(c.Do("blpop", k1, "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte(k1), []byte("a")}, vals)
+}
+
+func TestListBRPopLPush(t *testing.T) {
+	c := getTestConn(t)
+	c2 := getTestConn(t)
+	defer c.Close()
+	defer c2.Close()
+
+	src := "default:test_brpoplpush:src"
+	dst := "default:test_brpoplpush:dst"
+	v, err := c.Do("brpoplpush", src, dst, "0.1")
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	done := make(chan string, 1)
+	go func() {
+		v, err := goredis.String(c.Do("brpoplpush", src, dst, "3"))
+		assert.Nil(t, err)
+		done <- v
+	}()
+	time.Sleep(time.Millisecond * 200)
+	_, err = c2.Do("rpush", src, "a", "b")
+	assert.Nil(t, err)
+	select {
+	case v := <-done:
+		assert.Equal(t, "b", v)
+	case <-time.After(time.Second * 3):
+		t.Fatal("should be woken after pushed")
+	}
+	vals, err := goredis.MultiBulk(c.Do("lrange", dst, 0, -1))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("b")}, vals)
+	vals, err = goredis.MultiBulk(c.Do("lrange", src, 0, -1))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("a")}, vals)
+}
+
+func TestListEdit(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:list_edit"
+	dst := "default:test:list_edit_dst"
+	n, err := goredis.Int(c.Do("linsert", key, "before", "a", "x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = c.Do("rpush", key, "a", "b", "a", "c", "a")
+	assert.Nil(t, err)
+
+	n, err = goredis.Int(c.Do("linsert", key, "after", "b", "x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	n, err = goredis.Int(c.Do("linsert", key, "BEFORE", "y", "x"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, n)
+	n, err = goredis.Int(c.Do("lrem", key, -2, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	vals, err := goredis.Strings(c.Do("lrange", key, 0, -1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "x", "c"}, vals)
+
+	n, err = goredis.Int(c.Do("lpos", key, "x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	v, err := c.Do("lpos", key, "y")
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	ns, err := goredis.MultiBulk(c.Do("lpos", key, "a", "count", 0))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0)}, ns)
+	ns, err = goredis.MultiBulk(c.Do("lpos", key, "c", "rank", -1, "count", 1, "maxlen", 2))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(3)}, ns)
+
+	str, err := goredis.String(c.Do("rpoplpush", key, dst))
+	assert.Nil(t, err)
+	assert.Equal(t, "c", str)
+	str, err = goredis.String(c.Do("lmove", key, dst, "left", "right"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a", str)
+	str, err = goredis.String(c.Do("lmove", dst, dst, "LEFT", "RIGHT"))
+	assert.Nil(t, err)
+	assert.Equal(t, "c", str)
+	vals, err = goredis.Strings(c.Do("lrange", dst, 0, -1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, vals)
+	vals, err = goredis.Strings(c.Do("lrange", key, 0, -1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "x"}, vals)
+	v, err = c.Do("lmove", "default:test:list_edit_empty", dst, "left", "left")
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	_, err = c.Do("lmove", key, dst, "left", "middle")
+	assert.NotNil(t, err)
+	_, err = c.Do("linsert", key, "middle", "b", "x")
+	assert.NotNil(t, err)
+	_, err = c.Do("lrem", key, "a", "b")
+	assert.NotNil(t, err)
+	_, err = c.Do("lpos", key, "b", "rank", 0)
+	assert.NotNil(t, err)
+	_, err = c.Do("lpos", key, "b", "count")
+	assert.NotNil(t, err)
+	_, err = c.Do("rpoplpush", key)
+	assert.NotNil(t, err)
+}
+
 func TestListErrorParams(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
@@ -771,6 +968,68 @@ func TestSetSPopSAddConcurrent(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSetAlgebra(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:testdb_cmd_set_algebra_1"
+	key2 := "default:test:testdb_cmd_set_algebra_2"
+	key3 := "default:test:testdb_cmd_set_algebra_3"
+	dest := "default:test:testdb_cmd_set_algebra_dest"
+
+	_, err := c.Do("sadd", key1, "a", "b", "c")
+	assert.Nil(t, err)
+	_, err = c.Do("sadd", key2, "b", "c", "d")
+	assert.Nil(t, err)
+
+	vals, err := goredis.Strings(c.Do("sinter", key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, vals)
+	vals, err = goredis.Strings(c.Do("sunion", key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, vals)
+	vals, err = goredis.Strings(c.Do("sdiff", key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, vals)
+	vals, err = goredis.Strings(c.Do("sinter", key1, key3))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(vals))
+
+	n, err := goredis.Int(c.Do("sunionstore", dest, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	n, err = goredis.Int(c.Do("sinterstore", dest, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = goredis.Int(c.Do("scard", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = goredis.Int(c.Do("sdiffstore", dest, key1, key1))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("scard", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = goredis.Int(c.Do("smove", key1, key2, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("smove", key1, key2, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("sismember", key2, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("scard", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = c.Do("sinterstore", dest)
+	assert.NotNil(t, err)
+	_, err = c.Do("smove", key1, key2)
+	assert.NotNil(t, err)
+}
+
 func TestSetExpire(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
@@ -1851,3 +2110,99 @@ func TestZSetLex(t *testing.T) {
 		t.Fatal(n)
 	}
 }
+
+func TestZSetAggregateStore(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:testdb_cmd_zset_aggregate_1"
+	key2 := "default:test:testdb_cmd_zset_aggregate_2"
+	dest := "default:test:testdb_cmd_zset_aggregate_dest"
+
+	_, err := c.Do("zadd", key1, 1, "a", 2, "b")
+	assert.Nil(t, err)
+	_, err = c.Do("zadd", key2, 10, "b", 20, "c")
+	assert.Nil(t, err)
+
+	n, err := goredis.Int(c.Do("zunionstore", dest, 2, key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	vals, err := goredis.Strings(c.Do("zrange", dest, 0, -1, "withscores"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "1", "b", "12", "c", "20"}, vals)
+
+	n, err = goredis.Int(c.Do("zinterstore", dest, 2, key1, key2, "weights", 3, 1, "aggregate", "min"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	vals, err = goredis.Strings(c.Do("zrange", dest, 0, -1, "withscores"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "6"}, vals)
+
+	_, err = c.Do("zunionstore", dest, 0, key1)
+	assert.NotNil(t, err)
+	_, err = c.Do("zunionstore", dest, 2, key1)
+	assert.NotNil(t, err)
+	_, err = c.Do("zunionstore", dest, 1, key1, "weights", "a")
+	assert.NotNil(t, err)
+	_, err = c.Do("zunionstore", dest, 1, key1, "aggregate", "avg")
+	assert.NotNil(t, err)
+}
+
+func TestZSetPop(t *testing.T) {
+	c := getTestConn(t)
+	c2 := getTestConn(t)
+	defer c.Close()
+	defer c2.Close()
+
+	k1 := "default:test_zpop:1"
+	k2 := "default:test_zpop:2"
+	_, err := c.Do("zadd", k1, 1, "a", 2, "b", 3, "c")
+	assert.Nil(t, err)
+
+	vals, err := goredis.Strings(c.Do("zpopmin", k1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "1"}, vals)
+	vals, err = goredis.Strings(c.Do("zpopmax", k1, 5))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "3", "b", "2"}, vals)
+	vals, err = goredis.Strings(c.Do("zpopmin", k1))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(vals))
+
+	// timeout with null array
+	start := time.Now()
+	_, err = goredis.MultiBulk(c.Do("bzpopmin", k1, k2, "0.2"))
+	assert.Equal(t, goredis.ErrNil, err)
+	assert.True(t, time.Since(start) >= time.Millisecond*200)
+
+	_, err = c.Do("zadd", k2, 5, "x", 4, "y")
+	assert.Nil(t, err)
+	bvals, err := goredis.MultiBulk(c.Do("bzpopmin", k1, k2, "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte(k2), []byte("y"), []byte("4")}, bvals)
+
+	// blocked until added by other connection
+	done := make(chan []interface{}, 1)
+	go func() {
+		vals, err := goredis.MultiBulk(c.Do("bzpopmin", k1, "0"))
+		assert.Nil(t, err)
+		done <- vals
+	}()
+	time.Sleep(time.Millisecond * 200)
+	select {
+	case <-done:
+		t.Fatal("should block")
+	default:
+	}
+	_, err = c2.Do("zadd", k1, 7, "z")
+	assert.Nil(t, err)
+	select {
+	case bvals = <-done:
+		assert.Equal(t, []interface{}{[]byte(k1), []byte("z"), []byte("7")}, bvals)
+	case <-time.After(time.Second * 3):
+		t.Fatal("should be woken after added")
+	}
+	n, err := goredis.Int(c.Do("zcard", k1))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_stream:1"
+	id1, err := goredis.String(c.Do("xadd", key, "*", "f1", "v1"))
+	assert.Nil(t, err)
+	id2, err := goredis.String(c.Do("xadd", key, "MAXLEN", "10", "*", "f2", "v2"))
+	assert.Nil(t, err)
+	_, err = c.Do("xadd", key, id1, "f", "v")
+	assert.NotNil(t, err)
+	_, err = c.Do("xadd", key, "*", "f")
+	assert.NotNil(t, err)
+
+	n, err := goredis.Int(c.Do("xlen", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	vals, err := goredis.MultiBulk(c.Do("xrange", key, "-", "+"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vals))
+	entry := vals[0].([]interface{})
+	assert.Equal(t, []byte(id1), entry[0])
+	assert.Equal(t, []interface{}{[]byte("f1"), []byte("v1")}, entry[1])
+	vals, err = goredis.MultiBulk(c.Do("xrevrange", key, "+", "-", "COUNT", "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	assert.Equal(t, []byte(id2), vals[0].([]interface{})[0])
+	vals, err = goredis.MultiBulk(c.Do("xrange", key, "("+id1, "+"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+
+	// xread from the beginning and the end
+	vals, err = goredis.MultiBulk(c.Do("xread", "COUNT", "1", "STREAMS", key, "0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	kv := vals[0].([]interface{})
+	assert.Equal(t, []byte(key), kv[0])
+	assert.Equal(t, 1, len(kv[1].([]interface{})))
+	_, err = goredis.MultiBulk(c.Do("xread", "STREAMS", key, "$"))
+	assert.Equal(t, goredis.ErrNil, err)
+	_, err = c.Do("xread", "BLOCK", "100", "STREAMS", key, "$")
+	assert.NotNil(t, err)
+	_, err = c.Do("xread", "STREAMS", key)
+	assert.NotNil(t, err)
+
+	n, err = goredis.Int(c.Do("xdel", key, id1))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("xtrim", key, "MAXLEN", "0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("xlen", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = goredis.Int(c.Do("xexpire", key, "10"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("xttl", key))
+	assert.Nil(t, err)
+	assert.True(t, n > 0 && n <= 10)
+	n, err = goredis.Int(c.Do("xclear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("xkeyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestStreamGroup(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test_stream_group:1"
+	key2 := "default:test_stream_group:2"
+	_, err := c.Do("xgroup", "create", key, "g1", "$")
+	assert.NotNil(t, err)
+	_, err = c.Do("xgroup", "unknown", key, "g1")
+	assert.NotNil(t, err)
+	ok, err := goredis.String(c.Do("xgroup", "create", key, "g1", "$", "MKSTREAM"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	ok, err = goredis.String(c.Do("xgroup", "create", key2, "g1", "0", "MKSTREAM"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("xgroup", "create", key, "g1", "$")
+	assert.NotNil(t, err)
+
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		id, err := goredis.String(c.Do("xadd", key, "*", "f", "v"))
+		assert.Nil(t, err)
+		ids = append(ids, id)
+	}
+	_, err = c.Do("xadd", key2, "*", "f2", "v2")
+	assert.Nil(t, err)
+
+	vals, err := goredis.MultiBulk(c.Do("xreadgroup", "GROUP", "g1", "c1", "COUNT", "2",
+		"STREAMS", key, key2, ">", ">"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vals))
+	assert.Equal(t, []byte(key), vals[0].([]interface{})[0])
+	assert.Equal(t, 2, len(vals[0].([]interface{})[1].([]interface{})))
+	assert.Equal(t, []byte(key2), vals[1].([]interface{})[0])
+	vals, err = goredis.MultiBulk(c.Do("xreadgroup", "GROUP", "g1", "c2",
+		"STREAMS", key, ">"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	_, err = goredis.MultiBulk(c.Do("xreadgroup", "GROUP", "g1", "c2",
+		"STREAMS", key, ">"))
+	assert.Equal(t, goredis.ErrNil, err)
+	_, err = c.Do("xreadgroup", "GROUP", "nogroup", "c2", "STREAMS", key, ">")
+	assert.NotNil(t, err)
+
+	// pending history of the consumer
+	vals, err = goredis.MultiBulk(c.Do("xreadgroup", "GROUP", "g1", "c1",
+		"STREAMS", key, "0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vals[0].([]interface{})[1].([]interface{})))
+
+	vals, err = goredis.MultiBulk(c.Do("xpending", key, "g1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), vals[0])
+	assert.Equal(t, []byte(ids[0]), vals[1])
+	assert.Equal(t, []byte(ids[2]), vals[2])
+	assert.Equal(t, 2, len(vals[3].([]interface{})))
+	vals, err = goredis.MultiBulk(c.Do("xpending", key, "g1", "-", "+", "10", "c2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vals))
+	assert.Equal(t, []byte(ids[2]), vals[0].([]interface{})[0])
+
+	claimed, err := goredis.MultiBulk(c.Do("xclaim", key, "g1", "c2", "0", ids[0], "JUSTID"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte(ids[0])}, claimed)
+
+	n, err := goredis.Int(c.Do("xack", key, "g1", ids[0], ids[1]))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	vals, err = goredis.MultiBulk(c.Do("xpending", key, "g1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), vals[0])
+
+	ok, err = goredis.String(c.Do("xgroup", "setid", key, "g1", "0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	n, err = goredis.Int(c.Do("xgroup", "destroy", key, "g1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = c.Do("xpending", key, "g1")
+	assert.NotNil(t, err)
+}
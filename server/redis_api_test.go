@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -139,3 +140,75 @@ func getTestConn(t *testing.T) *goredis.PoolConn {
 	}
 	return conn
 }
+
+func TestAuthACL(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test_auth:a"
+	key2 := "default:test_auth_ro:a"
+	_, err := goredis.String(c.Do("set", key1, "1"))
+	assert.Nil(t, err)
+
+	old := gkvs.getAuthInfo()
+	defer func() {
+		if old == nil {
+			old = &common.AuthInfo{}
+		}
+		gkvs.authInfo.Store(old)
+	}()
+	gkvs.authInfo.Store(&common.AuthInfo{
+		Enabled: true,
+		Users: []common.AuthUser{
+			{
+				Name:         common.DefaultAuthUser,
+				PasswordHash: common.HashAuthPassword("default_pass"),
+				ACLs:         []common.AuthACL{{Namespace: common.AuthMatchAll}},
+			},
+			{
+				Name:         "test_user",
+				PasswordHash: common.HashAuthPassword("test_pass"),
+				ACLs: []common.AuthACL{
+					{Namespace: "default", Tables: []string{"test_auth"}},
+					{Namespace: "default", Tables: []string{"test_auth_ro"}, ReadOnly: true},
+				},
+			},
+		},
+	})
+
+	c2 := getTestConn(t)
+	defer c2.Close()
+	_, err = goredis.String(c2.Do("get", key1))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "NOAUTH"))
+	_, err = goredis.String(c2.Do("ping"))
+	assert.NotNil(t, err)
+
+	_, err = goredis.String(c2.Do("auth", "wrong_pass"))
+	assert.NotNil(t, err)
+	_, err = goredis.String(c2.Do("get", key1))
+	assert.NotNil(t, err)
+
+	_, err = goredis.String(c2.Do("auth", "default_pass"))
+	assert.Nil(t, err)
+	v, err := goredis.String(c2.Do("get", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+
+	_, err = goredis.String(c2.Do("auth", "test_user", "test_pass"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c2.Do("set", key1, "2"))
+	assert.Nil(t, err)
+	_, err = goredis.String(c2.Do("set", key2, "2"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "NOPERM"))
+	_, err = goredis.String(c2.Do("get", key2))
+	assert.Equal(t, goredis.ErrNil, err)
+	_, err = goredis.String(c2.Do("get", "default:test:a"))
+	assert.NotNil(t, err)
+	_, err = goredis.Int(c2.Do("del", key1, key2))
+	assert.NotNil(t, err)
+	n, err := goredis.Int(c2.Do("exists", key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
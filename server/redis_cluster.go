@@ -0,0 +1,353 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/cluster"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var (
+	errClusterDisabled   = errors.New("ERR This instance has cluster support disabled")
+	errClusterSubCommand = errors.New("ERR unknown subcommand or wrong number of arguments for 'cluster' command")
+)
+
+type redisClusterSlotRange struct {
+	start int
+	end   int
+}
+
+// the keys in the redis cluster namespace are placed by the slot, and each partition owns
+// a contiguous block of the slots, the partition may own no slot if more than 16384 partitions.
+func partitionSlotRanges(pid int, partNum int) []redisClusterSlotRange {
+	// the first slot with slot * partNum >= pid * 16384
+	start := (pid*common.RedisClusterSlots + partNum - 1) / partNum
+	end := ((pid+1)*common.RedisClusterSlots+partNum-1)/partNum - 1
+	if end < start {
+		return nil
+	}
+	return []redisClusterSlotRange{{start: start, end: end}}
+}
+
+type redisClusterNode struct {
+	// the 40 characters id as the redis cluster node
+	id   string
+	ip   string
+	port int
+}
+
+func newRedisClusterNode(nid string, ip string, port string) *redisClusterNode {
+	h := sha1.Sum([]byte(nid))
+	p, _ := strconv.Atoi(port)
+	return &redisClusterNode{
+		id:   hex.EncodeToString(h[:]),
+		ip:   ip,
+		port: p,
+	}
+}
+
+func (rn *redisClusterNode) addr() string {
+	return net.JoinHostPort(rn.ip, strconv.Itoa(rn.port))
+}
+
+type redisClusterPartition struct {
+	slots []redisClusterSlotRange
+	// nil if no leader
+	leader   *redisClusterNode
+	replicas []*redisClusterNode
+}
+
+func (s *Server) myRedisClusterNode() *redisClusterNode {
+	port := strconv.Itoa(s.conf.RedisAPIPort)
+	if s.dataCoord != nil {
+		return newRedisClusterNode(s.dataCoord.GetMyID(), s.conf.BroadcastAddr, port)
+	}
+	return newRedisClusterNode(net.JoinHostPort(s.conf.BroadcastAddr, port), s.conf.BroadcastAddr, port)
+}
+
+// get the partitions of the namespace ordered by the partition id, and the slot range for each partition.
+func (s *Server) getRedisClusterPartitions(ns string) ([]redisClusterPartition, error) {
+	if s.dataCoord == nil {
+		// all the partitions are in local while no cluster
+		nodes, err := s.nsMgr.GetNamespaceNodes(ns, false)
+		if err != nil {
+			return nil, err
+		}
+		me := s.myRedisClusterNode()
+		parts := make([]redisClusterPartition, len(nodes))
+		for i := range parts {
+			parts[i].slots = partitionSlotRanges(i, len(parts))
+			parts[i].leader = me
+		}
+		return parts, nil
+	}
+	nsParts, err := s.dataCoord.GetNamespacePartitions(ns)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]redisClusterPartition, len(nsParts))
+	for i, p := range nsParts {
+		parts[i].slots = partitionSlotRanges(i, len(parts))
+		leader := p.GetRealLeader()
+		for _, nid := range p.GetISR() {
+			ip, _, port, _ := cluster.ExtractNodeInfoFromID(nid)
+			n := newRedisClusterNode(nid, ip, port)
+			if nid == leader {
+				parts[i].leader = n
+			} else {
+				parts[i].replicas = append(parts[i].replicas, n)
+			}
+		}
+	}
+	return parts, nil
+}
+
+// check whether the key should be redirected to the partition leader on the other node. MOVED is used
+// for the redis cluster namespace since the slot of the key is owned by the partition, so the client
+// can update the slot mapping. Otherwise ASK is used to redirect only this request.
+func (s *Server) checkRedisClusterRedirect(ns string, pk []byte, pkSum int, key []byte) error {
+	if s.conf.RedisClusterNamespace == "" {
+		return nil
+	}
+	n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, pkSum)
+	if err == nil && n.Node.IsLead() {
+		return nil
+	}
+	parts, err := s.getRedisClusterPartitions(ns)
+	if err != nil || len(parts) == 0 {
+		// let the request handled as normal
+		return nil
+	}
+	pid := s.nsMgr.GetPartitionID(ns, pk, pkSum, len(parts))
+	return redisClusterRedirect(parts[pid].leader, s.myRedisClusterNode(),
+		common.KeyHashSlot(key), ns == s.conf.RedisClusterNamespace)
+}
+
+func redisClusterRedirect(leader *redisClusterNode, me *redisClusterNode, slot int, slotOwned bool) error {
+	if leader == nil || leader.id == me.id {
+		return nil
+	}
+	if slotOwned {
+		return fmt.Errorf("MOVED %d %s", slot, leader.addr())
+	}
+	return fmt.Errorf("ASK %d %s", slot, leader.addr())
+}
+
+func writeRedisClusterNode(conn redcon.Conn, n *redisClusterNode) {
+	conn.WriteArray(3)
+	conn.WriteBulkString(n.ip)
+	conn.WriteInt(n.port)
+	conn.WriteBulkString(n.id)
+}
+
+// cluster slots|shards|nodes|info|myid|keyslot
+func (s *Server) doRedisClusterCmd(conn redcon.Conn, cmd redcon.Command) {
+	if s.conf.RedisClusterNamespace == "" {
+		conn.WriteError(errClusterDisabled.Error())
+		return
+	}
+	if len(cmd.Args) < 2 {
+		conn.WriteError(errClusterSubCommand.Error())
+		return
+	}
+	subCmd := strings.ToLower(string(cmd.Args[1]))
+	switch subCmd {
+	case "myid":
+		conn.WriteBulkString(s.myRedisClusterNode().id)
+		return
+	case "keyslot":
+		if len(cmd.Args) != 3 {
+			conn.WriteError(errClusterSubCommand.Error())
+			return
+		}
+		conn.WriteInt(common.KeyHashSlot(cmd.Args[2]))
+		return
+	}
+	parts, err := s.getRedisClusterPartitions(s.conf.RedisClusterNamespace)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	switch subCmd {
+	case "slots":
+		s.writeRedisClusterSlots(conn, parts)
+	case "shards":
+		s.writeRedisClusterShards(conn, parts)
+	case "nodes":
+		conn.WriteBulkString(s.getRedisClusterNodes(parts))
+	case "info":
+		conn.WriteBulkString(s.getRedisClusterInfo(parts))
+	default:
+		conn.WriteError(errClusterSubCommand.Error())
+	}
+}
+
+func (s *Server) writeRedisClusterSlots(conn redcon.Conn, parts []redisClusterPartition) {
+	cnt := 0
+	for _, p := range parts {
+		if p.leader != nil {
+			cnt += len(p.slots)
+		}
+	}
+	conn.WriteArray(cnt)
+	for _, p := range parts {
+		if p.leader == nil {
+			continue
+		}
+		for _, sr := range p.slots {
+			conn.WriteArray(3 + len(p.replicas))
+			conn.WriteInt(sr.start)
+			conn.WriteInt(sr.end)
+			writeRedisClusterNode(conn, p.leader)
+			for _, r := range p.replicas {
+				writeRedisClusterNode(conn, r)
+			}
+		}
+	}
+}
+
+func (s *Server) writeRedisClusterShards(conn redcon.Conn, parts []redisClusterPartition) {
+	conn.WriteArray(len(parts))
+	for _, p := range parts {
+		conn.WriteArray(4)
+		conn.WriteBulkString("slots")
+		conn.WriteArray(2 * len(p.slots))
+		for _, sr := range p.slots {
+			conn.WriteInt(sr.start)
+			conn.WriteInt(sr.end)
+		}
+		conn.WriteBulkString("nodes")
+		nodes := p.replicas
+		if p.leader != nil {
+			nodes = append([]*redisClusterNode{p.leader}, p.replicas...)
+		}
+		conn.WriteArray(len(nodes))
+		for _, n := range nodes {
+			role := "replica"
+			if n == p.leader {
+				role = "master"
+			}
+			conn.WriteArray(14)
+			conn.WriteBulkString("id")
+			conn.WriteBulkString(n.id)
+			conn.WriteBulkString("port")
+			conn.WriteInt(n.port)
+			conn.WriteBulkString("ip")
+			conn.WriteBulkString(n.ip)
+			conn.WriteBulkString("endpoint")
+			conn.WriteBulkString(n.ip)
+			conn.WriteBulkString("role")
+			conn.WriteBulkString(role)
+			conn.WriteBulkString("replication-offset")
+			conn.WriteInt(0)
+			conn.WriteBulkString("health")
+			conn.WriteBulkString("online")
+		}
+	}
+}
+
+// the node may be the leader of some partitions and the follower of other partitions, since
+// the redis cluster node can not be both master and replica, all the nodes are shown as master
+// with the slots of the partitions they lead.
+func (s *Server) getRedisClusterNodes(parts []redisClusterPartition) string {
+	me := s.myRedisClusterNode()
+	nodes := make([]*redisClusterNode, 0)
+	nodeSlots := make(map[string][]string)
+	addNode := func(n *redisClusterNode) {
+		if _, ok := nodeSlots[n.id]; !ok {
+			nodes = append(nodes, n)
+			nodeSlots[n.id] = nil
+		}
+	}
+	for _, p := range parts {
+		if p.leader != nil {
+			addNode(p.leader)
+			for _, sr := range p.slots {
+				slots := strconv.Itoa(sr.start)
+				if sr.end != sr.start {
+					slots += "-" + strconv.Itoa(sr.end)
+				}
+				nodeSlots[p.leader.id] = append(nodeSlots[p.leader.id], slots)
+			}
+		}
+		for _, r := range p.replicas {
+			addNode(r)
+		}
+	}
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		flags := "master"
+		if n.id == me.id {
+			flags = "myself,master"
+		}
+		buf.WriteString(fmt.Sprintf("%s %s@%d %s - 0 0 0 connected", n.id, n.addr(), n.port+10000, flags))
+		for _, slots := range nodeSlots[n.id] {
+			buf.WriteString(" ")
+			buf.WriteString(slots)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func (s *Server) getRedisClusterInfo(parts []redisClusterPartition) string {
+	assigned := 0
+	masters := make(map[string]bool)
+	nodes := make(map[string]bool)
+	for _, p := range parts {
+		if p.leader != nil {
+			for _, sr := range p.slots {
+				assigned += sr.end - sr.start + 1
+			}
+			masters[p.leader.id] = true
+			nodes[p.leader.id] = true
+		}
+		for _, r := range p.replicas {
+			nodes[r.id] = true
+		}
+	}
+	state := "ok"
+	if assigned < common.RedisClusterSlots {
+		state = "fail"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("cluster_state:" + state + "\r\n")
+	buf.WriteString("cluster_slots_assigned:" + strconv.Itoa(assigned) + "\r\n")
+	buf.WriteString("cluster_slots_ok:" + strconv.Itoa(assigned) + "\r\n")
+	buf.WriteString("cluster_slots_pfail:0\r\n")
+	buf.WriteString("cluster_slots_fail:" + strconv.Itoa(common.RedisClusterSlots-assigned) + "\r\n")
+	buf.WriteString("cluster_known_nodes:" + strconv.Itoa(len(nodes)) + "\r\n")
+	buf.WriteString("cluster_size:" + strconv.Itoa(len(masters)) + "\r\n")
+	return buf.String()
+}
+
+// asking, readonly and readwrite are sent by the cluster client, since the request will
+// always be handled if this node is the partition leader, we just reply OK.
+func (s *Server) doRedisClusterConnCmd(conn redcon.Conn) {
+	if s.conf.RedisClusterNamespace == "" {
+		conn.WriteError(errClusterDisabled.Error())
+		return
+	}
+	conn.WriteString("OK")
+}
+
+// check the redirect by the first key for the merge command, the keys in the
+// other partitions will be handled as the normal merge command.
+func (s *Server) checkRedisClusterRedirectForKey(cmdName string, cmd redcon.Command) error {
+	if s.conf.RedisClusterNamespace == "" {
+		return nil
+	}
+	ns, pk, pkSum, err := GetPKAndHashSum(cmdName, cmd)
+	if err != nil {
+		return nil
+	}
+	return s.checkRedisClusterRedirect(ns, pk, pkSum, cmd.Args[1])
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+// record the reply of the cluster command as the redis client
+type clusterReplyConn struct {
+	redcon.Conn
+	rsp []interface{}
+}
+
+func (c *clusterReplyConn) WriteArray(count int)        { c.rsp = append(c.rsp, count) }
+func (c *clusterReplyConn) WriteInt(num int)            { c.rsp = append(c.rsp, num) }
+func (c *clusterReplyConn) WriteBulkString(bulk string) { c.rsp = append(c.rsp, bulk) }
+
+func TestRedisClusterSlotRange(t *testing.T) {
+	for _, partNum := range []int{1, 3, 8, 16, 100, 1000} {
+		owners := make([]int, common.RedisClusterSlots)
+		for i := range owners {
+			owners[i] = -1
+		}
+		for pid := 0; pid < partNum; pid++ {
+			ranges := partitionSlotRanges(pid, partNum)
+			// each partition owns one contiguous block
+			assert.Equal(t, 1, len(ranges))
+			for _, sr := range ranges {
+				assert.True(t, sr.end >= sr.start)
+				for slot := sr.start; slot <= sr.end; slot++ {
+					assert.Equal(t, -1, owners[slot])
+					owners[slot] = pid
+				}
+			}
+		}
+		for slot, pid := range owners {
+			assert.Equal(t, common.SlotPartition(slot, partNum), pid)
+		}
+	}
+	assert.Equal(t, []redisClusterSlotRange{{0, common.RedisClusterSlots - 1}}, partitionSlotRanges(0, 1))
+	assert.Equal(t, []redisClusterSlotRange{{0, 5461}}, partitionSlotRanges(0, 3))
+	assert.Equal(t, []redisClusterSlotRange{{5462, 10922}}, partitionSlotRanges(1, 3))
+	assert.Equal(t, []redisClusterSlotRange{{10923, 16383}}, partitionSlotRanges(2, 3))
+	// no slot for some partitions if more partitions than slots
+	assert.Equal(t, 0, len(partitionSlotRanges(1, common.RedisClusterSlots*2)))
+	assert.Equal(t, []redisClusterSlotRange{{1, 1}}, partitionSlotRanges(2, common.RedisClusterSlots*2))
+}
+
+func TestRedisClusterSlotsNoRedirect(t *testing.T) {
+	ns := "test_cluster"
+	for _, partNum := range []int{1, 3, 8} {
+		parts := make([]redisClusterPartition, partNum)
+		nodes := make(map[string]*redisClusterNode)
+		for i := range parts {
+			parts[i].slots = partitionSlotRanges(i, partNum)
+			port := strconv.Itoa(6000 + i)
+			parts[i].leader = newRedisClusterNode("127.0.0.1:"+port, "127.0.0.1", port)
+			nodes[parts[i].leader.addr()] = parts[i].leader
+			replicaPort := strconv.Itoa(7000 + i)
+			parts[i].replicas = append(parts[i].replicas,
+				newRedisClusterNode("127.0.0.1:"+replicaPort, "127.0.0.1", replicaPort))
+		}
+		conn := &clusterReplyConn{}
+		(&Server{}).writeRedisClusterSlots(conn, parts)
+
+		// build the slot mapping from the cluster slots reply as the client
+		slotNodes := make([]string, common.RedisClusterSlots)
+		rsp := conn.rsp
+		cnt := rsp[0].(int)
+		rsp = rsp[1:]
+		for i := 0; i < cnt; i++ {
+			nodeNum := rsp[0].(int) - 2
+			start, end := rsp[1].(int), rsp[2].(int)
+			rsp = rsp[3:]
+			// the first node is the master
+			addr := fmt.Sprintf("%v:%v", rsp[1], rsp[2])
+			for slot := start; slot <= end; slot++ {
+				assert.Equal(t, "", slotNodes[slot])
+				slotNodes[slot] = addr
+			}
+			rsp = rsp[4*nodeNum:]
+		}
+		assert.Equal(t, 0, len(rsp))
+
+		for i := 0; i < 1000; i++ {
+			pk := []byte("key" + strconv.Itoa(i))
+			if i%2 == 0 {
+				pk = []byte("{user" + strconv.Itoa(i) + "}:key")
+			}
+			rawKey := []byte(ns + ":" + string(pk))
+			slot := common.KeyHashSlot(rawKey)
+			target := nodes[slotNodes[slot]]
+			assert.NotNil(t, target, "slot %v not mapped", slot)
+			assert.Equal(t, slot, node.SlotHashedKey(ns, pk))
+			pid := common.SlotPartition(slot, partNum)
+			assert.Equal(t, parts[pid].leader, target)
+			assert.Nil(t, redisClusterRedirect(parts[pid].leader, target, slot, true))
+		}
+	}
+	leader := newRedisClusterNode("127.0.0.1:6000", "127.0.0.1", "6000")
+	me := newRedisClusterNode("127.0.0.1:6001", "127.0.0.1", "6001")
+	assert.Equal(t, "MOVED 100 127.0.0.1:6000", redisClusterRedirect(leader, me, 100, true).Error())
+	assert.Equal(t, "ASK 100 127.0.0.1:6000", redisClusterRedirect(leader, me, 100, false).Error())
+	assert.Nil(t, redisClusterRedirect(nil, me, 100, true))
+}
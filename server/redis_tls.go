@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/redcon"
+)
+
+var errRedisConnDetached = errors.New("redis connection detached")
+
+type redisListenServer interface {
+	ListenAndServe() error
+	Close() error
+	SetIdleClose(dur time.Duration)
+}
+
+// tlsRedisServer serve the redis protocol on the tls listener, the connection
+// handling is the same as the redcon server which only serve the plain tcp.
+type tlsRedisServer struct {
+	addr      string
+	tlsConf   *tls.Config
+	handler   func(conn redcon.Conn, cmd redcon.Command)
+	accept    func(conn redcon.Conn) bool
+	closed    func(conn redcon.Conn, err error)
+	mu        sync.Mutex
+	ln        net.Listener
+	conns     map[*tlsRedisConn]bool
+	done      bool
+	idleClose time.Duration
+}
+
+func newTLSRedisServer(addr string, tlsConf *tls.Config,
+	handler func(conn redcon.Conn, cmd redcon.Command),
+	accept func(conn redcon.Conn) bool,
+	closed func(conn redcon.Conn, err error),
+) *tlsRedisServer {
+	return &tlsRedisServer{
+		addr:    addr,
+		tlsConf: tlsConf,
+		handler: handler,
+		accept:  accept,
+		closed:  closed,
+		conns:   make(map[*tlsRedisConn]bool),
+	}
+}
+
+func (s *tlsRedisServer) SetIdleClose(dur time.Duration) {
+	s.mu.Lock()
+	s.idleClose = dur
+	s.mu.Unlock()
+}
+
+func (s *tlsRedisServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return errors.New("not serving")
+	}
+	s.done = true
+	return s.ln.Close()
+}
+
+func (s *tlsRedisServer) ListenAndServe() error {
+	lc := net.ListenConfig{KeepAlive: 10 * time.Second}
+	tcpLn, err := lc.Listen(context.Background(), "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	ln := tls.NewListener(tcpLn, s.tlsConf)
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	defer func() {
+		ln.Close()
+		s.mu.Lock()
+		for c := range s.conns {
+			c.conn.Close()
+		}
+		s.conns = nil
+		s.mu.Unlock()
+	}()
+	for {
+		lnconn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			done := s.done
+			s.mu.Unlock()
+			if done {
+				return nil
+			}
+			return err
+		}
+		c := &tlsRedisConn{
+			conn: lnconn,
+			addr: lnconn.RemoteAddr().String(),
+			wr:   redcon.NewWriter(lnconn),
+			rd:   redcon.NewReader(lnconn),
+		}
+		s.mu.Lock()
+		c.idleClose = s.idleClose
+		s.conns[c] = true
+		s.mu.Unlock()
+		if s.accept != nil && !s.accept(c) {
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+			continue
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *tlsRedisServer) handle(c *tlsRedisConn) {
+	var err error
+	defer func() {
+		if err != errRedisConnDetached {
+			c.conn.Close()
+		}
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		if s.closed != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			s.closed(c, err)
+		}
+	}()
+
+	err = func() error {
+		for {
+			if c.idleClose != 0 {
+				c.conn.SetReadDeadline(time.Now().Add(c.idleClose))
+			}
+			cmds, err := c.rd.ReadCommands()
+			if err != nil {
+				if _, ok := err.(net.Error); !ok && err != io.EOF {
+					c.wr.WriteError("ERR " + err.Error())
+					c.wr.Flush()
+				}
+				return err
+			}
+			c.cmds = cmds
+			for len(c.cmds) > 0 {
+				cmd := c.cmds[0]
+				if len(c.cmds) == 1 {
+					c.cmds = nil
+				} else {
+					c.cmds = c.cmds[1:]
+				}
+				s.handler(c, cmd)
+			}
+			if c.detached {
+				return errRedisConnDetached
+			}
+			if c.closed {
+				return nil
+			}
+			if err := c.wr.Flush(); err != nil {
+				return err
+			}
+		}
+	}()
+}
+
+type tlsRedisConn struct {
+	conn      net.Conn
+	wr        *redcon.Writer
+	rd        *redcon.Reader
+	addr      string
+	ctx       interface{}
+	detached  bool
+	closed    bool
+	cmds      []redcon.Command
+	idleClose time.Duration
+}
+
+func (c *tlsRedisConn) Close() error {
+	c.wr.Flush()
+	c.closed = true
+	return c.conn.Close()
+}
+func (c *tlsRedisConn) Context() interface{}        { return c.ctx }
+func (c *tlsRedisConn) SetContext(v interface{})    { c.ctx = v }
+func (c *tlsRedisConn) SetReadBuffer(n int)         {}
+func (c *tlsRedisConn) WriteString(str string)      { c.wr.WriteString(str) }
+func (c *tlsRedisConn) WriteBulk(bulk []byte)       { c.wr.WriteBulk(bulk) }
+func (c *tlsRedisConn) WriteBulkString(bulk string) { c.wr.WriteBulkString(bulk) }
+func (c *tlsRedisConn) WriteInt(num int)            { c.wr.WriteInt(num) }
+func (c *tlsRedisConn) WriteInt64(num int64)        { c.wr.WriteInt64(num) }
+func (c *tlsRedisConn) WriteError(msg string)       { c.wr.WriteError(msg) }
+func (c *tlsRedisConn) WriteArray(count int)        { c.wr.WriteArray(count) }
+func (c *tlsRedisConn) WriteNull()                  { c.wr.WriteNull() }
+func (c *tlsRedisConn) WriteRaw(data []byte)        { c.wr.WriteRaw(data) }
+func (c *tlsRedisConn) Flush() error                { return c.wr.Flush() }
+func (c *tlsRedisConn) RemoteAddr() string          { return c.addr }
+func (c *tlsRedisConn) NetConn() net.Conn           { return c.conn }
+func (c *tlsRedisConn) ReadPipeline() []redcon.Command {
+	cmds := c.cmds
+	c.cmds = nil
+	return cmds
+}
+func (c *tlsRedisConn) PeekPipeline() []redcon.Command {
+	return c.cmds
+}
+
+func (c *tlsRedisConn) Detach() redcon.DetachedConn {
+	c.detached = true
+	cmds := c.cmds
+	c.cmds = nil
+	return &tlsRedisDetachedConn{tlsRedisConn: c, cmds: cmds}
+}
+
+type tlsRedisDetachedConn struct {
+	*tlsRedisConn
+	cmds []redcon.Command
+}
+
+func (dc *tlsRedisDetachedConn) ReadCommand() (redcon.Command, error) {
+	if dc.closed {
+		return redcon.Command{}, errors.New("closed")
+	}
+	if len(dc.cmds) > 0 {
+		cmd := dc.cmds[0]
+		dc.cmds = dc.cmds[1:]
+		return cmd, nil
+	}
+	return dc.rd.ReadCommand()
+}
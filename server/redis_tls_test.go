@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/absolute8511/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/pkg/transport"
+)
+
+func TestTLSRedisServer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "redis-tls-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	info, err := transport.SelfCert(tmpDir, []string{"127.0.0.1:0"})
+	assert.Nil(t, err)
+	reloader, err := common.NewTLSReloader(common.TLSConfig{CertFile: info.CertFile, KeyFile: info.KeyFile})
+	assert.Nil(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	detachedC := make(chan struct{})
+	redisS := newTLSRedisServer(addr, reloader.ServerConfig(), func(conn redcon.Conn, cmd redcon.Command) {
+		switch qcmdlower(cmd.Args[0]) {
+		case "ping":
+			conn.WriteString("PONG")
+		case "echo":
+			conn.WriteBulk(cmd.Args[1])
+		case "detach":
+			dconn := conn.Detach()
+			go func() {
+				defer dconn.Close()
+				dconn.WriteString("OK")
+				dconn.Flush()
+				cmd, err := dconn.ReadCommand()
+				if err == nil {
+					dconn.WriteBulk(cmd.Args[0])
+					dconn.Flush()
+				}
+				close(detachedC)
+			}()
+		default:
+			conn.WriteError("ERR unknown command")
+		}
+	}, nil, nil)
+	redisS.SetIdleClose(time.Minute)
+	go redisS.ListenAndServe()
+	defer redisS.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	// the plain connection can not be served
+	c, err := redis.Dial("tcp", addr, redis.DialReadTimeout(time.Second))
+	assert.Nil(t, err)
+	_, err = c.Do("ping")
+	assert.NotNil(t, err)
+	c.Close()
+
+	c, err = redis.Dial("tcp", addr, redis.DialNetDial(func(network, addr string) (net.Conn, error) {
+		return tls.Dial(network, addr, &tls.Config{InsecureSkipVerify: true})
+	}))
+	assert.Nil(t, err)
+	defer c.Close()
+	rsp, err := redis.String(c.Do("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", rsp)
+	// pipeline
+	c.Send("echo", "a")
+	c.Send("echo", "b")
+	c.Flush()
+	rsp, err = redis.String(c.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, "a", rsp)
+	rsp, err = redis.String(c.Receive())
+	assert.Nil(t, err)
+	assert.Equal(t, "b", rsp)
+	_, err = c.Do("unknown")
+	assert.NotNil(t, err)
+
+	rsp, err = redis.String(c.Do("detach"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", rsp)
+	rsp, err = redis.String(c.Do("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", rsp)
+	<-detachedC
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+var (
+	errScriptNotFound       = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	errScriptNumKeys        = errors.New("ERR value is not an integer or out of range")
+	errScriptNumKeysTooMany = errors.New("ERR Number of keys can't be greater than number of args")
+	errScriptCrossPartition = errors.New("ERR all the keys in the script should be in the same partition")
+	errScriptSubCommand     = errors.New("ERR unknown subcommand or wrong number of arguments for 'script' command")
+)
+
+const maxScriptCacheNum = 10000
+
+// the scripts loaded on this server for evalsha, the script body is always
+// proposed to the raft so the other servers do not need the same cache.
+type scriptCache struct {
+	sync.RWMutex
+	scripts map[string]string
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{
+		scripts: make(map[string]string),
+	}
+}
+
+func (sc *scriptCache) load(script string) string {
+	sha := node.ScriptSHA1(script)
+	sc.Lock()
+	if _, ok := sc.scripts[sha]; !ok {
+		if len(sc.scripts) >= maxScriptCacheNum {
+			sLog.Infof("too much scripts cached, flush all")
+			sc.scripts = make(map[string]string)
+		}
+		sc.scripts[sha] = script
+	}
+	sc.Unlock()
+	return sha
+}
+
+func (sc *scriptCache) get(sha string) (string, bool) {
+	sc.RLock()
+	script, ok := sc.scripts[strings.ToLower(sha)]
+	sc.RUnlock()
+	return script, ok
+}
+
+func (sc *scriptCache) flush() {
+	sc.Lock()
+	sc.scripts = make(map[string]string)
+	sc.Unlock()
+}
+
+// script load script
+// script exists sha1 [sha1 ...]
+// script flush
+func (s *Server) doScriptCmd(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 2 {
+		conn.WriteError(errScriptSubCommand.Error())
+		return
+	}
+	switch strings.ToLower(string(cmd.Args[1])) {
+	case "load":
+		if len(cmd.Args) != 3 {
+			conn.WriteError(errScriptSubCommand.Error())
+			return
+		}
+		script := string(cmd.Args[2])
+		// reject the invalid script here as redis does
+		if _, err := node.CompileScript(script); err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteBulkString(s.scripts.load(script))
+	case "exists":
+		conn.WriteArray(len(cmd.Args) - 2)
+		for _, sha := range cmd.Args[2:] {
+			if _, ok := s.scripts.get(string(sha)); ok {
+				conn.WriteInt(1)
+			} else {
+				conn.WriteInt(0)
+			}
+		}
+	case "flush":
+		s.scripts.flush()
+		conn.WriteString("OK")
+	default:
+		conn.WriteError(errScriptSubCommand.Error())
+	}
+}
+
+// eval script numkeys key [key ...] [arg ...]
+// evalsha sha1 numkeys key [key ...] [arg ...]
+// all the keys should be declared and in the same partition, the script will be
+// proposed to the raft and run on the state machine.
+func (s *Server) doEvalCmd(conn redcon.Conn, authUser *common.AuthUser, cmdName string, cmd redcon.Command) {
+	if len(cmd.Args) < 3 {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	numKeys, err := strconv.Atoi(string(cmd.Args[2]))
+	if err != nil || numKeys < 0 {
+		conn.WriteError(errScriptNumKeys.Error())
+		return
+	}
+	if numKeys > len(cmd.Args)-3 {
+		conn.WriteError(errScriptNumKeysTooMany.Error())
+		return
+	}
+	if numKeys == 0 {
+		conn.WriteError(node.ErrScriptNoKeys.Error())
+		return
+	}
+	var script string
+	if cmdName == "evalsha" {
+		var ok bool
+		script, ok = s.scripts.get(string(cmd.Args[1]))
+		if !ok {
+			conn.WriteError(errScriptNotFound.Error())
+			return
+		}
+	} else {
+		script = string(cmd.Args[1])
+	}
+	// the command buffer will be reused by the connection, so we need copy the keys and args
+	keys := make([][]byte, 0, numKeys)
+	for _, k := range cmd.Args[3 : 3+numKeys] {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	args := make([][]byte, 0, len(cmd.Args)-3-numKeys)
+	for _, arg := range cmd.Args[3+numKeys:] {
+		args = append(args, append([]byte(nil), arg...))
+	}
+	if err := checkUserAccessKeys(authUser, keys, true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if node.IsSyncerOnly() {
+		conn.WriteError("The cluster is only allowing syncer write : ERR handle command " + cmdName)
+		return
+	}
+	var kvn *node.KVNode
+	tables := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ns, pk, err := common.ExtractNamesapce(k)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, node.HashedKey(pk))
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		if kvn == nil {
+			kvn = n.Node
+		} else if kvn != n.Node {
+			conn.WriteError(errScriptCrossPartition.Error())
+			return
+		}
+		table, _, _ := common.ExtractTable(pk)
+		tables = append(tables, string(table))
+	}
+	if !kvn.IsLead() {
+		conn.WriteError(node.ErrNamespaceNotLeader.Error())
+		return
+	}
+	if err := kvn.CheckMultiQuota([]string{cmdName}, tables, true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if cmdName == "eval" {
+		s.scripts.load(script)
+	}
+	start := time.Now()
+	rsp, err := kvn.EvalScript(script, keys, args)
+	var v interface{}
+	if err == nil {
+		v, err = rsp.WaitRsp()
+	}
+	cost := time.Since(start)
+	kvn.UpdateWriteStats(0, cost.Microseconds())
+	if cost >= slowClusterWriteLogTime {
+		sLog.Infof("slow script %v with %v keys cost %v", node.ScriptSHA1(script), len(keys), cost)
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	writeRedisRsp(conn, v)
+}
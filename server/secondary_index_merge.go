@@ -9,16 +9,20 @@ import (
 	"github.com/absolute8511/redcon"
 )
 
-func isValidPostSearchCmd(cmd string) bool {
+func isValidPostSearchCmd(searchCmd string, cmd string) bool {
+	if searchCmd == "jidx.from" {
+		return cmd == "json.get"
+	}
 	return cmd == "hget" || cmd == "hmget" || cmd == "hgetall"
 }
 
 // HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// JIDX.FROM ns:table where "path > 1 and path < 2" [LIMIT offset num] [JSON.GET $ path1 path2]
 func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 	var postCmd string
 	if len(cmd.Args) >= 5 {
 		postCmd = string(cmd.Args[4])
-		if !isValidPostSearchCmd(postCmd) {
+		if !isValidPostSearchCmd(qcmdlower(cmd.Args[0]), postCmd) {
 			conn.WriteError(common.ErrInvalidArgs.Error())
 			return
 		}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -29,6 +31,7 @@ import (
 	"github.com/youzan/ZanRedisDB/pkg/types"
 	"github.com/youzan/ZanRedisDB/raft"
 	"github.com/youzan/ZanRedisDB/raft/raftpb"
+	"github.com/youzan/ZanRedisDB/rockredis"
 	"github.com/youzan/ZanRedisDB/stats"
 	"github.com/youzan/ZanRedisDB/transport/rafthttp"
 	"golang.org/x/net/context"
@@ -36,11 +39,15 @@ import (
 
 var (
 	errRaftGroupNotReady = errors.New("raft group not ready")
+	errCDCRoleRequired   = errors.New("the change data capture is only served by the cdc learner")
+	errCrossPartition    = errors.New("ERR all the keys in the command should be in the same partition")
+	errBitOpSyntax       = errors.New("ERR syntax error for BITOP, the operation should be AND, OR, XOR or NOT")
 )
 
 const (
 	slowClusterWriteLogTime = time.Millisecond * 500
 	slowPreWaitQueueTime    = time.Second * 2
+	followerReadTimeout     = time.Second * 3
 )
 
 var sLog = common.NewLevelLogger(common.LOG_INFO, common.NewLogger())
@@ -80,6 +87,11 @@ type Server struct {
 	startTime     time.Time
 	maxScanJob    int32
 	scanStats     metric.ScanStats
+	authInfo      atomic.Value
+	pubSub        *pubSubHub
+	pubSubFwd     *pubSubForwarder
+	scripts       *scriptCache
+	tlsReloader   *common.TLSReloader
 }
 
 func NewServer(conf ServerConfig) (*Server, error) {
@@ -112,6 +124,12 @@ func NewServer(conf ServerConfig) (*Server, error) {
 	if conf.SlowLimiterRefuseCostMs > 0 {
 		node.ChangeSlowRefuseCost(conf.SlowLimiterRefuseCostMs)
 	}
+	if conf.ActiveActiveSync {
+		if conf.SyncerWriteOnly {
+			return nil, errors.New("active active sync can not be enabled with syncer write only")
+		}
+		node.SetActiveActiveSync(true)
+	}
 
 	myNode := &cluster.NodeInfo{
 		NodeIP:      conf.BroadcastAddr,
@@ -160,6 +178,26 @@ func NewServer(conf ServerConfig) (*Server, error) {
 		conf:       conf,
 		startTime:  time.Now(),
 		maxScanJob: conf.MaxScanJob,
+		pubSub:     newPubSubHub(),
+		pubSubFwd:  newPubSubForwarder(),
+		scripts:    newScriptCache(),
+	}
+
+	s.initLocalAuthInfo()
+	if conf.KeyspaceNotify {
+		node.SetKeyspaceNotifier(s.notifyKeyspaceEvent)
+	}
+	if conf.FollowerRead {
+		atomic.StoreInt32(&allowFollowerRead, 1)
+	}
+
+	if conf.TLS.IsEnabled() {
+		s.tlsReloader, err = common.NewTLSReloader(conf.TLS)
+		if err != nil {
+			sLog.Errorf("failed to load tls certificates: %v", err)
+			return nil, err
+		}
+		common.SetClientTLS(s.tlsReloader.ClientConfig())
 	}
 
 	ts := &stats.TransportStats{}
@@ -173,6 +211,9 @@ func NewServer(conf ServerConfig) (*Server, error) {
 		PeersStats:  stats.NewPeersStats(),
 		ErrorC:      nil,
 	}
+	if s.tlsReloader != nil {
+		s.raftTransport.TLSClientConfig = s.tlsReloader.ClientConfig()
+	}
 	mconf := &node.MachineConfig{
 		BroadcastAddr:     conf.BroadcastAddr,
 		HttpAPIPort:       conf.HttpAPIPort,
@@ -187,9 +228,15 @@ func NewServer(conf ServerConfig) (*Server, error) {
 		LearnerRole:       conf.LearnerRole,
 		RemoteSyncCluster: conf.RemoteSyncCluster,
 		StateMachineType:  conf.StateMachineType,
+		UseRsyncTransfer:  conf.UseRsyncTransfer,
+		RaftLogArchive:    conf.RaftLogArchive,
+		CDCKeepSegments:   conf.CDCKeepSegments,
 		RocksDBOpts:       conf.RocksDBOpts,
 		WALRocksDBOpts:    conf.WALRocksDBOpts,
 	}
+	mconf.RedisClusterNamespace = conf.RedisClusterNamespace
+	mconf.RaftLogArchiveDir = conf.RaftLogArchiveDir
+	mconf.RaftLogArchiveKeepHours = conf.RaftLogArchiveKeepHours
 	if mconf.RocksDBOpts.UseSharedCache || mconf.RocksDBOpts.AdjustThreadPool || mconf.RocksDBOpts.UseSharedRateLimiter {
 		sc, err := engine.NewSharedEngConfig(conf.RocksDBOpts)
 		if err != nil {
@@ -221,6 +268,9 @@ func NewServer(conf ServerConfig) (*Server, error) {
 		}
 		s.raftTransport.ID = types.ID(s.dataCoord.GetMyRegID())
 		s.nsMgr.SetIClusterInfo(s.dataCoord)
+		if err := s.refreshAuthInfo(); err != nil {
+			return nil, err
+		}
 	} else {
 		s.raftTransport.ID = types.ID(myNode.RegID)
 	}
@@ -325,9 +375,15 @@ func (s *Server) Stop() {
 	default:
 	}
 	close(s.stopC)
+	if s.conf.KeyspaceNotify {
+		node.SetKeyspaceNotifier(nil)
+	}
 
 	s.raftTransport.Stop()
 	s.wg.Wait()
+	if s.tlsReloader != nil {
+		s.tlsReloader.Stop()
+	}
 	sLog.Infof("server stopped")
 }
 
@@ -418,6 +474,9 @@ func (s *Server) Start() {
 
 	s.raftTransport.Start()
 	s.stopC = make(chan struct{})
+	if s.tlsReloader != nil {
+		s.tlsReloader.Start()
+	}
 
 	s.wg.Add(1)
 	go func() {
@@ -453,6 +512,16 @@ func (s *Server) Start() {
 		defer s.wg.Done()
 		s.metricLoop(s.stopC)
 	}()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.authRefreshLoop(s.stopC)
+	}()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.pubSubForwardLoop(s.stopC)
+	}()
 	if s.dataCoord != nil {
 		err := s.dataCoord.Start()
 		if err != nil {
@@ -494,6 +563,69 @@ func (s *Server) GetHandleNode(ns string, pk []byte, pkSum int, cmdName string,
 	return n.Node, nil
 }
 
+// bitop operation destkey key [key ...] is rewritten to the internal command
+// bitopand|bitopor|bitopxor|bitopnot destkey key [key ...], so the result is proposed
+// to the partition of the destination key.
+func rewriteBitOpCommand(cmd redcon.Command) (redcon.Command, error) {
+	if len(cmd.Args) < 4 {
+		return cmd, common.ErrInvalidArgs
+	}
+	op := strings.ToLower(string(cmd.Args[1]))
+	switch op {
+	case "and", "or", "xor", "not":
+	default:
+		return cmd, errBitOpSyntax
+	}
+	args := make([][]byte, 0, len(cmd.Args)-1)
+	args = append(args, []byte("bitop"+op))
+	args = append(args, cmd.Args[2:]...)
+	return common.BuildCommand(args), nil
+}
+
+// return the other keys of the write command which should be in the same partition with
+// the first key, and whether the other keys are written.
+func getSamePartitionKeys(cmdName string, cmd redcon.Command) ([][]byte, bool) {
+	if len(cmd.Args) < 3 {
+		return nil, false
+	}
+	switch cmdName {
+	case "smove", "rpoplpush", "lmove":
+		return cmd.Args[2:3], true
+	case "sinterstore", "sunionstore", "sdiffstore", "bitopand", "bitopor", "bitopxor", "bitopnot":
+		return cmd.Args[2:], false
+	case "zunionstore", "zinterstore":
+		return node.ZStoreSrcKeys(cmd.Args), false
+	}
+	return nil, false
+}
+
+// the multi keys write command is proposed to the partition of the first key, so all the
+// other keys should be in the same partition.
+func (s *Server) checkSamePartitionKeys(kvn *node.KVNode, authUser *common.AuthUser,
+	cmdName string, cmd redcon.Command) error {
+	keys, isWrite := getSamePartitionKeys(cmdName, cmd)
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := checkUserAccessKeys(authUser, keys, isWrite); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		ns, pk, err := common.ExtractNamesapce(k)
+		if err != nil {
+			return err
+		}
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, node.HashedKey(pk))
+		if err != nil {
+			return err
+		}
+		if n.Node != kvn {
+			return errCrossPartition
+		}
+	}
+	return nil
+}
+
 func isAllowStaleReadCmd(cmdName string) bool {
 	if strings.HasPrefix(cmdName, "stale.") {
 		return true
@@ -508,13 +640,59 @@ func (s *Server) GetHandler(cmdName string,
 	if !ok {
 		return nil, cmd, common.ErrInvalidCommand
 	}
-	if !kvn.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) && !isAllowStaleReadCmd(cmdName) {
-		// read only to leader to avoid stale read
-		return nil, cmd, node.ErrNamespaceNotLeader
+	if !isAllowStaleReadCmd(cmdName) {
+		if err := checkReadOnNode(kvn); err != nil {
+			return nil, cmd, err
+		}
 	}
 	return h, cmd, nil
 }
 
+// check whether the read can be handled on this node. Read only to leader to avoid stale read,
+// unless stale read is allowed. If follower read is enabled, the follower will get the read index
+// from the leader and wait until the index is applied, so the read is still linearizable.
+func checkReadOnNode(kvn *node.KVNode) error {
+	if kvn.IsLead() || atomic.LoadInt32(&allowStaleRead) != 0 {
+		return nil
+	}
+	if atomic.LoadInt32(&allowFollowerRead) == 0 {
+		return node.ErrNamespaceNotLeader
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), followerReadTimeout)
+	err := kvn.WaitReadIndex(ctx)
+	cancel()
+	if err != nil {
+		metric.FollowerReadCounter.WithLabelValues("failed").Inc()
+		return err
+	}
+	metric.FollowerReadCounter.WithLabelValues("ok").Inc()
+	return nil
+}
+
+// check the read on the partitions in parallel, so the read index for each partition is
+// waited only once at the same time. Return the error for the failed partitions.
+func checkReadOnNodes(nodes map[string]*node.KVNode) map[string]error {
+	errs := make(map[string]error)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, kvn := range nodes {
+		if kvn.IsLead() {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, kvn *node.KVNode) {
+			defer wg.Done()
+			if err := checkReadOnNode(kvn); err != nil {
+				mutex.Lock()
+				errs[name] = err
+				mutex.Unlock()
+			}
+		}(name, kvn)
+	}
+	wg.Wait()
+	return errs
+}
+
 func (s *Server) GetWriteHandler(cmdName string,
 	cmd redcon.Command, kvn *node.KVNode) (common.WriteCommandFunc, redcon.Command, error) {
 	h, ok := kvn.GetWriteHandler(cmdName)
@@ -533,7 +711,14 @@ func (s *Server) serveRaft(stopCh <-chan struct{}) {
 	if err != nil {
 		sLog.Panicf("failed to listen rafthttp : %v", err)
 	}
-	err = (&http.Server{Handler: s.raftTransport.Handler()}).Serve(ln)
+	var l net.Listener = ln
+	if url.Scheme == "https" {
+		if s.tlsReloader == nil {
+			sLog.Panicf("the tls should be configured for the raft address: %v", s.conf.LocalRaftAddr)
+		}
+		l = tls.NewListener(ln, s.tlsReloader.ServerConfig())
+	}
+	err = (&http.Server{Handler: s.raftTransport.Handler()}).Serve(l)
 	select {
 	case <-stopCh:
 	default:
@@ -632,7 +817,8 @@ func (s *Server) GetNsMgr() *node.NamespaceMgr {
 	return s.nsMgr
 }
 
-func (s *Server) handleRedisSingleCmd(cmdName string, pk []byte, pkSum int, kvn *node.KVNode, conn redcon.Conn, cmd redcon.Command) error {
+func (s *Server) handleRedisSingleCmd(cmdName string, ns string, pk []byte, pkSum int, kvn *node.KVNode,
+	authUser *common.AuthUser, conn redcon.Conn, cmd redcon.Command) error {
 	isWrite := false
 	var h common.CommandFunc
 	var wh common.WriteCommandFunc
@@ -645,12 +831,28 @@ func (s *Server) handleRedisSingleCmd(cmdName string, pk []byte, pkSum int, kvn
 		return fmt.Errorf("%s : Err handle command %s", err.Error(), cmdName)
 	}
 
+	if authUser != nil {
+		table, _, _ := common.ExtractTable(pk)
+		err = authUser.CheckAccess(ns, string(table), isWrite)
+		if err != nil {
+			return err
+		}
+	}
 	if isWrite && node.IsSyncerOnly() {
 		return fmt.Errorf("The cluster is only allowing syncer write : ERR handle command %s ", cmdName)
 	}
+	if isWrite {
+		if err := node.CheckActiveActiveCmd(cmdName); err != nil {
+			return err
+		}
+	}
 	if isWrite {
 		s.handleRedisWrite(cmdName, kvn, pk, pkSum, wh, conn, cmd)
 	} else {
+		table, _, _ := common.ExtractTable(pk)
+		if err := kvn.CheckQuota(cmdName, string(table), false); err != nil {
+			return err
+		}
 		metric.ReadCmdCounter.Inc()
 		h(conn, cmd)
 	}
@@ -669,6 +871,10 @@ func (s *Server) handleRedisWrite(cmdName string, kvn *node.KVNode,
 		conn.WriteError(node.ErrSlowLimiterRefused.Error())
 		return
 	}
+	if err := kvn.CheckQuota(cmdName, string(table), true); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
 	var sw *node.SlowWaitDone
 	if kvn.IsLead() {
 		var err error
@@ -720,6 +926,10 @@ func (s *Server) handleRedisWrite(cmdName string, kvn *node.KVNode,
 	if sw != nil {
 		sw.Done()
 	}
+	writeRedisRsp(conn, v)
+}
+
+func writeRedisRsp(conn redcon.Conn, v interface{}) {
 	switch rv := v.(type) {
 	case error:
 		conn.WriteError(rv.Error())
@@ -740,6 +950,14 @@ func (s *Server) handleRedisWrite(cmdName string, kvn *node.KVNode,
 		for _, d := range rv {
 			conn.WriteBulk(d)
 		}
+	case []interface{}:
+		// the nested response from the script
+		conn.WriteArray(len(rv))
+		for _, d := range rv {
+			writeRedisRsp(conn, d)
+		}
+	case []rockredis.StreamEntry:
+		node.WriteStreamEntries(conn, rv)
 	default:
 		// Do we have any other resp arrays for write command which is not [][]byte?
 		conn.WriteError("Invalid response type")
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -617,6 +618,46 @@ func TestReadWriteAfterStopped(t *testing.T) {
 	assert.NotNil(t, leaderNode)
 }
 
+func TestFollowerRead(t *testing.T) {
+	c := getTestClusterConn(t, true)
+	defer c.Close()
+
+	assert.Equal(t, 3, len(kvsCluster))
+	leaderNode := waitForLeader(t, time.Minute)
+	assert.NotNil(t, leaderNode)
+
+	followerPort := 0
+	for _, n := range kvsCluster {
+		replicaNode := n.server.GetNamespaceFromFullName("default-0")
+		if !replicaNode.Node.IsLead() {
+			followerPort = n.redisPort
+			break
+		}
+	}
+	assert.NotEqual(t, 0, followerPort)
+	fc := getTestConnForPort(t, followerPort)
+	defer fc.Close()
+
+	key := "default:test-cluster:follower_read"
+	for i := 0; i < 10; i++ {
+		v := strconv.Itoa(i)
+		rsp, err := goredis.String(c.Do("set", key, v))
+		assert.Nil(t, err)
+		assert.Equal(t, OK, rsp)
+
+		atomic.StoreInt32(&allowFollowerRead, 0)
+		_, err = fc.Do("get", key)
+		assert.NotNil(t, err)
+
+		// the follower read should always see the write just committed on the leader
+		atomic.StoreInt32(&allowFollowerRead, 1)
+		rv, err := goredis.String(fc.Do("get", key))
+		assert.Nil(t, err)
+		assert.Equal(t, v, rv)
+	}
+	atomic.StoreInt32(&allowFollowerRead, 0)
+}
+
 func TestCompactCancelAfterStopped(t *testing.T) {
 	// TODO: stop all nodes in cluster should cancel the running compaction
 	// also check if compact error after closed
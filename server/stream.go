@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	errStreamBlockNotSupported = errors.New("ERR the BLOCK option is not supported")
+	errStreamUnbalanced        = errors.New("ERR Unbalanced XREAD list of streams: for each stream key an ID or '$' must be specified.")
+	errStreamXGroupSyntax      = errors.New("ERR Unknown XGROUP subcommand or wrong number of arguments")
+)
+
+// rewrite the xgroup subcommands to make the stream key as the first argument, so
+// the command can be handled as the normal write command.
+// xgroup create key group id|$ [mkstream] => xgroupcreate key group id|$ [mkstream]
+// xgroup setid key group id|$ => xgroupsetid key group id|$
+// xgroup destroy key group => xgroupdestroy key group
+func rewriteXGroupCommand(cmd redcon.Command) (redcon.Command, error) {
+	if len(cmd.Args) < 4 {
+		return cmd, errStreamXGroupSyntax
+	}
+	var name string
+	switch strings.ToLower(string(cmd.Args[1])) {
+	case "create":
+		name = "xgroupcreate"
+	case "setid":
+		name = "xgroupsetid"
+	case "destroy":
+		name = "xgroupdestroy"
+	default:
+		return cmd, errStreamXGroupSyntax
+	}
+	args := make([][]byte, 0, len(cmd.Args)-1)
+	args = append(args, []byte(name))
+	args = append(args, cmd.Args[2:]...)
+	return common.BuildCommand(args), nil
+}
+
+type streamReadResult struct {
+	key     []byte
+	entries []rockredis.StreamEntry
+}
+
+// xread [COUNT count] STREAMS key [key ...] id [id ...]
+// xreadgroup GROUP group consumer [COUNT count] [NOACK] STREAMS key [key ...] id [id ...]
+// The keys can be in different partitions, and each key will be read on its own partition.
+func (s *Server) doStreamReadCmd(conn redcon.Conn, authUser *common.AuthUser, cmdName string, cmd redcon.Command) {
+	isGroup := cmdName == "xreadgroup"
+	var group, consumer []byte
+	count := 0
+	noAck := false
+	i := 1
+	for ; i < len(cmd.Args); i++ {
+		opt := strings.ToLower(string(cmd.Args[i]))
+		if opt == "streams" {
+			i++
+			break
+		}
+		switch {
+		case opt == "count" && i+1 < len(cmd.Args):
+			n, err := strconv.Atoi(string(cmd.Args[i+1]))
+			if err != nil {
+				conn.WriteError(common.ErrInvalidArgs.Error())
+				return
+			}
+			count = n
+			i++
+		case opt == "block":
+			conn.WriteError(errStreamBlockNotSupported.Error())
+			return
+		case isGroup && opt == "group" && i+2 < len(cmd.Args):
+			group = cmd.Args[i+1]
+			consumer = cmd.Args[i+2]
+			i += 2
+		case isGroup && opt == "noack":
+			noAck = true
+		default:
+			conn.WriteError("ERR syntax error")
+			return
+		}
+	}
+	if isGroup && group == nil {
+		conn.WriteError("ERR syntax error")
+		return
+	}
+	streams := cmd.Args[i:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		conn.WriteError(errStreamUnbalanced.Error())
+		return
+	}
+	keys := streams[:len(streams)/2]
+	ids := streams[len(streams)/2:]
+	if err := checkUserAccessKeys(authUser, keys, isGroup); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if isGroup && node.IsSyncerOnly() {
+		conn.WriteError("The cluster is only allowing syncer write : ERR handle command " + cmdName)
+		return
+	}
+
+	results := make([]streamReadResult, 0, len(keys))
+	for idx, k := range keys {
+		ns, pk, err := common.ExtractNamesapce(k)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKeySum(ns, pk, node.HashedKey(pk))
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		var entries []rockredis.StreamEntry
+		if isGroup {
+			entries, err = n.Node.StreamReadGroup(pk, group, consumer, ids[idx], count, noAck)
+		} else {
+			if err := checkReadOnNode(n.Node); err != nil {
+				conn.WriteError(err.Error())
+				return
+			}
+			entries, err = n.Node.StreamRead(pk, ids[idx], count)
+		}
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		// the history of the consumer is always returned even if it is empty
+		isHistory := isGroup && string(ids[idx]) != ">"
+		if len(entries) > 0 || isHistory {
+			results = append(results, streamReadResult{key: k, entries: entries})
+		}
+	}
+	if len(results) == 0 {
+		conn.WriteArray(-1)
+		return
+	}
+	conn.WriteArray(len(results))
+	for _, r := range results {
+		conn.WriteArray(2)
+		conn.WriteBulk(r.key)
+		node.WriteStreamEntries(conn, r.entries)
+	}
+}
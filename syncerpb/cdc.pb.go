@@ -0,0 +1,1707 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: cdc.proto
+
+package syncerpb
+
+import (
+	context "context"
+	fmt "fmt"
+	_ "github.com/gogo/protobuf/gogoproto"
+	proto "github.com/gogo/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+// the change event for a key decoded from the committed raft log
+type CDCEvent struct {
+	// namespace without partition
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Partition int32  `protobuf:"varint,2,opt,name=partition,proto3" json:"partition,omitempty"`
+	Table     string `protobuf:"bytes,3,opt,name=table,proto3" json:"table,omitempty"`
+	// the key with table prefix, table:key
+	Key     []byte `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	Command string `protobuf:"bytes,5,opt,name=command,proto3" json:"command,omitempty"`
+	// the arguments after the key in the command
+	Args      [][]byte `protobuf:"bytes,6,rep,name=args,proto3" json:"args,omitempty"`
+	Term      uint64   `protobuf:"varint,7,opt,name=term,proto3" json:"term,omitempty"`
+	Index     uint64   `protobuf:"varint,8,opt,name=index,proto3" json:"index,omitempty"`
+	Timestamp int64    `protobuf:"varint,9,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *CDCEvent) Reset()         { *m = CDCEvent{} }
+func (m *CDCEvent) String() string { return proto.CompactTextString(m) }
+func (*CDCEvent) ProtoMessage()    {}
+func (*CDCEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0d2e9f7929c73d8, []int{0}
+}
+func (m *CDCEvent) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CDCEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CDCEvent.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CDCEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CDCEvent.Merge(m, src)
+}
+func (m *CDCEvent) XXX_Size() int {
+	return m.Size()
+}
+func (m *CDCEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_CDCEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CDCEvent proto.InternalMessageInfo
+
+type CDCEventBatch struct {
+	Events []CDCEvent `protobuf:"bytes,1,rep,name=events,proto3" json:"events"`
+}
+
+func (m *CDCEventBatch) Reset()         { *m = CDCEventBatch{} }
+func (m *CDCEventBatch) String() string { return proto.CompactTextString(m) }
+func (*CDCEventBatch) ProtoMessage()    {}
+func (*CDCEventBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0d2e9f7929c73d8, []int{1}
+}
+func (m *CDCEventBatch) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CDCEventBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CDCEventBatch.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CDCEventBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CDCEventBatch.Merge(m, src)
+}
+func (m *CDCEventBatch) XXX_Size() int {
+	return m.Size()
+}
+func (m *CDCEventBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_CDCEventBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CDCEventBatch proto.InternalMessageInfo
+
+type CDCSubscribeReq struct {
+	Consumer string `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	// raft group name for the partition, namespace-partition
+	RaftGroupName string `protobuf:"bytes,2,opt,name=raft_group_name,json=raftGroupName,proto3" json:"raft_group_name,omitempty"`
+	// the raft index to start with, 0 means resume from the committed position of the consumer
+	StartIndex uint64 `protobuf:"varint,3,opt,name=start_index,json=startIndex,proto3" json:"start_index,omitempty"`
+}
+
+func (m *CDCSubscribeReq) Reset()         { *m = CDCSubscribeReq{} }
+func (m *CDCSubscribeReq) String() string { return proto.CompactTextString(m) }
+func (*CDCSubscribeReq) ProtoMessage()    {}
+func (*CDCSubscribeReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0d2e9f7929c73d8, []int{2}
+}
+func (m *CDCSubscribeReq) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CDCSubscribeReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CDCSubscribeReq.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CDCSubscribeReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CDCSubscribeReq.Merge(m, src)
+}
+func (m *CDCSubscribeReq) XXX_Size() int {
+	return m.Size()
+}
+func (m *CDCSubscribeReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_CDCSubscribeReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CDCSubscribeReq proto.InternalMessageInfo
+
+type CDCPositionReq struct {
+	Consumer      string `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	RaftGroupName string `protobuf:"bytes,2,opt,name=raft_group_name,json=raftGroupName,proto3" json:"raft_group_name,omitempty"`
+}
+
+func (m *CDCPositionReq) Reset()         { *m = CDCPositionReq{} }
+func (m *CDCPositionReq) String() string { return proto.CompactTextString(m) }
+func (*CDCPositionReq) ProtoMessage()    {}
+func (*CDCPositionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0d2e9f7929c73d8, []int{3}
+}
+func (m *CDCPositionReq) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CDCPositionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CDCPositionReq.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CDCPositionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CDCPositionReq.Merge(m, src)
+}
+func (m *CDCPositionReq) XXX_Size() int {
+	return m.Size()
+}
+func (m *CDCPositionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_CDCPositionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CDCPositionReq proto.InternalMessageInfo
+
+type CDCPosition struct {
+	Consumer      string `protobuf:"bytes,1,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	RaftGroupName string `protobuf:"bytes,2,opt,name=raft_group_name,json=raftGroupName,proto3" json:"raft_group_name,omitempty"`
+	// the raft term-index of the last event handled by the consumer
+	Term  uint64 `protobuf:"varint,3,opt,name=term,proto3" json:"term,omitempty"`
+	Index uint64 `protobuf:"varint,4,opt,name=index,proto3" json:"index,omitempty"`
+}
+
+func (m *CDCPosition) Reset()         { *m = CDCPosition{} }
+func (m *CDCPosition) String() string { return proto.CompactTextString(m) }
+func (*CDCPosition) ProtoMessage()    {}
+func (*CDCPosition) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0d2e9f7929c73d8, []int{4}
+}
+func (m *CDCPosition) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CDCPosition) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CDCPosition.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CDCPosition) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CDCPosition.Merge(m, src)
+}
+func (m *CDCPosition) XXX_Size() int {
+	return m.Size()
+}
+func (m *CDCPosition) XXX_DiscardUnknown() {
+	xxx_messageInfo_CDCPosition.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CDCPosition proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*CDCEvent)(nil), "syncerpb.CDCEvent")
+	proto.RegisterType((*CDCEventBatch)(nil), "syncerpb.CDCEventBatch")
+	proto.RegisterType((*CDCSubscribeReq)(nil), "syncerpb.CDCSubscribeReq")
+	proto.RegisterType((*CDCPositionReq)(nil), "syncerpb.CDCPositionReq")
+	proto.RegisterType((*CDCPosition)(nil), "syncerpb.CDCPosition")
+}
+
+func init() { proto.RegisterFile("cdc.proto", fileDescriptor_f0d2e9f7929c73d8) }
+
+var fileDescriptor_f0d2e9f7929c73d8 = []byte{
+	// 480 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x93, 0xbf, 0x6e, 0xdb, 0x3c,
+	0x14, 0xc5, 0xc5, 0x4f, 0xb6, 0x63, 0x5d, 0x3b, 0x7f, 0x40, 0xe4, 0x43, 0x59, 0xa3, 0x50, 0x04,
+	0x0d, 0x85, 0x26, 0x37, 0x48, 0xc7, 0x2e, 0x4d, 0xe8, 0x20, 0xc8, 0x52, 0x04, 0x6c, 0x77, 0x83,
+	0x96, 0x59, 0x57, 0x68, 0x29, 0xaa, 0x14, 0x1d, 0x34, 0xe8, 0x4b, 0xf4, 0xb1, 0x3c, 0x74, 0xf0,
+	0xd8, 0xa9, 0x68, 0xec, 0x3e, 0x48, 0x41, 0x2a, 0xb2, 0x1c, 0xc0, 0x63, 0xb6, 0x7b, 0x7e, 0xbc,
+	0x57, 0xe4, 0x3d, 0x07, 0x82, 0x20, 0x9d, 0xa6, 0xc3, 0x42, 0x2b, 0xa3, 0x70, 0xb7, 0xbc, 0xcb,
+	0x53, 0xa1, 0x8b, 0xc9, 0xe0, 0x78, 0xa6, 0x66, 0xca, 0xc1, 0x57, 0xb6, 0xaa, 0xce, 0x07, 0xfd,
+	0xea, 0xbc, 0x52, 0xf1, 0x5f, 0x04, 0x5d, 0x3a, 0xa2, 0x97, 0xb7, 0x22, 0x37, 0xf8, 0x05, 0x04,
+	0x39, 0x97, 0xa2, 0x2c, 0x78, 0x2a, 0x08, 0x8a, 0x50, 0x12, 0xb0, 0x06, 0xd8, 0xd3, 0x82, 0x6b,
+	0x93, 0x99, 0x4c, 0xe5, 0xe4, 0xbf, 0x08, 0x25, 0x6d, 0xd6, 0x00, 0x7c, 0x0c, 0x6d, 0xc3, 0x27,
+	0x5f, 0x04, 0xf1, 0xdd, 0x5c, 0x25, 0xf0, 0x11, 0xf8, 0x9f, 0xc5, 0x1d, 0x69, 0x45, 0x28, 0xe9,
+	0x33, 0x5b, 0x62, 0x02, 0x7b, 0xa9, 0x92, 0x92, 0xe7, 0x53, 0xd2, 0x76, 0x9d, 0xb5, 0xc4, 0x18,
+	0x5a, 0x5c, 0xcf, 0x4a, 0xd2, 0x89, 0xfc, 0xa4, 0xcf, 0x5c, 0x6d, 0x99, 0x11, 0x5a, 0x92, 0xbd,
+	0x08, 0x25, 0x2d, 0xe6, 0x6a, 0x7b, 0x53, 0x96, 0x4f, 0xc5, 0x37, 0xd2, 0x75, 0xb0, 0x12, 0xf6,
+	0x75, 0x26, 0x93, 0xa2, 0x34, 0x5c, 0x16, 0x24, 0x88, 0x50, 0xe2, 0xb3, 0x06, 0xc4, 0xe7, 0xb0,
+	0x5f, 0x6f, 0x79, 0xc1, 0x4d, 0xfa, 0x09, 0x9f, 0x42, 0x47, 0x58, 0x55, 0x12, 0x14, 0xf9, 0x49,
+	0xef, 0x0c, 0x0f, 0x6b, 0xdb, 0x86, 0x9b, 0xc6, 0xd6, 0xe2, 0xf7, 0x89, 0xc7, 0x1e, 0xfa, 0xe2,
+	0x5b, 0x38, 0xa4, 0x23, 0xfa, 0x7e, 0x3e, 0x29, 0x53, 0x9d, 0x4d, 0x04, 0x13, 0x5f, 0xf1, 0x00,
+	0xba, 0xa9, 0xca, 0xcb, 0xb9, 0x14, 0xfa, 0xc1, 0xae, 0x8d, 0xc6, 0x2f, 0xe1, 0x50, 0xf3, 0x8f,
+	0x66, 0x3c, 0xd3, 0x6a, 0x5e, 0x8c, 0xad, 0x8b, 0xce, 0xb3, 0x80, 0xed, 0x5b, 0x7c, 0x65, 0xe9,
+	0x3b, 0x2e, 0x05, 0x3e, 0x81, 0x5e, 0x69, 0xb8, 0x36, 0xe3, 0x6a, 0x27, 0xdf, 0xed, 0x04, 0x0e,
+	0x5d, 0x5b, 0x12, 0x7f, 0x80, 0x03, 0x3a, 0xa2, 0x37, 0xaa, 0x74, 0x3e, 0x3f, 0xd1, 0xb5, 0xf1,
+	0x77, 0xe8, 0x6d, 0x7d, 0xf5, 0x49, 0x36, 0xa9, 0xb3, 0xf2, 0x77, 0x65, 0xd5, 0xda, 0xca, 0xea,
+	0xec, 0x27, 0x82, 0x0e, 0x1d, 0xd1, 0xf3, 0x9b, 0x6b, 0x4c, 0x21, 0xd8, 0x58, 0x8a, 0x9f, 0x3f,
+	0x0a, 0x61, 0xdb, 0xea, 0xc1, 0xb3, 0x1d, 0xf9, 0xd8, 0x20, 0x63, 0xef, 0x14, 0xe1, 0x37, 0x70,
+	0x40, 0x95, 0x94, 0x99, 0xd9, 0xec, 0xf3, 0xff, 0xa3, 0xf6, 0x1a, 0x0f, 0x8e, 0x1a, 0xcc, 0x8a,
+	0xf4, 0x52, 0xeb, 0xd8, 0xc3, 0x6f, 0xa1, 0x77, 0x25, 0x9a, 0x49, 0xb2, 0x73, 0xd2, 0x3e, 0x61,
+	0xf7, 0x37, 0x63, 0xef, 0x22, 0x5a, 0xdc, 0x87, 0xde, 0xf2, 0x3e, 0xf4, 0x16, 0xab, 0x10, 0x2d,
+	0x57, 0x21, 0xfa, 0xb3, 0x0a, 0xd1, 0x8f, 0x75, 0xe8, 0x2d, 0xd7, 0xa1, 0xf7, 0x6b, 0x1d, 0x7a,
+	0x93, 0x8e, 0xfb, 0xd9, 0x5e, 0xff, 0x1b, 0x00, 0x15, 0x9f, 0x68, 0x70, 0xa7, 0x03, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// CDCAPIClient is the client API for CDCAPI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CDCAPIClient interface {
+	Subscribe(ctx context.Context, in *CDCSubscribeReq, opts ...grpc.CallOption) (CDCAPI_SubscribeClient, error)
+	CommitPosition(ctx context.Context, in *CDCPosition, opts ...grpc.CallOption) (*RpcErr, error)
+	GetPosition(ctx context.Context, in *CDCPositionReq, opts ...grpc.CallOption) (*CDCPosition, error)
+}
+
+type cDCAPIClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCDCAPIClient(cc *grpc.ClientConn) CDCAPIClient {
+	return &cDCAPIClient{cc}
+}
+
+func (c *cDCAPIClient) Subscribe(ctx context.Context, in *CDCSubscribeReq, opts ...grpc.CallOption) (CDCAPI_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CDCAPI_serviceDesc.Streams[0], "/syncerpb.CDCAPI/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cDCAPISubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CDCAPI_SubscribeClient interface {
+	Recv() (*CDCEventBatch, error)
+	grpc.ClientStream
+}
+
+type cDCAPISubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *cDCAPISubscribeClient) Recv() (*CDCEventBatch, error) {
+	m := new(CDCEventBatch)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cDCAPIClient) CommitPosition(ctx context.Context, in *CDCPosition, opts ...grpc.CallOption) (*RpcErr, error) {
+	out := new(RpcErr)
+	err := c.cc.Invoke(ctx, "/syncerpb.CDCAPI/CommitPosition", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cDCAPIClient) GetPosition(ctx context.Context, in *CDCPositionReq, opts ...grpc.CallOption) (*CDCPosition, error) {
+	out := new(CDCPosition)
+	err := c.cc.Invoke(ctx, "/syncerpb.CDCAPI/GetPosition", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CDCAPIServer is the server API for CDCAPI service.
+type CDCAPIServer interface {
+	Subscribe(*CDCSubscribeReq, CDCAPI_SubscribeServer) error
+	CommitPosition(context.Context, *CDCPosition) (*RpcErr, error)
+	GetPosition(context.Context, *CDCPositionReq) (*CDCPosition, error)
+}
+
+// UnimplementedCDCAPIServer can be embedded to have forward compatible implementations.
+type UnimplementedCDCAPIServer struct {
+}
+
+func (*UnimplementedCDCAPIServer) Subscribe(req *CDCSubscribeReq, srv CDCAPI_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedCDCAPIServer) CommitPosition(ctx context.Context, req *CDCPosition) (*RpcErr, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitPosition not implemented")
+}
+func (*UnimplementedCDCAPIServer) GetPosition(ctx context.Context, req *CDCPositionReq) (*CDCPosition, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPosition not implemented")
+}
+
+func RegisterCDCAPIServer(s *grpc.Server, srv CDCAPIServer) {
+	s.RegisterService(&_CDCAPI_serviceDesc, srv)
+}
+
+func _CDCAPI_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CDCSubscribeReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CDCAPIServer).Subscribe(m, &cDCAPISubscribeServer{stream})
+}
+
+type CDCAPI_SubscribeServer interface {
+	Send(*CDCEventBatch) error
+	grpc.ServerStream
+}
+
+type cDCAPISubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *cDCAPISubscribeServer) Send(m *CDCEventBatch) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CDCAPI_CommitPosition_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CDCPosition)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CDCAPIServer).CommitPosition(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/syncerpb.CDCAPI/CommitPosition",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CDCAPIServer).CommitPosition(ctx, req.(*CDCPosition))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CDCAPI_GetPosition_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CDCPositionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CDCAPIServer).GetPosition(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/syncerpb.CDCAPI/GetPosition",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CDCAPIServer).GetPosition(ctx, req.(*CDCPositionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _CDCAPI_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "syncerpb.CDCAPI",
+	HandlerType: (*CDCAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CommitPosition",
+			Handler:    _CDCAPI_CommitPosition_Handler,
+		},
+		{
+			MethodName: "GetPosition",
+			Handler:    _CDCAPI_GetPosition_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _CDCAPI_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cdc.proto",
+}
+
+func (m *CDCEvent) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CDCEvent) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CDCEvent) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Timestamp != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Timestamp))
+		i--
+		dAtA[i] = 0x48
+	}
+	if m.Index != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Index))
+		i--
+		dAtA[i] = 0x40
+	}
+	if m.Term != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Term))
+		i--
+		dAtA[i] = 0x38
+	}
+	if len(m.Args) > 0 {
+		for iNdEx := len(m.Args) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Args[iNdEx])
+			copy(dAtA[i:], m.Args[iNdEx])
+			i = encodeVarintCdc(dAtA, i, uint64(len(m.Args[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if len(m.Command) > 0 {
+		i -= len(m.Command)
+		copy(dAtA[i:], m.Command)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Command)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.Key) > 0 {
+		i -= len(m.Key)
+		copy(dAtA[i:], m.Key)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Key)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Table) > 0 {
+		i -= len(m.Table)
+		copy(dAtA[i:], m.Table)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Table)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.Partition != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Partition))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Namespace) > 0 {
+		i -= len(m.Namespace)
+		copy(dAtA[i:], m.Namespace)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Namespace)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *CDCEventBatch) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CDCEventBatch) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CDCEventBatch) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Events) > 0 {
+		for iNdEx := len(m.Events) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Events[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintCdc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *CDCSubscribeReq) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CDCSubscribeReq) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CDCSubscribeReq) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.StartIndex != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.StartIndex))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.RaftGroupName) > 0 {
+		i -= len(m.RaftGroupName)
+		copy(dAtA[i:], m.RaftGroupName)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.RaftGroupName)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Consumer) > 0 {
+		i -= len(m.Consumer)
+		copy(dAtA[i:], m.Consumer)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Consumer)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *CDCPositionReq) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CDCPositionReq) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CDCPositionReq) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.RaftGroupName) > 0 {
+		i -= len(m.RaftGroupName)
+		copy(dAtA[i:], m.RaftGroupName)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.RaftGroupName)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Consumer) > 0 {
+		i -= len(m.Consumer)
+		copy(dAtA[i:], m.Consumer)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Consumer)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *CDCPosition) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CDCPosition) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CDCPosition) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Index != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Index))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Term != 0 {
+		i = encodeVarintCdc(dAtA, i, uint64(m.Term))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.RaftGroupName) > 0 {
+		i -= len(m.RaftGroupName)
+		copy(dAtA[i:], m.RaftGroupName)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.RaftGroupName)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Consumer) > 0 {
+		i -= len(m.Consumer)
+		copy(dAtA[i:], m.Consumer)
+		i = encodeVarintCdc(dAtA, i, uint64(len(m.Consumer)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintCdc(dAtA []byte, offset int, v uint64) int {
+	offset -= sovCdc(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *CDCEvent) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Namespace)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	if m.Partition != 0 {
+		n += 1 + sovCdc(uint64(m.Partition))
+	}
+	l = len(m.Table)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	l = len(m.Command)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	if len(m.Args) > 0 {
+		for _, b := range m.Args {
+			l = len(b)
+			n += 1 + l + sovCdc(uint64(l))
+		}
+	}
+	if m.Term != 0 {
+		n += 1 + sovCdc(uint64(m.Term))
+	}
+	if m.Index != 0 {
+		n += 1 + sovCdc(uint64(m.Index))
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sovCdc(uint64(m.Timestamp))
+	}
+	return n
+}
+
+func (m *CDCEventBatch) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Events) > 0 {
+		for _, e := range m.Events {
+			l = e.Size()
+			n += 1 + l + sovCdc(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *CDCSubscribeReq) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Consumer)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	l = len(m.RaftGroupName)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	if m.StartIndex != 0 {
+		n += 1 + sovCdc(uint64(m.StartIndex))
+	}
+	return n
+}
+
+func (m *CDCPositionReq) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Consumer)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	l = len(m.RaftGroupName)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	return n
+}
+
+func (m *CDCPosition) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Consumer)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	l = len(m.RaftGroupName)
+	if l > 0 {
+		n += 1 + l + sovCdc(uint64(l))
+	}
+	if m.Term != 0 {
+		n += 1 + sovCdc(uint64(m.Term))
+	}
+	if m.Index != 0 {
+		n += 1 + sovCdc(uint64(m.Index))
+	}
+	return n
+}
+
+func sovCdc(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozCdc(x uint64) (n int) {
+	return sovCdc(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *CDCEvent) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CDCEvent: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CDCEvent: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Namespace", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Namespace = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Partition", wireType)
+			}
+			m.Partition = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Partition |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Table", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Table = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = append(m.Key[:0], dAtA[iNdEx:postIndex]...)
+			if m.Key == nil {
+				m.Key = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Command", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Command = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Args", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Args = append(m.Args, make([]byte, postIndex-iNdEx))
+			copy(m.Args[len(m.Args)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Term", wireType)
+			}
+			m.Term = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Term |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Index", wireType)
+			}
+			m.Index = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Index |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCdc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CDCEventBatch) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CDCEventBatch: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CDCEventBatch: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Events", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Events = append(m.Events, CDCEvent{})
+			if err := m.Events[len(m.Events)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCdc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CDCSubscribeReq) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CDCSubscribeReq: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CDCSubscribeReq: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Consumer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Consumer = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RaftGroupName", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RaftGroupName = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartIndex", wireType)
+			}
+			m.StartIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StartIndex |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCdc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CDCPositionReq) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CDCPositionReq: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CDCPositionReq: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Consumer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Consumer = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RaftGroupName", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RaftGroupName = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCdc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *CDCPosition) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CDCPosition: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CDCPosition: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Consumer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Consumer = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RaftGroupName", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCdc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RaftGroupName = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Term", wireType)
+			}
+			m.Term = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Term |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Index", wireType)
+			}
+			m.Index = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Index |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCdc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCdc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipCdc(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowCdc
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowCdc
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthCdc
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupCdc
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthCdc
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthCdc        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowCdc          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupCdc = fmt.Errorf("proto: unexpected end of group")
+)
@@ -15,6 +15,7 @@
 package rafthttp
 
 import (
+	"crypto/tls"
 	"net/http"
 	"sync"
 	"time"
@@ -109,6 +110,9 @@ type Transporter interface {
 type Transport struct {
 	DialTimeout time.Duration     // maximum duration before timing out dial of the request
 	TLSInfo     transport.TLSInfo // TLS information used when creating connection
+	// TLSClientConfig is used instead of the TLSInfo if not nil, it allows
+	// the certificates reloaded without restart.
+	TLSClientConfig *tls.Config
 
 	ID          types.ID   // local member ID
 	URLs        types.URLs // local peer URLs
@@ -145,6 +149,13 @@ func (t *Transport) Start() error {
 	if err != nil {
 		return err
 	}
+	if t.TLSClientConfig != nil {
+		for _, rt := range []http.RoundTripper{t.streamRt, t.pipelineRt} {
+			if tr, ok := rt.(*http.Transport); ok {
+				tr.TLSClientConfig = t.TLSClientConfig
+			}
+		}
+	}
 	t.remotes = make(map[types.ID]*remote)
 	t.peers = make(map[types.ID]Peer)
 	t.prober = probing.NewProber(t.pipelineRt)